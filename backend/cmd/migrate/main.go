@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -15,6 +16,11 @@ import (
 
 	_ "github.com/lib/pq"
 	"github.com/spf13/cobra"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 )
 
 type Migration struct {
@@ -190,8 +196,26 @@ func (m *Migrator) rollbackMigration(version string) error {
 	return nil
 }
 
+// requireBypassRLS refuses to migrate as a role subject to row-level security.
+// The tenant policies fail closed, so data migrations run as such a role would
+// silently see no tenant rows.
+func (m *Migrator) requireBypassRLS() error {
+	var bypass bool
+	err := m.db.QueryRow("SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user").Scan(&bypass)
+	if err != nil {
+		return fmt.Errorf("failed to check database role: %w", err)
+	}
+	if !bypass {
+		return fmt.Errorf("migrations must run as a superuser or a role with BYPASSRLS")
+	}
+	return nil
+}
+
 // Up applies all pending migrations
 func (m *Migrator) Up() error {
+	if err := m.requireBypassRLS(); err != nil {
+		return err
+	}
 	if err := m.ensureMigrationsTable(); err != nil {
 		return fmt.Errorf("failed to ensure migrations table: %w", err)
 	}
@@ -235,6 +259,9 @@ func (m *Migrator) Up() error {
 
 // Down rolls back the last migration
 func (m *Migrator) Down() error {
+	if err := m.requireBypassRLS(); err != nil {
+		return err
+	}
 	applied, err := m.getAppliedMigrations()
 	if err != nil {
 		return fmt.Errorf("failed to get applied migrations: %w", err)
@@ -341,9 +368,47 @@ func (m *Migrator) DropTenantSchema(tenantSlug string) error {
 	return nil
 }
 
+// EnableTenantRLS creates the tenant row-level security policy on every table of
+// the schema with a tenant_id column, or only prints the SQL on a dry run
+func (m *Migrator) EnableTenantRLS(schema string, dryRun bool) error {
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: m.db}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	pg := &database.PostgresDB{DB: gormDB}
+	ctx := context.Background()
+
+	if dryRun {
+		tables, err := pg.TenantRLSTables(ctx, schema)
+		if err != nil {
+			return err
+		}
+		for _, table := range tables {
+			for _, statement := range database.TenantRLSStatements(schema, table) {
+				fmt.Println(statement + ";")
+			}
+		}
+		return nil
+	}
+
+	tables, err := pg.EnableTenantRLS(ctx, schema)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		log.Printf("Row-level security enabled on %s.%s", schema, table.Name)
+	}
+	log.Printf("Tenant policies created on %d tables", len(tables))
+	return nil
+}
+
 func main() {
 	var dbURL string
 	var migrationsPath string
+	var rlsSchema string
+	var rlsDryRun bool
 
 	rootCmd := &cobra.Command{
 		Use:   "migrate",
@@ -356,7 +421,7 @@ func main() {
 
 	upCmd := &cobra.Command{
 		Use:   "up",
-		Short: "Apply all pending migrations",
+		Short: "Apply all pending migrations and create tenant row-level security policies",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			db, err := sql.Open("postgres", dbURL)
 			if err != nil {
@@ -365,9 +430,14 @@ func main() {
 			defer db.Close()
 
 			migrator := NewMigrator(db, migrationsPath)
-			return migrator.Up()
+			if err := migrator.Up(); err != nil {
+				return err
+			}
+			// Tables added by the migrations get their tenant policies
+			return migrator.EnableTenantRLS(rlsSchema, false)
 		},
 	}
+	upCmd.Flags().StringVar(&rlsSchema, "rls-schema", "public", "Schema whose tables get tenant row-level security policies")
 
 	downCmd := &cobra.Command{
 		Use:   "down",
@@ -440,7 +510,24 @@ func main() {
 		},
 	}
 
-	rootCmd.AddCommand(upCmd, downCmd, statusCmd, createTenantCmd, dropTenantCmd)
+	rlsCmd := &cobra.Command{
+		Use:   "rls",
+		Short: "Create tenant row-level security policies on every table with a tenant_id column",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := sql.Open("postgres", dbURL)
+			if err != nil {
+				return fmt.Errorf("failed to connect to database: %w", err)
+			}
+			defer db.Close()
+
+			migrator := NewMigrator(db, migrationsPath)
+			return migrator.EnableTenantRLS(rlsSchema, rlsDryRun)
+		},
+	}
+	rlsCmd.Flags().StringVar(&rlsSchema, "schema", "public", "Schema whose tables get policies")
+	rlsCmd.Flags().BoolVar(&rlsDryRun, "dry-run", false, "Print the SQL instead of running it")
+
+	rootCmd.AddCommand(upCmd, downCmd, statusCmd, createTenantCmd, dropTenantCmd, rlsCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
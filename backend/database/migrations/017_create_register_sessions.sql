@@ -0,0 +1,47 @@
+-- Register sessions track a shift at a POS register from opening float to close.
+-- The Z report taken at close is stored on the session itself. Cash put into or
+-- taken out of the drawer outside a sale is kept in cash_movements.
+CREATE TABLE IF NOT EXISTS register_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id VARCHAR(50) NOT NULL,
+    location_id UUID,
+    register_name VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'open', -- open, closed
+    opening_float DECIMAL(15,2) NOT NULL DEFAULT 0,
+    expected_cash DECIMAL(15,2) NOT NULL DEFAULT 0,
+    counted_cash DECIMAL(15,2),
+    cash_variance DECIMAL(15,2) NOT NULL DEFAULT 0,
+    opened_by UUID NOT NULL,
+    closed_by UUID,
+    opened_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    closed_at TIMESTAMP WITH TIME ZONE,
+    z_report JSONB,
+    notes TEXT,
+    metadata JSONB DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_register_sessions_tenant_id ON register_sessions (tenant_id);
+
+CREATE TABLE IF NOT EXISTS cash_movements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id VARCHAR(50) NOT NULL,
+    session_id UUID NOT NULL REFERENCES register_sessions(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL, -- cash_in, cash_out
+    amount DECIMAL(15,2) NOT NULL,
+    reason TEXT,
+    user_id UUID,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_cash_movements_session_id ON cash_movements (session_id);
+
+-- Payments and refunds taken at a register are totalled into its reports
+DO $$
+BEGIN
+    IF to_regclass('payment_transactions') IS NOT NULL THEN
+        ALTER TABLE payment_transactions ADD COLUMN IF NOT EXISTS register_session_id UUID REFERENCES register_sessions(id);
+        CREATE INDEX IF NOT EXISTS idx_payment_transactions_register_session_id ON payment_transactions (register_session_id);
+    END IF;
+END $$;
@@ -0,0 +1,9 @@
+DO $$
+BEGIN
+    IF to_regclass('payment_transactions') IS NOT NULL THEN
+        ALTER TABLE payment_transactions DROP COLUMN IF EXISTS register_session_id;
+    END IF;
+END $$;
+
+DROP TABLE IF EXISTS cash_movements;
+DROP TABLE IF EXISTS register_sessions;
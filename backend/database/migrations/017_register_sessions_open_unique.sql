@@ -0,0 +1,5 @@
+-- A register can only have one open session at a time. Sessions opened without
+-- a location share the nil UUID so they are held to the same rule.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_register_sessions_open
+    ON register_sessions (tenant_id, COALESCE(location_id, '00000000-0000-0000-0000-000000000000'::uuid), register_name)
+    WHERE status = 'open';
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_register_sessions_open;
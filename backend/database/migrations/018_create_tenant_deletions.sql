@@ -0,0 +1,30 @@
+-- Tenant deletions record a tenant's scheduled deletion through the grace
+-- period, the export of its data and the purge. The row outlives the tenant and
+-- holds the signed certificate of the purge, so it does not reference tenants.
+CREATE TABLE IF NOT EXISTS tenant_deletions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL,
+    tenant_name VARCHAR(255),
+    subdomain VARCHAR(255),
+    status VARCHAR(50) NOT NULL DEFAULT 'scheduled', -- scheduled, cancelled, purging, purged
+    previous_status VARCHAR(50),
+    reason TEXT,
+    requested_by UUID,
+    requested_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    purge_after TIMESTAMP WITH TIME ZONE NOT NULL,
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    archive_path TEXT,
+    archive_sha256 VARCHAR(64),
+    archive_size BIGINT DEFAULT 0,
+    exported_at TIMESTAMP WITH TIME ZONE,
+    purge_summary JSONB,
+    purged_at TIMESTAMP WITH TIME ZONE,
+    certificate TEXT,
+    certificate_signature TEXT,
+    error_message TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_deletions_tenant_id ON tenant_deletions (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_tenant_deletions_purge_after ON tenant_deletions (purge_after);
@@ -0,0 +1,5 @@
+-- A tenant can only have one deletion that is scheduled or being purged, so two
+-- concurrent deletion requests cannot both schedule one.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenant_deletions_open
+    ON tenant_deletions (tenant_id)
+    WHERE status IN ('scheduled', 'purging');
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_tenant_deletions_open;
@@ -0,0 +1,20 @@
+-- Tenant row-level security policies fail closed: a session that has not set
+-- app.current_tenant reaches no tenant rows. Platform jobs that work across
+-- tenants switch to this role, which bypasses the policies, with SET LOCAL ROLE.
+-- Role attributes are not inherited, so members stay subject to the policies
+-- until they switch. The role running the migrations is made a member; grant the
+-- role to the application's database user too when that is a different one.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'zplus_platform') THEN
+        CREATE ROLE zplus_platform NOLOGIN BYPASSRLS;
+    END IF;
+END
+$$;
+
+GRANT zplus_platform TO CURRENT_USER;
+GRANT USAGE ON SCHEMA public TO zplus_platform;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO zplus_platform;
+GRANT USAGE, SELECT, UPDATE ON ALL SEQUENCES IN SCHEMA public TO zplus_platform;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO zplus_platform;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT, UPDATE ON SEQUENCES TO zplus_platform;
@@ -0,0 +1,8 @@
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'zplus_platform') THEN
+        DROP OWNED BY zplus_platform;
+        DROP ROLE zplus_platform;
+    END IF;
+END
+$$;
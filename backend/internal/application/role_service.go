@@ -323,3 +323,11 @@ func (s *RoleService) InitializeTenantRoles(ctx context.Context, tenantID uuid.U
 	}
 	return nil
 }
+
+// RemoveTenantRoles deletes a tenant's roles and their policies
+func (s *RoleService) RemoveTenantRoles(ctx context.Context, tenantID uuid.UUID) error {
+	if err := s.casbinService.DeleteTenantRoles(ctx, tenantID); err != nil {
+		return fmt.Errorf("failed to remove tenant roles: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+)
+
+var (
+	ErrInvalidBarcode = errors.New("invalid barcode")
+	ErrInvalidGS1     = errors.New("invalid GS1-128 data")
+)
+
+// Code128 carries at most 48 data characters in practice; longer codes do not
+// fit on a shelf label at a scannable module width
+const maxCode128Length = 48
+
+// gs1Separator is the FNC1 character scanners transmit as ASCII GS to end a
+// variable-length GS1 element
+const gs1Separator = "\x1d"
+
+// gs1SymbologyPrefix is the AIM identifier scanners prepend to GS1-128 reads
+const gs1SymbologyPrefix = "]C1"
+
+// GS1 application identifiers used at the point of sale
+const (
+	GS1AIGTIN       = "01"
+	GS1AIBatch      = "10"
+	GS1AIBestBefore = "15"
+	GS1AIExpiry     = "17"
+	GS1AISerial     = "21"
+	GS1AICount      = "30"
+	GS1AINetKg      = "310" // fourth digit is the number of decimals
+	GS1AINetLb      = "320" // fourth digit is the number of decimals
+	GS1AIPrice      = "392" // fourth digit is the number of decimals
+	GS1AIPriceISO   = "393" // fourth digit is the number of decimals; prefixed by an ISO 4217 numeric code
+)
+
+const poundsToKilograms = 0.45359237
+
+// gs1AI describes how an application identifier's data is delimited
+type gs1AI struct {
+	length int // length of the AI itself
+	fixed  int // fixed data length, or 0 when variable
+	max    int // maximum variable data length
+}
+
+// gs1AIs lists the identifiers the parser understands by their two-digit prefix
+var gs1AIs = map[string]gs1AI{
+	"00": {length: 2, fixed: 18},
+	"01": {length: 2, fixed: 14},
+	"02": {length: 2, fixed: 14},
+	"10": {length: 2, max: 20},
+	"11": {length: 2, fixed: 6},
+	"13": {length: 2, fixed: 6},
+	"15": {length: 2, fixed: 6},
+	"17": {length: 2, fixed: 6},
+	"21": {length: 2, max: 20},
+	"30": {length: 2, max: 8},
+	"31": {length: 4, fixed: 6},
+	"32": {length: 4, fixed: 6},
+	"37": {length: 2, max: 8},
+	"39": {length: 4, max: 18},
+}
+
+// GS1Data is the decoded content of a GS1-128 barcode
+type GS1Data struct {
+	GTIN       string     `json:"gtin,omitempty"`
+	Batch      string     `json:"batch,omitempty"`
+	Serial     string     `json:"serial,omitempty"`
+	BestBefore *time.Time `json:"best_before,omitempty"`
+	Expiry     *time.Time `json:"expiry,omitempty"`
+	Count      *int       `json:"count,omitempty"`
+	// NetWeight is in kilograms, converted from pounds when encoded as AI 320n
+	NetWeight *float64 `json:"net_weight,omitempty"`
+	// Price is the amount payable printed by a scale, in the tenant's currency
+	// unless Currency holds an ISO 4217 numeric code
+	Price    *float64 `json:"price,omitempty"`
+	Currency string   `json:"currency,omitempty"`
+	// Elements holds every element read, keyed by application identifier
+	Elements map[string]string `json:"elements"`
+}
+
+// GTINCheckDigit computes the GS1 mod-10 check digit for the digits preceding it
+func GTINCheckDigit(digits string) (int, error) {
+	if digits == "" || !isDigits(digits) {
+		return 0, fmt.Errorf("%w: %q is not numeric", ErrInvalidBarcode, digits)
+	}
+	sum := 0
+	weight := 3
+	for i := len(digits) - 1; i >= 0; i-- {
+		sum += int(digits[i]-'0') * weight
+		weight = 4 - weight
+	}
+	return (10 - sum%10) % 10, nil
+}
+
+// ValidateBarcode checks code against its symbology, including the check digit
+// for EAN-13 and UPC-A
+func ValidateBarcode(symbology, code string) error {
+	switch symbology {
+	case domain.BarcodeSymbologyEAN13:
+		return validateGTIN(code, 13)
+	case domain.BarcodeSymbologyUPCA:
+		return validateGTIN(code, 12)
+	case domain.BarcodeSymbologyCode128:
+		if code == "" || len(code) > maxCode128Length {
+			return fmt.Errorf("%w: Code128 must be 1 to %d characters", ErrInvalidBarcode, maxCode128Length)
+		}
+		for _, r := range code {
+			if r < 32 || r > 126 {
+				return fmt.Errorf("%w: Code128 supports printable ASCII only", ErrInvalidBarcode)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported symbology %q", ErrInvalidBarcode, symbology)
+	}
+}
+
+// DetectSymbology picks the symbology for a code when none is given: numeric
+// codes with a valid check digit are EAN-13 or UPC-A, anything else Code128
+func DetectSymbology(code string) string {
+	switch {
+	case len(code) == 13 && validateGTIN(code, 13) == nil:
+		return domain.BarcodeSymbologyEAN13
+	case len(code) == 12 && validateGTIN(code, 12) == nil:
+		return domain.BarcodeSymbologyUPCA
+	default:
+		return domain.BarcodeSymbologyCode128
+	}
+}
+
+func validateGTIN(code string, length int) error {
+	if len(code) != length || !isDigits(code) {
+		return fmt.Errorf("%w: expected %d digits", ErrInvalidBarcode, length)
+	}
+	check, _ := GTINCheckDigit(code[:length-1])
+	if int(code[length-1]-'0') != check {
+		return fmt.Errorf("%w: check digit should be %d", ErrInvalidBarcode, check)
+	}
+	return nil
+}
+
+// gtinCandidates returns the stored forms a scanned numeric code may match.
+// A UPC-A is an EAN-13 with a leading zero and a GTIN-14 pads either with
+// zeros, so scanners and catalogs disagree on how many zeros to keep
+func gtinCandidates(code string) []string {
+	candidates := []string{code}
+	if !isDigits(code) || len(code) < 12 || len(code) > 14 {
+		return candidates
+	}
+	trimmed := strings.TrimLeft(code, "0")
+	for _, length := range []int{14, 13, 12} {
+		if len(trimmed) > length {
+			break
+		}
+		padded := strings.Repeat("0", length-len(trimmed)) + trimmed
+		if padded != code {
+			candidates = append(candidates, padded)
+		}
+	}
+	return candidates
+}
+
+// IsGS1 reports whether a scan looks like GS1-128 element strings rather than
+// a plain code: a ]C1 symbology prefix, bracketed AIs, FNC1 separators, or a
+// GTIN element followed by further data
+func IsGS1(scan string) bool {
+	if strings.HasPrefix(scan, gs1SymbologyPrefix) || strings.Contains(scan, gs1Separator) {
+		return true
+	}
+	if strings.HasPrefix(scan, "(") && strings.Contains(scan, ")") {
+		return true
+	}
+	return len(scan) > 16 && strings.HasPrefix(scan, GS1AIGTIN) && validateGTIN(scan[2:16], 14) == nil
+}
+
+// ParseGS1 decodes GS1-128 element strings in either the raw scanner form
+// (FNC1 as ASCII GS) or the human-readable bracketed form, e.g.
+// "(01)09501101530003(3103)001250(3922)1499"
+func ParseGS1(scan string) (*GS1Data, error) {
+	scan = strings.TrimPrefix(scan, gs1SymbologyPrefix)
+	if scan == "" {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidGS1)
+	}
+
+	var elements [][2]string
+	var err error
+	if strings.HasPrefix(scan, "(") {
+		elements, err = splitBracketedGS1(scan)
+	} else {
+		elements, err = splitRawGS1(scan)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := &GS1Data{Elements: make(map[string]string, len(elements))}
+	for _, element := range elements {
+		if err := data.apply(element[0], element[1]); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func splitBracketedGS1(scan string) ([][2]string, error) {
+	var elements [][2]string
+	rest := scan
+	for rest != "" {
+		if rest[0] != '(' {
+			return nil, fmt.Errorf("%w: expected ( at %q", ErrInvalidGS1, rest)
+		}
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unterminated application identifier", ErrInvalidGS1)
+		}
+		ai := rest[1:end]
+		rest = rest[end+1:]
+		next := strings.IndexByte(rest, '(')
+		if next < 0 {
+			next = len(rest)
+		}
+		value := strings.TrimSuffix(rest[:next], gs1Separator)
+		rest = rest[next:]
+
+		spec, ok := lookupGS1AI(ai)
+		if !ok || len(ai) != spec.length {
+			return nil, fmt.Errorf("%w: unsupported application identifier %s", ErrInvalidGS1, ai)
+		}
+		if err := checkGS1Length(ai, value, spec); err != nil {
+			return nil, err
+		}
+		elements = append(elements, [2]string{ai, value})
+	}
+	return elements, nil
+}
+
+func splitRawGS1(scan string) ([][2]string, error) {
+	var elements [][2]string
+	rest := scan
+	for rest != "" {
+		rest = strings.TrimPrefix(rest, gs1Separator)
+		if rest == "" {
+			break
+		}
+		spec, ok := lookupGS1AI(rest)
+		if !ok || len(rest) < spec.length {
+			return nil, fmt.Errorf("%w: unsupported application identifier at %q", ErrInvalidGS1, rest)
+		}
+		ai := rest[:spec.length]
+		rest = rest[spec.length:]
+
+		var value string
+		if spec.fixed > 0 {
+			if len(rest) < spec.fixed {
+				return nil, fmt.Errorf("%w: AI %s needs %d characters", ErrInvalidGS1, ai, spec.fixed)
+			}
+			value, rest = rest[:spec.fixed], rest[spec.fixed:]
+		} else {
+			end := strings.Index(rest, gs1Separator)
+			if end < 0 {
+				end = len(rest)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+		if err := checkGS1Length(ai, value, spec); err != nil {
+			return nil, err
+		}
+		elements = append(elements, [2]string{ai, value})
+	}
+	return elements, nil
+}
+
+func lookupGS1AI(data string) (gs1AI, bool) {
+	if len(data) < 2 {
+		return gs1AI{}, false
+	}
+	spec, ok := gs1AIs[data[:2]]
+	return spec, ok
+}
+
+func checkGS1Length(ai, value string, spec gs1AI) error {
+	if spec.fixed > 0 && len(value) != spec.fixed {
+		return fmt.Errorf("%w: AI %s needs %d characters", ErrInvalidGS1, ai, spec.fixed)
+	}
+	if spec.max > 0 && (value == "" || len(value) > spec.max) {
+		return fmt.Errorf("%w: AI %s takes 1 to %d characters", ErrInvalidGS1, ai, spec.max)
+	}
+	return nil
+}
+
+func (d *GS1Data) apply(ai, value string) error {
+	d.Elements[ai] = value
+
+	switch {
+	case ai == GS1AIGTIN:
+		if err := validateGTIN(value, 14); err != nil {
+			return fmt.Errorf("%w: GTIN %s", ErrInvalidGS1, err)
+		}
+		d.GTIN = value
+	case ai == GS1AIBatch:
+		d.Batch = value
+	case ai == GS1AISerial:
+		d.Serial = value
+	case ai == GS1AIBestBefore, ai == GS1AIExpiry:
+		date, err := parseGS1Date(value)
+		if err != nil {
+			return fmt.Errorf("%w: AI %s date %q", ErrInvalidGS1, ai, value)
+		}
+		if ai == GS1AIExpiry {
+			d.Expiry = &date
+		} else {
+			d.BestBefore = &date
+		}
+	case ai == GS1AICount:
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%w: count %q", ErrInvalidGS1, value)
+		}
+		d.Count = &count
+	case strings.HasPrefix(ai, GS1AINetKg), strings.HasPrefix(ai, GS1AINetLb):
+		weight, err := gs1Decimal(ai, value)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(ai, GS1AINetLb) {
+			weight = math.Round(weight*poundsToKilograms*1000) / 1000
+		}
+		d.NetWeight = &weight
+	case strings.HasPrefix(ai, GS1AIPrice):
+		price, err := gs1Decimal(ai, value)
+		if err != nil {
+			return err
+		}
+		d.Price = &price
+	case strings.HasPrefix(ai, GS1AIPriceISO):
+		if len(value) < 4 {
+			return fmt.Errorf("%w: AI %s needs a currency and an amount", ErrInvalidGS1, ai)
+		}
+		price, err := gs1Decimal(ai, value[3:])
+		if err != nil {
+			return err
+		}
+		d.Currency = value[:3]
+		d.Price = &price
+	}
+	return nil
+}
+
+// gs1Decimal reads a numeric value whose decimal places are given by the
+// fourth digit of its application identifier
+func gs1Decimal(ai, value string) (float64, error) {
+	if len(ai) != 4 || !isDigits(value) {
+		return 0, fmt.Errorf("%w: AI %s value %q is not numeric", ErrInvalidGS1, ai, value)
+	}
+	decimals := int(ai[3] - '0')
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: AI %s value %q", ErrInvalidGS1, ai, value)
+	}
+	return float64(amount) / math.Pow10(decimals), nil
+}
+
+// parseGS1Date reads YYMMDD. A day of 00 means the last day of the month, and
+// the century is chosen within the GS1 sliding window of -49/+50 years
+func parseGS1Date(value string) (time.Time, error) {
+	if len(value) != 6 || !isDigits(value) {
+		return time.Time{}, errors.New("date must be YYMMDD")
+	}
+	yy, _ := strconv.Atoi(value[0:2])
+	month, _ := strconv.Atoi(value[2:4])
+	day, _ := strconv.Atoi(value[4:6])
+	if month < 1 || month > 12 {
+		return time.Time{}, errors.New("month out of range")
+	}
+
+	current := time.Now().Year()
+	year := current/100*100 + yy
+	switch diff := year - current; {
+	case diff > 50:
+		year -= 100
+	case diff < -49:
+		year += 100
+	}
+
+	if day == 0 {
+		return time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC), nil
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Day() != day {
+		return time.Time{}, errors.New("day out of range")
+	}
+	return date, nil
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+)
+
+// Barcode label output formats
+const (
+	BarcodeLabelFormatPNG = "png"
+	BarcodeLabelFormatSVG = "svg"
+)
+
+// Label geometry in modules (the width of the narrowest bar)
+const (
+	barcodeQuietZone  = 10
+	barcodeBarHeight  = 60
+	barcodeGuardExtra = 5 // EAN/UPC guard bars extend below the others
+	barcodeTextHeight = 14
+	barcodeTitleSize  = 12
+	barcodeMaxScale   = 10
+)
+
+// eanLeftOdd holds the L-code patterns for digits 0-9; G- and R-codes derive from them
+var eanLeftOdd = [10]string{
+	"0001101", "0011001", "0010011", "0111101", "0100011",
+	"0110001", "0101111", "0111011", "0110111", "0001011",
+}
+
+// eanParity selects L (odd) or G (even) encoding for the six left-hand digits
+// from the leading digit of an EAN-13, which is not itself drawn
+var eanParity = [10]string{
+	"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG",
+	"LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL",
+}
+
+// code128Patterns holds the bar/space widths of Code128 symbol values 0-106
+var code128Patterns = [107]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128StartB = 104
+	code128StartC = 105
+	code128CodeB  = 100
+	code128CodeC  = 99
+	code128Stop   = 106
+)
+
+// BarcodeLabel is the content of a printable shelf or product label
+type BarcodeLabel struct {
+	Code      string
+	Symbology string
+	Title     string
+	Price     string
+}
+
+// BarcodeRenderer draws barcodes as PNG or SVG label images
+type BarcodeRenderer struct{}
+
+// NewBarcodeRenderer creates a new barcode renderer
+func NewBarcodeRenderer() *BarcodeRenderer {
+	return &BarcodeRenderer{}
+}
+
+// barcodeSymbol is an encoded barcode: one entry per module, true for a bar
+type barcodeSymbol struct {
+	modules []bool
+	// guards marks modules drawn at full height as EAN/UPC guard bars
+	guards []bool
+}
+
+// RenderPNG draws the bars of a label at scale pixels per module. PNG labels
+// carry no text, as there is no font renderer on the server; use SVG when the
+// human-readable line is needed
+func (r *BarcodeRenderer) RenderPNG(label *BarcodeLabel, scale int) ([]byte, error) {
+	symbol, err := encodeBarcode(label.Symbology, label.Code)
+	if err != nil {
+		return nil, err
+	}
+	scale = clampScale(scale)
+
+	width := (len(symbol.modules) + 2*barcodeQuietZone) * scale
+	height := (barcodeBarHeight + barcodeGuardExtra + barcodeQuietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+
+	top := barcodeQuietZone / 2 * scale
+	for i, bar := range symbol.modules {
+		if !bar {
+			continue
+		}
+		barHeight := barcodeBarHeight
+		if symbol.guards != nil && symbol.guards[i] {
+			barHeight += barcodeGuardExtra
+		}
+		x0 := (barcodeQuietZone + i) * scale
+		for y := top; y < top+barHeight*scale; y++ {
+			for x := x0; x < x0+scale; x++ {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode barcode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderSVG draws a label with its title, bars, human-readable code and price
+func (r *BarcodeRenderer) RenderSVG(label *BarcodeLabel, scale int) ([]byte, error) {
+	symbol, err := encodeBarcode(label.Symbology, label.Code)
+	if err != nil {
+		return nil, err
+	}
+	scale = clampScale(scale)
+
+	width := len(symbol.modules) + 2*barcodeQuietZone
+	top := barcodeQuietZone / 2
+	if label.Title != "" {
+		top += barcodeTitleSize + 2
+	}
+	height := top + barcodeBarHeight + barcodeTextHeight + barcodeQuietZone/2
+	if label.Price != "" {
+		height += barcodeTitleSize + 2
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		width*scale, height*scale, width, height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`, width, height)
+	if label.Title != "" {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-family="sans-serif" font-size="%d" text-anchor="middle">%s</text>`,
+			width/2, barcodeQuietZone/2+barcodeTitleSize, barcodeTitleSize, html.EscapeString(label.Title))
+	}
+
+	b.WriteString(`<g fill="#000">`)
+	for i := 0; i < len(symbol.modules); {
+		if !symbol.modules[i] {
+			i++
+			continue
+		}
+		start := i
+		guard := symbol.guards != nil && symbol.guards[i]
+		for i < len(symbol.modules) && symbol.modules[i] && (symbol.guards != nil && symbol.guards[i]) == guard {
+			i++
+		}
+		barHeight := barcodeBarHeight
+		if guard {
+			barHeight += barcodeGuardExtra
+		}
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d"/>`, barcodeQuietZone+start, top, i-start, barHeight)
+	}
+	b.WriteString(`</g>`)
+
+	textY := top + barcodeBarHeight + barcodeTextHeight - 2
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-family="monospace" font-size="%d" text-anchor="middle">%s</text>`,
+		width/2, textY, barcodeTextHeight-4, html.EscapeString(label.Code))
+	if label.Price != "" {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-family="sans-serif" font-size="%d" font-weight="bold" text-anchor="middle">%s</text>`,
+			width/2, textY+barcodeTitleSize+2, barcodeTitleSize, html.EscapeString(label.Price))
+	}
+	b.WriteString(`</svg>`)
+	return []byte(b.String()), nil
+}
+
+func clampScale(scale int) int {
+	if scale < 1 {
+		return 2
+	}
+	if scale > barcodeMaxScale {
+		return barcodeMaxScale
+	}
+	return scale
+}
+
+func encodeBarcode(symbology, code string) (*barcodeSymbol, error) {
+	if err := ValidateBarcode(symbology, code); err != nil {
+		return nil, err
+	}
+	switch symbology {
+	case domain.BarcodeSymbologyEAN13:
+		return encodeEAN13(code), nil
+	case domain.BarcodeSymbologyUPCA:
+		// UPC-A is drawn as the EAN-13 with a leading zero
+		return encodeEAN13("0" + code), nil
+	default:
+		return encodeCode128(code), nil
+	}
+}
+
+func encodeEAN13(code string) *barcodeSymbol {
+	symbol := &barcodeSymbol{}
+	add := func(pattern string, guard bool) {
+		for _, c := range pattern {
+			symbol.modules = append(symbol.modules, c == '1')
+			symbol.guards = append(symbol.guards, guard)
+		}
+	}
+
+	parity := eanParity[code[0]-'0']
+	add("101", true)
+	for i := 1; i <= 6; i++ {
+		pattern := eanLeftOdd[code[i]-'0']
+		if parity[i-1] == 'G' {
+			pattern = reversePattern(invertPattern(pattern))
+		}
+		add(pattern, false)
+	}
+	add("01010", true)
+	for i := 7; i <= 12; i++ {
+		add(invertPattern(eanLeftOdd[code[i]-'0']), false)
+	}
+	add("101", true)
+	return symbol
+}
+
+// encodeCode128 uses code set C for runs of four or more digits and code set B
+// for everything else, which keeps numeric codes short enough for small labels
+func encodeCode128(code string) *barcodeSymbol {
+	var values []int
+	set := 0
+	for i := 0; i < len(code); {
+		run := digitRun(code[i:])
+		if run >= 4 || (set == code128StartC && run >= 2) {
+			if set != code128StartC {
+				values = appendCode128Switch(values, set, code128StartC, code128CodeC)
+				set = code128StartC
+			}
+			for ; run >= 2; run -= 2 {
+				values = append(values, int(code[i]-'0')*10+int(code[i+1]-'0'))
+				i += 2
+			}
+			continue
+		}
+		if set != code128StartB {
+			values = appendCode128Switch(values, set, code128StartB, code128CodeB)
+			set = code128StartB
+		}
+		values = append(values, int(code[i])-32)
+		i++
+	}
+
+	checksum := values[0]
+	for i := 1; i < len(values); i++ {
+		checksum += values[i] * i
+	}
+	values = append(values, checksum%103, code128Stop)
+
+	symbol := &barcodeSymbol{}
+	for _, value := range values {
+		bar := true
+		for _, width := range code128Patterns[value] {
+			for n := 0; n < int(width-'0'); n++ {
+				symbol.modules = append(symbol.modules, bar)
+			}
+			bar = !bar
+		}
+	}
+	return symbol
+}
+
+func appendCode128Switch(values []int, current, start, code int) []int {
+	if current == 0 {
+		return append(values, start)
+	}
+	return append(values, code)
+}
+
+func digitRun(value string) int {
+	n := 0
+	for n < len(value) && value[n] >= '0' && value[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+func invertPattern(pattern string) string {
+	inverted := []byte(pattern)
+	for i, c := range inverted {
+		if c == '1' {
+			inverted[i] = '0'
+		} else {
+			inverted[i] = '1'
+		}
+	}
+	return string(inverted)
+}
+
+func reversePattern(pattern string) string {
+	reversed := []byte(pattern)
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	return string(reversed)
+}
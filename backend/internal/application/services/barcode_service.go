@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+var (
+	ErrBarcodeNotFound = errors.New("barcode not found")
+	ErrBarcodeInUse    = errors.New("barcode is already assigned to another product")
+	ErrProductNotFound = errors.New("product not found")
+)
+
+// How a scan was resolved
+const (
+	ScanMatchBarcode = "barcode"
+	ScanMatchSKU     = "sku"
+)
+
+// ScanResult is the product or variation a scanned code resolves to
+type ScanResult struct {
+	Scan      string                   `json:"scan"`
+	MatchedBy string                   `json:"matched_by"`
+	Product   *domain.Product          `json:"product"`
+	Variation *domain.ProductVariation `json:"variation,omitempty"`
+	Barcode   *domain.ProductBarcode   `json:"barcode,omitempty"`
+	UnitPrice float64                  `json:"unit_price"`
+	Quantity  int                      `json:"quantity"`
+	// Weight is the net weight in kilograms read from a GS1-128 deli label
+	Weight *float64 `json:"weight,omitempty"`
+	// LineTotal is the price printed on a GS1-128 label, or the unit price
+	// times the weight when the label carries only a weight
+	LineTotal *float64 `json:"line_total,omitempty"`
+	GS1       *GS1Data `json:"gs1,omitempty"`
+}
+
+// BarcodeService manages product barcodes, resolves scans and prints labels
+type BarcodeService struct {
+	barcodeRepo   repositories.ProductBarcodeRepository
+	productRepo   repositories.ProductRepository
+	variationRepo repositories.ProductVariationRepository
+	renderer      *BarcodeRenderer
+}
+
+// NewBarcodeService creates a new barcode service
+func NewBarcodeService(
+	barcodeRepo repositories.ProductBarcodeRepository,
+	productRepo repositories.ProductRepository,
+	variationRepo repositories.ProductVariationRepository,
+) *BarcodeService {
+	return &BarcodeService{
+		barcodeRepo:   barcodeRepo,
+		productRepo:   productRepo,
+		variationRepo: variationRepo,
+		renderer:      NewBarcodeRenderer(),
+	}
+}
+
+// AddBarcode assigns a code to a product, or to one of its variations when
+// variationID is set. The symbology is detected from the code when empty
+func (s *BarcodeService) AddBarcode(ctx context.Context, tenantID string, productID uuid.UUID, variationID *uuid.UUID, code, symbology string, isPrimary bool) (*domain.ProductBarcode, error) {
+	code = strings.TrimSpace(code)
+	if symbology == "" {
+		symbology = DetectSymbology(code)
+	}
+	symbology = strings.ToLower(symbology)
+	if err := ValidateBarcode(symbology, code); err != nil {
+		return nil, err
+	}
+
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil || product == nil || product.TenantID != tenantID {
+		return nil, ErrProductNotFound
+	}
+	if variationID != nil {
+		if _, err := resolveVariation(ctx, s.variationRepo, product, variationID); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, candidate := range gtinCandidates(code) {
+		existing, err := s.barcodeRepo.GetByCode(ctx, tenantID, candidate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check barcode: %w", err)
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("%w: %s", ErrBarcodeInUse, candidate)
+		}
+	}
+
+	barcode := &domain.ProductBarcode{
+		ID:          uuid.New(),
+		TenantID:    tenantID,
+		ProductID:   productID,
+		VariationID: variationID,
+		Code:        code,
+		Symbology:   symbology,
+		IsPrimary:   isPrimary,
+	}
+	if isPrimary {
+		if err := s.clearPrimary(ctx, productID, variationID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.barcodeRepo.Create(ctx, barcode); err != nil {
+		return nil, fmt.Errorf("failed to create barcode: %w", err)
+	}
+
+	return barcode, nil
+}
+
+// RemoveBarcode deletes one of the tenant's barcodes
+func (s *BarcodeService) RemoveBarcode(ctx context.Context, tenantID string, barcodeID uuid.UUID) error {
+	if _, err := s.getBarcode(ctx, tenantID, barcodeID); err != nil {
+		return err
+	}
+	return s.barcodeRepo.Delete(ctx, barcodeID)
+}
+
+// GetProductBarcodes lists the barcodes of a product and its variations
+func (s *BarcodeService) GetProductBarcodes(ctx context.Context, tenantID string, productID uuid.UUID) ([]*domain.ProductBarcode, error) {
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil || product == nil || product.TenantID != tenantID {
+		return nil, ErrProductNotFound
+	}
+	return s.barcodeRepo.GetByProductID(ctx, productID)
+}
+
+// Lookup resolves a scan to a product or variation. Barcodes are matched
+// first, allowing for UPC-A/EAN-13/GTIN-14 zero padding, then variation and
+// product SKUs. GS1-128 scans are resolved by their GTIN and carry the weight,
+// count and price they encode
+func (s *BarcodeService) Lookup(ctx context.Context, tenantID string, scan string) (*ScanResult, error) {
+	scan = strings.TrimSpace(scan)
+	if scan == "" {
+		return nil, fmt.Errorf("%w: empty scan", ErrInvalidBarcode)
+	}
+
+	result := &ScanResult{Scan: scan, Quantity: 1}
+	code := scan
+	if IsGS1(scan) {
+		data, err := ParseGS1(scan)
+		if err != nil {
+			return nil, err
+		}
+		if data.GTIN == "" {
+			return nil, fmt.Errorf("%w: no GTIN element", ErrInvalidGS1)
+		}
+		result.GS1 = data
+		code = data.GTIN
+	}
+
+	for _, candidate := range gtinCandidates(code) {
+		barcode, err := s.barcodeRepo.GetByCode(ctx, tenantID, candidate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up barcode: %w", err)
+		}
+		if barcode == nil {
+			continue
+		}
+		if err := s.resolve(ctx, tenantID, result, barcode.ProductID, barcode.VariationID); err != nil {
+			return nil, err
+		}
+		result.MatchedBy = ScanMatchBarcode
+		result.Barcode = barcode
+		return s.applyGS1(result), nil
+	}
+
+	// GS1 labels identify items by GTIN only, so SKUs are not tried for them
+	if result.GS1 == nil {
+		if variation, err := s.variationRepo.GetBySKU(ctx, tenantID, code); err == nil && variation != nil {
+			if err := s.resolve(ctx, tenantID, result, variation.ProductID, &variation.ID); err != nil {
+				return nil, err
+			}
+			result.MatchedBy = ScanMatchSKU
+			return result, nil
+		}
+		if product, err := s.productRepo.GetBySKU(ctx, tenantID, code); err == nil && product != nil {
+			if err := s.resolve(ctx, tenantID, result, product.ID, nil); err != nil {
+				return nil, err
+			}
+			result.MatchedBy = ScanMatchSKU
+			return result, nil
+		}
+	}
+
+	return nil, ErrBarcodeNotFound
+}
+
+// RenderLabel draws a printable label for one of the tenant's barcodes, titled
+// with the product name and showing its current price in currency
+func (s *BarcodeService) RenderLabel(ctx context.Context, tenantID string, barcodeID uuid.UUID, format string, scale int, currency string) ([]byte, string, error) {
+	barcode, err := s.getBarcode(ctx, tenantID, barcodeID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	result := &ScanResult{}
+	if err := s.resolve(ctx, tenantID, result, barcode.ProductID, barcode.VariationID); err != nil {
+		return nil, "", err
+	}
+	title := result.Product.Name
+	if result.Variation != nil {
+		if attributes := formatVariationAttributes(result.Variation.Attributes); attributes != "" {
+			title += " (" + attributes + ")"
+		}
+	}
+	label := &BarcodeLabel{
+		Code:      barcode.Code,
+		Symbology: barcode.Symbology,
+		Title:     title,
+		Price:     formatMoney(result.UnitPrice, currency),
+	}
+
+	switch strings.ToLower(format) {
+	case "", BarcodeLabelFormatPNG:
+		output, err := s.renderer.RenderPNG(label, scale)
+		return output, "image/png", err
+	case BarcodeLabelFormatSVG:
+		output, err := s.renderer.RenderSVG(label, scale)
+		return output, "image/svg+xml", err
+	default:
+		return nil, "", fmt.Errorf("unsupported label format: %s", format)
+	}
+}
+
+func (s *BarcodeService) getBarcode(ctx context.Context, tenantID string, barcodeID uuid.UUID) (*domain.ProductBarcode, error) {
+	barcode, err := s.barcodeRepo.GetByID(ctx, barcodeID)
+	if err != nil || barcode == nil || barcode.TenantID != tenantID {
+		return nil, ErrBarcodeNotFound
+	}
+	return barcode, nil
+}
+
+// resolve loads the product and variation a code points at into result
+func (s *BarcodeService) resolve(ctx context.Context, tenantID string, result *ScanResult, productID uuid.UUID, variationID *uuid.UUID) error {
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil || product == nil || product.TenantID != tenantID {
+		return ErrBarcodeNotFound
+	}
+
+	var variation *domain.ProductVariation
+	if variationID != nil {
+		variation, err = s.variationRepo.GetByID(ctx, *variationID)
+		if err != nil || variation == nil || variation.ProductID != product.ID {
+			return ErrBarcodeNotFound
+		}
+	}
+
+	result.Product = product
+	result.Variation = variation
+	result.UnitPrice = unitPriceFor(product, variation)
+	return nil
+}
+
+// applyGS1 carries the count, weight and printed price of a GS1-128 scan into
+// the result. A weighed item priced by the scale keeps the scale's price
+func (s *BarcodeService) applyGS1(result *ScanResult) *ScanResult {
+	data := result.GS1
+	if data == nil {
+		return result
+	}
+	if data.Count != nil && *data.Count > 0 {
+		result.Quantity = *data.Count
+	}
+	result.Weight = data.NetWeight
+
+	switch {
+	case data.Price != nil:
+		total := *data.Price
+		result.LineTotal = &total
+	case data.NetWeight != nil:
+		total := roundCurrency(result.UnitPrice * *data.NetWeight)
+		result.LineTotal = &total
+	}
+	return result
+}
+
+func (s *BarcodeService) clearPrimary(ctx context.Context, productID uuid.UUID, variationID *uuid.UUID) error {
+	barcodes, err := s.barcodeRepo.GetByProductID(ctx, productID)
+	if err != nil {
+		return fmt.Errorf("failed to get product barcodes: %w", err)
+	}
+	for _, barcode := range barcodes {
+		sameTarget := (barcode.VariationID == nil && variationID == nil) ||
+			(barcode.VariationID != nil && variationID != nil && *barcode.VariationID == *variationID)
+		if !barcode.IsPrimary || !sameTarget {
+			continue
+		}
+		barcode.IsPrimary = false
+		if err := s.barcodeRepo.Update(ctx, barcode); err != nil {
+			return fmt.Errorf("failed to update barcode: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+)
+
+// catalogColumns are the catalog fields an import file can carry, in the order
+// an export writes them. A row with a parent_sku is a variation of that product.
+var catalogColumns = []string{
+	"sku", "parent_sku", "name", "slug", "description", "short_description",
+	"product_type", "status", "featured", "category",
+	"regular_price", "sale_price", "cost_price", "tax_class",
+	"weight", "length", "width", "height",
+	"manage_stock", "stock_quantity", "low_stock_threshold", "backorders",
+	"attributes", "image",
+}
+
+// catalogVariationColumns are the columns a variation row may fill; the rest
+// belong to the parent product
+var catalogVariationColumns = map[string]bool{
+	"sku": true, "parent_sku": true,
+	"regular_price": true, "sale_price": true, "cost_price": true,
+	"weight": true, "length": true, "width": true, "height": true,
+	"stock_quantity": true, "attributes": true, "image": true,
+}
+
+// catalogNumericColumns are written as numbers to XLSX
+var catalogNumericColumns = map[string]bool{
+	"regular_price": true, "sale_price": true, "cost_price": true,
+	"weight": true, "length": true, "width": true, "height": true,
+	"stock_quantity": true, "low_stock_threshold": true,
+}
+
+// catalogCategorySeparator joins the levels of a category path, e.g. "Clothing > Shirts"
+const catalogCategorySeparator = " > "
+
+func isCatalogColumn(field string) bool {
+	for _, column := range catalogColumns {
+		if column == field {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeCatalogHeader matches file headers loosely, so "Regular Price" and
+// "regular-price" both name the regular_price column
+func normalizeCatalogHeader(header string) string {
+	header = strings.ToLower(strings.TrimSpace(header))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(header)
+}
+
+// catalogProductValue formats a product field the way an export writes it
+func catalogProductValue(product *domain.Product, field string) string {
+	switch field {
+	case "sku":
+		return product.SKU
+	case "name":
+		return product.Name
+	case "slug":
+		return product.Slug
+	case "description":
+		return product.Description
+	case "short_description":
+		return product.ShortDescription
+	case "product_type":
+		return product.ProductType
+	case "status":
+		return product.Status
+	case "featured":
+		return strconv.FormatBool(product.Featured)
+	case "regular_price":
+		return formatCatalogNumber(product.RegularPrice)
+	case "sale_price":
+		return formatCatalogNumber(product.SalePrice)
+	case "cost_price":
+		return formatCatalogNumber(product.CostPrice)
+	case "tax_class":
+		return product.TaxClass
+	case "weight":
+		return formatCatalogNumber(product.Weight)
+	case "length":
+		return formatCatalogNumber(product.Length)
+	case "width":
+		return formatCatalogNumber(product.Width)
+	case "height":
+		return formatCatalogNumber(product.Height)
+	case "manage_stock":
+		return strconv.FormatBool(product.ManageStock)
+	case "stock_quantity":
+		return strconv.Itoa(product.StockQuantity)
+	case "low_stock_threshold":
+		return strconv.Itoa(product.LowStockThreshold)
+	case "backorders":
+		return product.Backorders
+	case "attributes":
+		return formatCatalogAttributes(product.Attributes)
+	case "image":
+		return product.FeaturedImage
+	}
+	return ""
+}
+
+// setCatalogProductValue parses a cell into a product field. The sku,
+// parent_sku, category and stock_quantity columns are resolved by the importer.
+func setCatalogProductValue(product *domain.Product, field, value string) error {
+	var err error
+	switch field {
+	case "name":
+		product.Name = value
+	case "slug":
+		product.Slug = value
+	case "description":
+		product.Description = value
+	case "short_description":
+		product.ShortDescription = value
+	case "product_type":
+		product.ProductType, err = parseCatalogChoice(value, domain.ProductTypeSimple, domain.ProductTypeVariable, domain.ProductTypeGrouped, domain.ProductTypeExternal)
+	case "status":
+		product.Status, err = parseCatalogChoice(value, domain.ProductStatusDraft, domain.ProductStatusPublished, domain.ProductStatusPrivate, domain.ProductStatusPending)
+	case "featured":
+		product.Featured, err = parseCatalogBool(value)
+	case "regular_price":
+		product.RegularPrice, err = parseCatalogNumber(value)
+	case "sale_price":
+		product.SalePrice, err = parseCatalogNumber(value)
+	case "cost_price":
+		product.CostPrice, err = parseCatalogNumber(value)
+	case "tax_class":
+		product.TaxClass = value
+	case "weight":
+		product.Weight, err = parseCatalogNumber(value)
+	case "length":
+		product.Length, err = parseCatalogNumber(value)
+	case "width":
+		product.Width, err = parseCatalogNumber(value)
+	case "height":
+		product.Height, err = parseCatalogNumber(value)
+	case "manage_stock":
+		product.ManageStock, err = parseCatalogBool(value)
+	case "low_stock_threshold":
+		product.LowStockThreshold, err = parseCatalogQuantity(value)
+	case "backorders":
+		product.Backorders, err = parseCatalogChoice(value, "no", "notify", "yes")
+	case "attributes":
+		product.Attributes, err = parseCatalogAttributes(value)
+	case "image":
+		product.FeaturedImage = value
+	default:
+		return fmt.Errorf("%s cannot be set here", field)
+	}
+	return err
+}
+
+// catalogVariationValue formats a variation field the way an export writes it
+func catalogVariationValue(variation *domain.ProductVariation, field string) string {
+	switch field {
+	case "sku":
+		return variation.SKU
+	case "regular_price":
+		return formatCatalogNumber(variation.RegularPrice)
+	case "sale_price":
+		return formatCatalogNumber(variation.SalePrice)
+	case "cost_price":
+		return formatCatalogNumber(variation.CostPrice)
+	case "weight":
+		return formatCatalogNumber(variation.Weight)
+	case "length":
+		return formatCatalogNumber(variation.Length)
+	case "width":
+		return formatCatalogNumber(variation.Width)
+	case "height":
+		return formatCatalogNumber(variation.Height)
+	case "stock_quantity":
+		return strconv.Itoa(variation.StockQuantity)
+	case "attributes":
+		return formatCatalogAttributes(variation.Attributes)
+	case "image":
+		return variation.Image
+	}
+	return ""
+}
+
+// setCatalogVariationValue parses a cell into a variation field
+func setCatalogVariationValue(variation *domain.ProductVariation, field, value string) error {
+	var err error
+	switch field {
+	case "regular_price":
+		variation.RegularPrice, err = parseCatalogNumber(value)
+	case "sale_price":
+		variation.SalePrice, err = parseCatalogNumber(value)
+	case "cost_price":
+		variation.CostPrice, err = parseCatalogNumber(value)
+	case "weight":
+		variation.Weight, err = parseCatalogNumber(value)
+	case "length":
+		variation.Length, err = parseCatalogNumber(value)
+	case "width":
+		variation.Width, err = parseCatalogNumber(value)
+	case "height":
+		variation.Height, err = parseCatalogNumber(value)
+	case "attributes":
+		variation.Attributes, err = parseCatalogAttributes(value)
+	case "image":
+		variation.Image = value
+	default:
+		return fmt.Errorf("%s cannot be set here", field)
+	}
+	return err
+}
+
+func formatCatalogNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// parseCatalogNumber parses a price or dimension, which cannot be negative
+func parseCatalogNumber(value string) (float64, error) {
+	number, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", value)
+	}
+	if number < 0 {
+		return 0, errors.New("cannot be negative")
+	}
+	return number, nil
+}
+
+// parseCatalogQuantity parses a whole, non-negative quantity
+func parseCatalogQuantity(value string) (int, error) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number != float64(int(number)) {
+		return 0, fmt.Errorf("%q is not a whole number", value)
+	}
+	if number < 0 {
+		return 0, errors.New("cannot be negative")
+	}
+	return int(number), nil
+}
+
+func parseCatalogBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "y", "1":
+		return true, nil
+	case "false", "no", "n", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not true or false", value)
+}
+
+func parseCatalogChoice(value string, choices ...string) (string, error) {
+	for _, choice := range choices {
+		if strings.EqualFold(value, choice) {
+			return choice, nil
+		}
+	}
+	return "", fmt.Errorf("%q must be one of %s", value, strings.Join(choices, ", "))
+}
+
+// formatCatalogAttributes writes attributes as "Color=Red; Size=M", sorted by name
+func formatCatalogAttributes(attributes map[string]interface{}) string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%v", name, attributes[name]))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func parseCatalogAttributes(value string) (map[string]interface{}, error) {
+	attributes := make(map[string]interface{})
+	for _, part := range strings.Split(value, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		name, attribute, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not in Name=Value form", part)
+		}
+		attributes[name] = strings.TrimSpace(attribute)
+	}
+	return attributes, nil
+}
+
+// normalizeCategoryPath tidies a category path such as "Clothing>Shirts" into
+// "Clothing > Shirts"
+func normalizeCategoryPath(value string) string {
+	var names []string
+	for _, name := range strings.Split(value, ">") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, catalogCategorySeparator)
+}
+
+// catalogSlug makes a URL slug from a name, e.g. "Blue Shirt (XL)" -> "blue-shirt-xl"
+func catalogSlug(name string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r > 127 {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return slug.String()
+}
@@ -0,0 +1,1290 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
+	"github.com/ilmsadmin/zplus-saas-base/pkg/config"
+)
+
+var (
+	ErrCatalogImportNotFound = errors.New("catalog import not found")
+	ErrCatalogImportNotReady = errors.New("catalog import is not ready to apply")
+	ErrInvalidCatalogImport  = errors.New("invalid catalog import")
+	ErrInvalidCatalogFile    = errors.New("invalid catalog file")
+)
+
+const (
+	catalogImportBatchSize = 100      // Rows written per transaction
+	catalogImportMaxDiff   = 1000     // Changes kept in an import's diff
+	catalogImportMaxSize   = 20 << 20 // Largest accepted import file
+	catalogImportSweepSize = 100      // Stale imports failed per sweep
+	catalogFileCategory    = "catalog-imports"
+
+	catalogActionCreate    = "create"
+	catalogActionUpdate    = "update"
+	catalogActionUnchanged = "unchanged"
+)
+
+// CatalogImportService imports a product catalog from CSV or XLSX files and
+// exports it in the same layout. An import is validated and diffed against
+// the catalog in the background first; applying it is a separate step.
+type CatalogImportService struct {
+	txManager     repositories.TransactionManager
+	importRepo    repositories.CatalogImportRepository
+	categoryRepo  repositories.ProductCategoryRepository
+	productRepo   repositories.ProductRepository
+	variationRepo repositories.ProductVariationRepository
+	inventoryRepo repositories.InventoryLogRepository
+	inventory     *InventoryService
+	fileService   FileService
+	logger        *zap.Logger
+}
+
+// NewCatalogImportService creates a new catalog import service
+func NewCatalogImportService(
+	txManager repositories.TransactionManager,
+	importRepo repositories.CatalogImportRepository,
+	categoryRepo repositories.ProductCategoryRepository,
+	productRepo repositories.ProductRepository,
+	variationRepo repositories.ProductVariationRepository,
+	inventoryRepo repositories.InventoryLogRepository,
+	inventory *InventoryService,
+	fileService FileService,
+) *CatalogImportService {
+	return &CatalogImportService{
+		txManager:     txManager,
+		importRepo:    importRepo,
+		categoryRepo:  categoryRepo,
+		productRepo:   productRepo,
+		variationRepo: variationRepo,
+		inventoryRepo: inventoryRepo,
+		inventory:     inventory,
+		fileService:   fileService,
+		logger:        zap.NewNop(),
+	}
+}
+
+// SetLogger sets the logger for failures of imports running in the background
+func (s *CatalogImportService) SetLogger(logger *zap.Logger) {
+	if logger != nil {
+		s.logger = logger
+	}
+}
+
+// catalogRow is one non-blank row of an import file
+type catalogRow struct {
+	Line   int               // Line in the file, counting the header as line 1
+	Values map[string]string // Catalog field -> trimmed cell, for mapped columns only
+}
+
+// catalogTable is an import file read through its column mapping
+type catalogTable struct {
+	Headers map[string]string // Catalog field -> file header, for the error report
+	Rows    []catalogRow
+}
+
+// catalogRowError is one line of an import's error report
+type catalogRowError struct {
+	Row    int
+	SKU    string
+	Column string
+	Error  string
+}
+
+// catalogFieldChange is a field's value before and after an import
+type catalogFieldChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// catalogChange is one entry of an import's dry-run diff
+type catalogChange struct {
+	Row    int                           `json:"row,omitempty"`
+	Entity string                        `json:"entity"` // category, product, variation
+	Action string                        `json:"action"` // create, update
+	Key    string                        `json:"key"`    // SKU, or the category path
+	Fields map[string]catalogFieldChange `json:"fields,omitempty"`
+}
+
+// catalogItem is a product or variation row resolved against the catalog
+type catalogItem struct {
+	Line        int
+	SKU         string
+	Action      string // create, update, unchanged
+	Product     *domain.Product
+	Variation   *domain.ProductVariation
+	Category    string // Category path to file the product under, when it changes
+	Stock       *int   // Counted quantity to set, when it changes
+	StockBefore int
+	Changes     map[string]catalogFieldChange
+}
+
+// catalogPlan is what applying an import's rows would do. Planning never
+// writes; the same plan drives the dry-run diff and the apply step.
+type catalogPlan struct {
+	TenantID      string
+	Location      *domain.StockLocation // Where stock is counted; nil updates product totals only
+	Categories    *catalogCategories
+	NewCategories []string // Category paths to create, parents first
+	Products      []*catalogItem
+	Variations    []*catalogItem
+	Errors        []catalogRowError
+
+	headers map[string]string
+	slugs   map[string]bool
+}
+
+// StartImport stores an uploaded catalog file and validates it in the
+// background. mapping maps file headers to catalog fields; headers that
+// already name a catalog field need no mapping, and unmapped columns are
+// ignored. Imported stock is counted at locationID, or the tenant's default
+// location.
+func (s *CatalogImportService) StartImport(ctx context.Context, tenantID string, userID uuid.UUID, upload *FileUpload, mapping map[string]string, locationID *uuid.UUID) (*domain.CatalogImport, error) {
+	if upload == nil || upload.Header == nil {
+		return nil, fmt.Errorf("%w: a file is required", ErrInvalidCatalogImport)
+	}
+	format, err := catalogFormat(upload.Header.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	columnMapping := make(map[string]interface{}, len(mapping))
+	for header, field := range mapping {
+		field = strings.TrimSpace(field)
+		if field != "" && !isCatalogColumn(field) {
+			return nil, fmt.Errorf("%w: column %q maps to unknown field %q", ErrInvalidCatalogImport, header, field)
+		}
+		columnMapping[normalizeCatalogHeader(header)] = field
+	}
+	if locationID != nil {
+		if _, err := s.inventory.GetLocation(ctx, tenantID, *locationID); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := s.fileService.UploadFile(ctx, &FileUploadRequest{
+		TenantID: catalogFileTenant(tenantID),
+		UserID:   userID,
+		File:     upload,
+		Category: catalogFileCategory,
+		MaxSize:  catalogImportMaxSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store import file: %w", err)
+	}
+
+	catalogImport := &domain.CatalogImport{
+		ID:            uuid.New(),
+		TenantID:      tenantID,
+		UserID:        userID,
+		FileID:        file.ID,
+		FileName:      upload.Header.Filename,
+		Format:        format,
+		Status:        domain.CatalogImportStatusPending,
+		ColumnMapping: columnMapping,
+		LocationID:    locationID,
+		Summary:       make(map[string]interface{}),
+		Diff:          make(map[string]interface{}),
+	}
+	if err := s.importRepo.Create(ctx, catalogImport); err != nil {
+		return nil, fmt.Errorf("failed to create catalog import: %w", err)
+	}
+
+	s.runInBackground(tenantID, catalogImport.ID, s.validate)
+	return catalogImport, nil
+}
+
+// ApplyImport writes a validated import to the catalog in the background.
+// Rows that failed validation are skipped; the rest are planned again against
+// the current catalog and written in batches, each in its own transaction.
+func (s *CatalogImportService) ApplyImport(ctx context.Context, tenantID string, importID uuid.UUID, userID *uuid.UUID) (*domain.CatalogImport, error) {
+	catalogImport, err := s.GetImport(ctx, tenantID, importID)
+	if err != nil {
+		return nil, err
+	}
+	if catalogImport.Status != domain.CatalogImportStatusValidated {
+		return nil, fmt.Errorf("%w: the import is %s", ErrCatalogImportNotReady, catalogImport.Status)
+	}
+	if catalogImport.ValidRows == 0 {
+		return nil, fmt.Errorf("%w: no row passed validation", ErrCatalogImportNotReady)
+	}
+
+	// Only one of two requests applying the import at once gets to start it
+	catalogImport.Status = domain.CatalogImportStatusApplying
+	started, err := s.importRepo.UpdateIfStatus(ctx, catalogImport, domain.CatalogImportStatusValidated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update catalog import: %w", err)
+	}
+	if !started {
+		return nil, fmt.Errorf("%w: the import is already being applied", ErrCatalogImportNotReady)
+	}
+
+	s.runInBackground(tenantID, catalogImport.ID, func(ctx context.Context, catalogImport *domain.CatalogImport) error {
+		return s.apply(ctx, catalogImport, userID)
+	})
+	return catalogImport, nil
+}
+
+// GetImport returns one of the tenant's imports
+func (s *CatalogImportService) GetImport(ctx context.Context, tenantID string, importID uuid.UUID) (*domain.CatalogImport, error) {
+	catalogImport, err := s.importRepo.GetByID(ctx, importID)
+	if err != nil || catalogImport == nil || catalogImport.TenantID != tenantID {
+		return nil, ErrCatalogImportNotFound
+	}
+	return catalogImport, nil
+}
+
+// ListImports returns the tenant's imports, newest first
+func (s *CatalogImportService) ListImports(ctx context.Context, tenantID string, limit, offset int) ([]*domain.CatalogImport, int64, error) {
+	return s.importRepo.GetByTenantID(ctx, tenantID, limit, offset)
+}
+
+// OpenErrorReport opens an import's error report, a CSV of the rows that
+// failed with the column and reason. The caller closes it.
+func (s *CatalogImportService) OpenErrorReport(ctx context.Context, tenantID string, importID uuid.UUID) (io.ReadCloser, *FileResponse, error) {
+	catalogImport, err := s.GetImport(ctx, tenantID, importID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if catalogImport.ErrorReportFileID == nil {
+		return nil, nil, fmt.Errorf("%w: the import has no errors", ErrCatalogImportNotFound)
+	}
+	return s.fileService.OpenFile(ctx, *catalogImport.ErrorReportFileID)
+}
+
+// Export writes the tenant's catalog in the import layout, each product
+// followed by its variations. With a location, stock_quantity is the stock
+// counted there, so the file can be edited and imported back for it.
+func (s *CatalogImportService) Export(ctx context.Context, tenantID string, format string, locationID *uuid.UUID) ([]byte, error) {
+	if format != domain.CatalogFormatCSV && format != domain.CatalogFormatXLSX {
+		return nil, fmt.Errorf("%w: unsupported format %s", ErrInvalidCatalogFile, format)
+	}
+	if locationID != nil {
+		if _, err := s.inventory.GetLocation(ctx, tenantID, *locationID); err != nil {
+			return nil, err
+		}
+	}
+	categories, err := s.loadCategories(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	numeric := make(map[int]bool)
+	for i, column := range catalogColumns {
+		numeric[i] = catalogNumericColumns[column]
+	}
+	rows := [][]string{catalogColumns}
+
+	for page := 1; ; page++ {
+		products, total, err := s.productRepo.GetByTenantID(ctx, tenantID, &domain.ProductFilter{
+			Page:      page,
+			Limit:     100,
+			SortBy:    "sku",
+			SortOrder: "asc",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list products: %w", err)
+		}
+
+		for _, product := range products {
+			values := make(map[string]string, len(catalogColumns))
+			for _, column := range catalogColumns {
+				values[column] = catalogProductValue(product, column)
+			}
+			values["category"] = categories.path(product.CategoryID)
+			if locationID != nil {
+				quantity, _ := s.inventory.StockAt(ctx, *locationID, product.ID, nil)
+				values["stock_quantity"] = fmt.Sprint(quantity)
+			}
+			rows = append(rows, catalogRecord(values))
+
+			variations, err := s.variationRepo.GetByProductID(ctx, product.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list variations of %s: %w", product.SKU, err)
+			}
+			for _, variation := range variations {
+				values := map[string]string{"parent_sku": product.SKU}
+				for column := range catalogVariationColumns {
+					if column != "parent_sku" {
+						values[column] = catalogVariationValue(variation, column)
+					}
+				}
+				if locationID != nil {
+					quantity, _ := s.inventory.StockAt(ctx, *locationID, product.ID, &variation.ID)
+					values["stock_quantity"] = fmt.Sprint(quantity)
+				}
+				rows = append(rows, catalogRecord(values))
+			}
+		}
+
+		if len(products) == 0 || int64(page*100) >= total {
+			break
+		}
+	}
+
+	return writeCatalogTable(format, rows, numeric)
+}
+
+// runInBackground runs step on an import after the request has returned, with
+// the tenant's scope carried over from the request. A failing or panicking step
+// marks the whole import failed with the reason.
+func (s *CatalogImportService) runInBackground(tenantID string, importID uuid.UUID, step func(ctx context.Context, catalogImport *domain.CatalogImport) error) {
+	go func() {
+		ctx := database.WithTenantID(context.Background(), tenantID)
+		catalogImport, err := s.importRepo.GetByID(ctx, importID)
+		if err != nil || catalogImport == nil {
+			s.logger.Error("failed to load catalog import", zap.String("tenant_id", tenantID), zap.String("import_id", importID.String()), zap.Error(err))
+			return
+		}
+
+		if err := s.runStep(ctx, catalogImport, step); err != nil {
+			s.fail(ctx, catalogImport, err)
+		}
+	}()
+}
+
+// runStep runs step, turning a panic into an error so the import is not left
+// in progress
+func (s *CatalogImportService) runStep(ctx context.Context, catalogImport *domain.CatalogImport, step func(ctx context.Context, catalogImport *domain.CatalogImport) error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("import stopped unexpectedly: %v", recovered)
+		}
+	}()
+	return step(ctx, catalogImport)
+}
+
+// fail marks an import that is still in progress failed with the reason
+func (s *CatalogImportService) fail(ctx context.Context, catalogImport *domain.CatalogImport, reason error) {
+	status := catalogImport.Status
+	catalogImport.Status = domain.CatalogImportStatusFailed
+	catalogImport.Error = reason.Error()
+	if _, err := s.importRepo.UpdateIfStatus(ctx, catalogImport, status); err != nil {
+		s.logger.Error("failed to mark catalog import failed",
+			zap.String("tenant_id", catalogImport.TenantID),
+			zap.String("import_id", catalogImport.ID.String()),
+			zap.NamedError("reason", reason),
+			zap.Error(err))
+	}
+}
+
+// FailStaleImports marks imports failed that have been pending, validating or
+// applying for longer than timeout, e.g. because the server restarted while
+// they ran. Rows an interrupted apply wrote stay in the catalog; importing the
+// file again finds them unchanged.
+func (s *CatalogImportService) FailStaleImports(ctx context.Context, timeout time.Duration) (int, error) {
+	stale, err := s.importRepo.GetStale(ctx, []string{
+		domain.CatalogImportStatusPending,
+		domain.CatalogImportStatusValidating,
+		domain.CatalogImportStatusApplying,
+	}, time.Now().Add(-timeout), catalogImportSweepSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get stale catalog imports: %w", err)
+	}
+
+	for _, catalogImport := range stale {
+		s.fail(database.WithTenantID(ctx, catalogImport.TenantID), catalogImport,
+			fmt.Errorf("interrupted: the import was %s for more than %s", catalogImport.Status, timeout))
+	}
+	return len(stale), nil
+}
+
+// ScheduleStaleImportSweep fails imports left in progress on the job runner
+func (s *CatalogImportService) ScheduleStaleImportSweep(runner *JobRunner, jobs config.JobsConfig) {
+	runner.Every("fail_stale_catalog_imports", jobs.CatalogImportSweepInterval, func(ctx context.Context) error {
+		_, err := s.FailStaleImports(ctx, jobs.CatalogImportTimeout)
+		return err
+	})
+}
+
+// validate is the dry run: it checks every row and records the diff
+func (s *CatalogImportService) validate(ctx context.Context, catalogImport *domain.CatalogImport) error {
+	catalogImport.Status = domain.CatalogImportStatusValidating
+	started, err := s.importRepo.UpdateIfStatus(ctx, catalogImport, domain.CatalogImportStatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to update catalog import: %w", err)
+	}
+	if !started {
+		// Failed as stale before it got to run
+		return nil
+	}
+
+	table, err := s.readTable(ctx, catalogImport)
+	if err != nil {
+		return err
+	}
+	plan, err := s.plan(ctx, catalogImport, table)
+	if err != nil {
+		return err
+	}
+
+	catalogImport.TotalRows = len(table.Rows)
+	catalogImport.ErrorRows = plan.errorRows()
+	catalogImport.ValidRows = catalogImport.TotalRows - catalogImport.ErrorRows
+	catalogImport.Summary = plan.summary()
+	catalogImport.Diff = plan.diff()
+	if err := s.attachErrorReport(ctx, catalogImport, plan.Errors); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	catalogImport.ValidatedAt = &now
+	catalogImport.Status = domain.CatalogImportStatusValidated
+	return s.finish(ctx, catalogImport, domain.CatalogImportStatusValidating)
+}
+
+// apply plans the rows again, since the catalog may have changed since the dry
+// run, and writes them. A failed batch is rolled back and its rows reported.
+func (s *CatalogImportService) apply(ctx context.Context, catalogImport *domain.CatalogImport, userID *uuid.UUID) error {
+	table, err := s.readTable(ctx, catalogImport)
+	if err != nil {
+		return err
+	}
+	plan, err := s.plan(ctx, catalogImport, table)
+	if err != nil {
+		return err
+	}
+
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.createCategories(ctx, plan)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create categories: %w", err)
+	}
+
+	// Variations of a new product whose batch failed have no parent to attach to
+	failedProducts := make(map[uuid.UUID]bool)
+	appliedProducts := 0
+	for _, batch := range catalogBatches(plan.Products) {
+		err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+			return s.applyProducts(ctx, plan, batch, userID)
+		})
+		if err != nil {
+			for _, item := range batch {
+				plan.fail(item.Line, item.SKU, "", "not applied: "+err.Error())
+				failedProducts[item.Product.ID] = true
+			}
+			continue
+		}
+		appliedProducts += len(batch)
+	}
+
+	var variations []*catalogItem
+	for _, item := range plan.Variations {
+		if failedProducts[item.Variation.ProductID] {
+			plan.fail(item.Line, item.SKU, "parent_sku", "not applied: the parent product failed to import")
+			continue
+		}
+		variations = append(variations, item)
+	}
+	appliedVariations := 0
+	for _, batch := range catalogBatches(variations) {
+		err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+			return s.applyVariations(ctx, plan, batch, userID)
+		})
+		if err != nil {
+			for _, item := range batch {
+				plan.fail(item.Line, item.SKU, "", "not applied: "+err.Error())
+			}
+			continue
+		}
+		appliedVariations += len(batch)
+	}
+
+	catalogImport.TotalRows = len(table.Rows)
+	catalogImport.ErrorRows = plan.errorRows()
+	catalogImport.ValidRows = catalogImport.TotalRows - catalogImport.ErrorRows
+	catalogImport.Summary = plan.summary()
+	catalogImport.Summary["applied"] = map[string]int{
+		"categories": len(plan.NewCategories),
+		"products":   appliedProducts,
+		"variations": appliedVariations,
+	}
+	catalogImport.Diff = plan.diff()
+	if err := s.attachErrorReport(ctx, catalogImport, plan.Errors); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	catalogImport.AppliedAt = &now
+	catalogImport.Status = domain.CatalogImportStatusCompleted
+	return s.finish(ctx, catalogImport, domain.CatalogImportStatusApplying)
+}
+
+// finish saves the outcome of a background step, unless the stale import
+// sweep has failed the import in the meantime
+func (s *CatalogImportService) finish(ctx context.Context, catalogImport *domain.CatalogImport, running string) error {
+	saved, err := s.importRepo.UpdateIfStatus(ctx, catalogImport, running)
+	if err != nil {
+		return fmt.Errorf("failed to update catalog import: %w", err)
+	}
+	if !saved {
+		s.logger.Warn("catalog import finished after it was failed as stale",
+			zap.String("tenant_id", catalogImport.TenantID),
+			zap.String("import_id", catalogImport.ID.String()))
+	}
+	return nil
+}
+
+// readTable loads an import's file and maps its columns to catalog fields
+func (s *CatalogImportService) readTable(ctx context.Context, catalogImport *domain.CatalogImport) (*catalogTable, error) {
+	reader, _, err := s.fileService.OpenFile(ctx, catalogImport.FileID)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read import file: %w", err)
+	}
+	records, err := readCatalogTable(catalogImport.Format, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidCatalogFile)
+	}
+
+	table := &catalogTable{Headers: make(map[string]string)}
+	fields := make([]string, len(records[0]))
+	for i, header := range records[0] {
+		key := normalizeCatalogHeader(header)
+		field := key
+		if mapped, ok := catalogImport.ColumnMapping[key]; ok {
+			field, _ = mapped.(string)
+		}
+		if !isCatalogColumn(field) {
+			continue
+		}
+		if _, ok := table.Headers[field]; ok {
+			return nil, fmt.Errorf("%w: more than one column maps to %s", ErrInvalidCatalogFile, field)
+		}
+		fields[i] = field
+		table.Headers[field] = strings.TrimSpace(header)
+	}
+	if _, ok := table.Headers["sku"]; !ok {
+		return nil, fmt.Errorf("%w: no column maps to sku", ErrInvalidCatalogFile)
+	}
+
+	for i, record := range records[1:] {
+		row := catalogRow{Line: i + 2, Values: make(map[string]string)}
+		blank := true
+		for j, value := range record {
+			if fields[j] == "" {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			row.Values[fields[j]] = value
+			if value != "" {
+				blank = false
+			}
+		}
+		if !blank {
+			table.Rows = append(table.Rows, row)
+		}
+	}
+	return table, nil
+}
+
+// plan resolves every row against the catalog. Product rows are planned
+// before variation rows so a variation can belong to a product created by the
+// same file. Blank cells leave the field as it is.
+func (s *CatalogImportService) plan(ctx context.Context, catalogImport *domain.CatalogImport, table *catalogTable) (*catalogPlan, error) {
+	categories, err := s.loadCategories(ctx, catalogImport.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	location, err := s.inventory.ResolveLocation(ctx, catalogImport.TenantID, catalogImport.LocationID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &catalogPlan{
+		TenantID:   catalogImport.TenantID,
+		Location:   location,
+		Categories: categories,
+		headers:    table.Headers,
+		slugs:      make(map[string]bool),
+	}
+
+	seen := make(map[string]int)
+	products := make(map[string]*catalogItem)
+	failed := make(map[string]bool)
+	var variationRows []catalogRow
+	for _, row := range table.Rows {
+		sku := row.Values["sku"]
+		if sku == "" {
+			plan.fail(row.Line, "", "sku", "SKU is required")
+			continue
+		}
+		if line, ok := seen[sku]; ok {
+			plan.fail(row.Line, sku, "sku", fmt.Sprintf("SKU already appears on row %d", line))
+			continue
+		}
+		seen[sku] = row.Line
+
+		if row.Values["parent_sku"] != "" {
+			variationRows = append(variationRows, row)
+			continue
+		}
+		item := s.planProduct(ctx, plan, row)
+		if item == nil {
+			failed[sku] = true
+			continue
+		}
+		products[sku] = item
+		plan.Products = append(plan.Products, item)
+	}
+
+	for _, row := range variationRows {
+		if item := s.planVariation(ctx, plan, row, products, failed); item != nil {
+			plan.Variations = append(plan.Variations, item)
+		}
+	}
+	return plan, nil
+}
+
+// planProduct resolves a product row, or records its errors and returns nil
+func (s *CatalogImportService) planProduct(ctx context.Context, plan *catalogPlan, row catalogRow) *catalogItem {
+	sku := row.Values["sku"]
+	item := &catalogItem{Line: row.Line, SKU: sku, Action: catalogActionUpdate, Changes: make(map[string]catalogFieldChange)}
+
+	if existing, err := s.productRepo.GetBySKU(ctx, plan.TenantID, sku); err == nil && existing != nil {
+		product := *existing
+		item.Product = &product
+	} else {
+		if variation, err := s.variationRepo.GetBySKU(ctx, plan.TenantID, sku); err == nil && variation != nil {
+			plan.fail(row.Line, sku, "parent_sku", "SKU belongs to a product variation; set its parent_sku")
+			return nil
+		}
+		item.Action = catalogActionCreate
+		item.Product = &domain.Product{
+			ID:                uuid.New(),
+			TenantID:          plan.TenantID,
+			SKU:               sku,
+			ProductType:       domain.ProductTypeSimple,
+			Status:            domain.ProductStatusDraft,
+			TaxClass:          "standard",
+			ManageStock:       true,
+			LowStockThreshold: 5,
+			StockStatus:       domain.StockStatusInStock,
+			Backorders:        "no",
+			Attributes:        make(map[string]interface{}),
+			Metadata:          make(map[string]interface{}),
+		}
+	}
+	product := item.Product
+
+	valid := true
+	for _, field := range catalogColumns {
+		value := row.Values[field]
+		switch field {
+		case "sku", "parent_sku", "category", "stock_quantity":
+			continue
+		}
+		if value == "" {
+			continue
+		}
+
+		before := catalogProductValue(product, field)
+		if err := setCatalogProductValue(product, field, value); err != nil {
+			plan.fail(row.Line, sku, field, err.Error())
+			valid = false
+			continue
+		}
+		if after := catalogProductValue(product, field); after != before {
+			item.Changes[field] = catalogFieldChange{From: before, To: after}
+		}
+	}
+
+	if product.Name == "" {
+		plan.fail(row.Line, sku, "name", "name is required for a new product")
+		valid = false
+	}
+	if item.Action == catalogActionCreate && product.Slug == "" {
+		product.Slug = s.productSlug(ctx, plan, product)
+		item.Changes["slug"] = catalogFieldChange{To: product.Slug}
+	}
+
+	if value := normalizeCategoryPath(row.Values["category"]); value != "" {
+		if current := plan.Categories.path(product.CategoryID); !strings.EqualFold(current, value) {
+			item.Category = value
+			item.Changes["category"] = catalogFieldChange{From: current, To: value}
+			plan.addCategory(value)
+		}
+	}
+
+	if value := row.Values["stock_quantity"]; value != "" {
+		if !s.planStock(ctx, plan, item, product, nil, value) {
+			valid = false
+		}
+	}
+
+	if !valid {
+		return nil
+	}
+	if item.Action == catalogActionUpdate && len(item.Changes) == 0 {
+		item.Action = catalogActionUnchanged
+	}
+	return item
+}
+
+// planVariation resolves a variation row, or records its errors and returns nil
+func (s *CatalogImportService) planVariation(ctx context.Context, plan *catalogPlan, row catalogRow, products map[string]*catalogItem, failed map[string]bool) *catalogItem {
+	sku := row.Values["sku"]
+	parentSKU := row.Values["parent_sku"]
+	item := &catalogItem{Line: row.Line, SKU: sku, Action: catalogActionUpdate, Changes: make(map[string]catalogFieldChange)}
+
+	valid := true
+	for _, field := range catalogColumns {
+		if row.Values[field] != "" && !catalogVariationColumns[field] {
+			plan.fail(row.Line, sku, field, "does not apply to a variation row")
+			valid = false
+		}
+	}
+
+	var parent *domain.Product
+	parentItem := products[parentSKU]
+	if parentItem != nil {
+		parent = parentItem.Product
+	} else if failed[parentSKU] {
+		plan.fail(row.Line, sku, "parent_sku", "the parent product's row has errors")
+		return nil
+	} else if existing, err := s.productRepo.GetBySKU(ctx, plan.TenantID, parentSKU); err == nil && existing != nil {
+		parent = existing
+	} else {
+		plan.fail(row.Line, sku, "parent_sku", fmt.Sprintf("parent product %s not found", parentSKU))
+		return nil
+	}
+
+	if existing, err := s.variationRepo.GetBySKU(ctx, plan.TenantID, sku); err == nil && existing != nil {
+		if existing.ProductID != parent.ID {
+			plan.fail(row.Line, sku, "parent_sku", "the variation belongs to another product")
+			return nil
+		}
+		variation := *existing
+		item.Variation = &variation
+	} else {
+		if product, err := s.productRepo.GetBySKU(ctx, plan.TenantID, sku); err == nil && product != nil {
+			plan.fail(row.Line, sku, "sku", "SKU belongs to a product")
+			return nil
+		}
+		item.Action = catalogActionCreate
+		item.Variation = &domain.ProductVariation{
+			ID:          uuid.New(),
+			ProductID:   parent.ID,
+			SKU:         sku,
+			StockStatus: domain.StockStatusInStock,
+			Attributes:  make(map[string]interface{}),
+			Metadata:    make(map[string]interface{}),
+		}
+	}
+	variation := item.Variation
+
+	for _, field := range catalogColumns {
+		value := row.Values[field]
+		switch field {
+		case "sku", "parent_sku", "stock_quantity":
+			continue
+		}
+		if value == "" || !catalogVariationColumns[field] {
+			continue
+		}
+
+		before := catalogVariationValue(variation, field)
+		if err := setCatalogVariationValue(variation, field, value); err != nil {
+			plan.fail(row.Line, sku, field, err.Error())
+			valid = false
+			continue
+		}
+		if after := catalogVariationValue(variation, field); after != before {
+			item.Changes[field] = catalogFieldChange{From: before, To: after}
+		}
+	}
+
+	if value := row.Values["stock_quantity"]; value != "" {
+		if !s.planStock(ctx, plan, item, parent, variation, value) {
+			valid = false
+		}
+	}
+
+	if !valid {
+		return nil
+	}
+
+	// A new product given variations is variable unless its row says otherwise
+	if parentItem != nil && parentItem.Action == catalogActionCreate && parent.ProductType == domain.ProductTypeSimple {
+		if _, set := parentItem.Changes["product_type"]; !set {
+			parent.ProductType = domain.ProductTypeVariable
+			parentItem.Changes["product_type"] = catalogFieldChange{From: domain.ProductTypeSimple, To: domain.ProductTypeVariable}
+		}
+	}
+	if item.Action == catalogActionUpdate && len(item.Changes) == 0 {
+		item.Action = catalogActionUnchanged
+	}
+	return item
+}
+
+// planStock records a counted quantity for a product or variation. Stock is
+// compared with the count at the plan's location, or with the item's total
+// when the tenant has no locations.
+func (s *CatalogImportService) planStock(ctx context.Context, plan *catalogPlan, item *catalogItem, product *domain.Product, variation *domain.ProductVariation, value string) bool {
+	quantity, err := parseCatalogQuantity(value)
+	if err != nil {
+		plan.fail(item.Line, item.SKU, "stock_quantity", err.Error())
+		return false
+	}
+	if !product.ManageStock {
+		plan.fail(item.Line, item.SKU, "stock_quantity", "stock is not managed for this product; set manage_stock to true")
+		return false
+	}
+
+	before := 0
+	if item.Action != catalogActionCreate {
+		var variationID *uuid.UUID
+		before = product.StockQuantity
+		if variation != nil {
+			variationID = &variation.ID
+			before = variation.StockQuantity
+		}
+		if plan.Location != nil {
+			before, _ = s.inventory.StockAt(ctx, plan.Location.ID, product.ID, variationID)
+		}
+	}
+
+	if quantity != before {
+		item.Stock = &quantity
+		item.StockBefore = before
+		item.Changes["stock_quantity"] = catalogFieldChange{From: fmt.Sprint(before), To: fmt.Sprint(quantity)}
+	}
+	return true
+}
+
+// applyProducts writes a batch of product rows
+func (s *CatalogImportService) applyProducts(ctx context.Context, plan *catalogPlan, batch []*catalogItem, userID *uuid.UUID) error {
+	for _, item := range batch {
+		product := item.Product
+		if item.Category != "" {
+			categoryID := plan.Categories.byPath[strings.ToLower(item.Category)]
+			product.CategoryID = &categoryID
+		}
+
+		if item.Action == catalogActionCreate {
+			// Opening stock is counted in below so it is logged like any other count
+			product.StockQuantity = 0
+			if err := s.productRepo.Create(ctx, product); err != nil {
+				return fmt.Errorf("failed to create product %s: %w", product.SKU, err)
+			}
+		} else if item.fieldsChanged() {
+			if err := s.productRepo.Update(ctx, product); err != nil {
+				return fmt.Errorf("failed to update product %s: %w", product.SKU, err)
+			}
+		}
+	}
+	return s.applyStock(ctx, plan, batch, userID)
+}
+
+// applyVariations writes a batch of variation rows
+func (s *CatalogImportService) applyVariations(ctx context.Context, plan *catalogPlan, batch []*catalogItem, userID *uuid.UUID) error {
+	var creates, updates []*domain.ProductVariation
+	for _, item := range batch {
+		if item.Action == catalogActionCreate {
+			item.Variation.StockQuantity = 0
+			creates = append(creates, item.Variation)
+		} else if item.fieldsChanged() {
+			updates = append(updates, item.Variation)
+		}
+	}
+
+	if len(creates) > 0 {
+		if err := s.variationRepo.BulkCreate(ctx, creates); err != nil {
+			return fmt.Errorf("failed to create variations: %w", err)
+		}
+	}
+	if len(updates) > 0 {
+		if err := s.variationRepo.BulkUpdate(ctx, updates); err != nil {
+			return fmt.Errorf("failed to update variations: %w", err)
+		}
+	}
+	return s.applyStock(ctx, plan, batch, userID)
+}
+
+// applyStock sets the counted quantities of a batch. With a location the
+// inventory service records the count there; otherwise product and variation
+// totals are set directly and the movement logged.
+func (s *CatalogImportService) applyStock(ctx context.Context, plan *catalogPlan, batch []*catalogItem, userID *uuid.UUID) error {
+	const reason = "Catalog import"
+
+	var updates []domain.StockUpdate
+	var logs []*domain.InventoryLog
+	for _, item := range batch {
+		if item.Stock == nil {
+			continue
+		}
+
+		productID, variationID, unitCost := item.Product.ID, (*uuid.UUID)(nil), item.Product.CostPrice
+		if item.Variation != nil {
+			productID, variationID, unitCost = item.Variation.ProductID, &item.Variation.ID, item.Variation.CostPrice
+		}
+
+		if plan.Location != nil {
+			if err := s.inventory.SetStockLevel(ctx, plan.TenantID, plan.Location.ID, productID, variationID, *item.Stock, reason, userID); err != nil {
+				return fmt.Errorf("failed to set stock of %s: %w", item.SKU, err)
+			}
+			continue
+		}
+
+		difference := *item.Stock - item.StockBefore
+		logType := domain.InventoryTypeIn
+		if difference < 0 {
+			logType = domain.InventoryTypeOut
+		}
+		updates = append(updates, domain.StockUpdate{
+			ProductID:   productID,
+			VariationID: variationID,
+			Quantity:    *item.Stock,
+			Type:        "set",
+		})
+		logs = append(logs, &domain.InventoryLog{
+			TenantID:       plan.TenantID,
+			ProductID:      productID,
+			VariationID:    variationID,
+			Type:           logType,
+			Quantity:       abs(difference),
+			QuantityBefore: item.StockBefore,
+			QuantityAfter:  *item.Stock,
+			Reason:         reason,
+			ReferenceType:  "adjustment",
+			CostPerUnit:    unitCost,
+			TotalCost:      unitCost * float64(abs(difference)),
+			UserID:         userID,
+		})
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+	if err := s.productRepo.BulkUpdateStock(ctx, updates); err != nil {
+		return fmt.Errorf("failed to update stock: %w", err)
+	}
+	for _, inventoryLog := range logs {
+		if err := s.inventoryRepo.Create(ctx, inventoryLog); err != nil {
+			return fmt.Errorf("failed to create inventory log: %w", err)
+		}
+	}
+	return nil
+}
+
+// createCategories creates the categories the plan files products under
+// that do not exist yet, parents first
+func (s *CatalogImportService) createCategories(ctx context.Context, plan *catalogPlan) error {
+	for _, categoryPath := range plan.NewCategories {
+		names := strings.Split(categoryPath, catalogCategorySeparator)
+		category := &domain.ProductCategory{
+			ID:       uuid.New(),
+			TenantID: plan.TenantID,
+			Name:     names[len(names)-1],
+			IsActive: true,
+			Metadata: make(map[string]interface{}),
+		}
+		if len(names) > 1 {
+			parentID := plan.Categories.byPath[strings.ToLower(strings.Join(names[:len(names)-1], catalogCategorySeparator))]
+			category.ParentID = &parentID
+		}
+		category.Slug = uniqueCatalogSlug(catalogSlug(categoryPath), func(slug string) bool {
+			existing, err := s.categoryRepo.GetBySlug(ctx, plan.TenantID, slug)
+			return err == nil && existing != nil
+		})
+
+		if err := s.categoryRepo.Create(ctx, category); err != nil {
+			return fmt.Errorf("failed to create category %s: %w", categoryPath, err)
+		}
+		plan.Categories.add(category)
+	}
+	return nil
+}
+
+// productSlug picks a slug for a new product that no other product, in the
+// catalog or the file, already uses
+func (s *CatalogImportService) productSlug(ctx context.Context, plan *catalogPlan, product *domain.Product) string {
+	base := catalogSlug(product.Name)
+	if base == "" {
+		base = catalogSlug(product.SKU)
+	}
+	slug := uniqueCatalogSlug(base, func(slug string) bool {
+		if plan.slugs[slug] {
+			return true
+		}
+		existing, err := s.productRepo.GetBySlug(ctx, plan.TenantID, slug)
+		return err == nil && existing != nil
+	})
+	plan.slugs[slug] = true
+	return slug
+}
+
+// attachErrorReport replaces an import's error report with one listing errs
+func (s *CatalogImportService) attachErrorReport(ctx context.Context, catalogImport *domain.CatalogImport, errs []catalogRowError) error {
+	if catalogImport.ErrorReportFileID != nil {
+		if err := s.fileService.DeleteFile(ctx, *catalogImport.ErrorReportFileID); err != nil {
+			// The new report replaces it either way; the old file is only left behind
+			s.logger.Error("failed to delete catalog import error report", zap.String("tenant_id", catalogImport.TenantID), zap.String("import_id", catalogImport.ID.String()), zap.String("file_id", catalogImport.ErrorReportFileID.String()), zap.Error(err))
+		}
+		catalogImport.ErrorReportFileID = nil
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Row < errs[j].Row
+	})
+	rows := [][]string{{"row", "sku", "column", "error"}}
+	for _, rowError := range errs {
+		rows = append(rows, []string{fmt.Sprint(rowError.Row), rowError.SKU, rowError.Column, rowError.Error})
+	}
+	data, err := writeCatalogTable(domain.CatalogFormatCSV, rows, nil)
+	if err != nil {
+		return err
+	}
+
+	fileName := strings.TrimSuffix(catalogImport.FileName, path.Ext(catalogImport.FileName)) + "-errors.csv"
+	file, err := s.fileService.UploadFile(ctx, &FileUploadRequest{
+		TenantID: catalogFileTenant(catalogImport.TenantID),
+		UserID:   catalogImport.UserID,
+		File: &FileUpload{
+			File:     catalogFileBuffer{bytes.NewReader(data)},
+			Header:   &multipart.FileHeader{Filename: fileName, Size: int64(len(data))},
+			FileName: fileName,
+			Size:     int64(len(data)),
+			MimeType: "text/csv",
+		},
+		Category: catalogFileCategory,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store error report: %w", err)
+	}
+	catalogImport.ErrorReportFileID = &file.ID
+	return nil
+}
+
+// catalogCategories indexes a tenant's categories by ID and by path
+type catalogCategories struct {
+	byID   map[uuid.UUID]*domain.ProductCategory
+	byPath map[string]uuid.UUID // Lower-cased path, e.g. "clothing > shirts"
+}
+
+func (s *CatalogImportService) loadCategories(ctx context.Context, tenantID string) (*catalogCategories, error) {
+	tree, err := s.categoryRepo.GetTreeByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load categories: %w", err)
+	}
+
+	categories := &catalogCategories{
+		byID:   make(map[uuid.UUID]*domain.ProductCategory),
+		byPath: make(map[string]uuid.UUID),
+	}
+	var collect func(category *domain.ProductCategory)
+	collect = func(category *domain.ProductCategory) {
+		if category.DeletedAt != nil {
+			return
+		}
+		categories.byID[category.ID] = category
+		for i := range category.Children {
+			collect(&category.Children[i])
+		}
+	}
+	for _, category := range tree {
+		collect(category)
+	}
+	for id := range categories.byID {
+		id := id
+		categories.byPath[strings.ToLower(categories.path(&id))] = id
+	}
+	return categories, nil
+}
+
+// path returns a category's path from the root, e.g. "Clothing > Shirts"
+func (c *catalogCategories) path(categoryID *uuid.UUID) string {
+	var names []string
+	// The depth limit guards against a parent cycle in bad data
+	for depth := 0; categoryID != nil && depth < 32; depth++ {
+		category, ok := c.byID[*categoryID]
+		if !ok {
+			break
+		}
+		names = append([]string{category.Name}, names...)
+		categoryID = category.ParentID
+	}
+	return strings.Join(names, catalogCategorySeparator)
+}
+
+func (c *catalogCategories) add(category *domain.ProductCategory) {
+	c.byID[category.ID] = category
+	c.byPath[strings.ToLower(c.path(&category.ID))] = category.ID
+}
+
+// addCategory plans the creation of whichever levels of a category path do
+// not exist yet
+func (p *catalogPlan) addCategory(categoryPath string) {
+	names := strings.Split(categoryPath, catalogCategorySeparator)
+	for i := range names {
+		prefix := strings.Join(names[:i+1], catalogCategorySeparator)
+		if _, ok := p.Categories.byPath[strings.ToLower(prefix)]; ok {
+			continue
+		}
+		planned := false
+		for _, newCategory := range p.NewCategories {
+			if strings.EqualFold(newCategory, prefix) {
+				planned = true
+				break
+			}
+		}
+		if !planned {
+			p.NewCategories = append(p.NewCategories, prefix)
+		}
+	}
+}
+
+func (p *catalogPlan) fail(line int, sku, field, message string) {
+	column := field
+	if header, ok := p.headers[field]; ok {
+		column = header
+	}
+	p.Errors = append(p.Errors, catalogRowError{Row: line, SKU: sku, Column: column, Error: message})
+}
+
+// errorRows counts the rows with at least one error
+func (p *catalogPlan) errorRows() int {
+	lines := make(map[int]bool)
+	for _, rowError := range p.Errors {
+		lines[rowError.Row] = true
+	}
+	return len(lines)
+}
+
+// summary counts the planned creates, updates and unchanged rows per entity
+func (p *catalogPlan) summary() map[string]interface{} {
+	count := func(items []*catalogItem) map[string]int {
+		counts := map[string]int{catalogActionCreate: 0, catalogActionUpdate: 0, catalogActionUnchanged: 0}
+		for _, item := range items {
+			counts[item.Action]++
+		}
+		return counts
+	}
+	return map[string]interface{}{
+		"categories": map[string]int{catalogActionCreate: len(p.NewCategories)},
+		"products":   count(p.Products),
+		"variations": count(p.Variations),
+		"errors":     len(p.Errors),
+	}
+}
+
+// diff lists the planned changes field by field, up to catalogImportMaxDiff
+func (p *catalogPlan) diff() map[string]interface{} {
+	var changes []catalogChange
+	for _, categoryPath := range p.NewCategories {
+		changes = append(changes, catalogChange{Entity: "category", Action: catalogActionCreate, Key: categoryPath})
+	}
+	for _, item := range append(append([]*catalogItem{}, p.Products...), p.Variations...) {
+		if item.Action == catalogActionUnchanged {
+			continue
+		}
+		entity := "product"
+		if item.Variation != nil {
+			entity = "variation"
+		}
+		changes = append(changes, catalogChange{Row: item.Line, Entity: entity, Action: item.Action, Key: item.SKU, Fields: item.Changes})
+	}
+
+	truncated := len(changes) > catalogImportMaxDiff
+	if truncated {
+		changes = changes[:catalogImportMaxDiff]
+	}
+	return map[string]interface{}{
+		"changes":   changes,
+		"truncated": truncated,
+	}
+}
+
+// fieldsChanged reports whether a row changes more than the stock count,
+// which is written separately
+func (i *catalogItem) fieldsChanged() bool {
+	changed := len(i.Changes)
+	if _, ok := i.Changes["stock_quantity"]; ok {
+		changed--
+	}
+	return changed > 0
+}
+
+// catalogBatches splits the rows that change something into batches
+func catalogBatches(items []*catalogItem) [][]*catalogItem {
+	var batches [][]*catalogItem
+	var batch []*catalogItem
+	for _, item := range items {
+		if item.Action == catalogActionUnchanged {
+			continue
+		}
+		batch = append(batch, item)
+		if len(batch) == catalogImportBatchSize {
+			batches = append(batches, batch)
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// catalogRecord orders a row's values by catalogColumns
+func catalogRecord(values map[string]string) []string {
+	record := make([]string, len(catalogColumns))
+	for i, column := range catalogColumns {
+		record[i] = values[column]
+	}
+	return record
+}
+
+// uniqueCatalogSlug appends -2, -3, ... to base until taken reports it free
+func uniqueCatalogSlug(base string, taken func(slug string) bool) string {
+	slug := base
+	for i := 2; taken(slug); i++ {
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+	return slug
+}
+
+// catalogFileTenant returns the tenant ID files are stored under, or nil when
+// the POS tenant ID is not a UUID
+func catalogFileTenant(tenantID string) *uuid.UUID {
+	id, err := uuid.Parse(tenantID)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
+// catalogFileBuffer serves generated bytes as an uploaded file
+type catalogFileBuffer struct {
+	*bytes.Reader
+}
+
+func (catalogFileBuffer) Close() error {
+	return nil
+}
@@ -0,0 +1,360 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+)
+
+// catalogFormat picks the table format from a file name
+func catalogFormat(fileName string) (string, error) {
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".csv":
+		return domain.CatalogFormatCSV, nil
+	case ".xlsx":
+		return domain.CatalogFormatXLSX, nil
+	}
+	return "", fmt.Errorf("%w: only .csv and .xlsx files are supported", ErrInvalidCatalogFile)
+}
+
+// readCatalogTable reads the rows of a CSV file, or of the first worksheet of an
+// XLSX workbook. Short rows are padded so every row is as wide as the widest
+func readCatalogTable(format string, data []byte) ([][]string, error) {
+	var rows [][]string
+	var err error
+	switch format {
+	case domain.CatalogFormatCSV:
+		rows, err = readCSVTable(data)
+	case domain.CatalogFormatXLSX:
+		rows, err = readXLSXTable(data)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %s", ErrInvalidCatalogFile, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// writeCatalogTable writes rows as CSV or as a single-sheet XLSX workbook.
+// Columns listed in numeric are written as numbers in XLSX
+func writeCatalogTable(format string, rows [][]string, numeric map[int]bool) ([]byte, error) {
+	switch format {
+	case domain.CatalogFormatCSV:
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		if err := writer.WriteAll(rows); err != nil {
+			return nil, fmt.Errorf("failed to write CSV: %w", err)
+		}
+		return buf.Bytes(), nil
+	case domain.CatalogFormatXLSX:
+		return writeXLSXTable(rows, numeric)
+	}
+	return nil, fmt.Errorf("%w: unsupported format %s", ErrInvalidCatalogFile, format)
+}
+
+func readCSVTable(data []byte) ([][]string, error) {
+	// Spreadsheet tools often save CSV with a UTF-8 byte order mark
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCatalogFile, err)
+	}
+	return rows, nil
+}
+
+// XLSX is a zip of SpreadsheetML parts. Only what a catalog needs is read:
+// cell values of the first worksheet, with shared and inline strings
+
+type xlsxSharedStrings struct {
+	Items []xlsxStringItem `xml:"si"`
+}
+
+type xlsxStringItem struct {
+	Text string          `xml:"t"`
+	Runs []xlsxStringRun `xml:"r"`
+}
+
+type xlsxStringRun struct {
+	Text string `xml:"t"`
+}
+
+func (i xlsxStringItem) value() string {
+	if len(i.Runs) == 0 {
+		return i.Text
+	}
+	var text strings.Builder
+	text.WriteString(i.Text)
+	for _, run := range i.Runs {
+		text.WriteString(run.Text)
+	}
+	return text.String()
+}
+
+type xlsxWorksheet struct {
+	Rows []xlsxRow `xml:"sheetData>row"`
+}
+
+type xlsxRow struct {
+	Index int        `xml:"r,attr"`
+	Cells []xlsxCell `xml:"c"`
+}
+
+type xlsxCell struct {
+	Ref    string          `xml:"r,attr"`
+	Type   string          `xml:"t,attr"`
+	Value  string          `xml:"v"`
+	Inline *xlsxStringItem `xml:"is"`
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+func readXLSXTable(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCatalogFile, err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var shared xlsxSharedStrings
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeXLSXPart(file, &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	sheetFile := files[firstXLSXSheet(files)]
+	if sheetFile == nil {
+		return nil, fmt.Errorf("%w: the workbook has no worksheet", ErrInvalidCatalogFile)
+	}
+	var sheet xlsxWorksheet
+	if err := decodeXLSXPart(sheetFile, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for i, row := range sheet.Rows {
+		index := row.Index
+		if index == 0 {
+			index = i + 1
+		}
+		for len(rows) < index {
+			rows = append(rows, nil)
+		}
+
+		var values []string
+		for j, cell := range row.Cells {
+			column := j
+			if cell.Ref != "" {
+				column = xlsxColumnIndex(cell.Ref)
+			}
+			for len(values) <= column {
+				values = append(values, "")
+			}
+			values[column] = xlsxCellValue(cell, shared)
+		}
+		rows[index-1] = values
+	}
+	return rows, nil
+}
+
+// firstXLSXSheet finds the part holding the workbook's first sheet
+func firstXLSXSheet(files map[string]*zip.File) string {
+	var workbook xlsxWorkbook
+	var rels xlsxRelationships
+	if wb, ok := files["xl/workbook.xml"]; ok && decodeXLSXPart(wb, &workbook) == nil && len(workbook.Sheets) > 0 {
+		if rf, ok := files["xl/_rels/workbook.xml.rels"]; ok && decodeXLSXPart(rf, &rels) == nil {
+			for _, rel := range rels.Relationships {
+				if rel.ID != workbook.Sheets[0].RelID {
+					continue
+				}
+				if strings.HasPrefix(rel.Target, "/") {
+					return strings.TrimPrefix(rel.Target, "/")
+				}
+				return path.Join("xl", rel.Target)
+			}
+		}
+	}
+
+	// Fall back to the lowest numbered worksheet
+	var sheets []string
+	for name := range files {
+		if strings.HasPrefix(name, "xl/worksheets/") && strings.HasSuffix(name, ".xml") {
+			sheets = append(sheets, name)
+		}
+	}
+	sort.Strings(sheets)
+	if len(sheets) == 0 {
+		return ""
+	}
+	return sheets[0]
+}
+
+func decodeXLSXPart(file *zip.File, out interface{}) error {
+	reader, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCatalogFile, err)
+	}
+	defer reader.Close()
+
+	if err := xml.NewDecoder(reader).Decode(out); err != nil && err != io.EOF {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidCatalogFile, file.Name, err)
+	}
+	return nil
+}
+
+func xlsxCellValue(cell xlsxCell, shared xlsxSharedStrings) string {
+	switch cell.Type {
+	case "s":
+		index, err := strconv.Atoi(cell.Value)
+		if err != nil || index < 0 || index >= len(shared.Items) {
+			return ""
+		}
+		return shared.Items[index].value()
+	case "inlineStr":
+		if cell.Inline == nil {
+			return ""
+		}
+		return cell.Inline.value()
+	case "b":
+		if cell.Value == "1" {
+			return "true"
+		}
+		return "false"
+	case "str", "e":
+		return cell.Value
+	}
+
+	// Numbers come back in full binary precision, e.g. 19.899999999999999
+	if number, err := strconv.ParseFloat(cell.Value, 64); err == nil {
+		return strconv.FormatFloat(math.Round(number*1e9)/1e9, 'f', -1, 64)
+	}
+	return cell.Value
+}
+
+// xlsxColumnIndex turns a cell reference such as "AB12" into a zero-based column
+func xlsxColumnIndex(ref string) int {
+	index := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+	}
+	return index - 1
+}
+
+func xlsxColumnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Catalog" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+)
+
+// writeXLSXTable writes rows to a minimal workbook with inline strings, which
+// every spreadsheet application opens without a shared string table
+func writeXLSXTable(rows [][]string, numeric map[int]bool) ([]byte, error) {
+	var sheet bytes.Buffer
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(&sheet, `<row r="%d">`, i+1)
+		for j, value := range row {
+			if value == "" {
+				continue
+			}
+			ref := fmt.Sprintf("%s%d", xlsxColumnName(j), i+1)
+			if i > 0 && numeric[j] {
+				if _, err := strconv.ParseFloat(value, 64); err == nil {
+					fmt.Fprintf(&sheet, `<c r="%s"><v>%s</v></c>`, ref, value)
+					continue
+				}
+			}
+			fmt.Fprintf(&sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			if err := xml.EscapeText(&sheet, []byte(value)); err != nil {
+				return nil, fmt.Errorf("failed to write XLSX: %w", err)
+			}
+			sheet.WriteString(`</t></is></c>`)
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	parts := []struct {
+		name    string
+		content []byte
+	}{
+		{"[Content_Types].xml", []byte(xlsxContentTypes)},
+		{"_rels/.rels", []byte(xlsxRootRels)},
+		{"xl/workbook.xml", []byte(xlsxWorkbookXML)},
+		{"xl/_rels/workbook.xml.rels", []byte(xlsxWorkbookRels)},
+		{"xl/worksheets/sheet1.xml", sheet.Bytes()},
+	}
+	for _, part := range parts {
+		writer, err := archive.Create(part.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write XLSX: %w", err)
+		}
+		if _, err := writer.Write(part.content); err != nil {
+			return nil, fmt.Errorf("failed to write XLSX: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+var (
+	ErrInvalidCustomer = errors.New("invalid customer")
+	ErrCustomerExists  = errors.New("a customer with this email or phone already exists")
+)
+
+// CustomerService manages a tenant's customers and their purchase history
+type CustomerService struct {
+	customerRepo repositories.CustomerRepository
+	orderRepo    repositories.OrderRepository
+	wishlistRepo repositories.WishlistRepository
+}
+
+// NewCustomerService creates a new customer service
+func NewCustomerService(
+	customerRepo repositories.CustomerRepository,
+	orderRepo repositories.OrderRepository,
+	wishlistRepo repositories.WishlistRepository,
+) *CustomerService {
+	return &CustomerService{
+		customerRepo: customerRepo,
+		orderRepo:    orderRepo,
+		wishlistRepo: wishlistRepo,
+	}
+}
+
+// CreateCustomer adds a customer. Email and phone identify customers at the
+// till, so each may belong to only one of the tenant's customers.
+func (s *CustomerService) CreateCustomer(ctx context.Context, customer *domain.Customer) error {
+	normalizeCustomer(customer)
+	if err := s.validateCustomer(ctx, customer); err != nil {
+		return err
+	}
+
+	customer.ID = uuid.New()
+	customer.LoyaltyPoints = 0
+	customer.LifetimePoints = 0
+	customer.OrdersCount = 0
+	customer.TotalSpent = 0
+	customer.LastOrderAt = nil
+	if customer.Metadata == nil {
+		customer.Metadata = make(map[string]interface{})
+	}
+
+	if err := s.customerRepo.Create(ctx, customer); err != nil {
+		return fmt.Errorf("failed to create customer: %w", err)
+	}
+	return nil
+}
+
+// UpdateCustomer changes a customer's details. Loyalty balances and purchase
+// totals are kept from the stored customer; they only change through the ledger
+// and paid orders.
+func (s *CustomerService) UpdateCustomer(ctx context.Context, tenantID string, customer *domain.Customer) error {
+	existing, err := s.GetCustomer(ctx, tenantID, customer.ID)
+	if err != nil {
+		return err
+	}
+
+	normalizeCustomer(customer)
+	customer.TenantID = existing.TenantID
+	if err := s.validateCustomer(ctx, customer); err != nil {
+		return err
+	}
+
+	existing.UserID = customer.UserID
+	existing.FirstName = customer.FirstName
+	existing.LastName = customer.LastName
+	existing.Email = customer.Email
+	existing.Phone = customer.Phone
+	existing.AcceptsMarketing = customer.AcceptsMarketing
+	existing.Group = customer.Group
+	existing.Notes = customer.Notes
+	if customer.Metadata != nil {
+		existing.Metadata = customer.Metadata
+	}
+
+	if err := s.customerRepo.Update(ctx, existing); err != nil {
+		return fmt.Errorf("failed to update customer: %w", err)
+	}
+	*customer = *existing
+	return nil
+}
+
+// DeleteCustomer removes a customer. Past orders keep their customer link.
+func (s *CustomerService) DeleteCustomer(ctx context.Context, tenantID string, customerID uuid.UUID) error {
+	if _, err := s.GetCustomer(ctx, tenantID, customerID); err != nil {
+		return err
+	}
+	return s.customerRepo.Delete(ctx, customerID)
+}
+
+// GetCustomer returns one of the tenant's customers
+func (s *CustomerService) GetCustomer(ctx context.Context, tenantID string, customerID uuid.UUID) (*domain.Customer, error) {
+	customer, err := s.customerRepo.GetByID(ctx, customerID)
+	if err != nil || customer == nil || customer.TenantID != tenantID || customer.DeletedAt != nil {
+		return nil, ErrCustomerNotFound
+	}
+	return customer, nil
+}
+
+// ListCustomers returns the tenant's customers
+func (s *CustomerService) ListCustomers(ctx context.Context, tenantID string, filter *domain.CustomerFilter) ([]*domain.Customer, int64, error) {
+	return s.customerRepo.GetByTenantID(ctx, tenantID, filter)
+}
+
+// FindCustomer looks a customer up by email or phone, as given at the till
+func (s *CustomerService) FindCustomer(ctx context.Context, tenantID string, email, phone string) (*domain.Customer, error) {
+	if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+		customer, err := s.customerRepo.GetByEmail(ctx, tenantID, email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find customer: %w", err)
+		}
+		if customer != nil {
+			return customer, nil
+		}
+	}
+	if phone = strings.TrimSpace(phone); phone != "" {
+		customer, err := s.customerRepo.GetByPhone(ctx, tenantID, phone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find customer: %w", err)
+		}
+		if customer != nil {
+			return customer, nil
+		}
+	}
+	return nil, ErrCustomerNotFound
+}
+
+// GetPurchaseHistory returns the customer's orders
+func (s *CustomerService) GetPurchaseHistory(ctx context.Context, tenantID string, customerID uuid.UUID, filter *domain.OrderFilter) ([]*domain.Order, int64, error) {
+	if _, err := s.GetCustomer(ctx, tenantID, customerID); err != nil {
+		return nil, 0, err
+	}
+	if filter == nil {
+		filter = &domain.OrderFilter{Page: 1, Limit: 20}
+	}
+	filter.CustomerID = &customerID
+	return s.orderRepo.GetByTenantID(ctx, tenantID, filter)
+}
+
+// GetWishlists returns the wishlists linked to the customer
+func (s *CustomerService) GetWishlists(ctx context.Context, tenantID string, customerID uuid.UUID) ([]*domain.Wishlist, error) {
+	if _, err := s.GetCustomer(ctx, tenantID, customerID); err != nil {
+		return nil, err
+	}
+	return s.wishlistRepo.GetByCustomerID(ctx, customerID)
+}
+
+// LinkWishlist attaches one of the tenant's wishlists to a customer
+func (s *CustomerService) LinkWishlist(ctx context.Context, tenantID string, customerID, wishlistID uuid.UUID) error {
+	if _, err := s.GetCustomer(ctx, tenantID, customerID); err != nil {
+		return err
+	}
+	wishlist, err := s.wishlistRepo.GetByID(ctx, wishlistID)
+	if err != nil || wishlist == nil || wishlist.TenantID != tenantID {
+		return errors.New("wishlist not found")
+	}
+
+	wishlist.CustomerID = &customerID
+	wishlist.UpdatedAt = time.Now()
+	return s.wishlistRepo.Update(ctx, wishlist)
+}
+
+func (s *CustomerService) validateCustomer(ctx context.Context, customer *domain.Customer) error {
+	if customer.Email == "" && customer.Phone == "" && customer.FirstName == "" && customer.LastName == "" {
+		return fmt.Errorf("%w: a name, email or phone is required", ErrInvalidCustomer)
+	}
+
+	if customer.Email != "" {
+		existing, err := s.customerRepo.GetByEmail(ctx, customer.TenantID, customer.Email)
+		if err != nil {
+			return fmt.Errorf("failed to check customer email: %w", err)
+		}
+		if existing != nil && existing.ID != customer.ID {
+			return ErrCustomerExists
+		}
+	}
+	if customer.Phone != "" {
+		existing, err := s.customerRepo.GetByPhone(ctx, customer.TenantID, customer.Phone)
+		if err != nil {
+			return fmt.Errorf("failed to check customer phone: %w", err)
+		}
+		if existing != nil && existing.ID != customer.ID {
+			return ErrCustomerExists
+		}
+	}
+
+	return nil
+}
+
+func normalizeCustomer(customer *domain.Customer) {
+	customer.FirstName = strings.TrimSpace(customer.FirstName)
+	customer.LastName = strings.TrimSpace(customer.LastName)
+	customer.Email = strings.ToLower(strings.TrimSpace(customer.Email))
+	customer.Phone = strings.TrimSpace(customer.Phone)
+	customer.Group = strings.ToLower(strings.TrimSpace(customer.Group))
+}
@@ -0,0 +1,425 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+// Cart metadata keys used by the discount engine
+const (
+	cartMetadataDiscountCodes    = "discount_codes"
+	cartMetadataAppliedDiscounts = "applied_discounts"
+	cartMetadataFreeShipping     = "free_shipping"
+	itemMetadataDiscountTotal    = "discount_total"
+)
+
+// ErrDiscountUnavailable is returned when a discount can no longer be redeemed at checkout
+var ErrDiscountUnavailable = errors.New("discount is no longer available")
+
+// DefaultDiscountStackingRules applies when a tenant has not configured stacking
+var DefaultDiscountStackingRules = domain.DiscountStackingRules{AllowStacking: false, MaxCodes: 1}
+
+// AppliedDiscount is a discount code accepted for a cart, with its share per cart line
+type AppliedDiscount struct {
+	DiscountID   uuid.UUID             `json:"discount_id"`
+	Code         string                `json:"code"`
+	DiscountType string                `json:"discount_type"`
+	Amount       float64               `json:"amount"`
+	FreeShipping bool                  `json:"free_shipping,omitempty"`
+	Allocations  map[uuid.UUID]float64 `json:"allocations,omitempty"` // Cart item ID -> discount amount
+}
+
+// DiscountEvaluation is the outcome of applying a set of codes to a cart
+type DiscountEvaluation struct {
+	Applied       []AppliedDiscount     `json:"applied"`
+	Rejected      map[string]string     `json:"rejected"` // Code -> reason
+	ItemDiscounts map[uuid.UUID]float64 `json:"item_discounts"`
+	DiscountTotal float64               `json:"discount_total"`
+	FreeShipping  bool                  `json:"free_shipping"`
+}
+
+// DiscountService validates discount codes and allocates them across cart lines
+type DiscountService struct {
+	discountRepo repositories.DiscountRepository
+	productRepo  repositories.ProductRepository
+	tenantRepo   domain.TenantRepository
+}
+
+func NewDiscountService(
+	discountRepo repositories.DiscountRepository,
+	productRepo repositories.ProductRepository,
+	tenantRepo domain.TenantRepository,
+) *DiscountService {
+	return &DiscountService{
+		discountRepo: discountRepo,
+		productRepo:  productRepo,
+		tenantRepo:   tenantRepo,
+	}
+}
+
+// StackingRules returns the tenant's discount stacking configuration
+func (s *DiscountService) StackingRules(ctx context.Context, tenantID string) domain.DiscountStackingRules {
+	config := loadTenantConfiguration(ctx, s.tenantRepo, tenantID)
+	if config == nil || config.DiscountStacking == nil {
+		return DefaultDiscountStackingRules
+	}
+
+	return *config.DiscountStacking
+}
+
+// Evaluate validates codes in the order they were entered and allocates every
+// accepted discount across the eligible cart lines. Rejected codes are reported
+// with a reason rather than failing the whole evaluation.
+func (s *DiscountService) Evaluate(ctx context.Context, cart *domain.Cart, items []*domain.CartItem, codes []string) (*DiscountEvaluation, error) {
+	evaluation := &DiscountEvaluation{
+		Rejected:      make(map[string]string),
+		ItemDiscounts: make(map[uuid.UUID]float64),
+	}
+	if len(codes) == 0 {
+		return evaluation, nil
+	}
+
+	rules := s.StackingRules(ctx, cart.TenantID)
+
+	products := make(map[uuid.UUID]*domain.Product)
+	var subtotal float64
+	remaining := make(map[uuid.UUID]float64)
+	for _, item := range items {
+		if _, ok := products[item.ProductID]; !ok {
+			product, err := s.productRepo.GetByID(ctx, item.ProductID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get product %s: %w", item.ProductID, err)
+			}
+			products[item.ProductID] = product
+		}
+		subtotal += item.TotalPrice
+		remaining[item.ID] = item.TotalPrice
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		code = strings.TrimSpace(code)
+		key := strings.ToLower(code)
+		if code == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if len(evaluation.Applied) > 0 && !rules.AllowStacking {
+			evaluation.Rejected[code] = "discount codes cannot be combined"
+			continue
+		}
+		if rules.MaxCodes > 0 && len(evaluation.Applied) >= rules.MaxCodes {
+			evaluation.Rejected[code] = fmt.Sprintf("at most %d discount codes can be used per order", rules.MaxCodes)
+			continue
+		}
+
+		discount, err := s.discountRepo.GetByCode(ctx, cart.TenantID, code)
+		if err != nil || discount == nil {
+			evaluation.Rejected[code] = "invalid discount code"
+			continue
+		}
+
+		if reason, err := s.checkRestrictions(ctx, discount, cart.CustomerID, subtotal); err != nil {
+			return nil, err
+		} else if reason != "" {
+			evaluation.Rejected[code] = reason
+			continue
+		}
+
+		applied, reason := s.allocate(discount, items, products, remaining, rules)
+		if reason != "" {
+			evaluation.Rejected[code] = reason
+			continue
+		}
+		applied.Code = code
+
+		for itemID, amount := range applied.Allocations {
+			remaining[itemID] = roundCurrency(remaining[itemID] - amount)
+			evaluation.ItemDiscounts[itemID] = roundCurrency(evaluation.ItemDiscounts[itemID] + amount)
+		}
+		evaluation.DiscountTotal = roundCurrency(evaluation.DiscountTotal + applied.Amount)
+		evaluation.FreeShipping = evaluation.FreeShipping || applied.FreeShipping
+		evaluation.Applied = append(evaluation.Applied, *applied)
+	}
+
+	return evaluation, nil
+}
+
+// ValidateCode checks whether code could be added to the cart alongside the codes already applied
+func (s *DiscountService) ValidateCode(ctx context.Context, cart *domain.Cart, items []*domain.CartItem, code string) (*domain.DiscountValidation, error) {
+	codes := append(CartDiscountCodes(cart), code)
+	evaluation, err := s.Evaluate(ctx, cart, items, codes)
+	if err != nil {
+		return nil, err
+	}
+
+	validation := &domain.DiscountValidation{}
+	if reason, rejected := evaluation.Rejected[strings.TrimSpace(code)]; rejected {
+		validation.ErrorMessage = reason
+		return validation, nil
+	}
+
+	for _, applied := range evaluation.Applied {
+		if strings.EqualFold(applied.Code, strings.TrimSpace(code)) {
+			discount, err := s.discountRepo.GetByID(ctx, applied.DiscountID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get discount: %w", err)
+			}
+			validation.IsValid = true
+			validation.DiscountAmount = discount.DiscountValue
+			validation.AppliedAmount = applied.Amount
+			validation.UsageCount = discount.UsedCount
+			validation.UsageLimit = discount.UsageLimit
+			return validation, nil
+		}
+	}
+
+	validation.ErrorMessage = "discount code is already applied"
+	return validation, nil
+}
+
+// RedeemForOrder increments usage for every discount applied to the order and
+// records per-customer usage. It re-checks every restriction, including expiry and
+// usage limits, under a row lock, so it must run inside the order creation
+// transaction.
+func (s *DiscountService) RedeemForOrder(ctx context.Context, order *domain.Order, applied []AppliedDiscount) error {
+	for _, entry := range applied {
+		discount, err := s.discountRepo.GetByIDForUpdate(ctx, entry.DiscountID)
+		if err != nil {
+			return fmt.Errorf("failed to get discount %s: %w", entry.Code, err)
+		}
+
+		// The code may have expired or been switched off since it was applied to the cart
+		reason, err := s.checkRestrictions(ctx, discount, order.CustomerID, order.Subtotal)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			return fmt.Errorf("%w: %s: %s", ErrDiscountUnavailable, entry.Code, reason)
+		}
+
+		if err := s.discountRepo.UpdateUsageCount(ctx, discount.ID, 1); err != nil {
+			return fmt.Errorf("failed to update discount usage count: %w", err)
+		}
+
+		usage := &domain.DiscountUsage{
+			TenantID:   order.TenantID,
+			DiscountID: discount.ID,
+			OrderID:    order.ID,
+			UserID:     order.UserID,
+			CustomerID: order.CustomerID,
+			Code:       entry.Code,
+			Amount:     entry.Amount,
+			CreatedAt:  time.Now(),
+		}
+		if err := s.discountRepo.RecordUsage(ctx, usage); err != nil {
+			return fmt.Errorf("failed to record discount usage: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// checkRestrictions returns a non-empty reason when the discount cannot be used.
+// The per-customer limit counts against the order's customer rather than the
+// user placing it, who is the cashier on a POS order.
+func (s *DiscountService) checkRestrictions(ctx context.Context, discount *domain.Discount, customerID *uuid.UUID, subtotal float64) (string, error) {
+	now := time.Now()
+
+	if !discount.IsActive {
+		return "discount code is not active", nil
+	}
+	if discount.StartsAt != nil && now.Before(*discount.StartsAt) {
+		return "discount code is not active yet", nil
+	}
+	if discount.ExpiresAt != nil && now.After(*discount.ExpiresAt) {
+		return "discount code has expired", nil
+	}
+	if discount.UsageLimit > 0 && discount.UsedCount >= discount.UsageLimit {
+		return "discount code has reached its usage limit", nil
+	}
+	if discount.MinimumAmount > 0 && subtotal < discount.MinimumAmount {
+		return fmt.Sprintf("order subtotal must be at least %.2f", discount.MinimumAmount), nil
+	}
+	if discount.MaximumAmount > 0 && subtotal > discount.MaximumAmount {
+		return fmt.Sprintf("order subtotal must not exceed %.2f", discount.MaximumAmount), nil
+	}
+
+	// An order with no customer cannot be counted against one
+	if discount.UsageLimitPerCustomer > 0 && customerID != nil {
+		used, err := s.discountRepo.GetUsageByCustomer(ctx, discount.ID, *customerID)
+		if err != nil {
+			return "", fmt.Errorf("failed to get discount usage: %w", err)
+		}
+		if used >= discount.UsageLimitPerCustomer {
+			return "discount code has already been used the maximum number of times", nil
+		}
+	}
+
+	return "", nil
+}
+
+// allocate computes the discount amount and spreads it across eligible lines in
+// proportion to what is left of each line after earlier discounts
+func (s *DiscountService) allocate(discount *domain.Discount, items []*domain.CartItem, products map[uuid.UUID]*domain.Product, remaining map[uuid.UUID]float64, rules domain.DiscountStackingRules) (*AppliedDiscount, string) {
+	applied := &AppliedDiscount{
+		DiscountID:   discount.ID,
+		DiscountType: discount.DiscountType,
+		Allocations:  make(map[uuid.UUID]float64),
+	}
+
+	if discount.DiscountType == domain.DiscountTypeFreeShipping {
+		applied.FreeShipping = true
+		return applied, ""
+	}
+
+	var eligible []*domain.CartItem
+	var base, available float64
+	for _, item := range items {
+		if !isDiscountEligible(discount, products[item.ProductID]) || remaining[item.ID] <= 0 {
+			continue
+		}
+		eligible = append(eligible, item)
+		available += remaining[item.ID]
+		if rules.CompoundPercentages {
+			base += remaining[item.ID]
+		} else {
+			base += item.TotalPrice
+		}
+	}
+	if len(eligible) == 0 {
+		return nil, "discount code does not apply to any items in the cart"
+	}
+
+	var amount float64
+	switch discount.DiscountType {
+	case domain.DiscountTypePercentage:
+		amount = base * discount.DiscountValue / 100
+	case domain.DiscountTypeFixedAmount:
+		amount = discount.DiscountValue
+	default:
+		return nil, fmt.Sprintf("unsupported discount type: %s", discount.DiscountType)
+	}
+	amount = roundCurrency(amount)
+	if amount > available {
+		amount = roundCurrency(available)
+	}
+	if amount <= 0 {
+		return nil, "discount code does not reduce the cart total"
+	}
+
+	// The last line absorbs rounding so allocations add up to the discount exactly
+	allocated := 0.0
+	for i, item := range eligible {
+		share := roundCurrency(amount * remaining[item.ID] / available)
+		if i == len(eligible)-1 {
+			share = roundCurrency(amount - allocated)
+		}
+		if share > remaining[item.ID] {
+			share = remaining[item.ID]
+		}
+		applied.Allocations[item.ID] = share
+		allocated = roundCurrency(allocated + share)
+	}
+	applied.Amount = allocated
+
+	return applied, ""
+}
+
+// isDiscountEligible applies the product and category include/exclude lists
+func isDiscountEligible(discount *domain.Discount, product *domain.Product) bool {
+	if product == nil {
+		return false
+	}
+
+	productID := product.ID.String()
+	categoryID := ""
+	if product.CategoryID != nil {
+		categoryID = product.CategoryID.String()
+	}
+
+	if containsString(discount.ExcludedProducts, productID) {
+		return false
+	}
+	if categoryID != "" && containsString(discount.ExcludedCategories, categoryID) {
+		return false
+	}
+
+	hasIncludes := len(discount.ApplicableProducts) > 0 || len(discount.ApplicableCategories) > 0
+	if !hasIncludes {
+		return true
+	}
+
+	return containsString(discount.ApplicableProducts, productID) ||
+		(categoryID != "" && containsString(discount.ApplicableCategories, categoryID))
+}
+
+// CartDiscountCodes returns the discount codes entered on a cart
+func CartDiscountCodes(cart *domain.Cart) []string {
+	var codes []string
+	switch value := cart.Metadata[cartMetadataDiscountCodes].(type) {
+	case []string:
+		codes = append(codes, value...)
+	case []interface{}:
+		for _, code := range value {
+			if str, ok := code.(string); ok {
+				codes = append(codes, str)
+			}
+		}
+	}
+	return codes
+}
+
+// CartAppliedDiscounts returns the discounts accepted at the last cart recalculation
+func CartAppliedDiscounts(cart *domain.Cart) []AppliedDiscount {
+	value, ok := cart.Metadata[cartMetadataAppliedDiscounts]
+	if !ok {
+		return nil
+	}
+
+	// Metadata round-trips through jsonb, so decode via JSON whatever its in-memory shape
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var applied []AppliedDiscount
+	if err := json.Unmarshal(data, &applied); err != nil {
+		return nil
+	}
+	return applied
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func metadataFloat(metadata map[string]interface{}, key string) float64 {
+	switch value := metadata[key].(type) {
+	case float64:
+		return value
+	case int:
+		return float64(value)
+	case int64:
+		return float64(value)
+	}
+	return 0
+}
+
+func metadataMap(metadata map[string]interface{}, key string) map[string]interface{} {
+	value, _ := metadata[key].(map[string]interface{})
+	return value
+}
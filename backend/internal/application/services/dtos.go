@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"io"
 	"mime/multipart"
 	"time"
 
@@ -246,6 +247,7 @@ type FileService interface {
 	DeleteFile(ctx context.Context, fileID uuid.UUID) error
 	GetFile(ctx context.Context, fileID uuid.UUID) (*FileResponse, error)
 	GetFileByPath(ctx context.Context, path string) (*FileResponse, error)
+	OpenFile(ctx context.Context, fileID uuid.UUID) (io.ReadCloser, *FileResponse, error)
 }
 
 // AuditService defines audit logging interface
@@ -165,6 +165,20 @@ func (s *FileServiceImpl) GetFileByPath(ctx context.Context, path string) (*File
 	return s.toFileResponse(file), nil
 }
 
+// OpenFile opens a stored file for reading along with its metadata. The caller closes it
+func (s *FileServiceImpl) OpenFile(ctx context.Context, fileID uuid.UUID) (io.ReadCloser, *FileResponse, error) {
+	file, err := s.fileRepo.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	reader, err := os.Open(filepath.Join(s.storageDir, file.FilePath))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return reader, s.toFileResponse(file), nil
+}
+
 // Helper methods
 
 func (s *FileServiceImpl) validateUploadRequest(req *FileUploadRequest) error {
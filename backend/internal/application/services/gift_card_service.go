@@ -0,0 +1,537 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+var (
+	ErrGiftCardNotFound = errors.New("gift card not found")
+	ErrGiftCardExists   = errors.New("a gift card with this code already exists")
+	ErrGiftCardDisabled = errors.New("gift card is disabled")
+	ErrGiftCardExpired  = errors.New("gift card has expired")
+	ErrGiftCardEmpty    = errors.New("gift card has no balance")
+	ErrInvalidGiftCard  = errors.New("invalid gift card")
+)
+
+// Generated gift card codes leave out characters that are easily misread
+const (
+	giftCardCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	giftCardCodeLength   = 16
+)
+
+// GiftCardService issues gift cards and store credit and moves their balances.
+// Every movement is written to the card's transaction ledger
+type GiftCardService struct {
+	txManager repositories.TransactionManager
+	cardRepo  repositories.GiftCardRepository
+	txRepo    repositories.GiftCardTransactionRepository
+}
+
+// NewGiftCardService creates a new gift card service
+func NewGiftCardService(
+	txManager repositories.TransactionManager,
+	cardRepo repositories.GiftCardRepository,
+	txRepo repositories.GiftCardTransactionRepository,
+) *GiftCardService {
+	return &GiftCardService{
+		txManager: txManager,
+		cardRepo:  cardRepo,
+		txRepo:    txRepo,
+	}
+}
+
+// IssueGiftCard creates a card loaded with card.InitialBalance. A code is
+// generated when none is given
+func (s *GiftCardService) IssueGiftCard(ctx context.Context, card *domain.GiftCard, userID *uuid.UUID) error {
+	card.Code = NormalizeGiftCardCode(card.Code)
+	card.InitialBalance = roundCurrency(card.InitialBalance)
+	if card.InitialBalance <= 0 {
+		return fmt.Errorf("%w: the balance must be positive", ErrInvalidGiftCard)
+	}
+	if card.Type == "" {
+		card.Type = domain.GiftCardTypeGiftCard
+	}
+	if card.Type != domain.GiftCardTypeGiftCard && card.Type != domain.GiftCardTypeStoreCredit {
+		return fmt.Errorf("%w: unknown type %s", ErrInvalidGiftCard, card.Type)
+	}
+	if card.ExpiresAt != nil && !card.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: the expiry date is in the past", ErrInvalidGiftCard)
+	}
+
+	if card.Code == "" {
+		code, err := s.generateCode(ctx, card.TenantID)
+		if err != nil {
+			return err
+		}
+		card.Code = code
+	} else if existing, err := s.cardRepo.GetByCode(ctx, card.TenantID, card.Code); err != nil {
+		return fmt.Errorf("failed to check gift card code: %w", err)
+	} else if existing != nil {
+		return ErrGiftCardExists
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		_, err := s.create(ctx, card, nil, "issued", userID)
+		return err
+	})
+}
+
+// GetGiftCard returns one of the tenant's gift cards
+func (s *GiftCardService) GetGiftCard(ctx context.Context, tenantID string, cardID uuid.UUID) (*domain.GiftCard, error) {
+	card, err := s.cardRepo.GetByID(ctx, cardID)
+	if err != nil || card == nil || card.TenantID != tenantID {
+		return nil, ErrGiftCardNotFound
+	}
+	return card, nil
+}
+
+// GetGiftCardByCode looks a card up by the code printed on it
+func (s *GiftCardService) GetGiftCardByCode(ctx context.Context, tenantID string, code string) (*domain.GiftCard, error) {
+	code = NormalizeGiftCardCode(code)
+	if code == "" {
+		return nil, ErrGiftCardNotFound
+	}
+	card, err := s.cardRepo.GetByCode(ctx, tenantID, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gift card: %w", err)
+	}
+	if card == nil {
+		return nil, ErrGiftCardNotFound
+	}
+	return card, nil
+}
+
+// ListGiftCards returns the tenant's gift cards and store credit accounts
+func (s *GiftCardService) ListGiftCards(ctx context.Context, tenantID string, filter *domain.GiftCardFilter) ([]*domain.GiftCard, int64, error) {
+	return s.cardRepo.GetByTenantID(ctx, tenantID, filter)
+}
+
+// GetTransactions returns a card's balance movements, newest first
+func (s *GiftCardService) GetTransactions(ctx context.Context, tenantID string, cardID uuid.UUID, limit, offset int) ([]*domain.GiftCardTransaction, int64, error) {
+	if _, err := s.GetGiftCard(ctx, tenantID, cardID); err != nil {
+		return nil, 0, err
+	}
+	return s.txRepo.GetByGiftCardID(ctx, cardID, limit, offset)
+}
+
+// SetStatus enables or disables a card. A disabled card keeps its balance but
+// cannot be spent
+func (s *GiftCardService) SetStatus(ctx context.Context, tenantID string, cardID uuid.UUID, status string) (*domain.GiftCard, error) {
+	if status != domain.GiftCardStatusActive && status != domain.GiftCardStatusDisabled {
+		return nil, fmt.Errorf("%w: unknown status %s", ErrInvalidGiftCard, status)
+	}
+
+	var card *domain.GiftCard
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		card, err = s.lockCard(ctx, tenantID, cardID)
+		if err != nil {
+			return err
+		}
+		card.Status = status
+		card.UpdatedAt = time.Now()
+		if err := s.cardRepo.Update(ctx, card); err != nil {
+			return fmt.Errorf("failed to update gift card: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// AdjustBalance credits or debits a card by hand, for corrections and goodwill
+func (s *GiftCardService) AdjustBalance(ctx context.Context, tenantID string, cardID uuid.UUID, amount float64, reason string, userID *uuid.UUID) (*domain.GiftCardTransaction, error) {
+	amount = roundCurrency(amount)
+	if amount == 0 {
+		return nil, fmt.Errorf("%w: the adjustment cannot be zero", ErrInvalidGiftCard)
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, fmt.Errorf("%w: a reason is required", ErrInvalidGiftCard)
+	}
+
+	entry := &domain.GiftCardTransaction{
+		Type:   domain.GiftCardEntryAdjustment,
+		Amount: amount,
+		Reason: reason,
+		UserID: userID,
+	}
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		card, err := s.lockCard(ctx, tenantID, cardID)
+		if err != nil {
+			return err
+		}
+		if roundCurrency(card.Balance+amount) < 0 {
+			return fmt.Errorf("%w: %.2f available", ErrGiftCardEmpty, card.Balance)
+		}
+		return s.post(ctx, card, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Redeem spends up to amount from the card with the given code towards an
+// order. When the balance is lower than the amount the whole balance is taken
+// and the returned entry shows how much was actually debited
+func (s *GiftCardService) Redeem(ctx context.Context, tenantID string, code string, amount float64, currency string, orderID *uuid.UUID) (*domain.GiftCardTransaction, error) {
+	amount = roundCurrency(amount)
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: the amount must be positive", ErrInvalidGiftCard)
+	}
+
+	found, err := s.GetGiftCardByCode(ctx, tenantID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &domain.GiftCardTransaction{
+		Type:    domain.GiftCardEntryRedeem,
+		OrderID: orderID,
+		Reason:  "payment",
+	}
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		card, err := s.lockCard(ctx, tenantID, found.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkSpendable(card, currency); err != nil {
+			return err
+		}
+		entry.Amount = -minFloat(amount, card.Balance)
+		return s.post(ctx, card, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Refund puts money taken by a redeem entry back on its card. Refunds against
+// one redeem never add up to more than it took.
+func (s *GiftCardService) Refund(ctx context.Context, redeemID uuid.UUID, amount float64) (*domain.GiftCardTransaction, error) {
+	amount = roundCurrency(amount)
+	redeem, err := s.txRepo.GetByID(ctx, redeemID)
+	if err != nil || redeem == nil || redeem.Type != domain.GiftCardEntryRedeem {
+		return nil, ErrGiftCardNotFound
+	}
+	if amount <= 0 || amount > -redeem.Amount {
+		return nil, fmt.Errorf("%w: refund of %.2f against a payment of %.2f", ErrInvalidGiftCard, amount, -redeem.Amount)
+	}
+
+	entry := &domain.GiftCardTransaction{
+		Type:     domain.GiftCardEntryRefund,
+		OrderID:  redeem.OrderID,
+		ParentID: &redeem.ID,
+		Amount:   amount,
+		Reason:   "refund",
+	}
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		// The card lock keeps other refunds of the redeem out until this one is posted
+		card, err := s.lockCard(ctx, redeem.TenantID, redeem.GiftCardID)
+		if err != nil {
+			return err
+		}
+
+		refunded, err := s.txRepo.GetRefundedAmount(ctx, redeem.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get refunds of the payment: %w", err)
+		}
+		if refundable := roundCurrency(-redeem.Amount - refunded); amount > refundable {
+			return fmt.Errorf("%w: refund of %.2f exceeds the %.2f left to refund on the payment", ErrInvalidGiftCard, amount, refundable)
+		}
+
+		return s.post(ctx, card, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// IssueStoreCredit credits amount to a customer's store credit. The customer's
+// active account in the same currency is topped up; otherwise, or when there is
+// no customer, a new store credit card is issued
+func (s *GiftCardService) IssueStoreCredit(ctx context.Context, tenantID string, customerID *uuid.UUID, amount float64, currency string, orderID *uuid.UUID, reason string, userID *uuid.UUID) (*domain.GiftCard, *domain.GiftCardTransaction, error) {
+	amount = roundCurrency(amount)
+	if amount <= 0 {
+		return nil, nil, fmt.Errorf("%w: the amount must be positive", ErrInvalidGiftCard)
+	}
+
+	var existing *domain.GiftCard
+	if customerID != nil {
+		accounts, _, err := s.cardRepo.GetByTenantID(ctx, tenantID, &domain.GiftCardFilter{
+			Type:       domain.GiftCardTypeStoreCredit,
+			Status:     domain.GiftCardStatusActive,
+			CustomerID: customerID,
+			Page:       1,
+			Limit:      100,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get store credit: %w", err)
+		}
+		now := time.Now()
+		for _, account := range accounts {
+			if strings.EqualFold(account.Currency, currency) && (account.ExpiresAt == nil || account.ExpiresAt.After(now)) {
+				existing = account
+				break
+			}
+		}
+	}
+
+	var card *domain.GiftCard
+	var entry *domain.GiftCardTransaction
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		if existing == nil {
+			code, err := s.generateCode(ctx, tenantID)
+			if err != nil {
+				return err
+			}
+			card = &domain.GiftCard{
+				TenantID:       tenantID,
+				Code:           code,
+				Type:           domain.GiftCardTypeStoreCredit,
+				CustomerID:     customerID,
+				InitialBalance: amount,
+				Currency:       currency,
+			}
+			entry, err = s.create(ctx, card, orderID, reason, userID)
+			return err
+		}
+
+		var err error
+		card, err = s.lockCard(ctx, tenantID, existing.ID)
+		if err != nil {
+			return err
+		}
+		entry = &domain.GiftCardTransaction{
+			Type:    domain.GiftCardEntryIssue,
+			OrderID: orderID,
+			Amount:  amount,
+			Reason:  reason,
+			UserID:  userID,
+		}
+		return s.post(ctx, card, entry)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return card, entry, nil
+}
+
+// create stores a new card and posts its opening balance
+func (s *GiftCardService) create(ctx context.Context, card *domain.GiftCard, orderID *uuid.UUID, reason string, userID *uuid.UUID) (*domain.GiftCardTransaction, error) {
+	now := time.Now()
+	card.ID = uuid.New()
+	card.Status = domain.GiftCardStatusActive
+	card.Balance = 0
+	card.IssuedBy = userID
+	card.CreatedAt = now
+	card.UpdatedAt = now
+	if card.Currency == "" {
+		card.Currency = "USD"
+	}
+	if card.Metadata == nil {
+		card.Metadata = make(map[string]interface{})
+	}
+	if err := s.cardRepo.Create(ctx, card); err != nil {
+		return nil, fmt.Errorf("failed to create gift card: %w", err)
+	}
+
+	entry := &domain.GiftCardTransaction{
+		Type:    domain.GiftCardEntryIssue,
+		OrderID: orderID,
+		Amount:  card.InitialBalance,
+		Reason:  reason,
+		UserID:  userID,
+	}
+	if err := s.post(ctx, card, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *GiftCardService) lockCard(ctx context.Context, tenantID string, cardID uuid.UUID) (*domain.GiftCard, error) {
+	card, err := s.cardRepo.GetByIDForUpdate(ctx, cardID)
+	if err != nil || card == nil || card.TenantID != tenantID {
+		return nil, ErrGiftCardNotFound
+	}
+	return card, nil
+}
+
+// post writes a ledger entry and applies it to the locked card's balance
+func (s *GiftCardService) post(ctx context.Context, card *domain.GiftCard, entry *domain.GiftCardTransaction) error {
+	card.Balance = roundCurrency(card.Balance + entry.Amount)
+	card.UpdatedAt = time.Now()
+	if err := s.cardRepo.Update(ctx, card); err != nil {
+		return fmt.Errorf("failed to update gift card: %w", err)
+	}
+
+	entry.ID = uuid.New()
+	entry.TenantID = card.TenantID
+	entry.GiftCardID = card.ID
+	entry.Balance = card.Balance
+	entry.CreatedAt = card.UpdatedAt
+	if err := s.txRepo.Create(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record gift card transaction: %w", err)
+	}
+	return nil
+}
+
+// generateCode returns a random code not yet used by the tenant
+func (s *GiftCardService) generateCode(ctx context.Context, tenantID string) (string, error) {
+	alphabetSize := big.NewInt(int64(len(giftCardCodeAlphabet)))
+	for attempt := 0; attempt < 5; attempt++ {
+		var code strings.Builder
+		for i := 0; i < giftCardCodeLength; i++ {
+			n, err := rand.Int(rand.Reader, alphabetSize)
+			if err != nil {
+				return "", fmt.Errorf("failed to generate gift card code: %w", err)
+			}
+			code.WriteByte(giftCardCodeAlphabet[n.Int64()])
+		}
+
+		existing, err := s.cardRepo.GetByCode(ctx, tenantID, code.String())
+		if err != nil {
+			return "", fmt.Errorf("failed to check gift card code: %w", err)
+		}
+		if existing == nil {
+			return code.String(), nil
+		}
+	}
+	return "", errors.New("failed to generate a unique gift card code")
+}
+
+// checkSpendable reports why a card cannot pay for an order in currency, if it cannot
+func checkSpendable(card *domain.GiftCard, currency string) error {
+	switch {
+	case card.Status != domain.GiftCardStatusActive:
+		return ErrGiftCardDisabled
+	case card.ExpiresAt != nil && !card.ExpiresAt.After(time.Now()):
+		return ErrGiftCardExpired
+	case currency != "" && card.Currency != "" && !strings.EqualFold(card.Currency, currency):
+		return fmt.Errorf("%w: the card is in %s", ErrInvalidGiftCard, card.Currency)
+	case card.Balance <= 0:
+		return ErrGiftCardEmpty
+	}
+	return nil
+}
+
+// NormalizeGiftCardCode upper-cases a code and strips the spaces and dashes it
+// is printed with
+func NormalizeGiftCardCode(code string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.ToUpper(strings.TrimSpace(code)))
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// GiftCardPaymentGateway takes payments from gift cards and store credit. The
+// payment token is the card code; the charge ID is the card's redeem entry.
+// Like cash, gift card payments settle immediately and cannot be held. A card
+// with less than the amount asked for pays its whole balance, leaving the rest
+// of the order to another tender
+type GiftCardPaymentGateway struct {
+	cards *GiftCardService
+}
+
+// NewGiftCardPaymentGateway creates a gateway spending cards from cards
+func NewGiftCardPaymentGateway(cards *GiftCardService) *GiftCardPaymentGateway {
+	return &GiftCardPaymentGateway{cards: cards}
+}
+
+func (g *GiftCardPaymentGateway) Name() string {
+	return domain.PaymentMethodGiftCard
+}
+
+func (g *GiftCardPaymentGateway) Authorize(ctx context.Context, req *PaymentGatewayRequest) (*PaymentGatewayResult, error) {
+	if !req.Capture {
+		return &PaymentGatewayResult{Status: GatewayStatusDeclined, FailureReason: "gift_card_cannot_be_held"}, nil
+	}
+
+	orderID := req.OrderID
+	entry, err := g.cards.Redeem(ctx, req.TenantID, req.Token, req.Amount, req.Currency, &orderID)
+	if err != nil {
+		if reason := giftCardDeclineReason(err); reason != "" {
+			return &PaymentGatewayResult{Status: GatewayStatusDeclined, Amount: req.Amount, FailureReason: reason}, nil
+		}
+		return nil, err
+	}
+
+	return &PaymentGatewayResult{
+		TransactionID: entry.ID.String(),
+		Status:        GatewayStatusCaptured,
+		Amount:        -entry.Amount,
+		Raw: map[string]interface{}{
+			"gift_card_id": entry.GiftCardID,
+			"balance":      entry.Balance,
+		},
+	}, nil
+}
+
+func (g *GiftCardPaymentGateway) Capture(ctx context.Context, authorizationID string, amount float64) (*PaymentGatewayResult, error) {
+	return &PaymentGatewayResult{TransactionID: authorizationID, Status: GatewayStatusDeclined, FailureReason: "gift_card_cannot_be_held"}, nil
+}
+
+func (g *GiftCardPaymentGateway) Void(ctx context.Context, authorizationID string) (*PaymentGatewayResult, error) {
+	return &PaymentGatewayResult{TransactionID: authorizationID, Status: GatewayStatusDeclined, FailureReason: "gift_card_cannot_be_held"}, nil
+}
+
+func (g *GiftCardPaymentGateway) Refund(ctx context.Context, chargeID string, amount float64) (*PaymentGatewayResult, error) {
+	redeemID, err := uuid.Parse(chargeID)
+	if err != nil {
+		return nil, fmt.Errorf("gift card gateway: unknown charge %s", chargeID)
+	}
+
+	entry, err := g.cards.Refund(ctx, redeemID, amount)
+	if err != nil {
+		if reason := giftCardDeclineReason(err); reason != "" {
+			return &PaymentGatewayResult{TransactionID: chargeID, Status: GatewayStatusDeclined, FailureReason: reason}, nil
+		}
+		return nil, err
+	}
+
+	return &PaymentGatewayResult{
+		TransactionID: entry.ID.String(),
+		Status:        GatewayStatusRefunded,
+		Amount:        entry.Amount,
+		Raw: map[string]interface{}{
+			"gift_card_id": entry.GiftCardID,
+			"balance":      entry.Balance,
+		},
+	}, nil
+}
+
+// giftCardDeclineReason maps a card the customer cannot use to a decline reason
+func giftCardDeclineReason(err error) string {
+	switch {
+	case errors.Is(err, ErrGiftCardNotFound):
+		return "gift_card_not_found"
+	case errors.Is(err, ErrGiftCardDisabled):
+		return "gift_card_disabled"
+	case errors.Is(err, ErrGiftCardExpired):
+		return "gift_card_expired"
+	case errors.Is(err, ErrGiftCardEmpty):
+		return "insufficient_balance"
+	case errors.Is(err, ErrInvalidGiftCard):
+		return "invalid_gift_card"
+	}
+	return ""
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultIdempotencyKeyTTL is how long a completed response is kept for replay
+const DefaultIdempotencyKeyTTL = 24 * time.Hour
+
+// idempotencyLease is how long a key stays reserved for a request without the
+// request renewing it. Do renews it while the request runs, so it only has to
+// outlast a renewal, and a crash frees the key soon rather than blocking retries
+// for the whole TTL.
+const idempotencyLease = 5 * time.Minute
+
+const (
+	idempotencyStatusInProgress = "in_progress"
+	idempotencyStatusCompleted  = "completed"
+)
+
+var (
+	// ErrIdempotencyKeyReused is returned when a key is replayed with a different payload
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request payload")
+	// ErrIdempotencyRequestInProgress is returned when the original request for a key has not finished yet
+	ErrIdempotencyRequestInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+// IdempotencyStore is the tenant-scoped key/value store backing idempotency keys.
+// It is satisfied by database.RedisClient.
+type IdempotencyStore interface {
+	GetWithTenant(ctx context.Context, tenantID, key string) (string, error)
+	SetWithTenant(ctx context.Context, tenantID, key string, value interface{}, expiration time.Duration) error
+	SetNXWithTenant(ctx context.Context, tenantID, key string, value interface{}, expiration time.Duration) (bool, error)
+	DelWithTenant(ctx context.Context, tenantID, key string) error
+}
+
+type idempotencyContextKey struct{}
+
+// WithIdempotencyKey attaches a client-supplied idempotency key (e.g. the
+// Idempotency-Key request header) to the context of a mutating call
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyContextKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the idempotency key attached to ctx, if any
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyContextKey{}).(string)
+	return key
+}
+
+// IdempotencyService makes retried mutations safe by recording the response of
+// the first request for a key and replaying it for later requests
+type IdempotencyService struct {
+	store IdempotencyStore
+	ttl   time.Duration
+}
+
+type idempotencyRecord struct {
+	Status      string          `json:"status"`
+	PayloadHash string          `json:"payload_hash"`
+	Response    json.RawMessage `json:"response,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// NewIdempotencyService creates a new idempotency service
+func NewIdempotencyService(store IdempotencyStore, ttl time.Duration) *IdempotencyService {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyKeyTTL
+	}
+	return &IdempotencyService{store: store, ttl: ttl}
+}
+
+// Do runs fn at most once per tenant, scope and key. fn hands its result back
+// through the caller's variables as usual; when the key has already completed
+// with the same payload, fn is skipped and the stored response is decoded into
+// out instead. Failed calls release the key so the client can retry.
+func (s *IdempotencyService) Do(ctx context.Context, tenantID, scope, key string, payload interface{}, out interface{}, fn func() (interface{}, error)) error {
+	if key == "" {
+		_, err := fn()
+		return err
+	}
+
+	payloadHash, err := hashIdempotencyPayload(payload)
+	if err != nil {
+		return err
+	}
+
+	storeKey := fmt.Sprintf("idempotency:%s:%s", scope, key)
+	pending, err := json.Marshal(&idempotencyRecord{
+		Status:      idempotencyStatusInProgress,
+		PayloadHash: payloadHash,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+
+	acquired, err := s.store.SetNXWithTenant(ctx, tenantID, storeKey, string(pending), idempotencyLease)
+	if err != nil {
+		return fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	if !acquired {
+		return s.replay(ctx, tenantID, storeKey, payloadHash, out)
+	}
+
+	stopRenewing := s.renewLease(ctx, tenantID, storeKey, string(pending))
+	result, err := fn()
+	stopRenewing()
+	if err != nil {
+		if delErr := s.store.DelWithTenant(ctx, tenantID, storeKey); delErr != nil {
+			return fmt.Errorf("%w (and failed to release idempotency key: %v)", err, delErr)
+		}
+		return err
+	}
+
+	response, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotent response: %w", err)
+	}
+
+	completed, err := json.Marshal(&idempotencyRecord{
+		Status:      idempotencyStatusCompleted,
+		PayloadHash: payloadHash,
+		Response:    response,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+
+	if err := s.store.SetWithTenant(ctx, tenantID, storeKey, string(completed), s.ttl); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+
+	return nil
+}
+
+// renewLease keeps a reserved key from expiring while its request runs, so a
+// retry of a slow request is not let in. The returned function stops renewing
+// and waits for a renewal in flight to finish.
+func (s *IdempotencyService) renewLease(ctx context.Context, tenantID, storeKey, pending string) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(idempotencyLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// A missed renewal is retried on the next tick; the lease has two left
+				_ = s.store.SetWithTenant(ctx, tenantID, storeKey, pending, idempotencyLease)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+func (s *IdempotencyService) replay(ctx context.Context, tenantID, storeKey, payloadHash string, out interface{}) error {
+	stored, err := s.store.GetWithTenant(ctx, tenantID, storeKey)
+	if err != nil {
+		// The key expired between reserving and reading it; let the client retry
+		return ErrIdempotencyRequestInProgress
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal([]byte(stored), &record); err != nil {
+		return fmt.Errorf("failed to decode idempotency record: %w", err)
+	}
+
+	if record.PayloadHash != payloadHash {
+		return ErrIdempotencyKeyReused
+	}
+	if record.Status != idempotencyStatusCompleted {
+		return ErrIdempotencyRequestInProgress
+	}
+
+	if err := json.Unmarshal(record.Response, out); err != nil {
+		return fmt.Errorf("failed to decode idempotent response: %w", err)
+	}
+
+	return nil
+}
+
+func hashIdempotencyPayload(payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode idempotency payload: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
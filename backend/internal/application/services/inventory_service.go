@@ -0,0 +1,516 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+// ErrStockLocationNotFound is returned when a location does not exist for the tenant
+var ErrStockLocationNotFound = errors.New("stock location not found")
+
+// InventoryService manages stock locations, per-location stock levels and
+// transfers between locations. Product and variation StockQuantity are kept as
+// the total across locations so location-unaware code keeps working.
+type InventoryService struct {
+	txManager     repositories.TransactionManager
+	locationRepo  repositories.StockLocationRepository
+	levelRepo     repositories.StockLevelRepository
+	transferRepo  repositories.StockTransferRepository
+	productRepo   repositories.ProductRepository
+	variationRepo repositories.ProductVariationRepository
+	inventoryRepo repositories.InventoryLogRepository
+}
+
+func NewInventoryService(
+	txManager repositories.TransactionManager,
+	locationRepo repositories.StockLocationRepository,
+	levelRepo repositories.StockLevelRepository,
+	transferRepo repositories.StockTransferRepository,
+	productRepo repositories.ProductRepository,
+	variationRepo repositories.ProductVariationRepository,
+	inventoryRepo repositories.InventoryLogRepository,
+) *InventoryService {
+	return &InventoryService{
+		txManager:     txManager,
+		locationRepo:  locationRepo,
+		levelRepo:     levelRepo,
+		transferRepo:  transferRepo,
+		productRepo:   productRepo,
+		variationRepo: variationRepo,
+		inventoryRepo: inventoryRepo,
+	}
+}
+
+// stockMovement is a signed change to the stock of one item at one location
+type stockMovement struct {
+	TenantID      string
+	LocationID    uuid.UUID
+	ProductID     uuid.UUID
+	VariationID   *uuid.UUID
+	Quantity      int     // Positive adds stock, negative removes it
+	CountedAs     *int    // When set, the level is set to this count and Quantity is the difference
+	Type          string  // Defaults to in or out by the sign of Quantity
+	UnitCost      float64 // Cost logged per unit; the product's cost price when zero
+	Reason        string
+	ReferenceID   *uuid.UUID
+	ReferenceType string
+	UserID        *uuid.UUID
+	Metadata      map[string]interface{}
+}
+
+// CreateLocation adds a stock location. Making it the default clears the
+// tenant's previous default.
+func (s *InventoryService) CreateLocation(ctx context.Context, location *domain.StockLocation) error {
+	location.Code = strings.ToUpper(strings.TrimSpace(location.Code))
+	if location.Code == "" {
+		return errors.New("location code is required")
+	}
+	if location.Name == "" {
+		return errors.New("location name is required")
+	}
+	if location.Type == "" {
+		location.Type = domain.StockLocationTypeStore
+	}
+	if location.Type != domain.StockLocationTypeStore && location.Type != domain.StockLocationTypeWarehouse {
+		return fmt.Errorf("invalid location type: %s", location.Type)
+	}
+
+	if existing, err := s.locationRepo.GetByCode(ctx, location.TenantID, location.Code); err == nil && existing != nil {
+		return errors.New("location with this code already exists")
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		if location.IsDefault {
+			if err := s.clearDefault(ctx, location.TenantID); err != nil {
+				return err
+			}
+		}
+		if err := s.locationRepo.Create(ctx, location); err != nil {
+			return fmt.Errorf("failed to create stock location: %w", err)
+		}
+		return nil
+	})
+}
+
+// SetDefaultLocation makes the location fulfil carts that do not pick one
+func (s *InventoryService) SetDefaultLocation(ctx context.Context, tenantID string, locationID uuid.UUID) error {
+	location, err := s.GetLocation(ctx, tenantID, locationID)
+	if err != nil {
+		return err
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.clearDefault(ctx, tenantID); err != nil {
+			return err
+		}
+		location.IsDefault = true
+		if err := s.locationRepo.Update(ctx, location); err != nil {
+			return fmt.Errorf("failed to update stock location: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetLocation returns an active location belonging to the tenant
+func (s *InventoryService) GetLocation(ctx context.Context, tenantID string, locationID uuid.UUID) (*domain.StockLocation, error) {
+	location, err := s.locationRepo.GetByID(ctx, locationID)
+	if err != nil || location == nil || location.TenantID != tenantID {
+		return nil, ErrStockLocationNotFound
+	}
+	if !location.IsActive {
+		return nil, fmt.Errorf("stock location %s is not active", location.Code)
+	}
+	return location, nil
+}
+
+// ResolveLocation returns the location a cart or order is fulfilled from: the
+// one it picked, otherwise the tenant default. It returns nil when the tenant
+// has no locations set up, in which case only product totals are tracked.
+func (s *InventoryService) ResolveLocation(ctx context.Context, tenantID string, locationID *uuid.UUID) (*domain.StockLocation, error) {
+	if locationID != nil {
+		return s.GetLocation(ctx, tenantID, *locationID)
+	}
+
+	location, err := s.locationRepo.GetDefault(ctx, tenantID)
+	if err != nil || location == nil || !location.IsActive {
+		return nil, nil
+	}
+	return location, nil
+}
+
+// StockAt returns the quantity of an item on hand at a location
+func (s *InventoryService) StockAt(ctx context.Context, locationID, productID uuid.UUID, variationID *uuid.UUID) (int, error) {
+	level, err := s.levelRepo.Get(ctx, locationID, productID, variationID)
+	if err != nil || level == nil {
+		// Never stocked at this location
+		return 0, nil
+	}
+	return level.Quantity, nil
+}
+
+// SetStockLevel records a counted quantity for an item at a location, e.g. after a stocktake
+func (s *InventoryService) SetStockLevel(ctx context.Context, tenantID string, locationID, productID uuid.UUID, variationID *uuid.UUID, quantity int, reason string, userID *uuid.UUID) error {
+	if quantity < 0 {
+		return errors.New("stock quantity cannot be negative")
+	}
+	if _, err := s.GetLocation(ctx, tenantID, locationID); err != nil {
+		return err
+	}
+	if reason == "" {
+		reason = "Stock count"
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.moveStock(ctx, stockMovement{
+			TenantID:      tenantID,
+			LocationID:    locationID,
+			ProductID:     productID,
+			VariationID:   variationID,
+			CountedAs:     &quantity,
+			Reason:        reason,
+			ReferenceType: "adjustment",
+			UserID:        userID,
+		})
+	})
+}
+
+// AdjustStock adds or removes a quantity of an item at a location, e.g. for
+// damaged goods or stock found on a shelf. Stock cannot go below zero.
+func (s *InventoryService) AdjustStock(ctx context.Context, tenantID string, locationID, productID uuid.UUID, variationID *uuid.UUID, quantity int, reason string, userID *uuid.UUID, metadata map[string]interface{}) error {
+	if quantity == 0 {
+		return errors.New("adjustment quantity cannot be zero")
+	}
+	if _, err := s.GetLocation(ctx, tenantID, locationID); err != nil {
+		return err
+	}
+	if reason == "" {
+		reason = "Stock adjustment"
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.moveStock(ctx, stockMovement{
+			TenantID:      tenantID,
+			LocationID:    locationID,
+			ProductID:     productID,
+			VariationID:   variationID,
+			Quantity:      quantity,
+			Type:          domain.InventoryTypeAdjustment,
+			Reason:        reason,
+			ReferenceType: "adjustment",
+			UserID:        userID,
+			Metadata:      metadata,
+		})
+	})
+}
+
+// GetLowStock returns products at or below their low stock threshold at a
+// location, or across all locations when locationID is nil
+func (s *InventoryService) GetLowStock(ctx context.Context, tenantID string, locationID *uuid.UUID) ([]*domain.Product, error) {
+	return s.productRepo.GetLowStock(ctx, tenantID, locationID)
+}
+
+// GetOutOfStock returns products with no stock at a location, or across all
+// locations when locationID is nil
+func (s *InventoryService) GetOutOfStock(ctx context.Context, tenantID string, locationID *uuid.UUID) ([]*domain.Product, error) {
+	return s.productRepo.GetOutOfStock(ctx, tenantID, locationID)
+}
+
+// CreateTransfer drafts a transfer between two of the tenant's locations
+func (s *InventoryService) CreateTransfer(ctx context.Context, transfer *domain.StockTransfer) error {
+	if transfer.FromLocationID == transfer.ToLocationID {
+		return errors.New("cannot transfer stock to the same location")
+	}
+	if _, err := s.GetLocation(ctx, transfer.TenantID, transfer.FromLocationID); err != nil {
+		return err
+	}
+	if _, err := s.GetLocation(ctx, transfer.TenantID, transfer.ToLocationID); err != nil {
+		return err
+	}
+
+	if len(transfer.Items) == 0 {
+		return errors.New("transfer has no items")
+	}
+	for _, item := range transfer.Items {
+		if item.Quantity <= 0 {
+			return errors.New("transfer quantities must be positive")
+		}
+	}
+
+	transferNumber, err := s.transferRepo.GenerateTransferNumber(ctx, transfer.TenantID)
+	if err != nil {
+		return fmt.Errorf("failed to generate transfer number: %w", err)
+	}
+	transfer.TransferNumber = transferNumber
+	transfer.Status = domain.StockTransferStatusDraft
+
+	if err := s.transferRepo.Create(ctx, transfer); err != nil {
+		return fmt.Errorf("failed to create stock transfer: %w", err)
+	}
+
+	return nil
+}
+
+// ShipTransfer takes the transfer's stock out of the source location. The stock
+// is in transit, and not sellable anywhere, until the transfer is received.
+func (s *InventoryService) ShipTransfer(ctx context.Context, tenantID string, transferID uuid.UUID, userID *uuid.UUID) (*domain.StockTransfer, error) {
+	return s.advanceTransfer(ctx, tenantID, transferID, domain.StockTransferStatusDraft, domain.StockTransferStatusInTransit, func(ctx context.Context, transfer *domain.StockTransfer) error {
+		now := time.Now()
+		transfer.ShippedAt = &now
+		return s.moveTransferItems(ctx, transfer, transfer.FromLocationID, -1, domain.InventoryTypeTransferOut, userID)
+	})
+}
+
+// ReceiveTransfer adds the transfer's stock to the destination location,
+// completing the pair of inventory log entries written when it was shipped
+func (s *InventoryService) ReceiveTransfer(ctx context.Context, tenantID string, transferID uuid.UUID, userID *uuid.UUID) (*domain.StockTransfer, error) {
+	return s.advanceTransfer(ctx, tenantID, transferID, domain.StockTransferStatusInTransit, domain.StockTransferStatusReceived, func(ctx context.Context, transfer *domain.StockTransfer) error {
+		now := time.Now()
+		transfer.ReceivedAt = &now
+		return s.moveTransferItems(ctx, transfer, transfer.ToLocationID, 1, domain.InventoryTypeTransferIn, userID)
+	})
+}
+
+// CancelTransfer cancels a draft transfer, or returns the stock of a transfer in
+// transit to its source location
+func (s *InventoryService) CancelTransfer(ctx context.Context, tenantID string, transferID uuid.UUID, userID *uuid.UUID) (*domain.StockTransfer, error) {
+	var transfer *domain.StockTransfer
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		transfer, err = s.lockTransfer(ctx, tenantID, transferID)
+		if err != nil {
+			return err
+		}
+
+		switch transfer.Status {
+		case domain.StockTransferStatusDraft:
+		case domain.StockTransferStatusInTransit:
+			if err := s.moveTransferItems(ctx, transfer, transfer.FromLocationID, 1, domain.InventoryTypeTransferIn, userID); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("cannot cancel a %s transfer", transfer.Status)
+		}
+
+		transfer.Status = domain.StockTransferStatusCancelled
+		if err := s.transferRepo.Update(ctx, transfer); err != nil {
+			return fmt.Errorf("failed to update stock transfer: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+func (s *InventoryService) advanceTransfer(ctx context.Context, tenantID string, transferID uuid.UUID, from, to string, move func(ctx context.Context, transfer *domain.StockTransfer) error) (*domain.StockTransfer, error) {
+	var transfer *domain.StockTransfer
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		transfer, err = s.lockTransfer(ctx, tenantID, transferID)
+		if err != nil {
+			return err
+		}
+
+		if transfer.Status != from {
+			return fmt.Errorf("transfer %s is %s, expected %s", transfer.TransferNumber, transfer.Status, from)
+		}
+
+		if err := move(ctx, transfer); err != nil {
+			return err
+		}
+
+		transfer.Status = to
+		if err := s.transferRepo.Update(ctx, transfer); err != nil {
+			return fmt.Errorf("failed to update stock transfer: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+func (s *InventoryService) lockTransfer(ctx context.Context, tenantID string, transferID uuid.UUID) (*domain.StockTransfer, error) {
+	transfer, err := s.transferRepo.GetByIDForUpdate(ctx, transferID)
+	if err != nil || transfer == nil || transfer.TenantID != tenantID {
+		return nil, errors.New("stock transfer not found")
+	}
+	return transfer, nil
+}
+
+// moveTransferItems moves every item on the transfer in or out of a location.
+// Items are moved by product and then variation, the order checkouts lock stock in.
+func (s *InventoryService) moveTransferItems(ctx context.Context, transfer *domain.StockTransfer, locationID uuid.UUID, sign int, logType string, userID *uuid.UUID) error {
+	items := make([]domain.StockTransferItem, len(transfer.Items))
+	copy(items, transfer.Items)
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].ProductID != items[j].ProductID {
+			return items[i].ProductID.String() < items[j].ProductID.String()
+		}
+		return stockKey(items[i].ProductID, items[i].VariationID).String() < stockKey(items[j].ProductID, items[j].VariationID).String()
+	})
+
+	for _, item := range items {
+		err := s.moveStock(ctx, stockMovement{
+			TenantID:      transfer.TenantID,
+			LocationID:    locationID,
+			ProductID:     item.ProductID,
+			VariationID:   item.VariationID,
+			Quantity:      sign * item.Quantity,
+			Type:          logType,
+			Reason:        fmt.Sprintf("Stock transfer %s", transfer.TransferNumber),
+			ReferenceID:   &transfer.ID,
+			ReferenceType: "stock_transfer",
+			UserID:        userID,
+			Metadata: map[string]interface{}{
+				"transfer_number":  transfer.TransferNumber,
+				"from_location_id": transfer.FromLocationID,
+				"to_location_id":   transfer.ToLocationID,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveStock applies a movement to the location's stock level and to the product
+// or variation total, and logs it. Rows are locked product, variation, then
+// level, the same order checkout uses. It must run inside a transaction.
+func (s *InventoryService) moveStock(ctx context.Context, m stockMovement) error {
+	product, err := s.productRepo.GetByIDForUpdate(ctx, m.ProductID)
+	if err != nil {
+		return fmt.Errorf("failed to get product %s: %w", m.ProductID, err)
+	}
+	if product.TenantID != m.TenantID {
+		return fmt.Errorf("product %s not found", m.ProductID)
+	}
+	if !product.ManageStock {
+		return nil
+	}
+
+	var variation *domain.ProductVariation
+	if m.VariationID != nil {
+		variation, err = s.variationRepo.GetByIDForUpdate(ctx, *m.VariationID)
+		if err != nil {
+			return fmt.Errorf("failed to get product variation %s: %w", m.VariationID, err)
+		}
+		if variation.ProductID != product.ID {
+			return fmt.Errorf("variation %s does not belong to %s", m.VariationID, product.Name)
+		}
+	}
+
+	level, err := s.levelRepo.GetForUpdate(ctx, m.TenantID, m.LocationID, m.ProductID, m.VariationID)
+	if err != nil {
+		return fmt.Errorf("failed to get stock level: %w", err)
+	}
+	if m.CountedAs != nil {
+		m.Quantity = *m.CountedAs - level.Quantity
+	}
+	if m.Quantity == 0 {
+		return nil
+	}
+	if m.Type == "" {
+		m.Type = domain.InventoryTypeIn
+		if m.Quantity < 0 {
+			m.Type = domain.InventoryTypeOut
+		}
+	}
+	if level.Quantity+m.Quantity < 0 {
+		return fmt.Errorf("%w for product %s: only %d available at this location", ErrInsufficientStock, product.Name, level.Quantity)
+	}
+
+	if err := s.adjustTotal(ctx, product, variation, m.Quantity); err != nil {
+		return err
+	}
+
+	return s.applyToLevel(ctx, level, product, variation, m)
+}
+
+// applyToLevel updates a locked stock level and logs the movement against the
+// location. The log's before and after quantities are the location's.
+func (s *InventoryService) applyToLevel(ctx context.Context, level *domain.StockLevel, product *domain.Product, variation *domain.ProductVariation, m stockMovement) error {
+	before := level.Quantity
+	level.Quantity += m.Quantity
+	if err := s.levelRepo.UpdateQuantity(ctx, level.ID, level.Quantity); err != nil {
+		return fmt.Errorf("failed to update stock level: %w", err)
+	}
+
+	quantity := m.Quantity
+	if quantity < 0 {
+		quantity = -quantity
+	}
+
+	unitCost := m.UnitCost
+	if unitCost == 0 {
+		unitCost = costPriceFor(product, variation)
+	}
+
+	inventoryLog := &domain.InventoryLog{
+		TenantID:       m.TenantID,
+		ProductID:      product.ID,
+		VariationID:    m.VariationID,
+		LocationID:     &level.LocationID,
+		Type:           m.Type,
+		Quantity:       quantity,
+		QuantityBefore: before,
+		QuantityAfter:  level.Quantity,
+		Reason:         m.Reason,
+		ReferenceID:    m.ReferenceID,
+		ReferenceType:  m.ReferenceType,
+		CostPerUnit:    unitCost,
+		TotalCost:      unitCost * float64(quantity),
+		UserID:         m.UserID,
+		Metadata:       m.Metadata,
+	}
+
+	if err := s.inventoryRepo.Create(ctx, inventoryLog); err != nil {
+		return fmt.Errorf("failed to create inventory log: %w", err)
+	}
+
+	return nil
+}
+
+// adjustTotal changes the product or variation stock total by delta
+func (s *InventoryService) adjustTotal(ctx context.Context, product *domain.Product, variation *domain.ProductVariation, delta int) error {
+	if variation != nil {
+		if err := s.variationRepo.UpdateStock(ctx, variation.ID, variation.StockQuantity+delta); err != nil {
+			return fmt.Errorf("failed to update variation stock: %w", err)
+		}
+		variation.StockQuantity += delta
+		return nil
+	}
+
+	if err := s.productRepo.UpdateStock(ctx, product.ID, product.StockQuantity+delta); err != nil {
+		return fmt.Errorf("failed to update product stock: %w", err)
+	}
+	product.StockQuantity += delta
+	return nil
+}
+
+// clearDefault unsets the tenant's current default location
+func (s *InventoryService) clearDefault(ctx context.Context, tenantID string) error {
+	current, err := s.locationRepo.GetDefault(ctx, tenantID)
+	if err != nil || current == nil {
+		return nil
+	}
+	current.IsDefault = false
+	if err := s.locationRepo.Update(ctx, current); err != nil {
+		return fmt.Errorf("failed to update stock location: %w", err)
+	}
+	return nil
+}
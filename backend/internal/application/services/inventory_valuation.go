@@ -0,0 +1,492 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+// Costing methods used to value stock and cost sales
+const (
+	CostingMethodFIFO            = "fifo"
+	CostingMethodWeightedAverage = "weighted_average"
+)
+
+// ItemValuation is the value of one product or variation on hand
+type ItemValuation struct {
+	ProductID   uuid.UUID  `json:"product_id"`
+	VariationID *uuid.UUID `json:"variation_id,omitempty"`
+	ProductName string     `json:"product_name"`
+	SKU         string     `json:"sku"`
+	CategoryID  *uuid.UUID `json:"category_id,omitempty"`
+	Category    string     `json:"category"`
+	Quantity    int        `json:"quantity"`
+	UnitCost    float64    `json:"unit_cost"`
+	Value       float64    `json:"value"`
+}
+
+// StockValuation values stock on hand at a point in time
+type StockValuation struct {
+	AsOf       time.Time        `json:"as_of"`
+	Method     string           `json:"method"`
+	LocationID *uuid.UUID       `json:"location_id,omitempty"`
+	Items      []*ItemValuation `json:"items"`
+	TotalUnits int              `json:"total_units"`
+	TotalValue float64          `json:"total_value"`
+}
+
+// MarginLine is revenue, cost of goods sold and gross margin for a product or category
+type MarginLine struct {
+	ProductID     *uuid.UUID `json:"product_id,omitempty"`
+	ProductName   string     `json:"product_name,omitempty"`
+	SKU           string     `json:"sku,omitempty"`
+	CategoryID    *uuid.UUID `json:"category_id,omitempty"`
+	Category      string     `json:"category"`
+	QuantitySold  int        `json:"quantity_sold"`
+	Revenue       float64    `json:"revenue"`
+	COGS          float64    `json:"cogs"`
+	GrossProfit   float64    `json:"gross_profit"`
+	MarginPercent float64    `json:"margin_percent"`
+}
+
+// COGSReport is cost of goods sold and gross margin over a period
+type COGSReport struct {
+	StartDate   time.Time     `json:"start_date"`
+	EndDate     time.Time     `json:"end_date"`
+	Method      string        `json:"method"`
+	LocationID  *uuid.UUID    `json:"location_id,omitempty"`
+	Products    []*MarginLine `json:"products"`
+	Categories  []*MarginLine `json:"categories"`
+	Revenue     float64       `json:"revenue"`
+	COGS        float64       `json:"cogs"`
+	GrossProfit float64       `json:"gross_profit"`
+	Margin      float64       `json:"margin_percent"`
+}
+
+// costLayer is a batch of units received at the same unit cost
+type costLayer struct {
+	quantity int
+	unitCost float64
+}
+
+// costLedger tracks the cost of one item's stock as inventory movements are replayed
+type costLedger struct {
+	method   string
+	quantity int
+	average  float64
+	layers   []costLayer
+}
+
+// receive adds units at unitCost
+func (l *costLedger) receive(quantity int, unitCost float64) {
+	if l.method == CostingMethodFIFO {
+		l.layers = append(l.layers, costLayer{quantity: quantity, unitCost: unitCost})
+	} else if l.quantity+quantity > 0 {
+		onHand := l.quantity
+		if onHand < 0 {
+			onHand = 0
+		}
+		l.average = (float64(onHand)*l.average + float64(quantity)*unitCost) / float64(onHand+quantity)
+	}
+	l.quantity += quantity
+}
+
+// issue removes units and returns their cost. Units issued beyond the recorded
+// layers, e.g. stock that predates inventory logging, are costed at fallbackCost.
+func (l *costLedger) issue(quantity int, fallbackCost float64) float64 {
+	l.quantity -= quantity
+	if l.method != CostingMethodFIFO {
+		if l.average == 0 {
+			return float64(quantity) * fallbackCost
+		}
+		return float64(quantity) * l.average
+	}
+
+	var cost float64
+	for quantity > 0 && len(l.layers) > 0 {
+		layer := &l.layers[0]
+		take := quantity
+		if layer.quantity < take {
+			take = layer.quantity
+		}
+		cost += float64(take) * layer.unitCost
+		layer.quantity -= take
+		quantity -= take
+		if layer.quantity == 0 {
+			l.layers = l.layers[1:]
+		}
+	}
+	return cost + float64(quantity)*fallbackCost
+}
+
+// value returns the cost of the units on hand
+func (l *costLedger) value() float64 {
+	if l.quantity <= 0 {
+		return 0
+	}
+	if l.method != CostingMethodFIFO {
+		return float64(l.quantity) * l.average
+	}
+	var value float64
+	for _, layer := range l.layers {
+		value += float64(layer.quantity) * layer.unitCost
+	}
+	return value
+}
+
+// InventoryValuationService values stock and costs sales by replaying inventory
+// logs with FIFO or weighted-average costing
+type InventoryValuationService struct {
+	inventoryRepo repositories.InventoryLogRepository
+	productRepo   repositories.ProductRepository
+	variationRepo repositories.ProductVariationRepository
+	categoryRepo  repositories.ProductCategoryRepository
+	orderItemRepo repositories.OrderItemRepository
+}
+
+func NewInventoryValuationService(
+	inventoryRepo repositories.InventoryLogRepository,
+	productRepo repositories.ProductRepository,
+	variationRepo repositories.ProductVariationRepository,
+	categoryRepo repositories.ProductCategoryRepository,
+	orderItemRepo repositories.OrderItemRepository,
+) *InventoryValuationService {
+	return &InventoryValuationService{
+		inventoryRepo: inventoryRepo,
+		productRepo:   productRepo,
+		variationRepo: variationRepo,
+		categoryRepo:  categoryRepo,
+		orderItemRepo: orderItemRepo,
+	}
+}
+
+// Valuation values stock on hand as of asOf, at one location or across all
+// locations when locationID is nil
+func (s *InventoryValuationService) Valuation(ctx context.Context, tenantID string, asOf time.Time, method string, locationID *uuid.UUID) (*StockValuation, error) {
+	method, err := normalizeCostingMethod(method)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := s.movements(ctx, tenantID, asOf, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := newValuationCatalog(s)
+	ledgers := make(map[uuid.UUID]*costLedger)
+	keys := make(map[uuid.UUID]*domain.InventoryLog)
+	for _, log := range logs {
+		key := stockKey(log.ProductID, log.VariationID)
+		ledger, ok := ledgers[key]
+		if !ok {
+			ledger = &costLedger{method: method}
+			ledgers[key] = ledger
+			keys[key] = log
+		}
+		s.apply(ctx, catalog, ledger, log)
+	}
+
+	valuation := &StockValuation{AsOf: asOf, Method: method, LocationID: locationID}
+	for key, ledger := range ledgers {
+		if ledger.quantity <= 0 {
+			continue
+		}
+		first := keys[key]
+		info := catalog.item(ctx, first.ProductID, first.VariationID)
+		value := roundCurrency(ledger.value())
+		valuation.Items = append(valuation.Items, &ItemValuation{
+			ProductID:   first.ProductID,
+			VariationID: first.VariationID,
+			ProductName: info.name,
+			SKU:         info.sku,
+			CategoryID:  info.categoryID,
+			Category:    info.category,
+			Quantity:    ledger.quantity,
+			UnitCost:    roundCurrency(ledger.value() / float64(ledger.quantity)),
+			Value:       value,
+		})
+		valuation.TotalUnits += ledger.quantity
+		valuation.TotalValue += value
+	}
+	valuation.TotalValue = roundCurrency(valuation.TotalValue)
+
+	sort.Slice(valuation.Items, func(i, j int) bool {
+		if valuation.Items[i].Value != valuation.Items[j].Value {
+			return valuation.Items[i].Value > valuation.Items[j].Value
+		}
+		return valuation.Items[i].SKU < valuation.Items[j].SKU
+	})
+
+	return valuation, nil
+}
+
+// CostOfGoodsSold returns revenue, cost of goods sold and gross margin per
+// product and category for sales between startDate and endDate. Refunded and
+// restocked units are taken off both revenue and cost.
+func (s *InventoryValuationService) CostOfGoodsSold(ctx context.Context, tenantID string, startDate, endDate time.Time, method string, locationID *uuid.UUID) (*COGSReport, error) {
+	method, err := normalizeCostingMethod(method)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replay from the beginning so FIFO layers and averages are right at startDate
+	logs, err := s.movements(ctx, tenantID, endDate, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := newValuationCatalog(s)
+	ledgers := make(map[uuid.UUID]*costLedger)
+	products := make(map[uuid.UUID]*MarginLine)
+	orders := make(map[uuid.UUID]bool)
+
+	line := func(productID uuid.UUID) *MarginLine {
+		if margin, ok := products[productID]; ok {
+			return margin
+		}
+		info := catalog.item(ctx, productID, nil)
+		id := productID
+		margin := &MarginLine{ProductID: &id, ProductName: info.name, SKU: info.sku, CategoryID: info.categoryID, Category: info.category}
+		products[productID] = margin
+		return margin
+	}
+
+	for _, log := range logs {
+		key := stockKey(log.ProductID, log.VariationID)
+		ledger, ok := ledgers[key]
+		if !ok {
+			ledger = &costLedger{method: method}
+			ledgers[key] = ledger
+		}
+
+		cost := s.apply(ctx, catalog, ledger, log)
+		if log.CreatedAt.Before(startDate) {
+			continue
+		}
+
+		switch {
+		case log.Type == domain.InventoryTypeSale:
+			margin := line(log.ProductID)
+			margin.QuantitySold += log.Quantity
+			margin.COGS += cost
+			if log.ReferenceID != nil {
+				orders[*log.ReferenceID] = true
+			}
+		case log.Type == domain.InventoryTypeReturn && log.ReferenceType == "order_cancellation":
+			// Restocked units come back at the cost they are returned to stock at
+			margin := line(log.ProductID)
+			margin.QuantitySold -= log.Quantity
+			margin.COGS -= float64(log.Quantity) * log.CostPerUnit
+		}
+	}
+
+	// Revenue is what was charged for the lines, net of discounts, tax and refunds
+	for orderID := range orders {
+		items, err := s.orderItemRepo.GetByOrderID(ctx, orderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get order items: %w", err)
+		}
+		for _, item := range items {
+			margin, ok := products[item.ProductID]
+			if !ok || item.Quantity == 0 {
+				continue
+			}
+			net := item.TotalPrice - metadataFloat(item.Metadata, itemMetadataDiscountTotal)
+			kept := item.Quantity - metadataInt(item.Metadata, "refunded_quantity")
+			margin.Revenue += net * float64(kept) / float64(item.Quantity)
+		}
+	}
+
+	report := &COGSReport{StartDate: startDate, EndDate: endDate, Method: method, LocationID: locationID}
+	categories := make(map[string]*MarginLine)
+	for _, margin := range products {
+		finishMargin(margin)
+		report.Products = append(report.Products, margin)
+		report.Revenue += margin.Revenue
+		report.COGS += margin.COGS
+
+		categoryKey := ""
+		if margin.CategoryID != nil {
+			categoryKey = margin.CategoryID.String()
+		}
+		category, ok := categories[categoryKey]
+		if !ok {
+			category = &MarginLine{CategoryID: margin.CategoryID, Category: margin.Category}
+			categories[categoryKey] = category
+		}
+		category.QuantitySold += margin.QuantitySold
+		category.Revenue += margin.Revenue
+		category.COGS += margin.COGS
+	}
+	for _, category := range categories {
+		finishMargin(category)
+		report.Categories = append(report.Categories, category)
+	}
+
+	report.Revenue = roundCurrency(report.Revenue)
+	report.COGS = roundCurrency(report.COGS)
+	report.GrossProfit = roundCurrency(report.Revenue - report.COGS)
+	if report.Revenue != 0 {
+		report.Margin = roundCurrency(report.GrossProfit / report.Revenue * 100)
+	}
+
+	sort.Slice(report.Products, func(i, j int) bool { return report.Products[i].GrossProfit > report.Products[j].GrossProfit })
+	sort.Slice(report.Categories, func(i, j int) bool { return report.Categories[i].GrossProfit > report.Categories[j].GrossProfit })
+
+	return report, nil
+}
+
+// movements returns the inventory logs up to until in the order they happened.
+// Company-wide, transfers between locations do not change what is owned, so
+// they are left out; at a single location they move stock in and out.
+func (s *InventoryValuationService) movements(ctx context.Context, tenantID string, until time.Time, locationID *uuid.UUID) ([]*domain.InventoryLog, error) {
+	logs, err := s.inventoryRepo.GetByDateRange(ctx, tenantID, time.Time{}, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory logs: %w", err)
+	}
+
+	filtered := make([]*domain.InventoryLog, 0, len(logs))
+	for _, log := range logs {
+		if locationID != nil {
+			if log.LocationID == nil || *log.LocationID != *locationID {
+				continue
+			}
+		} else if log.Type == domain.InventoryTypeTransferIn || log.Type == domain.InventoryTypeTransferOut {
+			continue
+		}
+		filtered = append(filtered, log)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].CreatedAt.Before(filtered[j].CreatedAt) })
+	return filtered, nil
+}
+
+// apply replays one movement on the ledger and returns the cost of any units it issued
+func (s *InventoryValuationService) apply(ctx context.Context, catalog *valuationCatalog, ledger *costLedger, log *domain.InventoryLog) float64 {
+	if log.Quantity == 0 {
+		return 0
+	}
+	if inventoryLogDirection(log) > 0 {
+		ledger.receive(log.Quantity, log.CostPerUnit)
+		return 0
+	}
+
+	fallback := log.CostPerUnit
+	if fallback == 0 {
+		fallback = catalog.item(ctx, log.ProductID, log.VariationID).cost
+	}
+	return ledger.issue(log.Quantity, fallback)
+}
+
+// inventoryLogDirection returns 1 for movements into stock and -1 for movements out
+func inventoryLogDirection(log *domain.InventoryLog) int {
+	if log.QuantityAfter > log.QuantityBefore {
+		return 1
+	}
+	if log.QuantityAfter < log.QuantityBefore {
+		return -1
+	}
+
+	switch log.Type {
+	case domain.InventoryTypeIn, domain.InventoryTypeReturn, domain.InventoryTypeTransferIn:
+		return 1
+	default:
+		return -1
+	}
+}
+
+func normalizeCostingMethod(method string) (string, error) {
+	switch method {
+	case "", CostingMethodWeightedAverage, "wac", "average":
+		return CostingMethodWeightedAverage, nil
+	case CostingMethodFIFO:
+		return CostingMethodFIFO, nil
+	default:
+		return "", fmt.Errorf("unsupported costing method: %s", method)
+	}
+}
+
+func finishMargin(margin *MarginLine) {
+	margin.Revenue = roundCurrency(margin.Revenue)
+	margin.COGS = roundCurrency(margin.COGS)
+	margin.GrossProfit = roundCurrency(margin.Revenue - margin.COGS)
+	if margin.Revenue != 0 {
+		margin.MarginPercent = roundCurrency(margin.GrossProfit / margin.Revenue * 100)
+	}
+}
+
+// valuationItem is the catalog data shown against a valued item
+type valuationItem struct {
+	name       string
+	sku        string
+	cost       float64
+	categoryID *uuid.UUID
+	category   string
+}
+
+// valuationCatalog caches product, variation and category lookups for one report
+type valuationCatalog struct {
+	service    *InventoryValuationService
+	items      map[uuid.UUID]valuationItem
+	categories map[uuid.UUID]string
+}
+
+func newValuationCatalog(service *InventoryValuationService) *valuationCatalog {
+	return &valuationCatalog{
+		service:    service,
+		items:      make(map[uuid.UUID]valuationItem),
+		categories: make(map[uuid.UUID]string),
+	}
+}
+
+func (c *valuationCatalog) item(ctx context.Context, productID uuid.UUID, variationID *uuid.UUID) valuationItem {
+	key := stockKey(productID, variationID)
+	if item, ok := c.items[key]; ok {
+		return item
+	}
+
+	item := valuationItem{name: productID.String(), category: "Uncategorized"}
+	if product, err := c.service.productRepo.GetByID(ctx, productID); err == nil && product != nil {
+		item.name = product.Name
+		item.sku = product.SKU
+		item.cost = product.CostPrice
+		item.categoryID = product.CategoryID
+		if product.CategoryID != nil {
+			item.category = c.category(ctx, *product.CategoryID)
+		}
+	}
+	if variationID != nil && c.service.variationRepo != nil {
+		if variation, err := c.service.variationRepo.GetByID(ctx, *variationID); err == nil && variation != nil {
+			item.sku = variation.SKU
+			if variation.CostPrice > 0 {
+				item.cost = variation.CostPrice
+			}
+			if attributes := formatVariationAttributes(variation.Attributes); attributes != "" {
+				item.name = fmt.Sprintf("%s (%s)", item.name, attributes)
+			}
+		}
+	}
+
+	c.items[key] = item
+	return item
+}
+
+func (c *valuationCatalog) category(ctx context.Context, categoryID uuid.UUID) string {
+	if name, ok := c.categories[categoryID]; ok {
+		return name
+	}
+	name := "Uncategorized"
+	if c.service.categoryRepo != nil {
+		if category, err := c.service.categoryRepo.GetByID(ctx, categoryID); err == nil && category != nil {
+			name = category.Name
+		}
+	}
+	c.categories[categoryID] = name
+	return name
+}
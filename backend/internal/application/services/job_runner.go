@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
+)
+
+// tenantPageSize is how many tenants a per-tenant job loads at a time
+const tenantPageSize = 100
+
+// JobRunner runs background jobs on fixed intervals, such as voiding expired
+// authorization holds. A job that fails or panics is logged and runs again on
+// its next tick. Jobs run as the platform (see database.AsPlatform), so they
+// reach every tenant's rows unless they scope a context to one tenant.
+type JobRunner struct {
+	logger *zap.Logger
+	jobs   []scheduledJob
+}
+
+type scheduledJob struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+// NewJobRunner creates a new job runner
+func NewJobRunner(logger *zap.Logger) *JobRunner {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &JobRunner{logger: logger}
+}
+
+// Every registers fn to run every interval. A job with no interval is disabled.
+func (r *JobRunner) Every(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	if interval <= 0 {
+		r.logger.Info("background job disabled", zap.String("job", name))
+		return
+	}
+	r.jobs = append(r.jobs, scheduledJob{name: name, interval: interval, run: fn})
+}
+
+// Run runs the registered jobs until ctx is done
+func (r *JobRunner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, job := range r.jobs {
+		wg.Add(1)
+		go func(job scheduledJob) {
+			defer wg.Done()
+			r.loop(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+}
+
+func (r *JobRunner) loop(ctx context.Context, job scheduledJob) {
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.runOnce(ctx, job)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *JobRunner) runOnce(ctx context.Context, job scheduledJob) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			r.logger.Error("background job panicked", zap.String("job", job.name), zap.Any("panic", recovered))
+		}
+	}()
+
+	if err := job.run(database.AsPlatform(ctx)); err != nil {
+		r.logger.Error("background job failed", zap.String("job", job.name), zap.Error(err))
+	}
+}
+
+// forEachTenant runs fn for every tenant, carrying on past tenants that fail. It
+// returns the first failure.
+func forEachTenant(ctx context.Context, tenants domain.TenantRepository, fn func(ctx context.Context, tenantID string) error) error {
+	var firstErr error
+	for offset := 0; ; offset += tenantPageSize {
+		page, err := tenants.List(ctx, tenantPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to list tenants: %w", err)
+		}
+		for _, tenant := range page {
+			if err := fn(ctx, tenant.ID.String()); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("tenant %s: %w", tenant.ID, err)
+			}
+		}
+		if len(page) < tenantPageSize {
+			return firstErr
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+var (
+	ErrCustomerNotFound   = errors.New("customer not found")
+	ErrLoyaltyDisabled    = errors.New("loyalty programme is not enabled")
+	ErrInsufficientPoints = errors.New("insufficient loyalty points")
+)
+
+// Cart and order metadata keys used for loyalty redemptions
+const (
+	cartMetadataLoyaltyPoints     = "loyalty_points"     // Points the customer asked to redeem
+	cartMetadataLoyaltyRedemption = "loyalty_redemption" // Redemption as applied to the cart
+	orderMetadataLoyalty          = "loyalty_redemption"
+)
+
+// LoyaltyRedemption is a number of points redeemed as a cart discount, with
+// the discount's share per cart line
+type LoyaltyRedemption struct {
+	CustomerID  uuid.UUID             `json:"customer_id"`
+	Points      int                   `json:"points"`
+	Amount      float64               `json:"amount"`
+	Allocations map[uuid.UUID]float64 `json:"allocations,omitempty"` // Cart item ID -> discount amount
+}
+
+// LoyaltyService keeps the loyalty ledger: it earns points on paid orders,
+// redeems them as cart discounts and reverses both on refund
+type LoyaltyService struct {
+	txManager     repositories.TransactionManager
+	customerRepo  repositories.CustomerRepository
+	ledgerRepo    repositories.LoyaltyLedgerRepository
+	orderItemRepo repositories.OrderItemRepository
+	tenantRepo    domain.TenantRepository
+}
+
+// NewLoyaltyService creates a new loyalty service
+func NewLoyaltyService(
+	txManager repositories.TransactionManager,
+	customerRepo repositories.CustomerRepository,
+	ledgerRepo repositories.LoyaltyLedgerRepository,
+	orderItemRepo repositories.OrderItemRepository,
+	tenantRepo domain.TenantRepository,
+) *LoyaltyService {
+	return &LoyaltyService{
+		txManager:     txManager,
+		customerRepo:  customerRepo,
+		ledgerRepo:    ledgerRepo,
+		orderItemRepo: orderItemRepo,
+		tenantRepo:    tenantRepo,
+	}
+}
+
+// Settings returns the tenant's earn and burn rules; the programme is off
+// until a tenant configures it
+func (s *LoyaltyService) Settings(ctx context.Context, tenantID string) domain.LoyaltySettings {
+	config := loadTenantConfiguration(ctx, s.tenantRepo, tenantID)
+	if config == nil || config.Loyalty == nil {
+		return domain.LoyaltySettings{}
+	}
+	return *config.Loyalty
+}
+
+// GetCustomer returns one of the tenant's customers
+func (s *LoyaltyService) GetCustomer(ctx context.Context, tenantID string, customerID uuid.UUID) (*domain.Customer, error) {
+	customer, err := s.customerRepo.GetByID(ctx, customerID)
+	if err != nil || customer == nil || customer.TenantID != tenantID || customer.DeletedAt != nil {
+		return nil, ErrCustomerNotFound
+	}
+	return customer, nil
+}
+
+// CheckRedemption validates a request to redeem points before it is stored on a cart
+func (s *LoyaltyService) CheckRedemption(ctx context.Context, tenantID string, customerID uuid.UUID, points int) error {
+	settings := s.Settings(ctx, tenantID)
+	if !settings.Enabled || settings.PointValue <= 0 {
+		return ErrLoyaltyDisabled
+	}
+	if points <= 0 {
+		return errors.New("points to redeem must be positive")
+	}
+	if points < settings.MinimumRedeemPoints {
+		return fmt.Errorf("at least %d points must be redeemed", settings.MinimumRedeemPoints)
+	}
+
+	customer, err := s.GetCustomer(ctx, tenantID, customerID)
+	if err != nil {
+		return err
+	}
+	if customer.LoyaltyPoints < points {
+		return fmt.Errorf("%w: %d available", ErrInsufficientPoints, customer.LoyaltyPoints)
+	}
+	return nil
+}
+
+// PlanRedemption works out the discount for the points requested on the cart,
+// given what earlier discounts left of each line. Points beyond the customer's
+// balance or the tenant's redemption cap are not used; nil means nothing is
+// redeemed.
+func (s *LoyaltyService) PlanRedemption(ctx context.Context, cart *domain.Cart, items []*domain.CartItem, itemDiscounts map[uuid.UUID]float64) (*LoyaltyRedemption, error) {
+	points := metadataInt(cart.Metadata, cartMetadataLoyaltyPoints)
+	if points <= 0 || cart.CustomerID == nil {
+		return nil, nil
+	}
+
+	settings := s.Settings(ctx, cart.TenantID)
+	if !settings.Enabled || settings.PointValue <= 0 {
+		return nil, nil
+	}
+
+	customer, err := s.GetCustomer(ctx, cart.TenantID, *cart.CustomerID)
+	if err != nil {
+		return nil, nil
+	}
+	if points > customer.LoyaltyPoints {
+		points = customer.LoyaltyPoints
+	}
+
+	var eligible []*domain.CartItem
+	remaining := make(map[uuid.UUID]float64, len(items))
+	var available float64
+	for _, item := range items {
+		left := roundCurrency(item.TotalPrice - itemDiscounts[item.ID])
+		if left <= 0 {
+			continue
+		}
+		eligible = append(eligible, item)
+		remaining[item.ID] = left
+		available += left
+	}
+
+	limit := available
+	if settings.MaxRedeemPercent > 0 && settings.MaxRedeemPercent < 100 {
+		limit = available * settings.MaxRedeemPercent / 100
+	}
+	if maxPoints := int(math.Floor(limit/settings.PointValue + 1e-9)); points > maxPoints {
+		points = maxPoints
+	}
+	if points <= 0 || points < settings.MinimumRedeemPoints {
+		return nil, nil
+	}
+
+	redemption := &LoyaltyRedemption{
+		CustomerID:  customer.ID,
+		Points:      points,
+		Amount:      roundCurrency(float64(points) * settings.PointValue),
+		Allocations: make(map[uuid.UUID]float64, len(eligible)),
+	}
+
+	// The last line absorbs rounding so allocations add up to the discount exactly
+	allocated := 0.0
+	for i, item := range eligible {
+		share := roundCurrency(redemption.Amount * remaining[item.ID] / available)
+		if i == len(eligible)-1 {
+			share = roundCurrency(redemption.Amount - allocated)
+		}
+		if share > remaining[item.ID] {
+			share = remaining[item.ID]
+		}
+		redemption.Allocations[item.ID] = share
+		allocated = roundCurrency(allocated + share)
+	}
+	redemption.Amount = allocated
+
+	return redemption, nil
+}
+
+// RedeemForOrder debits the points redeemed on the order's cart. It re-checks
+// the balance under a row lock, so it must run inside the order creation
+// transaction.
+func (s *LoyaltyService) RedeemForOrder(ctx context.Context, order *domain.Order, redemption *LoyaltyRedemption) error {
+	customer, err := s.lockCustomer(ctx, order.TenantID, redemption.CustomerID)
+	if err != nil {
+		return err
+	}
+	if customer.LoyaltyPoints < redemption.Points {
+		return fmt.Errorf("%w: %d available", ErrInsufficientPoints, customer.LoyaltyPoints)
+	}
+
+	return s.post(ctx, customer, &domain.LoyaltyLedgerEntry{
+		OrderID: &order.ID,
+		Type:    domain.LoyaltyEntryRedeem,
+		Points:  -redemption.Points,
+		Amount:  redemption.Amount,
+		Reason:  fmt.Sprintf("Redeemed on order %s", order.OrderNumber),
+	})
+}
+
+// RecordPaidOrder adds a paid order to its customer's purchase history and
+// earns points on it. Orders without a customer are ignored.
+func (s *LoyaltyService) RecordPaidOrder(ctx context.Context, order *domain.Order) error {
+	if order.CustomerID == nil {
+		return nil
+	}
+
+	settings := s.Settings(ctx, order.TenantID)
+	var spend float64
+	points := 0
+	if settings.Enabled && settings.PointsPerUnit > 0 {
+		items, err := s.orderItemRepo.GetByOrderID(ctx, order.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get order items: %w", err)
+		}
+		for _, item := range items {
+			spend += item.TotalPrice - metadataFloat(item.Metadata, itemMetadataDiscountTotal)
+		}
+		spend = roundCurrency(spend)
+		if spend >= settings.MinimumSpend {
+			points = int(math.Floor(spend*settings.PointsPerUnit + 1e-9))
+		}
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		customer, err := s.lockCustomer(ctx, order.TenantID, *order.CustomerID)
+		if err != nil {
+			return err
+		}
+
+		paidAt := time.Now()
+		if order.DatePaid != nil {
+			paidAt = *order.DatePaid
+		}
+		customer.OrdersCount++
+		customer.TotalSpent = roundCurrency(customer.TotalSpent + order.Total)
+		customer.LastOrderAt = &paidAt
+
+		if points <= 0 {
+			if err := s.customerRepo.Update(ctx, customer); err != nil {
+				return fmt.Errorf("failed to update customer: %w", err)
+			}
+			return nil
+		}
+
+		return s.post(ctx, customer, &domain.LoyaltyLedgerEntry{
+			OrderID: &order.ID,
+			Type:    domain.LoyaltyEntryEarn,
+			Points:  points,
+			Amount:  spend,
+			Reason:  fmt.Sprintf("Earned on order %s", order.OrderNumber),
+		})
+	})
+}
+
+// RemoveFromHistory takes spend back out of the customer's total for a refunded
+// or cancelled order, and with removeOrder stops counting the order at all
+func (s *LoyaltyService) RemoveFromHistory(ctx context.Context, order *domain.Order, spend float64, removeOrder bool) error {
+	if order.CustomerID == nil {
+		return nil
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		customer, err := s.lockCustomer(ctx, order.TenantID, *order.CustomerID)
+		if err != nil {
+			return err
+		}
+
+		customer.TotalSpent = math.Max(0, roundCurrency(customer.TotalSpent-spend))
+		if removeOrder && customer.OrdersCount > 0 {
+			customer.OrdersCount--
+		}
+
+		if err := s.customerRepo.Update(ctx, customer); err != nil {
+			return fmt.Errorf("failed to update customer: %w", err)
+		}
+		return nil
+	})
+}
+
+// ReverseForRefund takes back the points earned on an order and returns the
+// points redeemed on it, in proportion to how much of the payment has been
+// refunded so far. A full refund reverses everything.
+func (s *LoyaltyService) ReverseForRefund(ctx context.Context, order *domain.Order, refunded, paid float64) error {
+	if paid <= 0 {
+		return nil
+	}
+	return s.reverse(ctx, order, math.Min(refunded/paid, 1), fmt.Sprintf("Refund of order %s", order.OrderNumber))
+}
+
+// ReverseForCancellation returns the points redeemed on a cancelled order and
+// takes back any points it earned
+func (s *LoyaltyService) ReverseForCancellation(ctx context.Context, order *domain.Order) error {
+	return s.reverse(ctx, order, 1, fmt.Sprintf("Cancellation of order %s", order.OrderNumber))
+}
+
+func (s *LoyaltyService) reverse(ctx context.Context, order *domain.Order, fraction float64, reason string) error {
+	if order.CustomerID == nil {
+		return nil
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		customer, err := s.lockCustomer(ctx, order.TenantID, *order.CustomerID)
+		if err != nil {
+			return err
+		}
+
+		entries, err := s.ledgerRepo.GetByOrderID(ctx, order.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get loyalty entries: %w", err)
+		}
+		totals := make(map[string]int)
+		for _, entry := range entries {
+			totals[entry.Type] += entry.Points
+		}
+
+		earned := totals[domain.LoyaltyEntryEarn]
+		if reverse := int(math.Round(float64(earned)*fraction)) + totals[domain.LoyaltyEntryEarnReversal]; reverse > 0 {
+			err := s.post(ctx, customer, &domain.LoyaltyLedgerEntry{
+				OrderID: &order.ID,
+				Type:    domain.LoyaltyEntryEarnReversal,
+				Points:  -reverse,
+				Reason:  reason,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		redeemed := -totals[domain.LoyaltyEntryRedeem]
+		if restore := int(math.Round(float64(redeemed)*fraction)) - totals[domain.LoyaltyEntryRedeemReversal]; restore > 0 {
+			err := s.post(ctx, customer, &domain.LoyaltyLedgerEntry{
+				OrderID: &order.ID,
+				Type:    domain.LoyaltyEntryRedeemReversal,
+				Points:  restore,
+				Reason:  reason,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// AdjustPoints credits or debits points by hand, e.g. for a goodwill gesture
+func (s *LoyaltyService) AdjustPoints(ctx context.Context, tenantID string, customerID uuid.UUID, points int, reason string, userID *uuid.UUID) (*domain.LoyaltyLedgerEntry, error) {
+	if points == 0 {
+		return nil, errors.New("adjustment must not be zero")
+	}
+	if reason == "" {
+		return nil, errors.New("a reason is required for loyalty adjustments")
+	}
+
+	entry := &domain.LoyaltyLedgerEntry{
+		Type:   domain.LoyaltyEntryAdjustment,
+		Points: points,
+		Reason: reason,
+		UserID: userID,
+	}
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		customer, err := s.lockCustomer(ctx, tenantID, customerID)
+		if err != nil {
+			return err
+		}
+		if customer.LoyaltyPoints+points < 0 {
+			return fmt.Errorf("%w: %d available", ErrInsufficientPoints, customer.LoyaltyPoints)
+		}
+		return s.post(ctx, customer, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// GetLedger returns a customer's loyalty entries, newest first
+func (s *LoyaltyService) GetLedger(ctx context.Context, tenantID string, customerID uuid.UUID, limit, offset int) ([]*domain.LoyaltyLedgerEntry, int64, error) {
+	if _, err := s.GetCustomer(ctx, tenantID, customerID); err != nil {
+		return nil, 0, err
+	}
+	return s.ledgerRepo.GetByCustomerID(ctx, customerID, limit, offset)
+}
+
+func (s *LoyaltyService) lockCustomer(ctx context.Context, tenantID string, customerID uuid.UUID) (*domain.Customer, error) {
+	customer, err := s.customerRepo.GetByIDForUpdate(ctx, customerID)
+	if err != nil || customer == nil || customer.TenantID != tenantID {
+		return nil, ErrCustomerNotFound
+	}
+	return customer, nil
+}
+
+// post writes a ledger entry and applies it to the locked customer's balance
+func (s *LoyaltyService) post(ctx context.Context, customer *domain.Customer, entry *domain.LoyaltyLedgerEntry) error {
+	customer.LoyaltyPoints += entry.Points
+	switch entry.Type {
+	case domain.LoyaltyEntryEarn, domain.LoyaltyEntryEarnReversal:
+		customer.LifetimePoints += entry.Points
+	}
+	if err := s.customerRepo.Update(ctx, customer); err != nil {
+		return fmt.Errorf("failed to update customer: %w", err)
+	}
+
+	entry.ID = uuid.New()
+	entry.TenantID = customer.TenantID
+	entry.CustomerID = customer.ID
+	entry.Balance = customer.LoyaltyPoints
+	entry.CreatedAt = time.Now()
+	if err := s.ledgerRepo.Create(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record loyalty entry: %w", err)
+	}
+	return nil
+}
+
+// CartLoyaltyRedemption returns the points redemption applied to a cart, if any
+func CartLoyaltyRedemption(cart *domain.Cart) *LoyaltyRedemption {
+	raw, ok := cart.Metadata[cartMetadataLoyaltyRedemption]
+	if !ok || raw == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var redemption LoyaltyRedemption
+	if err := json.Unmarshal(data, &redemption); err != nil || redemption.Points <= 0 {
+		return nil
+	}
+	return &redemption
+}
@@ -0,0 +1,580 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Mail retry defaults
+const (
+	DefaultMailMaxAttempts  = 5
+	DefaultMailRetryBackoff = time.Minute
+)
+
+// mailSendLease is how long a delivery being sent is kept from other workers. A
+// worker that dies mid-send leaves the delivery to be picked up once it ends.
+const mailSendLease = 5 * time.Minute
+
+// mailRetryBatchSize is how many deliveries one run of the retry queue claims
+const mailRetryBatchSize = 100
+
+// ErrMailTemplateNotFound is returned when neither the tenant nor the built-in set has a template
+var ErrMailTemplateNotFound = errors.New("mail template not found")
+
+// MailTransport delivers a fully rendered message
+type MailTransport interface {
+	Send(ctx context.Context, msg *MailMessage) error
+}
+
+// MailMessage is a rendered email ready for a transport
+type MailMessage struct {
+	FromAddress string
+	FromName    string
+	To          []string
+	Subject     string
+	HTMLBody    string
+	TextBody    string
+	Attachments []domain.MailAttachment
+}
+
+// Recipients parses the message's recipients, rejecting anything that is not a
+// single address, such as a recipient carrying extra header lines
+func (m *MailMessage) Recipients() ([]*mail.Address, error) {
+	return parseMailRecipients(m.To)
+}
+
+// MIME encodes the message as an RFC 5322 message with text, HTML and attachment parts
+func (m *MailMessage) MIME() ([]byte, error) {
+	var buf bytes.Buffer
+
+	recipients, err := m.Recipients()
+	if err != nil {
+		return nil, err
+	}
+	to := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		to[i] = recipient.String()
+	}
+
+	from := mail.Address{Name: m.FromName, Address: m.FromAddress}
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", uuid.New().String(), messageIDDomain(m.FromAddress))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	mixed := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mixed.Boundary())
+
+	var body bytes.Buffer
+	alternative := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.TextBody},
+		{"text/html; charset=utf-8", m.HTMLBody},
+	} {
+		if part.content == "" {
+			continue
+		}
+		writer, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create message part: %w", err)
+		}
+		qp := quotedprintable.NewWriter(writer)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("failed to encode message part: %w", err)
+		}
+		qp.Close()
+	}
+	alternative.Close()
+
+	bodyPart, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("multipart/alternative; boundary=%q", alternative.Boundary())},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message body: %w", err)
+	}
+	bodyPart.Write(body.Bytes())
+
+	for _, attachment := range m.Attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		writer, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create attachment part: %w", err)
+		}
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			fmt.Fprintf(writer, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(writer, "%s\r\n", encoded)
+	}
+	mixed.Close()
+
+	return buf.Bytes(), nil
+}
+
+// MemoryMailTransport keeps sent messages in memory for tests and local development
+type MemoryMailTransport struct {
+	mu       sync.Mutex
+	messages []MailMessage
+	// FailWith, when set, is returned by Send instead of delivering
+	FailWith error
+}
+
+func NewMemoryMailTransport() *MemoryMailTransport {
+	return &MemoryMailTransport{}
+}
+
+func (t *MemoryMailTransport) Send(ctx context.Context, msg *MailMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.FailWith != nil {
+		return t.FailWith
+	}
+	t.messages = append(t.messages, *msg)
+	return nil
+}
+
+// Messages returns a copy of every message sent so far
+func (t *MemoryMailTransport) Messages() []MailMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]MailMessage(nil), t.messages...)
+}
+
+// MailSettings holds the platform-wide sender and retry policy
+type MailSettings struct {
+	FromAddress   string
+	FromName      string
+	DefaultLocale string
+	MaxAttempts   int
+	RetryBackoff  time.Duration
+}
+
+// MailRequest asks for a templated email to be sent
+type MailRequest struct {
+	TenantID      string
+	Template      string
+	Locale        string
+	To            []string
+	Data          map[string]interface{}
+	Attachments   []domain.MailAttachment
+	ReferenceType string
+	ReferenceID   *uuid.UUID
+}
+
+// MailDeliveryHook is called once a delivery with a matching reference type has been sent
+type MailDeliveryHook func(ctx context.Context, delivery *domain.MailDelivery) error
+
+// MailService renders tenant email templates, logs every delivery and retries failed sends
+type MailService struct {
+	transport    MailTransport
+	templateRepo domain.MailTemplateRepository
+	deliveryRepo domain.MailDeliveryRepository
+	tenantRepo   domain.TenantRepository
+	settings     MailSettings
+	logger       *zap.Logger
+
+	mu    sync.RWMutex
+	hooks map[string]MailDeliveryHook
+}
+
+func NewMailService(
+	transport MailTransport,
+	templateRepo domain.MailTemplateRepository,
+	deliveryRepo domain.MailDeliveryRepository,
+	tenantRepo domain.TenantRepository,
+	settings MailSettings,
+) *MailService {
+	if settings.MaxAttempts <= 0 {
+		settings.MaxAttempts = DefaultMailMaxAttempts
+	}
+	if settings.RetryBackoff <= 0 {
+		settings.RetryBackoff = DefaultMailRetryBackoff
+	}
+	if settings.DefaultLocale == "" {
+		settings.DefaultLocale = "en"
+	}
+
+	return &MailService{
+		transport:    transport,
+		templateRepo: templateRepo,
+		deliveryRepo: deliveryRepo,
+		tenantRepo:   tenantRepo,
+		settings:     settings,
+		logger:       zap.NewNop(),
+		hooks:        make(map[string]MailDeliveryHook),
+	}
+}
+
+// SetLogger sets the logger for failures after a mail has been sent
+func (s *MailService) SetLogger(logger *zap.Logger) {
+	if logger != nil {
+		s.logger = logger
+	}
+}
+
+// OnDelivered registers a hook for deliveries with the given reference type
+func (s *MailService) OnDelivered(referenceType string, hook MailDeliveryHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks[referenceType] = hook
+}
+
+// Send renders the template, records the delivery and makes the first attempt.
+// A failed attempt is not an error: the delivery stays queued for ProcessRetryQueue.
+func (s *MailService) Send(ctx context.Context, req *MailRequest) (*domain.MailDelivery, error) {
+	// Lease the delivery to this call so the retry queue does not send it as well
+	delivery, err := s.record(ctx, req, time.Now().Add(mailSendLease))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.attempt(ctx, delivery); err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// Enqueue renders the template and records the delivery for ProcessRetryQueue to
+// send, for callers that must not wait on the mail server
+func (s *MailService) Enqueue(ctx context.Context, req *MailRequest) (*domain.MailDelivery, error) {
+	return s.record(ctx, req, time.Now())
+}
+
+// record renders the template and logs a queued delivery, first due at nextAttempt
+func (s *MailService) record(ctx context.Context, req *MailRequest, nextAttempt time.Time) (*domain.MailDelivery, error) {
+	if len(req.To) == 0 {
+		return nil, errors.New("mail has no recipients")
+	}
+	if _, err := parseMailRecipients(req.To); err != nil {
+		return nil, err
+	}
+
+	tenant := loadTenant(ctx, s.tenantRepo, req.TenantID)
+
+	data := make(map[string]interface{}, len(req.Data)+2)
+	for key, value := range req.Data {
+		data[key] = value
+	}
+	data["Tenant"] = tenant
+	data["Branding"] = domain.TenantBranding{}
+	if tenant != nil && tenant.Branding != nil {
+		data["Branding"] = *tenant.Branding
+	}
+
+	subject, htmlBody, textBody, err := s.render(ctx, req.TenantID, req.Template, req.Locale, data)
+	if err != nil {
+		return nil, err
+	}
+
+	fromAddress, fromName := s.settings.FromAddress, s.settings.FromName
+	if tenant != nil && tenant.Branding != nil {
+		if tenant.Branding.EmailFromAddress != "" {
+			fromAddress = tenant.Branding.EmailFromAddress
+		}
+		if tenant.Branding.EmailFromName != "" {
+			fromName = tenant.Branding.EmailFromName
+		}
+	}
+
+	delivery := &domain.MailDelivery{
+		TenantID:      req.TenantID,
+		Template:      req.Template,
+		FromAddress:   fromAddress,
+		FromName:      fromName,
+		Recipients:    req.To,
+		Subject:       subject,
+		HTMLBody:      htmlBody,
+		TextBody:      textBody,
+		Attachments:   req.Attachments,
+		Status:        domain.MailStatusQueued,
+		NextAttemptAt: &nextAttempt,
+		ReferenceType: req.ReferenceType,
+		ReferenceID:   req.ReferenceID,
+	}
+
+	if err := s.deliveryRepo.Create(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("failed to log mail delivery: %w", err)
+	}
+
+	return delivery, nil
+}
+
+// ProcessRetryQueue sends queued deliveries and retries failed ones that are due.
+// Each delivery is claimed before it is sent, so workers running side by side
+// never send the same message. It returns the number of messages sent.
+func (s *MailService) ProcessRetryQueue(ctx context.Context, limit int) (int, error) {
+	now := time.Now()
+	deliveries, err := s.deliveryRepo.ClaimDue(ctx, now, now.Add(mailSendLease), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get queued mail: %w", err)
+	}
+
+	sent := 0
+	for _, delivery := range deliveries {
+		if delivery.Status != domain.MailStatusQueued && delivery.Status != domain.MailStatusRetrying {
+			continue
+		}
+		if err := s.attempt(ctx, delivery); err != nil {
+			return sent, err
+		}
+		if delivery.Status == domain.MailStatusSent {
+			sent++
+		}
+	}
+
+	return sent, nil
+}
+
+// ScheduleRetryQueue runs ProcessRetryQueue on the job runner every interval
+func (s *MailService) ScheduleRetryQueue(runner *JobRunner, interval time.Duration) {
+	runner.Every("mail_retry_queue", interval, func(ctx context.Context) error {
+		_, err := s.ProcessRetryQueue(ctx, mailRetryBatchSize)
+		return err
+	})
+}
+
+// SendInvitation emails a tenant invitation with a link to accept it
+func (s *MailService) SendInvitation(ctx context.Context, invitation *domain.TenantInvitation, acceptURL string) (*domain.MailDelivery, error) {
+	return s.Send(ctx, &MailRequest{
+		TenantID: invitation.TenantID.String(),
+		Template: domain.MailTemplateInvitation,
+		To:       []string{invitation.Email},
+		Data: map[string]interface{}{
+			"Invitation": invitation,
+			"AcceptURL":  acceptURL,
+		},
+		ReferenceType: domain.MailTemplateInvitation,
+		ReferenceID:   &invitation.ID,
+	})
+}
+
+// SendPasswordReset emails a password reset link
+func (s *MailService) SendPasswordReset(ctx context.Context, tenantID string, user *domain.User, resetURL string, expiresAt time.Time) (*domain.MailDelivery, error) {
+	return s.Send(ctx, &MailRequest{
+		TenantID: tenantID,
+		Template: domain.MailTemplatePasswordReset,
+		To:       []string{user.Email},
+		Data: map[string]interface{}{
+			"User":      user,
+			"ResetURL":  resetURL,
+			"ExpiresAt": expiresAt,
+		},
+		ReferenceType: domain.MailTemplatePasswordReset,
+		ReferenceID:   &user.ID,
+	})
+}
+
+// attempt sends a delivery once and records the outcome, scheduling a retry
+// with exponential backoff until the attempt limit is reached
+func (s *MailService) attempt(ctx context.Context, delivery *domain.MailDelivery) error {
+	msg := &MailMessage{
+		FromAddress: delivery.FromAddress,
+		FromName:    delivery.FromName,
+		To:          delivery.Recipients,
+		Subject:     delivery.Subject,
+		HTMLBody:    delivery.HTMLBody,
+		TextBody:    delivery.TextBody,
+		Attachments: delivery.Attachments,
+	}
+
+	delivery.Attempts++
+	sendErr := s.transport.Send(ctx, msg)
+	now := time.Now()
+
+	if sendErr == nil {
+		delivery.Status = domain.MailStatusSent
+		delivery.SentAt = &now
+		delivery.NextAttemptAt = nil
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = sendErr.Error()
+		if delivery.Attempts >= s.settings.MaxAttempts {
+			delivery.Status = domain.MailStatusFailed
+			delivery.NextAttemptAt = nil
+		} else {
+			delivery.Status = domain.MailStatusRetrying
+			next := now.Add(s.settings.RetryBackoff * time.Duration(1<<uint(delivery.Attempts-1)))
+			delivery.NextAttemptAt = &next
+		}
+	}
+
+	if err := s.deliveryRepo.Update(ctx, delivery); err != nil {
+		return fmt.Errorf("failed to update mail delivery: %w", err)
+	}
+
+	if delivery.Status == domain.MailStatusSent {
+		s.mu.RLock()
+		hook := s.hooks[delivery.ReferenceType]
+		s.mu.RUnlock()
+		if hook != nil {
+			if err := hook(ctx, delivery); err != nil {
+				// The mail is out; a failed hook must not cause it to be resent
+				s.logger.Error("mail delivery hook failed", zap.String("tenant_id", delivery.TenantID), zap.String("delivery_id", delivery.ID.String()), zap.String("reference_type", delivery.ReferenceType), zap.Error(err))
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseMailRecipients(recipients []string) ([]*mail.Address, error) {
+	addresses := make([]*mail.Address, 0, len(recipients))
+	for _, recipient := range recipients {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mail recipient %q: %w", recipient, err)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// render executes the tenant's template for name, falling back to the tenant's
+// default locale and then to the built-in template
+func (s *MailService) render(ctx context.Context, tenantID, name, locale string, data map[string]interface{}) (string, string, string, error) {
+	if locale == "" {
+		locale = s.settings.DefaultLocale
+	}
+
+	var tmpl *domain.MailTemplate
+	if s.templateRepo != nil {
+		for _, candidate := range []string{locale, s.settings.DefaultLocale} {
+			found, err := s.templateRepo.GetByName(ctx, tenantID, name, candidate)
+			if err == nil && found != nil && found.IsActive {
+				tmpl = found
+				break
+			}
+		}
+	}
+	if tmpl == nil {
+		builtin, ok := defaultMailTemplates[name]
+		if !ok {
+			return "", "", "", fmt.Errorf("%w: %s", ErrMailTemplateNotFound, name)
+		}
+		tmpl = &builtin
+	}
+
+	subject, err := executeTextTemplate(name+".subject", tmpl.Subject, data)
+	if err != nil {
+		return "", "", "", err
+	}
+	textBody, err := executeTextTemplate(name+".text", tmpl.TextBody, data)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	var htmlBody string
+	if tmpl.HTMLBody != "" {
+		parsed, err := htmltemplate.New(name + ".html").Parse(tmpl.HTMLBody)
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to parse mail template %s: %w", name, err)
+		}
+		var buf bytes.Buffer
+		if err := parsed.Execute(&buf, data); err != nil {
+			return "", "", "", fmt.Errorf("failed to render mail template %s: %w", name, err)
+		}
+		htmlBody = buf.String()
+	}
+
+	return strings.TrimSpace(subject), htmlBody, textBody, nil
+}
+
+func executeTextTemplate(name, text string, data map[string]interface{}) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	parsed, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse mail template %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := parsed.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render mail template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+func messageIDDomain(address string) string {
+	if at := strings.LastIndex(address, "@"); at >= 0 && at < len(address)-1 {
+		return address[at+1:]
+	}
+	return "localhost"
+}
+
+// defaultMailTemplates are used when a tenant has not customised a template
+var defaultMailTemplates = map[string]domain.MailTemplate{
+	domain.MailTemplateReceipt: {
+		Name:    domain.MailTemplateReceipt,
+		Subject: `Your receipt {{.Receipt.ReceiptNumber}}{{if .Tenant}} from {{.Tenant.Name}}{{end}}`,
+		TextBody: `Thank you for your purchase.
+
+Order: {{.Order.OrderNumber}}
+Receipt: {{.Receipt.ReceiptNumber}}
+Total: {{printf "%.2f" .Order.Total}} {{.Order.Currency}}
+
+Your receipt is attached as a PDF.
+{{if .Branding.FooterText}}
+{{.Branding.FooterText}}{{end}}
+`,
+		HTMLBody: `{{.ReceiptHTML}}`,
+	},
+	domain.MailTemplateInvitation: {
+		Name:    domain.MailTemplateInvitation,
+		Subject: `You're invited to join {{if .Tenant}}{{.Tenant.Name}}{{else}}a workspace{{end}}`,
+		TextBody: `You have been invited to join {{if .Tenant}}{{.Tenant.Name}}{{else}}a workspace{{end}} as {{.Invitation.Role}}.
+
+Accept the invitation: {{.AcceptURL}}
+
+This invitation expires on {{.Invitation.ExpiresAt.Format "2006-01-02"}}.
+`,
+		HTMLBody: `<p>You have been invited to join <strong>{{if .Tenant}}{{.Tenant.Name}}{{else}}a workspace{{end}}</strong> as {{.Invitation.Role}}.</p>
+<p><a href="{{.AcceptURL}}"{{if .Branding.PrimaryColor}} style="color: {{.Branding.PrimaryColor}}"{{end}}>Accept the invitation</a></p>
+<p>This invitation expires on {{.Invitation.ExpiresAt.Format "2006-01-02"}}.</p>`,
+	},
+	domain.MailTemplatePasswordReset: {
+		Name:    domain.MailTemplatePasswordReset,
+		Subject: `Reset your password`,
+		TextBody: `Hi {{.User.FirstName}},
+
+Use the link below to reset your password:
+{{.ResetURL}}
+
+The link expires at {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}. If you did not ask for a reset, you can ignore this email.
+`,
+		HTMLBody: `<p>Hi {{.User.FirstName}},</p>
+<p><a href="{{.ResetURL}}"{{if .Branding.PrimaryColor}} style="color: {{.Branding.PrimaryColor}}"{{end}}>Reset your password</a></p>
+<p>The link expires at {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}. If you did not ask for a reset, you can ignore this email.</p>`,
+	},
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMailMessageMIMERejectsInjectedHeaders(t *testing.T) {
+	msg := &MailMessage{
+		FromAddress: "shop@example.com",
+		To:          []string{"customer@example.com\r\nBcc: everyone@example.com"},
+		Subject:     "Your receipt",
+		TextBody:    "Thanks",
+	}
+	if body, err := msg.MIME(); err == nil {
+		t.Fatalf("MIME accepted a recipient with a header line:\n%s", body)
+	}
+
+	msg.To = []string{"Jo Customer <customer@example.com>"}
+	body, err := msg.MIME()
+	if err != nil {
+		t.Fatalf("MIME: %v", err)
+	}
+	if !bytes.Contains(body, []byte("To: \"Jo Customer\" <customer@example.com>\r\n")) {
+		t.Errorf("MIME did not format the recipient:\n%s", body)
+	}
+}
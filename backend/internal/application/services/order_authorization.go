@@ -0,0 +1,409 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/pkg/config"
+)
+
+// DefaultAuthorizationWindow is how long an uncaptured hold is kept before it is voided
+const DefaultAuthorizationWindow = 7 * 24 * time.Hour
+
+// SetAuthorizationWindow overrides how long uncaptured holds are kept before VoidExpiredAuthorizations releases them
+func (s *OrderService) SetAuthorizationWindow(window time.Duration) {
+	if window > 0 {
+		s.authorizationWindow = window
+	}
+}
+
+// AuthorizePayment places a hold on the customer's payment method without collecting funds.
+// An amount of zero holds the balance due.
+func (s *OrderService) AuthorizePayment(ctx context.Context, orderID uuid.UUID, paymentData domain.PaymentData, amount float64) (*domain.PaymentTransaction, error) {
+	var (
+		order    *domain.Order
+		gateway  PaymentGateway
+		declined error
+	)
+	authorization, err := s.callGateway(ctx, orderID, gatewayCall{
+		scope: "authorize_payment",
+		reserve: func(ctx context.Context, locked *domain.Order, _ []*domain.PaymentTransaction) (*domain.PaymentTransaction, error) {
+			order = locked
+			switch order.PaymentStatus {
+			case domain.PaymentStatusPaid:
+				return nil, errors.New("order is already paid")
+			case domain.PaymentStatusAuthorized:
+				return nil, errors.New("order already has an outstanding authorization")
+			case domain.PaymentStatusRefunded, domain.PaymentStatusPartiallyRefunded:
+				return nil, errors.New("order has been refunded")
+			}
+
+			amount, err := s.paymentAmount(ctx, order, amount)
+			if err != nil {
+				return nil, err
+			}
+
+			gateway, err = s.gateways.Get(paymentData.Gateway)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := s.checkRegisterSession(ctx, order.TenantID, paymentData.RegisterSessionID); err != nil {
+				return nil, err
+			}
+
+			return &domain.PaymentTransaction{
+				TenantID:          order.TenantID,
+				OrderID:           orderID,
+				TransactionID:     paymentData.TransactionID,
+				PaymentGateway:    gateway.Name(),
+				PaymentMethod:     paymentData.Method,
+				Amount:            amount,
+				Currency:          order.Currency,
+				Status:            domain.TransactionStatusPending,
+				Type:              domain.TransactionTypeAuthorization,
+				GatewayResponse:   paymentData.GatewayResponse,
+				RegisterSessionID: paymentData.RegisterSessionID,
+			}, nil
+		},
+		call: func(ctx context.Context, authorization *domain.PaymentTransaction, idempotencyKey string) (*PaymentGatewayResult, error) {
+			return gateway.Authorize(ctx, &PaymentGatewayRequest{
+				TenantID:    order.TenantID,
+				OrderID:     order.ID,
+				Amount:      authorization.Amount,
+				Currency:    order.Currency,
+				Method:      paymentData.Method,
+				Token:       paymentData.Token,
+				Capture:     false,
+				Description: fmt.Sprintf("Order %s", order.OrderNumber),
+				Metadata:    map[string]string{"order_number": order.OrderNumber, "tenant_id": order.TenantID},
+
+				IdempotencyKey: idempotencyKey,
+			})
+		},
+		record: func(ctx context.Context, order *domain.Order, authorization *domain.PaymentTransaction, result *PaymentGatewayResult, gatewayErr error) error {
+			if gatewayErr != nil || result.Declined() {
+				var failureReason string
+				if gatewayErr != nil {
+					failureReason = gatewayErr.Error()
+				} else {
+					failureReason = result.FailureReason
+					authorization.GatewayResponse = result.Raw
+				}
+				if err := s.failPayment(ctx, order, authorization, failureReason); err != nil {
+					return err
+				}
+				// Commit the failed authorization and report the decline afterwards
+				declined = fmt.Errorf("%w: %s", ErrPaymentDeclined, failureReason)
+				return nil
+			}
+
+			if result.TransactionID != "" {
+				authorization.TransactionID = result.TransactionID
+			}
+			authorization.Status = domain.TransactionStatusAuthorized
+			authorization.GatewayResponse = result.Raw
+
+			if err := s.paymentRepo.Update(ctx, authorization); err != nil {
+				return fmt.Errorf("failed to update authorization transaction: %w", err)
+			}
+
+			setOrderPaymentMethod(order, paymentData.Method, paymentData.MethodTitle)
+			order.PaymentStatus = domain.PaymentStatusAuthorized
+			order.TransactionID = authorization.TransactionID
+			order.DateModified = *authorization.ProcessedAt
+
+			if err := s.orderRepo.Update(ctx, order); err != nil {
+				return fmt.Errorf("failed to update order payment status: %w", err)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if declined != nil {
+		return authorization, declined
+	}
+
+	return authorization, nil
+}
+
+// CapturePayment settles a hold for the full authorized amount, or for a lower
+// final amount once the order has been fulfilled. An amount of zero captures the full hold.
+func (s *OrderService) CapturePayment(ctx context.Context, authorizationID uuid.UUID, amount float64) (*domain.PaymentTransaction, error) {
+	orderID, err := s.authorizationOrderID(ctx, authorizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		order         *domain.Order
+		authorization *domain.PaymentTransaction
+		gateway       PaymentGateway
+		declined      error
+	)
+	capture, err := s.callGateway(ctx, orderID, gatewayCall{
+		scope: "capture_payment",
+		reserve: func(ctx context.Context, _ *domain.Order, transactions []*domain.PaymentTransaction) (*domain.PaymentTransaction, error) {
+			// Checked under the lock, so the hold cannot be captured or voided twice
+			var err error
+			authorization, gateway, err = s.openAuthorization(transactions, authorizationID)
+			if err != nil {
+				return nil, err
+			}
+
+			amount := amount
+			if amount == 0 {
+				amount = authorization.Amount
+			}
+			if amount <= 0 {
+				return nil, errors.New("capture amount must be positive")
+			}
+			if roundCurrency(amount) > roundCurrency(authorization.Amount) {
+				return nil, fmt.Errorf("capture amount exceeds authorized amount: %.2f", authorization.Amount)
+			}
+
+			// The capture lands in the session the hold was taken in, which must
+			// still be open to report it
+			if err := s.checkRegisterSession(ctx, authorization.TenantID, authorization.RegisterSessionID); err != nil {
+				return nil, err
+			}
+
+			return &domain.PaymentTransaction{
+				TenantID:            authorization.TenantID,
+				OrderID:             authorization.OrderID,
+				TransactionID:       authorization.TransactionID,
+				PaymentGateway:      authorization.PaymentGateway,
+				PaymentMethod:       authorization.PaymentMethod,
+				Amount:              amount,
+				Currency:            authorization.Currency,
+				Status:              domain.TransactionStatusPending,
+				Type:                domain.TransactionTypeCapture,
+				ParentTransactionID: &authorization.ID,
+				RegisterSessionID:   authorization.RegisterSessionID,
+			}, nil
+		},
+		call: func(ctx context.Context, capture *domain.PaymentTransaction, idempotencyKey string) (*PaymentGatewayResult, error) {
+			return gateway.Capture(ctx, authorization.TransactionID, capture.Amount, idempotencyKey)
+		},
+		record: func(ctx context.Context, locked *domain.Order, capture *domain.PaymentTransaction, result *PaymentGatewayResult, gatewayErr error) error {
+			order = locked
+			if gatewayErr != nil || result.Declined() {
+				capture.Status = domain.TransactionStatusFailed
+				if gatewayErr != nil {
+					capture.FailureReason = gatewayErr.Error()
+				} else {
+					capture.FailureReason = result.FailureReason
+					capture.GatewayResponse = result.Raw
+				}
+				if err := s.paymentRepo.Update(ctx, capture); err != nil {
+					return fmt.Errorf("failed to update capture transaction: %w", err)
+				}
+				declined = fmt.Errorf("%w: %s", ErrPaymentDeclined, capture.FailureReason)
+				return nil
+			}
+
+			if result.TransactionID != "" {
+				capture.TransactionID = result.TransactionID
+			}
+			capture.Status = domain.TransactionStatusCompleted
+			capture.Fee = result.Fee
+			capture.NetAmount = roundCurrency(capture.Amount - result.Fee)
+			capture.GatewayResponse = result.Raw
+
+			if err := s.paymentRepo.Update(ctx, capture); err != nil {
+				return fmt.Errorf("failed to update capture transaction: %w", err)
+			}
+
+			// The hold is consumed by the capture, including any uncaptured remainder
+			if err := s.paymentRepo.UpdateStatus(ctx, authorization.ID, domain.TransactionStatusCompleted); err != nil {
+				return fmt.Errorf("failed to update authorization transaction: %w", err)
+			}
+
+			// A capture for less than the balance due leaves the order partially paid
+			return s.settleOrder(ctx, order, capture, *capture.ProcessedAt)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if declined != nil {
+		return capture, declined
+	}
+
+	s.completePaidOrder(ctx, order)
+
+	return capture, nil
+}
+
+// VoidAuthorization releases a hold without collecting any funds
+func (s *OrderService) VoidAuthorization(ctx context.Context, authorizationID uuid.UUID, reason string) (*domain.PaymentTransaction, error) {
+	orderID, err := s.authorizationOrderID(ctx, authorizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		authorization *domain.PaymentTransaction
+		gateway       PaymentGateway
+		declined      error
+	)
+	void, err := s.callGateway(ctx, orderID, gatewayCall{
+		scope: "void_authorization",
+		reserve: func(ctx context.Context, _ *domain.Order, transactions []*domain.PaymentTransaction) (*domain.PaymentTransaction, error) {
+			var err error
+			authorization, gateway, err = s.openAuthorization(transactions, authorizationID)
+			if err != nil {
+				return nil, err
+			}
+
+			return &domain.PaymentTransaction{
+				TenantID:            authorization.TenantID,
+				OrderID:             authorization.OrderID,
+				TransactionID:       authorization.TransactionID,
+				PaymentGateway:      authorization.PaymentGateway,
+				PaymentMethod:       authorization.PaymentMethod,
+				Amount:              authorization.Amount,
+				Currency:            authorization.Currency,
+				Status:              domain.TransactionStatusPending,
+				Type:                domain.TransactionTypeVoid,
+				ParentTransactionID: &authorization.ID,
+				GatewayResponse:     map[string]interface{}{"reason": reason},
+			}, nil
+		},
+		call: func(ctx context.Context, _ *domain.PaymentTransaction, _ string) (*PaymentGatewayResult, error) {
+			return gateway.Void(ctx, authorization.TransactionID)
+		},
+		record: func(ctx context.Context, order *domain.Order, void *domain.PaymentTransaction, result *PaymentGatewayResult, gatewayErr error) error {
+			if gatewayErr != nil || result.Declined() {
+				void.Status = domain.TransactionStatusFailed
+				if gatewayErr != nil {
+					void.FailureReason = gatewayErr.Error()
+				} else {
+					void.FailureReason = result.FailureReason
+				}
+				if err := s.paymentRepo.Update(ctx, void); err != nil {
+					return fmt.Errorf("failed to update void transaction: %w", err)
+				}
+				declined = fmt.Errorf("%w: %s", ErrPaymentDeclined, void.FailureReason)
+				return nil
+			}
+
+			void.Status = domain.TransactionStatusCompleted
+			if err := s.paymentRepo.Update(ctx, void); err != nil {
+				return fmt.Errorf("failed to update void transaction: %w", err)
+			}
+
+			if err := s.paymentRepo.UpdateStatus(ctx, authorization.ID, domain.TransactionStatusCancelled); err != nil {
+				return fmt.Errorf("failed to update authorization transaction: %w", err)
+			}
+
+			// No funds were collected by the hold, so the order can be paid again. Other
+			// tenders it was split with stay paid
+			if order.PaymentStatus != domain.PaymentStatusAuthorized {
+				return nil
+			}
+			paid, err := s.amountPaid(ctx, order.ID)
+			if err != nil {
+				return err
+			}
+			order.PaymentStatus = domain.PaymentStatusPending
+			if paid > 0 {
+				order.PaymentStatus = domain.PaymentStatusPartiallyPaid
+			}
+			order.TransactionID = ""
+			order.DateModified = *void.ProcessedAt
+			if err := s.orderRepo.Update(ctx, order); err != nil {
+				return fmt.Errorf("failed to update order payment status: %w", err)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if declined != nil {
+		return void, declined
+	}
+
+	return void, nil
+}
+
+// VoidExpiredAuthorizations voids every hold older than the authorization window.
+// It is meant to be run periodically and returns the number of holds released.
+func (s *OrderService) VoidExpiredAuthorizations(ctx context.Context, tenantID string) (int, error) {
+	authorizations, err := s.paymentRepo.GetByStatus(ctx, tenantID, domain.TransactionStatusAuthorized)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get open authorizations: %w", err)
+	}
+
+	cutoff := time.Now().Add(-s.authorizationWindow)
+	voided := 0
+	for _, authorization := range authorizations {
+		if authorization.Type != domain.TransactionTypeAuthorization || authorization.CreatedAt.After(cutoff) {
+			continue
+		}
+
+		if _, err := s.VoidAuthorization(ctx, authorization.ID, "authorization window expired"); err != nil {
+			// Keep sweeping; the hold will be retried on the next run
+			continue
+		}
+		voided++
+	}
+
+	return voided, nil
+}
+
+// ScheduleAuthorizationSweep voids every tenant's expired holds on the job runner,
+// keeping holds for the authorization window set in the payment config
+func (s *OrderService) ScheduleAuthorizationSweep(runner *JobRunner, tenants domain.TenantRepository, payment config.PaymentConfig, jobs config.JobsConfig) {
+	s.SetAuthorizationWindow(payment.AuthorizationWindow)
+	runner.Every("void_expired_authorizations", jobs.AuthorizationSweepInterval, func(ctx context.Context) error {
+		return forEachTenant(ctx, tenants, func(ctx context.Context, tenantID string) error {
+			_, err := s.VoidExpiredAuthorizations(ctx, tenantID)
+			return err
+		})
+	})
+}
+
+// authorizationOrderID returns the order a hold was placed for
+func (s *OrderService) authorizationOrderID(ctx context.Context, authorizationID uuid.UUID) (uuid.UUID, error) {
+	authorization, err := s.paymentRepo.GetByID(ctx, authorizationID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get authorization transaction: %w", err)
+	}
+	return authorization.OrderID, nil
+}
+
+// openAuthorization finds a hold among its order's locked transactions and
+// checks it is still open
+func (s *OrderService) openAuthorization(transactions []*domain.PaymentTransaction, authorizationID uuid.UUID) (*domain.PaymentTransaction, PaymentGateway, error) {
+	var authorization *domain.PaymentTransaction
+	for _, tx := range transactions {
+		if tx.ID == authorizationID {
+			authorization = tx
+		}
+	}
+	if authorization == nil {
+		return nil, nil, errors.New("authorization transaction not found")
+	}
+
+	if authorization.Type != domain.TransactionTypeAuthorization {
+		return nil, nil, errors.New("transaction is not an authorization")
+	}
+	if authorization.Status != domain.TransactionStatusAuthorized {
+		return nil, nil, fmt.Errorf("authorization is not open: %s", authorization.Status)
+	}
+
+	gateway, err := s.gateways.Get(authorization.PaymentGateway)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return authorization, gateway, nil
+}
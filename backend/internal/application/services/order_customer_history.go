@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/pkg/config"
+)
+
+// Order metadata keys tracking what a paid order has added to its customer's
+// order count, total spend and loyalty balance
+const (
+	orderMetadataCustomerRecorded      = "customer_recorded"       // false until the order is in the customer's history
+	orderMetadataCustomerSpendReversed = "customer_spend_reversed" // Spend taken back out by refunds and cancellation
+	orderMetadataCustomerOrderReversed = "customer_order_reversed" // The order no longer counts towards the customer's orders
+)
+
+const (
+	// followUpAttempts and followUpBackoff pace the retries of bookkeeping that
+	// runs after a payment or refund has been committed
+	followUpAttempts = 3
+	followUpBackoff  = 200 * time.Millisecond
+
+	// customerHistoryLookback is how far back the sweep looks for paid orders
+	// that are still missing from their customer's history
+	customerHistoryLookback = 7 * 24 * time.Hour
+	customerHistoryPageSize = 100
+)
+
+// SetLogger sets the logger for failures that do not undo a committed payment or refund
+func (s *OrderService) SetLogger(logger *zap.Logger) {
+	if logger != nil {
+		s.logger = logger
+	}
+}
+
+// followUp runs bookkeeping for an order whose payment or refund has already
+// been committed. It retries fn a few times, so fn must be safe to repeat, and
+// logs the failure when it still does not go through.
+func (s *OrderService) followUp(ctx context.Context, task string, order *domain.Order, fn func(ctx context.Context) error) {
+	var err error
+	for attempt := 1; attempt <= followUpAttempts; attempt++ {
+		if err = fn(ctx); err == nil {
+			return
+		}
+		if attempt == followUpAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			attempt = followUpAttempts
+		case <-time.After(followUpBackoff * time.Duration(attempt)):
+		}
+	}
+	s.logger.Error("order follow-up failed",
+		zap.String("task", task),
+		zap.String("tenant_id", order.TenantID),
+		zap.String("order_id", order.ID.String()),
+		zap.Error(err))
+}
+
+// recordPaidOrder adds a paid order to its customer's history and earns loyalty
+// points on it. The order is marked in the same transaction, so running it again
+// for the same order does nothing.
+func (s *OrderService) recordPaidOrder(ctx context.Context, orderID uuid.UUID) error {
+	if s.loyalty == nil {
+		return nil
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		order, err := s.orderRepo.GetByIDForUpdate(ctx, orderID)
+		if err != nil {
+			return fmt.Errorf("failed to get order: %w", err)
+		}
+		if recorded, ok := order.Metadata[orderMetadataCustomerRecorded].(bool); !ok || recorded {
+			return nil
+		}
+		// An order refunded before it was recorded is left out of the history
+		if order.PaymentStatus != domain.PaymentStatusPaid {
+			return nil
+		}
+
+		if err := s.loyalty.RecordPaidOrder(ctx, order); err != nil {
+			return err
+		}
+
+		order.Metadata[orderMetadataCustomerRecorded] = true
+		if err := s.orderRepo.Update(ctx, order); err != nil {
+			return fmt.Errorf("failed to update order: %w", err)
+		}
+		return nil
+	})
+}
+
+// reverseCustomerHistory takes a refunded or cancelled order back out of its
+// customer's history: fraction is the share of the payment returned so far, and
+// the order stops counting towards the customer's orders once all of it is.
+// reverseLoyalty reverses the order's loyalty points in the same transaction.
+func (s *OrderService) reverseCustomerHistory(ctx context.Context, orderID uuid.UUID, fraction float64, reverseLoyalty func(ctx context.Context, order *domain.Order) error) error {
+	if s.loyalty == nil {
+		return nil
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		order, err := s.orderRepo.GetByIDForUpdate(ctx, orderID)
+		if err != nil {
+			return fmt.Errorf("failed to get order: %w", err)
+		}
+
+		if err := reverseLoyalty(ctx, order); err != nil {
+			return err
+		}
+
+		if order.CustomerID == nil {
+			return nil
+		}
+		// Orders paid before the history was tracked on the order carry no mark;
+		// they were recorded when they were paid
+		if recorded, ok := order.Metadata[orderMetadataCustomerRecorded].(bool); ok && !recorded {
+			return nil
+		}
+
+		fraction = math.Min(fraction, 1)
+		reversed := metadataFloat(order.Metadata, orderMetadataCustomerSpendReversed)
+		spend := roundCurrency(order.Total*fraction - reversed)
+		removeOrder := fraction >= 1 && !metadataBool(order.Metadata, orderMetadataCustomerOrderReversed)
+		if spend <= 0 && !removeOrder {
+			return nil
+		}
+		spend = math.Max(spend, 0)
+
+		if err := s.loyalty.RemoveFromHistory(ctx, order, spend, removeOrder); err != nil {
+			return err
+		}
+
+		if order.Metadata == nil {
+			order.Metadata = make(map[string]interface{})
+		}
+		order.Metadata[orderMetadataCustomerSpendReversed] = roundCurrency(reversed + spend)
+		if removeOrder {
+			order.Metadata[orderMetadataCustomerOrderReversed] = true
+		}
+		if err := s.orderRepo.Update(ctx, order); err != nil {
+			return fmt.Errorf("failed to update order: %w", err)
+		}
+		return nil
+	})
+}
+
+// RecordMissedCustomerHistory records the tenant's orders paid since the given
+// time that are still missing from their customer's history, e.g. because the
+// database went away just after the payment was committed
+func (s *OrderService) RecordMissedCustomerHistory(ctx context.Context, tenantID string, since time.Time) (int, error) {
+	if s.loyalty == nil {
+		return 0, nil
+	}
+
+	paid := domain.PaymentStatusPaid
+	filter := &domain.OrderFilter{
+		PaymentStatus: &paid,
+		StartDate:     &since,
+		Limit:         customerHistoryPageSize,
+		SortBy:        "date_created",
+		SortOrder:     "asc",
+	}
+
+	recorded := 0
+	for page := 1; ; page++ {
+		filter.Page = page
+		orders, _, err := s.orderRepo.GetByTenantID(ctx, tenantID, filter)
+		if err != nil {
+			return recorded, fmt.Errorf("failed to get paid orders: %w", err)
+		}
+		for _, order := range orders {
+			if done, ok := order.Metadata[orderMetadataCustomerRecorded].(bool); !ok || done {
+				continue
+			}
+			if err := s.recordPaidOrder(ctx, order.ID); err != nil {
+				return recorded, fmt.Errorf("order %s: %w", order.ID, err)
+			}
+			recorded++
+		}
+		if len(orders) < customerHistoryPageSize {
+			return recorded, nil
+		}
+	}
+}
+
+// ScheduleCustomerHistorySweep records every tenant's paid orders that are still
+// missing from their customer's history on the job runner
+func (s *OrderService) ScheduleCustomerHistorySweep(runner *JobRunner, tenants domain.TenantRepository, jobs config.JobsConfig) {
+	runner.Every("record_customer_history", jobs.CustomerHistoryInterval, func(ctx context.Context) error {
+		since := time.Now().Add(-customerHistoryLookback)
+		return forEachTenant(ctx, tenants, func(ctx context.Context, tenantID string) error {
+			_, err := s.RecordMissedCustomerHistory(ctx, tenantID, since)
+			return err
+		})
+	})
+}
@@ -2,51 +2,136 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+	"go.uber.org/zap"
 )
 
+// ErrInsufficientStock is returned when an order asks for more units than are on hand
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// itemMetadataAttributes holds the sold variation's attributes on an order item
+const (
+	itemMetadataAttributes = "attributes"
+	itemMetadataPriceRule  = "price_rule" // Price list rule the line was sold at
+)
+
+// gatewayResponseIdempotencyKey holds the idempotency key of a pending gateway
+// call on its transaction, so a retry can find the call
+const gatewayResponseIdempotencyKey = "idempotency_key"
+
+// gatewayCallTimeout bounds how long a gateway call can be in flight
+const gatewayCallTimeout = 10 * time.Minute
+
 // OrderService handles order business logic
 type OrderService struct {
+	txManager     repositories.TransactionManager
 	orderRepo     repositories.OrderRepository
 	orderItemRepo repositories.OrderItemRepository
 	cartRepo      repositories.CartRepository
 	cartItemRepo  repositories.CartItemRepository
 	productRepo   repositories.ProductRepository
+	variationRepo repositories.ProductVariationRepository
 	inventoryRepo repositories.InventoryLogRepository
+	inventory     *InventoryService
 	paymentRepo   repositories.PaymentTransactionRepository
 	receiptRepo   repositories.ReceiptRepository
+	gateways      *PaymentGatewayRegistry
+	idempotency   *IdempotencyService
+	discounts     *DiscountService
+	tax           TaxCalculator
+	receipts      *ReceiptService
+	registers     *RegisterService
+	loyalty       *LoyaltyService
+	giftCards     *GiftCardService
+	logger        *zap.Logger
+
+	authorizationWindow time.Duration
 }
 
 func NewOrderService(
+	txManager repositories.TransactionManager,
 	orderRepo repositories.OrderRepository,
 	orderItemRepo repositories.OrderItemRepository,
 	cartRepo repositories.CartRepository,
 	cartItemRepo repositories.CartItemRepository,
 	productRepo repositories.ProductRepository,
+	variationRepo repositories.ProductVariationRepository,
 	inventoryRepo repositories.InventoryLogRepository,
+	inventory *InventoryService,
 	paymentRepo repositories.PaymentTransactionRepository,
 	receiptRepo repositories.ReceiptRepository,
+	gateways *PaymentGatewayRegistry,
+	idempotency *IdempotencyService,
+	discounts *DiscountService,
+	tax TaxCalculator,
+	receipts *ReceiptService,
+	registers *RegisterService,
+	loyalty *LoyaltyService,
+	giftCards *GiftCardService,
 ) *OrderService {
 	return &OrderService{
+		txManager:     txManager,
 		orderRepo:     orderRepo,
 		orderItemRepo: orderItemRepo,
 		cartRepo:      cartRepo,
 		cartItemRepo:  cartItemRepo,
 		productRepo:   productRepo,
+		variationRepo: variationRepo,
 		inventoryRepo: inventoryRepo,
+		inventory:     inventory,
 		paymentRepo:   paymentRepo,
 		receiptRepo:   receiptRepo,
+		gateways:      gateways,
+		idempotency:   idempotency,
+		discounts:     discounts,
+		tax:           tax,
+		receipts:      receipts,
+		registers:     registers,
+		loyalty:       loyalty,
+		giftCards:     giftCards,
+		logger:        zap.NewNop(),
+
+		authorizationWindow: DefaultAuthorizationWindow,
 	}
 }
 
-// CreateOrderFromCart creates an order from a shopping cart
+// CreateOrderFromCart creates an order from a shopping cart. Retries carrying the
+// same idempotency key (see WithIdempotencyKey) return the original order.
 func (s *OrderService) CreateOrderFromCart(ctx context.Context, cartID uuid.UUID, customerInfo domain.CustomerInfo) (*domain.Order, error) {
+	key := IdempotencyKeyFromContext(ctx)
+	if key == "" || s.idempotency == nil {
+		return s.createOrderFromCart(ctx, cartID, customerInfo)
+	}
+
+	cart, err := s.cartRepo.GetByID(ctx, cartID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	var order *domain.Order
+	payload := map[string]interface{}{"cart_id": cartID, "customer": customerInfo}
+	err = s.idempotency.Do(ctx, cart.TenantID, "create_order", key, payload, &order, func() (interface{}, error) {
+		var err error
+		order, err = s.createOrderFromCart(ctx, cartID, customerInfo)
+		return order, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (s *OrderService) createOrderFromCart(ctx context.Context, cartID uuid.UUID, customerInfo domain.CustomerInfo) (*domain.Order, error) {
 	// Get cart and items
 	cart, err := s.cartRepo.GetByID(ctx, cartID)
 	if err != nil {
@@ -66,109 +151,295 @@ func (s *OrderService) CreateOrderFromCart(ctx context.Context, cartID uuid.UUID
 		return nil, errors.New("cart is empty")
 	}
 
-	// Validate stock availability for all items
-	for _, item := range cartItems {
-		product, err := s.productRepo.GetByID(ctx, item.ProductID)
+	// Tax at the customer's address before taking any locks, since an external
+	// tax service may be slow
+	taxResult, err := calculateCartTax(ctx, s.tax, s.productRepo, cart, cartItems, customerInfo.BillingAddress, customerInfo.ShippingAddress, cart.ShippingTotal)
+	if err != nil {
+		return nil, err
+	}
+
+	total := cart.Subtotal + cart.ShippingTotal - cart.DiscountTotal
+	if !taxResult.PricesIncludeTax {
+		total += taxResult.TaxTotal
+	}
+
+	// Link the order to the customer identified on the cart or at checkout
+	customerID := cart.CustomerID
+	if customerID == nil {
+		customerID = customerInfo.CustomerID
+	}
+	redemption := CartLoyaltyRedemption(cart)
+	if customerID != nil || redemption != nil {
+		if s.loyalty == nil {
+			return nil, errors.New("customers are not enabled")
+		}
+	}
+	if customerID != nil {
+		customer, err := s.loyalty.GetCustomer(ctx, cart.TenantID, *customerID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get product %s: %w", item.ProductID, err)
+			return nil, err
 		}
+		if customerInfo.Email == "" {
+			customerInfo.Email = customer.Email
+		}
+		if customerInfo.Phone == "" {
+			customerInfo.Phone = customer.Phone
+		}
+	}
+	if redemption != nil && (customerID == nil || redemption.CustomerID != *customerID) {
+		return nil, errors.New("loyalty points were redeemed for a different customer")
+	}
 
-		if product.ManageStock && product.StockQuantity < item.Quantity {
-			return nil, fmt.Errorf("insufficient stock for product %s: only %d available", product.Name, product.StockQuantity)
+	// Fulfil from the cart's location, or the tenant default when it has locations
+	var location *domain.StockLocation
+	if s.inventory != nil {
+		location, err = s.inventory.ResolveLocation(ctx, cart.TenantID, cart.LocationID)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	// Generate order number
-	orderNumber, err := s.orderRepo.GenerateOrderNumber(ctx, cart.TenantID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate order number: %w", err)
-	}
-
-	// Create order
-	order := &domain.Order{
-		TenantID:        cart.TenantID,
-		OrderNumber:     orderNumber,
-		UserID:          cart.UserID,
-		Status:          domain.OrderStatusPending,
-		PaymentStatus:   domain.PaymentStatusPending,
-		CustomerEmail:   customerInfo.Email,
-		CustomerPhone:   customerInfo.Phone,
-		BillingAddress:  customerInfo.BillingAddress,
-		ShippingAddress: customerInfo.ShippingAddress,
-		Currency:        cart.Currency,
-		Subtotal:        cart.Subtotal,
-		TaxTotal:        cart.TaxTotal,
-		ShippingTotal:   cart.ShippingTotal,
-		DiscountTotal:   cart.DiscountTotal,
-		Total:           cart.Total,
-		CustomerNote:    customerInfo.Note,
-		DateCreated:     time.Now(),
-		DateModified:    time.Now(),
-	}
-
-	if err := s.orderRepo.Create(ctx, order); err != nil {
-		return nil, fmt.Errorf("failed to create order: %w", err)
-	}
-
-	// Create order items and update inventory
-	for _, cartItem := range cartItems {
-		product, err := s.productRepo.GetByID(ctx, cartItem.ProductID)
+	// Two carts holding the same items would deadlock if each locked them in its
+	// own line order, so lines are locked by product and then variation
+	sort.SliceStable(cartItems, func(i, j int) bool {
+		if cartItems[i].ProductID != cartItems[j].ProductID {
+			return cartItems[i].ProductID.String() < cartItems[j].ProductID.String()
+		}
+		return stockKey(cartItems[i].ProductID, cartItems[i].VariationID).String() < stockKey(cartItems[j].ProductID, cartItems[j].VariationID).String()
+	})
+
+	var order *domain.Order
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		// Claim the cart first: a second checkout of it waits on the row until we
+		// finish, then finds it converted
+		claimed, err := s.cartRepo.TransitionStatus(ctx, cartID, domain.CartStatusActive, domain.CartStatusConverted)
+		if err != nil {
+			return fmt.Errorf("failed to mark cart as converted: %w", err)
+		}
+		if !claimed {
+			return errors.New("cart is not active")
+		}
+
+		// Lock every product and variation row and validate stock against the
+		// locked values; a concurrent checkout for the same item waits here until
+		// we commit. Variations carry their own stock, and with a fulfilment
+		// location only the stock held there can be sold.
+		products := make(map[uuid.UUID]*domain.Product)
+		variations := make(map[uuid.UUID]*domain.ProductVariation)
+		levels := make(map[uuid.UUID]*domain.StockLevel)
+		remaining := make(map[uuid.UUID]int)
+		for _, item := range cartItems {
+			if _, ok := products[item.ProductID]; !ok {
+				product, err := s.productRepo.GetByIDForUpdate(ctx, item.ProductID)
+				if err != nil {
+					return fmt.Errorf("failed to get product %s: %w", item.ProductID, err)
+				}
+				products[item.ProductID] = product
+				remaining[product.ID] = product.StockQuantity
+			}
+			product := products[item.ProductID]
+
+			key := stockKey(item.ProductID, item.VariationID)
+			if item.VariationID != nil {
+				if _, ok := variations[key]; !ok {
+					variation, err := s.lockVariation(ctx, product, *item.VariationID)
+					if err != nil {
+						return err
+					}
+					variations[key] = variation
+					remaining[key] = variation.StockQuantity
+				}
+			} else if product.ProductType == domain.ProductTypeVariable {
+				return fmt.Errorf("a variation of %s must be selected", product.Name)
+			}
+
+			available := remaining[key]
+			if location != nil && product.ManageStock {
+				level, ok := levels[key]
+				if !ok {
+					var err error
+					level, err = s.inventory.levelRepo.GetForUpdate(ctx, cart.TenantID, location.ID, item.ProductID, item.VariationID)
+					if err != nil {
+						return fmt.Errorf("failed to get stock level: %w", err)
+					}
+					levels[key] = level
+					remaining[level.ID] = level.Quantity
+				}
+				if remaining[level.ID] < item.Quantity {
+					return fmt.Errorf("%w for product %s: only %d available at %s", ErrInsufficientStock, product.Name, remaining[level.ID], location.Name)
+				}
+				remaining[level.ID] -= item.Quantity
+			} else if product.ManageStock && available < item.Quantity {
+				return fmt.Errorf("%w for product %s: only %d available", ErrInsufficientStock, product.Name, available)
+			}
+			remaining[key] -= item.Quantity
+		}
+
+		// Generate order number
+		orderNumber, err := s.orderRepo.GenerateOrderNumber(ctx, cart.TenantID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get product: %w", err)
+			return fmt.Errorf("failed to generate order number: %w", err)
 		}
 
-		// Create order item
-		orderItem := &domain.OrderItem{
-			OrderID:     order.ID,
-			ProductID:   cartItem.ProductID,
-			VariationID: cartItem.VariationID,
-			Quantity:    cartItem.Quantity,
-			UnitPrice:   cartItem.UnitPrice,
-			TotalPrice:  cartItem.TotalPrice,
-			ProductName: product.Name,
-			ProductSKU:  product.SKU,
-			ProductData: cartItem.ProductData,
+		// Create order
+		order = &domain.Order{
+			TenantID:        cart.TenantID,
+			OrderNumber:     orderNumber,
+			UserID:          cart.UserID,
+			CustomerID:      customerID,
+			LocationID:      cart.LocationID,
+			Status:          domain.OrderStatusPending,
+			PaymentStatus:   domain.PaymentStatusPending,
+			CustomerEmail:   customerInfo.Email,
+			CustomerPhone:   customerInfo.Phone,
+			BillingAddress:  customerInfo.BillingAddress,
+			ShippingAddress: customerInfo.ShippingAddress,
+			Currency:        cart.Currency,
+			Subtotal:        cart.Subtotal,
+			TaxTotal:        taxResult.TaxTotal,
+			ShippingTotal:   cart.ShippingTotal,
+			DiscountTotal:   cart.DiscountTotal,
+			Total:           roundCurrency(total),
+			CustomerNote:    customerInfo.Note,
+			DateCreated:     time.Now(),
+			DateModified:    time.Now(),
 		}
 
-		if err := s.orderItemRepo.Create(ctx, orderItem); err != nil {
-			return nil, fmt.Errorf("failed to create order item: %w", err)
+		order.Metadata = map[string]interface{}{"prices_include_tax": taxResult.PricesIncludeTax}
+		if len(taxResult.ShippingTax.TaxLines) > 0 {
+			order.Metadata["shipping_tax_lines"] = taxResult.ShippingTax.TaxLines
 		}
 
-		// Update product stock and create inventory log
-		if product.ManageStock {
-			newStock := product.StockQuantity - cartItem.Quantity
-			if err := s.productRepo.UpdateStock(ctx, product.ID, newStock); err != nil {
-				return nil, fmt.Errorf("failed to update product stock: %w", err)
+		appliedDiscounts := CartAppliedDiscounts(cart)
+		if len(appliedDiscounts) > 0 {
+			order.Metadata["discounts"] = appliedDiscounts
+		}
+		if redemption != nil {
+			order.Metadata[orderMetadataLoyalty] = redemption
+		}
+
+		if location != nil {
+			order.LocationID = &location.ID
+		}
+
+		if err := s.orderRepo.Create(ctx, order); err != nil {
+			return fmt.Errorf("failed to create order: %w", err)
+		}
+
+		// Redeem discounts under lock so a code cannot be used past its limits
+		if len(appliedDiscounts) > 0 && s.discounts != nil {
+			if err := s.discounts.RedeemForOrder(ctx, order, appliedDiscounts); err != nil {
+				return err
 			}
+		}
 
-			// Create inventory log
-			inventoryLog := &domain.InventoryLog{
-				TenantID:       cart.TenantID,
-				ProductID:      product.ID,
-				VariationID:    cartItem.VariationID,
-				Type:           domain.InventoryTypeSale,
-				Quantity:       cartItem.Quantity,
-				QuantityBefore: product.StockQuantity,
-				QuantityAfter:  newStock,
-				Reason:         fmt.Sprintf("Sale - Order %s", order.OrderNumber),
-				ReferenceID:    &order.ID,
-				ReferenceType:  "order",
-				CostPerUnit:    product.CostPrice,
-				TotalCost:      product.CostPrice * float64(cartItem.Quantity),
-				UserID:         cart.UserID,
+		// Debit redeemed points under lock so they cannot be spent twice
+		if redemption != nil {
+			if err := s.loyalty.RedeemForOrder(ctx, order, redemption); err != nil {
+				return err
+			}
+		}
+
+		// Create order items and update inventory
+		for _, cartItem := range cartItems {
+			product := products[cartItem.ProductID]
+			variation := variations[stockKey(cartItem.ProductID, cartItem.VariationID)]
+
+			// Create order item
+			orderItem := &domain.OrderItem{
+				OrderID:     order.ID,
+				ProductID:   cartItem.ProductID,
+				VariationID: cartItem.VariationID,
+				Quantity:    cartItem.Quantity,
+				UnitPrice:   cartItem.UnitPrice,
+				TotalPrice:  cartItem.TotalPrice,
+				ProductName: product.Name,
+				ProductSKU:  product.SKU,
+				ProductData: cartItem.ProductData,
+				TaxClass:    product.TaxClass,
+				TaxTotal:    taxResult.Lines[cartItem.ID].TaxTotal,
+				TaxLines:    taxResult.Lines[cartItem.ID].TaxLines,
+			}
+			orderItem.Metadata = make(map[string]interface{})
+			if discount := metadataFloat(cartItem.Metadata, itemMetadataDiscountTotal); discount > 0 {
+				orderItem.Metadata[itemMetadataDiscountTotal] = discount
+			}
+			if cartItem.PriceRuleID != nil {
+				orderItem.Metadata[itemMetadataPriceRule] = priceRuleSnapshot(cartItem)
+			}
+			if variation != nil {
+				orderItem.ProductSKU = variation.SKU
+				orderItem.Metadata[itemMetadataAttributes] = variation.Attributes
+			}
+
+			if err := s.orderItemRepo.Create(ctx, orderItem); err != nil {
+				return fmt.Errorf("failed to create order item: %w", err)
 			}
 
-			if err := s.inventoryRepo.Create(ctx, inventoryLog); err != nil {
-				// Log error but don't fail order creation
-				// TODO: Add proper logging
+			// Update product or variation stock and create inventory log
+			if product.ManageStock {
+				var stockBefore, newStock int
+				if variation != nil {
+					stockBefore = variation.StockQuantity
+					newStock = stockBefore - cartItem.Quantity
+					if err := s.variationRepo.UpdateStock(ctx, variation.ID, newStock); err != nil {
+						return fmt.Errorf("failed to update variation stock: %w", err)
+					}
+					variation.StockQuantity = newStock
+				} else {
+					stockBefore = product.StockQuantity
+					newStock = stockBefore - cartItem.Quantity
+					if err := s.productRepo.UpdateStock(ctx, product.ID, newStock); err != nil {
+						return fmt.Errorf("failed to update product stock: %w", err)
+					}
+					product.StockQuantity = newStock
+				}
+
+				// With a location the sale is logged against the location's stock
+				if level := levels[stockKey(cartItem.ProductID, cartItem.VariationID)]; level != nil {
+					err := s.inventory.applyToLevel(ctx, level, product, variation, stockMovement{
+						TenantID:      cart.TenantID,
+						VariationID:   cartItem.VariationID,
+						Quantity:      -cartItem.Quantity,
+						Type:          domain.InventoryTypeSale,
+						Reason:        fmt.Sprintf("Sale - Order %s", order.OrderNumber),
+						ReferenceID:   &order.ID,
+						ReferenceType: "order",
+						UserID:        cart.UserID,
+					})
+					if err != nil {
+						return err
+					}
+					continue
+				}
+
+				// Create inventory log
+				inventoryLog := &domain.InventoryLog{
+					TenantID:       cart.TenantID,
+					ProductID:      product.ID,
+					VariationID:    cartItem.VariationID,
+					Type:           domain.InventoryTypeSale,
+					Quantity:       cartItem.Quantity,
+					QuantityBefore: stockBefore,
+					QuantityAfter:  newStock,
+					Reason:         fmt.Sprintf("Sale - Order %s", order.OrderNumber),
+					ReferenceID:    &order.ID,
+					ReferenceType:  "order",
+					CostPerUnit:    costPriceFor(product, variation),
+					TotalCost:      costPriceFor(product, variation) * float64(cartItem.Quantity),
+					UserID:         cart.UserID,
+				}
+
+				if err := s.inventoryRepo.Create(ctx, inventoryLog); err != nil {
+					return fmt.Errorf("failed to create inventory log: %w", err)
+				}
 			}
 		}
-	}
 
-	// Mark cart as converted
-	if err := s.cartRepo.UpdateStatus(ctx, cartID, domain.CartStatusConverted); err != nil {
-		// Log error but don't fail order creation
-		// TODO: Add proper logging
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return order, nil
@@ -192,6 +463,10 @@ func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID,
 		if err := s.handleOrderCancellation(ctx, order, userID); err != nil {
 			return fmt.Errorf("failed to handle order cancellation: %w", err)
 		}
+		// Returning the tenders updates the order's payment status
+		if order, err = s.orderRepo.GetByID(ctx, orderID); err != nil {
+			return fmt.Errorf("failed to get order: %w", err)
+		}
 	case domain.OrderStatusDelivered:
 		order.DateCompleted = &[]time.Time{time.Now()}[0]
 	}
@@ -199,166 +474,972 @@ func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID,
 	order.Status = status
 	order.DateModified = time.Now()
 
-	return s.orderRepo.Update(ctx, order)
+	if err := s.orderRepo.Update(ctx, order); err != nil {
+		return err
+	}
+
+	// Runs once the status is saved, as it updates the order itself
+	if status == domain.OrderStatusCancelled && s.loyalty != nil {
+		s.followUp(ctx, "reverse_customer_history", order, func(ctx context.Context) error {
+			return s.reverseCustomerHistory(ctx, order.ID, 1, s.loyalty.ReverseForCancellation)
+		})
+	}
+
+	return nil
 }
 
-// ProcessPayment processes a payment for an order
+// ProcessPayment charges an order through the gateway named in paymentData.Gateway.
+// An order can be split across several tenders, each taking paymentData.Amount;
+// it is paid once its payments cover the total. Retries carrying the same
+// idempotency key return the original transaction.
 func (s *OrderService) ProcessPayment(ctx context.Context, orderID uuid.UUID, paymentData domain.PaymentData) (*domain.PaymentTransaction, error) {
+	var transaction *domain.PaymentTransaction
+	err := s.withOrderIdempotency(ctx, orderID, "process_payment", paymentData, &transaction, func() (interface{}, error) {
+		var err error
+		transaction, err = s.processPayment(ctx, orderID, paymentData)
+		return transaction, err
+	})
+	return transaction, err
+}
+
+func (s *OrderService) processPayment(ctx context.Context, orderID uuid.UUID, paymentData domain.PaymentData) (*domain.PaymentTransaction, error) {
+	var (
+		order    *domain.Order
+		gateway  PaymentGateway
+		declined error
+	)
+	transaction, err := s.callGateway(ctx, orderID, gatewayCall{
+		scope: "process_payment",
+		reserve: func(ctx context.Context, locked *domain.Order, _ []*domain.PaymentTransaction) (*domain.PaymentTransaction, error) {
+			// The order is locked so two tenders cannot both pass the balance due check
+			order = locked
+			switch order.PaymentStatus {
+			case domain.PaymentStatusPaid:
+				return nil, errors.New("order is already paid")
+			case domain.PaymentStatusAuthorized:
+				return nil, errors.New("order has an outstanding authorization; capture or void it instead")
+			case domain.PaymentStatusRefunded, domain.PaymentStatusPartiallyRefunded:
+				return nil, errors.New("order has been refunded")
+			}
+
+			amount, err := s.paymentAmount(ctx, order, paymentData.Amount)
+			if err != nil {
+				return nil, err
+			}
+
+			gateway, err = s.gateways.Get(paymentData.Gateway)
+			if err != nil {
+				return nil, err
+			}
+
+			// Holds the session open until the pending payment is committed; the
+			// session then cannot close until the payment is recorded
+			if err := s.checkRegisterSession(ctx, order.TenantID, paymentData.RegisterSessionID); err != nil {
+				return nil, err
+			}
+
+			return &domain.PaymentTransaction{
+				TenantID:          order.TenantID,
+				OrderID:           orderID,
+				TransactionID:     paymentData.TransactionID,
+				PaymentGateway:    gateway.Name(),
+				PaymentMethod:     paymentData.Method,
+				Amount:            amount,
+				Currency:          order.Currency,
+				Status:            domain.TransactionStatusPending,
+				Type:              domain.TransactionTypePayment,
+				GatewayResponse:   paymentData.GatewayResponse,
+				RegisterSessionID: paymentData.RegisterSessionID,
+			}, nil
+		},
+		call: func(ctx context.Context, transaction *domain.PaymentTransaction, idempotencyKey string) (*PaymentGatewayResult, error) {
+			return gateway.Authorize(ctx, &PaymentGatewayRequest{
+				TenantID:    order.TenantID,
+				OrderID:     order.ID,
+				Amount:      transaction.Amount,
+				Currency:    order.Currency,
+				Method:      paymentData.Method,
+				Token:       paymentData.Token,
+				Capture:     true,
+				Description: fmt.Sprintf("Order %s", order.OrderNumber),
+				Metadata:    map[string]string{"order_number": order.OrderNumber, "tenant_id": order.TenantID},
+
+				IdempotencyKey: idempotencyKey,
+			})
+		},
+		record: func(ctx context.Context, locked *domain.Order, transaction *domain.PaymentTransaction, result *PaymentGatewayResult, gatewayErr error) error {
+			order = locked
+			if gatewayErr != nil || result.Declined() {
+				var failureReason string
+				if gatewayErr != nil {
+					failureReason = gatewayErr.Error()
+				} else {
+					failureReason = result.FailureReason
+					transaction.GatewayResponse = result.Raw
+				}
+				if err := s.failPayment(ctx, order, transaction, failureReason); err != nil {
+					return err
+				}
+				// Commit the failed transaction and report the decline afterwards
+				declined = fmt.Errorf("%w: %s", ErrPaymentDeclined, failureReason)
+				return nil
+			}
+
+			if result.TransactionID != "" {
+				transaction.TransactionID = result.TransactionID
+			}
+			// A gift card can cover less than was asked for; the rest stays due
+			if result.Amount > 0 && result.Amount < transaction.Amount {
+				transaction.Amount = roundCurrency(result.Amount)
+			}
+			transaction.Status = domain.TransactionStatusCompleted
+			transaction.Fee = result.Fee
+			transaction.NetAmount = roundCurrency(transaction.Amount - result.Fee)
+			transaction.GatewayResponse = result.Raw
+
+			if err := s.paymentRepo.Update(ctx, transaction); err != nil {
+				return fmt.Errorf("failed to update payment transaction: %w", err)
+			}
+
+			// Update order payment status
+			setOrderPaymentMethod(order, paymentData.Method, paymentData.MethodTitle)
+			return s.settleOrder(ctx, order, transaction, *transaction.ProcessedAt)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if declined != nil {
+		return transaction, declined
+	}
+
+	s.completePaidOrder(ctx, order)
+
+	return transaction, nil
+}
+
+// BalanceDue returns what is left to pay on an order after its settled
+// payments, net of refunds
+func (s *OrderService) BalanceDue(ctx context.Context, orderID uuid.UUID) (float64, error) {
 	order, err := s.orderRepo.GetByID(ctx, orderID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order: %w", err)
+		return 0, fmt.Errorf("failed to get order: %w", err)
+	}
+	paid, err := s.amountPaid(ctx, order.ID)
+	if err != nil {
+		return 0, err
 	}
+	return math.Max(0, roundCurrency(order.Total-paid)), nil
+}
+
+// RefundOrder refunds selected order lines, the shipping charge and/or an
+// arbitrary amount. Lines marked for restocking are returned to inventory.
+// Retries carrying the same idempotency key return the original refund.
+func (s *OrderService) RefundOrder(ctx context.Context, orderID uuid.UUID, req domain.RefundRequest, userID *uuid.UUID) (*domain.PaymentTransaction, error) {
+	var transaction *domain.PaymentTransaction
+	err := s.withOrderIdempotency(ctx, orderID, "refund_order", req, &transaction, func() (interface{}, error) {
+		var err error
+		transaction, err = s.refundOrder(ctx, orderID, req, userID)
+		return transaction, err
+	})
+	return transaction, err
+}
+
+// refundPlan is a refund worked out against the locked order and its payments
+type refundPlan struct {
+	amount        float64
+	refundType    string
+	lines         []map[string]interface{}
+	restock       map[uuid.UUID]int
+	remaining     map[uuid.UUID]float64
+	settled       bool
+	totalPaid     float64
+	refundedTotal float64
+}
 
-	if order.PaymentStatus == domain.PaymentStatusPaid {
-		return nil, errors.New("order is already paid")
+func (s *OrderService) refundOrder(ctx context.Context, orderID uuid.UUID, req domain.RefundRequest, userID *uuid.UUID) (*domain.PaymentTransaction, error) {
+	if len(req.Items) == 0 && !req.RefundShipping && req.Amount <= 0 {
+		return nil, errors.New("nothing to refund")
 	}
+	if req.Amount < 0 {
+		return nil, errors.New("refund amount cannot be negative")
+	}
+
+	var (
+		order             *domain.Order
+		plan              *refundPlan
+		refundTransaction *domain.PaymentTransaction
+		declined          error
+		err               error
+	)
+	if req.ToStoreCredit {
+		// No gateway is involved, so the credit is issued under the order's lock
+		err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+			var transactions []*domain.PaymentTransaction
+			var err error
+			order, transactions, err = s.lockOrderPayments(ctx, orderID)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			for _, tx := range transactions {
+				if isInFlight(tx, now) {
+					return ErrPaymentInProgress
+				}
+			}
 
-	// Create payment transaction
-	transaction := &domain.PaymentTransaction{
-		TenantID:        order.TenantID,
-		OrderID:         orderID,
-		TransactionID:   paymentData.TransactionID,
-		PaymentGateway:  paymentData.Gateway,
-		PaymentMethod:   paymentData.Method,
-		Amount:          order.Total,
-		Currency:        order.Currency,
-		Status:          domain.TransactionStatusPending,
-		Type:            domain.TransactionTypePayment,
-		GatewayResponse: paymentData.GatewayResponse,
+			if plan, err = s.planRefund(ctx, order, transactions, req); err != nil {
+				return err
+			}
+			if refundTransaction, err = s.refundToStoreCredit(ctx, order, plan.amount, plan.refundType, req, userID); err != nil {
+				return err
+			}
+			return s.applyRefund(ctx, order, req, plan, refundTransaction)
+		})
+	} else {
+		charges := make(map[uuid.UUID]string)
+		refundTransaction, err = s.callGateway(ctx, orderID, gatewayCall{
+			scope: "refund_order",
+			reserve: func(ctx context.Context, locked *domain.Order, transactions []*domain.PaymentTransaction) (*domain.PaymentTransaction, error) {
+				// The order and its payments are locked so two refunds cannot both
+				// pass the refundable balance check
+				order = locked
+				var err error
+				if plan, err = s.planRefund(ctx, order, transactions, req); err != nil {
+					return nil, err
+				}
+				for _, tx := range transactions {
+					charges[tx.ID] = tx.TransactionID
+				}
+				return s.refundToPayment(order, plan, req, transactions)
+			},
+			call: func(ctx context.Context, refund *domain.PaymentTransaction, idempotencyKey string) (*PaymentGatewayResult, error) {
+				gateway, err := s.gateways.Get(refund.PaymentGateway)
+				if err != nil {
+					return nil, err
+				}
+				return gateway.Refund(ctx, charges[*refund.ParentTransactionID], refund.Amount, idempotencyKey)
+			},
+			record: func(ctx context.Context, locked *domain.Order, refund *domain.PaymentTransaction, result *PaymentGatewayResult, gatewayErr error) error {
+				order = locked
+				if gatewayErr != nil || result.Declined() {
+					refund.Status = domain.TransactionStatusFailed
+					if gatewayErr != nil {
+						refund.FailureReason = gatewayErr.Error()
+					} else {
+						refund.FailureReason = result.FailureReason
+						refund.GatewayResponse = result.Raw
+					}
+					if err := s.paymentRepo.Update(ctx, refund); err != nil {
+						return fmt.Errorf("failed to update refund transaction: %w", err)
+					}
+					// Commit the failed refund transaction; the order is left as it was
+					declined = fmt.Errorf("%w: %s", ErrPaymentDeclined, refund.FailureReason)
+					return nil
+				}
+
+				if result.TransactionID != "" {
+					refund.TransactionID = result.TransactionID
+				}
+				refund.Status = domain.TransactionStatusCompleted
+				refund.NetAmount = refund.Amount
+				refund.GatewayResponse = result.Raw
+
+				if err := s.paymentRepo.Update(ctx, refund); err != nil {
+					return fmt.Errorf("failed to update refund transaction: %w", err)
+				}
+				return s.applyRefund(ctx, order, req, plan, refund)
+			},
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if declined != nil {
+		return refundTransaction, declined
 	}
 
-	if err := s.paymentRepo.Create(ctx, transaction); err != nil {
-		return nil, fmt.Errorf("failed to create payment transaction: %w", err)
+	if len(plan.restock) > 0 {
+		if err := s.restoreInventoryFromOrder(ctx, order, plan.restock, userID); err != nil {
+			// Log error but don't fail refund
+			s.logger.Error("failed to restock refunded items", zap.String("tenant_id", order.TenantID), zap.String("order_id", order.ID.String()), zap.Error(err))
+		}
 	}
 
-	// TODO: Integrate with actual payment gateways
-	// For now, assume payment is successful
-	transaction.Status = domain.TransactionStatusCompleted
-	transaction.ProcessedAt = &[]time.Time{time.Now()}[0]
+	if plan.settled && s.loyalty != nil {
+		refundedTotal, totalPaid := plan.refundedTotal, plan.totalPaid
+		s.followUp(ctx, "reverse_customer_history", order, func(ctx context.Context) error {
+			return s.reverseCustomerHistory(ctx, order.ID, refundedTotal/totalPaid, func(ctx context.Context, order *domain.Order) error {
+				return s.loyalty.ReverseForRefund(ctx, order, refundedTotal, totalPaid)
+			})
+		})
+	}
 
-	if err := s.paymentRepo.Update(ctx, transaction); err != nil {
-		return nil, fmt.Errorf("failed to update payment transaction: %w", err)
+	return refundTransaction, nil
+}
+
+// planRefund works out what a refund request returns and checks it against the
+// refundable balance. The caller holds the lock on the order and its payments.
+func (s *OrderService) planRefund(ctx context.Context, order *domain.Order, transactions []*domain.PaymentTransaction, req domain.RefundRequest) (*refundPlan, error) {
+	switch order.PaymentStatus {
+	case domain.PaymentStatusPaid, domain.PaymentStatusPartiallyRefunded, domain.PaymentStatusPartiallyPaid:
+	default:
+		return nil, errors.New("order is not paid")
+	}
+	plan := &refundPlan{
+		restock: make(map[uuid.UUID]int),
+		lines:   make([]map[string]interface{}, 0, len(req.Items)),
+		// Refunding a tender of an order that was never fully paid only reopens its balance
+		settled: order.PaymentStatus != domain.PaymentStatusPartiallyPaid,
 	}
 
-	// Update order payment status
-	order.PaymentStatus = domain.PaymentStatusPaid
-	order.PaymentMethod = paymentData.Method
-	order.PaymentMethodTitle = paymentData.MethodTitle
-	order.TransactionID = paymentData.TransactionID
-	order.DatePaid = &[]time.Time{time.Now()}[0]
-	order.DateModified = time.Now()
+	// Work out the amount owed for each selected line
+	orderItems, err := s.orderItemRepo.GetByOrderID(ctx, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order items: %w", err)
+	}
+	itemsByID := make(map[uuid.UUID]*domain.OrderItem, len(orderItems))
+	for _, item := range orderItems {
+		itemsByID[item.ID] = item
+	}
 
-	if err := s.orderRepo.Update(ctx, order); err != nil {
-		return nil, fmt.Errorf("failed to update order payment status: %w", err)
+	pricesIncludeTax := metadataBool(order.Metadata, "prices_include_tax")
+	amount := req.Amount
+	for _, line := range req.Items {
+		item, ok := itemsByID[line.OrderItemID]
+		if !ok {
+			return nil, fmt.Errorf("order item %s does not belong to this order", line.OrderItemID)
+		}
+		if line.Quantity <= 0 {
+			return nil, fmt.Errorf("refund quantity for %s must be positive", item.ProductName)
+		}
+
+		alreadyRefunded := metadataInt(item.Metadata, "refunded_quantity")
+		if alreadyRefunded+line.Quantity > item.Quantity {
+			return nil, fmt.Errorf("cannot refund %d of %s: only %d not yet refunded", line.Quantity, item.ProductName, item.Quantity-alreadyRefunded)
+		}
+
+		// Refund what the customer actually paid for the line: net of its discount
+		// share and including any tax charged on top of the price
+		linePaid := item.TotalPrice - metadataFloat(item.Metadata, itemMetadataDiscountTotal)
+		if !pricesIncludeTax {
+			linePaid += item.TaxTotal
+		}
+		lineAmount := roundCurrency(linePaid / float64(item.Quantity) * float64(line.Quantity))
+		amount += lineAmount
+		if line.Restock {
+			plan.restock[item.ID] += line.Quantity
+		}
+		plan.lines = append(plan.lines, map[string]interface{}{
+			"order_item_id": item.ID,
+			"quantity":      line.Quantity,
+			"amount":        lineAmount,
+			"restock":       line.Restock,
+		})
 	}
 
-	// Generate receipt
-	if err := s.generateReceipt(ctx, order); err != nil {
-		// Log error but don't fail payment processing
-		// TODO: Add proper logging
+	if req.RefundShipping {
+		if metadataBool(order.Metadata, "shipping_refunded") {
+			return nil, errors.New("shipping has already been refunded")
+		}
+		amount += order.ShippingTotal
+		if !pricesIncludeTax {
+			for _, taxLine := range orderTaxLines(order.Metadata["shipping_tax_lines"]) {
+				amount += taxLine.Amount
+			}
+		}
 	}
+	plan.amount = roundCurrency(amount)
 
-	return transaction, nil
+	if plan.amount <= 0 {
+		return nil, errors.New("refund amount must be positive")
+	}
+
+	totalPaid, totalRefunded, remaining := summarizeRefundable(transactions)
+	if totalPaid <= 0 {
+		return nil, errors.New("no refundable transactions found")
+	}
+	if plan.amount > roundCurrency(totalPaid-totalRefunded) {
+		return nil, fmt.Errorf("refund amount exceeds refundable amount: %.2f", totalPaid-totalRefunded)
+	}
+	plan.totalPaid = totalPaid
+	plan.remaining = remaining
+	plan.refundedTotal = roundCurrency(totalRefunded + plan.amount)
+
+	if err := s.checkRegisterSession(ctx, order.TenantID, req.RegisterSessionID); err != nil {
+		return nil, err
+	}
+
+	plan.refundType = domain.TransactionTypePartialRefund
+	if plan.refundedTotal >= totalPaid {
+		plan.refundType = domain.TransactionTypeRefund
+	}
+	return plan, nil
 }
 
-// RefundOrder processes a refund for an order
-func (s *OrderService) RefundOrder(ctx context.Context, orderID uuid.UUID, amount float64, reason string, userID *uuid.UUID) (*domain.PaymentTransaction, error) {
-	order, err := s.orderRepo.GetByID(ctx, orderID)
+// applyRefund records a refund that has gone through on the order and its lines.
+// The caller holds the lock on the order.
+func (s *OrderService) applyRefund(ctx context.Context, order *domain.Order, req domain.RefundRequest, plan *refundPlan, refundTransaction *domain.PaymentTransaction) error {
+	now := time.Now()
+
+	orderItems, err := s.orderItemRepo.GetByOrderID(ctx, order.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order: %w", err)
+		return fmt.Errorf("failed to get order items: %w", err)
+	}
+	itemsByID := make(map[uuid.UUID]*domain.OrderItem, len(orderItems))
+	for _, item := range orderItems {
+		itemsByID[item.ID] = item
 	}
 
-	if order.PaymentStatus != domain.PaymentStatusPaid {
-		return nil, errors.New("order is not paid")
+	// Record refunded quantities so lines cannot be refunded twice
+	for _, line := range req.Items {
+		item, ok := itemsByID[line.OrderItemID]
+		if !ok {
+			return fmt.Errorf("order item %s does not belong to this order", line.OrderItemID)
+		}
+		if item.Metadata == nil {
+			item.Metadata = make(map[string]interface{})
+		}
+		item.Metadata["refunded_quantity"] = metadataInt(item.Metadata, "refunded_quantity") + line.Quantity
+		if err := s.orderItemRepo.Update(ctx, item); err != nil {
+			return fmt.Errorf("failed to update order item: %w", err)
+		}
 	}
 
-	// Get refundable transactions
-	refundableTransactions, err := s.paymentRepo.GetRefundableTransactions(ctx, orderID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get refundable transactions: %w", err)
+	// Update order payment status and keep a refund history on the order
+	if order.Metadata == nil {
+		order.Metadata = make(map[string]interface{})
+	}
+	if req.RefundShipping {
+		order.Metadata["shipping_refunded"] = true
+	}
+	refunds, _ := order.Metadata["refunds"].([]interface{})
+	order.Metadata["refunds"] = append(refunds, map[string]interface{}{
+		"transaction_id": refundTransaction.ID,
+		"amount":         plan.amount,
+		"reason":         req.Reason,
+		"items":          plan.lines,
+		"shipping":       req.RefundShipping,
+		"refunded_at":    now,
+	})
+
+	fullyRefunded := plan.refundType == domain.TransactionTypeRefund
+	newStatus := domain.OrderStatusPartiallyRefunded
+	switch {
+	case !plan.settled && fullyRefunded:
+		order.PaymentStatus = domain.PaymentStatusPending
+	case !plan.settled:
+		order.PaymentStatus = domain.PaymentStatusPartiallyPaid
+	case fullyRefunded:
+		order.PaymentStatus = domain.PaymentStatusRefunded
+		newStatus = domain.OrderStatusRefunded
+	default:
+		order.PaymentStatus = domain.PaymentStatusPartiallyRefunded
+	}
+	if plan.settled && order.Status != newStatus && s.isValidStatusTransition(order.Status, newStatus) {
+		order.Status = newStatus
 	}
+	order.DateModified = now
 
-	if len(refundableTransactions) == 0 {
-		return nil, errors.New("no refundable transactions found")
+	if err := s.orderRepo.Update(ctx, order); err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
 	}
+	return nil
+}
 
-	// Calculate total refundable amount
-	var totalRefundable float64
-	for _, tx := range refundableTransactions {
-		if tx.Type == domain.TransactionTypePayment {
-			totalRefundable += tx.Amount
+// refundToPayment builds the pending refund that returns plan's amount to one of
+// the order's payments through the gateway that took it: the payment named in
+// the request, or else the first that can cover the whole amount
+func (s *OrderService) refundToPayment(order *domain.Order, plan *refundPlan, req domain.RefundRequest, transactions []*domain.PaymentTransaction) (*domain.PaymentTransaction, error) {
+	var parent *domain.PaymentTransaction
+	for _, tx := range transactions {
+		if !isSettledPayment(tx) || (req.TransactionID != nil && tx.ID != *req.TransactionID) {
+			continue
+		}
+		if plan.remaining[tx.ID] >= plan.amount {
+			parent = tx
+			break
+		}
+		if req.TransactionID != nil {
+			return nil, fmt.Errorf("refund amount exceeds the refundable balance of the payment: %.2f", plan.remaining[tx.ID])
 		}
 	}
+	if parent == nil {
+		if req.TransactionID != nil {
+			return nil, fmt.Errorf("payment %s cannot be refunded on this order", *req.TransactionID)
+		}
+		return nil, errors.New("refund amount exceeds the balance of any single payment")
+	}
 
-	if amount > totalRefundable {
-		return nil, fmt.Errorf("refund amount exceeds refundable amount: %.2f", totalRefundable)
+	if _, err := s.gateways.Get(parent.PaymentGateway); err != nil {
+		return nil, err
 	}
 
-	// Create refund transaction
-	refundTransaction := &domain.PaymentTransaction{
+	return &domain.PaymentTransaction{
 		TenantID:            order.TenantID,
-		OrderID:             orderID,
+		OrderID:             order.ID,
 		TransactionID:       generateRefundTransactionID(),
-		PaymentGateway:      refundableTransactions[0].PaymentGateway,
-		PaymentMethod:       refundableTransactions[0].PaymentMethod,
-		Amount:              amount,
+		PaymentGateway:      parent.PaymentGateway,
+		PaymentMethod:       parent.PaymentMethod,
+		Amount:              plan.amount,
 		Currency:            order.Currency,
-		Status:              domain.TransactionStatusCompleted,
-		Type:                domain.TransactionTypeRefund,
-		ParentTransactionID: &refundableTransactions[0].ID,
-		ProcessedAt:         &[]time.Time{time.Now()}[0],
+		Status:              domain.TransactionStatusPending,
+		Type:                plan.refundType,
+		ParentTransactionID: &parent.ID,
+		RegisterSessionID:   req.RegisterSessionID,
+	}, nil
+}
+
+// refundToStoreCredit issues amount as store credit to the order's customer
+// instead of returning the money. The refund is recorded against no payment
+func (s *OrderService) refundToStoreCredit(ctx context.Context, order *domain.Order, amount float64, refundType string, req domain.RefundRequest, userID *uuid.UUID) (*domain.PaymentTransaction, error) {
+	if s.giftCards == nil {
+		return nil, errors.New("store credit is not supported")
 	}
 
-	if err := s.paymentRepo.Create(ctx, refundTransaction); err != nil {
-		return nil, fmt.Errorf("failed to create refund transaction: %w", err)
+	reason := req.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("refund of order %s", order.OrderNumber)
 	}
 
-	// Update order payment status
-	if amount >= order.Total {
-		order.PaymentStatus = domain.PaymentStatusRefunded
-		order.Status = domain.OrderStatusRefunded
-	} else {
-		order.PaymentStatus = domain.PaymentStatusPartiallyRefunded
+	var refundTransaction *domain.PaymentTransaction
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		card, entry, err := s.giftCards.IssueStoreCredit(ctx, order.TenantID, order.CustomerID, amount, order.Currency, &order.ID, reason, userID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		refundTransaction = &domain.PaymentTransaction{
+			TenantID:       order.TenantID,
+			OrderID:        order.ID,
+			TransactionID:  entry.ID.String(),
+			PaymentGateway: domain.PaymentMethodGiftCard,
+			PaymentMethod:  domain.PaymentMethodStoreCredit,
+			Amount:         amount,
+			Currency:       order.Currency,
+			NetAmount:      amount,
+			Status:         domain.TransactionStatusCompleted,
+			Type:           refundType,
+			GatewayResponse: map[string]interface{}{
+				"gift_card_id": card.ID,
+				"code":         card.Code,
+				"balance":      card.Balance,
+			},
+			RegisterSessionID: req.RegisterSessionID,
+			ProcessedAt:       &now,
+		}
+		if err := s.paymentRepo.Create(ctx, refundTransaction); err != nil {
+			return fmt.Errorf("failed to create refund transaction: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	order.DateModified = time.Now()
+
+	return refundTransaction, nil
+}
+
+// Helper methods
+
+// paymentAmount works out how much a tender takes: the amount asked for, or
+// the whole balance due when none is given. The caller holds the lock on the
+// order, so the balance cannot change under it.
+func (s *OrderService) paymentAmount(ctx context.Context, order *domain.Order, requested float64) (float64, error) {
+	paid, err := s.amountPaid(ctx, order.ID)
+	if err != nil {
+		return 0, err
+	}
+	due := roundCurrency(order.Total - paid)
+	if due <= 0 {
+		return 0, errors.New("order has no balance due")
+	}
+
+	amount := roundCurrency(requested)
+	switch {
+	case amount == 0:
+		return due, nil
+	case amount < 0:
+		return 0, errors.New("payment amount must be positive")
+	case amount > due:
+		return 0, fmt.Errorf("payment amount exceeds the balance due: %.2f", due)
+	}
+	return amount, nil
+}
+
+// amountPaid totals an order's settled payments, net of refunds
+func (s *OrderService) amountPaid(ctx context.Context, orderID uuid.UUID) (float64, error) {
+	transactions, err := s.paymentRepo.GetByOrderID(ctx, orderID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get payment transactions: %w", err)
+	}
+	paid, refunded, _ := summarizeRefundable(transactions)
+	return roundCurrency(paid - refunded), nil
+}
+
+// settleOrder brings the order's payment status up to date after a payment has
+// settled. The order is paid once its payments cover the total; the caller
+// then passes it to completePaidOrder.
+func (s *OrderService) settleOrder(ctx context.Context, order *domain.Order, transaction *domain.PaymentTransaction, now time.Time) error {
+	paid, err := s.amountPaid(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	fullyPaid := paid >= order.Total
+	order.PaymentStatus = domain.PaymentStatusPartiallyPaid
+	if fullyPaid {
+		order.PaymentStatus = domain.PaymentStatusPaid
+		order.DatePaid = &now
+		// Committed with the payment, so the sweep finds the order if
+		// completePaidOrder never gets to record it
+		if order.CustomerID != nil && s.loyalty != nil {
+			if order.Metadata == nil {
+				order.Metadata = make(map[string]interface{})
+			}
+			order.Metadata[orderMetadataCustomerRecorded] = false
+		}
+	}
+	order.TransactionID = transaction.TransactionID
+	order.DateModified = now
 
 	if err := s.orderRepo.Update(ctx, order); err != nil {
-		return nil, fmt.Errorf("failed to update order status: %w", err)
+		return fmt.Errorf("failed to update order payment status: %w", err)
 	}
 
-	// Restore inventory if full refund
-	if amount >= order.Total {
-		if err := s.restoreInventoryFromOrder(ctx, order, userID); err != nil {
-			// Log error but don't fail refund
-			// TODO: Add proper logging
+	return nil
+}
+
+// completePaidOrder records a fully paid order against its customer and issues
+// its receipt. It runs once the payment is committed, and failures here leave
+// the payment in place.
+func (s *OrderService) completePaidOrder(ctx context.Context, order *domain.Order) {
+	if order.PaymentStatus != domain.PaymentStatusPaid {
+		return
+	}
+
+	s.followUp(ctx, "record_paid_order", order, func(ctx context.Context) error {
+		return s.recordPaidOrder(ctx, order.ID)
+	})
+
+	// Generate receipt
+	if err := s.generateReceipt(ctx, order); err != nil {
+		s.logger.Error("failed to generate receipt", zap.String("tenant_id", order.TenantID), zap.String("order_id", order.ID.String()), zap.Error(err))
+	}
+}
+
+// setOrderPaymentMethod records how an order was paid. An order paid with more
+// than one method is marked as split tender
+func setOrderPaymentMethod(order *domain.Order, method, title string) {
+	if order.PaymentStatus != domain.PaymentStatusPartiallyPaid || order.PaymentMethod == "" || order.PaymentMethod == method {
+		order.PaymentMethod = method
+		order.PaymentMethodTitle = title
+		return
+	}
+	order.PaymentMethod = domain.PaymentMethodSplit
+	order.PaymentMethodTitle = "Split tender"
+}
+
+// withOrderIdempotency runs fn under the idempotency key carried by ctx, scoped
+// to the order's tenant. Without a key it simply runs fn.
+func (s *OrderService) withOrderIdempotency(ctx context.Context, orderID uuid.UUID, scope string, payload interface{}, out interface{}, fn func() (interface{}, error)) error {
+	key := IdempotencyKeyFromContext(ctx)
+	if key == "" || s.idempotency == nil {
+		_, err := fn()
+		return err
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to get order: %w", err)
+	}
+
+	request := map[string]interface{}{"order_id": orderID, "request": payload}
+	return s.idempotency.Do(ctx, order.TenantID, scope, key, request, out, fn)
+}
+
+// checkRegisterSession makes sure money is only put through an open register
+// session. Payments taken outside a register carry no session. It must run in
+// the transaction that records the money, which keeps the session from closing
+// until that transaction ends.
+func (s *OrderService) checkRegisterSession(ctx context.Context, tenantID string, sessionID *uuid.UUID) error {
+	if sessionID == nil {
+		return nil
+	}
+	if s.registers == nil {
+		return errors.New("register sessions are not supported")
+	}
+	_, err := s.registers.ShareOpenSession(ctx, tenantID, *sessionID)
+	return err
+}
+
+// gatewayCall is a gateway operation made for an order. reserve checks it
+// against the locked order and its transactions and returns the pending
+// transaction that records it, call makes it under the given idempotency key,
+// and record saves the outcome on the transaction, which callGateway has locked
+// again along with the order.
+type gatewayCall struct {
+	scope   string
+	reserve func(ctx context.Context, order *domain.Order, transactions []*domain.PaymentTransaction) (*domain.PaymentTransaction, error)
+	call    func(ctx context.Context, transaction *domain.PaymentTransaction, idempotencyKey string) (*PaymentGatewayResult, error)
+	record  func(ctx context.Context, order *domain.Order, transaction *domain.PaymentTransaction, result *PaymentGatewayResult, gatewayErr error) error
+}
+
+// callGateway makes a gateway call without holding the order's lock over the
+// network: the pending transaction is committed first, the gateway is called,
+// and the outcome is recorded in a second transaction. While a call is pending
+// no other call can be made for the order; a retry carrying the same
+// idempotency key picks up a call that was never recorded.
+func (s *OrderService) callGateway(ctx context.Context, orderID uuid.UUID, op gatewayCall) (*domain.PaymentTransaction, error) {
+	var transaction *domain.PaymentTransaction
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		order, transactions, err := s.lockOrderPayments(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		if transaction, err = op.reserve(ctx, order, transactions); err != nil {
+			return err
+		}
+
+		key := gatewayIdempotencyKey(ctx, op.scope, transaction)
+		retry := IdempotencyKeyFromContext(ctx) != ""
+		now := time.Now()
+		for _, tx := range transactions {
+			if tx.Status != domain.TransactionStatusPending {
+				continue
+			}
+			if retry && tx.GatewayResponse[gatewayResponseIdempotencyKey] == key {
+				transaction = tx
+				return nil
+			}
+			if isInFlight(tx, now) {
+				return ErrPaymentInProgress
+			}
+		}
+
+		if retry {
+			response := make(map[string]interface{}, len(transaction.GatewayResponse)+1)
+			for k, v := range transaction.GatewayResponse {
+				response[k] = v
+			}
+			response[gatewayResponseIdempotencyKey] = key
+			transaction.GatewayResponse = response
+		}
+		if err := s.paymentRepo.Create(ctx, transaction); err != nil {
+			return fmt.Errorf("failed to create %s transaction: %w", transaction.Type, err)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return refundTransaction, nil
+	result, gatewayErr := op.call(ctx, transaction, gatewayIdempotencyKey(ctx, op.scope, transaction))
+
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		order, transactions, err := s.lockOrderPayments(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		var current *domain.PaymentTransaction
+		for _, tx := range transactions {
+			if tx.ID == transaction.ID {
+				current = tx
+			}
+		}
+		if current == nil || current.Status != domain.TransactionStatusPending {
+			return fmt.Errorf("%s transaction %s has already been recorded", transaction.Type, transaction.ID)
+		}
+
+		now := time.Now()
+		current.ProcessedAt = &now
+		transaction = current
+		return op.record(ctx, order, current, result, gatewayErr)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
 }
 
-// Helper methods
+// lockOrderPayments locks an order and its payment transactions
+func (s *OrderService) lockOrderPayments(ctx context.Context, orderID uuid.UUID) (*domain.Order, []*domain.PaymentTransaction, error) {
+	order, err := s.orderRepo.GetByIDForUpdate(ctx, orderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	transactions, err := s.paymentRepo.GetByOrderIDForUpdate(ctx, orderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get payment transactions: %w", err)
+	}
+	return order, transactions, nil
+}
 
+// handleOrderCancellation gives the customer back what they paid towards the
+// order and returns its lines to stock. Open holds are voided and every tender
+// is refunded through the gateway that took it; a tender that cannot be
+// refunded stops the cancellation, and cancelling again picks up from there.
 func (s *OrderService) handleOrderCancellation(ctx context.Context, order *domain.Order, userID *uuid.UUID) error {
-	// Restore inventory
-	return s.restoreInventoryFromOrder(ctx, order, userID)
+	transactions, err := s.paymentRepo.GetByOrderID(ctx, order.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get payment transactions: %w", err)
+	}
+
+	_, _, remaining := summarizeRefundable(transactions)
+	for _, tx := range transactions {
+		switch {
+		case tx.Type == domain.TransactionTypeAuthorization && tx.Status == domain.TransactionStatusAuthorized:
+			if _, err := s.VoidAuthorization(ctx, tx.ID, "order cancelled"); err != nil {
+				return fmt.Errorf("failed to void authorization %s: %w", tx.ID, err)
+			}
+		case isSettledPayment(tx) && remaining[tx.ID] > 0:
+			tender := tx.ID
+			_, err := s.refundOrder(ctx, order.ID, domain.RefundRequest{
+				Amount:        remaining[tx.ID],
+				Reason:        "Order cancelled",
+				TransactionID: &tender,
+			}, userID)
+			if err != nil {
+				return fmt.Errorf("failed to refund payment %s: %w", tx.ID, err)
+			}
+		}
+	}
+
+	// Restore inventory, leaving out units refunds have already put back
+	orderItems, err := s.orderItemRepo.GetByOrderID(ctx, order.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get order items: %w", err)
+	}
+	restocked := restockedQuantities(order)
+	quantities := make(map[uuid.UUID]int, len(orderItems))
+	for _, item := range orderItems {
+		quantities[item.ID] = item.Quantity - restocked[item.ID]
+	}
+	return s.restoreInventoryFromOrder(ctx, order, quantities, userID)
+}
+
+// restockedQuantities totals the units of each order item that the refunds
+// recorded on the order returned to stock
+func restockedQuantities(order *domain.Order) map[uuid.UUID]int {
+	restocked := make(map[uuid.UUID]int)
+	refunds, _ := order.Metadata["refunds"].([]interface{})
+	for _, refund := range refunds {
+		entry, _ := refund.(map[string]interface{})
+		// Lines are maps when the order was just refunded and decoded jsonb after a reload
+		var lines []map[string]interface{}
+		switch items := entry["items"].(type) {
+		case []map[string]interface{}:
+			lines = items
+		case []interface{}:
+			for _, item := range items {
+				if line, ok := item.(map[string]interface{}); ok {
+					lines = append(lines, line)
+				}
+			}
+		}
+
+		for _, line := range lines {
+			if !metadataBool(line, "restock") {
+				continue
+			}
+			itemID, err := uuid.Parse(fmt.Sprint(line["order_item_id"]))
+			if err != nil {
+				continue
+			}
+			restocked[itemID] += metadataInt(line, "quantity")
+		}
+	}
+	return restocked
 }
 
-func (s *OrderService) restoreInventoryFromOrder(ctx context.Context, order *domain.Order, userID *uuid.UUID) error {
+// failPayment records a declined or errored gateway call on both the transaction and the order
+func (s *OrderService) failPayment(ctx context.Context, order *domain.Order, transaction *domain.PaymentTransaction, reason string) error {
+	transaction.Status = domain.TransactionStatusFailed
+	transaction.FailureReason = reason
+	transaction.Fee = 0
+	transaction.NetAmount = 0
+
+	if err := s.paymentRepo.Update(ctx, transaction); err != nil {
+		return fmt.Errorf("failed to update payment transaction: %w", err)
+	}
+
+	// A declined tender leaves what other tenders paid in place
+	if order.PaymentStatus != domain.PaymentStatusPartiallyPaid {
+		order.PaymentStatus = domain.PaymentStatusFailed
+	}
+	order.DateModified = time.Now()
+
+	if err := s.orderRepo.Update(ctx, order); err != nil {
+		return fmt.Errorf("failed to update order payment status: %w", err)
+	}
+
+	return nil
+}
+
+// restoreInventoryFromOrder returns order lines to stock. quantities maps order
+// item IDs to the number of units to restock; nil restocks every line in full.
+func (s *OrderService) restoreInventoryFromOrder(ctx context.Context, order *domain.Order, quantities map[uuid.UUID]int, userID *uuid.UUID) error {
 	orderItems, err := s.orderItemRepo.GetByOrderID(ctx, order.ID)
 	if err != nil {
 		return fmt.Errorf("failed to get order items: %w", err)
 	}
 
 	for _, item := range orderItems {
+		quantity := item.Quantity
+		if quantities != nil {
+			quantity = quantities[item.ID]
+		}
+		if quantity <= 0 {
+			continue
+		}
+
+		// Return stock to the location the order was fulfilled from
+		if order.LocationID != nil && s.inventory != nil {
+			err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+				return s.inventory.moveStock(ctx, stockMovement{
+					TenantID:      order.TenantID,
+					LocationID:    *order.LocationID,
+					ProductID:     item.ProductID,
+					VariationID:   item.VariationID,
+					Quantity:      quantity,
+					Type:          domain.InventoryTypeReturn,
+					Reason:        fmt.Sprintf("Order cancellation/refund - Order %s", order.OrderNumber),
+					ReferenceID:   &order.ID,
+					ReferenceType: "order_cancellation",
+					UserID:        userID,
+				})
+			})
+			if err != nil {
+				// Log error but keep restocking the other lines
+				s.logger.Error("failed to restock order line", zap.String("tenant_id", order.TenantID), zap.String("order_id", order.ID.String()), zap.String("product_id", item.ProductID.String()), zap.Int("quantity", quantity), zap.Error(err))
+			}
+			continue
+		}
+
 		product, err := s.productRepo.GetByID(ctx, item.ProductID)
 		if err != nil {
 			continue // Skip if product not found
 		}
 
+		var variation *domain.ProductVariation
+		if item.VariationID != nil && s.variationRepo != nil {
+			variation, err = s.variationRepo.GetByID(ctx, *item.VariationID)
+			if err != nil {
+				continue // Skip if variation not found
+			}
+		}
+
 		if product.ManageStock {
-			newStock := product.StockQuantity + item.Quantity
-			if err := s.productRepo.UpdateStock(ctx, product.ID, newStock); err != nil {
+			stockBefore := availableStockFor(product, variation)
+			newStock := stockBefore + quantity
+			if variation != nil {
+				err = s.variationRepo.UpdateStock(ctx, variation.ID, newStock)
+			} else {
+				err = s.productRepo.UpdateStock(ctx, product.ID, newStock)
+			}
+			if err != nil {
 				continue // Skip on error
 			}
 
@@ -368,14 +1449,14 @@ func (s *OrderService) restoreInventoryFromOrder(ctx context.Context, order *dom
 				ProductID:      product.ID,
 				VariationID:    item.VariationID,
 				Type:           domain.InventoryTypeReturn,
-				Quantity:       item.Quantity,
-				QuantityBefore: product.StockQuantity,
+				Quantity:       quantity,
+				QuantityBefore: stockBefore,
 				QuantityAfter:  newStock,
 				Reason:         fmt.Sprintf("Order cancellation/refund - Order %s", order.OrderNumber),
 				ReferenceID:    &order.ID,
 				ReferenceType:  "order_cancellation",
-				CostPerUnit:    product.CostPrice,
-				TotalCost:      product.CostPrice * float64(item.Quantity),
+				CostPerUnit:    costPriceFor(product, variation),
+				TotalCost:      costPriceFor(product, variation) * float64(quantity),
 				UserID:         userID,
 			}
 
@@ -386,6 +1467,23 @@ func (s *OrderService) restoreInventoryFromOrder(ctx context.Context, order *dom
 	return nil
 }
 
+// lockVariation locks a variation row and checks it belongs to the product
+func (s *OrderService) lockVariation(ctx context.Context, product *domain.Product, variationID uuid.UUID) (*domain.ProductVariation, error) {
+	if s.variationRepo == nil {
+		return nil, errors.New("product variations are not supported")
+	}
+
+	variation, err := s.variationRepo.GetByIDForUpdate(ctx, variationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product variation %s: %w", variationID, err)
+	}
+	if variation.ProductID != product.ID {
+		return nil, fmt.Errorf("variation %s does not belong to %s", variationID, product.Name)
+	}
+
+	return variation, nil
+}
+
 func (s *OrderService) generateReceipt(ctx context.Context, order *domain.Order) error {
 	receiptNumber, err := s.receiptRepo.GenerateReceiptNumber(ctx, order.TenantID)
 	if err != nil {
@@ -398,11 +1496,20 @@ func (s *OrderService) generateReceipt(ctx context.Context, order *domain.Order)
 		return fmt.Errorf("failed to get order items: %w", err)
 	}
 
+	// Summarize taxes by rate for the receipt footer
+	taxGroups := make([][]domain.TaxLine, 0, len(orderItems)+1)
+	for _, item := range orderItems {
+		taxGroups = append(taxGroups, item.TaxLines)
+	}
+	taxGroups = append(taxGroups, orderTaxLines(order.Metadata["shipping_tax_lines"]))
+
 	// Prepare receipt data
 	receiptData := map[string]interface{}{
-		"order":        order,
-		"items":        orderItems,
-		"generated_at": time.Now(),
+		"order":              order,
+		"items":              orderItems,
+		"tax_summary":        summarizeTaxLines(taxGroups...),
+		"prices_include_tax": metadataBool(order.Metadata, "prices_include_tax"),
+		"generated_at":       time.Now(),
 	}
 
 	receipt := &domain.Receipt{
@@ -413,17 +1520,37 @@ func (s *OrderService) generateReceipt(ctx context.Context, order *domain.Order)
 		EmailRecipient: order.CustomerEmail,
 	}
 
-	return s.receiptRepo.Create(ctx, receipt)
+	if s.receipts != nil {
+		if err := s.receipts.Attach(ctx, receipt, order, orderItems); err != nil {
+			// Keep the receipt data; HTML and PDF can be rendered again on reprint
+			s.logger.Error("failed to render receipt", zap.String("tenant_id", order.TenantID), zap.String("order_id", order.ID.String()), zap.String("receipt_number", receiptNumber), zap.Error(err))
+		}
+	}
+
+	if err := s.receiptRepo.Create(ctx, receipt); err != nil {
+		return err
+	}
+
+	// Queue the receipt email once it is saved; the mail retry queue sends it
+	if s.receipts != nil && receipt.EmailRecipient != "" {
+		if err := s.receipts.Email(ctx, receipt, order, orderItems); err != nil {
+			// Log error but don't fail payment
+			s.logger.Error("failed to queue receipt email", zap.String("tenant_id", order.TenantID), zap.String("order_id", order.ID.String()), zap.String("receipt_number", receiptNumber), zap.Error(err))
+		}
+	}
+
+	return nil
 }
 
 func (s *OrderService) isValidStatusTransition(currentStatus, newStatus string) bool {
 	validTransitions := map[string][]string{
-		domain.OrderStatusPending:    {domain.OrderStatusProcessing, domain.OrderStatusCancelled},
-		domain.OrderStatusProcessing: {domain.OrderStatusShipped, domain.OrderStatusCancelled},
-		domain.OrderStatusShipped:    {domain.OrderStatusDelivered},
-		domain.OrderStatusDelivered:  {domain.OrderStatusRefunded},
-		domain.OrderStatusCancelled:  {}, // Terminal state
-		domain.OrderStatusRefunded:   {}, // Terminal state
+		domain.OrderStatusPending:           {domain.OrderStatusProcessing, domain.OrderStatusCancelled, domain.OrderStatusPartiallyRefunded, domain.OrderStatusRefunded},
+		domain.OrderStatusProcessing:        {domain.OrderStatusShipped, domain.OrderStatusCancelled, domain.OrderStatusPartiallyRefunded, domain.OrderStatusRefunded},
+		domain.OrderStatusShipped:           {domain.OrderStatusDelivered, domain.OrderStatusPartiallyRefunded, domain.OrderStatusRefunded},
+		domain.OrderStatusDelivered:         {domain.OrderStatusPartiallyRefunded, domain.OrderStatusRefunded},
+		domain.OrderStatusPartiallyRefunded: {domain.OrderStatusRefunded},
+		domain.OrderStatusCancelled:         {}, // Terminal state
+		domain.OrderStatusRefunded:          {}, // Terminal state
 	}
 
 	allowedStatuses, exists := validTransitions[currentStatus]
@@ -440,6 +1567,113 @@ func (s *OrderService) isValidStatusTransition(currentStatus, newStatus string)
 	return false
 }
 
+// isInFlight reports whether tx records a gateway call that is yet to be
+// recorded. A call still pending after gatewayCallTimeout was abandoned by a
+// request that died and no longer holds anything up.
+func isInFlight(tx *domain.PaymentTransaction, now time.Time) bool {
+	return tx.Status == domain.TransactionStatusPending && now.Sub(tx.CreatedAt) < gatewayCallTimeout
+}
+
+// isSettledPayment reports whether a transaction moved money from the customer
+func isSettledPayment(tx *domain.PaymentTransaction) bool {
+	return (tx.Type == domain.TransactionTypePayment || tx.Type == domain.TransactionTypeCapture) &&
+		tx.Status == domain.TransactionStatusCompleted
+}
+
+// isRefund reports whether a transaction returned money to the customer
+func isRefund(tx *domain.PaymentTransaction) bool {
+	return (tx.Type == domain.TransactionTypeRefund || tx.Type == domain.TransactionTypePartialRefund) &&
+		tx.Status == domain.TransactionStatusCompleted
+}
+
+// summarizeRefundable totals settled payments and completed refunds, and returns
+// the balance still refundable on each payment keyed by transaction ID
+func summarizeRefundable(transactions []*domain.PaymentTransaction) (float64, float64, map[uuid.UUID]float64) {
+	var totalPaid, totalRefunded float64
+	remaining := make(map[uuid.UUID]float64)
+
+	for _, tx := range transactions {
+		if isSettledPayment(tx) {
+			totalPaid += tx.Amount
+			remaining[tx.ID] += tx.Amount
+		}
+	}
+	for _, tx := range transactions {
+		if isRefund(tx) {
+			totalRefunded += tx.Amount
+			if tx.ParentTransactionID != nil {
+				remaining[*tx.ParentTransactionID] -= tx.Amount
+			}
+		}
+	}
+	for id, balance := range remaining {
+		remaining[id] = roundCurrency(balance)
+	}
+
+	return roundCurrency(totalPaid), roundCurrency(totalRefunded), remaining
+}
+
+func metadataInt(metadata map[string]interface{}, key string) int {
+	switch value := metadata[key].(type) {
+	case int:
+		return value
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	}
+	return 0
+}
+
+// orderTaxLines decodes tax lines stored in order metadata, which may have been
+// round-tripped through jsonb
+func orderTaxLines(value interface{}) []domain.TaxLine {
+	if lines, ok := value.([]domain.TaxLine); ok {
+		return lines
+	}
+	if value == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var lines []domain.TaxLine
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return nil
+	}
+	return lines
+}
+
+// stockKey identifies the row that holds stock for a line: the variation when
+// there is one, otherwise the product
+func stockKey(productID uuid.UUID, variationID *uuid.UUID) uuid.UUID {
+	if variationID != nil {
+		return *variationID
+	}
+	return productID
+}
+
+func metadataBool(metadata map[string]interface{}, key string) bool {
+	value, _ := metadata[key].(bool)
+	return value
+}
+
+// gatewayIdempotencyKey keys a gateway call on the caller's idempotency key when
+// the request carries one, so a retry after a crash reaches the same charge, and
+// otherwise on the transaction recording the call. Calls against a parent
+// transaction, such as refunds of different tenders, are keyed on it as well.
+func gatewayIdempotencyKey(ctx context.Context, scope string, transaction *domain.PaymentTransaction) string {
+	if key := IdempotencyKeyFromContext(ctx); key != "" {
+		if transaction.ParentTransactionID != nil {
+			scope += ":" + transaction.ParentTransactionID.String()
+		}
+		return fmt.Sprintf("%s:%s:%s:%s", transaction.TenantID, transaction.OrderID, scope, key)
+	}
+	return transaction.ID.String()
+}
+
 func generateRefundTransactionID() string {
 	return fmt.Sprintf("refund_%d_%s", time.Now().Unix(), uuid.New().String()[:8])
 }
@@ -0,0 +1,393 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+type memTxKey struct{}
+
+// memTx stands in for a database transaction: rows it locks stay locked until
+// it ends, and its writes are undone when it rolls back
+type memTx struct {
+	held  map[uuid.UUID]bool
+	locks []*sync.Mutex
+	undo  []func()
+}
+
+// memStore is an in-memory database for the order service's repositories. It
+// gives SELECT ... FOR UPDATE semantics through per-row locks, so checkouts
+// race the way they would against PostgreSQL.
+type memStore struct {
+	mu        sync.Mutex
+	rowLocks  map[uuid.UUID]*sync.Mutex
+	products  map[uuid.UUID]*domain.Product
+	carts     map[uuid.UUID]*domain.Cart
+	cartItems map[uuid.UUID][]*domain.CartItem
+	orders    map[uuid.UUID]*domain.Order
+	logs      []*domain.InventoryLog
+	stock     []int // Every stock level written by UpdateStock, in order
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		rowLocks:  make(map[uuid.UUID]*sync.Mutex),
+		products:  make(map[uuid.UUID]*domain.Product),
+		carts:     make(map[uuid.UUID]*domain.Cart),
+		cartItems: make(map[uuid.UUID][]*domain.CartItem),
+		orders:    make(map[uuid.UUID]*domain.Order),
+	}
+}
+
+func (m *memStore) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(memTxKey{}).(*memTx); ok {
+		return fn(ctx)
+	}
+
+	tx := &memTx{held: make(map[uuid.UUID]bool)}
+	err := fn(context.WithValue(ctx, memTxKey{}, tx))
+	if err != nil {
+		m.mu.Lock()
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+		m.mu.Unlock()
+	}
+	for _, lock := range tx.locks {
+		lock.Unlock()
+	}
+	return err
+}
+
+// lockRow locks a row until the transaction carried by ctx ends
+func (m *memStore) lockRow(ctx context.Context, id uuid.UUID) {
+	tx, ok := ctx.Value(memTxKey{}).(*memTx)
+	if !ok {
+		panic("row locked outside a transaction")
+	}
+	if tx.held[id] {
+		return
+	}
+
+	m.mu.Lock()
+	lock, ok := m.rowLocks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.rowLocks[id] = lock
+	}
+	m.mu.Unlock()
+
+	lock.Lock()
+	tx.held[id] = true
+	tx.locks = append(tx.locks, lock)
+}
+
+// onRollback registers how to undo a write; m.mu is held by the caller
+func (m *memStore) onRollback(ctx context.Context, undo func()) {
+	if tx, ok := ctx.Value(memTxKey{}).(*memTx); ok {
+		tx.undo = append(tx.undo, undo)
+	}
+}
+
+type memProductRepo struct {
+	repositories.ProductRepository
+	m *memStore
+}
+
+func (r *memProductRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Product, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	product, ok := r.m.products[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	copied := *product
+	return &copied, nil
+}
+
+func (r *memProductRepo) GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*domain.Product, error) {
+	r.m.lockRow(ctx, id)
+	return r.GetByID(ctx, id)
+}
+
+func (r *memProductRepo) UpdateStock(ctx context.Context, id uuid.UUID, quantity int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	product := r.m.products[id]
+	before := product.StockQuantity
+	product.StockQuantity = quantity
+	r.m.stock = append(r.m.stock, quantity)
+	r.m.onRollback(ctx, func() { product.StockQuantity = before })
+	return nil
+}
+
+type memCartRepo struct {
+	repositories.CartRepository
+	m *memStore
+}
+
+func (r *memCartRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Cart, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	cart, ok := r.m.carts[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	copied := *cart
+	return &copied, nil
+}
+
+func (r *memCartRepo) TransitionStatus(ctx context.Context, id uuid.UUID, from, to string) (bool, error) {
+	r.m.lockRow(ctx, id)
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	cart := r.m.carts[id]
+	if cart.Status != from {
+		return false, nil
+	}
+	cart.Status = to
+	r.m.onRollback(ctx, func() { cart.Status = from })
+	return true, nil
+}
+
+type memCartItemRepo struct {
+	repositories.CartItemRepository
+	m *memStore
+}
+
+func (r *memCartItemRepo) GetByCartID(ctx context.Context, cartID uuid.UUID) ([]*domain.CartItem, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	items := make([]*domain.CartItem, 0, len(r.m.cartItems[cartID]))
+	for _, item := range r.m.cartItems[cartID] {
+		copied := *item
+		items = append(items, &copied)
+	}
+	return items, nil
+}
+
+type memOrderRepo struct {
+	repositories.OrderRepository
+	m *memStore
+}
+
+func (r *memOrderRepo) GenerateOrderNumber(ctx context.Context, tenantID string) (string, error) {
+	return "ORD-" + uuid.NewString()[:8], nil
+}
+
+func (r *memOrderRepo) Create(ctx context.Context, order *domain.Order) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	order.ID = uuid.New()
+	r.m.orders[order.ID] = order
+	r.m.onRollback(ctx, func() { delete(r.m.orders, order.ID) })
+	return nil
+}
+
+type memOrderItemRepo struct {
+	repositories.OrderItemRepository
+}
+
+func (r *memOrderItemRepo) Create(ctx context.Context, item *domain.OrderItem) error {
+	item.ID = uuid.New()
+	return nil
+}
+
+type memInventoryLogRepo struct {
+	repositories.InventoryLogRepository
+	m *memStore
+}
+
+func (r *memInventoryLogRepo) Create(ctx context.Context, log *domain.InventoryLog) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.logs = append(r.m.logs, log)
+	return nil
+}
+
+func newCheckoutService(m *memStore) *OrderService {
+	return NewOrderService(
+		m,
+		&memOrderRepo{m: m},
+		&memOrderItemRepo{},
+		&memCartRepo{m: m},
+		&memCartItemRepo{m: m},
+		&memProductRepo{m: m},
+		nil,
+		&memInventoryLogRepo{m: m},
+		nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil,
+	)
+}
+
+// addProduct stocks a product whose stock is managed on the product row
+func (m *memStore) addProduct(stock int) *domain.Product {
+	product := &domain.Product{
+		ID:            uuid.New(),
+		TenantID:      "acme",
+		Name:          "Widget",
+		SKU:           "W-1",
+		ProductType:   domain.ProductTypeSimple,
+		ManageStock:   true,
+		StockQuantity: stock,
+	}
+	m.products[product.ID] = product
+	return product
+}
+
+// addCart creates an active cart holding quantity units of the product
+func (m *memStore) addCart(product *domain.Product, quantity int) *domain.Cart {
+	cart := &domain.Cart{
+		ID:       uuid.New(),
+		TenantID: "acme",
+		Status:   domain.CartStatusActive,
+		Currency: "USD",
+		Subtotal: 10 * float64(quantity),
+	}
+	m.carts[cart.ID] = cart
+	m.cartItems[cart.ID] = []*domain.CartItem{{
+		ID:         uuid.New(),
+		CartID:     cart.ID,
+		ProductID:  product.ID,
+		Quantity:   quantity,
+		UnitPrice:  10,
+		TotalPrice: 10 * float64(quantity),
+	}}
+	return cart
+}
+
+// checkoutConcurrently checks every cart out at once and returns the errors in cart order
+func checkoutConcurrently(service *OrderService, carts []*domain.Cart) []error {
+	errs := make([]error, len(carts))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, cart := range carts {
+		wg.Add(1)
+		go func(i int, cartID uuid.UUID) {
+			defer wg.Done()
+			<-start
+			_, errs[i] = service.CreateOrderFromCart(context.Background(), cartID, domain.CustomerInfo{})
+		}(i, cart.ID)
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+func TestConcurrentCheckoutsDoNotOversell(t *testing.T) {
+	m := newMemStore()
+	product := m.addProduct(5)
+	carts := make([]*domain.Cart, 12)
+	for i := range carts {
+		carts[i] = m.addCart(product, 1)
+	}
+
+	errs := checkoutConcurrently(newCheckoutService(m), carts)
+
+	sold := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			sold++
+		case errors.Is(err, ErrInsufficientStock):
+			if status := m.carts[carts[i].ID].Status; status != domain.CartStatusActive {
+				t.Errorf("cart of a failed checkout has status %q, want it left active", status)
+			}
+		default:
+			t.Errorf("checkout failed: %v", err)
+		}
+	}
+	if sold != 5 {
+		t.Errorf("%d checkouts succeeded, want 5", sold)
+	}
+	if got := m.products[product.ID].StockQuantity; got != 0 {
+		t.Errorf("stock after checkouts = %d, want 0", got)
+	}
+	if len(m.orders) != sold || len(m.logs) != sold {
+		t.Errorf("got %d orders and %d inventory logs for %d sales", len(m.orders), len(m.logs), sold)
+	}
+
+	// Each sale must write stock from the level the previous one left behind
+	if len(m.stock) != sold {
+		t.Fatalf("UpdateStock was called %d times, want %d", len(m.stock), sold)
+	}
+	for i, quantity := range m.stock {
+		if want := 4 - i; quantity != want {
+			t.Errorf("UpdateStock call %d wrote %d, want %d", i, quantity, want)
+		}
+	}
+}
+
+func TestConcurrentCheckoutsOfOneCartCreateOneOrder(t *testing.T) {
+	m := newMemStore()
+	product := m.addProduct(10)
+	cart := m.addCart(product, 2)
+	carts := make([]*domain.Cart, 8)
+	for i := range carts {
+		carts[i] = cart
+	}
+
+	errs := checkoutConcurrently(newCheckoutService(m), carts)
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		} else if err.Error() != "cart is not active" {
+			t.Errorf("checkout failed: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d checkouts of the cart succeeded, want 1", succeeded)
+	}
+	if got := m.products[product.ID].StockQuantity; got != 8 {
+		t.Errorf("stock after checkouts = %d, want 8", got)
+	}
+	if status := m.carts[cart.ID].Status; status != domain.CartStatusConverted {
+		t.Errorf("cart status = %q, want converted", status)
+	}
+}
+
+func TestCheckoutRollsBackOnInsufficientStock(t *testing.T) {
+	m := newMemStore()
+	product := m.addProduct(1)
+	cart := m.addCart(product, 2)
+
+	_, err := newCheckoutService(m).CreateOrderFromCart(context.Background(), cart.ID, domain.CustomerInfo{})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("CreateOrderFromCart error = %v, want ErrInsufficientStock", err)
+	}
+	if status := m.carts[cart.ID].Status; status != domain.CartStatusActive {
+		t.Errorf("cart status = %q, want active", status)
+	}
+	if len(m.orders) != 0 || len(m.stock) != 0 {
+		t.Errorf("a failed checkout left %d orders and %d stock writes", len(m.orders), len(m.stock))
+	}
+}
+
+func TestRestockedQuantitiesCountsRestockedRefundLines(t *testing.T) {
+	first, second := uuid.New(), uuid.New()
+	order := &domain.Order{Metadata: map[string]interface{}{
+		"refunds": []interface{}{
+			// Recorded by this process
+			map[string]interface{}{"items": []map[string]interface{}{
+				{"order_item_id": first, "quantity": 2, "restock": true},
+				{"order_item_id": second, "quantity": 1, "restock": false},
+			}},
+			// Read back from jsonb
+			map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"order_item_id": first.String(), "quantity": float64(1), "restock": true},
+			}},
+		},
+	}}
+
+	restocked := restockedQuantities(order)
+	if restocked[first] != 3 || restocked[second] != 0 {
+		t.Errorf("restocked = %v, want 3 of %s and none of %s", restocked, first, second)
+	}
+}
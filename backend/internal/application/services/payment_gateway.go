@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+)
+
+// Payment gateway result statuses
+const (
+	GatewayStatusAuthorized = "authorized"
+	GatewayStatusCaptured   = "captured"
+	GatewayStatusVoided     = "voided"
+	GatewayStatusRefunded   = "refunded"
+	GatewayStatusDeclined   = "declined"
+)
+
+var (
+	// ErrPaymentGatewayNotFound is returned when no gateway is registered under the requested name
+	ErrPaymentGatewayNotFound = errors.New("payment gateway not found")
+	// ErrPaymentDeclined is returned when the gateway refuses a payment operation
+	ErrPaymentDeclined = errors.New("payment declined")
+	// ErrPaymentInProgress is returned while a gateway call made for the order is yet to be recorded
+	ErrPaymentInProgress = errors.New("another payment operation on this order is in progress")
+)
+
+// PaymentGateway defines the operations every payment processor adapter must support.
+// Capture and Refund take an idempotency key like PaymentGatewayRequest does, so a
+// resent capture or refund is not applied twice.
+type PaymentGateway interface {
+	Name() string
+	Authorize(ctx context.Context, req *PaymentGatewayRequest) (*PaymentGatewayResult, error)
+	Capture(ctx context.Context, authorizationID string, amount float64, idempotencyKey string) (*PaymentGatewayResult, error)
+	Void(ctx context.Context, authorizationID string) (*PaymentGatewayResult, error)
+	Refund(ctx context.Context, chargeID string, amount float64, idempotencyKey string) (*PaymentGatewayResult, error)
+}
+
+// PaymentGatewayRequest represents an authorization request sent to a gateway
+type PaymentGatewayRequest struct {
+	TenantID    string            `json:"tenant_id"`
+	OrderID     uuid.UUID         `json:"order_id"`
+	Amount      float64           `json:"amount"`
+	Currency    string            `json:"currency"`
+	Method      string            `json:"method"`
+	Token       string            `json:"token"`   // Tokenized payment source from the client
+	Capture     bool              `json:"capture"` // Capture immediately instead of holding funds
+	Description string            `json:"description"`
+	Metadata    map[string]string `json:"metadata"`
+
+	// IdempotencyKey lets the gateway recognise a resent charge. It is unique to
+	// one tender, so two tenders of the same amount on an order stay distinct.
+	IdempotencyKey string `json:"idempotency_key"`
+}
+
+// PaymentGatewayResult represents the outcome of a gateway operation
+type PaymentGatewayResult struct {
+	TransactionID string                 `json:"transaction_id"`
+	Status        string                 `json:"status"`
+	Amount        float64                `json:"amount"`
+	Fee           float64                `json:"fee"`
+	FailureReason string                 `json:"failure_reason,omitempty"`
+	Raw           map[string]interface{} `json:"raw,omitempty"`
+}
+
+// Declined reports whether the gateway refused the operation
+func (r *PaymentGatewayResult) Declined() bool {
+	return r.Status == GatewayStatusDeclined
+}
+
+// PaymentGatewayRegistry resolves gateways by the name carried in PaymentData.Gateway
+type PaymentGatewayRegistry struct {
+	mu       sync.RWMutex
+	gateways map[string]PaymentGateway
+}
+
+// NewPaymentGatewayRegistry creates a registry pre-populated with the given gateways
+func NewPaymentGatewayRegistry(gateways ...PaymentGateway) *PaymentGatewayRegistry {
+	registry := &PaymentGatewayRegistry{gateways: make(map[string]PaymentGateway)}
+	for _, gateway := range gateways {
+		registry.Register(gateway)
+	}
+	return registry
+}
+
+// Register adds or replaces a gateway
+func (r *PaymentGatewayRegistry) Register(gateway PaymentGateway) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gateways[strings.ToLower(gateway.Name())] = gateway
+}
+
+// Get returns the gateway registered under name
+func (r *PaymentGatewayRegistry) Get(name string) (PaymentGateway, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	gateway, ok := r.gateways[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPaymentGatewayNotFound, name)
+	}
+	return gateway, nil
+}
+
+// FakePaymentGateway is a deterministic in-process gateway for tests and local development.
+// Tokens "tok_decline" and "tok_error" simulate a card decline and a transport failure.
+type FakePaymentGateway struct {
+	mu         sync.Mutex
+	name       string
+	sequence   int
+	FeePercent float64
+	FeeFixed   float64
+	charges    map[string]*fakeCharge
+}
+
+type fakeCharge struct {
+	authorized float64
+	captured   float64
+	refunded   float64
+	voided     bool
+}
+
+// Fake gateway test tokens
+const (
+	FakeTokenDecline = "tok_decline"
+	FakeTokenError   = "tok_error"
+)
+
+// NewFakePaymentGateway creates a fake gateway registered under name
+func NewFakePaymentGateway(name string) *FakePaymentGateway {
+	return &FakePaymentGateway{
+		name:       name,
+		FeePercent: 2.9,
+		FeeFixed:   0.30,
+		charges:    make(map[string]*fakeCharge),
+	}
+}
+
+func (g *FakePaymentGateway) Name() string {
+	return g.name
+}
+
+func (g *FakePaymentGateway) Authorize(ctx context.Context, req *PaymentGatewayRequest) (*PaymentGatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch req.Token {
+	case FakeTokenError:
+		return nil, errors.New("fake gateway: connection reset")
+	case FakeTokenDecline:
+		return &PaymentGatewayResult{
+			Status:        GatewayStatusDeclined,
+			Amount:        req.Amount,
+			FailureReason: "card_declined",
+		}, nil
+	}
+
+	if req.Amount <= 0 {
+		return &PaymentGatewayResult{Status: GatewayStatusDeclined, FailureReason: "invalid_amount"}, nil
+	}
+
+	g.sequence++
+	id := fmt.Sprintf("fake_ch_%06d", g.sequence)
+	charge := &fakeCharge{authorized: req.Amount}
+	g.charges[id] = charge
+
+	result := &PaymentGatewayResult{
+		TransactionID: id,
+		Status:        GatewayStatusAuthorized,
+		Amount:        req.Amount,
+	}
+	if req.Capture {
+		charge.captured = req.Amount
+		result.Status = GatewayStatusCaptured
+		result.Fee = g.fee(req.Amount)
+	}
+	result.Raw = map[string]interface{}{"id": id, "status": result.Status}
+
+	return result, nil
+}
+
+func (g *FakePaymentGateway) Capture(ctx context.Context, authorizationID string, amount float64, idempotencyKey string) (*PaymentGatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	charge, ok := g.charges[authorizationID]
+	if !ok {
+		return nil, fmt.Errorf("fake gateway: unknown authorization %s", authorizationID)
+	}
+	if charge.voided || charge.captured > 0 {
+		return &PaymentGatewayResult{TransactionID: authorizationID, Status: GatewayStatusDeclined, FailureReason: "authorization_not_capturable"}, nil
+	}
+	if amount <= 0 || amount > charge.authorized {
+		return &PaymentGatewayResult{TransactionID: authorizationID, Status: GatewayStatusDeclined, FailureReason: "amount_too_large"}, nil
+	}
+
+	charge.captured = amount
+	return &PaymentGatewayResult{
+		TransactionID: authorizationID,
+		Status:        GatewayStatusCaptured,
+		Amount:        amount,
+		Fee:           g.fee(amount),
+	}, nil
+}
+
+func (g *FakePaymentGateway) Void(ctx context.Context, authorizationID string) (*PaymentGatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	charge, ok := g.charges[authorizationID]
+	if !ok {
+		return nil, fmt.Errorf("fake gateway: unknown authorization %s", authorizationID)
+	}
+	if charge.captured > 0 {
+		return &PaymentGatewayResult{TransactionID: authorizationID, Status: GatewayStatusDeclined, FailureReason: "charge_already_captured"}, nil
+	}
+
+	charge.voided = true
+	return &PaymentGatewayResult{
+		TransactionID: authorizationID,
+		Status:        GatewayStatusVoided,
+		Amount:        charge.authorized,
+	}, nil
+}
+
+func (g *FakePaymentGateway) Refund(ctx context.Context, chargeID string, amount float64, idempotencyKey string) (*PaymentGatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	charge, ok := g.charges[chargeID]
+	if !ok {
+		return nil, fmt.Errorf("fake gateway: unknown charge %s", chargeID)
+	}
+	if amount <= 0 || roundCurrency(charge.refunded+amount) > charge.captured {
+		return &PaymentGatewayResult{TransactionID: chargeID, Status: GatewayStatusDeclined, FailureReason: "amount_too_large"}, nil
+	}
+
+	charge.refunded = roundCurrency(charge.refunded + amount)
+	g.sequence++
+	return &PaymentGatewayResult{
+		TransactionID: fmt.Sprintf("fake_re_%06d", g.sequence),
+		Status:        GatewayStatusRefunded,
+		Amount:        amount,
+	}, nil
+}
+
+func (g *FakePaymentGateway) fee(amount float64) float64 {
+	return roundCurrency(amount*g.FeePercent/100 + g.FeeFixed)
+}
+
+// CashPaymentGateway records cash tendered at a register. The money changes hands
+// at the till, so charges always settle immediately and cannot be held.
+type CashPaymentGateway struct {
+	mu       sync.Mutex
+	sequence int
+}
+
+func NewCashPaymentGateway() *CashPaymentGateway {
+	return &CashPaymentGateway{}
+}
+
+func (g *CashPaymentGateway) Name() string {
+	return domain.PaymentMethodCash
+}
+
+func (g *CashPaymentGateway) Authorize(ctx context.Context, req *PaymentGatewayRequest) (*PaymentGatewayResult, error) {
+	if !req.Capture {
+		return &PaymentGatewayResult{Status: GatewayStatusDeclined, FailureReason: "cash_cannot_be_held"}, nil
+	}
+	if req.Amount <= 0 {
+		return &PaymentGatewayResult{Status: GatewayStatusDeclined, FailureReason: "invalid_amount"}, nil
+	}
+
+	id := g.nextID("cash_ch")
+	return &PaymentGatewayResult{
+		TransactionID: id,
+		Status:        GatewayStatusCaptured,
+		Amount:        req.Amount,
+		Raw:           map[string]interface{}{"id": id, "status": GatewayStatusCaptured},
+	}, nil
+}
+
+func (g *CashPaymentGateway) Capture(ctx context.Context, authorizationID string, amount float64, idempotencyKey string) (*PaymentGatewayResult, error) {
+	return &PaymentGatewayResult{TransactionID: authorizationID, Status: GatewayStatusDeclined, FailureReason: "cash_cannot_be_held"}, nil
+}
+
+func (g *CashPaymentGateway) Void(ctx context.Context, authorizationID string) (*PaymentGatewayResult, error) {
+	return &PaymentGatewayResult{TransactionID: authorizationID, Status: GatewayStatusDeclined, FailureReason: "cash_cannot_be_held"}, nil
+}
+
+func (g *CashPaymentGateway) Refund(ctx context.Context, chargeID string, amount float64, idempotencyKey string) (*PaymentGatewayResult, error) {
+	if amount <= 0 {
+		return &PaymentGatewayResult{TransactionID: chargeID, Status: GatewayStatusDeclined, FailureReason: "invalid_amount"}, nil
+	}
+	return &PaymentGatewayResult{
+		TransactionID: g.nextID("cash_re"),
+		Status:        GatewayStatusRefunded,
+		Amount:        amount,
+	}, nil
+}
+
+func (g *CashPaymentGateway) nextID(prefix string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sequence++
+	return fmt.Sprintf("%s_%d_%06d", prefix, time.Now().Unix(), g.sequence)
+}
+
+// roundCurrency rounds an amount to two decimal places
+func roundCurrency(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -292,20 +294,38 @@ func (s *ProductService) validateProduct(ctx context.Context, product *domain.Pr
 
 // CartService handles shopping cart business logic
 type CartService struct {
-	cartRepo     repositories.CartRepository
-	cartItemRepo repositories.CartItemRepository
-	productRepo  repositories.ProductRepository
+	cartRepo      repositories.CartRepository
+	cartItemRepo  repositories.CartItemRepository
+	productRepo   repositories.ProductRepository
+	variationRepo repositories.ProductVariationRepository
+	inventory     *InventoryService
+	discounts     *DiscountService
+	tax           TaxCalculator
+	loyalty       *LoyaltyService
+	pricing       *PriceListService
 }
 
 func NewCartService(
 	cartRepo repositories.CartRepository,
 	cartItemRepo repositories.CartItemRepository,
 	productRepo repositories.ProductRepository,
+	variationRepo repositories.ProductVariationRepository,
+	inventory *InventoryService,
+	discounts *DiscountService,
+	tax TaxCalculator,
+	loyalty *LoyaltyService,
+	pricing *PriceListService,
 ) *CartService {
 	return &CartService{
-		cartRepo:     cartRepo,
-		cartItemRepo: cartItemRepo,
-		productRepo:  productRepo,
+		cartRepo:      cartRepo,
+		cartItemRepo:  cartItemRepo,
+		productRepo:   productRepo,
+		variationRepo: variationRepo,
+		inventory:     inventory,
+		discounts:     discounts,
+		tax:           tax,
+		loyalty:       loyalty,
+		pricing:       pricing,
 	}
 }
 
@@ -348,8 +368,16 @@ func (s *CartService) AddToCart(ctx context.Context, cartID, productID uuid.UUID
 		return errors.New("product is not available")
 	}
 
+	variation, err := resolveVariation(ctx, s.variationRepo, product, variationID)
+	if err != nil {
+		return err
+	}
+
 	// Check stock availability
-	availableStock := product.StockQuantity
+	availableStock, err := s.availableStock(ctx, cartID, product, variation)
+	if err != nil {
+		return err
+	}
 	if product.ManageStock && availableStock < quantity {
 		return fmt.Errorf("insufficient stock: only %d available", availableStock)
 	}
@@ -371,10 +399,7 @@ func (s *CartService) AddToCart(ctx context.Context, cartID, productID uuid.UUID
 		}
 	} else {
 		// Create new cart item
-		unitPrice := product.SalePrice
-		if unitPrice == 0 {
-			unitPrice = product.RegularPrice
-		}
+		unitPrice := unitPriceFor(product, variation)
 
 		cartItem := &domain.CartItem{
 			CartID:      cartID,
@@ -383,13 +408,8 @@ func (s *CartService) AddToCart(ctx context.Context, cartID, productID uuid.UUID
 			Quantity:    quantity,
 			UnitPrice:   unitPrice,
 			TotalPrice:  unitPrice * float64(quantity),
-			ProductData: map[string]interface{}{
-				"name":          product.Name,
-				"sku":           product.SKU,
-				"image":         product.FeaturedImage,
-				"regular_price": product.RegularPrice,
-				"sale_price":    product.SalePrice,
-			},
+			BasePrice:   &unitPrice,
+			ProductData: productSnapshot(product, variation),
 		}
 
 		if err := s.cartItemRepo.Create(ctx, cartItem); err != nil {
@@ -401,6 +421,59 @@ func (s *CartService) AddToCart(ctx context.Context, cartID, productID uuid.UUID
 	return s.RecalculateCartTotals(ctx, cartID)
 }
 
+// SetFulfillmentLocation picks the location the cart's order will be fulfilled
+// from. A nil location falls back to the tenant default.
+func (s *CartService) SetFulfillmentLocation(ctx context.Context, cartID uuid.UUID, locationID *uuid.UUID) error {
+	cart, err := s.cartRepo.GetByID(ctx, cartID)
+	if err != nil {
+		return fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	if locationID != nil {
+		if s.inventory == nil {
+			return errors.New("stock locations are not supported")
+		}
+		if _, err := s.inventory.GetLocation(ctx, cart.TenantID, *locationID); err != nil {
+			return err
+		}
+	}
+
+	cart.LocationID = locationID
+	if err := s.cartRepo.Update(ctx, cart); err != nil {
+		return fmt.Errorf("failed to update cart: %w", err)
+	}
+
+	return nil
+}
+
+// availableStock returns the stock a cart can draw on: what is on hand at the
+// cart's fulfilment location when the tenant uses locations, otherwise the
+// product or variation total
+func (s *CartService) availableStock(ctx context.Context, cartID uuid.UUID, product *domain.Product, variation *domain.ProductVariation) (int, error) {
+	if s.inventory == nil || !product.ManageStock {
+		return availableStockFor(product, variation), nil
+	}
+
+	cart, err := s.cartRepo.GetByID(ctx, cartID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	location, err := s.inventory.ResolveLocation(ctx, cart.TenantID, cart.LocationID)
+	if err != nil {
+		return 0, err
+	}
+	if location == nil {
+		return availableStockFor(product, variation), nil
+	}
+
+	var variationID *uuid.UUID
+	if variation != nil {
+		variationID = &variation.ID
+	}
+	return s.inventory.StockAt(ctx, location.ID, product.ID, variationID)
+}
+
 func (s *CartService) RemoveFromCart(ctx context.Context, cartItemID uuid.UUID) error {
 	cartItem, err := s.cartItemRepo.GetByID(ctx, cartItemID)
 	if err != nil {
@@ -431,8 +504,17 @@ func (s *CartService) UpdateCartItemQuantity(ctx context.Context, cartItemID uui
 		return fmt.Errorf("failed to get product: %w", err)
 	}
 
-	if product.ManageStock && product.StockQuantity < quantity {
-		return fmt.Errorf("insufficient stock: only %d available", product.StockQuantity)
+	variation, err := resolveVariation(ctx, s.variationRepo, product, cartItem.VariationID)
+	if err != nil {
+		return err
+	}
+
+	availableStock, err := s.availableStock(ctx, cartItem.CartID, product, variation)
+	if err != nil {
+		return err
+	}
+	if product.ManageStock && availableStock < quantity {
+		return fmt.Errorf("insufficient stock: only %d available", availableStock)
 	}
 
 	cartItem.Quantity = quantity
@@ -447,21 +529,55 @@ func (s *CartService) UpdateCartItemQuantity(ctx context.Context, cartItemID uui
 }
 
 func (s *CartService) RecalculateCartTotals(ctx context.Context, cartID uuid.UUID) error {
+	cart, err := s.cartRepo.GetByID(ctx, cartID)
+	if err != nil {
+		return fmt.Errorf("failed to get cart: %w", err)
+	}
+
 	items, err := s.cartItemRepo.GetByCartID(ctx, cartID)
 	if err != nil {
 		return fmt.Errorf("failed to get cart items: %w", err)
 	}
 
+	if err := s.applyPricing(ctx, cart, items); err != nil {
+		return err
+	}
+
 	var subtotal float64
 	for _, item := range items {
 		subtotal += item.TotalPrice
 	}
 
-	// TODO: Calculate tax, shipping, discounts
-	taxTotal := 0.0      // Calculate based on tax rules
+	// TODO: Calculate shipping
 	shippingTotal := 0.0 // Calculate based on shipping rules
-	discountTotal := 0.0 // Calculate based on applied discounts
-	total := subtotal + taxTotal + shippingTotal - discountTotal
+	discountTotal := 0.0
+
+	if err := s.applyDiscounts(ctx, cart, items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		discountTotal += metadataFloat(item.Metadata, itemMetadataDiscountTotal)
+	}
+	if metadataBool(cart.Metadata, cartMetadataFreeShipping) {
+		shippingTotal = 0
+	}
+	discountTotal = roundCurrency(discountTotal)
+
+	// The customer's address is not known yet, so carts are taxed at the
+	// address stored on the cart or, failing that, the tenant's base address
+	shippingAddress, _ := cart.Metadata["shipping_address"].(map[string]interface{})
+	billingAddress, _ := cart.Metadata["billing_address"].(map[string]interface{})
+	taxResult, err := calculateCartTax(ctx, s.tax, s.productRepo, cart, items, billingAddress, shippingAddress, shippingTotal)
+	if err != nil {
+		return err
+	}
+
+	taxTotal := taxResult.TaxTotal
+	total := subtotal + shippingTotal - discountTotal
+	if !taxResult.PricesIncludeTax {
+		total += taxTotal
+	}
+	total = roundCurrency(total)
 
 	totals := domain.CartTotals{
 		Subtotal:      subtotal,
@@ -474,6 +590,337 @@ func (s *CartService) RecalculateCartTotals(ctx context.Context, cartID uuid.UUI
 	return s.cartRepo.UpdateTotals(ctx, cartID, totals)
 }
 
+// ApplyDiscountCode adds a discount code to the cart after validating it against
+// the cart contents and the tenant's stacking rules
+func (s *CartService) ApplyDiscountCode(ctx context.Context, cartID uuid.UUID, code string) (*domain.DiscountValidation, error) {
+	if s.discounts == nil {
+		return nil, errors.New("discounts are not enabled")
+	}
+
+	cart, err := s.cartRepo.GetByID(ctx, cartID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	items, err := s.cartItemRepo.GetByCartID(ctx, cartID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart items: %w", err)
+	}
+
+	validation, err := s.discounts.ValidateCode(ctx, cart, items, code)
+	if err != nil {
+		return nil, err
+	}
+	if !validation.IsValid {
+		return validation, nil
+	}
+
+	if cart.Metadata == nil {
+		cart.Metadata = make(map[string]interface{})
+	}
+	cart.Metadata[cartMetadataDiscountCodes] = append(CartDiscountCodes(cart), strings.TrimSpace(code))
+	if err := s.cartRepo.Update(ctx, cart); err != nil {
+		return nil, fmt.Errorf("failed to update cart: %w", err)
+	}
+
+	return validation, s.RecalculateCartTotals(ctx, cartID)
+}
+
+// RemoveDiscountCode removes a discount code from the cart
+func (s *CartService) RemoveDiscountCode(ctx context.Context, cartID uuid.UUID, code string) error {
+	cart, err := s.cartRepo.GetByID(ctx, cartID)
+	if err != nil {
+		return fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	var codes []string
+	for _, existing := range CartDiscountCodes(cart) {
+		if !strings.EqualFold(existing, strings.TrimSpace(code)) {
+			codes = append(codes, existing)
+		}
+	}
+
+	if cart.Metadata == nil {
+		cart.Metadata = make(map[string]interface{})
+	}
+	cart.Metadata[cartMetadataDiscountCodes] = codes
+	if err := s.cartRepo.Update(ctx, cart); err != nil {
+		return fmt.Errorf("failed to update cart: %w", err)
+	}
+
+	return s.RecalculateCartTotals(ctx, cartID)
+}
+
+// SetCustomer identifies the customer buying the cart, or clears it when
+// customerID is nil. Points redeemed for a previous customer are dropped.
+func (s *CartService) SetCustomer(ctx context.Context, cartID uuid.UUID, customerID *uuid.UUID) error {
+	cart, err := s.cartRepo.GetByID(ctx, cartID)
+	if err != nil {
+		return fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	if customerID != nil {
+		if s.loyalty == nil {
+			return errors.New("customers are not enabled")
+		}
+		if _, err := s.loyalty.GetCustomer(ctx, cart.TenantID, *customerID); err != nil {
+			return err
+		}
+	}
+
+	if cart.CustomerID == nil || customerID == nil || *cart.CustomerID != *customerID {
+		delete(cart.Metadata, cartMetadataLoyaltyPoints)
+	}
+	cart.CustomerID = customerID
+	if err := s.cartRepo.Update(ctx, cart); err != nil {
+		return fmt.Errorf("failed to update cart: %w", err)
+	}
+
+	return s.RecalculateCartTotals(ctx, cartID)
+}
+
+// RedeemLoyaltyPoints asks to pay part of the cart with the customer's loyalty
+// points, or stops redeeming when points is zero. Fewer points may be used if
+// the tenant caps how much of an order points can pay.
+func (s *CartService) RedeemLoyaltyPoints(ctx context.Context, cartID uuid.UUID, points int) error {
+	cart, err := s.cartRepo.GetByID(ctx, cartID)
+	if err != nil {
+		return fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	if points != 0 {
+		if s.loyalty == nil {
+			return ErrLoyaltyDisabled
+		}
+		if cart.CustomerID == nil {
+			return errors.New("a customer must be added to the cart to redeem points")
+		}
+		if err := s.loyalty.CheckRedemption(ctx, cart.TenantID, *cart.CustomerID, points); err != nil {
+			return err
+		}
+	}
+
+	if cart.Metadata == nil {
+		cart.Metadata = make(map[string]interface{})
+	}
+	if points == 0 {
+		delete(cart.Metadata, cartMetadataLoyaltyPoints)
+	} else {
+		cart.Metadata[cartMetadataLoyaltyPoints] = points
+	}
+	if err := s.cartRepo.Update(ctx, cart); err != nil {
+		return fmt.Errorf("failed to update cart: %w", err)
+	}
+
+	return s.RecalculateCartTotals(ctx, cartID)
+}
+
+// applyPricing prices each line from its base price and the tenant's price
+// lists, recording the rule that set the price on the line. A line no rule
+// applies to any more goes back to its base price. Price locked lines are
+// left as they are.
+func (s *CartService) applyPricing(ctx context.Context, cart *domain.Cart, items []*domain.CartItem) error {
+	if s.pricing == nil {
+		return nil
+	}
+
+	var priced []*domain.CartItem
+	baseSet := make(map[uuid.UUID]bool)
+	for _, item := range items {
+		if item.PriceLocked {
+			continue
+		}
+		if item.BasePrice == nil {
+			if err := s.setCatalogBasePrice(ctx, item); err != nil {
+				return err
+			}
+			baseSet[item.ID] = true
+		}
+		priced = append(priced, item)
+	}
+
+	quotes, err := s.quotePrices(ctx, cart, priced)
+	if err != nil {
+		return err
+	}
+
+	var changed []*domain.CartItem
+	for _, item := range priced {
+		unitPrice := *item.BasePrice
+		var priceListID, ruleID *uuid.UUID
+		var rule map[string]interface{}
+		if quote := quotes[item.ID]; quote != nil {
+			unitPrice = quote.UnitPrice
+			priceListID = &quote.PriceListID
+			ruleID = &quote.RuleID
+			rule = quote.Rule
+		}
+		totalPrice := roundCurrency(unitPrice * float64(item.Quantity))
+
+		sameRule := (item.PriceRuleID == nil && ruleID == nil) || (item.PriceRuleID != nil && ruleID != nil && *item.PriceRuleID == *ruleID)
+		if item.UnitPrice == unitPrice && item.TotalPrice == totalPrice && sameRule && !baseSet[item.ID] {
+			continue
+		}
+		item.UnitPrice = unitPrice
+		item.TotalPrice = totalPrice
+		item.PriceListID = priceListID
+		item.PriceRuleID = ruleID
+		item.PriceRule = rule
+		changed = append(changed, item)
+	}
+
+	if len(changed) > 0 {
+		if err := s.cartItemRepo.BulkUpdate(ctx, changed); err != nil {
+			return fmt.Errorf("failed to update cart item prices: %w", err)
+		}
+	}
+	return nil
+}
+
+// QuoteUnitPrices returns the unit price the tenant's price lists give each
+// line of the cart, keyed by item ID, without changing the lines. Lines must
+// carry an ID and, unless they are to be priced at the catalog price, a base price.
+func (s *CartService) QuoteUnitPrices(ctx context.Context, cart *domain.Cart, items []*domain.CartItem) (map[uuid.UUID]float64, error) {
+	prices := make(map[uuid.UUID]float64, len(items))
+	quoted := make([]*domain.CartItem, 0, len(items))
+	for _, item := range items {
+		if item.BasePrice == nil {
+			copied := *item
+			if err := s.setCatalogBasePrice(ctx, &copied); err != nil {
+				return nil, err
+			}
+			item = &copied
+		}
+		prices[item.ID] = *item.BasePrice
+		quoted = append(quoted, item)
+	}
+	if s.pricing == nil {
+		return prices, nil
+	}
+
+	quotes, err := s.quotePrices(ctx, cart, quoted)
+	if err != nil {
+		return nil, err
+	}
+	for itemID, quote := range quotes {
+		prices[itemID] = quote.UnitPrice
+	}
+	return prices, nil
+}
+
+// quotePrices runs the cart's lines through the tenant's price lists, for the
+// location the cart is fulfilled from
+func (s *CartService) quotePrices(ctx context.Context, cart *domain.Cart, items []*domain.CartItem) (map[uuid.UUID]*PriceQuote, error) {
+	var locationID *uuid.UUID
+	if s.inventory != nil {
+		if location, err := s.inventory.ResolveLocation(ctx, cart.TenantID, cart.LocationID); err == nil && location != nil {
+			locationID = &location.ID
+		}
+	}
+
+	quotes, err := s.pricing.PriceCart(ctx, cart, items, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply price lists: %w", err)
+	}
+	return quotes, nil
+}
+
+// setCatalogBasePrice gives a line added before base prices were kept the
+// current catalog price of its product as its base price. A line whose product
+// is gone keeps the price it was added at.
+func (s *CartService) setCatalogBasePrice(ctx context.Context, item *domain.CartItem) error {
+	basePrice := item.UnitPrice
+	product, err := s.productRepo.GetByID(ctx, item.ProductID)
+	if err == nil && product != nil {
+		variation, err := resolveVariation(ctx, s.variationRepo, product, item.VariationID)
+		if err != nil {
+			return err
+		}
+		basePrice = unitPriceFor(product, variation)
+	}
+	item.BasePrice = &basePrice
+	return nil
+}
+
+// applyDiscounts re-evaluates the cart's discount codes and loyalty points,
+// drops codes that no longer apply and stores each line's share of the
+// discount on the item. Points are applied after codes, to what the codes leave.
+func (s *CartService) applyDiscounts(ctx context.Context, cart *domain.Cart, items []*domain.CartItem) error {
+	codes := CartDiscountCodes(cart)
+	hasCodes := s.discounts != nil && (len(codes) > 0 || cart.Metadata[cartMetadataAppliedDiscounts] != nil)
+	hasPoints := cart.Metadata[cartMetadataLoyaltyPoints] != nil || cart.Metadata[cartMetadataLoyaltyRedemption] != nil
+	if !hasCodes && !hasPoints {
+		return nil
+	}
+
+	evaluation := &DiscountEvaluation{ItemDiscounts: make(map[uuid.UUID]float64)}
+	if hasCodes {
+		var err error
+		evaluation, err = s.discounts.Evaluate(ctx, cart, items, codes)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate discounts: %w", err)
+		}
+	}
+
+	var redemption *LoyaltyRedemption
+	if s.loyalty != nil {
+		var err error
+		redemption, err = s.loyalty.PlanRedemption(ctx, cart, items, evaluation.ItemDiscounts)
+		if err != nil {
+			return fmt.Errorf("failed to apply loyalty points: %w", err)
+		}
+	}
+
+	var changed []*domain.CartItem
+	for _, item := range items {
+		amount := evaluation.ItemDiscounts[item.ID]
+		if redemption != nil {
+			amount = roundCurrency(amount + redemption.Allocations[item.ID])
+		}
+		if metadataFloat(item.Metadata, itemMetadataDiscountTotal) == amount {
+			continue
+		}
+		if item.Metadata == nil {
+			item.Metadata = make(map[string]interface{})
+		}
+		item.Metadata[itemMetadataDiscountTotal] = amount
+		changed = append(changed, item)
+	}
+	if len(changed) > 0 {
+		if err := s.cartItemRepo.BulkUpdate(ctx, changed); err != nil {
+			return fmt.Errorf("failed to update cart item discounts: %w", err)
+		}
+	}
+
+	accepted := make([]string, 0, len(evaluation.Applied))
+	for _, applied := range evaluation.Applied {
+		accepted = append(accepted, applied.Code)
+	}
+
+	if cart.Metadata == nil {
+		cart.Metadata = make(map[string]interface{})
+	}
+	if hasCodes {
+		cart.Metadata[cartMetadataDiscountCodes] = accepted
+		cart.Metadata[cartMetadataAppliedDiscounts] = evaluation.Applied
+		cart.Metadata[cartMetadataFreeShipping] = evaluation.FreeShipping
+		if len(evaluation.Applied) == 0 {
+			delete(cart.Metadata, cartMetadataAppliedDiscounts)
+		}
+	}
+	if redemption != nil {
+		cart.Metadata[cartMetadataLoyaltyRedemption] = redemption
+	} else {
+		delete(cart.Metadata, cartMetadataLoyaltyRedemption)
+	}
+
+	if err := s.cartRepo.Update(ctx, cart); err != nil {
+		return fmt.Errorf("failed to update cart discounts: %w", err)
+	}
+
+	return nil
+}
+
 func (s *CartService) ClearCart(ctx context.Context, cartID uuid.UUID) error {
 	if err := s.cartItemRepo.DeleteByCartID(ctx, cartID); err != nil {
 		return fmt.Errorf("failed to clear cart items: %w", err)
@@ -497,3 +944,158 @@ func abs(x int) int {
 	}
 	return x
 }
+
+// calculateCartTax taxes each cart line net of its discount share. Without a
+// calculator nothing is taxed.
+func calculateCartTax(ctx context.Context, calculator TaxCalculator, productRepo repositories.ProductRepository, cart *domain.Cart, items []*domain.CartItem, billingAddress, shippingAddress map[string]interface{}, shippingTotal float64) (*TaxResult, error) {
+	if calculator == nil {
+		return &TaxResult{Lines: make(map[uuid.UUID]LineTax)}, nil
+	}
+
+	req := &TaxRequest{
+		TenantID:        cart.TenantID,
+		Currency:        cart.Currency,
+		BillingAddress:  billingAddress,
+		ShippingAddress: shippingAddress,
+		ShippingAmount:  shippingTotal,
+	}
+
+	taxClasses := make(map[uuid.UUID]string)
+	for _, item := range items {
+		if _, ok := taxClasses[item.ProductID]; !ok {
+			product, err := productRepo.GetByID(ctx, item.ProductID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get product %s: %w", item.ProductID, err)
+			}
+			taxClasses[item.ProductID] = product.TaxClass
+		}
+
+		req.Lines = append(req.Lines, TaxableLine{
+			ID:        item.ID,
+			ProductID: item.ProductID,
+			TaxClass:  taxClasses[item.ProductID],
+			Quantity:  item.Quantity,
+			Amount:    roundCurrency(item.TotalPrice - metadataFloat(item.Metadata, itemMetadataDiscountTotal)),
+		})
+	}
+
+	result, err := calculator.Calculate(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate tax: %w", err)
+	}
+
+	return result, nil
+}
+
+// resolveVariation loads the variation a cart or order line refers to. Variable
+// products must be sold as one of their variations.
+func resolveVariation(ctx context.Context, variationRepo repositories.ProductVariationRepository, product *domain.Product, variationID *uuid.UUID) (*domain.ProductVariation, error) {
+	if variationID == nil {
+		if product.ProductType == domain.ProductTypeVariable {
+			return nil, fmt.Errorf("a variation of %s must be selected", product.Name)
+		}
+		return nil, nil
+	}
+
+	if variationRepo == nil {
+		return nil, errors.New("product variations are not supported")
+	}
+
+	variation, err := variationRepo.GetByID(ctx, *variationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product variation: %w", err)
+	}
+	if variation.ProductID != product.ID {
+		return nil, fmt.Errorf("variation %s does not belong to %s", variationID, product.Name)
+	}
+
+	return variation, nil
+}
+
+// unitPriceFor returns the selling price of a product, or of the variation when
+// one is given. A variation without its own price inherits the product's.
+func unitPriceFor(product *domain.Product, variation *domain.ProductVariation) float64 {
+	if variation != nil {
+		if variation.SalePrice > 0 {
+			return variation.SalePrice
+		}
+		if variation.RegularPrice > 0 {
+			return variation.RegularPrice
+		}
+	}
+
+	if product.SalePrice > 0 {
+		return product.SalePrice
+	}
+	return product.RegularPrice
+}
+
+// availableStockFor returns the stock that limits a sale: the variation's own
+// stock when selling a variation, otherwise the product's
+func availableStockFor(product *domain.Product, variation *domain.ProductVariation) int {
+	if variation != nil {
+		return variation.StockQuantity
+	}
+	return product.StockQuantity
+}
+
+// costPriceFor returns the unit cost used for inventory logs
+func costPriceFor(product *domain.Product, variation *domain.ProductVariation) float64 {
+	if variation != nil && variation.CostPrice > 0 {
+		return variation.CostPrice
+	}
+	return product.CostPrice
+}
+
+// productSnapshot captures what the customer saw when the line was added
+func productSnapshot(product *domain.Product, variation *domain.ProductVariation) map[string]interface{} {
+	snapshot := map[string]interface{}{
+		"name":          product.Name,
+		"sku":           product.SKU,
+		"image":         product.FeaturedImage,
+		"regular_price": product.RegularPrice,
+		"sale_price":    product.SalePrice,
+	}
+
+	if variation != nil {
+		snapshot["variation_id"] = variation.ID
+		snapshot["sku"] = variation.SKU
+		snapshot["regular_price"] = variation.RegularPrice
+		snapshot["sale_price"] = variation.SalePrice
+		snapshot["attributes"] = variation.Attributes
+		if variation.Image != "" {
+			snapshot["image"] = variation.Image
+		}
+	}
+
+	return snapshot
+}
+
+// formatVariationAttributes renders variation attributes as "Color: Red, Size: M",
+// sorted by attribute name so receipts print them consistently
+func formatVariationAttributes(attributes map[string]interface{}) string {
+	if len(attributes) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := fmt.Sprint(attributes[name])
+		if value == "" {
+			continue
+		}
+		label := strings.ReplaceAll(strings.TrimPrefix(name, "pa_"), "_", " ")
+		if label != "" {
+			label = strings.ToUpper(label[:1]) + label[1:]
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", label, value))
+	}
+
+	return strings.Join(parts, ", ")
+}
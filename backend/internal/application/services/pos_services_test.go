@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+// activePriceListRepo returns the same lists for every tenant and time
+type activePriceListRepo struct {
+	repositories.PriceListRepository
+	lists []*domain.PriceList
+}
+
+func (r *activePriceListRepo) GetActive(ctx context.Context, tenantID string, at time.Time) ([]*domain.PriceList, error) {
+	return r.lists, nil
+}
+
+// updatedCartItemRepo records the lines written back by BulkUpdate
+type updatedCartItemRepo struct {
+	repositories.CartItemRepository
+	updated []*domain.CartItem
+}
+
+func (r *updatedCartItemRepo) BulkUpdate(ctx context.Context, items []*domain.CartItem) error {
+	r.updated = append(r.updated, items...)
+	return nil
+}
+
+// newTierPricedCartService prices the product at 10 in the catalog and 20% off
+// on the tenant's price list
+func newTierPricedCartService(t *testing.T) (*CartService, *updatedCartItemRepo, *domain.Product) {
+	t.Helper()
+	m := newMemStore()
+	product := m.addProduct(100)
+	product.RegularPrice = 10
+
+	listID := uuid.New()
+	lists := &activePriceListRepo{lists: []*domain.PriceList{{
+		ID:       listID,
+		TenantID: "acme",
+		Name:     "Members",
+		IsActive: true,
+		Rules: []domain.PriceListRule{{
+			ID:          uuid.New(),
+			TenantID:    "acme",
+			PriceListID: listID,
+			ProductID:   &product.ID,
+			MinQuantity: 1,
+			PriceType:   domain.PriceRuleTypePercentageOff,
+			Value:       20,
+		}},
+	}}}
+	items := &updatedCartItemRepo{}
+	products := &memProductRepo{m: m}
+	pricing := &PriceListService{listRepo: lists, productRepo: products}
+	return &CartService{cartItemRepo: items, productRepo: products, pricing: pricing}, items, product
+}
+
+func TestApplyPricingLeavesPriceLockedLines(t *testing.T) {
+	s, repo, product := newTierPricedCartService(t)
+	cart := &domain.Cart{ID: uuid.New(), TenantID: "acme"}
+	charged := 9.5
+	locked := &domain.CartItem{ID: uuid.New(), ProductID: product.ID, Quantity: 1, UnitPrice: charged, TotalPrice: charged, PriceLocked: true}
+	// A line added before base prices were kept, already at the tier price
+	legacy := &domain.CartItem{ID: uuid.New(), ProductID: product.ID, Quantity: 2, UnitPrice: 8, TotalPrice: 16}
+
+	if err := s.applyPricing(context.Background(), cart, []*domain.CartItem{locked, legacy}); err != nil {
+		t.Fatalf("applyPricing: %v", err)
+	}
+
+	if locked.UnitPrice != charged || locked.PriceRuleID != nil {
+		t.Errorf("price locked line was repriced to %.2f", locked.UnitPrice)
+	}
+	if legacy.BasePrice == nil || *legacy.BasePrice != 10 {
+		t.Errorf("legacy line base price = %v, want the catalog price 10", legacy.BasePrice)
+	}
+	if legacy.UnitPrice != 8 || legacy.PriceRuleID == nil {
+		t.Errorf("legacy line unit price = %.2f, want the tier price 8", legacy.UnitPrice)
+	}
+	if len(repo.updated) != 1 || repo.updated[0] != legacy {
+		t.Errorf("%d lines were written back, want only the legacy line", len(repo.updated))
+	}
+}
+
+func TestQuoteUnitPricesAppliesPriceListsToLockedLines(t *testing.T) {
+	s, repo, product := newTierPricedCartService(t)
+	catalogPrice := 10.0
+	item := &domain.CartItem{ID: uuid.New(), ProductID: product.ID, Quantity: 1, UnitPrice: 8, BasePrice: &catalogPrice, PriceLocked: true}
+
+	quoted, err := s.QuoteUnitPrices(context.Background(), &domain.Cart{TenantID: "acme"}, []*domain.CartItem{item})
+	if err != nil {
+		t.Fatalf("QuoteUnitPrices: %v", err)
+	}
+
+	if quoted[item.ID] != 8 {
+		t.Errorf("quoted %.2f, want the tier price 8", quoted[item.ID])
+	}
+	if item.UnitPrice != 8 || len(repo.updated) != 0 {
+		t.Error("quoting changed the line")
+	}
+}
@@ -0,0 +1,526 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+var (
+	ErrPriceListNotFound = errors.New("price list not found")
+	ErrPriceRuleNotFound = errors.New("price list rule not found")
+	ErrInvalidPriceList  = errors.New("invalid price list")
+)
+
+// priceListDays are the accepted DaysOfWeek values, indexed by time.Weekday
+var priceListDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// PriceQuote is the price a price list rule sets for a cart line
+type PriceQuote struct {
+	PriceListID uuid.UUID
+	RuleID      uuid.UUID
+	UnitPrice   float64
+	Rule        map[string]interface{} // Snapshot recorded on the cart line
+}
+
+// PriceListService manages price lists and prices cart lines with them
+type PriceListService struct {
+	txManager    repositories.TransactionManager
+	listRepo     repositories.PriceListRepository
+	ruleRepo     repositories.PriceListRuleRepository
+	productRepo  repositories.ProductRepository
+	customerRepo repositories.CustomerRepository
+}
+
+// NewPriceListService creates a new price list service
+func NewPriceListService(
+	txManager repositories.TransactionManager,
+	listRepo repositories.PriceListRepository,
+	ruleRepo repositories.PriceListRuleRepository,
+	productRepo repositories.ProductRepository,
+	customerRepo repositories.CustomerRepository,
+) *PriceListService {
+	return &PriceListService{
+		txManager:    txManager,
+		listRepo:     listRepo,
+		ruleRepo:     ruleRepo,
+		productRepo:  productRepo,
+		customerRepo: customerRepo,
+	}
+}
+
+// CreatePriceList adds a price list. Its rules are added separately.
+func (s *PriceListService) CreatePriceList(ctx context.Context, priceList *domain.PriceList) error {
+	if err := normalizePriceList(priceList); err != nil {
+		return err
+	}
+
+	priceList.ID = uuid.New()
+	priceList.Rules = nil
+	if priceList.Metadata == nil {
+		priceList.Metadata = make(map[string]interface{})
+	}
+
+	if err := s.listRepo.Create(ctx, priceList); err != nil {
+		return fmt.Errorf("failed to create price list: %w", err)
+	}
+	return nil
+}
+
+// UpdatePriceList changes a price list's name, priority, targets and schedule
+func (s *PriceListService) UpdatePriceList(ctx context.Context, tenantID string, priceList *domain.PriceList) error {
+	existing, err := s.GetPriceList(ctx, tenantID, priceList.ID)
+	if err != nil {
+		return err
+	}
+	if err := normalizePriceList(priceList); err != nil {
+		return err
+	}
+
+	existing.Name = priceList.Name
+	existing.Description = priceList.Description
+	existing.Priority = priceList.Priority
+	existing.IsActive = priceList.IsActive
+	existing.CustomerGroups = priceList.CustomerGroups
+	existing.LocationIDs = priceList.LocationIDs
+	existing.StartsAt = priceList.StartsAt
+	existing.EndsAt = priceList.EndsAt
+	existing.DaysOfWeek = priceList.DaysOfWeek
+	existing.StartTime = priceList.StartTime
+	existing.EndTime = priceList.EndTime
+	existing.Timezone = priceList.Timezone
+	if priceList.Metadata != nil {
+		existing.Metadata = priceList.Metadata
+	}
+
+	rules := existing.Rules
+	existing.Rules = nil
+	if err := s.listRepo.Update(ctx, existing); err != nil {
+		return fmt.Errorf("failed to update price list: %w", err)
+	}
+	existing.Rules = rules
+	*priceList = *existing
+	return nil
+}
+
+// DeletePriceList removes a price list and its rules. Cart lines it priced
+// keep their price until the cart is next recalculated.
+func (s *PriceListService) DeletePriceList(ctx context.Context, tenantID string, priceListID uuid.UUID) error {
+	priceList, err := s.GetPriceList(ctx, tenantID, priceListID)
+	if err != nil {
+		return err
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		for _, rule := range priceList.Rules {
+			if err := s.ruleRepo.Delete(ctx, rule.ID); err != nil {
+				return fmt.Errorf("failed to delete price list rule: %w", err)
+			}
+		}
+		return s.listRepo.Delete(ctx, priceListID)
+	})
+}
+
+// GetPriceList returns one of the tenant's price lists with its rules
+func (s *PriceListService) GetPriceList(ctx context.Context, tenantID string, priceListID uuid.UUID) (*domain.PriceList, error) {
+	priceList, err := s.listRepo.GetByID(ctx, priceListID)
+	if err != nil || priceList == nil || priceList.TenantID != tenantID {
+		return nil, ErrPriceListNotFound
+	}
+	return priceList, nil
+}
+
+// ListPriceLists returns the tenant's price lists
+func (s *PriceListService) ListPriceLists(ctx context.Context, tenantID string, filter *domain.PriceListFilter) ([]*domain.PriceList, int64, error) {
+	return s.listRepo.GetByTenantID(ctx, tenantID, filter)
+}
+
+// AddRule adds a rule to a price list
+func (s *PriceListService) AddRule(ctx context.Context, tenantID string, rule *domain.PriceListRule) error {
+	if _, err := s.GetPriceList(ctx, tenantID, rule.PriceListID); err != nil {
+		return err
+	}
+	rule.TenantID = tenantID
+	if err := s.validateRule(ctx, rule); err != nil {
+		return err
+	}
+
+	rule.ID = uuid.New()
+	if err := s.ruleRepo.Create(ctx, rule); err != nil {
+		return fmt.Errorf("failed to create price list rule: %w", err)
+	}
+	return nil
+}
+
+// UpdateRule changes a rule's target, tier or price
+func (s *PriceListService) UpdateRule(ctx context.Context, tenantID string, rule *domain.PriceListRule) error {
+	existing, err := s.getRule(ctx, tenantID, rule.PriceListID, rule.ID)
+	if err != nil {
+		return err
+	}
+	rule.TenantID = tenantID
+	if err := s.validateRule(ctx, rule); err != nil {
+		return err
+	}
+
+	existing.ProductID = rule.ProductID
+	existing.VariationID = rule.VariationID
+	existing.CategoryID = rule.CategoryID
+	existing.MinQuantity = rule.MinQuantity
+	existing.PriceType = rule.PriceType
+	existing.Value = rule.Value
+	if err := s.ruleRepo.Update(ctx, existing); err != nil {
+		return fmt.Errorf("failed to update price list rule: %w", err)
+	}
+	*rule = *existing
+	return nil
+}
+
+// DeleteRule removes a rule from a price list
+func (s *PriceListService) DeleteRule(ctx context.Context, tenantID string, priceListID, ruleID uuid.UUID) error {
+	if _, err := s.getRule(ctx, tenantID, priceListID, ruleID); err != nil {
+		return err
+	}
+	return s.ruleRepo.Delete(ctx, ruleID)
+}
+
+// PriceCart finds the price list rule, if any, that prices each cart line
+// now. Lists are filtered by the cart customer's group, the location the cart
+// is fulfilled from and their schedule, then tried highest priority first;
+// the first list with a rule for the line prices it. Rules apply to a line's
+// BasePrice; callers give lines added before it was kept one first.
+func (s *PriceListService) PriceCart(ctx context.Context, cart *domain.Cart, items []*domain.CartItem, locationID *uuid.UUID) (map[uuid.UUID]*PriceQuote, error) {
+	quotes := make(map[uuid.UUID]*PriceQuote)
+	if len(items) == 0 {
+		return quotes, nil
+	}
+
+	now := time.Now()
+	lists, err := s.listRepo.GetActive(ctx, cart.TenantID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price lists: %w", err)
+	}
+
+	group := ""
+	if cart.CustomerID != nil {
+		customer, err := s.customerRepo.GetByID(ctx, *cart.CustomerID)
+		if err == nil && customer != nil && customer.TenantID == cart.TenantID {
+			group = customer.Group
+		}
+	}
+
+	var applicable []*domain.PriceList
+	for _, priceList := range lists {
+		if priceList.IsActive && len(priceList.Rules) > 0 && priceListApplies(priceList, group, locationID, now) {
+			applicable = append(applicable, priceList)
+		}
+	}
+	if len(applicable) == 0 {
+		return quotes, nil
+	}
+	sort.SliceStable(applicable, func(i, j int) bool {
+		if applicable[i].Priority != applicable[j].Priority {
+			return applicable[i].Priority > applicable[j].Priority
+		}
+		return applicable[i].CreatedAt.Before(applicable[j].CreatedAt)
+	})
+
+	// Category rules need each line's product category
+	categories := make(map[uuid.UUID]*uuid.UUID)
+	for _, item := range items {
+		if _, ok := categories[item.ProductID]; ok {
+			continue
+		}
+		var categoryID *uuid.UUID
+		if product, err := s.productRepo.GetByID(ctx, item.ProductID); err == nil && product != nil {
+			categoryID = product.CategoryID
+		}
+		categories[item.ProductID] = categoryID
+	}
+
+	for _, item := range items {
+		if item.BasePrice == nil {
+			return nil, fmt.Errorf("cart item %s has no base price", item.ID)
+		}
+		basePrice := *item.BasePrice
+		for _, priceList := range applicable {
+			rule := bestPriceRule(priceList.Rules, item, categories[item.ProductID])
+			if rule == nil {
+				continue
+			}
+			quotes[item.ID] = &PriceQuote{
+				PriceListID: priceList.ID,
+				RuleID:      rule.ID,
+				UnitPrice:   priceRuleUnitPrice(rule, basePrice),
+				Rule: map[string]interface{}{
+					"price_list_name": priceList.Name,
+					"price_type":      rule.PriceType,
+					"value":           rule.Value,
+					"min_quantity":    rule.MinQuantity,
+					"base_price":      basePrice,
+					"priced_at":       now,
+				},
+			}
+			break
+		}
+	}
+	return quotes, nil
+}
+
+func (s *PriceListService) getRule(ctx context.Context, tenantID string, priceListID, ruleID uuid.UUID) (*domain.PriceListRule, error) {
+	rule, err := s.ruleRepo.GetByID(ctx, ruleID)
+	if err != nil || rule == nil || rule.TenantID != tenantID || rule.PriceListID != priceListID {
+		return nil, ErrPriceRuleNotFound
+	}
+	return rule, nil
+}
+
+func (s *PriceListService) validateRule(ctx context.Context, rule *domain.PriceListRule) error {
+	if rule.CategoryID != nil && (rule.ProductID != nil || rule.VariationID != nil) {
+		return fmt.Errorf("%w: a rule targets either a category or a product", ErrInvalidPriceList)
+	}
+	if rule.ProductID != nil {
+		product, err := s.productRepo.GetByID(ctx, *rule.ProductID)
+		if err != nil || product == nil || product.TenantID != rule.TenantID {
+			return fmt.Errorf("%w: product not found", ErrInvalidPriceList)
+		}
+	}
+
+	if rule.MinQuantity == 0 {
+		rule.MinQuantity = 1
+	}
+	if rule.MinQuantity < 1 {
+		return fmt.Errorf("%w: minimum quantity must be at least 1", ErrInvalidPriceList)
+	}
+	if rule.Value < 0 {
+		return fmt.Errorf("%w: value cannot be negative", ErrInvalidPriceList)
+	}
+	switch rule.PriceType {
+	case domain.PriceRuleTypeFixed, domain.PriceRuleTypeAmountOff:
+	case domain.PriceRuleTypePercentageOff:
+		if rule.Value > 100 {
+			return fmt.Errorf("%w: percentage cannot exceed 100", ErrInvalidPriceList)
+		}
+	default:
+		return fmt.Errorf("%w: price type must be fixed, percentage_off or amount_off", ErrInvalidPriceList)
+	}
+	return nil
+}
+
+// normalizePriceList checks a price list's targets and schedule and puts them
+// in the form PriceCart compares against
+func normalizePriceList(priceList *domain.PriceList) error {
+	priceList.Name = strings.TrimSpace(priceList.Name)
+	if priceList.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPriceList)
+	}
+
+	groups := make([]string, 0, len(priceList.CustomerGroups))
+	for _, group := range priceList.CustomerGroups {
+		if group = strings.ToLower(strings.TrimSpace(group)); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	priceList.CustomerGroups = groups
+
+	locations := make([]string, 0, len(priceList.LocationIDs))
+	for _, locationID := range priceList.LocationIDs {
+		id, err := uuid.Parse(locationID)
+		if err != nil {
+			return fmt.Errorf("%w: invalid location ID %q", ErrInvalidPriceList, locationID)
+		}
+		locations = append(locations, id.String())
+	}
+	priceList.LocationIDs = locations
+
+	if priceList.StartsAt != nil && priceList.EndsAt != nil && !priceList.EndsAt.After(*priceList.StartsAt) {
+		return fmt.Errorf("%w: the list must end after it starts", ErrInvalidPriceList)
+	}
+
+	days := make([]string, 0, len(priceList.DaysOfWeek))
+	for _, day := range priceList.DaysOfWeek {
+		day = strings.ToLower(strings.TrimSpace(day))
+		if len(day) > 3 {
+			day = day[:3]
+		}
+		if priceListDay(day) < 0 {
+			return fmt.Errorf("%w: unknown day of week %q", ErrInvalidPriceList, day)
+		}
+		days = append(days, day)
+	}
+	priceList.DaysOfWeek = days
+
+	if (priceList.StartTime == "") != (priceList.EndTime == "") {
+		return fmt.Errorf("%w: a time window needs both a start and an end time", ErrInvalidPriceList)
+	}
+	if priceList.StartTime != "" {
+		start, err := parseClockMinutes(priceList.StartTime)
+		if err != nil {
+			return fmt.Errorf("%w: start time: %v", ErrInvalidPriceList, err)
+		}
+		end, err := parseClockMinutes(priceList.EndTime)
+		if err != nil {
+			return fmt.Errorf("%w: end time: %v", ErrInvalidPriceList, err)
+		}
+		if start == end {
+			return fmt.Errorf("%w: the time window is empty", ErrInvalidPriceList)
+		}
+	}
+
+	if priceList.Timezone == "" {
+		priceList.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(priceList.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown time zone %q", ErrInvalidPriceList, priceList.Timezone)
+	}
+	return nil
+}
+
+// priceListApplies reports whether a list targets the customer group and
+// location and is within its schedule at now
+func priceListApplies(priceList *domain.PriceList, group string, locationID *uuid.UUID, now time.Time) bool {
+	if len(priceList.CustomerGroups) > 0 && !containsString(priceList.CustomerGroups, group) {
+		return false
+	}
+	if len(priceList.LocationIDs) > 0 && (locationID == nil || !containsString(priceList.LocationIDs, locationID.String())) {
+		return false
+	}
+	if priceList.StartsAt != nil && now.Before(*priceList.StartsAt) {
+		return false
+	}
+	if priceList.EndsAt != nil && !now.Before(*priceList.EndsAt) {
+		return false
+	}
+
+	zone, err := time.LoadLocation(priceList.Timezone)
+	if err != nil {
+		zone = time.UTC
+	}
+	local := now.In(zone)
+	day := local.Weekday()
+	if priceList.StartTime != "" {
+		start, err1 := parseClockMinutes(priceList.StartTime)
+		end, err2 := parseClockMinutes(priceList.EndTime)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		minute := local.Hour()*60 + local.Minute()
+		switch {
+		case start < end:
+			if minute < start || minute >= end {
+				return false
+			}
+		case minute < end:
+			// After midnight in a window that started the day before
+			day = (day + 6) % 7
+		case minute < start:
+			return false
+		}
+	}
+
+	if len(priceList.DaysOfWeek) == 0 {
+		return true
+	}
+	for _, listDay := range priceList.DaysOfWeek {
+		if priceListDay(listDay) == int(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// bestPriceRule picks the rule for a cart line from one list: the most
+// specific target (variation, product, category, everything), then the
+// highest quantity tier the line reaches
+func bestPriceRule(rules []domain.PriceListRule, item *domain.CartItem, categoryID *uuid.UUID) *domain.PriceListRule {
+	var best *domain.PriceListRule
+	bestRank := -1
+	for i := range rules {
+		rule := &rules[i]
+		if rule.MinQuantity > item.Quantity {
+			continue
+		}
+
+		rank := 0
+		switch {
+		case rule.VariationID != nil:
+			if item.VariationID == nil || *rule.VariationID != *item.VariationID {
+				continue
+			}
+			rank = 3
+		case rule.ProductID != nil:
+			if *rule.ProductID != item.ProductID {
+				continue
+			}
+			rank = 2
+		case rule.CategoryID != nil:
+			if categoryID == nil || *rule.CategoryID != *categoryID {
+				continue
+			}
+			rank = 1
+		}
+
+		if rank > bestRank || (rank == bestRank && rule.MinQuantity > best.MinQuantity) {
+			best = rule
+			bestRank = rank
+		}
+	}
+	return best
+}
+
+// priceRuleUnitPrice applies a rule to a base price. Prices never go below zero.
+func priceRuleUnitPrice(rule *domain.PriceListRule, basePrice float64) float64 {
+	price := basePrice
+	switch rule.PriceType {
+	case domain.PriceRuleTypeFixed:
+		price = rule.Value
+	case domain.PriceRuleTypePercentageOff:
+		price = basePrice * (1 - rule.Value/100)
+	case domain.PriceRuleTypeAmountOff:
+		price = basePrice - rule.Value
+	}
+	if price < 0 {
+		price = 0
+	}
+	return roundCurrency(price)
+}
+
+// priceRuleSnapshot records on an order line the price list rule it was sold at
+func priceRuleSnapshot(item *domain.CartItem) map[string]interface{} {
+	snapshot := make(map[string]interface{}, len(item.PriceRule)+2)
+	for key, value := range item.PriceRule {
+		snapshot[key] = value
+	}
+	snapshot["price_list_id"] = item.PriceListID
+	snapshot["price_rule_id"] = item.PriceRuleID
+	return snapshot
+}
+
+// parseClockMinutes parses an HH:MM time into minutes after midnight
+func parseClockMinutes(value string) (int, error) {
+	hours, minutes, ok := strings.Cut(strings.TrimSpace(value), ":")
+	h, err1 := strconv.Atoi(hours)
+	m, err2 := strconv.Atoi(minutes)
+	if !ok || err1 != nil || err2 != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("%q is not an HH:MM time", value)
+	}
+	return h*60 + m, nil
+}
+
+func priceListDay(day string) int {
+	for i, name := range priceListDays {
+		if name == day {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,541 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+// ErrPurchaseOrderNotFound is returned when a purchase order does not exist for the tenant
+var ErrPurchaseOrderNotFound = errors.New("purchase order not found")
+
+// PurchaseReceiptLine is a quantity received against one purchase order line
+type PurchaseReceiptLine struct {
+	ItemID   uuid.UUID `json:"item_id"`
+	Quantity int       `json:"quantity"`
+}
+
+// ReorderSuggestion proposes restocking a product, or one variation of it, that is
+// at or below its low stock threshold
+type ReorderSuggestion struct {
+	ProductID         uuid.UUID  `json:"product_id"`
+	VariationID       *uuid.UUID `json:"variation_id,omitempty"`
+	ProductName       string     `json:"product_name"`
+	SKU               string     `json:"sku"`
+	CurrentStock      int        `json:"current_stock"`
+	LowStockThreshold int        `json:"low_stock_threshold"`
+	OnOrder           int        `json:"on_order"`
+	SuggestedQuantity int        `json:"suggested_quantity"`
+	SupplierID        *uuid.UUID `json:"supplier_id,omitempty"` // Supplier of the last purchase, if any
+	UnitCost          float64    `json:"unit_cost"`
+}
+
+// PurchasingService manages suppliers and purchase orders, and receives
+// purchased stock at its landed cost
+type PurchasingService struct {
+	txManager     repositories.TransactionManager
+	supplierRepo  repositories.SupplierRepository
+	orderRepo     repositories.PurchaseOrderRepository
+	productRepo   repositories.ProductRepository
+	variationRepo repositories.ProductVariationRepository
+	inventoryRepo repositories.InventoryLogRepository
+	inventory     *InventoryService
+}
+
+func NewPurchasingService(
+	txManager repositories.TransactionManager,
+	supplierRepo repositories.SupplierRepository,
+	orderRepo repositories.PurchaseOrderRepository,
+	productRepo repositories.ProductRepository,
+	variationRepo repositories.ProductVariationRepository,
+	inventoryRepo repositories.InventoryLogRepository,
+	inventory *InventoryService,
+) *PurchasingService {
+	return &PurchasingService{
+		txManager:     txManager,
+		supplierRepo:  supplierRepo,
+		orderRepo:     orderRepo,
+		productRepo:   productRepo,
+		variationRepo: variationRepo,
+		inventoryRepo: inventoryRepo,
+		inventory:     inventory,
+	}
+}
+
+func (s *PurchasingService) CreateSupplier(ctx context.Context, supplier *domain.Supplier) error {
+	supplier.Code = strings.ToUpper(strings.TrimSpace(supplier.Code))
+	if supplier.Code == "" {
+		return errors.New("supplier code is required")
+	}
+	if supplier.Name == "" {
+		return errors.New("supplier name is required")
+	}
+	if supplier.LeadTimeDays < 0 {
+		return errors.New("lead time cannot be negative")
+	}
+
+	if existing, err := s.supplierRepo.GetByCode(ctx, supplier.TenantID, supplier.Code); err == nil && existing != nil {
+		return errors.New("supplier with this code already exists")
+	}
+
+	return s.supplierRepo.Create(ctx, supplier)
+}
+
+func (s *PurchasingService) UpdateSupplier(ctx context.Context, supplier *domain.Supplier) error {
+	if supplier.Name == "" {
+		return errors.New("supplier name is required")
+	}
+	if supplier.LeadTimeDays < 0 {
+		return errors.New("lead time cannot be negative")
+	}
+	return s.supplierRepo.Update(ctx, supplier)
+}
+
+// CreatePurchaseOrder drafts a purchase order and works out its totals
+func (s *PurchasingService) CreatePurchaseOrder(ctx context.Context, order *domain.PurchaseOrder) error {
+	supplier, err := s.supplierRepo.GetByID(ctx, order.SupplierID)
+	if err != nil || supplier == nil || supplier.TenantID != order.TenantID {
+		return errors.New("supplier not found")
+	}
+	if !supplier.IsActive {
+		return fmt.Errorf("supplier %s is not active", supplier.Name)
+	}
+
+	if order.LocationID != nil {
+		if s.inventory == nil {
+			return errors.New("stock locations are not supported")
+		}
+		if _, err := s.inventory.GetLocation(ctx, order.TenantID, *order.LocationID); err != nil {
+			return err
+		}
+	}
+
+	if len(order.Items) == 0 {
+		return errors.New("purchase order has no items")
+	}
+	if order.ShippingCost < 0 || order.OtherCosts < 0 {
+		return errors.New("purchase order costs cannot be negative")
+	}
+
+	order.Subtotal = 0
+	for i := range order.Items {
+		item := &order.Items[i]
+		if item.Quantity <= 0 {
+			return errors.New("purchase quantities must be positive")
+		}
+		if item.UnitCost < 0 {
+			return errors.New("unit cost cannot be negative")
+		}
+
+		product, err := s.productRepo.GetByID(ctx, item.ProductID)
+		if err != nil || product.TenantID != order.TenantID {
+			return fmt.Errorf("product %s not found", item.ProductID)
+		}
+		if _, err := resolveVariation(ctx, s.variationRepo, product, item.VariationID); err != nil {
+			return err
+		}
+
+		item.QuantityReceived = 0
+		item.TotalCost = roundCurrency(item.UnitCost * float64(item.Quantity))
+		order.Subtotal += item.TotalCost
+	}
+	order.Subtotal = roundCurrency(order.Subtotal)
+	order.Total = roundCurrency(order.Subtotal + order.ShippingCost + order.OtherCosts)
+
+	if order.Currency == "" {
+		order.Currency = supplier.Currency
+	}
+	if order.ExpectedAt == nil && supplier.LeadTimeDays > 0 {
+		expected := time.Now().AddDate(0, 0, supplier.LeadTimeDays)
+		order.ExpectedAt = &expected
+	}
+
+	orderNumber, err := s.orderRepo.GenerateOrderNumber(ctx, order.TenantID)
+	if err != nil {
+		return fmt.Errorf("failed to generate purchase order number: %w", err)
+	}
+	order.OrderNumber = orderNumber
+	order.Status = domain.PurchaseOrderStatusDraft
+
+	if err := s.orderRepo.Create(ctx, order); err != nil {
+		return fmt.Errorf("failed to create purchase order: %w", err)
+	}
+
+	return nil
+}
+
+// SubmitPurchaseOrder marks a draft purchase order as sent to the supplier
+func (s *PurchasingService) SubmitPurchaseOrder(ctx context.Context, tenantID string, orderID uuid.UUID) (*domain.PurchaseOrder, error) {
+	order, err := s.getOrder(ctx, tenantID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != domain.PurchaseOrderStatusDraft {
+		return nil, fmt.Errorf("cannot submit a %s purchase order", order.Status)
+	}
+
+	now := time.Now()
+	order.Status = domain.PurchaseOrderStatusOrdered
+	order.OrderedAt = &now
+	if err := s.orderRepo.Update(ctx, order); err != nil {
+		return nil, fmt.Errorf("failed to update purchase order: %w", err)
+	}
+
+	return order, nil
+}
+
+// CancelPurchaseOrder cancels whatever has not been received yet. Stock already
+// received stays where it is.
+func (s *PurchasingService) CancelPurchaseOrder(ctx context.Context, tenantID string, orderID uuid.UUID) (*domain.PurchaseOrder, error) {
+	order, err := s.getOrder(ctx, tenantID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status == domain.PurchaseOrderStatusReceived || order.Status == domain.PurchaseOrderStatusCancelled {
+		return nil, fmt.Errorf("cannot cancel a %s purchase order", order.Status)
+	}
+
+	order.Status = domain.PurchaseOrderStatusCancelled
+	if err := s.orderRepo.Update(ctx, order); err != nil {
+		return nil, fmt.Errorf("failed to update purchase order: %w", err)
+	}
+
+	return order, nil
+}
+
+// ReceivePurchaseOrder books received stock in at its landed cost and updates
+// each item's weighted-average cost. With no lines, everything outstanding is
+// received.
+func (s *PurchasingService) ReceivePurchaseOrder(ctx context.Context, tenantID string, orderID uuid.UUID, lines []PurchaseReceiptLine, userID *uuid.UUID) (*domain.PurchaseOrder, error) {
+	var order *domain.PurchaseOrder
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		order, err = s.orderRepo.GetByIDForUpdate(ctx, orderID)
+		if err != nil || order == nil || order.TenantID != tenantID {
+			return ErrPurchaseOrderNotFound
+		}
+		if order.Status != domain.PurchaseOrderStatusOrdered && order.Status != domain.PurchaseOrderStatusPartiallyReceived {
+			return fmt.Errorf("cannot receive a %s purchase order", order.Status)
+		}
+
+		quantities, err := receiptQuantities(order, lines)
+		if err != nil {
+			return err
+		}
+
+		// Receive by product and then variation, the order checkouts lock stock in
+		items := make([]*domain.PurchaseOrderItem, 0, len(quantities))
+		for i := range order.Items {
+			if quantities[order.Items[i].ID] > 0 {
+				items = append(items, &order.Items[i])
+			}
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			if items[i].ProductID != items[j].ProductID {
+				return items[i].ProductID.String() < items[j].ProductID.String()
+			}
+			return stockKey(items[i].ProductID, items[i].VariationID).String() < stockKey(items[j].ProductID, items[j].VariationID).String()
+		})
+
+		for _, item := range items {
+			quantity := quantities[item.ID]
+			if err := s.receiveItem(ctx, order, item, quantity, userID); err != nil {
+				return err
+			}
+
+			item.QuantityReceived += quantity
+			if err := s.orderRepo.UpdateItem(ctx, item); err != nil {
+				return fmt.Errorf("failed to update purchase order item: %w", err)
+			}
+		}
+
+		order.Status = domain.PurchaseOrderStatusReceived
+		for _, item := range order.Items {
+			if item.QuantityReceived < item.Quantity {
+				order.Status = domain.PurchaseOrderStatusPartiallyReceived
+				break
+			}
+		}
+		if order.Status == domain.PurchaseOrderStatusReceived {
+			now := time.Now()
+			order.ReceivedAt = &now
+		}
+
+		if err := s.orderRepo.Update(ctx, order); err != nil {
+			return fmt.Errorf("failed to update purchase order: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// GetReorderSuggestions proposes purchases for products at or below their low
+// stock threshold, at a location or across all locations when locationID is nil.
+// Variations hold their own stock, so a variable product gets one suggestion per
+// variation, measured against the product's threshold. Each suggestion tops stock
+// up to twice the threshold, less what is already on order.
+func (s *PurchasingService) GetReorderSuggestions(ctx context.Context, tenantID string, locationID *uuid.UUID) ([]*ReorderSuggestion, error) {
+	products, err := s.productRepo.GetLowStock(ctx, tenantID, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get low stock products: %w", err)
+	}
+
+	suggestions := make([]*ReorderSuggestion, 0, len(products))
+	for _, product := range products {
+		if !product.ManageStock {
+			continue
+		}
+
+		variations := []*domain.ProductVariation{nil}
+		if product.ProductType == domain.ProductTypeVariable && s.variationRepo != nil {
+			variations, err = s.variationRepo.GetByProductID(ctx, product.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get product variations: %w", err)
+			}
+		}
+
+		for _, variation := range variations {
+			suggestion, err := s.reorderSuggestion(ctx, tenantID, locationID, product, variation)
+			if err != nil {
+				return nil, err
+			}
+			if suggestion != nil {
+				suggestions = append(suggestions, suggestion)
+			}
+		}
+	}
+
+	return suggestions, nil
+}
+
+// reorderSuggestion proposes restocking one item, or returns nil when it has
+// enough in stock and on order
+func (s *PurchasingService) reorderSuggestion(ctx context.Context, tenantID string, locationID *uuid.UUID, product *domain.Product, variation *domain.ProductVariation) (*ReorderSuggestion, error) {
+	var variationID *uuid.UUID
+	if variation != nil {
+		variationID = &variation.ID
+	}
+
+	stock := availableStockFor(product, variation)
+	if locationID != nil && s.inventory != nil {
+		var err error
+		stock, err = s.inventory.StockAt(ctx, *locationID, product.ID, variationID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	onOrder, err := s.orderRepo.GetOutstandingQuantity(ctx, tenantID, product.ID, variationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quantity on order: %w", err)
+	}
+
+	target := product.LowStockThreshold * 2
+	if target < 1 {
+		target = 1
+	}
+	if stock > product.LowStockThreshold {
+		return nil, nil
+	}
+	suggested := target - stock - onOrder
+	if suggested <= 0 {
+		return nil, nil
+	}
+
+	suggestion := &ReorderSuggestion{
+		ProductID:         product.ID,
+		VariationID:       variationID,
+		ProductName:       product.Name,
+		SKU:               product.SKU,
+		CurrentStock:      stock,
+		LowStockThreshold: product.LowStockThreshold,
+		OnOrder:           onOrder,
+		SuggestedQuantity: suggested,
+		UnitCost:          costPriceFor(product, variation),
+	}
+	if variation != nil {
+		suggestion.SKU = variation.SKU
+	}
+
+	// Suggest buying from the supplier used last time, at their last price
+	if last, err := s.orderRepo.GetLastItemForProduct(ctx, tenantID, product.ID, variationID); err == nil && last != nil {
+		supplierID := last.PurchaseOrder.SupplierID
+		suggestion.SupplierID = &supplierID
+		suggestion.UnitCost = last.UnitCost
+	}
+
+	return suggestion, nil
+}
+
+// receiveItem books quantity units of a line into stock at their landed cost and
+// folds that cost into the item's weighted-average cost. It must run inside a transaction.
+func (s *PurchasingService) receiveItem(ctx context.Context, order *domain.PurchaseOrder, item *domain.PurchaseOrderItem, quantity int, userID *uuid.UUID) error {
+	product, err := s.productRepo.GetByIDForUpdate(ctx, item.ProductID)
+	if err != nil {
+		return fmt.Errorf("failed to get product %s: %w", item.ProductID, err)
+	}
+
+	var variation *domain.ProductVariation
+	if item.VariationID != nil {
+		variation, err = s.variationRepo.GetByIDForUpdate(ctx, *item.VariationID)
+		if err != nil {
+			return fmt.Errorf("failed to get product variation %s: %w", item.VariationID, err)
+		}
+	}
+
+	landedCost := landedUnitCost(order, item)
+	averageCost := weightedAverageCost(availableStockFor(product, variation), costPriceFor(product, variation), quantity, landedCost)
+
+	if product.ManageStock {
+		movement := stockMovement{
+			TenantID:      order.TenantID,
+			ProductID:     item.ProductID,
+			VariationID:   item.VariationID,
+			Quantity:      quantity,
+			Type:          domain.InventoryTypeIn,
+			UnitCost:      landedCost,
+			Reason:        fmt.Sprintf("Purchase order %s", order.OrderNumber),
+			ReferenceID:   &order.ID,
+			ReferenceType: "purchase_order",
+			UserID:        userID,
+			Metadata: map[string]interface{}{
+				"purchase_order_number": order.OrderNumber,
+				"supplier_id":           order.SupplierID,
+				"unit_cost":             item.UnitCost,
+			},
+		}
+
+		if order.LocationID != nil && s.inventory != nil {
+			movement.LocationID = *order.LocationID
+			if err := s.inventory.moveStock(ctx, movement); err != nil {
+				return err
+			}
+		} else if err := s.receiveIntoTotal(ctx, product, variation, movement); err != nil {
+			return err
+		}
+	}
+
+	if variation != nil {
+		if err := s.variationRepo.UpdateCostPrice(ctx, variation.ID, averageCost); err != nil {
+			return fmt.Errorf("failed to update variation cost: %w", err)
+		}
+		return nil
+	}
+	if err := s.productRepo.UpdateCostPrice(ctx, product.ID, averageCost); err != nil {
+		return fmt.Errorf("failed to update product cost: %w", err)
+	}
+	return nil
+}
+
+// receiveIntoTotal adds received stock to the product or variation total for
+// tenants that do not track locations
+func (s *PurchasingService) receiveIntoTotal(ctx context.Context, product *domain.Product, variation *domain.ProductVariation, m stockMovement) error {
+	stockBefore := availableStockFor(product, variation)
+	newStock := stockBefore + m.Quantity
+	if variation != nil {
+		if err := s.variationRepo.UpdateStock(ctx, variation.ID, newStock); err != nil {
+			return fmt.Errorf("failed to update variation stock: %w", err)
+		}
+	} else if err := s.productRepo.UpdateStock(ctx, product.ID, newStock); err != nil {
+		return fmt.Errorf("failed to update product stock: %w", err)
+	}
+
+	inventoryLog := &domain.InventoryLog{
+		TenantID:       m.TenantID,
+		ProductID:      product.ID,
+		VariationID:    m.VariationID,
+		Type:           m.Type,
+		Quantity:       m.Quantity,
+		QuantityBefore: stockBefore,
+		QuantityAfter:  newStock,
+		Reason:         m.Reason,
+		ReferenceID:    m.ReferenceID,
+		ReferenceType:  m.ReferenceType,
+		CostPerUnit:    m.UnitCost,
+		TotalCost:      roundCurrency(m.UnitCost * float64(m.Quantity)),
+		UserID:         m.UserID,
+		Metadata:       m.Metadata,
+	}
+
+	if err := s.inventoryRepo.Create(ctx, inventoryLog); err != nil {
+		return fmt.Errorf("failed to create inventory log: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PurchasingService) getOrder(ctx context.Context, tenantID string, orderID uuid.UUID) (*domain.PurchaseOrder, error) {
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil || order == nil || order.TenantID != tenantID {
+		return nil, ErrPurchaseOrderNotFound
+	}
+	return order, nil
+}
+
+// receiptQuantities maps purchase order item IDs to the units being received
+func receiptQuantities(order *domain.PurchaseOrder, lines []PurchaseReceiptLine) (map[uuid.UUID]int, error) {
+	quantities := make(map[uuid.UUID]int)
+	if len(lines) == 0 {
+		for _, item := range order.Items {
+			if outstanding := item.Quantity - item.QuantityReceived; outstanding > 0 {
+				quantities[item.ID] = outstanding
+			}
+		}
+	}
+
+	items := make(map[uuid.UUID]domain.PurchaseOrderItem, len(order.Items))
+	for _, item := range order.Items {
+		items[item.ID] = item
+	}
+	for _, line := range lines {
+		item, ok := items[line.ItemID]
+		if !ok {
+			return nil, fmt.Errorf("item %s does not belong to this purchase order", line.ItemID)
+		}
+		if line.Quantity <= 0 {
+			return nil, errors.New("received quantities must be positive")
+		}
+		quantities[item.ID] += line.Quantity
+		if outstanding := item.Quantity - item.QuantityReceived; quantities[item.ID] > outstanding {
+			return nil, fmt.Errorf("cannot receive %d of item %s: only %d outstanding", quantities[item.ID], item.ID, outstanding)
+		}
+	}
+
+	if len(quantities) == 0 {
+		return nil, errors.New("nothing to receive")
+	}
+	return quantities, nil
+}
+
+// landedUnitCost spreads the order's shipping and other costs over its lines in
+// proportion to their value and returns the item's cost per unit including its share
+func landedUnitCost(order *domain.PurchaseOrder, item *domain.PurchaseOrderItem) float64 {
+	extras := order.ShippingCost + order.OtherCosts
+	if extras == 0 || order.Subtotal == 0 {
+		return item.UnitCost
+	}
+	return roundCurrency(item.UnitCost * (1 + extras/order.Subtotal))
+}
+
+// weightedAverageCost blends the cost of stock on hand with newly received stock
+func weightedAverageCost(stockOnHand int, currentCost float64, received int, receivedCost float64) float64 {
+	if stockOnHand < 0 {
+		stockOnHand = 0
+	}
+	if stockOnHand+received <= 0 {
+		return receivedCost
+	}
+	total := float64(stockOnHand)*currentCost + float64(received)*receivedCost
+	return roundCurrency(total / float64(stockOnHand+received))
+}
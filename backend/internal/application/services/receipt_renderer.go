@@ -0,0 +1,364 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+)
+
+// Receipt output formats
+const (
+	ReceiptFormatHTML   = "html"
+	ReceiptFormatPDF    = "pdf"
+	ReceiptFormatESCPOS = "escpos"
+)
+
+// Thermal paper widths in millimetres and the characters per line they fit
+const (
+	PaperWidth58mm = 58
+	PaperWidth80mm = 80
+
+	receiptColumns58mm = 32
+	receiptColumns80mm = 48
+	receiptColumnsPDF  = 42
+)
+
+// ReceiptDocument is the format-independent content of a receipt
+type ReceiptDocument struct {
+	StoreName        string
+	Branding         domain.TenantBranding
+	ReceiptNumber    string
+	OrderNumber      string
+	Date             time.Time
+	Currency         string
+	Lines            []ReceiptLine
+	Subtotal         float64
+	DiscountTotal    float64
+	ShippingTotal    float64
+	Taxes            []domain.TaxLine
+	TaxTotal         float64
+	Total            float64
+	PricesIncludeTax bool
+	PaymentMethod    string
+	Reprint          bool
+}
+
+// ReceiptLine is one product line on a receipt
+type ReceiptLine struct {
+	Name string
+	SKU  string
+	// Attributes describes the variation sold, e.g. "Color: Red, Size: M"
+	Attributes string
+	Quantity   int
+	UnitPrice  float64
+	Total      float64
+	Discount   float64
+	Tax        float64
+}
+
+type receiptTextLine struct {
+	text string
+	bold bool
+}
+
+// ReceiptRenderer turns a ReceiptDocument into HTML, PDF or ESC/POS output
+type ReceiptRenderer struct {
+	htmlTemplate *template.Template
+}
+
+func NewReceiptRenderer() *ReceiptRenderer {
+	return &ReceiptRenderer{
+		htmlTemplate: template.Must(template.New("receipt").Funcs(template.FuncMap{
+			"money": formatMoney,
+		}).Parse(receiptHTMLTemplate)),
+	}
+}
+
+// RenderHTML renders the receipt as a standalone HTML page styled with the tenant's branding
+func (r *ReceiptRenderer) RenderHTML(doc *ReceiptDocument) (string, error) {
+	var buf bytes.Buffer
+	if err := r.htmlTemplate.Execute(&buf, doc); err != nil {
+		return "", fmt.Errorf("failed to render receipt HTML: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// RenderESCPOS renders the receipt as an ESC/POS byte stream for a 58mm or 80mm thermal printer
+func (r *ReceiptRenderer) RenderESCPOS(doc *ReceiptDocument, paperWidth int) []byte {
+	columns := receiptColumns80mm
+	if paperWidth == PaperWidth58mm {
+		columns = receiptColumns58mm
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0x1b, 0x40})       // ESC @: initialize printer
+	buf.Write([]byte{0x1b, 0x74, 0x10}) // ESC t 16: WPC1252 code page
+
+	for _, line := range receiptText(doc, columns) {
+		if line.bold {
+			buf.Write([]byte{0x1b, 0x45, 0x01}) // ESC E 1: bold on
+		}
+		buf.Write(toLatin1(line.text))
+		buf.WriteByte('\n')
+		if line.bold {
+			buf.Write([]byte{0x1b, 0x45, 0x00}) // ESC E 0: bold off
+		}
+	}
+
+	buf.Write([]byte{0x1b, 0x64, 0x04})       // ESC d 4: feed four lines
+	buf.Write([]byte{0x1d, 0x56, 0x42, 0x00}) // GS V B 0: partial cut
+	return buf.Bytes()
+}
+
+// RenderPDF renders the receipt as a single-page PDF sized like an 80mm paper roll
+func (r *ReceiptRenderer) RenderPDF(doc *ReceiptDocument) []byte {
+	const (
+		fontSize = 8.0
+		leading  = 10.0
+		margin   = 12.0
+		width    = 226.77 // 80mm in points
+	)
+
+	lines := receiptText(doc, receiptColumnsPDF)
+	height := margin*2 + leading*float64(len(lines))
+
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "BT\n%.2f TL\n%.2f %.2f Td\n", leading, margin, height-margin-fontSize)
+	for i, line := range lines {
+		font := "F1"
+		if line.bold {
+			font = "F2"
+		}
+		if i > 0 {
+			content.WriteString("T*\n")
+		}
+		fmt.Fprintf(&content, "/%s %.1f Tf\n(%s) Tj\n", font, fontSize, pdfEscape(toLatin1(line.text)))
+	}
+	content.WriteString("ET\n")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>", width, height),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return pdf.Bytes()
+}
+
+// receiptText lays the receipt out as fixed-width text shared by the thermal and PDF outputs
+func receiptText(doc *ReceiptDocument, columns int) []receiptTextLine {
+	var lines []receiptTextLine
+	add := func(text string, bold bool) {
+		lines = append(lines, receiptTextLine{text: text, bold: bold})
+	}
+	rule := strings.Repeat("-", columns)
+
+	for _, text := range wrapText(doc.StoreName, columns) {
+		add(centerText(text, columns), true)
+	}
+	if doc.Reprint {
+		add(centerText("*** REPRINT ***", columns), true)
+	}
+	add(rule, false)
+	add(padColumns("Receipt", doc.ReceiptNumber, columns), false)
+	add(padColumns("Order", doc.OrderNumber, columns), false)
+	add(padColumns("Date", doc.Date.Format("2006-01-02 15:04"), columns), false)
+	add(rule, false)
+
+	for _, line := range doc.Lines {
+		for _, text := range wrapText(line.Name, columns) {
+			add(text, false)
+		}
+		if line.Attributes != "" {
+			for _, text := range wrapText(line.Attributes, columns-2) {
+				add("  "+text, false)
+			}
+		}
+		quantity := fmt.Sprintf("  %d x %s", line.Quantity, formatMoney(line.UnitPrice, doc.Currency))
+		add(padColumns(quantity, formatMoney(line.Total, doc.Currency), columns), false)
+		if line.Discount > 0 {
+			add(padColumns("  Discount", "-"+formatMoney(line.Discount, doc.Currency), columns), false)
+		}
+	}
+
+	add(rule, false)
+	add(padColumns("Subtotal", formatMoney(doc.Subtotal, doc.Currency), columns), false)
+	if doc.DiscountTotal > 0 {
+		add(padColumns("Discount", "-"+formatMoney(doc.DiscountTotal, doc.Currency), columns), false)
+	}
+	if doc.ShippingTotal > 0 {
+		add(padColumns("Shipping", formatMoney(doc.ShippingTotal, doc.Currency), columns), false)
+	}
+	for _, tax := range doc.Taxes {
+		label := fmt.Sprintf("%s %s%%", tax.Name, trimRate(tax.Rate))
+		if doc.PricesIncludeTax {
+			label = "Incl. " + label
+		}
+		add(padColumns(label, formatMoney(tax.Amount, doc.Currency), columns), false)
+	}
+	add(padColumns("TOTAL", formatMoney(doc.Total, doc.Currency), columns), true)
+	if doc.PaymentMethod != "" {
+		add(padColumns("Paid by", doc.PaymentMethod, columns), false)
+	}
+
+	if doc.Branding.FooterText != "" {
+		add(rule, false)
+		for _, text := range wrapText(doc.Branding.FooterText, columns) {
+			add(centerText(text, columns), false)
+		}
+	}
+
+	return lines
+}
+
+// padColumns puts left and right at opposite ends of a line, truncating left if needed
+func padColumns(left, right string, columns int) string {
+	space := columns - utf8.RuneCountInString(right) - 1
+	if space < 0 {
+		space = 0
+	}
+	leftRunes := []rune(left)
+	if len(leftRunes) > space {
+		leftRunes = leftRunes[:space]
+	}
+	return string(leftRunes) + strings.Repeat(" ", columns-len(leftRunes)-utf8.RuneCountInString(right)) + right
+}
+
+func centerText(text string, columns int) string {
+	padding := (columns - utf8.RuneCountInString(text)) / 2
+	if padding <= 0 {
+		return text
+	}
+	return strings.Repeat(" ", padding) + text
+}
+
+// wrapText breaks text on spaces into lines of at most columns characters
+func wrapText(text string, columns int) []string {
+	var lines []string
+	var current []rune
+	for _, word := range strings.Fields(text) {
+		wordRunes := []rune(word)
+		for len(wordRunes) > columns {
+			if len(current) > 0 {
+				lines = append(lines, string(current))
+				current = nil
+			}
+			lines = append(lines, string(wordRunes[:columns]))
+			wordRunes = wordRunes[columns:]
+		}
+		if len(current) > 0 && len(current)+1+len(wordRunes) > columns {
+			lines = append(lines, string(current))
+			current = nil
+		}
+		if len(current) > 0 {
+			current = append(current, ' ')
+		}
+		current = append(current, wordRunes...)
+	}
+	if len(current) > 0 {
+		lines = append(lines, string(current))
+	}
+	return lines
+}
+
+// toLatin1 converts text to the single-byte code page used by thermal printers
+// and the standard PDF fonts, replacing characters outside it with '?'
+func toLatin1(text string) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r < 0x100 {
+			out = append(out, byte(r))
+		} else {
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+func pdfEscape(text []byte) string {
+	var buf bytes.Buffer
+	for _, b := range text {
+		switch b {
+		case '\\', '(', ')':
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(b)
+	}
+	return buf.String()
+}
+
+// formatMoney formats an amount with the currency code, without minor units for zero-decimal currencies
+func formatMoney(amount float64, currency string) string {
+	switch strings.ToUpper(currency) {
+	case "VND", "JPY", "KRW", "CLP", "ISK", "UGX", "XAF", "XOF":
+		return fmt.Sprintf("%.0f %s", amount, strings.ToUpper(currency))
+	}
+	return fmt.Sprintf("%.2f %s", amount, strings.ToUpper(currency))
+}
+
+func trimRate(rate float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.4f", rate), "0"), ".")
+}
+
+const receiptHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Receipt {{.ReceiptNumber}}</title>
+<style>
+body { font-family: {{if .Branding.FontFamily}}{{.Branding.FontFamily}}{{else}}Helvetica, Arial, sans-serif{{end}}; color: {{if .Branding.TextColor}}{{.Branding.TextColor}}{{else}}#222{{end}}; background: {{if .Branding.BackgroundColor}}{{.Branding.BackgroundColor}}{{else}}#fff{{end}}; max-width: 420px; margin: 0 auto; padding: 16px; }
+header { text-align: center; border-bottom: 2px solid {{if .Branding.PrimaryColor}}{{.Branding.PrimaryColor}}{{else}}#222{{end}}; padding-bottom: 8px; }
+header img { max-height: 64px; }
+table { width: 100%; border-collapse: collapse; margin-top: 12px; }
+td { padding: 2px 0; vertical-align: top; }
+td.amount { text-align: right; white-space: nowrap; }
+tr.total td { font-weight: bold; border-top: 1px solid #999; padding-top: 6px; }
+.muted { color: #777; font-size: 0.9em; }
+footer { text-align: center; margin-top: 16px; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<header>
+{{if .Branding.LogoURL}}<img src="{{.Branding.LogoURL}}" alt="{{.StoreName}}">{{end}}
+<h2>{{.StoreName}}</h2>
+{{if .Reprint}}<p><strong>REPRINT</strong></p>{{end}}
+<p class="muted">Receipt {{.ReceiptNumber}} &middot; Order {{.OrderNumber}}<br>{{.Date.Format "2006-01-02 15:04"}}</p>
+</header>
+<table>
+{{range .Lines}}<tr><td>{{.Name}}{{if .Attributes}}<br><span class="muted">{{.Attributes}}</span>{{end}}<br><span class="muted">{{.Quantity}} &times; {{money .UnitPrice $.Currency}}</span>{{if .Discount}}<br><span class="muted">Discount -{{money .Discount $.Currency}}</span>{{end}}</td><td class="amount">{{money .Total $.Currency}}</td></tr>
+{{end}}</table>
+<table>
+<tr><td>Subtotal</td><td class="amount">{{money .Subtotal .Currency}}</td></tr>
+{{if .DiscountTotal}}<tr><td>Discount</td><td class="amount">-{{money .DiscountTotal .Currency}}</td></tr>{{end}}
+{{if .ShippingTotal}}<tr><td>Shipping</td><td class="amount">{{money .ShippingTotal .Currency}}</td></tr>{{end}}
+{{range .Taxes}}<tr><td>{{if $.PricesIncludeTax}}Incl. {{end}}{{.Name}} ({{.Rate}}%)</td><td class="amount">{{money .Amount $.Currency}}</td></tr>
+{{end}}<tr class="total"><td>Total</td><td class="amount">{{money .Total .Currency}}</td></tr>
+{{if .PaymentMethod}}<tr><td class="muted">Paid by</td><td class="amount muted">{{.PaymentMethod}}</td></tr>{{end}}
+</table>
+{{if .Branding.FooterText}}<footer>{{.Branding.FooterText}}</footer>{{end}}
+</body>
+</html>
+`
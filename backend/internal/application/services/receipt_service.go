@@ -0,0 +1,252 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+// ErrReceiptNotFound is returned when a receipt does not exist for the tenant
+var ErrReceiptNotFound = errors.New("receipt not found")
+
+// ReceiptStorage stores rendered receipt files. It is satisfied by infrastructure.StorageProvider.
+type ReceiptStorage interface {
+	Upload(ctx context.Context, path string, reader io.Reader) error
+}
+
+// ReceiptService renders receipts, stores their PDF copy and handles reprints
+type ReceiptService struct {
+	receiptRepo   repositories.ReceiptRepository
+	orderRepo     repositories.OrderRepository
+	orderItemRepo repositories.OrderItemRepository
+	tenantRepo    domain.TenantRepository
+	storage       ReceiptStorage
+	mailer        *MailService
+	renderer      *ReceiptRenderer
+}
+
+func NewReceiptService(
+	receiptRepo repositories.ReceiptRepository,
+	orderRepo repositories.OrderRepository,
+	orderItemRepo repositories.OrderItemRepository,
+	tenantRepo domain.TenantRepository,
+	storage ReceiptStorage,
+	mailer *MailService,
+) *ReceiptService {
+	s := &ReceiptService{
+		receiptRepo:   receiptRepo,
+		orderRepo:     orderRepo,
+		orderItemRepo: orderItemRepo,
+		tenantRepo:    tenantRepo,
+		storage:       storage,
+		mailer:        mailer,
+		renderer:      NewReceiptRenderer(),
+	}
+
+	// Receipts count as emailed only once the mail has actually gone out,
+	// which may be on a later retry
+	if mailer != nil {
+		mailer.OnDelivered(domain.MailTemplateReceipt, s.markEmailed)
+	}
+
+	return s
+}
+
+// Attach renders the HTML version of a new receipt and uploads its PDF copy.
+// It is called before the receipt is saved.
+func (s *ReceiptService) Attach(ctx context.Context, receipt *domain.Receipt, order *domain.Order, items []*domain.OrderItem) error {
+	doc := s.buildDocument(ctx, receipt, order, items)
+
+	html, err := s.renderer.RenderHTML(doc)
+	if err != nil {
+		return err
+	}
+	receipt.ReceiptHTML = html
+
+	if s.storage != nil {
+		path := fmt.Sprintf("receipts/%s/%s.pdf", order.TenantID, receipt.ReceiptNumber)
+		if err := s.storage.Upload(ctx, path, bytes.NewReader(s.renderer.RenderPDF(doc))); err != nil {
+			return fmt.Errorf("failed to store receipt PDF: %w", err)
+		}
+		receipt.ReceiptPDFPath = path
+	}
+
+	return nil
+}
+
+// Email queues the receipt for the order's customer with the PDF attached. The
+// mail retry queue sends it, so a slow mail server never holds up a payment.
+func (s *ReceiptService) Email(ctx context.Context, receipt *domain.Receipt, order *domain.Order, items []*domain.OrderItem) error {
+	if s.mailer == nil {
+		return errors.New("mail is not configured")
+	}
+
+	recipient := receipt.EmailRecipient
+	if recipient == "" {
+		recipient = order.CustomerEmail
+	}
+	if recipient == "" {
+		return errors.New("order has no customer email")
+	}
+
+	doc := s.buildDocument(ctx, receipt, order, items)
+	html := receipt.ReceiptHTML
+	if html == "" {
+		rendered, err := s.renderer.RenderHTML(doc)
+		if err != nil {
+			return err
+		}
+		html = rendered
+	}
+
+	_, err := s.mailer.Enqueue(ctx, &MailRequest{
+		TenantID: order.TenantID,
+		Template: domain.MailTemplateReceipt,
+		To:       []string{recipient},
+		Data: map[string]interface{}{
+			"Order":       order,
+			"Receipt":     receipt,
+			"ReceiptHTML": htmltemplate.HTML(html),
+		},
+		Attachments: []domain.MailAttachment{{
+			Filename:    fmt.Sprintf("receipt-%s.pdf", receipt.ReceiptNumber),
+			ContentType: "application/pdf",
+			Data:        s.renderer.RenderPDF(doc),
+		}},
+		ReferenceType: domain.MailTemplateReceipt,
+		ReferenceID:   &receipt.ID,
+	})
+	return err
+}
+
+func (s *ReceiptService) markEmailed(ctx context.Context, delivery *domain.MailDelivery) error {
+	if delivery.ReferenceID == nil {
+		return nil
+	}
+	recipient := ""
+	if len(delivery.Recipients) > 0 {
+		recipient = delivery.Recipients[0]
+	}
+	return s.receiptRepo.UpdateEmailStatus(ctx, *delivery.ReferenceID, true, delivery.SentAt, recipient)
+}
+
+// Render returns the receipt in the requested format without counting it as printed
+func (s *ReceiptService) Render(ctx context.Context, tenantID string, receiptID uuid.UUID, format string, paperWidth int) ([]byte, string, error) {
+	_, doc, err := s.loadDocument(ctx, tenantID, receiptID)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.render(doc, format, paperWidth)
+}
+
+// Reprint renders the receipt again, marked as a reprint after the first print,
+// and increments its print count. The count is incremented in the database
+// first, so of two prints at the same time only one is the original.
+func (s *ReceiptService) Reprint(ctx context.Context, tenantID string, receiptID uuid.UUID, format string, paperWidth int) ([]byte, string, error) {
+	receipt, doc, err := s.loadDocument(ctx, tenantID, receiptID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	printCount, err := s.receiptRepo.IncrementPrintCount(ctx, receipt.ID, time.Now())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to update receipt print status: %w", err)
+	}
+	doc.Reprint = printCount > 1
+
+	return s.render(doc, format, paperWidth)
+}
+
+func (s *ReceiptService) render(doc *ReceiptDocument, format string, paperWidth int) ([]byte, string, error) {
+	switch strings.ToLower(format) {
+	case "", ReceiptFormatHTML:
+		html, err := s.renderer.RenderHTML(doc)
+		if err != nil {
+			return nil, "", err
+		}
+		return []byte(html), "text/html; charset=utf-8", nil
+	case ReceiptFormatPDF:
+		return s.renderer.RenderPDF(doc), "application/pdf", nil
+	case ReceiptFormatESCPOS:
+		return s.renderer.RenderESCPOS(doc, paperWidth), "application/octet-stream", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported receipt format: %s", format)
+	}
+}
+
+func (s *ReceiptService) loadDocument(ctx context.Context, tenantID string, receiptID uuid.UUID) (*domain.Receipt, *ReceiptDocument, error) {
+	receipt, err := s.receiptRepo.GetByID(ctx, receiptID)
+	if err != nil || receipt == nil || receipt.TenantID != tenantID {
+		return nil, nil, ErrReceiptNotFound
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, receipt.OrderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	items, err := s.orderItemRepo.GetByOrderID(ctx, order.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get order items: %w", err)
+	}
+
+	return receipt, s.buildDocument(ctx, receipt, order, items), nil
+}
+
+func (s *ReceiptService) buildDocument(ctx context.Context, receipt *domain.Receipt, order *domain.Order, items []*domain.OrderItem) *ReceiptDocument {
+	doc := &ReceiptDocument{
+		StoreName:        order.TenantID,
+		ReceiptNumber:    receipt.ReceiptNumber,
+		OrderNumber:      order.OrderNumber,
+		Date:             order.DateCreated,
+		Currency:         order.Currency,
+		Subtotal:         order.Subtotal,
+		DiscountTotal:    order.DiscountTotal,
+		ShippingTotal:    order.ShippingTotal,
+		TaxTotal:         order.TaxTotal,
+		Total:            order.Total,
+		PricesIncludeTax: metadataBool(order.Metadata, "prices_include_tax"),
+		PaymentMethod:    order.PaymentMethodTitle,
+	}
+	if order.DatePaid != nil {
+		doc.Date = *order.DatePaid
+	}
+	if doc.PaymentMethod == "" {
+		doc.PaymentMethod = order.PaymentMethod
+	}
+
+	if tenant := loadTenant(ctx, s.tenantRepo, order.TenantID); tenant != nil {
+		doc.StoreName = tenant.Name
+		if tenant.Branding != nil {
+			doc.Branding = *tenant.Branding
+		}
+	}
+
+	taxGroups := make([][]domain.TaxLine, 0, len(items)+1)
+	for _, item := range items {
+		doc.Lines = append(doc.Lines, ReceiptLine{
+			Name:       item.ProductName,
+			SKU:        item.ProductSKU,
+			Attributes: formatVariationAttributes(metadataMap(item.Metadata, itemMetadataAttributes)),
+			Quantity:   item.Quantity,
+			UnitPrice:  item.UnitPrice,
+			Total:      item.TotalPrice,
+			Discount:   metadataFloat(item.Metadata, itemMetadataDiscountTotal),
+			Tax:        item.TaxTotal,
+		})
+		taxGroups = append(taxGroups, item.TaxLines)
+	}
+	taxGroups = append(taxGroups, orderTaxLines(order.Metadata["shipping_tax_lines"]))
+	doc.Taxes = summarizeTaxLines(taxGroups...)
+
+	return doc
+}
@@ -0,0 +1,461 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+var (
+	// ErrRegisterSessionNotFound is returned when a register session does not exist for the tenant
+	ErrRegisterSessionNotFound = errors.New("register session not found")
+	// ErrRegisterSessionClosed is returned when money is put through a session that has been closed
+	ErrRegisterSessionClosed = errors.New("register session is closed")
+	// ErrRegisterPaymentsInProgress is returned when a session is closed while a
+	// gateway call put through it is yet to be recorded
+	ErrRegisterPaymentsInProgress = errors.New("register session has payments in progress")
+)
+
+// Register report types. An X report is a mid-shift reading; a Z report is
+// taken when the session closes and is stored on it.
+const (
+	RegisterReportX = "X"
+	RegisterReportZ = "Z"
+)
+
+// RegisterReport totals the money taken on a register session by payment method
+type RegisterReport struct {
+	Type         string     `json:"type"` // X or Z
+	SessionID    uuid.UUID  `json:"session_id"`
+	RegisterName string     `json:"register_name"`
+	LocationID   *uuid.UUID `json:"location_id,omitempty"`
+	OpenedBy     uuid.UUID  `json:"opened_by"`
+	ClosedBy     *uuid.UUID `json:"closed_by,omitempty"`
+	OpenedAt     time.Time  `json:"opened_at"`
+	ClosedAt     *time.Time `json:"closed_at,omitempty"`
+	GeneratedAt  time.Time  `json:"generated_at"`
+
+	Tenders          []RegisterTenderTotal `json:"tenders"`
+	TransactionCount int                   `json:"transaction_count"`
+	GrossSales       float64               `json:"gross_sales"`
+	Refunds          float64               `json:"refunds"`
+	NetSales         float64               `json:"net_sales"`
+
+	// Cash drawer reconciliation
+	OpeningFloat float64  `json:"opening_float"`
+	CashSales    float64  `json:"cash_sales"`
+	CashRefunds  float64  `json:"cash_refunds"`
+	CashIn       float64  `json:"cash_in"`
+	CashOut      float64  `json:"cash_out"`
+	ExpectedCash float64  `json:"expected_cash"`
+	CountedCash  *float64 `json:"counted_cash,omitempty"`
+	CashVariance float64  `json:"cash_variance"`
+}
+
+// RegisterTenderTotal is the takings for one payment method
+type RegisterTenderTotal struct {
+	PaymentMethod string  `json:"payment_method"`
+	Payments      int     `json:"payments"`
+	Sales         float64 `json:"sales"`
+	RefundCount   int     `json:"refund_count"`
+	Refunds       float64 `json:"refunds"`
+	Net           float64 `json:"net"`
+}
+
+// RegisterService opens and closes register shifts, tracks cash moved in and
+// out of the drawer and reconciles the drawer count against the takings
+type RegisterService struct {
+	txManager    repositories.TransactionManager
+	sessionRepo  repositories.RegisterSessionRepository
+	movementRepo repositories.CashMovementRepository
+	paymentRepo  repositories.PaymentTransactionRepository
+	inventory    *InventoryService
+	auditService AuditService
+}
+
+func NewRegisterService(
+	txManager repositories.TransactionManager,
+	sessionRepo repositories.RegisterSessionRepository,
+	movementRepo repositories.CashMovementRepository,
+	paymentRepo repositories.PaymentTransactionRepository,
+	inventory *InventoryService,
+	auditService AuditService,
+) *RegisterService {
+	return &RegisterService{
+		txManager:    txManager,
+		sessionRepo:  sessionRepo,
+		movementRepo: movementRepo,
+		paymentRepo:  paymentRepo,
+		inventory:    inventory,
+		auditService: auditService,
+	}
+}
+
+// OpenSession starts a shift on a register with the cash counted into the drawer.
+// A register can only have one open session at a time.
+func (s *RegisterService) OpenSession(ctx context.Context, tenantID string, locationID *uuid.UUID, registerName string, openingFloat float64, userID uuid.UUID, notes string) (*domain.RegisterSession, error) {
+	registerName = strings.TrimSpace(registerName)
+	if registerName == "" {
+		return nil, errors.New("register name is required")
+	}
+	if openingFloat < 0 {
+		return nil, errors.New("opening float cannot be negative")
+	}
+
+	if locationID != nil {
+		if s.inventory == nil {
+			return nil, errors.New("stock locations are not supported")
+		}
+		if _, err := s.inventory.GetLocation(ctx, tenantID, *locationID); err != nil {
+			return nil, err
+		}
+	}
+
+	session := &domain.RegisterSession{
+		TenantID:     tenantID,
+		LocationID:   locationID,
+		RegisterName: registerName,
+		Status:       domain.RegisterSessionStatusOpen,
+		OpeningFloat: roundCurrency(openingFloat),
+		OpenedBy:     userID,
+		OpenedAt:     time.Now(),
+		Notes:        notes,
+	}
+
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		open, err := s.sessionRepo.GetOpenByRegister(ctx, tenantID, locationID, registerName)
+		if err != nil {
+			return fmt.Errorf("failed to check register: %w", err)
+		}
+		if open != nil {
+			return fmt.Errorf("register %s already has an open session", registerName)
+		}
+
+		// The open session index catches a session opened by a concurrent request
+		if err := s.sessionRepo.Create(ctx, session); errors.Is(err, repositories.ErrDuplicateKey) {
+			return fmt.Errorf("register %s already has an open session", registerName)
+		} else if err != nil {
+			return fmt.Errorf("failed to create register session: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetSession returns a tenant's register session
+func (s *RegisterService) GetSession(ctx context.Context, tenantID string, sessionID uuid.UUID) (*domain.RegisterSession, error) {
+	session, err := s.sessionRepo.GetByID(ctx, sessionID)
+	if err != nil || session == nil || session.TenantID != tenantID {
+		return nil, ErrRegisterSessionNotFound
+	}
+	return session, nil
+}
+
+// RequireOpenSession returns the session when it is open, so payments can be taken on it
+func (s *RegisterService) RequireOpenSession(ctx context.Context, tenantID string, sessionID uuid.UUID) (*domain.RegisterSession, error) {
+	session, err := s.GetSession(ctx, tenantID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != domain.RegisterSessionStatusOpen {
+		return nil, ErrRegisterSessionClosed
+	}
+	return session, nil
+}
+
+// ShareOpenSession checks the session is open and keeps it from being closed
+// until the surrounding transaction ends. Payments and refunds taken on the
+// register call it in the transaction that records them, so every one of them
+// is either refused or counted in the Z report.
+func (s *RegisterService) ShareOpenSession(ctx context.Context, tenantID string, sessionID uuid.UUID) (*domain.RegisterSession, error) {
+	session, err := s.sessionRepo.GetByIDForShare(ctx, sessionID)
+	if err != nil || session == nil || session.TenantID != tenantID {
+		return nil, ErrRegisterSessionNotFound
+	}
+	if session.Status != domain.RegisterSessionStatusOpen {
+		return nil, ErrRegisterSessionClosed
+	}
+	return session, nil
+}
+
+// RecordCashMovement logs cash added to or removed from the drawer outside a
+// sale. Cash cannot be taken out beyond what the drawer should hold.
+func (s *RegisterService) RecordCashMovement(ctx context.Context, tenantID string, sessionID uuid.UUID, movementType string, amount float64, reason string, userID *uuid.UUID) (*domain.CashMovement, error) {
+	if movementType != domain.CashMovementTypeIn && movementType != domain.CashMovementTypeOut {
+		return nil, fmt.Errorf("invalid cash movement type: %s", movementType)
+	}
+	if amount <= 0 {
+		return nil, errors.New("cash movement amount must be positive")
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("a reason is required for cash movements")
+	}
+
+	movement := &domain.CashMovement{
+		TenantID:  tenantID,
+		SessionID: sessionID,
+		Type:      movementType,
+		Amount:    roundCurrency(amount),
+		Reason:    reason,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		session, err := s.lockOpenSession(ctx, tenantID, sessionID)
+		if err != nil {
+			return err
+		}
+
+		if movementType == domain.CashMovementTypeOut {
+			report, err := s.buildReport(ctx, session, RegisterReportX)
+			if err != nil {
+				return err
+			}
+			if movement.Amount > report.ExpectedCash {
+				return fmt.Errorf("cannot take out %.2f: the drawer should only hold %.2f", movement.Amount, report.ExpectedCash)
+			}
+		}
+
+		if err := s.movementRepo.Create(ctx, movement); err != nil {
+			return fmt.Errorf("failed to record cash movement: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return movement, nil
+}
+
+// XReport reads the session's takings so far without closing it
+func (s *RegisterService) XReport(ctx context.Context, tenantID string, sessionID uuid.UUID) (*RegisterReport, error) {
+	session, err := s.GetSession(ctx, tenantID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status == domain.RegisterSessionStatusClosed {
+		return s.ZReport(ctx, tenantID, sessionID)
+	}
+	return s.buildReport(ctx, session, RegisterReportX)
+}
+
+// ZReport returns the report stored when the session was closed
+func (s *RegisterService) ZReport(ctx context.Context, tenantID string, sessionID uuid.UUID) (*RegisterReport, error) {
+	session, err := s.GetSession(ctx, tenantID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != domain.RegisterSessionStatusClosed || session.ZReport == nil {
+		return nil, errors.New("register session has not been closed")
+	}
+
+	data, err := json.Marshal(session.ZReport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Z report: %w", err)
+	}
+	var report RegisterReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to read Z report: %w", err)
+	}
+	return &report, nil
+}
+
+// CloseSession ends the shift with the cash counted in the drawer and stores the
+// Z report on the session. Any difference between the count and the expected
+// cash is written to the audit log.
+func (s *RegisterService) CloseSession(ctx context.Context, tenantID string, sessionID uuid.UUID, countedCash float64, userID uuid.UUID, notes string) (*RegisterReport, error) {
+	if countedCash < 0 {
+		return nil, errors.New("counted cash cannot be negative")
+	}
+
+	var report *RegisterReport
+	var session *domain.RegisterSession
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		session, err = s.lockOpenSession(ctx, tenantID, sessionID)
+		if err != nil {
+			return err
+		}
+
+		report, err = s.buildReport(ctx, session, RegisterReportZ)
+		if err != nil {
+			return err
+		}
+
+		now := report.GeneratedAt
+		counted := roundCurrency(countedCash)
+		report.ClosedBy = &userID
+		report.ClosedAt = &now
+		report.CountedCash = &counted
+		report.CashVariance = roundCurrency(counted - report.ExpectedCash)
+
+		stored, err := toJSONMap(report)
+		if err != nil {
+			return err
+		}
+
+		session.Status = domain.RegisterSessionStatusClosed
+		session.ExpectedCash = report.ExpectedCash
+		session.CountedCash = &counted
+		session.CashVariance = report.CashVariance
+		session.ClosedBy = &userID
+		session.ClosedAt = &now
+		session.ZReport = stored
+		if notes != "" {
+			session.Notes = strings.TrimSpace(session.Notes + "\n" + notes)
+		}
+
+		if err := s.sessionRepo.Update(ctx, session); err != nil {
+			return fmt.Errorf("failed to close register session: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if report.CashVariance != 0 {
+		s.logVariance(ctx, session, report, userID)
+	}
+
+	return report, nil
+}
+
+// lockOpenSession locks a tenant's session and checks it is still open. It must
+// run inside a transaction.
+func (s *RegisterService) lockOpenSession(ctx context.Context, tenantID string, sessionID uuid.UUID) (*domain.RegisterSession, error) {
+	session, err := s.sessionRepo.GetByIDForUpdate(ctx, sessionID)
+	if err != nil || session == nil || session.TenantID != tenantID {
+		return nil, ErrRegisterSessionNotFound
+	}
+	if session.Status != domain.RegisterSessionStatusOpen {
+		return nil, ErrRegisterSessionClosed
+	}
+	return session, nil
+}
+
+// buildReport totals the session's completed payments and refunds by payment
+// method and works out the cash the drawer should hold
+func (s *RegisterService) buildReport(ctx context.Context, session *domain.RegisterSession, reportType string) (*RegisterReport, error) {
+	transactions, err := s.paymentRepo.GetByRegisterSessionID(ctx, session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get register transactions: %w", err)
+	}
+	movements, err := s.movementRepo.GetBySessionID(ctx, session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cash movements: %w", err)
+	}
+
+	report := &RegisterReport{
+		Type:         reportType,
+		SessionID:    session.ID,
+		RegisterName: session.RegisterName,
+		LocationID:   session.LocationID,
+		OpenedBy:     session.OpenedBy,
+		OpenedAt:     session.OpenedAt,
+		GeneratedAt:  time.Now(),
+		OpeningFloat: session.OpeningFloat,
+	}
+
+	tenders := make(map[string]*RegisterTenderTotal)
+	tender := func(method string) *RegisterTenderTotal {
+		method = strings.ToLower(method)
+		if method == "" {
+			method = "other"
+		}
+		if tenders[method] == nil {
+			tenders[method] = &RegisterTenderTotal{PaymentMethod: method}
+		}
+		return tenders[method]
+	}
+
+	for _, tx := range transactions {
+		// The Z report is final, so it waits for payments still at the gateway
+		if reportType == RegisterReportZ && isInFlight(tx, report.GeneratedAt) {
+			return nil, ErrRegisterPaymentsInProgress
+		}
+		switch {
+		case isSettledPayment(tx):
+			total := tender(tx.PaymentMethod)
+			total.Payments++
+			total.Sales += tx.Amount
+			report.GrossSales += tx.Amount
+		case isRefund(tx):
+			total := tender(tx.PaymentMethod)
+			total.RefundCount++
+			total.Refunds += tx.Amount
+			report.Refunds += tx.Amount
+		default:
+			continue
+		}
+		report.TransactionCount++
+	}
+
+	for _, total := range tenders {
+		total.Sales = roundCurrency(total.Sales)
+		total.Refunds = roundCurrency(total.Refunds)
+		total.Net = roundCurrency(total.Sales - total.Refunds)
+		report.Tenders = append(report.Tenders, *total)
+	}
+	sort.Slice(report.Tenders, func(i, j int) bool {
+		return report.Tenders[i].PaymentMethod < report.Tenders[j].PaymentMethod
+	})
+
+	if cash := tenders[domain.PaymentMethodCash]; cash != nil {
+		report.CashSales = cash.Sales
+		report.CashRefunds = cash.Refunds
+	}
+	for _, movement := range movements {
+		switch movement.Type {
+		case domain.CashMovementTypeIn:
+			report.CashIn += movement.Amount
+		case domain.CashMovementTypeOut:
+			report.CashOut += movement.Amount
+		}
+	}
+
+	report.GrossSales = roundCurrency(report.GrossSales)
+	report.Refunds = roundCurrency(report.Refunds)
+	report.NetSales = roundCurrency(report.GrossSales - report.Refunds)
+	report.CashIn = roundCurrency(report.CashIn)
+	report.CashOut = roundCurrency(report.CashOut)
+	report.ExpectedCash = roundCurrency(report.OpeningFloat + report.CashSales - report.CashRefunds + report.CashIn - report.CashOut)
+
+	return report, nil
+}
+
+// logVariance records a drawer shortage or overage in the audit log. Audit
+// failures do not undo the close.
+func (s *RegisterService) logVariance(ctx context.Context, session *domain.RegisterSession, report *RegisterReport, userID uuid.UUID) {
+	if s.auditService == nil {
+		return
+	}
+
+	tenantID, err := uuid.Parse(session.TenantID)
+	if err != nil {
+		tenantID = uuid.Nil
+	}
+
+	s.auditService.LogEvent(ctx, tenantID, &userID, domain.ActionCashVariance, domain.ResourceRegisterSession, session.ID.String(), map[string]interface{}{
+		"register_name": session.RegisterName,
+		"location_id":   session.LocationID,
+		"opened_by":     session.OpenedBy,
+		"expected_cash": report.ExpectedCash,
+		"counted_cash":  report.CountedCash,
+		"variance":      report.CashVariance,
+	})
+}
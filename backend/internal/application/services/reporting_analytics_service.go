@@ -71,6 +71,7 @@ type ReportingAnalyticsServiceImpl struct {
 	scheduleRepo      domain.ReportScheduleRepository
 	userRepo          domain.UserRepository
 	orderRepo         domain.OrderRepository
+	valuation         *InventoryValuationService
 	logger            *zap.Logger
 }
 
@@ -83,6 +84,7 @@ func NewReportingAnalyticsService(
 	scheduleRepo domain.ReportScheduleRepository,
 	userRepo domain.UserRepository,
 	orderRepo domain.OrderRepository,
+	valuation *InventoryValuationService,
 	logger *zap.Logger,
 ) ReportingAnalyticsService {
 	return &ReportingAnalyticsServiceImpl{
@@ -93,6 +95,7 @@ func NewReportingAnalyticsService(
 		scheduleRepo:      scheduleRepo,
 		userRepo:          userRepo,
 		orderRepo:         orderRepo,
+		valuation:         valuation,
 		logger:            logger,
 	}
 }
@@ -321,6 +324,8 @@ func (s *ReportingAnalyticsServiceImpl) GenerateReport(ctx context.Context, tena
 		reportData, summary, err = s.generateUserReportData(ctx, tenantID, report.PeriodStart, report.PeriodEnd, report.Parameters)
 	case "system":
 		reportData, summary, err = s.generateSystemReportData(ctx, tenantID, report.PeriodStart, report.PeriodEnd, report.Parameters)
+	case "inventory":
+		reportData, summary, err = s.generateInventoryReportData(ctx, tenantID, report.PeriodStart, report.PeriodEnd, report.Parameters)
 	default:
 		err = fmt.Errorf("unsupported report type: %s", report.ReportType)
 	}
@@ -604,6 +609,67 @@ func (s *ReportingAnalyticsServiceImpl) generateSystemReportData(ctx context.Con
 	return reportData, summary, nil
 }
 
+// generateInventoryReportData generates stock valuation and cost of goods sold
+// report data. Parameters: section ("valuation" values stock at the end of the
+// period, "cogs" reports margins for the period, empty includes both),
+// costing_method (fifo or weighted_average) and location_id.
+func (s *ReportingAnalyticsServiceImpl) generateInventoryReportData(ctx context.Context, tenantID string, startDate, endDate time.Time, parameters map[string]interface{}) (map[string]interface{}, map[string]interface{}, error) {
+	if s.valuation == nil {
+		return nil, nil, fmt.Errorf("inventory valuation is not configured")
+	}
+
+	section, _ := parameters["section"].(string)
+	method, _ := parameters["costing_method"].(string)
+	var locationID *uuid.UUID
+	if value, ok := parameters["location_id"].(string); ok && value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid location_id: %w", err)
+		}
+		locationID = &id
+	}
+
+	reportData := map[string]interface{}{
+		"period": map[string]interface{}{
+			"start_date": startDate,
+			"end_date":   endDate,
+		},
+	}
+	summary := map[string]interface{}{
+		"generated_at": time.Now(),
+	}
+
+	if section == "" || section == "valuation" {
+		valuation, err := s.valuation.Valuation(ctx, tenantID, endDate, method, locationID)
+		if err != nil {
+			return nil, nil, err
+		}
+		reportData["valuation"] = valuation
+		summary["costing_method"] = valuation.Method
+		summary["stock_units"] = valuation.TotalUnits
+		summary["stock_value"] = valuation.TotalValue
+	}
+
+	if section == "" || section == "cogs" {
+		cogs, err := s.valuation.CostOfGoodsSold(ctx, tenantID, startDate, endDate, method, locationID)
+		if err != nil {
+			return nil, nil, err
+		}
+		reportData["cogs"] = cogs
+		summary["costing_method"] = cogs.Method
+		summary["revenue"] = cogs.Revenue
+		summary["cogs"] = cogs.COGS
+		summary["gross_profit"] = cogs.GrossProfit
+		summary["margin_percent"] = cogs.Margin
+	}
+
+	if len(reportData) == 1 {
+		return nil, nil, fmt.Errorf("unsupported inventory report section: %s", section)
+	}
+
+	return reportData, summary, nil
+}
+
 // generateReportFile generates report file in specified format
 func (s *ReportingAnalyticsServiceImpl) generateReportFile(ctx context.Context, report *domain.AnalyticsReport, data map[string]interface{}) (string, string, int64, error) {
 	// This would integrate with file management service
@@ -0,0 +1,711 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+var (
+	// ErrInvalidSyncRequest is returned when a sync batch is malformed
+	ErrInvalidSyncRequest = errors.New("invalid sync request")
+	// ErrInvalidSyncCursor is returned when a terminal sends a cursor the server did not issue
+	ErrInvalidSyncCursor = errors.New("invalid sync cursor")
+)
+
+const (
+	// DefaultSyncCatalogPageSize caps each kind of catalog record returned by one sync
+	DefaultSyncCatalogPageSize = 500
+	// DefaultSyncCommitWindow is how old a catalog change must be before it is
+	// synced. updated_at is set when a row is written, not when its transaction
+	// commits, so the window must outlast the longest catalog write transaction.
+	DefaultSyncCommitWindow = time.Minute
+	// MaxSyncBatchItems caps the orders, payments and stock movements uploaded in one sync
+	MaxSyncBatchItems = 500
+)
+
+// Sync conflict types
+const (
+	SyncConflictOversell      = "oversell"       // Not enough stock on the server for an offline sale or removal
+	SyncConflictPrice         = "price"          // The terminal charged a different price than the catalog
+	SyncConflictTotal         = "total"          // The server's order total differs from the terminal's
+	SyncConflictPaymentAmount = "payment_amount" // The terminal took a different amount than the balance due
+)
+
+// SyncRequest is a batch of work a POS terminal did while offline, plus the
+// cursor of its last catalog download
+type SyncRequest struct {
+	TerminalID        string              `json:"terminal_id"`
+	Cursor            string              `json:"cursor"`                        // From the previous sync; empty downloads the whole catalog
+	LocationID        *uuid.UUID          `json:"location_id,omitempty"`         // Location the terminal sells from; the tenant default when empty
+	RegisterSessionID *uuid.UUID          `json:"register_session_id,omitempty"` // Register shift the payments were taken on
+	Orders            []SyncOrder         `json:"orders"`
+	Payments          []SyncPayment       `json:"payments"`
+	StockMovements    []SyncStockMovement `json:"stock_movements"`
+}
+
+// SyncOrder is an order rung up on a terminal while offline
+type SyncOrder struct {
+	ClientID  uuid.UUID           `json:"client_id"`
+	CreatedAt time.Time           `json:"created_at"`
+	Currency  string              `json:"currency"`
+	Customer  domain.CustomerInfo `json:"customer"`
+	Items     []SyncOrderItem     `json:"items"`
+	Total     float64             `json:"total"` // As worked out on the terminal
+}
+
+// SyncOrderItem is one line of an offline order
+type SyncOrderItem struct {
+	ProductID   uuid.UUID  `json:"product_id"`
+	VariationID *uuid.UUID `json:"variation_id,omitempty"`
+	Quantity    int        `json:"quantity"`
+	UnitPrice   float64    `json:"unit_price"` // Price charged on the terminal
+}
+
+// SyncPayment is a payment taken offline against an order in the same or an earlier batch
+type SyncPayment struct {
+	ClientID      uuid.UUID `json:"client_id"`
+	OrderClientID uuid.UUID `json:"order_client_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Gateway       string    `json:"gateway"`
+	Method        string    `json:"method"`
+	MethodTitle   string    `json:"method_title"`
+	Amount        float64   `json:"amount"`
+	TransactionID string    `json:"transaction_id"`
+	Token         string    `json:"token"`
+	// Partial marks one tender of a split payment: Amount is charged rather
+	// than the balance due
+	Partial bool `json:"partial"`
+}
+
+// SyncStockMovement is a stock adjustment recorded on a terminal while offline
+type SyncStockMovement struct {
+	ClientID    uuid.UUID  `json:"client_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ProductID   uuid.UUID  `json:"product_id"`
+	VariationID *uuid.UUID `json:"variation_id,omitempty"`
+	Quantity    int        `json:"quantity"` // Positive adds stock, negative removes it
+	Reason      string     `json:"reason"`
+}
+
+// SyncResult reports what happened to every uploaded item and carries the
+// catalog changes since the terminal's cursor
+type SyncResult struct {
+	Results    []SyncItemResult `json:"results"`
+	Catalog    SyncCatalogDelta `json:"catalog"`
+	Cursor     string           `json:"cursor"` // Send with the next sync
+	ServerTime time.Time        `json:"server_time"`
+}
+
+// SyncItemResult is the resolution of one uploaded item
+type SyncItemResult struct {
+	ClientID    uuid.UUID      `json:"client_id"`
+	EntityType  string         `json:"entity_type"`
+	Status      string         `json:"status"` // applied, conflict, duplicate, rejected
+	ServerID    *uuid.UUID     `json:"server_id,omitempty"`
+	OrderNumber string         `json:"order_number,omitempty"`
+	Conflicts   []SyncConflict `json:"conflicts,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// SyncConflict describes a difference between the terminal and the server and how it was resolved
+type SyncConflict struct {
+	Type        string     `json:"type"`
+	ProductID   *uuid.UUID `json:"product_id,omitempty"`
+	VariationID *uuid.UUID `json:"variation_id,omitempty"`
+	ClientValue float64    `json:"client_value"`
+	ServerValue float64    `json:"server_value"`
+	Resolution  string     `json:"resolution"`
+}
+
+// SyncCatalogDelta holds catalog records changed since the cursor. Deleted
+// categories and products carry deleted_at. Terminals apply them as upserts,
+// so a record may be sent more than once.
+type SyncCatalogDelta struct {
+	Categories []*domain.ProductCategory  `json:"categories"`
+	Products   []*domain.Product          `json:"products"`
+	Variations []*domain.ProductVariation `json:"variations"`
+	HasMore    bool                       `json:"has_more"` // More changes remain; sync again with the returned cursor
+}
+
+// SyncService applies work done on offline POS terminals and sends them the
+// catalog changes they missed. Items are keyed by client-generated IDs, so a
+// batch can be re-sent after a dropped connection without applying anything twice.
+type SyncService struct {
+	txManager     repositories.TransactionManager
+	syncRepo      repositories.SyncRecordRepository
+	categoryRepo  repositories.ProductCategoryRepository
+	productRepo   repositories.ProductRepository
+	variationRepo repositories.ProductVariationRepository
+	cartRepo      repositories.CartRepository
+	cartItemRepo  repositories.CartItemRepository
+	orderRepo     repositories.OrderRepository
+	carts         *CartService
+	orders        *OrderService
+	inventory     *InventoryService
+
+	catalogPageSize int
+	commitWindow    time.Duration
+}
+
+func NewSyncService(
+	txManager repositories.TransactionManager,
+	syncRepo repositories.SyncRecordRepository,
+	categoryRepo repositories.ProductCategoryRepository,
+	productRepo repositories.ProductRepository,
+	variationRepo repositories.ProductVariationRepository,
+	cartRepo repositories.CartRepository,
+	cartItemRepo repositories.CartItemRepository,
+	orderRepo repositories.OrderRepository,
+	carts *CartService,
+	orders *OrderService,
+	inventory *InventoryService,
+) *SyncService {
+	return &SyncService{
+		txManager:     txManager,
+		syncRepo:      syncRepo,
+		categoryRepo:  categoryRepo,
+		productRepo:   productRepo,
+		variationRepo: variationRepo,
+		cartRepo:      cartRepo,
+		cartItemRepo:  cartItemRepo,
+		orderRepo:     orderRepo,
+		carts:         carts,
+		orders:        orders,
+		inventory:     inventory,
+
+		catalogPageSize: DefaultSyncCatalogPageSize,
+		commitWindow:    DefaultSyncCommitWindow,
+	}
+}
+
+// Sync applies a terminal's batch in the order the work happened: orders, then
+// the payments for them, then stock movements. Each item is applied on its own,
+// so one rejected item does not hold back the rest. Rejected items are not
+// remembered and can be sent again once the conflict has been sorted out.
+func (s *SyncService) Sync(ctx context.Context, tenantID string, userID *uuid.UUID, req *SyncRequest) (*SyncResult, error) {
+	req.TerminalID = strings.TrimSpace(req.TerminalID)
+	if req.TerminalID == "" {
+		return nil, fmt.Errorf("%w: terminal ID is required", ErrInvalidSyncRequest)
+	}
+	if len(req.Orders)+len(req.Payments)+len(req.StockMovements) > MaxSyncBatchItems {
+		return nil, fmt.Errorf("%w: at most %d items can be synced at once", ErrInvalidSyncRequest, MaxSyncBatchItems)
+	}
+
+	cursor, err := parseSyncCursor(req.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(req.Orders, func(i, j int) bool { return req.Orders[i].CreatedAt.Before(req.Orders[j].CreatedAt) })
+	sort.SliceStable(req.Payments, func(i, j int) bool { return req.Payments[i].CreatedAt.Before(req.Payments[j].CreatedAt) })
+	sort.SliceStable(req.StockMovements, func(i, j int) bool {
+		return req.StockMovements[i].CreatedAt.Before(req.StockMovements[j].CreatedAt)
+	})
+
+	result := &SyncResult{
+		Results: make([]SyncItemResult, 0, len(req.Orders)+len(req.Payments)+len(req.StockMovements)),
+	}
+	for _, order := range req.Orders {
+		result.Results = append(result.Results, s.syncOrder(ctx, tenantID, userID, req, order))
+	}
+	for _, payment := range req.Payments {
+		result.Results = append(result.Results, s.syncPayment(ctx, tenantID, req, payment))
+	}
+	for _, movement := range req.StockMovements {
+		result.Results = append(result.Results, s.syncStockMovement(ctx, tenantID, userID, req, movement))
+	}
+
+	// Changes newer than the commit window may belong to transactions that have
+	// not committed yet; they are left for the next sync
+	result.ServerTime = time.Now()
+	catalog, next, err := s.catalogDelta(ctx, tenantID, cursor, result.ServerTime.Add(-s.commitWindow))
+	if err != nil {
+		return nil, err
+	}
+	result.Catalog = catalog
+	result.Cursor = encodeSyncCursor(next)
+
+	return result, nil
+}
+
+// syncOrder rebuilds an offline order as a cart and checks it out, keeping the
+// prices the customer was charged. Orders that would oversell are rejected.
+func (s *SyncService) syncOrder(ctx context.Context, tenantID string, userID *uuid.UUID, req *SyncRequest, o SyncOrder) SyncItemResult {
+	result := SyncItemResult{ClientID: o.ClientID, EntityType: domain.SyncEntityOrder}
+	if duplicate, ok := s.findSynced(ctx, tenantID, o.ClientID); ok {
+		return duplicate
+	}
+	if o.ClientID == uuid.Nil {
+		return rejectSyncItem(result, errors.New("client ID is required"))
+	}
+	if len(o.Items) == 0 {
+		return rejectSyncItem(result, errors.New("order has no items"))
+	}
+
+	var location *domain.StockLocation
+	if s.inventory != nil {
+		var err error
+		location, err = s.inventory.ResolveLocation(ctx, tenantID, req.LocationID)
+		if err != nil {
+			return rejectSyncItem(result, err)
+		}
+	}
+
+	// Check prices and stock up front so every conflicting line is reported,
+	// not just the first one checkout trips over
+	cartItems := make([]*domain.CartItem, 0, len(o.Items))
+	requested := make(map[uuid.UUID]int)
+	var oversold []SyncConflict
+	for _, item := range o.Items {
+		if item.Quantity <= 0 {
+			return rejectSyncItem(result, fmt.Errorf("quantity for product %s must be positive", item.ProductID))
+		}
+
+		product, err := s.productRepo.GetByID(ctx, item.ProductID)
+		if err != nil || product.TenantID != tenantID {
+			return rejectSyncItem(result, fmt.Errorf("product %s not found", item.ProductID))
+		}
+		variation, err := resolveVariation(ctx, s.variationRepo, product, item.VariationID)
+		if err != nil {
+			return rejectSyncItem(result, err)
+		}
+
+		if product.ManageStock {
+			key := stockKey(product.ID, item.VariationID)
+			requested[key] += item.Quantity
+			available := availableStockFor(product, variation)
+			if location != nil {
+				available, err = s.inventory.StockAt(ctx, location.ID, product.ID, item.VariationID)
+				if err != nil {
+					return rejectSyncItem(result, err)
+				}
+			}
+			if requested[key] > available {
+				oversold = append(oversold, SyncConflict{
+					Type:        SyncConflictOversell,
+					ProductID:   &product.ID,
+					VariationID: item.VariationID,
+					ClientValue: float64(requested[key]),
+					ServerValue: float64(available),
+					Resolution:  "order_not_created",
+				})
+			}
+		}
+
+		catalogPrice := unitPriceFor(product, variation)
+		cartItems = append(cartItems, &domain.CartItem{
+			ID:          uuid.New(),
+			ProductID:   product.ID,
+			VariationID: item.VariationID,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			TotalPrice:  roundCurrency(item.UnitPrice * float64(item.Quantity)),
+			BasePrice:   &catalogPrice,
+			PriceLocked: true,
+			ProductData: productSnapshot(product, variation),
+		})
+	}
+
+	// Terminals apply the price lists too, so a line only conflicts when its
+	// price differs from what the price lists would have charged here
+	quoted, err := s.carts.QuoteUnitPrices(ctx, &domain.Cart{
+		TenantID:   tenantID,
+		CustomerID: o.Customer.CustomerID,
+		LocationID: req.LocationID,
+	}, cartItems)
+	if err != nil {
+		return rejectSyncItem(result, err)
+	}
+	for _, item := range cartItems {
+		if roundCurrency(item.UnitPrice) != roundCurrency(quoted[item.ID]) {
+			result.Conflicts = append(result.Conflicts, SyncConflict{
+				Type:        SyncConflictPrice,
+				ProductID:   &item.ProductID,
+				VariationID: item.VariationID,
+				ClientValue: item.UnitPrice,
+				ServerValue: quoted[item.ID],
+				Resolution:  "kept_terminal_price",
+			})
+		}
+	}
+
+	if len(oversold) > 0 {
+		result.Conflicts = append(result.Conflicts, oversold...)
+		return rejectSyncItem(result, ErrInsufficientStock)
+	}
+
+	currency := o.Currency
+	if currency == "" {
+		currency = "USD"
+	}
+
+	checked := result.Conflicts
+
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		cart := &domain.Cart{
+			TenantID:   tenantID,
+			UserID:     userID,
+			SessionID:  fmt.Sprintf("sync:%s:%s", req.TerminalID, o.ClientID),
+			LocationID: req.LocationID,
+			Status:     domain.CartStatusActive,
+			Currency:   currency,
+		}
+		if err := s.cartRepo.Create(ctx, cart); err != nil {
+			return fmt.Errorf("failed to create cart: %w", err)
+		}
+		for _, item := range cartItems {
+			item.CartID = cart.ID
+		}
+		if err := s.cartItemRepo.BulkCreate(ctx, cartItems); err != nil {
+			return fmt.Errorf("failed to create cart items: %w", err)
+		}
+		if err := s.carts.RecalculateCartTotals(ctx, cart.ID); err != nil {
+			return err
+		}
+
+		order, err := s.orders.CreateOrderFromCart(ctx, cart.ID, o.Customer)
+		if err != nil {
+			return err
+		}
+
+		if o.Total > 0 && roundCurrency(o.Total) != order.Total {
+			result.Conflicts = append(result.Conflicts, SyncConflict{
+				Type:        SyncConflictTotal,
+				ClientValue: o.Total,
+				ServerValue: order.Total,
+				Resolution:  "kept_server_total",
+			})
+		}
+
+		if !o.CreatedAt.IsZero() {
+			order.DateCreated = o.CreatedAt
+		}
+		if order.Metadata == nil {
+			order.Metadata = make(map[string]interface{})
+		}
+		order.Metadata["offline"] = map[string]interface{}{
+			"terminal_id": req.TerminalID,
+			"client_id":   o.ClientID,
+			"created_at":  o.CreatedAt,
+		}
+		if err := s.orderRepo.Update(ctx, order); err != nil {
+			return fmt.Errorf("failed to update order: %w", err)
+		}
+
+		result.ServerID = &order.ID
+		result.OrderNumber = order.OrderNumber
+		return s.recordSynced(ctx, tenantID, req.TerminalID, o.CreatedAt, &result)
+	})
+	if err != nil {
+		// Stock can still run out between the check above and checkout
+		result.Conflicts = checked
+		if errors.Is(err, ErrInsufficientStock) {
+			result.Conflicts = append(result.Conflicts, SyncConflict{Type: SyncConflictOversell, Resolution: "order_not_created"})
+		}
+		result.ServerID = nil
+		result.OrderNumber = ""
+		return rejectSyncItem(result, err)
+	}
+
+	return result
+}
+
+// syncPayment charges an order synced earlier. Offline payments settle the
+// balance due; a different amount taken on the terminal is reported as a
+// conflict. Tenders of a split payment charge their own amount.
+func (s *SyncService) syncPayment(ctx context.Context, tenantID string, req *SyncRequest, p SyncPayment) SyncItemResult {
+	result := SyncItemResult{ClientID: p.ClientID, EntityType: domain.SyncEntityPayment}
+	if duplicate, ok := s.findSynced(ctx, tenantID, p.ClientID); ok {
+		return duplicate
+	}
+	if p.ClientID == uuid.Nil {
+		return rejectSyncItem(result, errors.New("client ID is required"))
+	}
+
+	orderRecord, err := s.syncRepo.GetByClientID(ctx, tenantID, p.OrderClientID)
+	if err != nil || orderRecord == nil || orderRecord.EntityType != domain.SyncEntityOrder || orderRecord.ServerID == nil {
+		return rejectSyncItem(result, fmt.Errorf("order %s has not been synced", p.OrderClientID))
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, *orderRecord.ServerID)
+	if err != nil {
+		return rejectSyncItem(result, fmt.Errorf("failed to get order: %w", err))
+	}
+	result.OrderNumber = order.OrderNumber
+
+	due, err := s.orders.BalanceDue(ctx, order.ID)
+	if err != nil {
+		return rejectSyncItem(result, err)
+	}
+	amount := 0.0
+	if p.Partial && p.Amount > 0 && roundCurrency(p.Amount) <= due {
+		amount = p.Amount
+	} else if p.Amount > 0 && roundCurrency(p.Amount) != due {
+		result.Conflicts = append(result.Conflicts, SyncConflict{
+			Type:        SyncConflictPaymentAmount,
+			ClientValue: p.Amount,
+			ServerValue: due,
+			Resolution:  "charged_balance_due",
+		})
+	}
+
+	// The idempotency key stops a concurrent re-send charging the order twice
+	paymentCtx := WithIdempotencyKey(ctx, "sync:"+p.ClientID.String())
+	transaction, err := s.orders.ProcessPayment(paymentCtx, order.ID, domain.PaymentData{
+		TransactionID:     p.TransactionID,
+		Gateway:           p.Gateway,
+		Method:            p.Method,
+		MethodTitle:       p.MethodTitle,
+		Token:             p.Token,
+		Amount:            amount,
+		RegisterSessionID: req.RegisterSessionID,
+	})
+	if err != nil {
+		return rejectSyncItem(result, err)
+	}
+
+	result.ServerID = &transaction.ID
+	if err := s.recordSynced(ctx, tenantID, req.TerminalID, p.CreatedAt, &result); err != nil {
+		// The payment went through; only replay protection is lost
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// syncStockMovement applies an offline stock adjustment at the terminal's location
+func (s *SyncService) syncStockMovement(ctx context.Context, tenantID string, userID *uuid.UUID, req *SyncRequest, m SyncStockMovement) SyncItemResult {
+	result := SyncItemResult{ClientID: m.ClientID, EntityType: domain.SyncEntityStockMovement}
+	if duplicate, ok := s.findSynced(ctx, tenantID, m.ClientID); ok {
+		return duplicate
+	}
+	if m.ClientID == uuid.Nil {
+		return rejectSyncItem(result, errors.New("client ID is required"))
+	}
+	if s.inventory == nil {
+		return rejectSyncItem(result, errors.New("stock locations are not supported"))
+	}
+
+	location, err := s.inventory.ResolveLocation(ctx, tenantID, req.LocationID)
+	if err != nil {
+		return rejectSyncItem(result, err)
+	}
+	if location == nil {
+		return rejectSyncItem(result, errors.New("no stock location to adjust"))
+	}
+
+	reason := m.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("Offline adjustment on %s", req.TerminalID)
+	}
+
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := s.inventory.AdjustStock(ctx, tenantID, location.ID, m.ProductID, m.VariationID, m.Quantity, reason, userID, map[string]interface{}{
+			"terminal_id": req.TerminalID,
+			"client_id":   m.ClientID,
+			"created_at":  m.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.ServerID = &location.ID
+		return s.recordSynced(ctx, tenantID, req.TerminalID, m.CreatedAt, &result)
+	})
+	if err != nil {
+		result.ServerID = nil
+		if errors.Is(err, ErrInsufficientStock) {
+			available, _ := s.inventory.StockAt(ctx, location.ID, m.ProductID, m.VariationID)
+			result.Conflicts = append(result.Conflicts, SyncConflict{
+				Type:        SyncConflictOversell,
+				ProductID:   &m.ProductID,
+				VariationID: m.VariationID,
+				ClientValue: float64(-m.Quantity),
+				ServerValue: float64(available),
+				Resolution:  "movement_not_applied",
+			})
+		}
+		return rejectSyncItem(result, err)
+	}
+
+	return result
+}
+
+// catalogDelta loads catalog records changed after the cursor and no later than
+// until. Each kind of record is paged on its own: a full page leaves its
+// position at the last record sent, otherwise the position moves up to until.
+func (s *SyncService) catalogDelta(ctx context.Context, tenantID string, cursor syncCursor, until time.Time) (SyncCatalogDelta, syncCursor, error) {
+	var delta SyncCatalogDelta
+	next := cursor
+	limit := s.catalogPageSize
+
+	advance := func(position *domain.ChangePosition, count int, last domain.ChangePosition) {
+		switch {
+		case count >= limit:
+			delta.HasMore = true
+			*position = last
+		case position.UpdatedAt.Before(until):
+			// Every record up to until has been sent, those updated at until included
+			*position = domain.ChangePosition{UpdatedAt: until, ID: uuid.Max}
+		}
+	}
+
+	if s.categoryRepo != nil {
+		categories, err := s.categoryRepo.GetChangedSince(ctx, tenantID, cursor.Categories, until, limit)
+		if err != nil {
+			return delta, cursor, fmt.Errorf("failed to get changed categories: %w", err)
+		}
+		delta.Categories = categories
+		var last domain.ChangePosition
+		if len(categories) > 0 {
+			last = domain.ChangePosition{UpdatedAt: categories[len(categories)-1].UpdatedAt, ID: categories[len(categories)-1].ID}
+		}
+		advance(&next.Categories, len(categories), last)
+	}
+
+	products, err := s.productRepo.GetChangedSince(ctx, tenantID, cursor.Products, until, limit)
+	if err != nil {
+		return delta, cursor, fmt.Errorf("failed to get changed products: %w", err)
+	}
+	delta.Products = products
+	var last domain.ChangePosition
+	if len(products) > 0 {
+		last = domain.ChangePosition{UpdatedAt: products[len(products)-1].UpdatedAt, ID: products[len(products)-1].ID}
+	}
+	advance(&next.Products, len(products), last)
+
+	if s.variationRepo != nil {
+		variations, err := s.variationRepo.GetChangedSince(ctx, tenantID, cursor.Variations, until, limit)
+		if err != nil {
+			return delta, cursor, fmt.Errorf("failed to get changed variations: %w", err)
+		}
+		delta.Variations = variations
+		var last domain.ChangePosition
+		if len(variations) > 0 {
+			last = domain.ChangePosition{UpdatedAt: variations[len(variations)-1].UpdatedAt, ID: variations[len(variations)-1].ID}
+		}
+		advance(&next.Variations, len(variations), last)
+	}
+
+	return delta, next, nil
+}
+
+// findSynced returns the stored result of an item synced earlier, marked as a duplicate
+func (s *SyncService) findSynced(ctx context.Context, tenantID string, clientID uuid.UUID) (SyncItemResult, bool) {
+	if clientID == uuid.Nil {
+		return SyncItemResult{}, false
+	}
+
+	record, err := s.syncRepo.GetByClientID(ctx, tenantID, clientID)
+	if err != nil || record == nil {
+		return SyncItemResult{}, false
+	}
+
+	result := SyncItemResult{
+		ClientID:   record.ClientID,
+		EntityType: record.EntityType,
+		ServerID:   record.ServerID,
+	}
+	if data, err := json.Marshal(record.Resolution); err == nil {
+		json.Unmarshal(data, &result)
+	}
+	result.Status = domain.SyncStatusDuplicate
+
+	return result, true
+}
+
+// recordSynced sets the item's status from its conflicts and remembers its
+// result under the client ID
+func (s *SyncService) recordSynced(ctx context.Context, tenantID, terminalID string, clientCreatedAt time.Time, result *SyncItemResult) error {
+	result.Status = domain.SyncStatusApplied
+	if len(result.Conflicts) > 0 {
+		result.Status = domain.SyncStatusConflict
+	}
+
+	resolution, err := toJSONMap(result)
+	if err != nil {
+		return err
+	}
+
+	record := &domain.SyncRecord{
+		TenantID:        tenantID,
+		TerminalID:      terminalID,
+		ClientID:        result.ClientID,
+		EntityType:      result.EntityType,
+		ServerID:        result.ServerID,
+		Status:          result.Status,
+		Resolution:      resolution,
+		ClientCreatedAt: clientCreatedAt,
+	}
+	if err := s.syncRepo.Create(ctx, record); err != nil {
+		return fmt.Errorf("failed to record synced %s: %w", result.EntityType, err)
+	}
+
+	return nil
+}
+
+func rejectSyncItem(result SyncItemResult, err error) SyncItemResult {
+	result.Status = domain.SyncStatusRejected
+	result.Error = err.Error()
+	return result
+}
+
+// syncCursor records how far a terminal has read each kind of catalog record
+type syncCursor struct {
+	Categories domain.ChangePosition `json:"categories"`
+	Products   domain.ChangePosition `json:"products"`
+	Variations domain.ChangePosition `json:"variations"`
+}
+
+// encodeSyncCursor and parseSyncCursor keep the cursor opaque to terminals
+func encodeSyncCursor(cursor syncCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseSyncCursor(cursor string) (syncCursor, error) {
+	if cursor == "" {
+		return syncCursor{}, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return syncCursor{}, ErrInvalidSyncCursor
+	}
+	var parsed syncCursor
+	if err := json.Unmarshal(data, &parsed); err == nil {
+		return parsed, nil
+	}
+
+	// Cursors issued before the keyset cursor hold a single timestamp; every
+	// record updated at or after it is sent again
+	t, err := time.Parse(time.RFC3339Nano, string(data))
+	if err != nil {
+		return syncCursor{}, ErrInvalidSyncCursor
+	}
+	position := domain.ChangePosition{UpdatedAt: t}
+	return syncCursor{Categories: position, Products: position, Variations: position}, nil
+}
+
+// toJSONMap converts a value to the map form stored in jsonb columns
+func toJSONMap(value interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %w", value, err)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %w", value, err)
+	}
+	return result, nil
+}
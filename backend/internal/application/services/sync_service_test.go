@@ -0,0 +1,137 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+// changedProductRepo serves GetChangedSince from a slice the way the keyset
+// query does
+type changedProductRepo struct {
+	repositories.ProductRepository
+	products []*domain.Product
+}
+
+func (r *changedProductRepo) GetChangedSince(ctx context.Context, tenantID string, after domain.ChangePosition, until time.Time, limit int) ([]*domain.Product, error) {
+	sorted := append([]*domain.Product(nil), r.products...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].UpdatedAt.Equal(sorted[j].UpdatedAt) {
+			return sorted[i].UpdatedAt.Before(sorted[j].UpdatedAt)
+		}
+		return bytes.Compare(sorted[i].ID[:], sorted[j].ID[:]) < 0
+	})
+
+	var page []*domain.Product
+	for _, product := range sorted {
+		if product.UpdatedAt.After(until) {
+			break
+		}
+		if product.UpdatedAt.Before(after.UpdatedAt) ||
+			product.UpdatedAt.Equal(after.UpdatedAt) && bytes.Compare(product.ID[:], after.ID[:]) <= 0 {
+			continue
+		}
+		page = append(page, product)
+		if len(page) == limit {
+			break
+		}
+	}
+	return page, nil
+}
+
+func (r *changedProductRepo) add(updatedAt time.Time) *domain.Product {
+	product := &domain.Product{ID: uuid.New(), TenantID: "acme", UpdatedAt: updatedAt}
+	r.products = append(r.products, product)
+	return product
+}
+
+// syncAll pages through the catalog delta like a terminal, returning how many
+// times each product was sent and the cursor it ends with
+func syncAll(t *testing.T, s *SyncService, cursor syncCursor, until time.Time) (map[uuid.UUID]int, syncCursor) {
+	t.Helper()
+	sent := make(map[uuid.UUID]int)
+	for page := 0; ; page++ {
+		if page == 20 {
+			t.Fatal("catalog delta is still returning pages after 20 syncs")
+		}
+		delta, next, err := s.catalogDelta(context.Background(), "acme", cursor, until)
+		if err != nil {
+			t.Fatalf("catalogDelta: %v", err)
+		}
+		for _, product := range delta.Products {
+			sent[product.ID]++
+		}
+		cursor = next
+		if !delta.HasMore {
+			return sent, cursor
+		}
+	}
+}
+
+func TestCatalogDeltaPagesThroughRowsSharingUpdatedAt(t *testing.T) {
+	repo := &changedProductRepo{}
+	updatedAt := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		repo.add(updatedAt)
+	}
+	s := &SyncService{productRepo: repo, catalogPageSize: 3}
+
+	sent, _ := syncAll(t, s, syncCursor{}, updatedAt.Add(time.Hour))
+
+	if len(sent) != 7 {
+		t.Errorf("%d products were sent, want 7", len(sent))
+	}
+	for id, count := range sent {
+		if count != 1 {
+			t.Errorf("product %s was sent %d times, want once", id, count)
+		}
+	}
+}
+
+func TestCatalogDeltaLeavesChangesAfterTheWatermark(t *testing.T) {
+	repo := &changedProductRepo{}
+	watermark := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	repo.add(watermark.Add(-time.Minute))
+	atWatermark := repo.add(watermark)
+	s := &SyncService{productRepo: repo, catalogPageSize: 10}
+
+	// A change newer than the watermark may not have committed; it waits for the next sync
+	late := repo.add(watermark.Add(time.Second))
+	sent, cursor := syncAll(t, s, syncCursor{}, watermark)
+	if len(sent) != 2 || sent[late.ID] != 0 {
+		t.Errorf("sync up to the watermark sent %d products, the late one %d times", len(sent), sent[late.ID])
+	}
+
+	sent, _ = syncAll(t, s, cursor, watermark.Add(time.Minute))
+	if len(sent) != 1 || sent[late.ID] != 1 {
+		t.Errorf("next sync sent %d products, want only the late one", len(sent))
+	}
+	if sent[atWatermark.ID] != 0 {
+		t.Error("the product updated at the watermark was sent twice")
+	}
+}
+
+func TestParseSyncCursorAcceptsTimestampCursors(t *testing.T) {
+	since := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	legacy := base64.RawURLEncoding.EncodeToString([]byte(since.Format(time.RFC3339Nano)))
+
+	cursor, err := parseSyncCursor(legacy)
+	if err != nil {
+		t.Fatalf("parseSyncCursor: %v", err)
+	}
+	if !cursor.Products.UpdatedAt.Equal(since) || cursor.Products.ID != uuid.Nil {
+		t.Errorf("products position = %+v, want the start of %s", cursor.Products, since)
+	}
+
+	roundTrip, err := parseSyncCursor(encodeSyncCursor(cursor))
+	if err != nil || !roundTrip.Products.UpdatedAt.Equal(since) || roundTrip.Variations.ID != uuid.Nil {
+		t.Errorf("cursor did not survive encoding: %+v, %v", roundTrip, err)
+	}
+}
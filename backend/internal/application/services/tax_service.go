@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+)
+
+// TaxCalculator computes taxes for a cart or order. The built-in ZoneTaxCalculator
+// uses tenant-defined zones and rates; an external tax service can replace it.
+type TaxCalculator interface {
+	Calculate(ctx context.Context, req *TaxRequest) (*TaxResult, error)
+}
+
+// TaxRequest describes what needs to be taxed and where it is going
+type TaxRequest struct {
+	TenantID        string                 `json:"tenant_id"`
+	Currency        string                 `json:"currency"`
+	BillingAddress  map[string]interface{} `json:"billing_address"`
+	ShippingAddress map[string]interface{} `json:"shipping_address"`
+	Lines           []TaxableLine          `json:"lines"`
+	ShippingAmount  float64                `json:"shipping_amount"`
+}
+
+// TaxableLine is a single cart or order line, priced after discounts
+type TaxableLine struct {
+	ID        uuid.UUID `json:"id"`
+	ProductID uuid.UUID `json:"product_id"`
+	TaxClass  string    `json:"tax_class"`
+	Quantity  int       `json:"quantity"`
+	Amount    float64   `json:"amount"`
+}
+
+// LineTax is the tax charged on one line
+type LineTax struct {
+	TaxTotal float64          `json:"tax_total"`
+	TaxLines []domain.TaxLine `json:"tax_lines"`
+}
+
+// TaxResult is the outcome of a tax calculation
+type TaxResult struct {
+	PricesIncludeTax bool                  `json:"prices_include_tax"`
+	Lines            map[uuid.UUID]LineTax `json:"lines"`
+	ShippingTax      LineTax               `json:"shipping_tax"`
+	TaxTotal         float64               `json:"tax_total"`
+}
+
+// ZoneTaxCalculator resolves the destination address to a tenant tax zone and
+// applies the zone's rates for each line's tax class
+type ZoneTaxCalculator struct {
+	zoneRepo   repositories.TaxZoneRepository
+	rateRepo   repositories.TaxRateRepository
+	tenantRepo domain.TenantRepository
+}
+
+func NewZoneTaxCalculator(
+	zoneRepo repositories.TaxZoneRepository,
+	rateRepo repositories.TaxRateRepository,
+	tenantRepo domain.TenantRepository,
+) *ZoneTaxCalculator {
+	return &ZoneTaxCalculator{
+		zoneRepo:   zoneRepo,
+		rateRepo:   rateRepo,
+		tenantRepo: tenantRepo,
+	}
+}
+
+func (c *ZoneTaxCalculator) Calculate(ctx context.Context, req *TaxRequest) (*TaxResult, error) {
+	settings := domain.TaxSettings{TaxBasedOn: domain.TaxBasedOnShipping, ShippingTaxClass: domain.TaxClassStandard}
+	if config := loadTenantConfiguration(ctx, c.tenantRepo, req.TenantID); config != nil && config.Tax != nil {
+		settings = *config.Tax
+	}
+
+	result := &TaxResult{
+		PricesIncludeTax: settings.PricesIncludeTax,
+		Lines:            make(map[uuid.UUID]LineTax),
+	}
+
+	address := req.ShippingAddress
+	if settings.TaxBasedOn == domain.TaxBasedOnBilling || len(address) == 0 {
+		address = req.BillingAddress
+	}
+	if len(address) == 0 {
+		address = settings.BaseAddress
+	}
+
+	zone, err := c.matchZone(ctx, req.TenantID, address)
+	if err != nil {
+		return nil, err
+	}
+	if zone == nil {
+		// No zone covers this address, so nothing is taxed
+		return result, nil
+	}
+
+	rates, err := c.rateRepo.GetByZoneID(ctx, zone.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax rates: %w", err)
+	}
+	sort.SliceStable(rates, func(i, j int) bool { return rates[i].Priority < rates[j].Priority })
+
+	for _, line := range req.Lines {
+		taxClass := line.TaxClass
+		if taxClass == "" {
+			taxClass = domain.TaxClassStandard
+		}
+		lineTax := applyTaxRates(ratesForClass(rates, taxClass, false), line.Amount, settings.PricesIncludeTax)
+		result.Lines[line.ID] = lineTax
+		result.TaxTotal += lineTax.TaxTotal
+	}
+
+	if req.ShippingAmount > 0 {
+		shippingClass := settings.ShippingTaxClass
+		if shippingClass == "" {
+			shippingClass = domain.TaxClassStandard
+		}
+		result.ShippingTax = applyTaxRates(ratesForClass(rates, shippingClass, true), req.ShippingAmount, settings.PricesIncludeTax)
+		result.TaxTotal += result.ShippingTax.TaxTotal
+	}
+
+	result.TaxTotal = roundCurrency(result.TaxTotal)
+	return result, nil
+}
+
+// matchZone returns the first active zone, in priority order, that covers the address
+func (c *ZoneTaxCalculator) matchZone(ctx context.Context, tenantID string, address map[string]interface{}) (*domain.TaxZone, error) {
+	zones, err := c.zoneRepo.GetActiveByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax zones: %w", err)
+	}
+	sort.SliceStable(zones, func(i, j int) bool { return zones[i].Priority < zones[j].Priority })
+
+	country := addressField(address, "country")
+	state := addressField(address, "state")
+	postalCode := addressField(address, "postcode", "postal_code", "zip")
+
+	for _, zone := range zones {
+		if !zone.IsActive {
+			continue
+		}
+		if len(zone.Countries) > 0 && !containsString(zone.Countries, country) {
+			continue
+		}
+		if len(zone.States) > 0 && !containsString(zone.States, state) {
+			continue
+		}
+		if len(zone.PostalCodes) > 0 && !matchPostalCode(zone.PostalCodes, postalCode) {
+			continue
+		}
+		return zone, nil
+	}
+
+	return nil, nil
+}
+
+func ratesForClass(rates []*domain.TaxRate, taxClass string, shipping bool) []*domain.TaxRate {
+	if strings.EqualFold(taxClass, domain.TaxClassZero) {
+		return nil
+	}
+
+	var matched []*domain.TaxRate
+	for _, rate := range rates {
+		if !strings.EqualFold(rate.TaxClass, taxClass) {
+			continue
+		}
+		if shipping && !rate.Shipping {
+			continue
+		}
+		matched = append(matched, rate)
+	}
+	return matched
+}
+
+// applyTaxRates taxes amount with rates in priority order. Compound rates are
+// charged on the amount plus every tax before them. For tax-inclusive prices the
+// net amount is backed out first so the taxes add up to the price paid.
+func applyTaxRates(rates []*domain.TaxRate, amount float64, inclusive bool) LineTax {
+	lineTax := LineTax{}
+	if len(rates) == 0 || amount == 0 {
+		return lineTax
+	}
+
+	// Tax on one unit of net amount; the same factors scale linearly
+	factors := make([]float64, len(rates))
+	var taxed float64
+	for i, rate := range rates {
+		base := 1.0
+		if rate.Compound {
+			base += taxed
+		}
+		factors[i] = base * rate.Rate / 100
+		taxed += factors[i]
+	}
+
+	net := amount
+	if inclusive {
+		net = amount / (1 + taxed)
+	}
+
+	for i, rate := range rates {
+		taxAmount := roundCurrency(net * factors[i])
+		lineTax.TaxLines = append(lineTax.TaxLines, domain.TaxLine{
+			RateID:   rate.ID,
+			Name:     rate.Name,
+			Rate:     rate.Rate,
+			Compound: rate.Compound,
+			Amount:   taxAmount,
+		})
+		lineTax.TaxTotal += taxAmount
+	}
+	lineTax.TaxTotal = roundCurrency(lineTax.TaxTotal)
+
+	return lineTax
+}
+
+func matchPostalCode(patterns []string, postalCode string) bool {
+	postalCode = strings.ToUpper(strings.ReplaceAll(postalCode, " ", ""))
+	for _, pattern := range patterns {
+		pattern = strings.ToUpper(strings.ReplaceAll(pattern, " ", ""))
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(postalCode, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if pattern == postalCode {
+			return true
+		}
+	}
+	return false
+}
+
+// addressField returns the first non-empty value among keys
+func addressField(address map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := address[key].(string); ok && value != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// summarizeTaxLines totals tax lines by name and rate for display on receipts
+func summarizeTaxLines(groups ...[]domain.TaxLine) []domain.TaxLine {
+	var summary []domain.TaxLine
+	index := make(map[string]int)
+	for _, lines := range groups {
+		for _, line := range lines {
+			key := fmt.Sprintf("%s|%.4f|%t", line.Name, line.Rate, line.Compound)
+			if i, ok := index[key]; ok {
+				summary[i].Amount = roundCurrency(summary[i].Amount + line.Amount)
+				continue
+			}
+			index[key] = len(summary)
+			summary = append(summary, domain.TaxLine{Name: line.Name, Rate: line.Rate, Compound: line.Compound, Amount: line.Amount})
+		}
+	}
+	return summary
+}
+
+// loadTenantConfiguration returns the tenant's operational configuration, or nil
+// when the tenant cannot be loaded or has none
+func loadTenantConfiguration(ctx context.Context, tenantRepo domain.TenantRepository, tenantID string) *domain.TenantConfiguration {
+	tenant := loadTenant(ctx, tenantRepo, tenantID)
+	if tenant == nil {
+		return nil
+	}
+	return tenant.Configuration
+}
+
+// loadTenant looks up a tenant by the string ID carried on POS records, or
+// returns nil when it cannot be loaded
+func loadTenant(ctx context.Context, tenantRepo domain.TenantRepository, tenantID string) *domain.Tenant {
+	if tenantRepo == nil {
+		return nil
+	}
+
+	id, err := uuid.Parse(tenantID)
+	if err != nil {
+		return nil
+	}
+
+	tenant, err := tenantRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil
+	}
+
+	return tenant
+}
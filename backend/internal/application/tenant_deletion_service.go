@@ -0,0 +1,846 @@
+package application
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain/repositories"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/auth"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
+	"github.com/ilmsadmin/zplus-saas-base/pkg/config"
+)
+
+var (
+	ErrTenantDeletionNotFound     = errors.New("tenant deletion not found")
+	ErrTenantDeletionScheduled    = errors.New("tenant deletion is already scheduled")
+	ErrTenantDeletionNotScheduled = errors.New("tenant deletion is no longer scheduled")
+	ErrTenantArchiveNotReady      = errors.New("tenant data export is not ready")
+	ErrInvalidDeletionCertificate = errors.New("invalid deletion certificate")
+)
+
+// deletionRetainedTables hold tenant_id rows that must outlive the purge
+var deletionRetainedTables = []string{"tenant_deletions"}
+
+// errPurgeBusy is returned when another worker is purging the deletion or it is
+// no longer due
+var errPurgeBusy = errors.New("tenant deletion is being purged elsewhere")
+
+// Stores purged for a tenant, in purge order; the names key the purge summary
+const (
+	purgeStoreKeycloak  = "keycloak"
+	purgeStoreFiles     = "files"
+	purgeStoreCasbin    = "casbin"
+	purgeStoreMongo     = "mongo"
+	purgeStoreRedis     = "redis"
+	purgeStoreDedicated = "dedicated_database"
+	purgeStorePostgres  = "postgres"
+)
+
+// DeletionCertificate attests that a tenant's data was purged from every store.
+// It is stored as the exact JSON that was signed.
+type DeletionCertificate struct {
+	CertificateID uuid.UUID              `json:"certificate_id"`
+	TenantID      uuid.UUID              `json:"tenant_id"`
+	TenantName    string                 `json:"tenant_name"`
+	Subdomain     string                 `json:"subdomain"`
+	RequestedAt   time.Time              `json:"requested_at"`
+	RequestedBy   *uuid.UUID             `json:"requested_by,omitempty"`
+	PurgedAt      time.Time              `json:"purged_at"`
+	ArchiveSHA256 string                 `json:"archive_sha256"`
+	Stores        map[string]interface{} `json:"stores"`
+	Algorithm     string                 `json:"algorithm"`
+}
+
+// ParseCertificateSigningKey decodes a base64 Ed25519 seed into a signing key
+func ParseCertificateSigningKey(encoded string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate signing key: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid certificate signing key: want a %d byte seed, got %d bytes", ed25519.SeedSize, len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// TenantDeletionService deletes tenants. A deletion request soft deletes and suspends
+// the tenant for a grace period in which it can be cancelled. Before the purge a full
+// export archive is written covering the tenant's Postgres rows, including those
+// held in a dedicated database, Mongo collections, Redis keys and stored files.
+// Once the grace period is over every store is purged, including Keycloak users
+// and Casbin policies, and a signed deletion certificate is issued.
+type TenantDeletionService struct {
+	txManager      repositories.TransactionManager
+	deletionRepo   domain.TenantDeletionRepository
+	tenantRepo     domain.TenantRepository
+	onboardingRepo domain.TenantOnboardingRepository
+	fileRepo       domain.FileRepository
+	fileService    services.FileService
+	postgres       *database.PostgresDB
+	resolver       *database.TenantConnectionResolver
+	mongo          *database.MongoClient
+	redis          *database.RedisClient
+	roleService    *RoleService
+	keycloak       *auth.KeycloakClient
+	gracePeriod    time.Duration
+	exportDir      string
+	signingKey     ed25519.PrivateKey
+	logger         *zap.Logger
+}
+
+// NewTenantDeletionService creates a new tenant deletion service
+func NewTenantDeletionService(
+	deletionRepo domain.TenantDeletionRepository,
+	tenantRepo domain.TenantRepository,
+	onboardingRepo domain.TenantOnboardingRepository,
+	fileRepo domain.FileRepository,
+	fileService services.FileService,
+	postgres *database.PostgresDB,
+	resolver *database.TenantConnectionResolver,
+	mongo *database.MongoClient,
+	redis *database.RedisClient,
+	roleService *RoleService,
+	keycloak *auth.KeycloakClient,
+	gracePeriod time.Duration,
+	exportDir string,
+	signingKey ed25519.PrivateKey,
+	logger *zap.Logger,
+) *TenantDeletionService {
+	return &TenantDeletionService{
+		txManager:      database.NewGormTransactionManager(postgres.DB),
+		deletionRepo:   deletionRepo,
+		tenantRepo:     tenantRepo,
+		onboardingRepo: onboardingRepo,
+		fileRepo:       fileRepo,
+		fileService:    fileService,
+		postgres:       postgres,
+		resolver:       resolver,
+		mongo:          mongo,
+		redis:          redis,
+		roleService:    roleService,
+		keycloak:       keycloak,
+		gracePeriod:    gracePeriod,
+		exportDir:      exportDir,
+		signingKey:     signingKey,
+		logger:         logger,
+	}
+}
+
+// RequestDeletion soft deletes and suspends a tenant and schedules its purge for
+// the end of the grace period. A tenant has at most one open deletion; the
+// database enforces that, so concurrent requests cannot both schedule one.
+func (s *TenantDeletionService) RequestDeletion(ctx context.Context, tenantID uuid.UUID, requestedBy *uuid.UUID, reason string) (*domain.TenantDeletion, error) {
+	var deletion *domain.TenantDeletion
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		tenant, err := s.tenantRepo.GetByID(ctx, tenantID)
+		if err != nil {
+			return fmt.Errorf("failed to get tenant: %w", err)
+		}
+
+		now := time.Now()
+		deletion = &domain.TenantDeletion{
+			ID:             uuid.New(),
+			TenantID:       tenant.ID,
+			TenantName:     tenant.Name,
+			Subdomain:      tenant.Subdomain,
+			Status:         domain.TenantDeletionStatusScheduled,
+			PreviousStatus: tenant.Status,
+			Reason:         reason,
+			RequestedBy:    requestedBy,
+			RequestedAt:    now,
+			PurgeAfter:     now.Add(s.gracePeriod),
+		}
+		if err := s.deletionRepo.Create(ctx, deletion); err != nil {
+			if errors.Is(err, domain.ErrTenantDeletionOpen) {
+				return ErrTenantDeletionScheduled
+			}
+			return fmt.Errorf("failed to schedule tenant deletion: %w", err)
+		}
+
+		tenant.Status = domain.TenantStatusSuspended
+		tenant.DeletedAt = &now
+		if err := s.tenantRepo.Update(ctx, tenant); err != nil {
+			return fmt.Errorf("failed to soft delete tenant: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deletion, nil
+}
+
+// CancelDeletion restores a tenant whose deletion is still in its grace period.
+// The deletion is cancelled only while it is still scheduled, so a purge that
+// has already claimed it is not undone under its feet.
+func (s *TenantDeletionService) CancelDeletion(ctx context.Context, deletionID uuid.UUID) (*domain.TenantDeletion, error) {
+	deletion, err := s.GetDeletion(ctx, deletionID)
+	if err != nil {
+		return nil, err
+	}
+	if deletion.Status != domain.TenantDeletionStatusScheduled || time.Now().After(deletion.PurgeAfter) {
+		return nil, ErrTenantDeletionNotScheduled
+	}
+
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		now := time.Now()
+		deletion.Status = domain.TenantDeletionStatusCancelled
+		deletion.CancelledAt = &now
+		cancelled, err := s.deletionRepo.UpdateIfStatus(ctx, deletion, domain.TenantDeletionStatusScheduled)
+		if err != nil {
+			return fmt.Errorf("failed to cancel tenant deletion: %w", err)
+		}
+		if !cancelled {
+			return ErrTenantDeletionNotScheduled
+		}
+
+		tenant, err := s.tenantRepo.GetByID(ctx, deletion.TenantID)
+		if err != nil {
+			return fmt.Errorf("failed to get tenant: %w", err)
+		}
+		tenant.Status = deletion.PreviousStatus
+		if tenant.Status == "" {
+			tenant.Status = domain.TenantStatusActive
+		}
+		tenant.DeletedAt = nil
+		if err := s.tenantRepo.Update(ctx, tenant); err != nil {
+			return fmt.Errorf("failed to restore tenant: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The export was taken for the deletion; the tenant's data lives on, so drop it
+	if deletion.ArchivePath != "" {
+		if err := os.Remove(deletion.ArchivePath); err != nil && !os.IsNotExist(err) {
+			s.logger.Error("Failed to remove tenant export archive", zap.Error(err))
+		}
+	}
+	return deletion, nil
+}
+
+// GetDeletion returns a tenant deletion
+func (s *TenantDeletionService) GetDeletion(ctx context.Context, deletionID uuid.UUID) (*domain.TenantDeletion, error) {
+	deletion, err := s.deletionRepo.GetByID(ctx, deletionID)
+	if err != nil || deletion == nil {
+		return nil, ErrTenantDeletionNotFound
+	}
+	return deletion, nil
+}
+
+// ListDeletions lists a tenant's deletions, newest first
+func (s *TenantDeletionService) ListDeletions(ctx context.Context, tenantID uuid.UUID) ([]*domain.TenantDeletion, error) {
+	deletions, err := s.deletionRepo.ListByTenant(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenant deletions: %w", err)
+	}
+	return deletions, nil
+}
+
+// OpenArchive opens a deletion's export archive for download
+func (s *TenantDeletionService) OpenArchive(ctx context.Context, deletionID uuid.UUID) (io.ReadCloser, *domain.TenantDeletion, error) {
+	deletion, err := s.GetDeletion(ctx, deletionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if deletion.ArchivePath == "" {
+		return nil, nil, ErrTenantArchiveNotReady
+	}
+
+	archive, err := os.Open(deletion.ArchivePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open tenant export archive: %w", err)
+	}
+	return archive, deletion, nil
+}
+
+// ExportArchive writes the export archive of a scheduled deletion's tenant. A zip
+// holds manifest.json, postgres/<schema>/<table>.jsonl, mongo/<collection>.jsonl,
+// redis/keys.jsonl (each key's DUMP payload and TTL), and files/index.jsonl with the
+// stored files under files/<file id>/. Exporting again replaces the archive.
+func (s *TenantDeletionService) ExportArchive(ctx context.Context, deletionID uuid.UUID) (*domain.TenantDeletion, error) {
+	deletion, err := s.GetDeletion(ctx, deletionID)
+	if err != nil {
+		return nil, err
+	}
+	if deletion.Status != domain.TenantDeletionStatusScheduled {
+		return nil, ErrTenantDeletionNotScheduled
+	}
+	if err := s.export(ctx, deletion); err != nil {
+		return nil, err
+	}
+	return deletion, nil
+}
+
+func (s *TenantDeletionService) export(ctx context.Context, deletion *domain.TenantDeletion) error {
+	if err := os.MkdirAll(s.exportDir, 0750); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	archivePath := filepath.Join(s.exportDir, fmt.Sprintf("tenant-%s-%s.zip", deletion.TenantID, deletion.ID))
+	tmpPath := archivePath + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create tenant export archive: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(out, hash)}
+	archive := zip.NewWriter(counter)
+
+	manifest, err := s.writeArchive(ctx, archive, deletion.TenantID)
+	if err == nil {
+		err = writeArchiveJSON(archive, "manifest.json", manifest)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export tenant data: %w", err)
+	}
+	if err := os.Rename(tmpPath, archivePath); err != nil {
+		return fmt.Errorf("failed to save tenant export archive: %w", err)
+	}
+
+	now := time.Now()
+	deletion.ArchivePath = archivePath
+	deletion.ArchiveSHA256 = hex.EncodeToString(hash.Sum(nil))
+	deletion.ArchiveSize = counter.n
+	deletion.ExportedAt = &now
+	// A deletion cancelled while it was exported keeps its cancellation
+	recorded, err := s.deletionRepo.UpdateIfStatus(ctx, deletion, deletion.Status)
+	if err != nil {
+		return fmt.Errorf("failed to record tenant export: %w", err)
+	}
+	if !recorded {
+		os.Remove(archivePath)
+		return ErrTenantDeletionNotScheduled
+	}
+	return nil
+}
+
+func (s *TenantDeletionService) writeArchive(ctx context.Context, archive *zip.Writer, tenantID uuid.UUID) (map[string]interface{}, error) {
+	tenantKey := tenantID.String()
+	entries := make(map[string]int)
+
+	lines := &jsonlWriter{archive: archive, counts: entries}
+	err := s.postgres.ExportTenantRows(ctx, tenantKey, deletionRetainedTables, func(table string, row []byte) error {
+		return lines.write("postgres/"+strings.Replace(table, ".", "/", 1)+".jsonl", row)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	store, tables, err := s.dedicatedDatabase(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if store != nil {
+		err = database.ExportTenantTables(ctx, store, tables, func(table string, row []byte) error {
+			return lines.write(path.Join("postgres", "dedicated", table+".jsonl"), row)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.mongo.ExportTenantDatabase(ctx, tenantKey, func(collection string, document []byte) error {
+		return lines.write(path.Join("mongo", collection+".jsonl"), document)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The scan covers every key stored for the tenant, idempotency keys included
+	err = s.redis.ScanTenantKeys(ctx, tenantKey, func(key string) error {
+		dump, err := s.redis.Dump(ctx, key).Result()
+		if errors.Is(err, redis.Nil) {
+			// The key expired between the scan and the dump
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to export redis key %s: %w", key, err)
+		}
+		ttl, err := s.redis.PTTL(ctx, key).Result()
+		if err != nil {
+			return fmt.Errorf("failed to export redis key %s: %w", key, err)
+		}
+		line, err := json.Marshal(map[string]interface{}{
+			"key":    key,
+			"dump":   base64.StdEncoding.EncodeToString([]byte(dump)),
+			"ttl_ms": ttl.Milliseconds(),
+		})
+		if err != nil {
+			return err
+		}
+		return lines.write("redis/keys.jsonl", line)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.tenantFiles(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	lines.current = ""
+	var index []map[string]interface{}
+	for _, file := range files {
+		entry := map[string]interface{}{
+			"id":            file.ID,
+			"original_name": file.OriginalName,
+			"mime_type":     file.MimeType,
+			"size":          file.Size,
+			"category":      file.Category,
+			"created_at":    file.CreatedAt,
+		}
+		reader, _, err := s.fileService.OpenFile(ctx, file.ID)
+		if errors.Is(err, fs.ErrNotExist) {
+			entry["missing"] = true
+			index = append(index, entry)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to export file %s: %w", file.ID, err)
+		}
+		name := path.Join("files", file.ID.String(), path.Base(filepath.ToSlash(file.OriginalName)))
+		w, err := archive.Create(name)
+		if err == nil {
+			_, err = io.Copy(w, reader)
+		}
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to export file %s: %w", file.ID, err)
+		}
+		entry["path"] = name
+		index = append(index, entry)
+	}
+	for _, entry := range index {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		if err := lines.write("files/index.jsonl", line); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]interface{}{
+		"tenant_id":   tenantID,
+		"exported_at": time.Now(),
+		"entries":     entries,
+	}, nil
+}
+
+// dedicatedDatabase returns the tenant's dedicated database and the tables whose
+// rows it holds, or no database when the tenant's rows are in the shared one
+func (s *TenantDeletionService) dedicatedDatabase(ctx context.Context, tenantID uuid.UUID) (*database.TenantDB, []string, error) {
+	tenant, err := s.tenantRepo.GetByID(ctx, tenantID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	if tenant.IsolationMode != domain.TenantIsolationDatabase {
+		return nil, nil, nil
+	}
+	store, err := s.resolver.Connect(tenantID.String(), tenant.IsolationMode, tenant.DatabaseDSN)
+	if err != nil {
+		return nil, nil, err
+	}
+	tables, err := s.postgres.MovableTenantTables(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, tables, nil
+}
+
+// tenantFiles lists every stored file of the tenant
+func (s *TenantDeletionService) tenantFiles(ctx context.Context, tenantID uuid.UUID) ([]*domain.File, error) {
+	const batchSize = 100
+	var files []*domain.File
+	for offset := 0; ; offset += batchSize {
+		batch, err := s.fileRepo.ListByTenant(ctx, tenantID, batchSize, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tenant files: %w", err)
+		}
+		files = append(files, batch...)
+		if len(batch) < batchSize {
+			return files, nil
+		}
+	}
+}
+
+// PurgeDue purges every deletion whose grace period is over and returns how many
+// were purged. A deletion that fails is logged and retried on the next run.
+func (s *TenantDeletionService) PurgeDue(ctx context.Context) (int, error) {
+	deletions, err := s.deletionRepo.ListDue(ctx, time.Now(), 100)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list due tenant deletions: %w", err)
+	}
+
+	purged := 0
+	for _, deletion := range deletions {
+		err := s.purge(ctx, deletion.ID)
+		if errors.Is(err, errPurgeBusy) {
+			continue
+		}
+		if err != nil {
+			s.logger.Error("Failed to purge tenant",
+				zap.String("tenant_id", deletion.TenantID.String()),
+				zap.String("deletion_id", deletion.ID.String()),
+				zap.Error(err))
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// ScheduleDuePurges purges deletions whose grace period is over on the job runner
+func (s *TenantDeletionService) ScheduleDuePurges(runner *services.JobRunner, jobs config.JobsConfig) {
+	runner.Every("purge_tenant_deletions", jobs.TenantPurgeInterval, func(ctx context.Context) error {
+		_, err := s.PurgeDue(ctx)
+		return err
+	})
+}
+
+// purgeStore purges the tenant's data from one store and summarises what it removed
+type purgeStore struct {
+	name  string
+	purge func() (map[string]interface{}, error)
+}
+
+// purge claims a due deletion, exports the tenant if that has not happened yet,
+// then purges each store in turn. The deletion is locked for the purge, so two
+// workers never purge it at once.
+func (s *TenantDeletionService) purge(ctx context.Context, deletionID uuid.UUID) error {
+	unlock, acquired, err := s.postgres.TryAdvisoryLock(ctx, "tenant_deletion:"+deletionID.String())
+	if err != nil {
+		return fmt.Errorf("failed to lock tenant deletion: %w", err)
+	}
+	if !acquired {
+		return errPurgeBusy
+	}
+	defer unlock()
+
+	// Read the deletion again under the lock; it may have been cancelled or purged since it was listed
+	deletion, err := s.GetDeletion(ctx, deletionID)
+	if err != nil {
+		return err
+	}
+	switch deletion.Status {
+	case domain.TenantDeletionStatusScheduled:
+		if time.Now().Before(deletion.PurgeAfter) {
+			return errPurgeBusy
+		}
+		deletion.Status = domain.TenantDeletionStatusPurging
+		claimed, err := s.deletionRepo.UpdateIfStatus(ctx, deletion, domain.TenantDeletionStatusScheduled)
+		if err != nil {
+			return fmt.Errorf("failed to record tenant purge: %w", err)
+		}
+		if !claimed {
+			return errPurgeBusy
+		}
+	case domain.TenantDeletionStatusPurging:
+	default:
+		return errPurgeBusy
+	}
+
+	if deletion.ArchivePath == "" {
+		if err := s.export(ctx, deletion); err != nil {
+			return s.failPurge(ctx, deletion, err)
+		}
+	}
+
+	tenantKey := deletion.TenantID.String()
+	// Membership rows go with the Postgres purge, so the users are looked up once up front
+	users, err := s.postgres.ExclusiveTenantUsers(ctx, tenantKey)
+	if err != nil {
+		return s.failPurge(ctx, deletion, err)
+	}
+	userIDs := make([]string, 0, len(users))
+	for _, user := range users {
+		userIDs = append(userIDs, user.ID)
+	}
+
+	return s.runPurge(ctx, deletion, []purgeStore{
+		{purgeStoreKeycloak, func() (map[string]interface{}, error) {
+			keycloakIDs, err := s.tenantKeycloakUsers(ctx, deletion.TenantID, users)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range keycloakIDs {
+				if err := s.keycloak.DeleteUser(id); err != nil {
+					return nil, err
+				}
+			}
+			return map[string]interface{}{"users_deleted": len(keycloakIDs)}, nil
+		}},
+		{purgeStoreFiles, func() (map[string]interface{}, error) {
+			files, err := s.tenantFiles(ctx, deletion.TenantID)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				if err := s.fileService.DeleteFile(ctx, file.ID); err != nil {
+					return nil, err
+				}
+			}
+			return map[string]interface{}{"files_deleted": len(files)}, nil
+		}},
+		{purgeStoreCasbin, func() (map[string]interface{}, error) {
+			roles, err := s.roleService.GetTenantRoles(ctx, deletion.TenantID)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.roleService.RemoveTenantRoles(ctx, deletion.TenantID); err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"roles_deleted": len(roles)}, nil
+		}},
+		{purgeStoreMongo, func() (map[string]interface{}, error) {
+			if err := s.mongo.DropTenantDatabase(ctx, tenantKey); err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"database_dropped": s.mongo.GetTenantDatabase(tenantKey).Name()}, nil
+		}},
+		{purgeStoreRedis, func() (map[string]interface{}, error) {
+			// Idempotency keys live under the tenant prefix and go with the rest
+			deleted, err := s.redis.DeleteTenantKeys(ctx, tenantKey)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"keys_deleted": deleted, "key_pattern": database.TenantKeyPattern(tenantKey)}, nil
+		}},
+		{purgeStoreDedicated, func() (map[string]interface{}, error) {
+			store, tables, err := s.dedicatedDatabase(ctx, deletion.TenantID)
+			if err != nil || store == nil {
+				return map[string]interface{}{}, err
+			}
+			deleted, err := database.DeleteTenantRows(ctx, store, tables)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"rows_deleted": deleted}, nil
+		}},
+		{purgeStorePostgres, func() (map[string]interface{}, error) {
+			deleted, err := s.postgres.PurgeTenantRows(ctx, tenantKey, userIDs, deletionRetainedTables)
+			if err != nil {
+				return nil, err
+			}
+			schemaName, _ := database.TenantSchemaName(tenantKey)
+			return map[string]interface{}{"rows_deleted": deleted, "schema_dropped": schemaName}, nil
+		}},
+	})
+}
+
+// runPurge purges the stores in order and issues the deletion certificate once
+// all of them are done. Stores already in the purge summary are skipped, so an
+// interrupted purge resumes with the store it stopped at.
+func (s *TenantDeletionService) runPurge(ctx context.Context, deletion *domain.TenantDeletion, stores []purgeStore) error {
+	if deletion.PurgeSummary == nil {
+		deletion.PurgeSummary = make(map[string]interface{})
+	}
+
+	for _, store := range stores {
+		if _, done := deletion.PurgeSummary[store.name]; done {
+			continue
+		}
+		result, err := store.purge()
+		if err != nil {
+			return s.failPurge(ctx, deletion, fmt.Errorf("failed to purge %s: %w", store.name, err))
+		}
+		deletion.PurgeSummary[store.name] = result
+		deletion.ErrorMessage = ""
+		if err := s.deletionRepo.Update(ctx, deletion); err != nil {
+			return fmt.Errorf("failed to record tenant purge: %w", err)
+		}
+	}
+
+	now := time.Now()
+	certificate, signature, err := s.signCertificate(deletion, now)
+	if err != nil {
+		return s.failPurge(ctx, deletion, err)
+	}
+	deletion.Status = domain.TenantDeletionStatusPurged
+	deletion.PurgedAt = &now
+	deletion.Certificate = certificate
+	deletion.CertificateSignature = signature
+	if err := s.deletionRepo.Update(ctx, deletion); err != nil {
+		return fmt.Errorf("failed to record tenant purge: %w", err)
+	}
+	return nil
+}
+
+// tenantKeycloakUsers returns the Keycloak IDs of the tenant's accounts: the
+// logins of members that belong to no other tenant, and the admin account that
+// provisioning created unless it has since become another tenant's login too.
+// Members without a Keycloak ID have no account to delete.
+func (s *TenantDeletionService) tenantKeycloakUsers(ctx context.Context, tenantID uuid.UUID, users []database.TenantUser) ([]string, error) {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, user := range users {
+		if user.KeycloakUserID != "" && !seen[user.KeycloakUserID] {
+			seen[user.KeycloakUserID] = true
+			ids = append(ids, user.KeycloakUserID)
+		}
+	}
+
+	log, err := s.onboardingRepo.GetByTenantAndStep(ctx, tenantID, domain.ProvisioningStepAdminUser)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provisioning log: %w", err)
+	}
+	if log.Status != domain.OnboardingStatusCompleted {
+		return ids, nil
+	}
+	adminID, _ := log.Data["user_id"].(string)
+	if adminID == "" || seen[adminID] {
+		return ids, nil
+	}
+	shared, err := s.postgres.KeycloakUserInOtherTenants(ctx, adminID, tenantID.String())
+	if err != nil {
+		return nil, err
+	}
+	if !shared {
+		ids = append(ids, adminID)
+	}
+	return ids, nil
+}
+
+func (s *TenantDeletionService) failPurge(ctx context.Context, deletion *domain.TenantDeletion, purgeErr error) error {
+	deletion.ErrorMessage = purgeErr.Error()
+	if err := s.deletionRepo.Update(ctx, deletion); err != nil {
+		s.logger.Error("Failed to record tenant purge failure", zap.Error(err))
+	}
+	return purgeErr
+}
+
+func (s *TenantDeletionService) signCertificate(deletion *domain.TenantDeletion, purgedAt time.Time) (string, string, error) {
+	if len(s.signingKey) == 0 {
+		return "", "", errors.New("no certificate signing key is configured")
+	}
+
+	certificate, err := json.Marshal(DeletionCertificate{
+		CertificateID: deletion.ID,
+		TenantID:      deletion.TenantID,
+		TenantName:    deletion.TenantName,
+		Subdomain:     deletion.Subdomain,
+		RequestedAt:   deletion.RequestedAt.UTC(),
+		RequestedBy:   deletion.RequestedBy,
+		PurgedAt:      purgedAt.UTC(),
+		ArchiveSHA256: deletion.ArchiveSHA256,
+		Stores:        deletion.PurgeSummary,
+		Algorithm:     "Ed25519",
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to build deletion certificate: %w", err)
+	}
+	signature := ed25519.Sign(s.signingKey, certificate)
+	return string(certificate), base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// CertificatePublicKey returns the base64 Ed25519 public key that verifies
+// deletion certificates
+func (s *TenantDeletionService) CertificatePublicKey() string {
+	if len(s.signingKey) == 0 {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(s.signingKey.Public().(ed25519.PublicKey))
+}
+
+// VerifyDeletionCertificate checks a purged deletion's certificate against its signature
+func (s *TenantDeletionService) VerifyDeletionCertificate(deletion *domain.TenantDeletion) (*DeletionCertificate, error) {
+	if deletion.Certificate == "" || len(s.signingKey) == 0 {
+		return nil, ErrInvalidDeletionCertificate
+	}
+	signature, err := base64.StdEncoding.DecodeString(deletion.CertificateSignature)
+	if err != nil {
+		return nil, ErrInvalidDeletionCertificate
+	}
+	if !ed25519.Verify(s.signingKey.Public().(ed25519.PublicKey), []byte(deletion.Certificate), signature) {
+		return nil, ErrInvalidDeletionCertificate
+	}
+
+	var certificate DeletionCertificate
+	if err := json.Unmarshal([]byte(deletion.Certificate), &certificate); err != nil {
+		return nil, ErrInvalidDeletionCertificate
+	}
+	return &certificate, nil
+}
+
+// jsonlWriter writes JSON lines into zip entries. Lines for one entry must arrive
+// together because a zip entry cannot be reopened once the next one starts.
+type jsonlWriter struct {
+	archive *zip.Writer
+	current string
+	w       io.Writer
+	counts  map[string]int
+}
+
+func (j *jsonlWriter) write(name string, line []byte) error {
+	if name != j.current {
+		w, err := j.archive.Create(name)
+		if err != nil {
+			return err
+		}
+		j.current, j.w = name, w
+	}
+	if _, err := j.w.Write(line); err != nil {
+		return err
+	}
+	if _, err := j.w.Write([]byte("\n")); err != nil {
+		return err
+	}
+	j.counts[name]++
+	return nil
+}
+
+func writeArchiveJSON(archive *zip.Writer, name string, value interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,321 @@
+package application
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
+)
+
+// memDeletionRepo keeps tenant deletions in memory
+type memDeletionRepo struct {
+	domain.TenantDeletionRepository
+	deletions map[uuid.UUID]*domain.TenantDeletion
+}
+
+func (r *memDeletionRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.TenantDeletion, error) {
+	deletion, ok := r.deletions[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	copied := *deletion
+	return &copied, nil
+}
+
+func (r *memDeletionRepo) Update(ctx context.Context, deletion *domain.TenantDeletion) error {
+	copied := *deletion
+	copied.PurgeSummary = make(map[string]interface{}, len(deletion.PurgeSummary))
+	for store, result := range deletion.PurgeSummary {
+		copied.PurgeSummary[store] = result
+	}
+	r.deletions[deletion.ID] = &copied
+	return nil
+}
+
+func (r *memDeletionRepo) UpdateIfStatus(ctx context.Context, deletion *domain.TenantDeletion, status string) (bool, error) {
+	if stored, ok := r.deletions[deletion.ID]; !ok || stored.Status != status {
+		return false, nil
+	}
+	return true, r.Update(ctx, deletion)
+}
+
+// memTenantRepo keeps tenants in memory
+type memTenantRepo struct {
+	domain.TenantRepository
+	tenants map[uuid.UUID]*domain.Tenant
+}
+
+func (r *memTenantRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Tenant, error) {
+	tenant, ok := r.tenants[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	copied := *tenant
+	return &copied, nil
+}
+
+func (r *memTenantRepo) Update(ctx context.Context, tenant *domain.Tenant) error {
+	copied := *tenant
+	r.tenants[tenant.ID] = &copied
+	return nil
+}
+
+// passThroughTx runs the function without a transaction
+type passThroughTx struct{}
+
+func (passThroughTx) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func testSigningKey(t *testing.T, fill byte) ed25519.PrivateKey {
+	t.Helper()
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = fill
+	}
+	key, err := ParseCertificateSigningKey(base64.StdEncoding.EncodeToString(seed))
+	if err != nil {
+		t.Fatalf("ParseCertificateSigningKey: %v", err)
+	}
+	return key
+}
+
+func newTestDeletionService(t *testing.T) (*TenantDeletionService, *memDeletionRepo, *memTenantRepo) {
+	deletions := &memDeletionRepo{deletions: make(map[uuid.UUID]*domain.TenantDeletion)}
+	tenants := &memTenantRepo{tenants: make(map[uuid.UUID]*domain.Tenant)}
+	return &TenantDeletionService{
+		txManager:    passThroughTx{},
+		deletionRepo: deletions,
+		tenantRepo:   tenants,
+		signingKey:   testSigningKey(t, 7),
+		logger:       zap.NewNop(),
+	}, deletions, tenants
+}
+
+// scheduleTestDeletion soft deletes an active tenant with its purge due after purgeAfter
+func scheduleTestDeletion(deletions *memDeletionRepo, tenants *memTenantRepo, purgeAfter time.Time) *domain.TenantDeletion {
+	now := time.Now()
+	tenant := &domain.Tenant{ID: uuid.New(), Name: "Acme", Subdomain: "acme", Status: domain.TenantStatusSuspended, DeletedAt: &now}
+	tenants.tenants[tenant.ID] = tenant
+	deletion := &domain.TenantDeletion{
+		ID:             uuid.New(),
+		TenantID:       tenant.ID,
+		TenantName:     tenant.Name,
+		Subdomain:      tenant.Subdomain,
+		Status:         domain.TenantDeletionStatusScheduled,
+		PreviousStatus: domain.TenantStatusActive,
+		RequestedAt:    now,
+		PurgeAfter:     purgeAfter,
+	}
+	deletions.deletions[deletion.ID] = deletion
+	return deletion
+}
+
+func TestDeletionCertificateVerifiesOnlyUnchanged(t *testing.T) {
+	s, _, _ := newTestDeletionService(t)
+	deletion := &domain.TenantDeletion{
+		ID:            uuid.New(),
+		TenantID:      uuid.New(),
+		TenantName:    "Acme",
+		Subdomain:     "acme",
+		RequestedAt:   time.Now().Add(-30 * 24 * time.Hour),
+		ArchiveSHA256: "0f1e2d",
+		PurgeSummary:  map[string]interface{}{purgeStoreRedis: map[string]interface{}{"keys_deleted": 3}},
+	}
+
+	certificate, signature, err := s.signCertificate(deletion, time.Now())
+	if err != nil {
+		t.Fatalf("signCertificate: %v", err)
+	}
+	deletion.Certificate, deletion.CertificateSignature = certificate, signature
+
+	verified, err := s.VerifyDeletionCertificate(deletion)
+	if err != nil {
+		t.Fatalf("VerifyDeletionCertificate: %v", err)
+	}
+	if verified.TenantID != deletion.TenantID || verified.ArchiveSHA256 != "0f1e2d" || verified.Algorithm != "Ed25519" {
+		t.Errorf("verified certificate = %+v", verified)
+	}
+
+	tampered := *deletion
+	tampered.Certificate = strings.Replace(certificate, `"Acme"`, `"Other"`, 1)
+	if _, err := s.VerifyDeletionCertificate(&tampered); !errors.Is(err, ErrInvalidDeletionCertificate) {
+		t.Errorf("tampered certificate verified: %v", err)
+	}
+
+	other := &TenantDeletionService{signingKey: testSigningKey(t, 9)}
+	if _, err := other.VerifyDeletionCertificate(deletion); !errors.Is(err, ErrInvalidDeletionCertificate) {
+		t.Errorf("certificate verified with another key: %v", err)
+	}
+}
+
+func TestRunPurgeResumesInterruptedPurge(t *testing.T) {
+	s, deletions, tenants := newTestDeletionService(t)
+	deletion := scheduleTestDeletion(deletions, tenants, time.Now().Add(-time.Hour))
+	deletion.Status = domain.TenantDeletionStatusPurging
+
+	calls := make(map[string]int)
+	failFiles := true
+	stores := []purgeStore{
+		{purgeStoreKeycloak, func() (map[string]interface{}, error) {
+			calls[purgeStoreKeycloak]++
+			return map[string]interface{}{"users_deleted": 2}, nil
+		}},
+		{purgeStoreFiles, func() (map[string]interface{}, error) {
+			calls[purgeStoreFiles]++
+			if failFiles {
+				return nil, errors.New("storage unavailable")
+			}
+			return map[string]interface{}{"files_deleted": 5}, nil
+		}},
+		{purgeStorePostgres, func() (map[string]interface{}, error) {
+			calls[purgeStorePostgres]++
+			return map[string]interface{}{"rows_deleted": 40}, nil
+		}},
+	}
+
+	if err := s.runPurge(context.Background(), deletion, stores); err == nil {
+		t.Fatal("purge with a failing store succeeded")
+	}
+	interrupted, _ := deletions.GetByID(context.Background(), deletion.ID)
+	if _, done := interrupted.PurgeSummary[purgeStoreKeycloak]; !done || len(interrupted.PurgeSummary) != 1 {
+		t.Errorf("summary after the failure = %v, want only keycloak", interrupted.PurgeSummary)
+	}
+	if interrupted.ErrorMessage == "" || interrupted.Status == domain.TenantDeletionStatusPurged {
+		t.Errorf("failed purge recorded status %q, error %q", interrupted.Status, interrupted.ErrorMessage)
+	}
+
+	failFiles = false
+	if err := s.runPurge(context.Background(), interrupted, stores); err != nil {
+		t.Fatalf("resumed purge: %v", err)
+	}
+	if calls[purgeStoreKeycloak] != 1 || calls[purgeStoreFiles] != 2 || calls[purgeStorePostgres] != 1 {
+		t.Errorf("store purges = %v, want keycloak once, files twice, postgres once", calls)
+	}
+
+	purged, _ := deletions.GetByID(context.Background(), deletion.ID)
+	if purged.Status != domain.TenantDeletionStatusPurged || purged.PurgedAt == nil {
+		t.Fatalf("resumed purge left status %q", purged.Status)
+	}
+	certificate, err := s.VerifyDeletionCertificate(purged)
+	if err != nil {
+		t.Fatalf("VerifyDeletionCertificate: %v", err)
+	}
+	if len(certificate.Stores) != len(stores) {
+		t.Errorf("certificate covers %d stores, want %d", len(certificate.Stores), len(stores))
+	}
+}
+
+func TestCancelDeletionWithinGracePeriod(t *testing.T) {
+	s, deletions, tenants := newTestDeletionService(t)
+	ctx := context.Background()
+
+	deletion := scheduleTestDeletion(deletions, tenants, time.Now().Add(24*time.Hour))
+	cancelled, err := s.CancelDeletion(ctx, deletion.ID)
+	if err != nil {
+		t.Fatalf("CancelDeletion: %v", err)
+	}
+	if cancelled.Status != domain.TenantDeletionStatusCancelled || cancelled.CancelledAt == nil {
+		t.Errorf("deletion status = %q, want cancelled", cancelled.Status)
+	}
+	tenant := tenants.tenants[deletion.TenantID]
+	if tenant.Status != domain.TenantStatusActive || tenant.DeletedAt != nil {
+		t.Errorf("tenant was not restored: status %q, deleted at %v", tenant.Status, tenant.DeletedAt)
+	}
+
+	due := scheduleTestDeletion(deletions, tenants, time.Now().Add(-time.Minute))
+	if _, err := s.CancelDeletion(ctx, due.ID); !errors.Is(err, ErrTenantDeletionNotScheduled) {
+		t.Errorf("cancelling after the grace period: %v, want ErrTenantDeletionNotScheduled", err)
+	}
+	if tenants.tenants[due.TenantID].DeletedAt == nil {
+		t.Error("tenant was restored after its grace period")
+	}
+
+	// A purge claimed the deletion after the caller loaded it
+	claimed := scheduleTestDeletion(deletions, tenants, time.Now().Add(time.Hour))
+	loaded, _ := deletions.GetByID(ctx, claimed.ID)
+	deletions.deletions[claimed.ID].Status = domain.TenantDeletionStatusPurging
+	s.deletionRepo = &staleDeletionRepo{memDeletionRepo: deletions, stale: loaded}
+	if _, err := s.CancelDeletion(ctx, claimed.ID); !errors.Is(err, ErrTenantDeletionNotScheduled) {
+		t.Errorf("cancelling a claimed deletion: %v, want ErrTenantDeletionNotScheduled", err)
+	}
+	if tenants.tenants[claimed.TenantID].DeletedAt == nil {
+		t.Error("tenant of a claimed deletion was restored")
+	}
+}
+
+// staleDeletionRepo returns a copy of a deletion read before it changed
+type staleDeletionRepo struct {
+	*memDeletionRepo
+	stale *domain.TenantDeletion
+}
+
+func (r *staleDeletionRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.TenantDeletion, error) {
+	if id == r.stale.ID {
+		copied := *r.stale
+		return &copied, nil
+	}
+	return r.memDeletionRepo.GetByID(ctx, id)
+}
+
+// tenantKeyStore is an idempotency store that keeps keys where RedisClient does
+type tenantKeyStore struct {
+	values map[string]string
+}
+
+var _ services.IdempotencyStore = (*database.RedisClient)(nil)
+
+func (s *tenantKeyStore) GetWithTenant(ctx context.Context, tenantID, key string) (string, error) {
+	return s.values[database.TenantKey(tenantID, key)], nil
+}
+
+func (s *tenantKeyStore) SetWithTenant(ctx context.Context, tenantID, key string, value interface{}, expiration time.Duration) error {
+	s.values[database.TenantKey(tenantID, key)] = value.(string)
+	return nil
+}
+
+func (s *tenantKeyStore) SetNXWithTenant(ctx context.Context, tenantID, key string, value interface{}, expiration time.Duration) (bool, error) {
+	if _, ok := s.values[database.TenantKey(tenantID, key)]; ok {
+		return false, nil
+	}
+	return true, s.SetWithTenant(ctx, tenantID, key, value, expiration)
+}
+
+func (s *tenantKeyStore) DelWithTenant(ctx context.Context, tenantID, key string) error {
+	delete(s.values, database.TenantKey(tenantID, key))
+	return nil
+}
+
+func TestTenantKeyPatternCoversIdempotencyKeys(t *testing.T) {
+	store := &tenantKeyStore{values: make(map[string]string)}
+	idempotency := services.NewIdempotencyService(store, time.Hour)
+	tenantID := uuid.New().String()
+
+	var out string
+	err := idempotency.Do(context.Background(), tenantID, "create_order", "key-1", "payload", &out, func() (interface{}, error) {
+		return "order", nil
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	if len(store.values) != 1 {
+		t.Fatalf("%d keys stored, want 1", len(store.values))
+	}
+	for key := range store.values {
+		if matched, _ := path.Match(database.TenantKeyPattern(tenantID), key); !matched {
+			t.Errorf("idempotency key %q is outside the tenant's key pattern %q", key, database.TenantKeyPattern(tenantID))
+		}
+	}
+}
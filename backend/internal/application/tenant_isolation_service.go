@@ -0,0 +1,416 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
+	"github.com/ilmsadmin/zplus-saas-base/pkg/config"
+)
+
+var (
+	ErrTenantMoveNotFound     = errors.New("tenant isolation move not found")
+	ErrTenantMoveInProgress   = errors.New("tenant is already being moved")
+	ErrTenantMoveNotCompleted = errors.New("tenant isolation move has not completed")
+	ErrTenantMoveFinished     = errors.New("tenant isolation move has already finished")
+	ErrTenantAlreadyInMode    = errors.New("tenant is already in that isolation mode")
+)
+
+// NewTenantPlacementLookup returns the placement lookup for a TenantConnectionResolver.
+// A tenant is frozen while a move to another mode is cutting over and has not yet
+// switched the tenant. The move is read before the tenant, so a switch between
+// the two reads gives the new placement rather than an unfrozen old one.
+func NewTenantPlacementLookup(tenantRepo domain.TenantRepository, migrationRepo domain.TenantIsolationMigrationRepository) database.TenantPlacementFunc {
+	return func(ctx context.Context, tenantID string) (database.TenantPlacement, error) {
+		id, err := uuid.Parse(tenantID)
+		if err != nil {
+			return database.TenantPlacement{}, fmt.Errorf("%w: %q", database.ErrInvalidTenantID, tenantID)
+		}
+		move, err := migrationRepo.GetOpenByTenant(ctx, id)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return database.TenantPlacement{}, fmt.Errorf("failed to get tenant isolation move: %w", err)
+		}
+		tenant, err := tenantRepo.GetByID(ctx, id)
+		if err != nil {
+			return database.TenantPlacement{}, fmt.Errorf("failed to get tenant: %w", err)
+		}
+
+		placement := database.TenantPlacement{Mode: tenantIsolationMode(tenant), DatabaseDSN: tenant.DatabaseDSN}
+		if move != nil && move.Status == domain.TenantMigrationStatusCutover {
+			placement.Frozen = placement.Mode != move.ToMode || placement.DatabaseDSN != move.ToDatabaseDSN
+		}
+		return placement, nil
+	}
+}
+
+// tenantIsolationMode returns the tenant's isolation mode; tenants created before
+// modes existed have none and use the shared tables
+func tenantIsolationMode(tenant *domain.Tenant) string {
+	if tenant.IsolationMode == "" {
+		return domain.TenantIsolationShared
+	}
+	return tenant.IsolationMode
+}
+
+// TenantIsolationService moves tenants between isolation modes online. The tenant's
+// rows are copied to the target while it stays live. The cutover then freezes the
+// tenant, waits until every instance has seen the freeze and takes the tenant's
+// write fence, so no transaction can write to the source any more. It copies the
+// rows written since the copy snapshot, removes rows deleted meanwhile and
+// switches the tenant to the target. The source rows are kept until CleanupSource
+// is called. Moves whose process stopped are picked up again by ResumeMoves.
+type TenantIsolationService struct {
+	migrationRepo domain.TenantIsolationMigrationRepository
+	tenantRepo    domain.TenantRepository
+	postgres      *database.PostgresDB
+	resolver      *database.TenantConnectionResolver
+	logger        *zap.Logger
+}
+
+// NewTenantIsolationService creates a new tenant isolation service
+func NewTenantIsolationService(
+	migrationRepo domain.TenantIsolationMigrationRepository,
+	tenantRepo domain.TenantRepository,
+	postgres *database.PostgresDB,
+	resolver *database.TenantConnectionResolver,
+	logger *zap.Logger,
+) *TenantIsolationService {
+	return &TenantIsolationService{
+		migrationRepo: migrationRepo,
+		tenantRepo:    tenantRepo,
+		postgres:      postgres,
+		resolver:      resolver,
+		logger:        logger,
+	}
+}
+
+// StartMove starts moving a tenant to another isolation mode. The move runs in the
+// background; its progress is tracked on the returned record.
+func (s *TenantIsolationService) StartMove(ctx context.Context, tenantID uuid.UUID, toMode, toDatabaseDSN string, requestedBy *uuid.UUID) (*domain.TenantIsolationMigration, error) {
+	switch toMode {
+	case domain.TenantIsolationShared, domain.TenantIsolationSchema:
+		if toDatabaseDSN != "" {
+			return nil, fmt.Errorf("%w: only the database mode takes a DSN", database.ErrInvalidIsolationMode)
+		}
+	case domain.TenantIsolationDatabase:
+		if toDatabaseDSN == "" {
+			return nil, fmt.Errorf("%w: the database mode needs a DSN", database.ErrInvalidIsolationMode)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", database.ErrInvalidIsolationMode, toMode)
+	}
+
+	tenant, err := s.tenantRepo.GetByID(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	fromMode := tenantIsolationMode(tenant)
+	if fromMode == toMode && tenant.DatabaseDSN == toDatabaseDSN {
+		return nil, ErrTenantAlreadyInMode
+	}
+	if open, err := s.migrationRepo.GetOpenByTenant(ctx, tenantID); err == nil && open != nil {
+		return nil, ErrTenantMoveInProgress
+	}
+
+	movable, err := s.postgres.MovableTenantTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	move := &domain.TenantIsolationMigration{
+		TenantID:        tenantID,
+		FromMode:        fromMode,
+		ToMode:          toMode,
+		FromDatabaseDSN: tenant.DatabaseDSN,
+		ToDatabaseDSN:   toDatabaseDSN,
+		Status:          domain.TenantMigrationStatusCopying,
+		Tables:          movable,
+		RowsCopied:      make(map[string]interface{}),
+		RequestedBy:     requestedBy,
+		StartedAt:       time.Now(),
+	}
+	if err := s.migrationRepo.Create(ctx, move); err != nil {
+		return nil, fmt.Errorf("failed to create tenant isolation move: %w", err)
+	}
+
+	s.runInBackground(move)
+
+	s.logger.Info("Tenant isolation move started",
+		zap.String("tenant_id", tenantID.String()),
+		zap.String("from", fromMode),
+		zap.String("to", toMode))
+	return move, nil
+}
+
+// runInBackground runs a move on a goroutine of its own. The move is locked while
+// it runs, so an instance resuming it leaves it alone, and it is scoped to its
+// tenant like the queries of a request. A panic fails the move.
+func (s *TenantIsolationService) runInBackground(move *domain.TenantIsolationMigration) {
+	go func() {
+		ctx := database.WithTenantID(context.Background(), move.TenantID.String())
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				s.failMove(ctx, move, fmt.Errorf("move panicked: %v", recovered))
+			}
+		}()
+
+		unlock, acquired, err := s.postgres.TryAdvisoryLock(ctx, "tenant_isolation_move:"+move.ID.String())
+		if err != nil {
+			s.logger.Error("Failed to lock tenant isolation move",
+				zap.String("move_id", move.ID.String()),
+				zap.Error(err))
+			return
+		}
+		if !acquired {
+			return
+		}
+		defer unlock()
+
+		// Another instance may have finished the move before the lock was free
+		current, err := s.migrationRepo.GetByID(ctx, move.ID)
+		if err != nil {
+			s.logger.Error("Failed to reload tenant isolation move",
+				zap.String("move_id", move.ID.String()),
+				zap.Error(err))
+			return
+		}
+		if current.Status != domain.TenantMigrationStatusCopying && current.Status != domain.TenantMigrationStatusCutover {
+			return
+		}
+		*move = *current
+		s.run(ctx, move)
+	}()
+}
+
+// run copies the tenant's rows, cuts over and switches the tenant to the target
+// mode. A move resumed in the cutover keeps the rows it copied.
+func (s *TenantIsolationService) run(ctx context.Context, move *domain.TenantIsolationMigration) {
+	tenantKey := move.TenantID.String()
+	src, err := s.resolver.Connect(tenantKey, move.FromMode, move.FromDatabaseDSN)
+	if err != nil {
+		s.failMove(ctx, move, err)
+		return
+	}
+	dst, err := s.resolver.Connect(tenantKey, move.ToMode, move.ToDatabaseDSN)
+	if err != nil {
+		s.failMove(ctx, move, err)
+		return
+	}
+	if err := database.PrepareTenantTables(ctx, dst, move.Tables); err != nil {
+		s.failMove(ctx, move, err)
+		return
+	}
+
+	if move.Status == domain.TenantMigrationStatusCopying {
+		if err := s.copyRows(ctx, move, src, dst); err != nil {
+			s.failMove(ctx, move, err)
+			return
+		}
+	}
+	if err := s.cutover(ctx, move, src, dst); err != nil {
+		s.failMove(ctx, move, err)
+		return
+	}
+
+	// The tenant is switched and unfrozen even if recording the completion fails
+	now := time.Now()
+	move.Status = domain.TenantMigrationStatusCompleted
+	move.CompletedAt = &now
+	if err := s.migrationRepo.Update(ctx, move); err != nil {
+		s.logger.Error("Failed to record tenant isolation move completion",
+			zap.String("move_id", move.ID.String()),
+			zap.Error(err))
+		return
+	}
+
+	s.logger.Info("Tenant isolation move completed",
+		zap.String("tenant_id", tenantKey),
+		zap.String("to", move.ToMode))
+}
+
+// copyRows takes the copy snapshot, copies the tenant's rows while it stays live
+// and starts the cutover
+func (s *TenantIsolationService) copyRows(ctx context.Context, move *domain.TenantIsolationMigration, src, dst *database.TenantDB) error {
+	snapshot, err := database.CopySnapshot(ctx, src)
+	if err != nil {
+		return err
+	}
+	move.CopySnapshot = snapshot
+
+	for _, table := range move.Tables {
+		copied, err := database.CopyTenantTable(ctx, table, src, dst, nil)
+		if err != nil {
+			return err
+		}
+		move.RowsCopied[table] = copied
+		if err := s.migrationRepo.Update(ctx, move); err != nil {
+			return fmt.Errorf("failed to record copy progress: %w", err)
+		}
+	}
+
+	now := time.Now()
+	move.Status = domain.TenantMigrationStatusCutover
+	move.CutoverAt = &now
+	if err := s.migrationRepo.Update(ctx, move); err != nil {
+		return fmt.Errorf("failed to start cutover: %w", err)
+	}
+	return nil
+}
+
+// cutover waits until every instance sees the tenant frozen, takes its writes,
+// copies the rows written since the copy snapshot and switches the tenant
+func (s *TenantIsolationService) cutover(ctx context.Context, move *domain.TenantIsolationMigration, src, dst *database.TenantDB) error {
+	tenantKey := move.TenantID.String()
+	s.resolver.Invalidate(tenantKey)
+	select {
+	case <-time.After(s.resolver.FreezeWait()):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Waits for the tenant's transactions that began before the freeze
+	unlock, err := database.LockTenantWrites(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, table := range move.Tables {
+		copied, err := database.CopyTenantTable(ctx, table, src, dst, &move.CopySnapshot)
+		if err != nil {
+			return err
+		}
+		if _, err := database.PruneTenantTable(ctx, table, src, dst); err != nil {
+			return err
+		}
+		total, _ := move.RowsCopied[table].(int64)
+		move.RowsCopied[table] = total + copied
+	}
+
+	tenant, err := s.tenantRepo.GetByID(ctx, move.TenantID)
+	if err != nil {
+		return fmt.Errorf("failed to get tenant: %w", err)
+	}
+	tenant.IsolationMode = move.ToMode
+	tenant.DatabaseDSN = move.ToDatabaseDSN
+	if err := s.tenantRepo.Update(ctx, tenant); err != nil {
+		return fmt.Errorf("failed to switch tenant: %w", err)
+	}
+	s.resolver.Invalidate(tenantKey)
+	return nil
+}
+
+// failMove records a failed move. The tenant stays in its source mode and is
+// unfrozen; rows already copied to the target are replaced by the next attempt.
+func (s *TenantIsolationService) failMove(ctx context.Context, move *domain.TenantIsolationMigration, moveErr error) {
+	s.logger.Error("Tenant isolation move failed",
+		zap.String("move_id", move.ID.String()),
+		zap.String("tenant_id", move.TenantID.String()),
+		zap.Error(moveErr))
+
+	move.Status = domain.TenantMigrationStatusFailed
+	move.ErrorMessage = moveErr.Error()
+	if err := s.migrationRepo.Update(ctx, move); err != nil {
+		s.logger.Error("Failed to record tenant isolation move failure", zap.Error(err))
+	}
+	s.resolver.Invalidate(move.TenantID.String())
+}
+
+// AbortMove marks a move that is no longer running, such as one whose process
+// stopped, as failed so the tenant is unfrozen and can be moved again
+func (s *TenantIsolationService) AbortMove(ctx context.Context, moveID uuid.UUID) (*domain.TenantIsolationMigration, error) {
+	move, err := s.GetMove(ctx, moveID)
+	if err != nil {
+		return nil, err
+	}
+	if move.Status != domain.TenantMigrationStatusCopying && move.Status != domain.TenantMigrationStatusCutover {
+		return nil, ErrTenantMoveFinished
+	}
+	s.failMove(ctx, move, errors.New("move aborted"))
+	return move, nil
+}
+
+// CleanupSource removes the tenant's rows from the source of a completed move: the
+// schema is dropped, or the rows are deleted from the shared tables or the database
+func (s *TenantIsolationService) CleanupSource(ctx context.Context, moveID uuid.UUID) (*domain.TenantIsolationMigration, error) {
+	move, err := s.GetMove(ctx, moveID)
+	if err != nil {
+		return nil, err
+	}
+	if move.Status != domain.TenantMigrationStatusCompleted {
+		return nil, ErrTenantMoveNotCompleted
+	}
+
+	tenantKey := move.TenantID.String()
+	var removed map[string]int64
+	if move.FromMode == domain.TenantIsolationSchema {
+		if err := s.postgres.DropTenantSchema(tenantKey); err != nil {
+			return nil, fmt.Errorf("failed to drop tenant schema: %w", err)
+		}
+	} else {
+		src, err := s.resolver.Connect(tenantKey, move.FromMode, move.FromDatabaseDSN)
+		if err != nil {
+			return nil, err
+		}
+		if removed, err = database.DeleteTenantRows(ctx, src, move.Tables); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	move.Status = domain.TenantMigrationStatusCleaned
+	move.CleanedAt = &now
+	if err := s.migrationRepo.Update(ctx, move); err != nil {
+		return nil, fmt.Errorf("failed to record tenant isolation move cleanup: %w", err)
+	}
+
+	s.logger.Info("Tenant isolation move source cleaned up",
+		zap.String("move_id", moveID.String()),
+		zap.Any("rows_deleted", removed))
+	return move, nil
+}
+
+// ResumeMoves picks up the moves that are copying or cutting over but no longer
+// running, such as those of a process that stopped. Moves still running elsewhere
+// are left alone.
+func (s *TenantIsolationService) ResumeMoves(ctx context.Context) error {
+	moves, err := s.migrationRepo.ListOpen(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list open tenant isolation moves: %w", err)
+	}
+	for _, move := range moves {
+		s.runInBackground(move)
+	}
+	return nil
+}
+
+// ScheduleMoveResume resumes stopped moves on the job runner
+func (s *TenantIsolationService) ScheduleMoveResume(runner *services.JobRunner, jobs config.JobsConfig) {
+	runner.Every("resume_tenant_isolation_moves", jobs.TenantMoveResumeInterval, s.ResumeMoves)
+}
+
+// GetMove gets a tenant isolation move
+func (s *TenantIsolationService) GetMove(ctx context.Context, moveID uuid.UUID) (*domain.TenantIsolationMigration, error) {
+	move, err := s.migrationRepo.GetByID(ctx, moveID)
+	if err != nil {
+		return nil, ErrTenantMoveNotFound
+	}
+	return move, nil
+}
+
+// ListMoves lists a tenant's isolation moves, newest first
+func (s *TenantIsolationService) ListMoves(ctx context.Context, tenantID uuid.UUID) ([]*domain.TenantIsolationMigration, error) {
+	moves, err := s.migrationRepo.ListByTenant(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenant isolation moves: %w", err)
+	}
+	return moves, nil
+}
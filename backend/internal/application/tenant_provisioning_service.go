@@ -0,0 +1,452 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/auth"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
+)
+
+var (
+	ErrTenantAlreadyProvisioned = errors.New("tenant is already provisioned")
+	ErrProvisioningNotStarted   = errors.New("tenant provisioning has not started")
+	ErrProvisioningInProgress   = errors.New("tenant provisioning is already running")
+)
+
+// errStepSkipped is returned by a provisioning step that has nothing to do for the tenant
+var errStepSkipped = errors.New("provisioning step skipped")
+
+// provisioningStep is one step of the provisioning saga. run must be safe to
+// repeat once compensate has undone a partial run; compensate must be safe to
+// call when the step did nothing. compensate gets the data run recorded, which
+// is nil when the step failed or was interrupted.
+type provisioningStep struct {
+	step       int
+	name       string
+	run        func(ctx context.Context, tenant *domain.Tenant) (map[string]interface{}, error)
+	compensate func(ctx context.Context, tenant *domain.Tenant, data map[string]interface{}) error
+}
+
+// TenantProvisioningService creates a tenant's schema, document database, roles and
+// admin user as a saga. Every step is recorded in the tenant's onboarding log, so a
+// failed run can be resumed from the step that failed, or rolled back by running the
+// compensating action of each step that ran, newest first. Runs and rollbacks for a
+// tenant hold a Postgres advisory lock, so only one of them works on it at a time.
+type TenantProvisioningService struct {
+	tenantRepo     domain.TenantRepository
+	onboardingRepo domain.TenantOnboardingRepository
+	postgres       *database.PostgresDB
+	mongo          *database.MongoClient
+	roleService    *RoleService
+	keycloak       *auth.KeycloakClient
+	logger         *zap.Logger
+	steps          []provisioningStep
+}
+
+// NewTenantProvisioningService creates a new tenant provisioning service
+func NewTenantProvisioningService(
+	tenantRepo domain.TenantRepository,
+	onboardingRepo domain.TenantOnboardingRepository,
+	postgres *database.PostgresDB,
+	mongo *database.MongoClient,
+	roleService *RoleService,
+	keycloak *auth.KeycloakClient,
+	logger *zap.Logger,
+) *TenantProvisioningService {
+	s := &TenantProvisioningService{
+		tenantRepo:     tenantRepo,
+		onboardingRepo: onboardingRepo,
+		postgres:       postgres,
+		mongo:          mongo,
+		roleService:    roleService,
+		keycloak:       keycloak,
+		logger:         logger,
+	}
+	s.steps = []provisioningStep{
+		{step: domain.ProvisioningStepSchema, name: "create_schema", run: s.createSchema, compensate: s.dropSchema},
+		{step: domain.ProvisioningStepMongoDatabase, name: "create_mongo_database", run: s.createMongoDatabase, compensate: s.dropMongoDatabase},
+		{step: domain.ProvisioningStepRoles, name: "create_roles", run: s.createRoles, compensate: s.removeRoles},
+		{step: domain.ProvisioningStepAdminUser, name: "create_admin_user", run: s.createAdminUser, compensate: s.deleteAdminUser},
+		{step: domain.ProvisioningStepActivate, name: "activate_tenant", run: s.activateTenant},
+	}
+	return s
+}
+
+// Provision runs the tenant's provisioning steps in order. Steps that already
+// completed are skipped, so calling it again after a failure resumes from the step
+// that failed; that step's partial work is compensated before it is retried.
+func (s *TenantProvisioningService) Provision(ctx context.Context, tenantID uuid.UUID) error {
+	unlock, err := s.lockTenant(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tenant, err := s.tenantRepo.GetByID(ctx, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to get tenant: %w", err)
+	}
+
+	logs, err := s.provisioningLogs(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range s.steps {
+		log := logs[step.step]
+		if log != nil && (log.Status == domain.OnboardingStatusCompleted || log.Status == domain.OnboardingStatusSkipped) {
+			continue
+		}
+
+		// A failed or interrupted step may have done part of its work
+		if log != nil && (log.Status == domain.OnboardingStatusFailed || log.Status == domain.OnboardingStatusInProgress) && step.compensate != nil {
+			if err := step.compensate(ctx, tenant, log.Data); err != nil {
+				s.failStep(ctx, log, err)
+				return fmt.Errorf("failed to clean up provisioning step %s: %w", step.name, err)
+			}
+		}
+
+		log, err = s.startStep(ctx, tenantID, step, log)
+		if err != nil {
+			return err
+		}
+
+		data, err := step.run(ctx, tenant)
+		if errors.Is(err, errStepSkipped) {
+			if err := s.finishStep(ctx, log, domain.OnboardingStatusSkipped, data); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			s.failStep(ctx, log, err)
+			return fmt.Errorf("provisioning step %s failed: %w", step.name, err)
+		}
+		if err := s.finishStep(ctx, log, domain.OnboardingStatusCompleted, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rollback undoes a provisioning run that did not finish by compensating each step
+// that ran, newest first, then cancels the tenant. If a compensation fails the
+// rollback stops there and can be retried.
+func (s *TenantProvisioningService) Rollback(ctx context.Context, tenantID uuid.UUID) error {
+	unlock, err := s.lockTenant(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tenant, err := s.tenantRepo.GetByID(ctx, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to get tenant: %w", err)
+	}
+
+	logs, err := s.provisioningLogs(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if len(logs) == 0 {
+		return ErrProvisioningNotStarted
+	}
+	if log := logs[domain.ProvisioningStepActivate]; log != nil && log.Status == domain.OnboardingStatusCompleted {
+		return ErrTenantAlreadyProvisioned
+	}
+
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		step := s.steps[i]
+		log := logs[step.step]
+		if log == nil || log.Status == domain.OnboardingStatusCompensated || log.Status == domain.OnboardingStatusSkipped {
+			continue
+		}
+
+		if step.compensate != nil {
+			if err := step.compensate(ctx, tenant, log.Data); err != nil {
+				log.ErrorMessage = err.Error()
+				if updateErr := s.onboardingRepo.Update(ctx, log); updateErr != nil {
+					s.logger.Error("Failed to record provisioning rollback error", zap.Error(updateErr))
+				}
+				return fmt.Errorf("failed to compensate provisioning step %s: %w", step.name, err)
+			}
+		}
+
+		log.Status = domain.OnboardingStatusCompensated
+		log.ErrorMessage = ""
+		if err := s.onboardingRepo.Update(ctx, log); err != nil {
+			return fmt.Errorf("failed to record provisioning rollback: %w", err)
+		}
+	}
+
+	if err := s.tenantRepo.CancelTenant(ctx, tenantID); err != nil {
+		return fmt.Errorf("failed to cancel tenant: %w", err)
+	}
+	return nil
+}
+
+// RollbackStale rolls back pending tenants whose provisioning failed or stalled and
+// has not been touched for olderThan, so half-created tenants do not linger. It
+// returns how many tenants were rolled back.
+func (s *TenantProvisioningService) RollbackStale(ctx context.Context, olderThan time.Duration) (int, error) {
+	const batchSize = 100
+	cutoff := time.Now().Add(-olderThan)
+
+	var stale []uuid.UUID
+	for offset := 0; ; offset += batchSize {
+		tenants, err := s.tenantRepo.ListByStatus(ctx, domain.TenantStatusPending, batchSize, offset)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list pending tenants: %w", err)
+		}
+
+		for _, tenant := range tenants {
+			logs, err := s.provisioningLogs(ctx, tenant.ID)
+			if err != nil {
+				return 0, err
+			}
+			if provisioningStalled(logs, cutoff) {
+				stale = append(stale, tenant.ID)
+			}
+		}
+
+		if len(tenants) < batchSize {
+			break
+		}
+	}
+
+	rolledBack := 0
+	for _, tenantID := range stale {
+		err := s.Rollback(ctx, tenantID)
+		if errors.Is(err, ErrProvisioningInProgress) {
+			continue
+		}
+		if err != nil {
+			s.logger.Error("Failed to roll back stale tenant provisioning",
+				zap.String("tenant_id", tenantID.String()),
+				zap.Error(err))
+			continue
+		}
+		rolledBack++
+	}
+	return rolledBack, nil
+}
+
+// GetProvisioningSteps returns the tenant's provisioning log in step order
+func (s *TenantProvisioningService) GetProvisioningSteps(ctx context.Context, tenantID uuid.UUID) ([]*domain.TenantOnboardingLog, error) {
+	logs, err := s.onboardingRepo.ListByTenant(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provisioning log: %w", err)
+	}
+
+	var steps []*domain.TenantOnboardingLog
+	for _, log := range logs {
+		if log.Step >= domain.ProvisioningStepSchema {
+			steps = append(steps, log)
+		}
+	}
+	return steps, nil
+}
+
+// lockTenant keeps other provisioning runs and rollbacks off the tenant until
+// the returned unlock is called
+func (s *TenantProvisioningService) lockTenant(ctx context.Context, tenantID uuid.UUID) (func(), error) {
+	unlock, acquired, err := s.postgres.TryAdvisoryLock(ctx, "tenant_provisioning:"+tenantID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock tenant provisioning: %w", err)
+	}
+	if !acquired {
+		return nil, ErrProvisioningInProgress
+	}
+	return unlock, nil
+}
+
+func (s *TenantProvisioningService) provisioningLogs(ctx context.Context, tenantID uuid.UUID) (map[int]*domain.TenantOnboardingLog, error) {
+	steps, err := s.GetProvisioningSteps(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make(map[int]*domain.TenantOnboardingLog, len(steps))
+	for _, log := range steps {
+		logs[log.Step] = log
+	}
+	return logs, nil
+}
+
+func (s *TenantProvisioningService) startStep(ctx context.Context, tenantID uuid.UUID, step provisioningStep, log *domain.TenantOnboardingLog) (*domain.TenantOnboardingLog, error) {
+	now := time.Now()
+	if log == nil {
+		log = &domain.TenantOnboardingLog{
+			ID:        uuid.New(),
+			TenantID:  tenantID,
+			Step:      step.step,
+			StepName:  step.name,
+			Status:    domain.OnboardingStatusInProgress,
+			StartedAt: &now,
+		}
+		if err := s.onboardingRepo.Create(ctx, log); err != nil {
+			return nil, fmt.Errorf("failed to record provisioning step: %w", err)
+		}
+		return log, nil
+	}
+
+	log.Status = domain.OnboardingStatusInProgress
+	log.ErrorMessage = ""
+	log.StartedAt = &now
+	log.CompletedAt = nil
+	if err := s.onboardingRepo.Update(ctx, log); err != nil {
+		return nil, fmt.Errorf("failed to record provisioning step: %w", err)
+	}
+	return log, nil
+}
+
+func (s *TenantProvisioningService) finishStep(ctx context.Context, log *domain.TenantOnboardingLog, status string, data map[string]interface{}) error {
+	now := time.Now()
+	log.Status = status
+	log.Data = data
+	log.CompletedAt = &now
+	if err := s.onboardingRepo.Update(ctx, log); err != nil {
+		return fmt.Errorf("failed to record provisioning step: %w", err)
+	}
+	return nil
+}
+
+// failStep records a step failure. The step error is what the caller reports, so a
+// failure to record it is only logged.
+func (s *TenantProvisioningService) failStep(ctx context.Context, log *domain.TenantOnboardingLog, stepErr error) {
+	log.Status = domain.OnboardingStatusFailed
+	log.ErrorMessage = stepErr.Error()
+	if err := s.onboardingRepo.Update(ctx, log); err != nil {
+		s.logger.Error("Failed to record provisioning step failure",
+			zap.String("step", log.StepName),
+			zap.Error(err))
+	}
+}
+
+// provisioningStalled reports whether provisioning has a failed or interrupted step
+// and the log has not changed since cutoff
+func provisioningStalled(logs map[int]*domain.TenantOnboardingLog, cutoff time.Time) bool {
+	stalled := false
+	for _, log := range logs {
+		if log.UpdatedAt.After(cutoff) {
+			return false
+		}
+		if log.Status == domain.OnboardingStatusFailed || log.Status == domain.OnboardingStatusInProgress {
+			stalled = true
+		}
+	}
+	return stalled
+}
+
+func (s *TenantProvisioningService) createSchema(ctx context.Context, tenant *domain.Tenant) (map[string]interface{}, error) {
+	schemaName, err := database.TenantSchemaName(tenant.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.postgres.CreateTenantSchema(tenant.ID.String()); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"schema": schemaName}, nil
+}
+
+func (s *TenantProvisioningService) dropSchema(ctx context.Context, tenant *domain.Tenant, _ map[string]interface{}) error {
+	return s.postgres.DropTenantSchema(tenant.ID.String())
+}
+
+func (s *TenantProvisioningService) createMongoDatabase(ctx context.Context, tenant *domain.Tenant) (map[string]interface{}, error) {
+	if err := s.mongo.CreateTenantDatabase(ctx, tenant.ID.String()); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"database": s.mongo.GetTenantDatabase(tenant.ID.String()).Name()}, nil
+}
+
+func (s *TenantProvisioningService) dropMongoDatabase(ctx context.Context, tenant *domain.Tenant, _ map[string]interface{}) error {
+	return s.mongo.DropTenantDatabase(ctx, tenant.ID.String())
+}
+
+// createRoles creates the tenant's default roles. RoleService.InitializeTenantRoles
+// creates them through CasbinService.CreateDefaultTenantRoles, which also syncs
+// their Casbin policies, so one step covers both.
+func (s *TenantProvisioningService) createRoles(ctx context.Context, tenant *domain.Tenant) (map[string]interface{}, error) {
+	if err := s.roleService.InitializeTenantRoles(ctx, tenant.ID); err != nil {
+		return nil, err
+	}
+
+	roles, err := s.roleService.GetTenantRoles(ctx, tenant.ID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return map[string]interface{}{"roles": names}, nil
+}
+
+func (s *TenantProvisioningService) removeRoles(ctx context.Context, tenant *domain.Tenant, _ map[string]interface{}) error {
+	return s.roleService.RemoveTenantRoles(ctx, tenant.ID)
+}
+
+// createAdminUser creates the tenant admin's Keycloak account for the tenant's
+// contact. Tenants without a contact email skip the step.
+func (s *TenantProvisioningService) createAdminUser(ctx context.Context, tenant *domain.Tenant) (map[string]interface{}, error) {
+	if tenant.ContactEmail == "" {
+		return nil, errStepSkipped
+	}
+
+	firstName, lastName, _ := strings.Cut(strings.TrimSpace(tenant.ContactName), " ")
+	user := auth.KeycloakUser{
+		Username:   tenant.ContactEmail,
+		Email:      tenant.ContactEmail,
+		FirstName:  firstName,
+		LastName:   strings.TrimSpace(lastName),
+		Enabled:    true,
+		Attributes: map[string][]string{"tenant_id": {tenant.ID.String()}},
+		RealmRoles: []string{domain.RoleTenantAdmin},
+	}
+	userID, err := s.keycloak.CreateUser(user)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"username": user.Username, "user_id": userID}, nil
+}
+
+// deleteAdminUser deletes the Keycloak account createAdminUser made. When the
+// step did not get to record the account's ID, only accounts with the contact's
+// username that were created for this tenant are deleted; an existing account
+// with the same username belongs to someone else.
+func (s *TenantProvisioningService) deleteAdminUser(ctx context.Context, tenant *domain.Tenant, data map[string]interface{}) error {
+	if userID, ok := data["user_id"].(string); ok && userID != "" {
+		return s.keycloak.DeleteUser(userID)
+	}
+	if tenant.ContactEmail == "" {
+		return nil
+	}
+
+	userIDs, err := s.keycloak.FindUserIDs(tenant.ContactEmail, "tenant_id", tenant.ID.String())
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if err := s.keycloak.DeleteUser(userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TenantProvisioningService) activateTenant(ctx context.Context, tenant *domain.Tenant) (map[string]interface{}, error) {
+	if err := s.tenantRepo.ActivateTenant(ctx, tenant.ID); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
@@ -29,6 +29,8 @@ type Tenant struct {
 	CompanySize        string                 `json:"company_size"`
 	Industry           string                 `json:"industry"`
 	Region             string                 `json:"region" gorm:"default:'us-west-1'"`
+	IsolationMode      string                 `json:"isolation_mode" gorm:"not null;default:'shared'"`
+	DatabaseDSN        string                 `json:"-"` // Dedicated database, for the database isolation mode
 	Timezone           string                 `json:"timezone" gorm:"default:'UTC'"`
 	Language           string                 `json:"language" gorm:"default:'en'"`
 	Currency           string                 `json:"currency" gorm:"default:'USD'"`
@@ -368,6 +370,13 @@ type APIKey struct {
 	Tenant Tenant `json:"tenant" gorm:"foreignKey:TenantID"`
 }
 
+// ChangePosition is a place in a table read in (updated_at, id) order. Rows
+// sharing an updated_at are told apart by their ID, so paging never stalls on them.
+type ChangePosition struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	ID        uuid.UUID `json:"id"`
+}
+
 // AuditLog represents audit logging for tenant activities
 type AuditLog struct {
 	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
@@ -615,6 +624,9 @@ type TenantConfiguration struct {
 	NetworkSettings     map[string]interface{} `json:"network_settings,omitempty"`
 	DatabaseSettings    map[string]interface{} `json:"database_settings,omitempty"`
 	CacheSettings       map[string]interface{} `json:"cache_settings,omitempty"`
+	DiscountStacking    *DiscountStackingRules `json:"discount_stacking,omitempty"`
+	Tax                 *TaxSettings           `json:"tax,omitempty"`
+	Loyalty             *LoyaltySettings       `json:"loyalty,omitempty"`
 }
 
 // TenantBranding represents tenant white-label branding settings
@@ -673,7 +685,7 @@ type TenantOnboardingLog struct {
 	TenantID     uuid.UUID              `json:"tenant_id" gorm:"type:uuid;not null"`
 	Step         int                    `json:"step" gorm:"not null"`
 	StepName     string                 `json:"step_name" gorm:"not null"`
-	Status       string                 `json:"status" gorm:"not null"` // 'pending', 'in_progress', 'completed', 'skipped', 'failed'
+	Status       string                 `json:"status" gorm:"not null"` // 'pending', 'in_progress', 'completed', 'skipped', 'failed', 'compensated'
 	Data         map[string]interface{} `json:"data" gorm:"type:jsonb"`
 	ErrorMessage string                 `json:"error_message"`
 	StartedAt    *time.Time             `json:"started_at"`
@@ -685,6 +697,60 @@ type TenantOnboardingLog struct {
 	Tenant Tenant `json:"tenant" gorm:"foreignKey:TenantID"`
 }
 
+// TenantDeletion tracks a tenant's deletion from the request, through the grace
+// period and data export, to the purge and its signed deletion certificate. It has
+// no relation to Tenant because it outlives the tenant row.
+type TenantDeletion struct {
+	ID                   uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID             uuid.UUID              `json:"tenant_id" gorm:"type:uuid;not null;index"`
+	TenantName           string                 `json:"tenant_name"`
+	Subdomain            string                 `json:"subdomain"`
+	Status               string                 `json:"status" gorm:"not null;default:'scheduled'"` // 'scheduled', 'cancelled', 'purging', 'purged'
+	PreviousStatus       string                 `json:"previous_status"`
+	Reason               string                 `json:"reason"`
+	RequestedBy          *uuid.UUID             `json:"requested_by" gorm:"type:uuid"`
+	RequestedAt          time.Time              `json:"requested_at" gorm:"not null"`
+	PurgeAfter           time.Time              `json:"purge_after" gorm:"not null;index"`
+	CancelledAt          *time.Time             `json:"cancelled_at"`
+	ArchivePath          string                 `json:"-"`
+	ArchiveSHA256        string                 `json:"archive_sha256"`
+	ArchiveSize          int64                  `json:"archive_size"`
+	ExportedAt           *time.Time             `json:"exported_at"`
+	PurgeSummary         map[string]interface{} `json:"purge_summary" gorm:"type:jsonb"`
+	PurgedAt             *time.Time             `json:"purged_at"`
+	Certificate          string                 `json:"certificate" gorm:"type:text"`
+	CertificateSignature string                 `json:"certificate_signature"`
+	ErrorMessage         string                 `json:"error_message"`
+	CreatedAt            time.Time              `json:"created_at"`
+	UpdatedAt            time.Time              `json:"updated_at"`
+}
+
+// TenantIsolationMigration tracks an online move of a tenant's rows from one
+// isolation mode to another. Rows are copied while the tenant stays live, then
+// writes pause briefly for the cutover that copies the rows written since the
+// copy snapshot and switches the tenant over. The source rows are kept until the
+// move is cleaned up.
+type TenantIsolationMigration struct {
+	ID              uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID        uuid.UUID              `json:"tenant_id" gorm:"type:uuid;not null;index"`
+	FromMode        string                 `json:"from_mode" gorm:"not null"`
+	ToMode          string                 `json:"to_mode" gorm:"not null"`
+	FromDatabaseDSN string                 `json:"-"`
+	ToDatabaseDSN   string                 `json:"-"`
+	Status          string                 `json:"status" gorm:"not null;default:'copying'"` // 'copying', 'cutover', 'completed', 'failed', 'cleaned'
+	Tables          []string               `json:"tables" gorm:"type:text[]"`
+	RowsCopied      map[string]interface{} `json:"rows_copied" gorm:"type:jsonb"`
+	CopySnapshot    int64                  `json:"-"` // Oldest source transaction the first copy may have missed
+	ErrorMessage    string                 `json:"error_message"`
+	RequestedBy     *uuid.UUID             `json:"requested_by" gorm:"type:uuid"`
+	StartedAt       time.Time              `json:"started_at" gorm:"not null"`
+	CutoverAt       *time.Time             `json:"cutover_at"`
+	CompletedAt     *time.Time             `json:"completed_at"`
+	CleanedAt       *time.Time             `json:"cleaned_at"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
 // TenantInvitation represents invitations to join a tenant
 type TenantInvitation struct {
 	ID         uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
@@ -765,6 +831,30 @@ const (
 	TenantStatusTrialEnded = "trial_ended"
 )
 
+// Tenant deletion status constants
+const (
+	TenantDeletionStatusScheduled = "scheduled"
+	TenantDeletionStatusCancelled = "cancelled"
+	TenantDeletionStatusPurging   = "purging"
+	TenantDeletionStatusPurged    = "purged"
+)
+
+// Tenant isolation mode constants
+const (
+	TenantIsolationShared   = "shared"   // Rows in the shared tables, told apart by tenant_id
+	TenantIsolationSchema   = "schema"   // Rows in the tenant's own schema of the shared database
+	TenantIsolationDatabase = "database" // Rows in a dedicated database
+)
+
+// Tenant isolation migration status constants
+const (
+	TenantMigrationStatusCopying   = "copying"
+	TenantMigrationStatusCutover   = "cutover"
+	TenantMigrationStatusCompleted = "completed"
+	TenantMigrationStatusFailed    = "failed"
+	TenantMigrationStatusCleaned   = "cleaned"
+)
+
 // Tenant plan constants
 const (
 	TenantPlanStarter      = "starter"
@@ -775,11 +865,12 @@ const (
 
 // Onboarding status constants
 const (
-	OnboardingStatusPending    = "pending"
-	OnboardingStatusInProgress = "in_progress"
-	OnboardingStatusCompleted  = "completed"
-	OnboardingStatusSkipped    = "skipped"
-	OnboardingStatusFailed     = "failed"
+	OnboardingStatusPending     = "pending"
+	OnboardingStatusInProgress  = "in_progress"
+	OnboardingStatusCompleted   = "completed"
+	OnboardingStatusSkipped     = "skipped"
+	OnboardingStatusFailed      = "failed"
+	OnboardingStatusCompensated = "compensated"
 )
 
 // Onboarding step constants
@@ -793,6 +884,16 @@ const (
 	OnboardingStepCompleted    = 7
 )
 
+// Provisioning step constants. Provisioning is logged with the onboarding steps,
+// numbered from 101 so the two never share a log entry.
+const (
+	ProvisioningStepSchema        = 101
+	ProvisioningStepMongoDatabase = 102
+	ProvisioningStepRoles         = 103
+	ProvisioningStepAdminUser     = 104
+	ProvisioningStepActivate      = 105
+)
+
 // Subscription status constants
 const (
 	SubscriptionStatusTrial     = "trial"
@@ -874,6 +975,8 @@ const (
 	ResourceAPIKey     = "api_key"
 	ResourceDomain     = "domain"
 	ResourceSettings   = "settings"
+
+	ResourceRegisterSession = "register_session"
 )
 
 // Constants for actions
@@ -887,6 +990,8 @@ const (
 	ActionView   = "view"
 	ActionManage = "manage"
 	ActionAssign = "assign"
+
+	ActionCashVariance = "cash_variance"
 )
 
 // Constants for permission names
@@ -1157,6 +1262,9 @@ type Product struct {
 	SalePrice    float64 `json:"sale_price"`
 	CostPrice    float64 `json:"cost_price"`
 
+	// Taxation
+	TaxClass string `json:"tax_class" gorm:"default:'standard'"` // standard, reduced, zero, or a tenant-defined class
+
 	// Physical properties
 	Weight float64 `json:"weight"`
 	Length float64 `json:"length"`
@@ -1193,6 +1301,7 @@ type Product struct {
 	Tenant        Tenant             `json:"tenant" gorm:"foreignKey:TenantID"`
 	Category      *ProductCategory   `json:"category" gorm:"foreignKey:CategoryID"`
 	Variations    []ProductVariation `json:"variations" gorm:"foreignKey:ProductID"`
+	Barcodes      []ProductBarcode   `json:"barcodes,omitempty" gorm:"foreignKey:ProductID"`
 	InventoryLogs []InventoryLog     `json:"inventory_logs" gorm:"foreignKey:ProductID"`
 }
 
@@ -1217,7 +1326,27 @@ type ProductVariation struct {
 	UpdatedAt     time.Time              `json:"updated_at"`
 
 	// Relationships
-	Product Product `json:"product" gorm:"foreignKey:ProductID"`
+	Product  Product          `json:"product" gorm:"foreignKey:ProductID"`
+	Barcodes []ProductBarcode `json:"barcodes,omitempty" gorm:"foreignKey:VariationID"`
+}
+
+// ProductBarcode is one scannable code printed on a product or variation. A
+// product may carry several, e.g. a manufacturer EAN-13 and an in-store Code128
+type ProductBarcode struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID    string     `json:"tenant_id" gorm:"type:varchar(50);not null;uniqueIndex:idx_product_barcodes_code"`
+	ProductID   uuid.UUID  `json:"product_id" gorm:"type:uuid;not null;index"`
+	VariationID *uuid.UUID `json:"variation_id" gorm:"type:uuid;index"`
+	Code        string     `json:"code" gorm:"not null;uniqueIndex:idx_product_barcodes_code"`
+	Symbology   string     `json:"symbology" gorm:"not null"` // ean13, upca, code128
+	IsPrimary   bool       `json:"is_primary" gorm:"default:false"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Relationships
+	Tenant    Tenant            `json:"tenant" gorm:"foreignKey:TenantID"`
+	Product   *Product          `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	Variation *ProductVariation `json:"variation,omitempty" gorm:"foreignKey:VariationID"`
 }
 
 // InventoryLog tracks all inventory movements
@@ -1226,7 +1355,8 @@ type InventoryLog struct {
 	TenantID       string                 `json:"tenant_id" gorm:"type:varchar(50);not null"`
 	ProductID      uuid.UUID              `json:"product_id" gorm:"type:uuid;not null"`
 	VariationID    *uuid.UUID             `json:"variation_id" gorm:"type:uuid"`
-	Type           string                 `json:"type" gorm:"not null"` // 'in', 'out', 'adjustment', 'sale', 'return'
+	LocationID     *uuid.UUID             `json:"location_id" gorm:"type:uuid"`
+	Type           string                 `json:"type" gorm:"not null"` // 'in', 'out', 'adjustment', 'sale', 'return', 'transfer_out', 'transfer_in'
 	Quantity       int                    `json:"quantity" gorm:"not null"`
 	QuantityBefore int                    `json:"quantity_before" gorm:"not null"`
 	QuantityAfter  int                    `json:"quantity_after" gorm:"not null"`
@@ -1252,7 +1382,9 @@ type Cart struct {
 	ID            uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	TenantID      string                 `json:"tenant_id" gorm:"type:varchar(50);not null"`
 	UserID        *uuid.UUID             `json:"user_id" gorm:"type:uuid"`
+	CustomerID    *uuid.UUID             `json:"customer_id" gorm:"type:uuid"`   // Customer identified at the till, for loyalty
 	SessionID     string                 `json:"session_id"`                     // For guest users
+	LocationID    *uuid.UUID             `json:"location_id" gorm:"type:uuid"`   // Fulfilment location; the tenant default when empty
 	Status        string                 `json:"status" gorm:"default:'active'"` // active, abandoned, converted
 	Currency      string                 `json:"currency" gorm:"default:'USD'"`
 	Subtotal      float64                `json:"subtotal" gorm:"default:0"`
@@ -1282,8 +1414,19 @@ type CartItem struct {
 	TotalPrice  float64                `json:"total_price" gorm:"not null"`
 	ProductData map[string]interface{} `json:"product_data" gorm:"type:jsonb"` // Snapshot of product data
 	Metadata    map[string]interface{} `json:"metadata" gorm:"type:jsonb;default:'{}'"`
-	CreatedAt   time.Time              `json:"created_at"`
-	UpdatedAt   time.Time              `json:"updated_at"`
+
+	// Pricing. BasePrice is the catalog price when the line was added, nil on
+	// lines added before it was kept; UnitPrice is what the price lists make of
+	// it, with the rule that set it kept for audit. A PriceLocked line keeps the
+	// UnitPrice it was created with, e.g. the price an offline terminal charged.
+	BasePrice   *float64               `json:"base_price"`
+	PriceLocked bool                   `json:"price_locked" gorm:"default:false"`
+	PriceListID *uuid.UUID             `json:"price_list_id" gorm:"type:uuid"`
+	PriceRuleID *uuid.UUID             `json:"price_rule_id" gorm:"type:uuid"`
+	PriceRule   map[string]interface{} `json:"price_rule,omitempty" gorm:"type:jsonb"` // Snapshot of the applied rule
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 
 	// Relationships
 	Cart      Cart              `json:"cart" gorm:"foreignKey:CartID"`
@@ -1297,10 +1440,12 @@ type Order struct {
 	TenantID    string     `json:"tenant_id" gorm:"type:varchar(50);not null"`
 	OrderNumber string     `json:"order_number" gorm:"not null"`
 	UserID      *uuid.UUID `json:"user_id" gorm:"type:uuid"`
+	CustomerID  *uuid.UUID `json:"customer_id" gorm:"type:uuid;index"`
+	LocationID  *uuid.UUID `json:"location_id" gorm:"type:uuid"` // Location the order was fulfilled from
 
 	// Order status
-	Status        string `json:"status" gorm:"default:'pending'"`         // pending, processing, shipped, delivered, cancelled, refunded
-	PaymentStatus string `json:"payment_status" gorm:"default:'pending'"` // pending, paid, failed, refunded, partially_refunded
+	Status        string `json:"status" gorm:"default:'pending'"`         // pending, processing, shipped, delivered, cancelled, refunded, partially_refunded
+	PaymentStatus string `json:"payment_status" gorm:"default:'pending'"` // pending, authorized, partially_paid, paid, failed, refunded, partially_refunded
 
 	// Customer information
 	CustomerEmail   string                 `json:"customer_email"`
@@ -1335,6 +1480,7 @@ type Order struct {
 	// Relationships
 	Tenant       Tenant               `json:"tenant" gorm:"foreignKey:TenantID"`
 	User         *User                `json:"user" gorm:"foreignKey:UserID"`
+	Customer     *Customer            `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
 	Items        []OrderItem          `json:"items" gorm:"foreignKey:OrderID"`
 	Transactions []PaymentTransaction `json:"transactions" gorm:"foreignKey:OrderID"`
 	Receipts     []Receipt            `json:"receipts" gorm:"foreignKey:OrderID"`
@@ -1350,6 +1496,11 @@ type OrderItem struct {
 	UnitPrice   float64    `json:"unit_price" gorm:"not null"`
 	TotalPrice  float64    `json:"total_price" gorm:"not null"`
 
+	// Tax breakdown for this line
+	TaxClass string    `json:"tax_class"`
+	TaxTotal float64   `json:"tax_total" gorm:"default:0"`
+	TaxLines []TaxLine `json:"tax_lines" gorm:"type:jsonb"`
+
 	// Snapshot data (in case product is deleted)
 	ProductName string                 `json:"product_name" gorm:"not null"`
 	ProductSKU  string                 `json:"product_sku"`
@@ -1382,8 +1533,8 @@ type PaymentTransaction struct {
 	NetAmount float64 `json:"net_amount"`
 
 	// Status and type
-	Status string `json:"status" gorm:"not null"` // pending, completed, failed, cancelled, refunded
-	Type   string `json:"type" gorm:"not null"`   // payment, refund, partial_refund
+	Status string `json:"status" gorm:"not null"` // pending, authorized, completed, failed, cancelled, refunded
+	Type   string `json:"type" gorm:"not null"`   // payment, refund, partial_refund, authorization, capture, void
 
 	// Gateway response
 	GatewayResponse map[string]interface{} `json:"gateway_response" gorm:"type:jsonb"`
@@ -1391,6 +1542,7 @@ type PaymentTransaction struct {
 
 	// Reference
 	ParentTransactionID *uuid.UUID `json:"parent_transaction_id" gorm:"type:uuid"`
+	RegisterSessionID   *uuid.UUID `json:"register_session_id" gorm:"type:uuid"` // Register shift the payment was taken on
 
 	// Timestamps
 	ProcessedAt *time.Time `json:"processed_at"`
@@ -1512,21 +1664,508 @@ type Discount struct {
 	Tenant Tenant `json:"tenant" gorm:"foreignKey:TenantID"`
 }
 
+// DiscountUsage records a discount redeemed on an order, for per-customer limits
+type DiscountUsage struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID   string     `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	DiscountID uuid.UUID  `json:"discount_id" gorm:"type:uuid;not null;index"`
+	OrderID    uuid.UUID  `json:"order_id" gorm:"type:uuid;not null"`
+	UserID     *uuid.UUID `json:"user_id" gorm:"type:uuid;index"`
+	CustomerID *uuid.UUID `json:"customer_id" gorm:"type:uuid;index"` // Customer the per-customer limit counts against
+	Code       string     `json:"code"`
+	Amount     float64    `json:"amount"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Relationships
+	Discount Discount `json:"discount" gorm:"foreignKey:DiscountID"`
+	Order    Order    `json:"order" gorm:"foreignKey:OrderID"`
+}
+
+// DiscountStackingRules controls how several discount codes combine on one cart
+type DiscountStackingRules struct {
+	AllowStacking       bool `json:"allow_stacking"`       // Allow more than one code per cart
+	MaxCodes            int  `json:"max_codes"`            // 0 means no limit when stacking is allowed
+	CompoundPercentages bool `json:"compound_percentages"` // Apply percentage codes to the already discounted price
+}
+
+// PriceList overrides catalog prices for some customers, locations or times,
+// e.g. wholesale prices, a location's own prices or a happy hour. When several
+// lists apply to a cart line, the highest priority list with a matching rule wins
+type PriceList struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID    string    `json:"tenant_id" gorm:"type:varchar(50);not null;index"`
+	Name        string    `json:"name" gorm:"not null"`
+	Description string    `json:"description"`
+	Priority    int       `json:"priority" gorm:"default:0"` // Higher priority lists are tried first
+	IsActive    bool      `json:"is_active" gorm:"default:true"`
+
+	// Who and where. An empty list applies to every customer group or location
+	CustomerGroups []string `json:"customer_groups" gorm:"type:text[]"` // Customer.Group values, e.g. wholesale
+	LocationIDs    []string `json:"location_ids" gorm:"type:text[]"`    // Stock locations the cart is fulfilled from
+
+	// When. StartsAt and EndsAt bound the list; the weekly window repeats within
+	// them in the list's time zone. An EndTime before StartTime runs past midnight
+	StartsAt   *time.Time `json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at"`
+	DaysOfWeek []string   `json:"days_of_week" gorm:"type:text[]"` // mon, tue, ...; empty is every day
+	StartTime  string     `json:"start_time"`                      // HH:MM; empty is all day
+	EndTime    string     `json:"end_time"`                        // HH:MM
+	Timezone   string     `json:"timezone" gorm:"default:'UTC'"`
+
+	Metadata  map[string]interface{} `json:"metadata" gorm:"type:jsonb;default:'{}'"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+
+	// Relationships
+	Tenant Tenant          `json:"tenant" gorm:"foreignKey:TenantID"`
+	Rules  []PriceListRule `json:"rules,omitempty" gorm:"foreignKey:PriceListID"`
+}
+
+// PriceListRule prices what it targets: a variation, a product, the products
+// of a category or, with no target, everything. MinQuantity makes it a
+// quantity break; the most specific rule wins, then the highest tier reached
+type PriceListRule struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID    string     `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	PriceListID uuid.UUID  `json:"price_list_id" gorm:"type:uuid;not null;index"`
+	ProductID   *uuid.UUID `json:"product_id" gorm:"type:uuid"`
+	VariationID *uuid.UUID `json:"variation_id" gorm:"type:uuid"`
+	CategoryID  *uuid.UUID `json:"category_id" gorm:"type:uuid"`
+	MinQuantity int        `json:"min_quantity" gorm:"not null;default:1"`
+	PriceType   string     `json:"price_type" gorm:"not null"` // fixed, percentage_off, amount_off
+	Value       float64    `json:"value" gorm:"not null"`      // The price, percentage or amount
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// TaxZone groups tax rates that apply to a set of destination addresses
+type TaxZone struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID    string    `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	Name        string    `json:"name" gorm:"not null"`
+	Countries   []string  `json:"countries" gorm:"type:text[]"`    // ISO country codes; empty matches any country
+	States      []string  `json:"states" gorm:"type:text[]"`       // State or region codes; empty matches any state
+	PostalCodes []string  `json:"postal_codes" gorm:"type:text[]"` // Exact codes or prefixes ending in *
+	Priority    int       `json:"priority" gorm:"default:0"`       // Lower priority zones are matched first
+	IsActive    bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Relationships
+	Tenant Tenant    `json:"tenant" gorm:"foreignKey:TenantID"`
+	Rates  []TaxRate `json:"rates" gorm:"foreignKey:ZoneID"`
+}
+
+// TaxRate is a single tax applied to one tax class within a zone
+type TaxRate struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID  string    `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	ZoneID    uuid.UUID `json:"zone_id" gorm:"type:uuid;not null"`
+	Name      string    `json:"name" gorm:"not null"` // Label shown on receipts, e.g. "VAT" or "State tax"
+	TaxClass  string    `json:"tax_class" gorm:"default:'standard'"`
+	Rate      float64   `json:"rate" gorm:"not null"`          // Percentage, e.g. 8.25
+	Priority  int       `json:"priority" gorm:"default:0"`     // Rates are applied in ascending priority
+	Compound  bool      `json:"compound" gorm:"default:false"` // Charged on top of the taxes applied before it
+	Shipping  bool      `json:"shipping" gorm:"default:true"`  // Also applies to shipping charges
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Relationships
+	Zone TaxZone `json:"zone" gorm:"foreignKey:ZoneID"`
+}
+
+// TaxLine is one tax charged on an order line or on shipping
+type TaxLine struct {
+	RateID   uuid.UUID `json:"rate_id"`
+	Name     string    `json:"name"`
+	Rate     float64   `json:"rate"`
+	Compound bool      `json:"compound"`
+	Amount   float64   `json:"amount"`
+}
+
+// TaxSettings controls how a tenant's prices are taxed
+type TaxSettings struct {
+	PricesIncludeTax bool                   `json:"prices_include_tax"`
+	TaxBasedOn       string                 `json:"tax_based_on"`       // shipping or billing
+	ShippingTaxClass string                 `json:"shipping_tax_class"` // Tax class applied to shipping charges
+	BaseAddress      map[string]interface{} `json:"base_address"`       // Store address used before the customer's is known
+}
+
+// LoyaltySettings are a tenant's rules for earning and redeeming loyalty points
+type LoyaltySettings struct {
+	Enabled bool `json:"enabled"`
+
+	// Earn rules. Points are earned on what the customer paid for the goods:
+	// after discounts, before tax and shipping, rounded down
+	PointsPerUnit float64 `json:"points_per_unit"` // Points per unit of currency spent
+	MinimumSpend  float64 `json:"minimum_spend"`   // Orders spending less earn nothing
+
+	// Burn rules
+	PointValue          float64 `json:"point_value"`           // Discount one point is worth
+	MinimumRedeemPoints int     `json:"minimum_redeem_points"` // Smallest redemption accepted
+	MaxRedeemPercent    float64 `json:"max_redeem_percent"`    // Largest share of the discounted subtotal points can pay; 0 means all of it
+}
+
+// StockLocation is a shop, warehouse or other place a tenant holds stock
+type StockLocation struct {
+	ID        uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID  string                 `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	Code      string                 `json:"code" gorm:"not null"` // Short code unique per tenant, e.g. "WH1"
+	Name      string                 `json:"name" gorm:"not null"`
+	Type      string                 `json:"type" gorm:"default:'store'"` // store, warehouse
+	Address   map[string]interface{} `json:"address" gorm:"type:jsonb"`
+	IsDefault bool                   `json:"is_default" gorm:"default:false"` // Fulfils carts that do not pick a location
+	IsActive  bool                   `json:"is_active" gorm:"default:true"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+
+	// Relationships
+	Tenant Tenant `json:"tenant" gorm:"foreignKey:TenantID"`
+}
+
+// StockLevel is the quantity of a product or variation on hand at one location.
+// Product and variation StockQuantity hold the total across all locations.
+type StockLevel struct {
+	ID                uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID          string     `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	LocationID        uuid.UUID  `json:"location_id" gorm:"type:uuid;not null"`
+	ProductID         uuid.UUID  `json:"product_id" gorm:"type:uuid;not null"`
+	VariationID       *uuid.UUID `json:"variation_id" gorm:"type:uuid"`
+	Quantity          int        `json:"quantity" gorm:"not null;default:0"`
+	LowStockThreshold int        `json:"low_stock_threshold" gorm:"default:0"` // 0 uses the product's threshold
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+
+	// Relationships
+	Location  StockLocation     `json:"location" gorm:"foreignKey:LocationID"`
+	Product   Product           `json:"product" gorm:"foreignKey:ProductID"`
+	Variation *ProductVariation `json:"variation" gorm:"foreignKey:VariationID"`
+}
+
+// StockTransfer moves stock from one location to another. Shipping takes the
+// stock out of the source and receiving adds it to the destination.
+type StockTransfer struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID       string     `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	TransferNumber string     `json:"transfer_number" gorm:"not null"`
+	FromLocationID uuid.UUID  `json:"from_location_id" gorm:"type:uuid;not null"`
+	ToLocationID   uuid.UUID  `json:"to_location_id" gorm:"type:uuid;not null"`
+	Status         string     `json:"status" gorm:"default:'draft'"` // draft, in_transit, received, cancelled
+	Notes          string     `json:"notes"`
+	CreatedBy      *uuid.UUID `json:"created_by" gorm:"type:uuid"`
+	ShippedAt      *time.Time `json:"shipped_at"`
+	ReceivedAt     *time.Time `json:"received_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relationships
+	FromLocation StockLocation       `json:"from_location" gorm:"foreignKey:FromLocationID"`
+	ToLocation   StockLocation       `json:"to_location" gorm:"foreignKey:ToLocationID"`
+	Items        []StockTransferItem `json:"items" gorm:"foreignKey:TransferID"`
+}
+
+// StockTransferItem is one product or variation on a transfer
+type StockTransferItem struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TransferID  uuid.UUID  `json:"transfer_id" gorm:"type:uuid;not null"`
+	ProductID   uuid.UUID  `json:"product_id" gorm:"type:uuid;not null"`
+	VariationID *uuid.UUID `json:"variation_id" gorm:"type:uuid"`
+	Quantity    int        `json:"quantity" gorm:"not null"`
+
+	// Relationships
+	Product   Product           `json:"product" gorm:"foreignKey:ProductID"`
+	Variation *ProductVariation `json:"variation" gorm:"foreignKey:VariationID"`
+}
+
+// Supplier is a vendor the tenant buys stock from
+type Supplier struct {
+	ID           uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID     string                 `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	Code         string                 `json:"code" gorm:"not null"`
+	Name         string                 `json:"name" gorm:"not null"`
+	ContactName  string                 `json:"contact_name"`
+	Email        string                 `json:"email"`
+	Phone        string                 `json:"phone"`
+	Address      map[string]interface{} `json:"address" gorm:"type:jsonb"`
+	Currency     string                 `json:"currency" gorm:"default:'USD'"`
+	LeadTimeDays int                    `json:"lead_time_days" gorm:"default:0"`
+	PaymentTerms string                 `json:"payment_terms"` // e.g. "Net 30"
+	Notes        string                 `json:"notes"`
+	IsActive     bool                   `json:"is_active" gorm:"default:true"`
+	Metadata     map[string]interface{} `json:"metadata" gorm:"type:jsonb;default:'{}'"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+
+	// Relationships
+	Tenant Tenant `json:"tenant" gorm:"foreignKey:TenantID"`
+}
+
+// PurchaseOrder is an order placed with a supplier. Shipping and other costs
+// are spread over the lines by value to give each unit's landed cost.
+type PurchaseOrder struct {
+	ID           uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID     string                 `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	OrderNumber  string                 `json:"order_number" gorm:"not null"`
+	SupplierID   uuid.UUID              `json:"supplier_id" gorm:"type:uuid;not null"`
+	LocationID   *uuid.UUID             `json:"location_id" gorm:"type:uuid"`  // Location the stock is received into
+	Status       string                 `json:"status" gorm:"default:'draft'"` // draft, ordered, partially_received, received, cancelled
+	Currency     string                 `json:"currency" gorm:"default:'USD'"`
+	Subtotal     float64                `json:"subtotal" gorm:"default:0"`
+	ShippingCost float64                `json:"shipping_cost" gorm:"default:0"`
+	OtherCosts   float64                `json:"other_costs" gorm:"default:0"` // Duties, insurance and other landed costs
+	Total        float64                `json:"total" gorm:"default:0"`
+	ExpectedAt   *time.Time             `json:"expected_at"`
+	OrderedAt    *time.Time             `json:"ordered_at"`
+	ReceivedAt   *time.Time             `json:"received_at"`
+	Notes        string                 `json:"notes"`
+	CreatedBy    *uuid.UUID             `json:"created_by" gorm:"type:uuid"`
+	Metadata     map[string]interface{} `json:"metadata" gorm:"type:jsonb;default:'{}'"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+
+	// Relationships
+	Supplier Supplier            `json:"supplier" gorm:"foreignKey:SupplierID"`
+	Location *StockLocation      `json:"location" gorm:"foreignKey:LocationID"`
+	Items    []PurchaseOrderItem `json:"items" gorm:"foreignKey:PurchaseOrderID"`
+}
+
+// PurchaseOrderItem is one product or variation ordered from a supplier
+type PurchaseOrderItem struct {
+	ID               uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	PurchaseOrderID  uuid.UUID  `json:"purchase_order_id" gorm:"type:uuid;not null"`
+	ProductID        uuid.UUID  `json:"product_id" gorm:"type:uuid;not null"`
+	VariationID      *uuid.UUID `json:"variation_id" gorm:"type:uuid"`
+	SupplierSKU      string     `json:"supplier_sku"`
+	Quantity         int        `json:"quantity" gorm:"not null"`
+	QuantityReceived int        `json:"quantity_received" gorm:"default:0"`
+	UnitCost         float64    `json:"unit_cost" gorm:"not null"` // Expected cost from the supplier
+	TotalCost        float64    `json:"total_cost" gorm:"not null"`
+
+	// Relationships
+	PurchaseOrder PurchaseOrder     `json:"purchase_order" gorm:"foreignKey:PurchaseOrderID"`
+	Product       Product           `json:"product" gorm:"foreignKey:ProductID"`
+	Variation     *ProductVariation `json:"variation" gorm:"foreignKey:VariationID"`
+}
+
+// RegisterSession is one shift on a cash register, from opening float to the
+// closing count. Payments and refunds taken on the register carry its ID.
+type RegisterSession struct {
+	ID           uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID     string                 `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	LocationID   *uuid.UUID             `json:"location_id" gorm:"type:uuid"`
+	RegisterName string                 `json:"register_name" gorm:"not null"`
+	Status       string                 `json:"status" gorm:"default:'open'"` // open, closed
+	OpeningFloat float64                `json:"opening_float" gorm:"default:0"`
+	ExpectedCash float64                `json:"expected_cash" gorm:"default:0"` // Set when the session closes
+	CountedCash  *float64               `json:"counted_cash"`
+	CashVariance float64                `json:"cash_variance" gorm:"default:0"` // Counted minus expected; negative is a shortage
+	OpenedBy     uuid.UUID              `json:"opened_by" gorm:"type:uuid;not null"`
+	ClosedBy     *uuid.UUID             `json:"closed_by" gorm:"type:uuid"`
+	OpenedAt     time.Time              `json:"opened_at"`
+	ClosedAt     *time.Time             `json:"closed_at"`
+	ZReport      map[string]interface{} `json:"z_report" gorm:"type:jsonb"` // Report frozen at close
+	Notes        string                 `json:"notes"`
+	Metadata     map[string]interface{} `json:"metadata" gorm:"type:jsonb;default:'{}'"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+
+	// Relationships
+	Tenant        Tenant         `json:"tenant" gorm:"foreignKey:TenantID"`
+	Location      *StockLocation `json:"location" gorm:"foreignKey:LocationID"`
+	Opener        User           `json:"opener" gorm:"foreignKey:OpenedBy"`
+	CashMovements []CashMovement `json:"cash_movements" gorm:"foreignKey:SessionID"`
+}
+
+// CashMovement is cash put into or taken out of a register drawer outside a
+// sale, such as a float top-up or a bank drop
+type CashMovement struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID  string     `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	SessionID uuid.UUID  `json:"session_id" gorm:"type:uuid;not null"`
+	Type      string     `json:"type" gorm:"not null"` // cash_in, cash_out
+	Amount    float64    `json:"amount" gorm:"not null"`
+	Reason    string     `json:"reason"`
+	UserID    *uuid.UUID `json:"user_id" gorm:"type:uuid"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relationships
+	Session RegisterSession `json:"session" gorm:"foreignKey:SessionID"`
+	User    *User           `json:"user" gorm:"foreignKey:UserID"`
+}
+
+// SyncRecord remembers an order, payment or stock movement uploaded by an
+// offline terminal under its client-generated ID, so a re-sent batch is not
+// applied twice
+type SyncRecord struct {
+	ID              uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID        string                 `json:"tenant_id" gorm:"type:varchar(50);not null;uniqueIndex:idx_sync_records_client"`
+	TerminalID      string                 `json:"terminal_id" gorm:"not null"`
+	ClientID        uuid.UUID              `json:"client_id" gorm:"type:uuid;not null;uniqueIndex:idx_sync_records_client"`
+	EntityType      string                 `json:"entity_type" gorm:"not null"` // order, payment, stock_movement
+	ServerID        *uuid.UUID             `json:"server_id" gorm:"type:uuid"`  // Order, payment transaction or stock location it was applied to
+	Status          string                 `json:"status" gorm:"not null"`      // applied, conflict
+	Resolution      map[string]interface{} `json:"resolution" gorm:"type:jsonb"`
+	ClientCreatedAt time.Time              `json:"client_created_at"`
+	CreatedAt       time.Time              `json:"created_at"`
+
+	// Relationships
+	Tenant Tenant `json:"tenant" gorm:"foreignKey:TenantID"`
+}
+
+// CatalogImport is a bulk product catalog import from a CSV or XLSX file. It is
+// validated and diffed against the catalog first (a dry run), then applied on
+// request; rows that fail either step are listed in a downloadable error report
+type CatalogImport struct {
+	ID       uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID string    `json:"tenant_id" gorm:"type:varchar(50);not null;index"`
+	UserID   uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
+	FileID   uuid.UUID `json:"file_id" gorm:"type:uuid;not null"` // Uploaded source file
+	FileName string    `json:"file_name"`
+	Format   string    `json:"format" gorm:"not null"` // csv, xlsx
+	Status   string    `json:"status" gorm:"not null"` // pending, validating, validated, applying, completed, failed
+
+	// Options
+	ColumnMapping map[string]interface{} `json:"column_mapping" gorm:"type:jsonb;default:'{}'"` // File header -> catalog field
+	LocationID    *uuid.UUID             `json:"location_id" gorm:"type:uuid"`                  // Stock location imported quantities are counted at
+
+	// Results
+	TotalRows         int                    `json:"total_rows"`
+	ValidRows         int                    `json:"valid_rows"`
+	ErrorRows         int                    `json:"error_rows"`
+	Summary           map[string]interface{} `json:"summary" gorm:"type:jsonb;default:'{}'"` // Counts of creates, updates and unchanged rows per entity
+	Diff              map[string]interface{} `json:"diff" gorm:"type:jsonb;default:'{}'"`    // Field-level changes from the dry run
+	ErrorReportFileID *uuid.UUID             `json:"error_report_file_id" gorm:"type:uuid"`
+	Error             string                 `json:"error"` // Why the import failed as a whole
+
+	ValidatedAt *time.Time `json:"validated_at"`
+	AppliedAt   *time.Time `json:"applied_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Relationships
+	Tenant Tenant `json:"tenant" gorm:"foreignKey:TenantID"`
+}
+
+// Customer is a tenant's customer, identified at the till by email or phone and
+// optionally linked to a user account. Orders and wishlists point back to it
+type Customer struct {
+	ID               uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID         string                 `json:"tenant_id" gorm:"type:varchar(50);not null;index"`
+	UserID           *uuid.UUID             `json:"user_id" gorm:"type:uuid"`
+	FirstName        string                 `json:"first_name"`
+	LastName         string                 `json:"last_name"`
+	Email            string                 `json:"email" gorm:"index"`
+	Phone            string                 `json:"phone" gorm:"index"`
+	AcceptsMarketing bool                   `json:"accepts_marketing" gorm:"default:false"`
+	Group            string                 `json:"group" gorm:"index"` // Pricing group price lists target, e.g. wholesale
+	Notes            string                 `json:"notes"`
+	Metadata         map[string]interface{} `json:"metadata" gorm:"type:jsonb;default:'{}'"`
+
+	// Loyalty. The balance can go negative when a refund reverses points the
+	// customer has already spent
+	LoyaltyPoints  int `json:"loyalty_points" gorm:"default:0"`
+	LifetimePoints int `json:"lifetime_points" gorm:"default:0"`
+
+	// Purchase history totals, updated when orders are paid
+	OrdersCount int        `json:"orders_count" gorm:"default:0"`
+	TotalSpent  float64    `json:"total_spent" gorm:"default:0"`
+	LastOrderAt *time.Time `json:"last_order_at"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
+
+	// Relationships
+	Tenant    Tenant     `json:"tenant" gorm:"foreignKey:TenantID"`
+	User      *User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Orders    []Order    `json:"orders,omitempty" gorm:"foreignKey:CustomerID"`
+	Wishlists []Wishlist `json:"wishlists,omitempty" gorm:"foreignKey:CustomerID"`
+}
+
+// LoyaltyLedgerEntry is one movement of a customer's loyalty points. The
+// balance is the sum of the ledger; Customer.LoyaltyPoints caches it
+type LoyaltyLedgerEntry struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID   string     `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	CustomerID uuid.UUID  `json:"customer_id" gorm:"type:uuid;not null;index"`
+	OrderID    *uuid.UUID `json:"order_id" gorm:"type:uuid;index"`
+	Type       string     `json:"type" gorm:"not null"` // earn, redeem, earn_reversal, redeem_reversal, adjustment
+	Points     int        `json:"points"`               // Positive credits, negative debits
+	Balance    int        `json:"balance"`              // Balance after this entry
+	Amount     float64    `json:"amount"`               // Spend the points were earned on, or the discount they paid for
+	Reason     string     `json:"reason"`
+	UserID     *uuid.UUID `json:"user_id" gorm:"type:uuid"` // Staff member for manual adjustments
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Relationships
+	Tenant   Tenant   `json:"tenant" gorm:"foreignKey:TenantID"`
+	Customer Customer `json:"customer" gorm:"foreignKey:CustomerID"`
+	Order    *Order   `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+}
+
+// GiftCard is a prepaid balance spent as a payment method. Store credit issued
+// from refunds is a GiftCard of type store_credit, usually tied to a customer
+type GiftCard struct {
+	ID             uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID       string                 `json:"tenant_id" gorm:"type:varchar(50);not null;uniqueIndex:idx_gift_cards_code"`
+	Code           string                 `json:"code" gorm:"not null;uniqueIndex:idx_gift_cards_code"`
+	Type           string                 `json:"type" gorm:"not null;default:'gift_card'"` // gift_card, store_credit
+	Status         string                 `json:"status" gorm:"not null;default:'active'"`  // active, disabled
+	CustomerID     *uuid.UUID             `json:"customer_id" gorm:"type:uuid;index"`
+	InitialBalance float64                `json:"initial_balance"`
+	Balance        float64                `json:"balance"`
+	Currency       string                 `json:"currency" gorm:"default:'USD'"`
+	ExpiresAt      *time.Time             `json:"expires_at"`
+	Note           string                 `json:"note"`
+	Metadata       map[string]interface{} `json:"metadata" gorm:"type:jsonb;default:'{}'"`
+	IssuedBy       *uuid.UUID             `json:"issued_by" gorm:"type:uuid"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at"`
+
+	// Relationships
+	Tenant       Tenant                `json:"tenant" gorm:"foreignKey:TenantID"`
+	Customer     *Customer             `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	Transactions []GiftCardTransaction `json:"transactions,omitempty" gorm:"foreignKey:GiftCardID"`
+}
+
+// GiftCardTransaction is one movement of a gift card balance. Payments taken
+// with a card carry the ID of their redeem entry as their gateway transaction ID
+type GiftCardTransaction struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID   string     `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	GiftCardID uuid.UUID  `json:"gift_card_id" gorm:"type:uuid;not null;index"`
+	OrderID    *uuid.UUID `json:"order_id" gorm:"type:uuid;index"`
+	ParentID   *uuid.UUID `json:"parent_id" gorm:"type:uuid;index"` // Redeem entry a refund gives money back from
+	Type       string     `json:"type" gorm:"not null"`             // issue, redeem, refund, adjustment
+	Amount     float64    `json:"amount"`                           // Positive credits, negative debits
+	Balance    float64    `json:"balance"`                          // Balance after this entry
+	Reason     string     `json:"reason"`
+	UserID     *uuid.UUID `json:"user_id" gorm:"type:uuid"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Relationships
+	Tenant   Tenant   `json:"tenant" gorm:"foreignKey:TenantID"`
+	GiftCard GiftCard `json:"gift_card" gorm:"foreignKey:GiftCardID"`
+	Order    *Order   `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+}
+
 // Wishlist represents customer wishlists
 type Wishlist struct {
-	ID         uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	TenantID   string    `json:"tenant_id" gorm:"type:varchar(50);not null"`
-	UserID     uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
-	Name       string    `json:"name" gorm:"default:'My Wishlist'"`
-	IsPublic   bool      `json:"is_public" gorm:"default:false"`
-	ShareToken string    `json:"share_token"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID   string     `json:"tenant_id" gorm:"type:varchar(50);not null"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;not null"`
+	CustomerID *uuid.UUID `json:"customer_id" gorm:"type:uuid;index"`
+	Name       string     `json:"name" gorm:"default:'My Wishlist'"`
+	IsPublic   bool       `json:"is_public" gorm:"default:false"`
+	ShareToken string     `json:"share_token"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
 
 	// Relationships
-	Tenant Tenant         `json:"tenant" gorm:"foreignKey:TenantID"`
-	User   User           `json:"user" gorm:"foreignKey:UserID"`
-	Items  []WishlistItem `json:"items" gorm:"foreignKey:WishlistID"`
+	Tenant   Tenant         `json:"tenant" gorm:"foreignKey:TenantID"`
+	User     User           `json:"user" gorm:"foreignKey:UserID"`
+	Customer *Customer      `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	Items    []WishlistItem `json:"items" gorm:"foreignKey:WishlistID"`
 }
 
 // WishlistItem represents individual items in wishlists
@@ -1568,15 +2207,18 @@ const (
 	CartStatusConverted = "converted"
 
 	// Order status
-	OrderStatusPending    = "pending"
-	OrderStatusProcessing = "processing"
-	OrderStatusShipped    = "shipped"
-	OrderStatusDelivered  = "delivered"
-	OrderStatusCancelled  = "cancelled"
-	OrderStatusRefunded   = "refunded"
+	OrderStatusPending           = "pending"
+	OrderStatusProcessing        = "processing"
+	OrderStatusShipped           = "shipped"
+	OrderStatusDelivered         = "delivered"
+	OrderStatusCancelled         = "cancelled"
+	OrderStatusRefunded          = "refunded"
+	OrderStatusPartiallyRefunded = "partially_refunded"
 
 	// Payment status
 	PaymentStatusPending           = "pending"
+	PaymentStatusAuthorized        = "authorized"
+	PaymentStatusPartiallyPaid     = "partially_paid"
 	PaymentStatusPaid              = "paid"
 	PaymentStatusFailed            = "failed"
 	PaymentStatusRefunded          = "refunded"
@@ -1586,26 +2228,117 @@ const (
 	TransactionTypePayment       = "payment"
 	TransactionTypeRefund        = "refund"
 	TransactionTypePartialRefund = "partial_refund"
+	TransactionTypeAuthorization = "authorization"
+	TransactionTypeCapture       = "capture"
+	TransactionTypeVoid          = "void"
 
 	// Transaction status
-	TransactionStatusPending   = "pending"
-	TransactionStatusCompleted = "completed"
-	TransactionStatusFailed    = "failed"
-	TransactionStatusCancelled = "cancelled"
-	TransactionStatusRefunded  = "refunded"
+	TransactionStatusPending    = "pending"
+	TransactionStatusAuthorized = "authorized"
+	TransactionStatusCompleted  = "completed"
+	TransactionStatusFailed     = "failed"
+	TransactionStatusCancelled  = "cancelled"
+	TransactionStatusRefunded   = "refunded"
 
 	// Inventory log types
-	InventoryTypeIn         = "in"
-	InventoryTypeOut        = "out"
-	InventoryTypeAdjustment = "adjustment"
-	InventoryTypeSale       = "sale"
-	InventoryTypeReturn     = "return"
+	InventoryTypeIn          = "in"
+	InventoryTypeOut         = "out"
+	InventoryTypeAdjustment  = "adjustment"
+	InventoryTypeSale        = "sale"
+	InventoryTypeReturn      = "return"
+	InventoryTypeTransferOut = "transfer_out"
+	InventoryTypeTransferIn  = "transfer_in"
+
+	// Stock location types
+	StockLocationTypeStore     = "store"
+	StockLocationTypeWarehouse = "warehouse"
+
+	// Purchase order status
+	PurchaseOrderStatusDraft             = "draft"
+	PurchaseOrderStatusOrdered           = "ordered"
+	PurchaseOrderStatusPartiallyReceived = "partially_received"
+	PurchaseOrderStatusReceived          = "received"
+	PurchaseOrderStatusCancelled         = "cancelled"
+
+	// Register session status
+	RegisterSessionStatusOpen   = "open"
+	RegisterSessionStatusClosed = "closed"
+
+	// Cash movement types
+	CashMovementTypeIn  = "cash_in"
+	CashMovementTypeOut = "cash_out"
+
+	// Offline sync entity types
+	SyncEntityOrder         = "order"
+	SyncEntityPayment       = "payment"
+	SyncEntityStockMovement = "stock_movement"
+
+	// Offline sync item status
+	SyncStatusApplied   = "applied"   // Applied as sent
+	SyncStatusConflict  = "conflict"  // Applied after resolving a conflict
+	SyncStatusDuplicate = "duplicate" // Already applied by an earlier sync
+	SyncStatusRejected  = "rejected"  // Not applied; the terminal must resolve it
+
+	// Barcode symbologies
+	BarcodeSymbologyEAN13   = "ean13"
+	BarcodeSymbologyUPCA    = "upca"
+	BarcodeSymbologyCode128 = "code128"
+
+	// Loyalty ledger entry types
+	LoyaltyEntryEarn           = "earn"
+	LoyaltyEntryRedeem         = "redeem"
+	LoyaltyEntryEarnReversal   = "earn_reversal"
+	LoyaltyEntryRedeemReversal = "redeem_reversal"
+	LoyaltyEntryAdjustment     = "adjustment"
+
+	// Catalog import status and file formats
+	CatalogImportStatusPending    = "pending"
+	CatalogImportStatusValidating = "validating"
+	CatalogImportStatusValidated  = "validated"
+	CatalogImportStatusApplying   = "applying"
+	CatalogImportStatusCompleted  = "completed"
+	CatalogImportStatusFailed     = "failed"
+	CatalogFormatCSV              = "csv"
+	CatalogFormatXLSX             = "xlsx"
+
+	// Gift card types, status and transaction types
+	GiftCardTypeGiftCard    = "gift_card"
+	GiftCardTypeStoreCredit = "store_credit"
+	GiftCardStatusActive    = "active"
+	GiftCardStatusDisabled  = "disabled"
+	GiftCardEntryIssue      = "issue"
+	GiftCardEntryRedeem     = "redeem"
+	GiftCardEntryRefund     = "refund"
+	GiftCardEntryAdjustment = "adjustment"
+
+	// Payment methods with special handling
+	PaymentMethodCash        = "cash"
+	PaymentMethodGiftCard    = "gift_card"
+	PaymentMethodStoreCredit = "store_credit"
+	PaymentMethodSplit       = "split"
+
+	// Stock transfer status
+	StockTransferStatusDraft     = "draft"
+	StockTransferStatusInTransit = "in_transit"
+	StockTransferStatusReceived  = "received"
+	StockTransferStatusCancelled = "cancelled"
+
+	// Tax classes and address bases
+	TaxClassStandard   = "standard"
+	TaxClassZero       = "zero"
+	TaxBasedOnShipping = "shipping"
+	TaxBasedOnBilling  = "billing"
 
 	// Discount types
 	DiscountTypePercentage   = "percentage"
 	DiscountTypeFixedAmount  = "fixed_amount"
 	DiscountTypeFreeShipping = "free_shipping"
 
+	// Price list rule types
+	PriceRuleTypeFixed         = "fixed"
+	PriceRuleTypePercentageOff = "percentage_off"
+	PriceRuleTypeAmountOff     = "amount_off"
+
 	// Report types
 	ReportTypeDaily   = "daily"
 	ReportTypeWeekly  = "weekly"
@@ -1651,6 +2384,7 @@ type ProductFilter struct {
 type InventoryLogFilter struct {
 	ProductID     *uuid.UUID `json:"product_id,omitempty"`
 	VariationID   *uuid.UUID `json:"variation_id,omitempty"`
+	LocationID    *uuid.UUID `json:"location_id,omitempty"`
 	Type          *string    `json:"type,omitempty"`
 	ReferenceID   *uuid.UUID `json:"reference_id,omitempty"`
 	ReferenceType *string    `json:"reference_type,omitempty"`
@@ -1663,6 +2397,58 @@ type InventoryLogFilter struct {
 	SortOrder     string     `json:"sort_order" validate:"oneof=asc desc"`
 }
 
+// StockTransferFilter for filtering stock transfers
+type StockTransferFilter struct {
+	LocationID *uuid.UUID `json:"location_id,omitempty"` // Transfers from or to this location
+	Status     *string    `json:"status,omitempty"`
+	StartDate  *time.Time `json:"start_date,omitempty"`
+	EndDate    *time.Time `json:"end_date,omitempty"`
+	Page       int        `json:"page" validate:"min=1"`
+	Limit      int        `json:"limit" validate:"min=1,max=100"`
+}
+
+// PurchaseOrderFilter for filtering purchase orders
+type PurchaseOrderFilter struct {
+	SupplierID *uuid.UUID `json:"supplier_id,omitempty"`
+	LocationID *uuid.UUID `json:"location_id,omitempty"`
+	Status     *string    `json:"status,omitempty"`
+	StartDate  *time.Time `json:"start_date,omitempty"`
+	EndDate    *time.Time `json:"end_date,omitempty"`
+	Page       int        `json:"page" validate:"min=1"`
+	Limit      int        `json:"limit" validate:"min=1,max=100"`
+}
+
+// RegisterSessionFilter for filtering register sessions
+type RegisterSessionFilter struct {
+	LocationID   *uuid.UUID `json:"location_id,omitempty"`
+	RegisterName *string    `json:"register_name,omitempty"`
+	Status       *string    `json:"status,omitempty"`
+	OpenedBy     *uuid.UUID `json:"opened_by,omitempty"`
+	StartDate    *time.Time `json:"start_date,omitempty"`
+	EndDate      *time.Time `json:"end_date,omitempty"`
+	Page         int        `json:"page" validate:"min=1"`
+	Limit        int        `json:"limit" validate:"min=1,max=100"`
+}
+
+// CustomerFilter for filtering customers
+type CustomerFilter struct {
+	Search    string `json:"search,omitempty"` // Matches name, email or phone
+	Page      int    `json:"page" validate:"min=1"`
+	Limit     int    `json:"limit" validate:"min=1,max=100"`
+	SortBy    string `json:"sort_by"`
+	SortOrder string `json:"sort_order" validate:"oneof=asc desc"`
+}
+
+// GiftCardFilter for filtering gift cards
+type GiftCardFilter struct {
+	Type       string     `json:"type,omitempty"`
+	Status     string     `json:"status,omitempty"`
+	CustomerID *uuid.UUID `json:"customer_id,omitempty"`
+	Search     string     `json:"search,omitempty"` // Matches the code
+	Page       int        `json:"page" validate:"min=1"`
+	Limit      int        `json:"limit" validate:"min=1,max=100"`
+}
+
 // CartFilter for filtering carts
 type CartFilter struct {
 	UserID    *uuid.UUID `json:"user_id,omitempty"`
@@ -1686,6 +2472,7 @@ type OrderFilter struct {
 	EndDate       *time.Time `json:"end_date,omitempty"`
 	MinTotal      *float64   `json:"min_total,omitempty"`
 	MaxTotal      *float64   `json:"max_total,omitempty"`
+	CustomerID    *uuid.UUID `json:"customer_id,omitempty"`
 	CustomerEmail *string    `json:"customer_email,omitempty"`
 	CustomerPhone *string    `json:"customer_phone,omitempty"`
 	Page          int        `json:"page" validate:"min=1"`
@@ -1763,6 +2550,14 @@ type DiscountFilter struct {
 	SortOrder    string     `json:"sort_order" validate:"oneof=asc desc"`
 }
 
+// PriceListFilter for filtering price lists
+type PriceListFilter struct {
+	Name     string `json:"name,omitempty"`
+	IsActive *bool  `json:"is_active,omitempty"`
+	Page     int    `json:"page" validate:"min=1"`
+	Limit    int    `json:"limit" validate:"min=1,max=100"`
+}
+
 // WishlistFilter for filtering wishlists
 type WishlistFilter struct {
 	UserID    *uuid.UUID `json:"user_id,omitempty"`
@@ -1857,6 +2652,7 @@ type DiscountValidation struct {
 
 // CustomerInfo represents customer information for order creation
 type CustomerInfo struct {
+	CustomerID      *uuid.UUID             `json:"customer_id,omitempty"`
 	Email           string                 `json:"email"`
 	Phone           string                 `json:"phone"`
 	BillingAddress  map[string]interface{} `json:"billing_address"`
@@ -1870,7 +2666,38 @@ type PaymentData struct {
 	Gateway         string                 `json:"gateway"`
 	Method          string                 `json:"method"`
 	MethodTitle     string                 `json:"method_title"`
+	Token           string                 `json:"token"` // Tokenized payment source passed to the gateway, or a gift card code
 	GatewayResponse map[string]interface{} `json:"gateway_response"`
+
+	// Amount taken with this tender when an order is split across several
+	// payments. Zero takes the balance due
+	Amount float64 `json:"amount,omitempty"`
+
+	RegisterSessionID *uuid.UUID `json:"register_session_id,omitempty"` // Open register shift taking the payment
+}
+
+// RefundRequest describes what to refund on an order. Line items, shipping and
+// Amount are added together; Amount alone gives an amount-only refund.
+type RefundRequest struct {
+	Items          []RefundLineItem `json:"items"`
+	RefundShipping bool             `json:"refund_shipping"`
+	Amount         float64          `json:"amount"`
+	Reason         string           `json:"reason"`
+
+	// TransactionID picks the payment to refund on a split-tender order;
+	// by default the first payment that covers the amount is used
+	TransactionID *uuid.UUID `json:"transaction_id,omitempty"`
+	// ToStoreCredit issues store credit instead of returning the money
+	ToStoreCredit bool `json:"to_store_credit"`
+
+	RegisterSessionID *uuid.UUID `json:"register_session_id,omitempty"` // Open register shift paying out the refund
+}
+
+// RefundLineItem selects a quantity of an order item to refund
+type RefundLineItem struct {
+	OrderItemID uuid.UUID `json:"order_item_id"`
+	Quantity    int       `json:"quantity"`
+	Restock     bool      `json:"restock"` // Return the refunded units to inventory
 }
 
 // ============================
@@ -2087,3 +2914,63 @@ type SystemMetricsFilter struct {
 	GroupBy     string     `json:"group_by"`    // date, hour, metric_type
 	Aggregation string     `json:"aggregation"` // sum, avg, count, max, min
 }
+
+// ============================
+// Mail Models
+// ============================
+
+// MailTemplate is a tenant's override of a built-in transactional email
+type MailTemplate struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID  string    `json:"tenant_id" gorm:"type:varchar(50);not null;index"`
+	Name      string    `json:"name" gorm:"not null"` // receipt, invitation, password_reset
+	Locale    string    `json:"locale" gorm:"default:'en'"`
+	Subject   string    `json:"subject" gorm:"not null"`
+	HTMLBody  string    `json:"html_body"`
+	TextBody  string    `json:"text_body"`
+	IsActive  bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MailDelivery logs one email and doubles as its retry queue entry
+type MailDelivery struct {
+	ID            uuid.UUID        `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID      string           `json:"tenant_id" gorm:"type:varchar(50);not null;index"`
+	Template      string           `json:"template"`
+	FromAddress   string           `json:"from_address" gorm:"not null"`
+	FromName      string           `json:"from_name"`
+	Recipients    []string         `json:"recipients" gorm:"type:text[]"`
+	Subject       string           `json:"subject"`
+	HTMLBody      string           `json:"html_body"`
+	TextBody      string           `json:"text_body"`
+	Attachments   []MailAttachment `json:"attachments" gorm:"type:jsonb"`
+	Status        string           `json:"status" gorm:"default:'queued';index"` // queued, sent, retrying, failed
+	Attempts      int              `json:"attempts" gorm:"default:0"`
+	LastError     string           `json:"last_error"`
+	NextAttemptAt *time.Time       `json:"next_attempt_at" gorm:"index"`
+	SentAt        *time.Time       `json:"sent_at"`
+	ReferenceType string           `json:"reference_type"` // e.g. receipt, invitation
+	ReferenceID   *uuid.UUID       `json:"reference_id" gorm:"type:uuid"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+}
+
+// MailAttachment is a file attached to an email
+type MailAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// Mail constants
+const (
+	MailTemplateReceipt       = "receipt"
+	MailTemplateInvitation    = "invitation"
+	MailTemplatePasswordReset = "password_reset"
+
+	MailStatusQueued   = "queued"
+	MailStatusSent     = "sent"
+	MailStatusRetrying = "retrying"
+	MailStatusFailed   = "failed"
+)
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -64,6 +65,35 @@ type TenantOnboardingRepository interface {
 	CompleteStep(ctx context.Context, tenantID uuid.UUID, step int, data map[string]interface{}) error
 }
 
+// TenantDeletionRepository defines operations for tenant deletions
+type TenantDeletionRepository interface {
+	// Create returns ErrTenantDeletionOpen when the tenant already has a
+	// deletion that is scheduled or being purged
+	Create(ctx context.Context, deletion *TenantDeletion) error
+	GetByID(ctx context.Context, id uuid.UUID) (*TenantDeletion, error)
+	Update(ctx context.Context, deletion *TenantDeletion) error
+	// UpdateIfStatus saves the deletion only while its stored status is still
+	// status, and reports whether it did
+	UpdateIfStatus(ctx context.Context, deletion *TenantDeletion, status string) (bool, error)
+	ListByTenant(ctx context.Context, tenantID uuid.UUID) ([]*TenantDeletion, error)
+	GetOpenByTenant(ctx context.Context, tenantID uuid.UUID) (*TenantDeletion, error)
+	ListDue(ctx context.Context, at time.Time, limit int) ([]*TenantDeletion, error)
+}
+
+// ErrTenantDeletionOpen is returned when a tenant already has a deletion that
+// is scheduled or being purged
+var ErrTenantDeletionOpen = errors.New("tenant already has an open deletion")
+
+// TenantIsolationMigrationRepository defines operations for moves between isolation modes
+type TenantIsolationMigrationRepository interface {
+	Create(ctx context.Context, migration *TenantIsolationMigration) error
+	GetByID(ctx context.Context, id uuid.UUID) (*TenantIsolationMigration, error)
+	Update(ctx context.Context, migration *TenantIsolationMigration) error
+	ListByTenant(ctx context.Context, tenantID uuid.UUID) ([]*TenantIsolationMigration, error)
+	GetOpenByTenant(ctx context.Context, tenantID uuid.UUID) (*TenantIsolationMigration, error)
+	ListOpen(ctx context.Context) ([]*TenantIsolationMigration, error)
+}
+
 // TenantInvitationRepository defines operations for tenant invitations
 type TenantInvitationRepository interface {
 	Create(ctx context.Context, invitation *TenantInvitation) error
@@ -773,6 +803,29 @@ type ReportScheduleRepository interface {
 	GetScheduleStats(ctx context.Context, tenantID string) (map[string]interface{}, error)
 }
 
+// MailTemplateRepository defines the interface for tenant email template operations
+type MailTemplateRepository interface {
+	Create(ctx context.Context, template *MailTemplate) error
+	Update(ctx context.Context, template *MailTemplate) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByName(ctx context.Context, tenantID, name, locale string) (*MailTemplate, error)
+	ListByTenant(ctx context.Context, tenantID string) ([]*MailTemplate, error)
+}
+
+// MailDeliveryRepository defines the interface for the email delivery log and retry queue
+type MailDeliveryRepository interface {
+	Create(ctx context.Context, delivery *MailDelivery) error
+	Update(ctx context.Context, delivery *MailDelivery) error
+	GetByID(ctx context.Context, id uuid.UUID) (*MailDelivery, error)
+	ListByTenant(ctx context.Context, tenantID string, limit, offset int) ([]*MailDelivery, error)
+	ListByReference(ctx context.Context, referenceType string, referenceID uuid.UUID) ([]*MailDelivery, error)
+	// ClaimDue returns deliveries waiting to be sent whose next attempt is at or
+	// before now, moving their next attempt to leaseUntil in the same statement.
+	// Rows locked by another worker are skipped (FOR UPDATE SKIP LOCKED), so each
+	// delivery is claimed by one worker until the lease runs out.
+	ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*MailDelivery, error)
+}
+
 // OrderRepository interface for order operations (POS module)
 type OrderRepository interface {
 	Create(ctx context.Context, order *Order) error
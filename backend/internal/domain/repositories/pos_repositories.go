@@ -2,12 +2,22 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
 )
 
+// ErrDuplicateKey is returned by Create when the row would break a unique constraint
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// TransactionManager runs a unit of work in a single database transaction.
+// Repositories called with the context passed to fn join that transaction.
+type TransactionManager interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 // ProductCategoryRepository interface for product category operations
 type ProductCategoryRepository interface {
 	Create(ctx context.Context, category *domain.ProductCategory) error
@@ -20,6 +30,9 @@ type ProductCategoryRepository interface {
 	GetTreeByTenantID(ctx context.Context, tenantID string) ([]*domain.ProductCategory, error)
 	Exists(ctx context.Context, tenantID string, name string, excludeID *uuid.UUID) (bool, error)
 	UpdateSortOrder(ctx context.Context, categoryID uuid.UUID, sortOrder int) error
+	// GetChangedSince returns categories, soft-deleted ones included, that come
+	// after the position and were updated no later than until, in (updated_at, id) order
+	GetChangedSince(ctx context.Context, tenantID string, after domain.ChangePosition, until time.Time, limit int) ([]*domain.ProductCategory, error)
 }
 
 // ProductRepository interface for product operations
@@ -33,12 +46,20 @@ type ProductRepository interface {
 	GetBySlug(ctx context.Context, tenantID string, slug string) (*domain.Product, error)
 	GetByCategoryID(ctx context.Context, categoryID uuid.UUID, filter *domain.ProductFilter) ([]*domain.Product, int64, error)
 	GetFeatured(ctx context.Context, tenantID string, limit int) ([]*domain.Product, error)
-	GetLowStock(ctx context.Context, tenantID string) ([]*domain.Product, error)
-	GetOutOfStock(ctx context.Context, tenantID string) ([]*domain.Product, error)
+	// GetLowStock and GetOutOfStock compare stock at locationID, or the product
+	// total across locations when locationID is nil
+	GetLowStock(ctx context.Context, tenantID string, locationID *uuid.UUID) ([]*domain.Product, error)
+	GetOutOfStock(ctx context.Context, tenantID string, locationID *uuid.UUID) ([]*domain.Product, error)
+	// GetByIDForUpdate loads a product and locks its row until the surrounding transaction ends
+	GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*domain.Product, error)
 	UpdateStock(ctx context.Context, productID uuid.UUID, quantity int) error
+	UpdateCostPrice(ctx context.Context, productID uuid.UUID, costPrice float64) error
 	BulkUpdateStock(ctx context.Context, updates []domain.StockUpdate) error
 	Search(ctx context.Context, tenantID string, query string, filter *domain.ProductFilter) ([]*domain.Product, int64, error)
 	Exists(ctx context.Context, tenantID string, sku string, excludeID *uuid.UUID) (bool, error)
+	// GetChangedSince returns products, soft-deleted ones included, that come
+	// after the position and were updated no later than until, in (updated_at, id) order
+	GetChangedSince(ctx context.Context, tenantID string, after domain.ChangePosition, until time.Time, limit int) ([]*domain.Product, error)
 }
 
 // ProductVariationRepository interface for product variation operations
@@ -47,12 +68,18 @@ type ProductVariationRepository interface {
 	Update(ctx context.Context, variation *domain.ProductVariation) error
 	Delete(ctx context.Context, id uuid.UUID) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.ProductVariation, error)
+	// GetByIDForUpdate loads a variation and locks its row until the surrounding transaction ends
+	GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*domain.ProductVariation, error)
 	GetByProductID(ctx context.Context, productID uuid.UUID) ([]*domain.ProductVariation, error)
 	GetBySKU(ctx context.Context, tenantID string, sku string) (*domain.ProductVariation, error)
 	UpdateStock(ctx context.Context, variationID uuid.UUID, quantity int) error
+	UpdateCostPrice(ctx context.Context, variationID uuid.UUID, costPrice float64) error
 	BulkCreate(ctx context.Context, variations []*domain.ProductVariation) error
 	BulkUpdate(ctx context.Context, variations []*domain.ProductVariation) error
 	BulkDelete(ctx context.Context, variationIDs []uuid.UUID) error
+	// GetChangedSince returns the tenant's variations that come after the position
+	// and were updated no later than until, in (updated_at, id) order
+	GetChangedSince(ctx context.Context, tenantID string, after domain.ChangePosition, until time.Time, limit int) ([]*domain.ProductVariation, error)
 }
 
 // InventoryLogRepository interface for inventory log operations
@@ -77,6 +104,9 @@ type CartRepository interface {
 	GetActiveByTenantID(ctx context.Context, tenantID string, filter *domain.CartFilter) ([]*domain.Cart, int64, error)
 	GetAbandonedCarts(ctx context.Context, tenantID string, before time.Time) ([]*domain.Cart, error)
 	UpdateStatus(ctx context.Context, cartID uuid.UUID, status string) error
+	// TransitionStatus moves a cart from one status to another in a single
+	// conditional update and reports whether the cart was still in the from status
+	TransitionStatus(ctx context.Context, cartID uuid.UUID, from, to string) (bool, error)
 	UpdateTotals(ctx context.Context, cartID uuid.UUID, totals domain.CartTotals) error
 	CleanupExpiredCarts(ctx context.Context, tenantID string, before time.Time) (int64, error)
 }
@@ -101,6 +131,8 @@ type OrderRepository interface {
 	Update(ctx context.Context, order *domain.Order) error
 	Delete(ctx context.Context, id uuid.UUID) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Order, error)
+	// GetByIDForUpdate loads an order and locks its row until the surrounding transaction ends
+	GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*domain.Order, error)
 	GetByOrderNumber(ctx context.Context, tenantID string, orderNumber string) (*domain.Order, error)
 	GetByTenantID(ctx context.Context, tenantID string, filter *domain.OrderFilter) ([]*domain.Order, int64, error)
 	GetByUserID(ctx context.Context, userID uuid.UUID, filter *domain.OrderFilter) ([]*domain.Order, int64, error)
@@ -134,6 +166,8 @@ type PaymentTransactionRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.PaymentTransaction, error)
 	GetByTransactionID(ctx context.Context, transactionID string) (*domain.PaymentTransaction, error)
 	GetByOrderID(ctx context.Context, orderID uuid.UUID) ([]*domain.PaymentTransaction, error)
+	// GetByOrderIDForUpdate loads an order's transactions and locks their rows until the surrounding transaction ends
+	GetByOrderIDForUpdate(ctx context.Context, orderID uuid.UUID) ([]*domain.PaymentTransaction, error)
 	GetByTenantID(ctx context.Context, tenantID string, filter *domain.PaymentTransactionFilter) ([]*domain.PaymentTransaction, int64, error)
 	GetByStatus(ctx context.Context, tenantID string, status string) ([]*domain.PaymentTransaction, error)
 	GetByGateway(ctx context.Context, tenantID string, gateway string, filter *domain.PaymentTransactionFilter) ([]*domain.PaymentTransaction, int64, error)
@@ -141,6 +175,7 @@ type PaymentTransactionRepository interface {
 	UpdateStatus(ctx context.Context, transactionID uuid.UUID, status string) error
 	GetTotalByDateRange(ctx context.Context, tenantID string, startDate, endDate time.Time) (float64, error)
 	GetRefundableTransactions(ctx context.Context, orderID uuid.UUID) ([]*domain.PaymentTransaction, error)
+	GetByRegisterSessionID(ctx context.Context, sessionID uuid.UUID) ([]*domain.PaymentTransaction, error)
 }
 
 // ReceiptRepository interface for receipt operations
@@ -153,6 +188,9 @@ type ReceiptRepository interface {
 	GetByTenantID(ctx context.Context, tenantID string, filter *domain.ReceiptFilter) ([]*domain.Receipt, int64, error)
 	UpdateEmailStatus(ctx context.Context, receiptID uuid.UUID, sent bool, sentAt *time.Time, recipient string) error
 	UpdatePrintStatus(ctx context.Context, receiptID uuid.UUID, printed bool, printCount int, lastPrintedAt *time.Time) error
+	// IncrementPrintCount marks a receipt printed with print_count = print_count + 1
+	// and returns the new count
+	IncrementPrintCount(ctx context.Context, receiptID uuid.UUID, printedAt time.Time) (int, error)
 	GetUnsentReceipts(ctx context.Context, tenantID string) ([]*domain.Receipt, error)
 	GenerateReceiptNumber(ctx context.Context, tenantID string) (string, error)
 }
@@ -175,16 +213,218 @@ type DiscountRepository interface {
 	Update(ctx context.Context, discount *domain.Discount) error
 	Delete(ctx context.Context, id uuid.UUID) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Discount, error)
+	// GetByIDForUpdate loads a discount and locks its row until the surrounding transaction ends
+	GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*domain.Discount, error)
 	GetByCode(ctx context.Context, tenantID string, code string) (*domain.Discount, error)
 	GetByTenantID(ctx context.Context, tenantID string, filter *domain.DiscountFilter) ([]*domain.Discount, int64, error)
 	GetActiveDiscounts(ctx context.Context, tenantID string) ([]*domain.Discount, error)
 	GetApplicableDiscounts(ctx context.Context, tenantID string, productIDs []uuid.UUID, categoryIDs []uuid.UUID, amount float64) ([]*domain.Discount, error)
 	UpdateUsageCount(ctx context.Context, discountID uuid.UUID, increment int) error
 	ValidateDiscount(ctx context.Context, tenantID string, code string, productIDs []uuid.UUID, amount float64, userID *uuid.UUID) (*domain.DiscountValidation, error)
-	GetUsageByCustomer(ctx context.Context, discountID, userID uuid.UUID) (int, error)
+	GetUsageByCustomer(ctx context.Context, discountID, customerID uuid.UUID) (int, error)
+	RecordUsage(ctx context.Context, usage *domain.DiscountUsage) error
 	Exists(ctx context.Context, tenantID string, code string, excludeID *uuid.UUID) (bool, error)
 }
 
+// TaxZoneRepository interface for tax zone operations
+type TaxZoneRepository interface {
+	Create(ctx context.Context, zone *domain.TaxZone) error
+	Update(ctx context.Context, zone *domain.TaxZone) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.TaxZone, error)
+	GetActiveByTenantID(ctx context.Context, tenantID string) ([]*domain.TaxZone, error)
+}
+
+// TaxRateRepository interface for tax rate operations
+type TaxRateRepository interface {
+	Create(ctx context.Context, rate *domain.TaxRate) error
+	Update(ctx context.Context, rate *domain.TaxRate) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.TaxRate, error)
+	GetByZoneID(ctx context.Context, zoneID uuid.UUID) ([]*domain.TaxRate, error)
+}
+
+// StockLocationRepository interface for stock location operations
+type StockLocationRepository interface {
+	Create(ctx context.Context, location *domain.StockLocation) error
+	Update(ctx context.Context, location *domain.StockLocation) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.StockLocation, error)
+	GetByCode(ctx context.Context, tenantID string, code string) (*domain.StockLocation, error)
+	GetByTenantID(ctx context.Context, tenantID string) ([]*domain.StockLocation, error)
+	GetDefault(ctx context.Context, tenantID string) (*domain.StockLocation, error)
+}
+
+// StockLevelRepository interface for per-location stock operations
+type StockLevelRepository interface {
+	Get(ctx context.Context, locationID, productID uuid.UUID, variationID *uuid.UUID) (*domain.StockLevel, error)
+	// GetForUpdate loads a stock level, creating an empty one if the item has never
+	// been stocked at the location, and locks its row until the surrounding transaction ends
+	GetForUpdate(ctx context.Context, tenantID string, locationID, productID uuid.UUID, variationID *uuid.UUID) (*domain.StockLevel, error)
+	GetByLocation(ctx context.Context, locationID uuid.UUID) ([]*domain.StockLevel, error)
+	GetByProduct(ctx context.Context, productID uuid.UUID) ([]*domain.StockLevel, error)
+	GetLowStock(ctx context.Context, tenantID string, locationID *uuid.UUID) ([]*domain.StockLevel, error)
+	GetOutOfStock(ctx context.Context, tenantID string, locationID *uuid.UUID) ([]*domain.StockLevel, error)
+	UpdateQuantity(ctx context.Context, id uuid.UUID, quantity int) error
+}
+
+// StockTransferRepository interface for stock transfer operations
+type StockTransferRepository interface {
+	Create(ctx context.Context, transfer *domain.StockTransfer) error
+	Update(ctx context.Context, transfer *domain.StockTransfer) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.StockTransfer, error)
+	// GetByIDForUpdate loads a transfer with its items and locks its row until the surrounding transaction ends
+	GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*domain.StockTransfer, error)
+	GetByTenantID(ctx context.Context, tenantID string, filter *domain.StockTransferFilter) ([]*domain.StockTransfer, int64, error)
+	GenerateTransferNumber(ctx context.Context, tenantID string) (string, error)
+}
+
+// SupplierRepository interface for supplier operations
+type SupplierRepository interface {
+	Create(ctx context.Context, supplier *domain.Supplier) error
+	Update(ctx context.Context, supplier *domain.Supplier) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Supplier, error)
+	GetByCode(ctx context.Context, tenantID string, code string) (*domain.Supplier, error)
+	GetByTenantID(ctx context.Context, tenantID string) ([]*domain.Supplier, error)
+}
+
+// PurchaseOrderRepository interface for purchase order operations
+type PurchaseOrderRepository interface {
+	Create(ctx context.Context, order *domain.PurchaseOrder) error
+	Update(ctx context.Context, order *domain.PurchaseOrder) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.PurchaseOrder, error)
+	// GetByIDForUpdate loads a purchase order with its items and locks its row until the surrounding transaction ends
+	GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*domain.PurchaseOrder, error)
+	GetByTenantID(ctx context.Context, tenantID string, filter *domain.PurchaseOrderFilter) ([]*domain.PurchaseOrder, int64, error)
+	UpdateItem(ctx context.Context, item *domain.PurchaseOrderItem) error
+	GenerateOrderNumber(ctx context.Context, tenantID string) (string, error)
+	// GetOutstandingQuantity returns units ordered but not yet received on open purchase orders
+	GetOutstandingQuantity(ctx context.Context, tenantID string, productID uuid.UUID, variationID *uuid.UUID) (int, error)
+	// GetLastItemForProduct returns the most recent purchase order line for an item, with its order loaded
+	GetLastItemForProduct(ctx context.Context, tenantID string, productID uuid.UUID, variationID *uuid.UUID) (*domain.PurchaseOrderItem, error)
+}
+
+// RegisterSessionRepository interface for register session operations
+type RegisterSessionRepository interface {
+	// Create returns ErrDuplicateKey when the register already has an open session
+	Create(ctx context.Context, session *domain.RegisterSession) error
+	Update(ctx context.Context, session *domain.RegisterSession) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.RegisterSession, error)
+	// GetByIDForUpdate loads a session and locks its row until the surrounding transaction ends
+	GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*domain.RegisterSession, error)
+	// GetByIDForShare loads a session with a shared lock, which blocks GetByIDForUpdate but not other shared locks
+	GetByIDForShare(ctx context.Context, id uuid.UUID) (*domain.RegisterSession, error)
+	// GetOpenByRegister returns the open session on a register, or nil when the register is closed
+	GetOpenByRegister(ctx context.Context, tenantID string, locationID *uuid.UUID, registerName string) (*domain.RegisterSession, error)
+	GetByTenantID(ctx context.Context, tenantID string, filter *domain.RegisterSessionFilter) ([]*domain.RegisterSession, int64, error)
+}
+
+// CashMovementRepository interface for register cash movement operations
+type CashMovementRepository interface {
+	Create(ctx context.Context, movement *domain.CashMovement) error
+	GetBySessionID(ctx context.Context, sessionID uuid.UUID) ([]*domain.CashMovement, error)
+}
+
+// ProductBarcodeRepository interface for product and variation barcodes
+type ProductBarcodeRepository interface {
+	Create(ctx context.Context, barcode *domain.ProductBarcode) error
+	Update(ctx context.Context, barcode *domain.ProductBarcode) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.ProductBarcode, error)
+	// GetByCode returns the tenant's barcode with exactly this code, or nil when there is none
+	GetByCode(ctx context.Context, tenantID string, code string) (*domain.ProductBarcode, error)
+	GetByProductID(ctx context.Context, productID uuid.UUID) ([]*domain.ProductBarcode, error)
+}
+
+// CustomerRepository interface for tenant customers
+type CustomerRepository interface {
+	Create(ctx context.Context, customer *domain.Customer) error
+	Update(ctx context.Context, customer *domain.Customer) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Customer, error)
+	// GetByIDForUpdate loads a customer and locks its row until the surrounding transaction ends
+	GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*domain.Customer, error)
+	// GetByEmail and GetByPhone return nil when the tenant has no such customer
+	GetByEmail(ctx context.Context, tenantID string, email string) (*domain.Customer, error)
+	GetByPhone(ctx context.Context, tenantID string, phone string) (*domain.Customer, error)
+	GetByTenantID(ctx context.Context, tenantID string, filter *domain.CustomerFilter) ([]*domain.Customer, int64, error)
+}
+
+// LoyaltyLedgerRepository interface for loyalty point movements
+type LoyaltyLedgerRepository interface {
+	Create(ctx context.Context, entry *domain.LoyaltyLedgerEntry) error
+	// GetByCustomerID returns a customer's entries, newest first
+	GetByCustomerID(ctx context.Context, customerID uuid.UUID, limit, offset int) ([]*domain.LoyaltyLedgerEntry, int64, error)
+	GetByOrderID(ctx context.Context, orderID uuid.UUID) ([]*domain.LoyaltyLedgerEntry, error)
+}
+
+// CatalogImportRepository interface for bulk catalog imports
+type CatalogImportRepository interface {
+	Create(ctx context.Context, catalogImport *domain.CatalogImport) error
+	Update(ctx context.Context, catalogImport *domain.CatalogImport) error
+	// UpdateIfStatus saves the import only while its stored status is still
+	// status, reporting whether it did
+	UpdateIfStatus(ctx context.Context, catalogImport *domain.CatalogImport, status string) (bool, error)
+	// GetStale returns imports of any tenant in one of the statuses that have
+	// not been updated since before, oldest first
+	GetStale(ctx context.Context, statuses []string, before time.Time, limit int) ([]*domain.CatalogImport, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.CatalogImport, error)
+	// GetByTenantID returns the tenant's imports, newest first
+	GetByTenantID(ctx context.Context, tenantID string, limit, offset int) ([]*domain.CatalogImport, int64, error)
+}
+
+// PriceListRepository interface for price list operations
+type PriceListRepository interface {
+	Create(ctx context.Context, priceList *domain.PriceList) error
+	Update(ctx context.Context, priceList *domain.PriceList) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	// GetByID loads a price list with its rules
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.PriceList, error)
+	GetByTenantID(ctx context.Context, tenantID string, filter *domain.PriceListFilter) ([]*domain.PriceList, int64, error)
+	// GetActive returns the tenant's active lists whose StartsAt and EndsAt
+	// contain at, with their rules
+	GetActive(ctx context.Context, tenantID string, at time.Time) ([]*domain.PriceList, error)
+}
+
+// PriceListRuleRepository interface for price list rule operations
+type PriceListRuleRepository interface {
+	Create(ctx context.Context, rule *domain.PriceListRule) error
+	Update(ctx context.Context, rule *domain.PriceListRule) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.PriceListRule, error)
+	GetByPriceListID(ctx context.Context, priceListID uuid.UUID) ([]*domain.PriceListRule, error)
+}
+
+// GiftCardRepository interface for gift card and store credit operations
+type GiftCardRepository interface {
+	Create(ctx context.Context, card *domain.GiftCard) error
+	Update(ctx context.Context, card *domain.GiftCard) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.GiftCard, error)
+	// GetByIDForUpdate loads a gift card and locks its row until the surrounding transaction ends
+	GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*domain.GiftCard, error)
+	// GetByCode returns nil when the tenant has no card with the code
+	GetByCode(ctx context.Context, tenantID string, code string) (*domain.GiftCard, error)
+	GetByTenantID(ctx context.Context, tenantID string, filter *domain.GiftCardFilter) ([]*domain.GiftCard, int64, error)
+}
+
+// GiftCardTransactionRepository interface for gift card balance movements
+type GiftCardTransactionRepository interface {
+	Create(ctx context.Context, transaction *domain.GiftCardTransaction) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.GiftCardTransaction, error)
+	// GetByGiftCardID returns a card's transactions, newest first
+	GetByGiftCardID(ctx context.Context, giftCardID uuid.UUID, limit, offset int) ([]*domain.GiftCardTransaction, int64, error)
+	// GetRefundedAmount totals the refund entries made against a redeem entry
+	GetRefundedAmount(ctx context.Context, redeemID uuid.UUID) (float64, error)
+}
+
+// SyncRecordRepository interface for offline sync bookkeeping
+type SyncRecordRepository interface {
+	Create(ctx context.Context, record *domain.SyncRecord) error
+	// GetByClientID returns the record for a client-generated ID, or nil when it has not been synced
+	GetByClientID(ctx context.Context, tenantID string, clientID uuid.UUID) (*domain.SyncRecord, error)
+}
+
 // WishlistRepository interface for wishlist operations
 type WishlistRepository interface {
 	Create(ctx context.Context, wishlist *domain.Wishlist) error
@@ -192,6 +432,7 @@ type WishlistRepository interface {
 	Delete(ctx context.Context, id uuid.UUID) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Wishlist, error)
 	GetByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.Wishlist, error)
+	GetByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*domain.Wishlist, error)
 	GetByShareToken(ctx context.Context, token string) (*domain.Wishlist, error)
 	GetPublicWishlists(ctx context.Context, tenantID string, filter *domain.WishlistFilter) ([]*domain.Wishlist, int64, error)
 	GenerateShareToken(ctx context.Context, wishlistID uuid.UUID) (string, error)
@@ -212,18 +453,37 @@ type WishlistItemRepository interface {
 
 // Combined POS repository interface
 type POSRepositories struct {
-	ProductCategory    ProductCategoryRepository
-	Product            ProductRepository
-	ProductVariation   ProductVariationRepository
-	InventoryLog       InventoryLogRepository
-	Cart               CartRepository
-	CartItem           CartItemRepository
-	Order              OrderRepository
-	OrderItem          OrderItemRepository
-	PaymentTransaction PaymentTransactionRepository
-	Receipt            ReceiptRepository
-	SalesReport        SalesReportRepository
-	Discount           DiscountRepository
-	Wishlist           WishlistRepository
-	WishlistItem       WishlistItemRepository
+	Transaction         TransactionManager
+	ProductCategory     ProductCategoryRepository
+	Product             ProductRepository
+	ProductVariation    ProductVariationRepository
+	ProductBarcode      ProductBarcodeRepository
+	InventoryLog        InventoryLogRepository
+	Cart                CartRepository
+	CartItem            CartItemRepository
+	Order               OrderRepository
+	OrderItem           OrderItemRepository
+	PaymentTransaction  PaymentTransactionRepository
+	Receipt             ReceiptRepository
+	SalesReport         SalesReportRepository
+	Discount            DiscountRepository
+	PriceList           PriceListRepository
+	PriceListRule       PriceListRuleRepository
+	TaxZone             TaxZoneRepository
+	TaxRate             TaxRateRepository
+	StockLocation       StockLocationRepository
+	StockLevel          StockLevelRepository
+	StockTransfer       StockTransferRepository
+	Supplier            SupplierRepository
+	PurchaseOrder       PurchaseOrderRepository
+	RegisterSession     RegisterSessionRepository
+	CashMovement        CashMovementRepository
+	SyncRecord          SyncRecordRepository
+	Customer            CustomerRepository
+	LoyaltyLedger       LoyaltyLedgerRepository
+	GiftCard            GiftCardRepository
+	CatalogImport       CatalogImportRepository
+	GiftCardTransaction GiftCardTransactionRepository
+	Wishlist            WishlistRepository
+	WishlistItem        WishlistItemRepository
 }
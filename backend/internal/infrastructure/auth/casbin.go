@@ -359,6 +359,33 @@ func (s *CasbinService) CreateDefaultTenantRoles(ctx context.Context, tenantID u
 	return nil
 }
 
+// DeleteTenantRoles removes a tenant's roles along with every Casbin policy and
+// role assignment scoped to the tenant. It is safe to call more than once.
+func (s *CasbinService) DeleteTenantRoles(ctx context.Context, tenantID uuid.UUID) error {
+	roles, err := s.roleRepo.ListTenantRoles(ctx, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to list tenant roles: %w", err)
+	}
+
+	for _, role := range roles {
+		if err := s.db.WithContext(ctx).Model(role).Association("Permissions").Clear(); err != nil {
+			return fmt.Errorf("failed to clear tenant role permissions: %w", err)
+		}
+		if err := s.roleRepo.Delete(ctx, role.ID); err != nil {
+			return fmt.Errorf("failed to delete tenant role: %w", err)
+		}
+	}
+
+	if _, err := s.enforcer.RemoveFilteredPolicy(3, tenantID.String()); err != nil {
+		return fmt.Errorf("failed to remove tenant policies: %w", err)
+	}
+	if _, err := s.enforcer.RemoveFilteredGroupingPolicy(2, tenantID.String()); err != nil {
+		return fmt.Errorf("failed to remove tenant role assignments: %w", err)
+	}
+
+	return nil
+}
+
 // ValidateTenantAccess checks if user has access to a specific tenant
 func (s *CasbinService) ValidateTenantAccess(ctx context.Context, userID, tenantID uuid.UUID) (bool, error) {
 	// Get user roles for the tenant
@@ -1,11 +1,13 @@
 package auth
 
 import (
+	"bytes"
 	"context"
 	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -379,25 +381,132 @@ func (kc *KeycloakClient) Logout(refreshToken, clientID string) error {
 	return nil
 }
 
-// CreateUser creates a new user in Keycloak
-func (kc *KeycloakClient) CreateUser(user KeycloakUser) error {
+// CreateUser creates a new user in Keycloak and returns its Keycloak ID
+func (kc *KeycloakClient) CreateUser(user KeycloakUser) (string, error) {
+	if err := kc.getAdminToken(); err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(user)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode user: %w", err)
+	}
+
+	usersURL := fmt.Sprintf("%s/admin/realms/%s/users", kc.config.URL, kc.config.Realm)
+	req, err := http.NewRequest("POST", usersURL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+kc.accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := kc.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("user creation failed with status: %d", resp.StatusCode)
+	}
+
+	// The new user's ID is the last segment of its location
+	location := resp.Header.Get("Location")
+	id := location[strings.LastIndex(location, "/")+1:]
+	if id == "" {
+		return "", fmt.Errorf("user creation returned no user location")
+	}
+	return id, nil
+}
+
+// FindUserIDs returns the IDs of the users with exactly the given username whose
+// attribute has the given value
+func (kc *KeycloakClient) FindUserIDs(username, attribute, value string) ([]string, error) {
+	if err := kc.getAdminToken(); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("exact", "true")
+	query.Set("username", username)
+	query.Set("q", attribute+":"+value)
+	usersURL := fmt.Sprintf("%s/admin/realms/%s/users?%s", kc.config.URL, kc.config.Realm, query.Encode())
+	req, err := http.NewRequest("GET", usersURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+kc.accessToken)
+
+	resp, err := kc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("user lookup failed with status: %d", resp.StatusCode)
+	}
+
+	var users []struct {
+		ID         string              `json:"id"`
+		Username   string              `json:"username"`
+		Attributes map[string][]string `json:"attributes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Older Keycloak versions ignore q, so the attribute is checked here as well
+	var ids []string
+	for _, user := range users {
+		if !strings.EqualFold(user.Username, username) {
+			continue
+		}
+		for _, v := range user.Attributes[attribute] {
+			if v == value {
+				ids = append(ids, user.ID)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// DeleteUser deletes the user with the given Keycloak ID. A user that does not
+// exist is not an error.
+func (kc *KeycloakClient) DeleteUser(id string) error {
 	if err := kc.getAdminToken(); err != nil {
 		return err
 	}
 
-	// Implementation would go here
+	userURL := fmt.Sprintf("%s/admin/realms/%s/users/%s", kc.config.URL, kc.config.Realm, url.PathEscape(id))
+	req, err := http.NewRequest("DELETE", userURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+kc.accessToken)
+
+	resp, err := kc.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("user deletion failed with status: %d", resp.StatusCode)
+	}
 	return nil
 }
 
 // KeycloakUser represents a user in Keycloak
 type KeycloakUser struct {
-	Username      string            `json:"username"`
-	Email         string            `json:"email"`
-	FirstName     string            `json:"firstName"`
-	LastName      string            `json:"lastName"`
-	Enabled       bool              `json:"enabled"`
-	EmailVerified bool              `json:"emailVerified"`
-	Attributes    map[string]string `json:"attributes"`
-	Groups        []string          `json:"groups"`
-	RealmRoles    []string          `json:"realmRoles"`
+	Username      string              `json:"username"`
+	Email         string              `json:"email"`
+	FirstName     string              `json:"firstName"`
+	LastName      string              `json:"lastName"`
+	Enabled       bool                `json:"enabled"`
+	EmailVerified bool                `json:"emailVerified"`
+	Attributes    map[string][]string `json:"attributes"`
+	Groups        []string            `json:"groups"`
+	RealmRoles    []string            `json:"realmRoles"`
 }
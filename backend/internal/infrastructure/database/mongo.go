@@ -3,12 +3,16 @@ package database
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const tenantMetadataCollection = "tenant_metadata"
+
 type MongoClient struct {
 	*mongo.Client
 	Database *mongo.Database
@@ -49,6 +53,65 @@ func (m *MongoClient) GetTenantDatabase(tenantID string) *mongo.Database {
 	return m.Client.Database(dbName)
 }
 
+// CreateTenantDatabase creates the tenant's database. MongoDB only creates a
+// database on first write, so a metadata document recording the tenant is upserted.
+func (m *MongoClient) CreateTenantDatabase(ctx context.Context, tenantID string) error {
+	_, err := m.GetTenantCollection(tenantID, tenantMetadataCollection).UpdateOne(ctx,
+		bson.M{"tenant_id": tenantID},
+		bson.M{"$setOnInsert": bson.M{"tenant_id": tenantID, "created_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create tenant database: %w", err)
+	}
+	return nil
+}
+
+// DropTenantDatabase drops the tenant's database and everything in it
+func (m *MongoClient) DropTenantDatabase(ctx context.Context, tenantID string) error {
+	if err := m.GetTenantDatabase(tenantID).Drop(ctx); err != nil {
+		return fmt.Errorf("failed to drop tenant database: %w", err)
+	}
+	return nil
+}
+
+// ExportTenantDatabase calls fn with every document in the tenant's database as
+// canonical extended JSON, collection by collection
+func (m *MongoClient) ExportTenantDatabase(ctx context.Context, tenantID string, fn func(collection string, document []byte) error) error {
+	db := m.GetTenantDatabase(tenantID)
+	names, err := db.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("failed to list tenant collections: %w", err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := exportCollection(ctx, db.Collection(name), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportCollection(ctx context.Context, collection *mongo.Collection, fn func(collection string, document []byte) error) error {
+	cursor, err := collection.Find(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("failed to export %s: %w", collection.Name(), err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		document, err := bson.MarshalExtJSON(cursor.Current, true, false)
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", collection.Name(), err)
+		}
+		if err := fn(collection.Name(), document); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
 func (m *MongoClient) GetTenantCollection(tenantID, collectionName string) *mongo.Collection {
 	db := m.GetTenantDatabase(tenantID)
 	return db.Collection(collectionName)
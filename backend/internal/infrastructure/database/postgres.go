@@ -1,6 +1,9 @@
 package database
 
 import (
+	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"time"
 
@@ -36,6 +39,15 @@ func NewPostgresDB(config PostgresConfig) (*PostgresDB, error) {
 		config.SSLMode,
 	)
 
+	db, err := openPostgres(dsn, config)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresDB{DB: db}, nil
+}
+
+// openPostgres opens a connection pool to dsn with the pool settings of config
+func openPostgres(dsn string, config PostgresConfig) (*gorm.DB, error) {
 	gormConfig := &gorm.Config{
 		Logger: logger.Default.LogMode(config.LogLevel),
 	}
@@ -55,23 +67,79 @@ func NewPostgresDB(config PostgresConfig) (*PostgresDB, error) {
 	sqlDB.SetMaxIdleConns(config.MaxIdleConnections)
 	sqlDB.SetConnMaxLifetime(config.ConnectionMaxAge)
 
-	return &PostgresDB{DB: db}, nil
+	if _, err := installTenantScope(db); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
-func (p *PostgresDB) GetTenantDB(tenantID string) *gorm.DB {
-	// Implement schema-based multi-tenancy
-	schemaName := fmt.Sprintf("tenant_%s", tenantID)
-	return p.DB.Exec(fmt.Sprintf("SET search_path TO %s", schemaName))
+// GetTenantDB returns a handle whose transactions run against the tenant's schema
+func (p *PostgresDB) GetTenantDB(tenantID string) (*TenantDB, error) {
+	schemaName, err := TenantSchemaName(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &TenantDB{db: p.DB, tenantID: tenantID, schema: schemaName}, nil
 }
 
 func (p *PostgresDB) CreateTenantSchema(tenantID string) error {
-	schemaName := fmt.Sprintf("tenant_%s", tenantID)
-	return p.DB.Exec(fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", schemaName)).Error
+	schemaName, err := TenantSchemaName(tenantID)
+	if err != nil {
+		return err
+	}
+	return p.DB.Exec("CREATE SCHEMA IF NOT EXISTS " + QuoteIdentifier(schemaName)).Error
 }
 
 func (p *PostgresDB) DropTenantSchema(tenantID string) error {
-	schemaName := fmt.Sprintf("tenant_%s", tenantID)
-	return p.DB.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", schemaName)).Error
+	schemaName, err := TenantSchemaName(tenantID)
+	if err != nil {
+		return err
+	}
+	return p.DB.Exec("DROP SCHEMA IF EXISTS " + QuoteIdentifier(schemaName) + " CASCADE").Error
+}
+
+// TryAdvisoryLock takes the session advisory lock named key on a connection of
+// its own and reports whether it was free. The lock is held until unlock is
+// called, or until the connection drops when the process holding it dies.
+func (p *PostgresDB) TryAdvisoryLock(ctx context.Context, key string) (unlock func(), acquired bool, err error) {
+	return advisoryLock(ctx, p.DB, "SELECT pg_try_advisory_lock(hashtextextended($1, 0))", key)
+}
+
+// advisoryLock takes a session advisory lock on a connection of its own with
+// query, which returns whether the lock was taken
+func advisoryLock(ctx context.Context, db *gorm.DB, query, key string) (unlock func(), acquired bool, err error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	if err := conn.QueryRowContext(ctx, query, key).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	return func() {
+		// The caller's context may be done by now, and a connection that could
+		// not be unlocked is thrown away rather than returned to the pool
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtextextended($1, 0))", key); err != nil {
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, true, nil
+}
+
+// IsDuplicateKey reports whether err is a unique constraint violation
+func IsDuplicateKey(err error) bool {
+	return err != nil && errors.Is(postgres.Dialector{}.Translate(err), gorm.ErrDuplicatedKey)
 }
 
 func (p *PostgresDB) Close() error {
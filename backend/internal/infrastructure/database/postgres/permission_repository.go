@@ -7,6 +7,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 )
 
 // PermissionRepository implements the permission repository using PostgreSQL
@@ -21,13 +22,13 @@ func NewPermissionRepository(db *gorm.DB) *PermissionRepository {
 
 // Create creates a new permission
 func (r *PermissionRepository) Create(ctx context.Context, permission *domain.Permission) error {
-	return r.db.WithContext(ctx).Create(permission).Error
+	return database.DBFromContext(ctx, r.db).Create(permission).Error
 }
 
 // GetByID retrieves a permission by ID
 func (r *PermissionRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Permission, error) {
 	var permission domain.Permission
-	err := r.db.WithContext(ctx).First(&permission, "id = ?", id).Error
+	err := database.DBFromContext(ctx, r.db).First(&permission, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +38,7 @@ func (r *PermissionRepository) GetByID(ctx context.Context, id uuid.UUID) (*doma
 // GetByName retrieves a permission by name
 func (r *PermissionRepository) GetByName(ctx context.Context, name string) (*domain.Permission, error) {
 	var permission domain.Permission
-	err := r.db.WithContext(ctx).First(&permission, "name = ?", name).Error
+	err := database.DBFromContext(ctx, r.db).First(&permission, "name = ?", name).Error
 	if err != nil {
 		return nil, err
 	}
@@ -46,18 +47,18 @@ func (r *PermissionRepository) GetByName(ctx context.Context, name string) (*dom
 
 // Update updates a permission
 func (r *PermissionRepository) Update(ctx context.Context, permission *domain.Permission) error {
-	return r.db.WithContext(ctx).Save(permission).Error
+	return database.DBFromContext(ctx, r.db).Save(permission).Error
 }
 
 // Delete deletes a permission
 func (r *PermissionRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.Permission{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.Permission{}, "id = ?", id).Error
 }
 
 // List lists permissions with pagination
 func (r *PermissionRepository) List(ctx context.Context, limit, offset int) ([]*domain.Permission, error) {
 	var permissions []*domain.Permission
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Limit(limit).
 		Offset(offset).
 		Find(&permissions).Error
@@ -67,7 +68,7 @@ func (r *PermissionRepository) List(ctx context.Context, limit, offset int) ([]*
 // ListByResource lists permissions by resource
 func (r *PermissionRepository) ListByResource(ctx context.Context, resource string) ([]*domain.Permission, error) {
 	var permissions []*domain.Permission
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("resource = ?", resource).
 		Find(&permissions).Error
 	return permissions, err
@@ -76,6 +77,6 @@ func (r *PermissionRepository) ListByResource(ctx context.Context, resource stri
 // Count counts permissions
 func (r *PermissionRepository) Count(ctx context.Context) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).Model(&domain.Permission{}).Count(&count).Error
+	err := database.DBFromContext(ctx, r.db).Model(&domain.Permission{}).Count(&count).Error
 	return count, err
 }
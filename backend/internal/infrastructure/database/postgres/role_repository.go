@@ -7,6 +7,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 )
 
 // RoleRepository implements the role repository using PostgreSQL
@@ -21,13 +22,13 @@ func NewRoleRepository(db *gorm.DB) *RoleRepository {
 
 // Create creates a new role
 func (r *RoleRepository) Create(ctx context.Context, role *domain.Role) error {
-	return r.db.WithContext(ctx).Create(role).Error
+	return database.DBFromContext(ctx, r.db).Create(role).Error
 }
 
 // GetByID retrieves a role by ID
 func (r *RoleRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Role, error) {
 	var role domain.Role
-	err := r.db.WithContext(ctx).Preload("Permissions").First(&role, "id = ?", id).Error
+	err := database.DBFromContext(ctx, r.db).Preload("Permissions").First(&role, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +38,7 @@ func (r *RoleRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Rol
 // GetByName retrieves a role by name and tenant ID
 func (r *RoleRepository) GetByName(ctx context.Context, name string, tenantID *uuid.UUID) (*domain.Role, error) {
 	var role domain.Role
-	query := r.db.WithContext(ctx).Preload("Permissions")
+	query := database.DBFromContext(ctx, r.db).Preload("Permissions")
 
 	if tenantID == nil {
 		// System role
@@ -56,12 +57,12 @@ func (r *RoleRepository) GetByName(ctx context.Context, name string, tenantID *u
 
 // Update updates a role
 func (r *RoleRepository) Update(ctx context.Context, role *domain.Role) error {
-	return r.db.WithContext(ctx).Save(role).Error
+	return database.DBFromContext(ctx, r.db).Save(role).Error
 }
 
 // Delete deletes a role (only if not system role)
 func (r *RoleRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Where("id = ? AND is_system = ?", id, false).
 		Delete(&domain.Role{}).Error
 }
@@ -69,7 +70,7 @@ func (r *RoleRepository) Delete(ctx context.Context, id uuid.UUID) error {
 // List lists roles with pagination
 func (r *RoleRepository) List(ctx context.Context, tenantID *uuid.UUID, limit, offset int) ([]*domain.Role, error) {
 	var roles []*domain.Role
-	query := r.db.WithContext(ctx).Preload("Permissions")
+	query := database.DBFromContext(ctx, r.db).Preload("Permissions")
 
 	if tenantID == nil {
 		// List system roles
@@ -86,7 +87,7 @@ func (r *RoleRepository) List(ctx context.Context, tenantID *uuid.UUID, limit, o
 // ListSystemRoles lists all system roles
 func (r *RoleRepository) ListSystemRoles(ctx context.Context) ([]*domain.Role, error) {
 	var roles []*domain.Role
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("Permissions").
 		Where("tenant_id IS NULL AND is_system = ?", true).
 		Find(&roles).Error
@@ -96,7 +97,7 @@ func (r *RoleRepository) ListSystemRoles(ctx context.Context) ([]*domain.Role, e
 // ListTenantRoles lists all roles for a specific tenant
 func (r *RoleRepository) ListTenantRoles(ctx context.Context, tenantID uuid.UUID) ([]*domain.Role, error) {
 	var roles []*domain.Role
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("Permissions").
 		Where("tenant_id = ?", tenantID).
 		Find(&roles).Error
@@ -106,7 +107,7 @@ func (r *RoleRepository) ListTenantRoles(ctx context.Context, tenantID uuid.UUID
 // Count counts roles
 func (r *RoleRepository) Count(ctx context.Context, tenantID *uuid.UUID) (int64, error) {
 	var count int64
-	query := r.db.WithContext(ctx).Model(&domain.Role{})
+	query := database.DBFromContext(ctx, r.db).Model(&domain.Role{})
 
 	if tenantID == nil {
 		query = query.Where("tenant_id IS NULL")
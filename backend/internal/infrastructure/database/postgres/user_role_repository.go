@@ -7,6 +7,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 )
 
 // UserRoleRepository implements the user role repository using PostgreSQL
@@ -21,13 +22,13 @@ func NewUserRoleRepository(db *gorm.DB) *UserRoleRepository {
 
 // Create creates a new user role assignment
 func (r *UserRoleRepository) Create(ctx context.Context, userRole *domain.UserRole) error {
-	return r.db.WithContext(ctx).Create(userRole).Error
+	return database.DBFromContext(ctx, r.db).Create(userRole).Error
 }
 
 // GetByID retrieves a user role by ID
 func (r *UserRoleRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.UserRole, error) {
 	var userRole domain.UserRole
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("User").
 		Preload("Role").
 		Preload("Tenant").
@@ -41,7 +42,7 @@ func (r *UserRoleRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain
 // GetByUserAndTenant retrieves user roles by user and tenant
 func (r *UserRoleRepository) GetByUserAndTenant(ctx context.Context, userID, tenantID uuid.UUID) ([]*domain.UserRole, error) {
 	var userRoles []*domain.UserRole
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("Role").
 		Preload("Role.Permissions").
 		Where("user_id = ? AND tenant_id = ?", userID, tenantID).
@@ -51,17 +52,17 @@ func (r *UserRoleRepository) GetByUserAndTenant(ctx context.Context, userID, ten
 
 // Update updates a user role
 func (r *UserRoleRepository) Update(ctx context.Context, userRole *domain.UserRole) error {
-	return r.db.WithContext(ctx).Save(userRole).Error
+	return database.DBFromContext(ctx, r.db).Save(userRole).Error
 }
 
 // Delete deletes a user role by ID
 func (r *UserRoleRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.UserRole{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.UserRole{}, "id = ?", id).Error
 }
 
 // DeleteByUserAndRole deletes a user role by user, role, and tenant
 func (r *UserRoleRepository) DeleteByUserAndRole(ctx context.Context, userID, roleID, tenantID uuid.UUID) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Where("user_id = ? AND role_id = ? AND tenant_id = ?", userID, roleID, tenantID).
 		Delete(&domain.UserRole{}).Error
 }
@@ -69,7 +70,7 @@ func (r *UserRoleRepository) DeleteByUserAndRole(ctx context.Context, userID, ro
 // ListByUser lists user roles by user
 func (r *UserRoleRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.UserRole, error) {
 	var userRoles []*domain.UserRole
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("Role").
 		Preload("Role.Permissions").
 		Preload("Tenant").
@@ -81,7 +82,7 @@ func (r *UserRoleRepository) ListByUser(ctx context.Context, userID uuid.UUID) (
 // ListByRole lists user roles by role with pagination
 func (r *UserRoleRepository) ListByRole(ctx context.Context, roleID uuid.UUID, limit, offset int) ([]*domain.UserRole, error) {
 	var userRoles []*domain.UserRole
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("User").
 		Preload("Tenant").
 		Where("role_id = ?", roleID).
@@ -94,7 +95,7 @@ func (r *UserRoleRepository) ListByRole(ctx context.Context, roleID uuid.UUID, l
 // ListByTenant lists user roles by tenant with pagination
 func (r *UserRoleRepository) ListByTenant(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*domain.UserRole, error) {
 	var userRoles []*domain.UserRole
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("User").
 		Preload("Role").
 		Where("tenant_id = ?", tenantID).
@@ -107,7 +108,7 @@ func (r *UserRoleRepository) ListByTenant(ctx context.Context, tenantID uuid.UUI
 // CountByRole counts user roles by role
 func (r *UserRoleRepository) CountByRole(ctx context.Context, roleID uuid.UUID) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Model(&domain.UserRole{}).
 		Where("role_id = ?", roleID).
 		Count(&count).Error
@@ -117,7 +118,7 @@ func (r *UserRoleRepository) CountByRole(ctx context.Context, roleID uuid.UUID)
 // CountByTenant counts user roles by tenant
 func (r *UserRoleRepository) CountByTenant(ctx context.Context, tenantID uuid.UUID) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Model(&domain.UserRole{}).
 		Where("tenant_id = ?", tenantID).
 		Count(&count).Error
@@ -40,27 +40,82 @@ func NewRedisClient(config RedisConfig) (*RedisClient, error) {
 	return &RedisClient{Client: rdb}, nil
 }
 
+// TenantKey returns where the *WithTenant methods keep a tenant's key. Every
+// tenant-scoped key, idempotency keys included, lives under the tenant prefix.
+func TenantKey(tenantID, key string) string {
+	return fmt.Sprintf("tenant:%s:%s", tenantID, key)
+}
+
+// TenantKeyPattern matches every key of the tenant
+func TenantKeyPattern(tenantID string) string {
+	return TenantKey(tenantID, "*")
+}
+
 func (r *RedisClient) GetWithTenant(ctx context.Context, tenantID, key string) (string, error) {
-	tenantKey := fmt.Sprintf("tenant:%s:%s", tenantID, key)
+	tenantKey := TenantKey(tenantID, key)
 	return r.Get(ctx, tenantKey).Result()
 }
 
 func (r *RedisClient) SetWithTenant(ctx context.Context, tenantID, key string, value interface{}, expiration time.Duration) error {
-	tenantKey := fmt.Sprintf("tenant:%s:%s", tenantID, key)
+	tenantKey := TenantKey(tenantID, key)
 	return r.Set(ctx, tenantKey, value, expiration).Err()
 }
 
+// SetNXWithTenant sets the key only if it does not exist yet and reports whether it was set
+func (r *RedisClient) SetNXWithTenant(ctx context.Context, tenantID, key string, value interface{}, expiration time.Duration) (bool, error) {
+	tenantKey := TenantKey(tenantID, key)
+	return r.SetNX(ctx, tenantKey, value, expiration).Result()
+}
+
 func (r *RedisClient) DelWithTenant(ctx context.Context, tenantID, key string) error {
-	tenantKey := fmt.Sprintf("tenant:%s:%s", tenantID, key)
+	tenantKey := TenantKey(tenantID, key)
 	return r.Del(ctx, tenantKey).Err()
 }
 
 func (r *RedisClient) ExistsWithTenant(ctx context.Context, tenantID, key string) (bool, error) {
-	tenantKey := fmt.Sprintf("tenant:%s:%s", tenantID, key)
+	tenantKey := TenantKey(tenantID, key)
 	result, err := r.Exists(ctx, tenantKey).Result()
 	return result > 0, err
 }
 
+// ScanTenantKeys calls fn with each of the tenant's keys
+func (r *RedisClient) ScanTenantKeys(ctx context.Context, tenantID string, fn func(key string) error) error {
+	iter := r.Scan(ctx, 0, TenantKeyPattern(tenantID), 100).Iterator()
+	for iter.Next(ctx) {
+		if err := fn(iter.Val()); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// DeleteTenantKeys deletes all of the tenant's keys and returns how many were deleted
+func (r *RedisClient) DeleteTenantKeys(ctx context.Context, tenantID string) (int64, error) {
+	var deleted int64
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := r.Unlink(ctx, batch...).Result()
+		deleted += n
+		batch = batch[:0]
+		return err
+	}
+
+	err := r.ScanTenantKeys(ctx, tenantID, func(key string) error {
+		batch = append(batch, key)
+		if len(batch) < 100 {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	return deleted, err
+}
+
 func (r *RedisClient) Close() error {
 	return r.Client.Close()
 }
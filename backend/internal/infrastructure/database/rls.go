@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// currentTenantSetting holds the tenant of a transaction for the row-level
+// security policies. It is set with set_config(..., true), the equivalent of
+// SET LOCAL, so it ends with the transaction.
+const currentTenantSetting = "app.current_tenant"
+
+// tenantRLSPolicy is the name of the policy created on each tenant table
+const tenantRLSPolicy = "tenant_isolation"
+
+// PlatformRole bypasses row-level security. Migrations and platform jobs that
+// work across tenants run as it; it is created by the 019_platform_role migration.
+const PlatformRole = "zplus_platform"
+
+type platformContextKey struct{}
+
+// TenantRLSTable is a table with a tenant_id column that gets a tenant policy
+type TenantRLSTable struct {
+	Name     string
+	Nullable bool // Rows without a tenant, such as system roles, are shared by every tenant
+}
+
+// setCurrentTenant scopes the row-level security policies of tx to the tenant
+func setCurrentTenant(tx *gorm.DB, tenantID string) error {
+	if err := tx.Exec("SELECT set_config(?, ?, true)", currentTenantSetting, tenantID).Error; err != nil {
+		return fmt.Errorf("failed to set current tenant: %w", err)
+	}
+	return nil
+}
+
+// AsPlatform runs the statements of ctx that are not scoped to a tenant as
+// PlatformRole, for platform jobs that work across tenants. A tenant scope on ctx
+// still restricts its statements to that tenant.
+func AsPlatform(ctx context.Context) context.Context {
+	return context.WithValue(ctx, platformContextKey{}, true)
+}
+
+// isPlatform reports whether ctx runs as PlatformRole
+func isPlatform(ctx context.Context) bool {
+	platform, _ := ctx.Value(platformContextKey{}).(bool)
+	return platform
+}
+
+// setPlatformRole switches tx to PlatformRole until the transaction ends
+func setPlatformRole(tx *gorm.DB) error {
+	if err := tx.Exec("SET LOCAL ROLE " + QuoteIdentifier(PlatformRole)).Error; err != nil {
+		return fmt.Errorf("failed to set platform role: %w", err)
+	}
+	return nil
+}
+
+// TenantRLSStatements returns the SQL that enables row-level security on a table
+// and (re)creates its tenant policy. A transaction that has set app.current_tenant
+// only sees and writes that tenant's rows, so a query that forgets its tenant_id
+// filter returns nothing of other tenants. The policy fails closed: a session
+// that has not set a tenant reaches no tenant rows at all. Migrations and
+// platform jobs run as a role that bypasses row-level security instead; see
+// AsPlatform. Security is forced so the policy also applies to the tables' owner.
+func TenantRLSStatements(schema string, table TenantRLSTable) []string {
+	name := qualifiedTable(schema, table.Name)
+	current := fmt.Sprintf("current_setting('%s', true)", currentTenantSetting)
+	match := fmt.Sprintf("tenant_id::text = %s", current)
+
+	using := match
+	if table.Nullable {
+		using = "tenant_id IS NULL OR " + match
+	}
+
+	return []string{
+		fmt.Sprintf("ALTER TABLE %s ENABLE ROW LEVEL SECURITY", name),
+		fmt.Sprintf("ALTER TABLE %s FORCE ROW LEVEL SECURITY", name),
+		fmt.Sprintf("DROP POLICY IF EXISTS %s ON %s", tenantRLSPolicy, name),
+		fmt.Sprintf("CREATE POLICY %s ON %s USING (%s) WITH CHECK (%s)", tenantRLSPolicy, name, using, match),
+	}
+}
+
+// TenantRLSTables lists the base tables of the schema that have a tenant_id column
+func (p *PostgresDB) TenantRLSTables(ctx context.Context, schema string) ([]TenantRLSTable, error) {
+	var tables []TenantRLSTable
+	err := p.DB.WithContext(ctx).Raw(`
+		SELECT c.table_name AS name, c.is_nullable = 'YES' AS nullable
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = ? AND c.column_name = 'tenant_id' AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name`, schema).Scan(&tables).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenant tables: %w", err)
+	}
+	return tables, nil
+}
+
+// EnableTenantRLS creates the tenant policy on every table of the schema with a
+// tenant_id column, in one transaction. It is safe to run again after migrations
+// add tables. It returns the tables covered.
+func (p *PostgresDB) EnableTenantRLS(ctx context.Context, schema string) ([]TenantRLSTable, error) {
+	tables, err := p.TenantRLSTables(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, table := range tables {
+			for _, statement := range TenantRLSStatements(schema, table) {
+				if err := tx.Exec(statement).Error; err != nil {
+					return fmt.Errorf("failed to enable row-level security on %s: %w", table.Name, err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestTenantRLSStatements(t *testing.T) {
+	statements := TenantRLSStatements("public", TenantRLSTable{Name: "tenant_invitations"})
+	if len(statements) != 4 {
+		t.Fatalf("got %d statements, want 4", len(statements))
+	}
+	if statements[0] != `ALTER TABLE "public"."tenant_invitations" ENABLE ROW LEVEL SECURITY` {
+		t.Errorf("statement 0 = %q", statements[0])
+	}
+	if statements[1] != `ALTER TABLE "public"."tenant_invitations" FORCE ROW LEVEL SECURITY` {
+		t.Errorf("statement 1 = %q", statements[1])
+	}
+	policy := statements[3]
+	if !strings.Contains(policy, "tenant_id::text = current_setting('app.current_tenant', true)") {
+		t.Errorf("policy does not match on app.current_tenant: %q", policy)
+	}
+	if strings.Contains(policy, "tenant_id IS NULL") {
+		t.Errorf("policy of a NOT NULL tenant_id shares rows without a tenant: %q", policy)
+	}
+	if strings.Contains(policy, "COALESCE") || strings.Count(policy, "current_setting") != 2 {
+		t.Errorf("policy lets sessions without a tenant through: %q", policy)
+	}
+
+	nullable := TenantRLSStatements("public", TenantRLSTable{Name: "roles", Nullable: true})[3]
+	using := nullable[strings.Index(nullable, "USING"):strings.Index(nullable, "WITH CHECK")]
+	check := nullable[strings.Index(nullable, "WITH CHECK"):]
+	if !strings.Contains(using, "tenant_id IS NULL") {
+		t.Errorf("policy of a nullable tenant_id hides shared rows: %q", nullable)
+	}
+	if strings.Contains(check, "tenant_id IS NULL") {
+		t.Errorf("policy of a nullable tenant_id lets a tenant write shared rows: %q", nullable)
+	}
+}
+
+func TestTenantIDFromContext(t *testing.T) {
+	if _, ok := TenantIDFromContext(context.Background()); ok {
+		t.Error("TenantIDFromContext found a tenant in an empty context")
+	}
+
+	ctx := WithTenantID(context.Background(), "acme")
+	if tenantID, ok := TenantIDFromContext(ctx); !ok || tenantID != "acme" {
+		t.Errorf("TenantIDFromContext(WithTenantID) = %q, %v, want acme", tenantID, ok)
+	}
+
+	// Fiber stores request locals as user values of the fasthttp request context
+	request := &fasthttp.RequestCtx{}
+	request.SetUserValue("tenant_id", "globex")
+	if tenantID, ok := TenantIDFromContext(request); !ok || tenantID != "globex" {
+		t.Errorf("TenantIDFromContext(request) = %q, %v, want globex", tenantID, ok)
+	}
+
+	request.SetUserValue("tenant_id", "")
+	if _, ok := TenantIDFromContext(request); ok {
+		t.Error("TenantIDFromContext found a tenant in an empty request local")
+	}
+}
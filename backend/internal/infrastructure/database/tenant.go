@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidTenantID     = errors.New("invalid tenant ID")
+	ErrTenantScopeConflict = errors.New("transaction is already scoped to another tenant")
+)
+
+type tenantContextKey struct{}
+
+// tenantScopeContextKey carries the TenantDB a transaction was started from on
+// the context of its statements, for the tenant routing callbacks
+type tenantScopeContextKey struct{}
+
+// requestTenantKey is the request local middleware.TenantAuth stores the tenant
+// under. Handlers pass the fiber request context on, whose Value reads locals.
+const requestTenantKey = "tenant_id"
+
+// maxIdentifierLength is PostgreSQL's NAMEDATALEN - 1; longer names are silently truncated
+const maxIdentifierLength = 63
+
+const tenantSchemaPrefix = "tenant_"
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// TenantSchemaName returns the schema holding a tenant's tables. Tenant IDs are
+// UUIDs or slugs: lowercase letters, digits, hyphens and underscores only.
+func TenantSchemaName(tenantID string) (string, error) {
+	if !tenantIDPattern.MatchString(tenantID) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTenantID, tenantID)
+	}
+	schemaName := tenantSchemaPrefix + tenantID
+	if len(schemaName) > maxIdentifierLength {
+		return "", fmt.Errorf("%w: %q is too long", ErrInvalidTenantID, tenantID)
+	}
+	return schemaName, nil
+}
+
+// QuoteIdentifier quotes a PostgreSQL identifier so it can be placed in SQL text
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// TenantDB scopes queries to one tenant's schema. The search path is only ever
+// set with SET LOCAL inside a transaction, so it ends with the transaction and
+// never reaches the next user of the pooled connection. Tenants whose rows live
+// in shared tables or in a dedicated database have no schema, and their
+// transactions leave the search path alone.
+type TenantDB struct {
+	db        *gorm.DB
+	tenantID  string
+	schema    string
+	dedicated bool // The tenant has a database of its own
+
+	// Handles from Resolve are fenced: their transactions enter the tenant's
+	// write fence and refuse to start once the placement they were resolved
+	// from may have been switched by a move
+	fenced   bool
+	placedAt time.Time
+	maxAge   time.Duration
+}
+
+// TenantID returns the tenant the handle is scoped to
+func (t *TenantDB) TenantID() string {
+	return t.tenantID
+}
+
+// Schema returns the tenant's schema name, unquoted
+func (t *TenantDB) Schema() string {
+	return t.schema
+}
+
+// tableSchema returns the schema the tenant's tables live in
+func (t *TenantDB) tableSchema() string {
+	if t.schema == "" {
+		return "public"
+	}
+	return t.schema
+}
+
+// WithinTransaction runs fn in a transaction scoped to the tenant: app.current_tenant
+// is set for row-level security, and the search path is the tenant's schema
+// followed by public for the tables every tenant shares. Repositories reach the
+// transaction through DBFromContext. A nested call for the same tenant reuses the
+// outer transaction; one for a different tenant, or inside a transaction that is
+// not tenant scoped, fails with ErrTenantScopeConflict.
+func (t *TenantDB) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txContextKey{}).(*gorm.DB); ok {
+		if tenantID, _ := ctx.Value(tenantContextKey{}).(string); tenantID != t.tenantID {
+			return ErrTenantScopeConflict
+		}
+		return fn(ctx)
+	}
+
+	return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := t.scope(tx); err != nil {
+			return err
+		}
+		tx = tx.WithContext(context.WithValue(ctx, tenantScopeContextKey{}, t))
+		ctx = context.WithValue(ctx, txContextKey{}, tx)
+		ctx = context.WithValue(ctx, tenantContextKey{}, t.tenantID)
+		return fn(ctx)
+	})
+}
+
+// scope sets up a transaction of the tenant: app.current_tenant, the write fence
+// for fenced handles and the search path
+func (t *TenantDB) scope(tx *gorm.DB) error {
+	if err := setCurrentTenant(tx, t.tenantID); err != nil {
+		return err
+	}
+	if t.fenced {
+		var entered bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock_shared(hashtextextended(?, 0))", tenantWriteFenceKey(t.tenantID)).Row().Scan(&entered); err != nil {
+			return fmt.Errorf("failed to enter tenant write fence: %w", err)
+		}
+		// A cutover holds the fence exclusively until the tenant is switched, and
+		// by then every placement resolved before its freeze is older than maxAge
+		if !entered || time.Since(t.placedAt) > t.maxAge {
+			return ErrTenantMigrating
+		}
+	}
+	if t.schema != "" {
+		if err := tx.Exec("SET LOCAL search_path TO " + QuoteIdentifier(t.schema) + ", public").Error; err != nil {
+			return fmt.Errorf("failed to set tenant search path: %w", err)
+		}
+	}
+	return nil
+}
+
+// rowsTransaction runs fn in a transaction of the store that sets
+// app.current_tenant but neither enters the write fence nor sets the search path.
+// The move and purge helpers, which name every table with its schema and run
+// while a cutover holds the fence, reach the tenant's rows through it.
+func (t *TenantDB) rowsTransaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := setCurrentTenant(tx, t.tenantID); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// tenantWriteFenceKey names the advisory lock a tenant's transactions hold shared
+// and the cutover of a move holds exclusively
+func tenantWriteFenceKey(tenantID string) string {
+	return "tenant_writes:" + tenantID
+}
+
+// Transaction runs fn with a gorm handle scoped to the tenant's schema
+func (t *TenantDB) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return t.WithinTransaction(ctx, func(ctx context.Context) error {
+		return fn(DBFromContext(ctx, t.db))
+	})
+}
+
+// WithTenantID scopes the transactions started from ctx to the tenant, for callers
+// that do not run on a request, such as workers
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// TenantIDFromContext returns the tenant ctx is scoped to: that of its transaction
+// or of WithTenantID, or else the tenant of the request it belongs to
+func TenantIDFromContext(ctx context.Context) (string, bool) {
+	if tenantID, ok := ctx.Value(tenantContextKey{}).(string); ok {
+		return tenantID, true
+	}
+	tenantID, ok := ctx.Value(requestTenantKey).(string)
+	return tenantID, ok && tenantID != ""
+}
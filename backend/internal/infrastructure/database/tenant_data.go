@@ -0,0 +1,238 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// TenantUser is a member of a tenant as seen by tenant deletion
+type TenantUser struct {
+	ID             string
+	Email          string
+	Username       string
+	KeycloakUserID string
+}
+
+// tenantTables lists the public tables that have the given column, leaving out keep
+func (p *PostgresDB) tenantTables(ctx context.Context, column string, keep []string) ([]string, error) {
+	var tables []string
+	err := p.DB.WithContext(ctx).Raw(`
+		SELECT c.table_name
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = 'public' AND c.column_name = ? AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name`, column).Scan(&tables).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables with %s: %w", column, err)
+	}
+
+	kept := make(map[string]bool, len(keep))
+	for _, table := range keep {
+		kept[table] = true
+	}
+	filtered := tables[:0]
+	for _, table := range tables {
+		if !kept[table] {
+			filtered = append(filtered, table)
+		}
+	}
+	return filtered, nil
+}
+
+// exportRows calls fn with each row the query returns, as JSON
+func exportRows(db *gorm.DB, table string, fn func(table string, row []byte) error, query string, args ...interface{}) error {
+	rows, err := db.Raw(query, args...).Rows()
+	if err != nil {
+		return fmt.Errorf("failed to export %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row []byte
+		if err := rows.Scan(&row); err != nil {
+			return fmt.Errorf("failed to export %s: %w", table, err)
+		}
+		if err := fn(table, row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportTenantRows calls fn with every Postgres row that belongs to the tenant, as
+// JSON and grouped by table: the tenant itself, its members' user records, rows of
+// public tables with a tenant_id column, and the tables of the tenant's schema.
+// Tables are named schema.table. Tables in keep are left out. The public tables
+// are read as PlatformRole.
+func (p *PostgresDB) ExportTenantRows(ctx context.Context, tenantID string, keep []string, fn func(table string, row []byte) error) error {
+	tables, err := p.tenantTables(ctx, "tenant_id", keep)
+	if err != nil {
+		return err
+	}
+	err = WithinPlatformTransaction(ctx, p.DB, func(tx *gorm.DB) error {
+		if err := exportRows(tx, "public.tenants", fn,
+			"SELECT row_to_json(t)::text FROM tenants t WHERE t.id::text = ?", tenantID); err != nil {
+			return err
+		}
+		if err := exportRows(tx, "public.users", fn, `
+			SELECT row_to_json(u)::text FROM users u
+			WHERE u.id IN (SELECT tu.user_id FROM tenant_users tu WHERE tu.tenant_id::text = ?)`, tenantID); err != nil {
+			return err
+		}
+
+		for _, table := range tables {
+			query := fmt.Sprintf("SELECT row_to_json(t)::text FROM public.%s t WHERE t.tenant_id::text = ?", QuoteIdentifier(table))
+			if err := exportRows(tx, "public."+table, fn, query, tenantID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	tenantDB, err := p.GetTenantDB(tenantID)
+	if err != nil {
+		return err
+	}
+	return tenantDB.Transaction(ctx, func(tx *gorm.DB) error {
+		var schemaTables []string
+		err := tx.Raw(`
+			SELECT table_name FROM information_schema.tables
+			WHERE table_schema = ? AND table_type = 'BASE TABLE'
+			ORDER BY table_name`, tenantDB.Schema()).Scan(&schemaTables).Error
+		if err != nil {
+			return fmt.Errorf("failed to list tenant schema tables: %w", err)
+		}
+
+		for _, table := range schemaTables {
+			query := fmt.Sprintf("SELECT row_to_json(t)::text FROM %s.%s t", QuoteIdentifier(tenantDB.Schema()), QuoteIdentifier(table))
+			if err := exportRows(tx, tenantDB.Schema()+"."+table, fn, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ExclusiveTenantUsers returns the tenant's members that belong to no other
+// tenant. Memberships of every tenant are read, as PlatformRole.
+func (p *PostgresDB) ExclusiveTenantUsers(ctx context.Context, tenantID string) ([]TenantUser, error) {
+	var users []TenantUser
+	err := WithinPlatformTransaction(ctx, p.DB, func(tx *gorm.DB) error {
+		return tx.Raw(`
+			SELECT u.id::text AS id, u.email, COALESCE(u.username, '') AS username, COALESCE(u.keycloak_user_id, '') AS keycloak_user_id
+			FROM users u
+			WHERE u.id IN (SELECT user_id FROM tenant_users WHERE tenant_id::text = ?)
+			  AND u.id NOT IN (SELECT user_id FROM tenant_users WHERE tenant_id::text <> ?)
+			ORDER BY u.email`, tenantID, tenantID).Scan(&users).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenant users: %w", err)
+	}
+	return users, nil
+}
+
+// KeycloakUserInOtherTenants reports whether the Keycloak account is the login of
+// a member of any tenant other than the given one, read as PlatformRole
+func (p *PostgresDB) KeycloakUserInOtherTenants(ctx context.Context, keycloakUserID, tenantID string) (bool, error) {
+	var count int64
+	err := WithinPlatformTransaction(ctx, p.DB, func(tx *gorm.DB) error {
+		return tx.Raw(`
+			SELECT COUNT(*) FROM users u
+			JOIN tenant_users tu ON tu.user_id = u.id
+			WHERE u.keycloak_user_id = ? AND tu.tenant_id::text <> ?`, keycloakUserID, tenantID).Scan(&count).Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to look up Keycloak user: %w", err)
+	}
+	return count > 0, nil
+}
+
+// tenantDelete is one delete statement of a tenant purge
+type tenantDelete struct {
+	table string
+	query string
+	args  []interface{}
+}
+
+// deleteInPasses runs the deletes in tx, adding the rows deleted to deleted.
+// Foreign keys decide the order rows can go in, so deletes that fail are retried
+// in further passes until every one succeeds or a pass makes no progress.
+func deleteInPasses(tx *gorm.DB, pending []tenantDelete, deleted map[string]int64) error {
+	for len(pending) > 0 {
+		var failed []tenantDelete
+		var lastErr error
+		var lastTable string
+		for _, item := range pending {
+			// Each delete runs in a savepoint so a foreign key failure does not abort the transaction
+			err := tx.Transaction(func(sp *gorm.DB) error {
+				result := sp.Exec(item.query, item.args...)
+				if result.Error != nil {
+					return result.Error
+				}
+				deleted[item.table] += result.RowsAffected
+				return nil
+			})
+			if err != nil {
+				failed = append(failed, item)
+				lastErr, lastTable = err, item.table
+			}
+		}
+		if len(failed) == len(pending) {
+			return fmt.Errorf("failed to purge %s: %w", lastTable, lastErr)
+		}
+		pending = failed
+	}
+	return nil
+}
+
+// PurgeTenantRows hard deletes the tenant's rows from the public tables, every row
+// of the given users, the users and the tenant, then drops the tenant's schema.
+// The deletes run in passes, see deleteInPasses, as PlatformRole. Tables in keep
+// are left alone. It returns the rows deleted per table.
+func (p *PostgresDB) PurgeTenantRows(ctx context.Context, tenantID string, userIDs []string, keep []string) (map[string]int64, error) {
+	var pending []tenantDelete
+	tables, err := p.tenantTables(ctx, "tenant_id", keep)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		pending = append(pending, tenantDelete{
+			table: table,
+			query: fmt.Sprintf("DELETE FROM public.%s WHERE tenant_id::text = ?", QuoteIdentifier(table)),
+			args:  []interface{}{tenantID},
+		})
+	}
+	if len(userIDs) > 0 {
+		userTables, err := p.tenantTables(ctx, "user_id", keep)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range userTables {
+			pending = append(pending, tenantDelete{
+				table: table,
+				query: fmt.Sprintf("DELETE FROM public.%s WHERE user_id::text IN ?", QuoteIdentifier(table)),
+				args:  []interface{}{userIDs},
+			})
+		}
+		pending = append(pending, tenantDelete{table: "users", query: "DELETE FROM users WHERE id::text IN ?", args: []interface{}{userIDs}})
+	}
+	pending = append(pending, tenantDelete{table: "tenants", query: "DELETE FROM tenants WHERE id::text = ?", args: []interface{}{tenantID}})
+
+	deleted := make(map[string]int64)
+	err = WithinPlatformTransaction(ctx, p.DB, func(tx *gorm.DB) error {
+		return deleteInPasses(tx, pending, deleted)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.DropTenantSchema(tenantID); err != nil {
+		return nil, fmt.Errorf("failed to drop tenant schema: %w", err)
+	}
+	return deleted, nil
+}
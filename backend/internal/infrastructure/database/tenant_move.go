@@ -0,0 +1,303 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// tenantCopyBatchSize is how many rows a copy reads and writes at a time
+const tenantCopyBatchSize = 500
+
+// SharedTenantTables stay in the shared tables whatever a tenant's isolation
+// mode, because they are read before the tenant is known or across tenants.
+// Tables named tenant_* are kept shared too.
+var SharedTenantTables = []string{
+	"api_keys",
+	"audit_logs",
+	"domain_routing_caches",
+	"file_storage_configs",
+	"file_upload_sessions",
+	"files",
+	"roles",
+	"user_roles",
+	"user_sessions",
+}
+
+// MovableTenantTables lists the tables that move with a tenant between isolation
+// modes: the public tables with a tenant_id column other than the shared ones
+func (p *PostgresDB) MovableTenantTables(ctx context.Context) ([]string, error) {
+	tables, err := p.tenantTables(ctx, "tenant_id", SharedTenantTables)
+	if err != nil {
+		return nil, err
+	}
+	movable := tables[:0]
+	for _, table := range tables {
+		if !strings.HasPrefix(table, "tenant_") {
+			movable = append(movable, table)
+		}
+	}
+	return movable, nil
+}
+
+// CopySnapshot returns the oldest transaction of store's database that may still
+// commit changes a copy started now does not see. Passing it to CopyTenantTable
+// later copies every row written since.
+func CopySnapshot(ctx context.Context, store *TenantDB) (int64, error) {
+	var xmin int64
+	if err := store.db.WithContext(ctx).Raw("SELECT txid_snapshot_xmin(txid_current_snapshot())").Row().Scan(&xmin); err != nil {
+		return 0, fmt.Errorf("failed to take copy snapshot: %w", err)
+	}
+	return xmin, nil
+}
+
+// LockTenantWrites takes the tenant's write fence in store exclusively. It waits
+// for the transactions of fenced handles to end, and until unlock is called new
+// ones fail with ErrTenantMigrating.
+func LockTenantWrites(ctx context.Context, store *TenantDB) (unlock func(), err error) {
+	unlock, _, err = advisoryLock(ctx, store.db, "SELECT true FROM pg_advisory_lock(hashtextextended($1, 0))", tenantWriteFenceKey(store.tenantID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock tenant writes: %w", err)
+	}
+	return unlock, nil
+}
+
+// qualifiedTable returns schema.table, quoted
+func qualifiedTable(schema, table string) string {
+	return QuoteIdentifier(schema) + "." + QuoteIdentifier(table)
+}
+
+// primaryKey returns the primary key columns of schema.table in key order, or none
+// when the table has no primary key
+func primaryKey(db *gorm.DB, schema, table string) ([]string, error) {
+	var columns []string
+	err := db.Raw(`
+		SELECT a.attname
+		FROM pg_index i
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		WHERE i.indrelid = to_regclass(?) AND i.indisprimary
+		ORDER BY array_position(i.indkey::int2[], a.attnum)`, qualifiedTable(schema, table)).Scan(&columns).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up primary key of %s: %w", table, err)
+	}
+	return columns, nil
+}
+
+// keyMatch returns the condition matching rows of a and b on the key columns
+func keyMatch(a, b string, key []string) string {
+	conditions := make([]string, len(key))
+	for i, column := range key {
+		conditions[i] = fmt.Sprintf("%s.%s = %s.%s", a, QuoteIdentifier(column), b, QuoteIdentifier(column))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// PrepareTenantTables makes sure the target of a move has the tables. A tenant
+// schema gets copies of the public tables' definitions; a dedicated database is
+// expected to have been migrated already, so its tables are only checked.
+func PrepareTenantTables(ctx context.Context, dst *TenantDB, tables []string) error {
+	db := dst.db.WithContext(ctx)
+
+	if dst.schema != "" {
+		if err := db.Exec("CREATE SCHEMA IF NOT EXISTS " + QuoteIdentifier(dst.schema)).Error; err != nil {
+			return fmt.Errorf("failed to create tenant schema: %w", err)
+		}
+		for _, table := range tables {
+			query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (LIKE %s INCLUDING ALL)", qualifiedTable(dst.schema, table), qualifiedTable("public", table))
+			if err := db.Exec(query).Error; err != nil {
+				return fmt.Errorf("failed to create tenant table %s: %w", table, err)
+			}
+		}
+		return nil
+	}
+
+	var missing []string
+	for _, table := range tables {
+		var exists bool
+		if err := db.Raw("SELECT to_regclass(?) IS NOT NULL", qualifiedTable("public", table)).Row().Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check tenant table %s: %w", table, err)
+		}
+		if !exists {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("tenant database is missing tables: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// CopyTenantTable copies the tenant's rows of a table from src to dst, replacing
+// rows dst already has with the same primary key. With since set to a
+// CopySnapshot of src only rows written by its transactions from then on are
+// copied; tables without a primary key are always copied in full. It returns the
+// rows written.
+func CopyTenantTable(ctx context.Context, table string, src, dst *TenantDB, since *int64) (int64, error) {
+	srcDB := src.db.WithContext(ctx)
+	srcTable := qualifiedTable(src.tableSchema(), table)
+	dstTable := qualifiedTable(dst.tableSchema(), table)
+
+	key, err := primaryKey(srcDB, src.tableSchema(), table)
+	if err != nil {
+		return 0, err
+	}
+	if len(key) == 0 {
+		since = nil
+	}
+
+	where := "t.tenant_id::text = ?"
+	args := []interface{}{src.tenantID}
+	if since != nil {
+		// A row's xmin is the transaction that wrote it. Transaction IDs wrap
+		// around, so they are compared by age: a row written at or after the
+		// snapshot is no older than its xmin.
+		where += " AND age(t.xmin) <= age((?::bigint % 4294967296)::text::xid)"
+		args = append(args, *since)
+	}
+
+	read := func(fn func(tx *gorm.DB) error) error {
+		return src.rowsTransaction(ctx, fn)
+	}
+	if len(key) > 0 {
+		order := make([]string, len(key))
+		for i, column := range key {
+			order[i] = "t." + QuoteIdentifier(column)
+		}
+		write := func(fn func(tx *gorm.DB) error) error {
+			return dst.rowsTransaction(ctx, fn)
+		}
+		return copyTenantRows(read, write, srcTable, dstTable, where, args, strings.Join(order, ", "), key)
+	}
+
+	// Without a key rows cannot be matched up, so the tenant's rows are replaced wholesale
+	var copied int64
+	err = dst.rowsTransaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM "+dstTable+" WHERE tenant_id::text = ?", dst.tenantID).Error; err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+		write := func(fn func(tx *gorm.DB) error) error {
+			return tx.Transaction(fn)
+		}
+		copied, err = copyTenantRows(read, write, srcTable, dstTable, where, args, "t.ctid", nil)
+		return err
+	})
+	return copied, err
+}
+
+// copyTenantRows copies the rows of srcTable matching where to dstTable in batches,
+// deleting rows with the same key first when key is set. Each batch is read in a
+// transaction from read and written in one from write.
+func copyTenantRows(read, write func(fn func(tx *gorm.DB) error) error, srcTable, dstTable, where string, args []interface{}, order string, key []string) (int64, error) {
+	var copied int64
+	for offset := 0; ; offset += tenantCopyBatchSize {
+		query := fmt.Sprintf("SELECT COALESCE(json_agg(row_to_json(t)), '[]')::text FROM (SELECT * FROM %s t WHERE %s ORDER BY %s LIMIT %d OFFSET %d) t",
+			srcTable, where, order, tenantCopyBatchSize, offset)
+		var batch string
+		err := read(func(tx *gorm.DB) error {
+			return tx.Raw(query, args...).Row().Scan(&batch)
+		})
+		if err != nil {
+			return copied, fmt.Errorf("failed to read %s: %w", srcTable, err)
+		}
+		if batch == "[]" {
+			return copied, nil
+		}
+
+		err = write(func(tx *gorm.DB) error {
+			if len(key) > 0 {
+				query := fmt.Sprintf("DELETE FROM %s d USING json_populate_recordset(NULL::%s, ?::json) r WHERE %s",
+					dstTable, dstTable, keyMatch("d", "r", key))
+				if err := tx.Exec(query, batch).Error; err != nil {
+					return err
+				}
+			}
+			result := tx.Exec(fmt.Sprintf("INSERT INTO %s SELECT * FROM json_populate_recordset(NULL::%s, ?::json)", dstTable, dstTable), batch)
+			if result.Error != nil {
+				return result.Error
+			}
+			copied += result.RowsAffected
+			return nil
+		})
+		if err != nil {
+			return copied, fmt.Errorf("failed to write %s: %w", dstTable, err)
+		}
+	}
+}
+
+// PruneTenantTable deletes the tenant's rows of a table from dst whose primary key
+// src no longer has, catching up with deletes made during a copy. Tables without a
+// primary key are copied in full and need no pruning. It returns the rows deleted.
+func PruneTenantTable(ctx context.Context, table string, src, dst *TenantDB) (int64, error) {
+	srcDB := src.db.WithContext(ctx)
+	key, err := primaryKey(srcDB, src.tableSchema(), table)
+	if err != nil || len(key) == 0 {
+		return 0, err
+	}
+
+	columns := make([]string, len(key))
+	for i, column := range key {
+		columns[i] = "t." + QuoteIdentifier(column)
+	}
+	var keys string
+	query := fmt.Sprintf("SELECT COALESCE(json_agg(k), '[]')::text FROM (SELECT %s FROM %s t WHERE t.tenant_id::text = ?) k",
+		strings.Join(columns, ", "), qualifiedTable(src.tableSchema(), table))
+	err = src.rowsTransaction(ctx, func(tx *gorm.DB) error {
+		return tx.Raw(query, src.tenantID).Row().Scan(&keys)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read keys of %s: %w", table, err)
+	}
+
+	dstTable := qualifiedTable(dst.tableSchema(), table)
+	query = fmt.Sprintf("DELETE FROM %s d WHERE d.tenant_id::text = ? AND NOT EXISTS (SELECT 1 FROM json_populate_recordset(NULL::%s, ?::json) r WHERE %s)",
+		dstTable, dstTable, keyMatch("d", "r", key))
+	var pruned int64
+	err = dst.rowsTransaction(ctx, func(tx *gorm.DB) error {
+		result := tx.Exec(query, dst.tenantID, keys)
+		pruned = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune %s: %w", table, err)
+	}
+	return pruned, nil
+}
+
+// DeleteTenantRows deletes the tenant's rows of the tables from store, in passes
+// like PurgeTenantRows. A move cleans up its source with it. It returns the rows
+// deleted per table.
+func DeleteTenantRows(ctx context.Context, store *TenantDB, tables []string) (map[string]int64, error) {
+	pending := make([]tenantDelete, 0, len(tables))
+	for _, table := range tables {
+		pending = append(pending, tenantDelete{
+			table: table,
+			query: fmt.Sprintf("DELETE FROM %s WHERE tenant_id::text = ?", qualifiedTable(store.tableSchema(), table)),
+			args:  []interface{}{store.tenantID},
+		})
+	}
+
+	deleted := make(map[string]int64)
+	err := store.rowsTransaction(ctx, func(tx *gorm.DB) error {
+		return deleteInPasses(tx, pending, deleted)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// ExportTenantTables calls fn with the tenant's rows of the tables in store, as JSON
+// and grouped by table. It covers tenants whose rows live in a dedicated database.
+func ExportTenantTables(ctx context.Context, store *TenantDB, tables []string, fn func(table string, row []byte) error) error {
+	return store.rowsTransaction(ctx, func(tx *gorm.DB) error {
+		for _, table := range tables {
+			query := fmt.Sprintf("SELECT row_to_json(t)::text FROM %s t WHERE t.tenant_id::text = ?", qualifiedTable(store.tableSchema(), table))
+			if err := exportRows(tx, table, fn, query, store.tenantID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
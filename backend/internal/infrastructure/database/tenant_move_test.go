@@ -0,0 +1,335 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+)
+
+const moveTestTable = "move_test_notes"
+
+// moveTestNote is a row of the table the move tests move between placements
+type moveTestNote struct {
+	ID       string
+	TenantID string
+	Body     string
+}
+
+func (moveTestNote) TableName() string {
+	return moveTestTable
+}
+
+// createMoveTestTable creates the notes table in the public schema of db
+func createMoveTestTable(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	if err := db.Exec("DROP TABLE IF EXISTS " + moveTestTable).Error; err != nil {
+		t.Fatalf("failed to drop %s: %v", moveTestTable, err)
+	}
+	if err := db.Exec("CREATE TABLE " + moveTestTable + " (id text PRIMARY KEY, tenant_id text NOT NULL, body text NOT NULL)").Error; err != nil {
+		t.Fatalf("failed to create %s: %v", moveTestTable, err)
+	}
+	t.Cleanup(func() { db.Exec("DROP TABLE IF EXISTS " + moveTestTable) })
+}
+
+// insertNotes writes notes straight to the table of store
+func insertNotes(t *testing.T, store *TenantDB, notes ...moveTestNote) {
+	t.Helper()
+	for _, note := range notes {
+		query := fmt.Sprintf("INSERT INTO %s (id, tenant_id, body) VALUES (?, ?, ?)", qualifiedTable(store.tableSchema(), moveTestTable))
+		if err := store.db.Exec(query, note.ID, note.TenantID, note.Body).Error; err != nil {
+			t.Fatalf("failed to insert note %s: %v", note.ID, err)
+		}
+	}
+}
+
+// storedNotes returns id=body of every note in the table of store, sorted
+func storedNotes(t *testing.T, store *TenantDB) []string {
+	t.Helper()
+	var notes []moveTestNote
+	query := "SELECT * FROM " + qualifiedTable(store.tableSchema(), moveTestTable)
+	if err := store.db.Raw(query).Scan(&notes).Error; err != nil {
+		t.Fatalf("failed to read notes: %v", err)
+	}
+	return noteList(notes)
+}
+
+func noteList(notes []moveTestNote) []string {
+	list := make([]string, len(notes))
+	for i, note := range notes {
+		list[i] = note.ID + "=" + note.Body
+	}
+	sort.Strings(list)
+	return list
+}
+
+func TestCopyTenantTableCopiesRowsWrittenSinceSnapshot(t *testing.T) {
+	p := openTestPostgres(t)
+	ctx := context.Background()
+	createMoveTestTable(t, p.DB)
+
+	src := &TenantDB{db: p.DB, tenantID: "move-test-copy"}
+	dst := createMoveTestSchema(t, p, "move-test-copy")
+	insertNotes(t, src,
+		moveTestNote{ID: "a1", TenantID: "move-test-copy", Body: "first"},
+		moveTestNote{ID: "a2", TenantID: "move-test-copy", Body: "second"},
+		moveTestNote{ID: "b1", TenantID: "move-test-other", Body: "other tenant"},
+	)
+
+	snapshot, err := CopySnapshot(ctx, src)
+	if err != nil {
+		t.Fatalf("CopySnapshot: %v", err)
+	}
+	copied, err := CopyTenantTable(ctx, moveTestTable, src, dst, nil)
+	if err != nil {
+		t.Fatalf("CopyTenantTable: %v", err)
+	}
+	if copied != 2 {
+		t.Errorf("first copy wrote %d rows, want the tenant's 2", copied)
+	}
+
+	// Written after the snapshot, the way a live tenant keeps writing during the copy
+	if err := p.DB.Exec("UPDATE " + moveTestTable + " SET body = 'changed' WHERE id = 'a2'").Error; err != nil {
+		t.Fatalf("failed to update note: %v", err)
+	}
+	insertNotes(t, src, moveTestNote{ID: "a3", TenantID: "move-test-copy", Body: "third"})
+
+	copied, err = CopyTenantTable(ctx, moveTestTable, src, dst, &snapshot)
+	if err != nil {
+		t.Fatalf("CopyTenantTable since snapshot: %v", err)
+	}
+	if copied < 2 {
+		t.Errorf("copy since the snapshot wrote %d rows, want at least the 2 written since", copied)
+	}
+
+	want := []string{"a1=first", "a2=changed", "a3=third"}
+	if got := storedNotes(t, dst); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("target notes = %v, want %v", got, want)
+	}
+}
+
+func TestPruneTenantTableRemovesRowsDeletedAtSource(t *testing.T) {
+	p := openTestPostgres(t)
+	ctx := context.Background()
+	createMoveTestTable(t, p.DB)
+
+	src := &TenantDB{db: p.DB, tenantID: "move-test-prune"}
+	dst := createMoveTestSchema(t, p, "move-test-prune")
+	insertNotes(t, src,
+		moveTestNote{ID: "a1", TenantID: "move-test-prune", Body: "kept"},
+		moveTestNote{ID: "a2", TenantID: "move-test-prune", Body: "deleted"},
+	)
+	if _, err := CopyTenantTable(ctx, moveTestTable, src, dst, nil); err != nil {
+		t.Fatalf("CopyTenantTable: %v", err)
+	}
+	if err := p.DB.Exec("DELETE FROM " + moveTestTable + " WHERE id = 'a2'").Error; err != nil {
+		t.Fatalf("failed to delete note: %v", err)
+	}
+
+	pruned, err := PruneTenantTable(ctx, moveTestTable, src, dst)
+	if err != nil {
+		t.Fatalf("PruneTenantTable: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("pruned %d rows, want 1", pruned)
+	}
+	if got := storedNotes(t, dst); len(got) != 1 || got[0] != "a1=kept" {
+		t.Errorf("target notes = %v, want [a1=kept]", got)
+	}
+}
+
+// createMoveTestSchema creates the tenant's schema with a copy of the notes table
+func createMoveTestSchema(t *testing.T, p *PostgresDB, tenantID string) *TenantDB {
+	t.Helper()
+	if err := p.DropTenantSchema(tenantID); err != nil {
+		t.Fatalf("failed to drop schema for %s: %v", tenantID, err)
+	}
+	t.Cleanup(func() { p.DropTenantSchema(tenantID) })
+
+	store, err := p.GetTenantDB(tenantID)
+	if err != nil {
+		t.Fatalf("GetTenantDB(%s): %v", tenantID, err)
+	}
+	if err := PrepareTenantTables(context.Background(), store, []string{moveTestTable}); err != nil {
+		t.Fatalf("PrepareTenantTables: %v", err)
+	}
+	return store
+}
+
+// createMoveTestDatabase creates a database of its own next to the test database
+// and returns its DSN, skipping the test when the role may not create databases
+func createMoveTestDatabase(t *testing.T, p *PostgresDB) string {
+	t.Helper()
+	const name = "zplus_move_test"
+	p.DB.Exec("DROP DATABASE IF EXISTS " + name)
+	if err := p.DB.Exec("CREATE DATABASE " + name).Error; err != nil {
+		t.Skipf("cannot create a database for the tenant: %v", err)
+	}
+	t.Cleanup(func() { p.DB.Exec("DROP DATABASE IF EXISTS " + name) })
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		u.Path = "/" + name
+		return u.String()
+	}
+	return dsn + " dbname=" + name
+}
+
+// movePlacements is the placement lookup of the move test, switched by the test
+type movePlacements struct {
+	mu        sync.Mutex
+	placement TenantPlacement
+}
+
+func (m *movePlacements) lookup(ctx context.Context, tenantID string) (TenantPlacement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.placement, nil
+}
+
+func (m *movePlacements) set(placement TenantPlacement) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.placement = placement
+}
+
+func TestTenantMoveSharedToSchemaToDatabase(t *testing.T) {
+	p := openTestPostgres(t)
+	dsn := createMoveTestDatabase(t, p)
+	createMoveTestTable(t, p.DB)
+
+	const tenantID = "move-test-full"
+	placements := &movePlacements{placement: TenantPlacement{Mode: domain.TenantIsolationShared}}
+	resolver, err := NewTenantConnectionResolver(p, PostgresConfig{MaxOpenConnections: 2, MaxIdleConnections: 2, LogLevel: logger.Silent}, placements.lookup, 0)
+	if err != nil {
+		t.Fatalf("NewTenantConnectionResolver: %v", err)
+	}
+	t.Cleanup(func() { resolver.Close() })
+
+	dedicated, err := resolver.Connect(tenantID, domain.TenantIsolationDatabase, dsn)
+	if err != nil {
+		t.Fatalf("failed to connect to the tenant database: %v", err)
+	}
+	createMoveTestTable(t, dedicated.db)
+	t.Cleanup(func() { p.DropTenantSchema(tenantID) })
+
+	// The repository view: model queries on a tenant scoped context
+	ctx := WithTenantID(context.Background(), tenantID)
+	write := func(note moveTestNote) error {
+		note.TenantID = tenantID
+		return p.DB.WithContext(ctx).Create(&note).Error
+	}
+	read := func() []string {
+		t.Helper()
+		var notes []moveTestNote
+		if err := p.DB.WithContext(ctx).Find(&notes).Error; err != nil {
+			t.Fatalf("failed to read the tenant's notes: %v", err)
+		}
+		return noteList(notes)
+	}
+
+	if err := write(moveTestNote{ID: "n1", Body: "shared"}); err != nil {
+		t.Fatalf("write while shared: %v", err)
+	}
+
+	move := func(from, to TenantPlacement, whileCopying moveTestNote) {
+		t.Helper()
+		src, err := resolver.Connect(tenantID, from.Mode, from.DatabaseDSN)
+		if err != nil {
+			t.Fatalf("Connect source: %v", err)
+		}
+		dst, err := resolver.Connect(tenantID, to.Mode, to.DatabaseDSN)
+		if err != nil {
+			t.Fatalf("Connect target: %v", err)
+		}
+		if err := PrepareTenantTables(ctx, dst, []string{moveTestTable}); err != nil {
+			t.Fatalf("PrepareTenantTables: %v", err)
+		}
+		snapshot, err := CopySnapshot(ctx, src)
+		if err != nil {
+			t.Fatalf("CopySnapshot: %v", err)
+		}
+		if _, err := CopyTenantTable(ctx, moveTestTable, src, dst, nil); err != nil {
+			t.Fatalf("CopyTenantTable: %v", err)
+		}
+		// The tenant stays live during the copy
+		if err := write(whileCopying); err != nil {
+			t.Fatalf("write during the copy: %v", err)
+		}
+		stale, err := resolver.Resolve(ctx, tenantID)
+		if err != nil {
+			t.Fatalf("Resolve before the freeze: %v", err)
+		}
+
+		frozen := from
+		frozen.Frozen = true
+		placements.set(frozen)
+		resolver.Invalidate(tenantID)
+		if err := write(moveTestNote{ID: "frozen", Body: "lost"}); !errors.Is(err, ErrTenantMigrating) {
+			t.Fatalf("write while frozen error = %v, want ErrTenantMigrating", err)
+		}
+
+		unlock, err := LockTenantWrites(ctx, src)
+		if err != nil {
+			t.Fatalf("LockTenantWrites: %v", err)
+		}
+		// A handle resolved before the freeze cannot write past the fence either
+		err = stale.WithinTransaction(ctx, func(ctx context.Context) error { return nil })
+		if !errors.Is(err, ErrTenantMigrating) {
+			t.Fatalf("transaction of a handle resolved before the freeze error = %v, want ErrTenantMigrating", err)
+		}
+		if _, err := CopyTenantTable(ctx, moveTestTable, src, dst, &snapshot); err != nil {
+			t.Fatalf("CopyTenantTable since snapshot: %v", err)
+		}
+		if _, err := PruneTenantTable(ctx, moveTestTable, src, dst); err != nil {
+			t.Fatalf("PruneTenantTable: %v", err)
+		}
+		placements.set(to)
+		resolver.Invalidate(tenantID)
+		unlock()
+
+		// Cleaning up the source must not take the tenant's rows with it
+		if from.Mode == domain.TenantIsolationSchema {
+			if err := p.DropTenantSchema(tenantID); err != nil {
+				t.Fatalf("DropTenantSchema: %v", err)
+			}
+		} else if _, err := DeleteTenantRows(ctx, src, []string{moveTestTable}); err != nil {
+			t.Fatalf("DeleteTenantRows: %v", err)
+		}
+	}
+
+	schema := TenantPlacement{Mode: domain.TenantIsolationSchema}
+	move(TenantPlacement{Mode: domain.TenantIsolationShared}, schema, moveTestNote{ID: "n2", Body: "copying to schema"})
+	if err := write(moveTestNote{ID: "n3", Body: "schema"}); err != nil {
+		t.Fatalf("write while in a schema: %v", err)
+	}
+	want := []string{"n1=shared", "n2=copying to schema", "n3=schema"}
+	if got := read(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("notes after the move to a schema = %v, want %v", got, want)
+	}
+
+	move(schema, TenantPlacement{Mode: domain.TenantIsolationDatabase, DatabaseDSN: dsn}, moveTestNote{ID: "n4", Body: "copying to database"})
+	if err := write(moveTestNote{ID: "n5", Body: "database"}); err != nil {
+		t.Fatalf("write while in a database: %v", err)
+	}
+	want = append(want, "n4=copying to database", "n5=database")
+	if got := read(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("notes after the move to a database = %v, want %v", got, want)
+	}
+	if got := storedNotes(t, dedicated); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("tenant database holds %v, want %v", got, want)
+	}
+	if got := storedNotes(t, &TenantDB{db: p.DB, tenantID: tenantID}); len(got) != 0 {
+		t.Errorf("shared table still holds %v", got)
+	}
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTenantMigrating      = errors.New("tenant is being moved to another isolation mode")
+	ErrInvalidIsolationMode = errors.New("invalid tenant isolation mode")
+)
+
+// TenantPlacement says where a tenant's rows live
+type TenantPlacement struct {
+	Mode        string // One of the domain.TenantIsolation* modes
+	DatabaseDSN string // Dedicated database, for the database mode
+	Frozen      bool   // Set while a move between modes is cutting over
+}
+
+// TenantPlacementFunc looks up a tenant's placement
+type TenantPlacementFunc func(ctx context.Context, tenantID string) (TenantPlacement, error)
+
+// placementGrace is added to the cache TTL for the time a placement may take to
+// be looked up and acted on
+const placementGrace = 5 * time.Second
+
+type cachedPlacement struct {
+	placement TenantPlacement
+	placedAt  time.Time // When the lookup began
+}
+
+// TenantConnectionResolver hands out the TenantDB for a tenant according to its
+// isolation mode: the shared database for shared rows, the tenant's schema of the
+// shared database, or a pool of its own for a dedicated database. Placements are
+// cached for cacheTTL, so a change reaches every instance within that time.
+//
+// The resolver registers with the tenant scope of the shared database, so the
+// queries repositories run for a tenant scoped context reach the tenant's rows
+// wherever they live; see route.
+type TenantConnectionResolver struct {
+	shared   *PostgresDB
+	config   PostgresConfig
+	lookup   TenantPlacementFunc
+	cacheTTL time.Duration
+
+	mu         sync.Mutex
+	placements map[string]cachedPlacement
+	pools      map[string]*gorm.DB
+	isolated   map[string]bool
+}
+
+// NewTenantConnectionResolver creates a resolver and registers it with the tenant
+// scope of the shared database. Dedicated database pools use the pool settings of config.
+func NewTenantConnectionResolver(shared *PostgresDB, config PostgresConfig, lookup TenantPlacementFunc, cacheTTL time.Duration) (*TenantConnectionResolver, error) {
+	r := &TenantConnectionResolver{
+		shared:     shared,
+		config:     config,
+		lookup:     lookup,
+		cacheTTL:   cacheTTL,
+		placements: make(map[string]cachedPlacement),
+		pools:      make(map[string]*gorm.DB),
+	}
+	scope, err := installTenantScope(shared.DB)
+	if err != nil {
+		return nil, err
+	}
+	scope.resolver.Store(r)
+	return r, nil
+}
+
+// FreezeWait returns how long a move waits after freezing a tenant: placements
+// are served from the cache for up to this long, so by then every instance sees
+// the freeze
+func (r *TenantConnectionResolver) FreezeWait() time.Duration {
+	return r.cacheTTL + placementGrace
+}
+
+// Resolve returns the TenantDB for the tenant's current placement. It fails with
+// ErrTenantMigrating while the tenant is cutting over to another mode. The
+// handle is fenced, so its transactions also fail with ErrTenantMigrating once a
+// cutover has taken the tenant's writes.
+func (r *TenantConnectionResolver) Resolve(ctx context.Context, tenantID string) (*TenantDB, error) {
+	placement, placedAt, err := r.placement(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if placement.Frozen {
+		return nil, ErrTenantMigrating
+	}
+	tenantDB, err := r.Connect(tenantID, placement.Mode, placement.DatabaseDSN)
+	if err != nil {
+		return nil, err
+	}
+	tenantDB.fenced = true
+	tenantDB.placedAt = placedAt
+	tenantDB.maxAge = r.FreezeWait()
+	return tenantDB, nil
+}
+
+// Connect returns the TenantDB for the tenant in the given mode, whatever its
+// current placement. Moves between modes use it to reach both sides.
+func (r *TenantConnectionResolver) Connect(tenantID, mode, dsn string) (*TenantDB, error) {
+	if !tenantIDPattern.MatchString(tenantID) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTenantID, tenantID)
+	}
+
+	switch mode {
+	case domain.TenantIsolationShared:
+		return &TenantDB{db: r.shared.DB, tenantID: tenantID}, nil
+	case domain.TenantIsolationSchema:
+		return r.shared.GetTenantDB(tenantID)
+	case domain.TenantIsolationDatabase:
+		if dsn == "" {
+			return nil, fmt.Errorf("%w: tenant %s has no database DSN", ErrInvalidIsolationMode, tenantID)
+		}
+		db, err := r.pool(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return &TenantDB{db: db, tenantID: tenantID, dedicated: true}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidIsolationMode, mode)
+	}
+}
+
+// Invalidate drops the tenant's cached placement
+func (r *TenantConnectionResolver) Invalidate(tenantID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.placements, tenantID)
+}
+
+// Close closes the dedicated database pools
+func (r *TenantConnectionResolver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for dsn, db := range r.pools {
+		if sqlDB, err := db.DB(); err == nil {
+			if err := sqlDB.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		delete(r.pools, dsn)
+	}
+	return firstErr
+}
+
+// placement returns the tenant's placement and when its lookup began
+func (r *TenantConnectionResolver) placement(ctx context.Context, tenantID string) (TenantPlacement, time.Time, error) {
+	r.mu.Lock()
+	cached, ok := r.placements[tenantID]
+	r.mu.Unlock()
+	if ok && time.Since(cached.placedAt) < r.cacheTTL {
+		return cached.placement, cached.placedAt, nil
+	}
+
+	placedAt := time.Now()
+	placement, err := r.lookup(ctx, tenantID)
+	if err != nil {
+		return TenantPlacement{}, time.Time{}, err
+	}
+
+	r.mu.Lock()
+	r.placements[tenantID] = cachedPlacement{placement: placement, placedAt: placedAt}
+	r.mu.Unlock()
+	return placement, placedAt, nil
+}
+
+// pool returns the connection pool for a dedicated database, opening it on first use
+func (r *TenantConnectionResolver) pool(dsn string) (*gorm.DB, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if db, ok := r.pools[dsn]; ok {
+		return db, nil
+	}
+	db, err := openPostgres(dsn, r.config)
+	if err != nil {
+		return nil, err
+	}
+	// Statements on shared tables inside the tenant's transactions are sent
+	// back to the shared database
+	scope, err := installTenantScope(db)
+	if err != nil {
+		if sqlDB, dbErr := db.DB(); dbErr == nil {
+			sqlDB.Close()
+		}
+		return nil, err
+	}
+	scope.resolver.Store(r)
+	r.pools[dsn] = db
+	return db, nil
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// tenantScopePlugin is the name the tenant scope is installed under
+const tenantScopePlugin = "tenant_scope"
+
+// tenantRoutedTransaction holds the transaction route started for a statement
+const tenantRoutedTransaction = "tenant:routed_transaction"
+
+// tenantScope is a gorm plugin that runs the statements repositories issue
+// outside a transaction for a tenant scoped context in a transaction that sets
+// app.current_tenant, so the tenant policies, which fail closed, let them reach
+// the tenant's rows. Statements of a context from AsPlatform run as
+// PlatformRole. openPostgres installs it on every pool; a
+// TenantConnectionResolver registers with it to send tenant statements to the
+// tenant's placement.
+type tenantScope struct {
+	db       *gorm.DB
+	resolver atomic.Pointer[TenantConnectionResolver]
+}
+
+// routedTransaction is the transaction route started for a statement, with the
+// connection the statement had before
+type routedTransaction struct {
+	tx       *gorm.DB
+	connPool gorm.ConnPool
+}
+
+// InstallTenantScope installs the tenant scope on a database opened without
+// NewPostgresDB. It does nothing when the scope is already installed.
+func InstallTenantScope(db *gorm.DB) error {
+	_, err := installTenantScope(db)
+	return err
+}
+
+func installTenantScope(db *gorm.DB) (*tenantScope, error) {
+	if scope, ok := db.Config.Plugins[tenantScopePlugin].(*tenantScope); ok {
+		return scope, nil
+	}
+	scope := &tenantScope{}
+	if err := db.Use(scope); err != nil {
+		return nil, fmt.Errorf("failed to install tenant scope: %w", err)
+	}
+	return scope, nil
+}
+
+// Name implements gorm.Plugin
+func (s *tenantScope) Name() string {
+	return tenantScopePlugin
+}
+
+// Initialize implements gorm.Plugin by registering the routing callbacks around
+// the statements that read or write a model's table
+func (s *tenantScope) Initialize(db *gorm.DB) error {
+	s.db = db
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:begin_transaction").Register("tenant:route", s.route),
+		callbacks.Create().After("gorm:commit_or_rollback_transaction").Register("tenant:finish", finishRoute),
+		callbacks.Update().Before("gorm:begin_transaction").Register("tenant:route", s.route),
+		callbacks.Update().After("gorm:commit_or_rollback_transaction").Register("tenant:finish", finishRoute),
+		callbacks.Delete().Before("gorm:begin_transaction").Register("tenant:route", s.route),
+		callbacks.Delete().After("gorm:commit_or_rollback_transaction").Register("tenant:finish", finishRoute),
+		callbacks.Query().Before("gorm:query").Register("tenant:route", s.route),
+		callbacks.Query().After("gorm:after_query").Register("tenant:finish", finishRoute),
+	)
+}
+
+// resolverOf returns the resolver registered with the tenant scope of db, if any
+func resolverOf(db *gorm.DB) *TenantConnectionResolver {
+	if scope, ok := db.Config.Plugins[tenantScopePlugin].(*tenantScope); ok {
+		return scope.resolver.Load()
+	}
+	return nil
+}
+
+// route runs a statement outside a transaction in one of its own. For a tenant
+// scoped context it sets app.current_tenant, and when a resolver is registered
+// statements on a table that moves with the tenant run on the tenant's
+// placement, fenced like the transactions of a TenantDB from Resolve. For a
+// context from AsPlatform it runs as PlatformRole. Inside a transaction
+// statements run where it does, except that inside the transaction of a tenant
+// in its own database statements on the tables every tenant shares are sent back
+// to the shared database, in a transaction scoped to the tenant. Raw SQL and
+// Row, Rows and Scan are not routed; they run wherever their transaction does.
+func (s *tenantScope) route(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil {
+		return
+	}
+	resolver := s.resolver.Load()
+	shared, isolated := s.db, false
+	if resolver != nil {
+		shared = resolver.shared.DB
+		if stmt.Table != "" {
+			var err error
+			if isolated, err = resolver.isolatedTable(stmt.Table); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+	}
+
+	var target *gorm.DB
+	var scope func(tx *gorm.DB) error
+	if _, inTx := stmt.ConnPool.(gorm.TxCommitter); inTx {
+		tenantDB, ok := stmt.Context.Value(tenantScopeContextKey{}).(*TenantDB)
+		if !ok || !tenantDB.dedicated || isolated {
+			return
+		}
+		target, scope = shared, (&TenantDB{db: shared, tenantID: tenantDB.tenantID}).scope
+	} else if tenantID, ok := TenantIDFromContext(stmt.Context); ok {
+		tenantDB := &TenantDB{db: shared, tenantID: tenantID}
+		if isolated {
+			var err error
+			if tenantDB, err = resolver.Resolve(stmt.Context, tenantID); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+		target, scope = tenantDB.db, tenantDB.scope
+	} else if isPlatform(stmt.Context) {
+		target, scope = s.db, setPlatformRole
+	} else {
+		return
+	}
+
+	tx := target.WithContext(stmt.Context).Begin()
+	if tx.Error != nil {
+		db.AddError(tx.Error)
+		return
+	}
+	if err := scope(tx); err != nil {
+		tx.Rollback()
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(tenantRoutedTransaction, routedTransaction{tx: tx, connPool: stmt.ConnPool})
+	stmt.ConnPool = tx.Statement.ConnPool
+}
+
+// finishRoute commits the transaction route started, or rolls it back when the
+// statement failed
+func finishRoute(db *gorm.DB) {
+	value, ok := db.InstanceGet(tenantRoutedTransaction)
+	if !ok {
+		return
+	}
+	routed := value.(routedTransaction)
+	if db.Error != nil {
+		routed.tx.Rollback()
+	} else if err := routed.tx.Commit().Error; err != nil {
+		db.AddError(err)
+	}
+	db.Statement.ConnPool = routed.connPool
+}
+
+// isolatedTable reports whether a table's rows follow the tenant's isolation
+// mode. The tables are listed from the shared database the first time.
+func (r *TenantConnectionResolver) isolatedTable(table string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isolated == nil {
+		tables, err := r.shared.MovableTenantTables(context.Background())
+		if err != nil {
+			return false, err
+		}
+		r.isolated = make(map[string]bool, len(tables))
+		for _, movable := range tables {
+			r.isolated[movable] = true
+		}
+	}
+	return r.isolated[table], nil
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestTenantSchemaName(t *testing.T) {
+	tests := []struct {
+		tenantID string
+		want     string
+		wantErr  bool
+	}{
+		{tenantID: "acme", want: "tenant_acme"},
+		{tenantID: "acme-corp_2", want: "tenant_acme-corp_2"},
+		{tenantID: "0b7e4f3a-1c2d-4e5f-8a9b-0c1d2e3f4a5b", want: "tenant_0b7e4f3a-1c2d-4e5f-8a9b-0c1d2e3f4a5b"},
+		{tenantID: "", wantErr: true},
+		{tenantID: "Acme", wantErr: true},
+		{tenantID: "-acme", wantErr: true},
+		{tenantID: "acme; DROP SCHEMA public CASCADE", wantErr: true},
+		{tenantID: `acme"`, wantErr: true},
+		{tenantID: "acme,public", wantErr: true},
+		{tenantID: strings.Repeat("a", maxIdentifierLength-len(tenantSchemaPrefix)), want: "tenant_" + strings.Repeat("a", maxIdentifierLength-len(tenantSchemaPrefix))},
+		{tenantID: strings.Repeat("a", maxIdentifierLength-len(tenantSchemaPrefix)+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := TenantSchemaName(tt.tenantID)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidTenantID) {
+				t.Errorf("TenantSchemaName(%q) error = %v, want ErrInvalidTenantID", tt.tenantID, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("TenantSchemaName(%q) unexpected error: %v", tt.tenantID, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("TenantSchemaName(%q) = %q, want %q", tt.tenantID, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"tenant_acme":      `"tenant_acme"`,
+		"tenant_acme-corp": `"tenant_acme-corp"`,
+		`a"b`:              `"a""b"`,
+	}
+	for name, want := range tests {
+		if got := QuoteIdentifier(name); got != want {
+			t.Errorf("QuoteIdentifier(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// openTestPostgres connects to the database named by TEST_POSTGRES_DSN, skipping
+// the test when it is not set. The pool is kept small so tenants share connections.
+func openTestPostgres(t *testing.T) *PostgresDB {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to connect to PostgreSQL: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get underlying sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(2)
+	sqlDB.SetMaxIdleConns(2)
+
+	p := &PostgresDB{DB: db}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+// createTestTenant creates a tenant schema holding one notes table with a single row
+func createTestTenant(t *testing.T, p *PostgresDB, tenantID string) *TenantDB {
+	t.Helper()
+	if err := p.DropTenantSchema(tenantID); err != nil {
+		t.Fatalf("failed to drop schema for %s: %v", tenantID, err)
+	}
+	if err := p.CreateTenantSchema(tenantID); err != nil {
+		t.Fatalf("failed to create schema for %s: %v", tenantID, err)
+	}
+	t.Cleanup(func() { p.DropTenantSchema(tenantID) })
+
+	tenantDB, err := p.GetTenantDB(tenantID)
+	if err != nil {
+		t.Fatalf("GetTenantDB(%s): %v", tenantID, err)
+	}
+	err = tenantDB.Transaction(context.Background(), func(tx *gorm.DB) error {
+		if err := tx.Exec("CREATE TABLE notes (owner text NOT NULL)").Error; err != nil {
+			return err
+		}
+		return tx.Exec("INSERT INTO notes (owner) VALUES (?)", tenantID).Error
+	})
+	if err != nil {
+		t.Fatalf("failed to seed %s: %v", tenantID, err)
+	}
+	return tenantDB
+}
+
+func TestTenantDBConcurrentTenantsAreIsolated(t *testing.T) {
+	p := openTestPostgres(t)
+	tenants := []*TenantDB{
+		createTestTenant(t, p, "isolation-test-a"),
+		createTestTenant(t, p, "isolation-test-b"),
+	}
+
+	const iterations = 200
+	var wg sync.WaitGroup
+	errs := make(chan error, len(tenants)*iterations)
+	for _, tenantDB := range tenants {
+		for i := 0; i < iterations; i++ {
+			wg.Add(1)
+			go func(tenantDB *TenantDB) {
+				defer wg.Done()
+				err := tenantDB.Transaction(context.Background(), func(tx *gorm.DB) error {
+					var owners []string
+					if err := tx.Raw("SELECT owner FROM notes").Scan(&owners).Error; err != nil {
+						return err
+					}
+					if len(owners) != 1 || owners[0] != tenantDB.TenantID() {
+						return fmt.Errorf("tenant %s saw rows %v", tenantDB.TenantID(), owners)
+					}
+					return nil
+				})
+				if err != nil {
+					errs <- err
+				}
+			}(tenantDB)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestTenantDBSearchPathDoesNotLeakToPool(t *testing.T) {
+	p := openTestPostgres(t)
+	tenantDB := createTestTenant(t, p, "isolation-test-leak")
+
+	for i := 0; i < 10; i++ {
+		if err := tenantDB.Transaction(context.Background(), func(tx *gorm.DB) error { return nil }); err != nil {
+			t.Fatalf("tenant transaction: %v", err)
+		}
+	}
+
+	// Every pooled connection should be back on the default search path
+	for i := 0; i < 4; i++ {
+		var searchPath string
+		if err := p.DB.Raw("SHOW search_path").Scan(&searchPath).Error; err != nil {
+			t.Fatalf("SHOW search_path: %v", err)
+		}
+		if strings.Contains(searchPath, tenantDB.Schema()) {
+			t.Fatalf("search_path %q leaked from a tenant transaction", searchPath)
+		}
+	}
+	var count int64
+	if err := p.DB.Raw("SELECT count(*) FROM information_schema.tables WHERE table_name = 'notes' AND table_schema = current_schema()").Scan(&count).Error; err != nil {
+		t.Fatalf("count notes tables: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("the tenant's notes table is visible outside its transaction")
+	}
+}
+
+func TestTenantDBRejectsNestedTenantSwitch(t *testing.T) {
+	p := openTestPostgres(t)
+	tenantA := createTestTenant(t, p, "isolation-test-nested-a")
+	tenantB := createTestTenant(t, p, "isolation-test-nested-b")
+
+	err := tenantA.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		if tenantID, _ := TenantIDFromContext(ctx); tenantID != tenantA.TenantID() {
+			t.Errorf("TenantIDFromContext = %q, want %q", tenantID, tenantA.TenantID())
+		}
+		if err := tenantA.WithinTransaction(ctx, func(ctx context.Context) error { return nil }); err != nil {
+			t.Errorf("nested transaction for the same tenant: %v", err)
+		}
+		return tenantB.WithinTransaction(ctx, func(ctx context.Context) error { return nil })
+	})
+	if !errors.Is(err, ErrTenantScopeConflict) {
+		t.Fatalf("nested transaction for another tenant error = %v, want ErrTenantScopeConflict", err)
+	}
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type txContextKey struct{}
+
+// GormTransactionManager implements repositories.TransactionManager on top of gorm
+type GormTransactionManager struct {
+	db *gorm.DB
+}
+
+func NewGormTransactionManager(db *gorm.DB) *GormTransactionManager {
+	return &GormTransactionManager{db: db}
+}
+
+// WithinTransaction runs fn in a transaction that is committed when fn returns nil
+// and rolled back otherwise. Nested calls reuse the outer transaction. When ctx is
+// scoped to a tenant the transaction sets app.current_tenant, so row-level
+// security only lets it reach that tenant's rows, and when a
+// TenantConnectionResolver is installed on the database it runs on the tenant's
+// placement as a TenantDB transaction. Otherwise a ctx from AsPlatform runs the
+// transaction as PlatformRole.
+func (m *GormTransactionManager) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txContextKey{}).(*gorm.DB); ok {
+		return fn(ctx)
+	}
+	if tenantID, ok := TenantIDFromContext(ctx); ok {
+		if resolver := resolverOf(m.db); resolver != nil {
+			tenantDB, err := resolver.Resolve(ctx, tenantID)
+			if err != nil {
+				return err
+			}
+			return tenantDB.WithinTransaction(ctx, fn)
+		}
+	}
+
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if tenantID, ok := TenantIDFromContext(ctx); ok {
+			if err := setCurrentTenant(tx, tenantID); err != nil {
+				return err
+			}
+			ctx = context.WithValue(ctx, tenantContextKey{}, tenantID)
+		} else if isPlatform(ctx) {
+			if err := setPlatformRole(tx); err != nil {
+				return err
+			}
+		}
+		return fn(context.WithValue(ctx, txContextKey{}, tx))
+	})
+}
+
+// DBFromContext returns the transaction carried by ctx, or db when there is none.
+// Repository implementations use it so their queries join WithinTransaction.
+// Outside a transaction the tenant scope installed on db runs each query of a
+// tenant scoped ctx, or of one from AsPlatform, in a transaction of its own.
+func DBFromContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txContextKey{}).(*gorm.DB); ok {
+		return tx
+	}
+	return db.WithContext(ctx)
+}
+
+// WithinTenantTransaction runs fn in a transaction of db scoped to the tenant, on
+// the tenant's placement when db has a resolver. Raw SQL on a tenant's tables,
+// which is not routed, runs in one.
+func WithinTenantTransaction(ctx context.Context, db *gorm.DB, tenantID string, fn func(tx *gorm.DB) error) error {
+	if _, ok := ctx.Value(txContextKey{}).(*gorm.DB); !ok {
+		ctx = WithTenantID(ctx, tenantID)
+	}
+	return NewGormTransactionManager(db).WithinTransaction(ctx, func(ctx context.Context) error {
+		return fn(DBFromContext(ctx, db))
+	})
+}
+
+// WithinPlatformTransaction runs fn in a transaction of db as PlatformRole, for
+// statements that work across tenants whether or not ctx is scoped to one. A
+// transaction already carried by ctx is joined as it is.
+func WithinPlatformTransaction(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if tx, ok := ctx.Value(txContextKey{}).(*gorm.DB); ok {
+		return fn(tx)
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := setPlatformRole(tx); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// ForUpdate adds a SELECT ... FOR UPDATE row lock to a query
+func ForUpdate(db *gorm.DB) *gorm.DB {
+	return db.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// ForShare adds a SELECT ... FOR SHARE row lock to a query
+func ForShare(db *gorm.DB) *gorm.DB {
+	return db.Clauses(clause.Locking{Strength: "SHARE"})
+}
@@ -0,0 +1,42 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+)
+
+// FileMailTransport implements services.MailTransport by writing each message
+// to an .eml file, for development and tests
+type FileMailTransport struct {
+	dir string
+}
+
+// NewFileMailTransport creates a new file mail transport
+func NewFileMailTransport(dir string) *FileMailTransport {
+	return &FileMailTransport{dir: dir}
+}
+
+// Send writes the message to the output directory
+func (t *FileMailTransport) Send(ctx context.Context, msg *services.MailMessage) error {
+	body, err := msg.MIME()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), uuid.New().String())
+	if err := os.WriteFile(filepath.Join(t.dir, name), body, 0644); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+)
+
+// BarcodeHandler handles barcode scanning, management and label endpoints
+type BarcodeHandler struct {
+	barcodeService *services.BarcodeService
+	logger         *zap.Logger
+}
+
+// NewBarcodeHandler creates a new barcode handler
+func NewBarcodeHandler(barcodeService *services.BarcodeService, logger *zap.Logger) *BarcodeHandler {
+	return &BarcodeHandler{
+		barcodeService: barcodeService,
+		logger:         logger,
+	}
+}
+
+// AddBarcodeRequest assigns a barcode to a product or variation
+type AddBarcodeRequest struct {
+	VariationID *uuid.UUID `json:"variation_id"`
+	Code        string     `json:"code" validate:"required"`
+	// Symbology is ean13, upca or code128; detected from the code when empty
+	Symbology string `json:"symbology"`
+	IsPrimary bool   `json:"is_primary"`
+}
+
+// Lookup resolves a scanned code to a product or variation
+// @Summary Look Up Scanned Code
+// @Description Resolve a scanned EAN-13, UPC-A, Code128 or GS1-128 code, or a SKU, to a product or variation. GS1-128 deli labels also return the weight and price they carry.
+// @Tags Barcodes
+// @Produce json
+// @Param code query string true "Scanned code"
+// @Success 200 {object} services.ScanResult
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/barcodes/lookup [get]
+func (h *BarcodeHandler) Lookup(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	result, err := h.barcodeService.Lookup(c.Context(), tenantID, c.Query("code"))
+	if err != nil {
+		return h.handleError(c, err, "Failed to look up code")
+	}
+
+	return c.JSON(result)
+}
+
+// GetProductBarcodes lists a product's barcodes
+// @Summary Get Product Barcodes
+// @Description List the barcodes of a product and its variations
+// @Tags Barcodes
+// @Produce json
+// @Param id path string true "Product ID"
+// @Success 200 {array} domain.ProductBarcode
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/products/{id}/barcodes [get]
+func (h *BarcodeHandler) GetProductBarcodes(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	productID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid product ID format",
+		})
+	}
+
+	barcodes, err := h.barcodeService.GetProductBarcodes(c.Context(), tenantID, productID)
+	if err != nil {
+		return h.handleError(c, err, "Failed to get product barcodes")
+	}
+
+	return c.JSON(barcodes)
+}
+
+// AddBarcode assigns a barcode to a product or variation
+// @Summary Add Product Barcode
+// @Description Assign an EAN-13, UPC-A or Code128 barcode to a product or one of its variations. EAN-13 and UPC-A check digits are validated.
+// @Tags Barcodes
+// @Accept json
+// @Produce json
+// @Param id path string true "Product ID"
+// @Param request body AddBarcodeRequest true "Barcode"
+// @Success 201 {object} domain.ProductBarcode
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/products/{id}/barcodes [post]
+func (h *BarcodeHandler) AddBarcode(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	productID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid product ID format",
+		})
+	}
+
+	var req AddBarcodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		h.logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	barcode, err := h.barcodeService.AddBarcode(c.Context(), tenantID, productID, req.VariationID, req.Code, req.Symbology, req.IsPrimary)
+	if err != nil {
+		if errors.Is(err, services.ErrBarcodeInUse) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return h.handleError(c, err, "Failed to add barcode")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(barcode)
+}
+
+// RemoveBarcode deletes a barcode
+// @Summary Remove Barcode
+// @Description Remove a barcode from its product
+// @Tags Barcodes
+// @Param id path string true "Barcode ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/barcodes/{id} [delete]
+func (h *BarcodeHandler) RemoveBarcode(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	barcodeID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid barcode ID format",
+		})
+	}
+
+	if err := h.barcodeService.RemoveBarcode(c.Context(), tenantID, barcodeID); err != nil {
+		return h.handleError(c, err, "Failed to remove barcode")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RenderLabel renders a printable barcode label
+// @Summary Render Barcode Label
+// @Description Render a barcode label with the product name and price as SVG, or the bars alone as PNG
+// @Tags Barcodes
+// @Produce png,image/svg+xml
+// @Param id path string true "Barcode ID"
+// @Param format query string false "png or svg" default(png)
+// @Param scale query int false "Pixels per module, 1 to 10" default(2)
+// @Param currency query string false "Currency code for the price" default(USD)
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/barcodes/{id}/label [get]
+func (h *BarcodeHandler) RenderLabel(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	barcodeID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid barcode ID format",
+		})
+	}
+
+	scale, _ := strconv.Atoi(c.Query("scale", "2"))
+	output, contentType, err := h.barcodeService.RenderLabel(c.Context(), tenantID, barcodeID, c.Query("format", services.BarcodeLabelFormatPNG), scale, c.Query("currency", "USD"))
+	if err != nil {
+		return h.handleError(c, err, "Failed to render barcode label")
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Send(output)
+}
+
+func (h *BarcodeHandler) handleError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, services.ErrBarcodeNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Barcode not found",
+		})
+	case errors.Is(err, services.ErrProductNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Product not found",
+		})
+	case errors.Is(err, services.ErrInvalidBarcode), errors.Is(err, services.ErrInvalidGS1):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	h.logger.Error(message, zap.Error(err))
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
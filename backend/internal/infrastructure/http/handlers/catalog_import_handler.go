@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+)
+
+// CatalogImportHandler handles bulk catalog import and export endpoints
+type CatalogImportHandler struct {
+	catalogImportService *services.CatalogImportService
+	logger               *zap.Logger
+}
+
+// NewCatalogImportHandler creates a new catalog import handler
+func NewCatalogImportHandler(catalogImportService *services.CatalogImportService, logger *zap.Logger) *CatalogImportHandler {
+	return &CatalogImportHandler{
+		catalogImportService: catalogImportService,
+		logger:               logger,
+	}
+}
+
+// StartCatalogImport uploads a catalog file and validates it
+// @Summary Start Catalog Import
+// @Description Upload a CSV or XLSX catalog file. The file is validated and diffed against the catalog in the background (a dry run); poll the import until it is validated, review its diff, then apply it.
+// @Tags Catalog
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "CSV or XLSX file"
+// @Param mapping formData string false "JSON object mapping file headers to catalog fields, e.g. {\"Item Code\":\"sku\"}"
+// @Param location_id formData string false "Stock location imported quantities are counted at; the default location when empty"
+// @Success 202 {object} domain.CatalogImport
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/catalog/imports [post]
+func (h *CatalogImportHandler) StartCatalogImport(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "A catalog file is required",
+		})
+	}
+
+	var mapping map[string]string
+	if raw := c.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid column mapping format",
+			})
+		}
+	}
+
+	var locationID *uuid.UUID
+	if raw := c.FormValue("location_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid location ID format",
+			})
+		}
+		locationID = &id
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		h.logger.Error("Failed to open uploaded file", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid catalog file",
+		})
+	}
+	defer file.Close()
+
+	upload := &services.FileUpload{
+		File:     file,
+		Header:   header,
+		FileName: header.Filename,
+		Size:     header.Size,
+		MimeType: header.Header.Get(fiber.HeaderContentType),
+	}
+	catalogImport, err := h.catalogImportService.StartImport(c.Context(), tenantID, userID, upload, mapping, locationID)
+	if err != nil {
+		return h.handleError(c, err, "Failed to start catalog import")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(catalogImport)
+}
+
+// ListCatalogImports lists the tenant's catalog imports
+// @Summary List Catalog Imports
+// @Description List catalog imports, newest first
+// @Tags Catalog
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} ErrorResponse
+// @Router /api/catalog/imports [get]
+func (h *CatalogImportHandler) ListCatalogImports(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	imports, total, err := h.catalogImportService.ListImports(c.Context(), tenantID, limit, (page-1)*limit)
+	if err != nil {
+		return h.handleError(c, err, "Failed to list catalog imports")
+	}
+
+	return c.JSON(fiber.Map{
+		"imports": imports,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// GetCatalogImport returns a catalog import with its summary and diff
+// @Summary Get Catalog Import
+// @Description Get a catalog import's status, row counts, summary and field-level diff
+// @Tags Catalog
+// @Produce json
+// @Param id path string true "Import ID"
+// @Success 200 {object} domain.CatalogImport
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/catalog/imports/{id} [get]
+func (h *CatalogImportHandler) GetCatalogImport(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	importID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidCatalogImportID(c)
+	}
+
+	catalogImport, err := h.catalogImportService.GetImport(c.Context(), tenantID, importID)
+	if err != nil {
+		return h.handleError(c, err, "Failed to get catalog import")
+	}
+
+	return c.JSON(catalogImport)
+}
+
+// ApplyCatalogImport writes a validated import to the catalog
+// @Summary Apply Catalog Import
+// @Description Apply a validated import in the background. Rows that failed validation are skipped and stay in the error report.
+// @Tags Catalog
+// @Produce json
+// @Param id path string true "Import ID"
+// @Success 202 {object} domain.CatalogImport
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/catalog/imports/{id}/apply [post]
+func (h *CatalogImportHandler) ApplyCatalogImport(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	var userID *uuid.UUID
+	if id, ok := c.Locals("user_id").(uuid.UUID); ok {
+		userID = &id
+	}
+	importID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidCatalogImportID(c)
+	}
+
+	catalogImport, err := h.catalogImportService.ApplyImport(c.Context(), tenantID, importID, userID)
+	if err != nil {
+		return h.handleError(c, err, "Failed to apply catalog import")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(catalogImport)
+}
+
+// GetCatalogImportErrors downloads an import's error report
+// @Summary Download Catalog Import Errors
+// @Description Download a CSV listing each failed row with its SKU, column and error
+// @Tags Catalog
+// @Produce text/csv
+// @Param id path string true "Import ID"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/catalog/imports/{id}/errors [get]
+func (h *CatalogImportHandler) GetCatalogImportErrors(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	importID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidCatalogImportID(c)
+	}
+
+	report, file, err := h.catalogImportService.OpenErrorReport(c.Context(), tenantID, importID)
+	if err != nil {
+		return h.handleError(c, err, "Failed to get catalog import errors")
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv")
+	c.Attachment(file.OriginalName)
+	return c.SendStream(report)
+}
+
+// ExportCatalog downloads the catalog in the import layout
+// @Summary Export Catalog
+// @Description Download every product followed by its variations as CSV or XLSX, in the same columns an import reads
+// @Tags Catalog
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param format query string false "csv or xlsx" default(csv)
+// @Param location_id query string false "Export stock counted at this location instead of the product totals"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/catalog/export [get]
+func (h *CatalogImportHandler) ExportCatalog(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	format := c.Query("format", domain.CatalogFormatCSV)
+
+	var locationID *uuid.UUID
+	if raw := c.Query("location_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid location ID format",
+			})
+		}
+		locationID = &id
+	}
+
+	output, err := h.catalogImportService.Export(c.Context(), tenantID, format, locationID)
+	if err != nil {
+		return h.handleError(c, err, "Failed to export catalog")
+	}
+
+	contentType := "text/csv"
+	if format == domain.CatalogFormatXLSX {
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Attachment(fmt.Sprintf("catalog-%s.%s", time.Now().Format("20060102"), format))
+	return c.Send(output)
+}
+
+func (h *CatalogImportHandler) handleError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, services.ErrCatalogImportNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrStockLocationNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Stock location not found",
+		})
+	case errors.Is(err, services.ErrCatalogImportNotReady):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrInvalidCatalogImport), errors.Is(err, services.ErrInvalidCatalogFile):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	h.logger.Error(message, zap.Error(err))
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+func invalidCatalogImportID(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": "Invalid catalog import ID format",
+	})
+}
@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+)
+
+// CustomerHandler handles customer accounts and loyalty points
+type CustomerHandler struct {
+	customerService *services.CustomerService
+	loyaltyService  *services.LoyaltyService
+	logger          *zap.Logger
+}
+
+// NewCustomerHandler creates a new customer handler
+func NewCustomerHandler(customerService *services.CustomerService, loyaltyService *services.LoyaltyService, logger *zap.Logger) *CustomerHandler {
+	return &CustomerHandler{
+		customerService: customerService,
+		loyaltyService:  loyaltyService,
+		logger:          logger,
+	}
+}
+
+// LoyaltyAdjustmentRequest credits or debits loyalty points by hand
+type LoyaltyAdjustmentRequest struct {
+	Points int    `json:"points" validate:"required"` // Positive to credit, negative to debit
+	Reason string `json:"reason" validate:"required"`
+}
+
+// LoyaltyLedgerResponse is a page of a customer's loyalty ledger
+type LoyaltyLedgerResponse struct {
+	Balance int                          `json:"balance"`
+	Entries []*domain.LoyaltyLedgerEntry `json:"entries"`
+	Total   int64                        `json:"total"`
+	Page    int                          `json:"page"`
+	Limit   int                          `json:"limit"`
+}
+
+// CreateCustomer adds a customer
+// @Summary Create Customer
+// @Description Add a customer. Email and phone must be unique within the tenant.
+// @Tags Customers
+// @Accept json
+// @Produce json
+// @Param request body domain.Customer true "Customer"
+// @Success 201 {object} domain.Customer
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/customers [post]
+func (h *CustomerHandler) CreateCustomer(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	var customer domain.Customer
+	if err := c.BodyParser(&customer); err != nil {
+		h.logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+	customer.TenantID = tenantID
+
+	if err := h.customerService.CreateCustomer(c.Context(), &customer); err != nil {
+		return h.handleError(c, err, "Failed to create customer")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(customer)
+}
+
+// ListCustomers lists the tenant's customers
+// @Summary List Customers
+// @Description List customers, optionally searching by name, email or phone
+// @Tags Customers
+// @Produce json
+// @Param search query string false "Name, email or phone"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} ErrorResponse
+// @Router /api/customers [get]
+func (h *CustomerHandler) ListCustomers(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	filter := &domain.CustomerFilter{
+		Search: c.Query("search"),
+		Page:   page,
+		Limit:  limit,
+	}
+
+	customers, total, err := h.customerService.ListCustomers(c.Context(), tenantID, filter)
+	if err != nil {
+		return h.handleError(c, err, "Failed to list customers")
+	}
+
+	return c.JSON(fiber.Map{
+		"customers": customers,
+		"total":     total,
+		"page":      page,
+		"limit":     limit,
+	})
+}
+
+// LookupCustomer finds a customer by email or phone
+// @Summary Look Up Customer
+// @Description Find a customer by email or phone at the till
+// @Tags Customers
+// @Produce json
+// @Param email query string false "Email"
+// @Param phone query string false "Phone"
+// @Success 200 {object} domain.Customer
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/customers/lookup [get]
+func (h *CustomerHandler) LookupCustomer(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	customer, err := h.customerService.FindCustomer(c.Context(), tenantID, c.Query("email"), c.Query("phone"))
+	if err != nil {
+		return h.handleError(c, err, "Failed to look up customer")
+	}
+
+	return c.JSON(customer)
+}
+
+// GetCustomer returns a customer
+// @Summary Get Customer
+// @Description Get a customer with their loyalty balance and purchase totals
+// @Tags Customers
+// @Produce json
+// @Param id path string true "Customer ID"
+// @Success 200 {object} domain.Customer
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/customers/{id} [get]
+func (h *CustomerHandler) GetCustomer(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	customerID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidCustomerID(c)
+	}
+
+	customer, err := h.customerService.GetCustomer(c.Context(), tenantID, customerID)
+	if err != nil {
+		return h.handleError(c, err, "Failed to get customer")
+	}
+
+	return c.JSON(customer)
+}
+
+// UpdateCustomer changes a customer's details
+// @Summary Update Customer
+// @Description Update a customer's contact details. Loyalty balances and purchase totals cannot be set directly.
+// @Tags Customers
+// @Accept json
+// @Produce json
+// @Param id path string true "Customer ID"
+// @Param request body domain.Customer true "Customer"
+// @Success 200 {object} domain.Customer
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/customers/{id} [put]
+func (h *CustomerHandler) UpdateCustomer(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	customerID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidCustomerID(c)
+	}
+
+	var customer domain.Customer
+	if err := c.BodyParser(&customer); err != nil {
+		h.logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+	customer.ID = customerID
+
+	if err := h.customerService.UpdateCustomer(c.Context(), tenantID, &customer); err != nil {
+		return h.handleError(c, err, "Failed to update customer")
+	}
+
+	return c.JSON(customer)
+}
+
+// DeleteCustomer removes a customer
+// @Summary Delete Customer
+// @Description Delete a customer. Past orders keep their customer link.
+// @Tags Customers
+// @Param id path string true "Customer ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/customers/{id} [delete]
+func (h *CustomerHandler) DeleteCustomer(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	customerID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidCustomerID(c)
+	}
+
+	if err := h.customerService.DeleteCustomer(c.Context(), tenantID, customerID); err != nil {
+		return h.handleError(c, err, "Failed to delete customer")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetCustomerOrders returns a customer's purchase history
+// @Summary Get Customer Orders
+// @Description List the orders placed by a customer
+// @Tags Customers
+// @Produce json
+// @Param id path string true "Customer ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/customers/{id}/orders [get]
+func (h *CustomerHandler) GetCustomerOrders(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	customerID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidCustomerID(c)
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	filter := &domain.OrderFilter{Page: page, Limit: limit, SortBy: "created_at", SortOrder: "desc"}
+
+	orders, total, err := h.customerService.GetPurchaseHistory(c.Context(), tenantID, customerID, filter)
+	if err != nil {
+		return h.handleError(c, err, "Failed to get customer orders")
+	}
+
+	return c.JSON(fiber.Map{
+		"orders": orders,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+// GetCustomerWishlists returns a customer's wishlists
+// @Summary Get Customer Wishlists
+// @Description List the wishlists linked to a customer
+// @Tags Customers
+// @Produce json
+// @Param id path string true "Customer ID"
+// @Success 200 {array} domain.Wishlist
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/customers/{id}/wishlists [get]
+func (h *CustomerHandler) GetCustomerWishlists(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	customerID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidCustomerID(c)
+	}
+
+	wishlists, err := h.customerService.GetWishlists(c.Context(), tenantID, customerID)
+	if err != nil {
+		return h.handleError(c, err, "Failed to get customer wishlists")
+	}
+
+	return c.JSON(wishlists)
+}
+
+// GetLoyaltyLedger returns a customer's loyalty balance and ledger
+// @Summary Get Loyalty Ledger
+// @Description List a customer's loyalty point movements, newest first
+// @Tags Customers
+// @Produce json
+// @Param id path string true "Customer ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(50)
+// @Success 200 {object} LoyaltyLedgerResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/customers/{id}/loyalty [get]
+func (h *CustomerHandler) GetLoyaltyLedger(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	customerID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidCustomerID(c)
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	customer, err := h.customerService.GetCustomer(c.Context(), tenantID, customerID)
+	if err != nil {
+		return h.handleError(c, err, "Failed to get loyalty ledger")
+	}
+	entries, total, err := h.loyaltyService.GetLedger(c.Context(), tenantID, customerID, limit, (page-1)*limit)
+	if err != nil {
+		return h.handleError(c, err, "Failed to get loyalty ledger")
+	}
+
+	return c.JSON(LoyaltyLedgerResponse{
+		Balance: customer.LoyaltyPoints,
+		Entries: entries,
+		Total:   total,
+		Page:    page,
+		Limit:   limit,
+	})
+}
+
+// AdjustLoyaltyPoints credits or debits a customer's points by hand
+// @Summary Adjust Loyalty Points
+// @Description Credit or debit a customer's loyalty points with a reason, e.g. as a goodwill gesture
+// @Tags Customers
+// @Accept json
+// @Produce json
+// @Param id path string true "Customer ID"
+// @Param request body LoyaltyAdjustmentRequest true "Adjustment"
+// @Success 201 {object} domain.LoyaltyLedgerEntry
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/customers/{id}/loyalty/adjustments [post]
+func (h *CustomerHandler) AdjustLoyaltyPoints(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	var userID *uuid.UUID
+	if id, ok := c.Locals("user_id").(uuid.UUID); ok {
+		userID = &id
+	}
+	customerID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidCustomerID(c)
+	}
+
+	var req LoyaltyAdjustmentRequest
+	if err := c.BodyParser(&req); err != nil {
+		h.logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	entry, err := h.loyaltyService.AdjustPoints(c.Context(), tenantID, customerID, req.Points, req.Reason, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrInsufficientPoints) || errors.Is(err, services.ErrCustomerNotFound) {
+			return h.handleError(c, err, "Failed to adjust loyalty points")
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(entry)
+}
+
+func (h *CustomerHandler) handleError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, services.ErrCustomerNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Customer not found",
+		})
+	case errors.Is(err, services.ErrCustomerExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrInvalidCustomer), errors.Is(err, services.ErrInsufficientPoints), errors.Is(err, services.ErrLoyaltyDisabled):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	h.logger.Error(message, zap.Error(err))
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+func invalidCustomerID(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": "Invalid customer ID format",
+	})
+}
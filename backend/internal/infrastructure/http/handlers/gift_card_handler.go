@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+)
+
+// GiftCardHandler handles gift card and store credit endpoints
+type GiftCardHandler struct {
+	giftCardService *services.GiftCardService
+	logger          *zap.Logger
+}
+
+// NewGiftCardHandler creates a new gift card handler
+func NewGiftCardHandler(giftCardService *services.GiftCardService, logger *zap.Logger) *GiftCardHandler {
+	return &GiftCardHandler{
+		giftCardService: giftCardService,
+		logger:          logger,
+	}
+}
+
+// IssueGiftCardRequest issues a gift card or store credit
+type IssueGiftCardRequest struct {
+	Code       string     `json:"code"` // Generated when empty
+	Type       string     `json:"type"` // gift_card (default) or store_credit
+	Amount     float64    `json:"amount" validate:"required,gt=0"`
+	Currency   string     `json:"currency"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CustomerID *uuid.UUID `json:"customer_id"`
+	Note       string     `json:"note"`
+}
+
+// GiftCardStatusRequest enables or disables a gift card
+type GiftCardStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=active disabled"`
+}
+
+// GiftCardAdjustmentRequest credits or debits a gift card by hand
+type GiftCardAdjustmentRequest struct {
+	Amount float64 `json:"amount" validate:"required"` // Positive to credit, negative to debit
+	Reason string  `json:"reason" validate:"required"`
+}
+
+// IssueGiftCard issues a gift card or store credit
+// @Summary Issue Gift Card
+// @Description Issue a gift card or store credit with an opening balance. A code is generated when none is given.
+// @Tags Gift Cards
+// @Accept json
+// @Produce json
+// @Param request body IssueGiftCardRequest true "Gift card"
+// @Success 201 {object} domain.GiftCard
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/gift-cards [post]
+func (h *GiftCardHandler) IssueGiftCard(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	var userID *uuid.UUID
+	if id, ok := c.Locals("user_id").(uuid.UUID); ok {
+		userID = &id
+	}
+
+	var req IssueGiftCardRequest
+	if err := c.BodyParser(&req); err != nil {
+		h.logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	card := &domain.GiftCard{
+		TenantID:       tenantID,
+		Code:           req.Code,
+		Type:           req.Type,
+		CustomerID:     req.CustomerID,
+		InitialBalance: req.Amount,
+		Currency:       req.Currency,
+		ExpiresAt:      req.ExpiresAt,
+		Note:           req.Note,
+	}
+	if err := h.giftCardService.IssueGiftCard(c.Context(), card, userID); err != nil {
+		return h.handleError(c, err, "Failed to issue gift card")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(card)
+}
+
+// ListGiftCards lists the tenant's gift cards and store credit
+// @Summary List Gift Cards
+// @Description List gift cards and store credit accounts
+// @Tags Gift Cards
+// @Produce json
+// @Param type query string false "gift_card or store_credit"
+// @Param status query string false "active or disabled"
+// @Param customer_id query string false "Customer ID"
+// @Param search query string false "Code"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/gift-cards [get]
+func (h *GiftCardHandler) ListGiftCards(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	filter := &domain.GiftCardFilter{
+		Type:   c.Query("type"),
+		Status: c.Query("status"),
+		Search: services.NormalizeGiftCardCode(c.Query("search")),
+		Page:   page,
+		Limit:  limit,
+	}
+	if customerID := c.Query("customer_id"); customerID != "" {
+		id, err := uuid.Parse(customerID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid customer ID format",
+			})
+		}
+		filter.CustomerID = &id
+	}
+
+	cards, total, err := h.giftCardService.ListGiftCards(c.Context(), tenantID, filter)
+	if err != nil {
+		return h.handleError(c, err, "Failed to list gift cards")
+	}
+
+	return c.JSON(fiber.Map{
+		"gift_cards": cards,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+	})
+}
+
+// LookupGiftCard checks a gift card's balance by its code
+// @Summary Look Up Gift Card
+// @Description Find a gift card or store credit by the code printed on it, e.g. to check its balance at the till
+// @Tags Gift Cards
+// @Produce json
+// @Param code query string true "Gift card code"
+// @Success 200 {object} domain.GiftCard
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/gift-cards/lookup [get]
+func (h *GiftCardHandler) LookupGiftCard(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	card, err := h.giftCardService.GetGiftCardByCode(c.Context(), tenantID, c.Query("code"))
+	if err != nil {
+		return h.handleError(c, err, "Failed to look up gift card")
+	}
+
+	return c.JSON(card)
+}
+
+// GetGiftCard returns a gift card
+// @Summary Get Gift Card
+// @Description Get a gift card or store credit account with its balance
+// @Tags Gift Cards
+// @Produce json
+// @Param id path string true "Gift card ID"
+// @Success 200 {object} domain.GiftCard
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/gift-cards/{id} [get]
+func (h *GiftCardHandler) GetGiftCard(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	cardID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidGiftCardID(c)
+	}
+
+	card, err := h.giftCardService.GetGiftCard(c.Context(), tenantID, cardID)
+	if err != nil {
+		return h.handleError(c, err, "Failed to get gift card")
+	}
+
+	return c.JSON(card)
+}
+
+// SetGiftCardStatus enables or disables a gift card
+// @Summary Set Gift Card Status
+// @Description Disable a lost or stolen card, or enable it again. A disabled card keeps its balance.
+// @Tags Gift Cards
+// @Accept json
+// @Produce json
+// @Param id path string true "Gift card ID"
+// @Param request body GiftCardStatusRequest true "Status"
+// @Success 200 {object} domain.GiftCard
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/gift-cards/{id}/status [put]
+func (h *GiftCardHandler) SetGiftCardStatus(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	cardID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidGiftCardID(c)
+	}
+
+	var req GiftCardStatusRequest
+	if err := c.BodyParser(&req); err != nil {
+		h.logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	card, err := h.giftCardService.SetStatus(c.Context(), tenantID, cardID, req.Status)
+	if err != nil {
+		return h.handleError(c, err, "Failed to update gift card")
+	}
+
+	return c.JSON(card)
+}
+
+// AdjustGiftCardBalance credits or debits a gift card by hand
+// @Summary Adjust Gift Card Balance
+// @Description Credit or debit a gift card or store credit with a reason
+// @Tags Gift Cards
+// @Accept json
+// @Produce json
+// @Param id path string true "Gift card ID"
+// @Param request body GiftCardAdjustmentRequest true "Adjustment"
+// @Success 201 {object} domain.GiftCardTransaction
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/gift-cards/{id}/adjustments [post]
+func (h *GiftCardHandler) AdjustGiftCardBalance(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	var userID *uuid.UUID
+	if id, ok := c.Locals("user_id").(uuid.UUID); ok {
+		userID = &id
+	}
+	cardID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidGiftCardID(c)
+	}
+
+	var req GiftCardAdjustmentRequest
+	if err := c.BodyParser(&req); err != nil {
+		h.logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	entry, err := h.giftCardService.AdjustBalance(c.Context(), tenantID, cardID, req.Amount, req.Reason, userID)
+	if err != nil {
+		return h.handleError(c, err, "Failed to adjust gift card balance")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(entry)
+}
+
+// GetGiftCardTransactions returns a gift card's balance movements
+// @Summary Get Gift Card Transactions
+// @Description List a gift card's issues, payments, refunds and adjustments, newest first
+// @Tags Gift Cards
+// @Produce json
+// @Param id path string true "Gift card ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(50)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/gift-cards/{id}/transactions [get]
+func (h *GiftCardHandler) GetGiftCardTransactions(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	cardID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidGiftCardID(c)
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	transactions, total, err := h.giftCardService.GetTransactions(c.Context(), tenantID, cardID, limit, (page-1)*limit)
+	if err != nil {
+		return h.handleError(c, err, "Failed to get gift card transactions")
+	}
+
+	return c.JSON(fiber.Map{
+		"transactions": transactions,
+		"total":        total,
+		"page":         page,
+		"limit":        limit,
+	})
+}
+
+func (h *GiftCardHandler) handleError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, services.ErrGiftCardNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Gift card not found",
+		})
+	case errors.Is(err, services.ErrGiftCardExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrInvalidGiftCard), errors.Is(err, services.ErrGiftCardEmpty):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	h.logger.Error(message, zap.Error(err))
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+func invalidGiftCardID(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": "Invalid gift card ID format",
+	})
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+)
+
+// PriceListHandler handles price list endpoints
+type PriceListHandler struct {
+	priceListService *services.PriceListService
+	logger           *zap.Logger
+}
+
+// NewPriceListHandler creates a new price list handler
+func NewPriceListHandler(priceListService *services.PriceListService, logger *zap.Logger) *PriceListHandler {
+	return &PriceListHandler{
+		priceListService: priceListService,
+		logger:           logger,
+	}
+}
+
+// CreatePriceList adds a price list
+// @Summary Create Price List
+// @Description Add a price list for customer groups, locations or a schedule such as a happy hour. Add its prices as rules.
+// @Tags Price Lists
+// @Accept json
+// @Produce json
+// @Param request body domain.PriceList true "Price list"
+// @Success 201 {object} domain.PriceList
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/price-lists [post]
+func (h *PriceListHandler) CreatePriceList(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	var priceList domain.PriceList
+	if err := c.BodyParser(&priceList); err != nil {
+		h.logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+	priceList.TenantID = tenantID
+
+	if err := h.priceListService.CreatePriceList(c.Context(), &priceList); err != nil {
+		return h.handleError(c, err, "Failed to create price list")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(priceList)
+}
+
+// ListPriceLists lists the tenant's price lists
+// @Summary List Price Lists
+// @Description List price lists
+// @Tags Price Lists
+// @Produce json
+// @Param name query string false "Name"
+// @Param is_active query bool false "Active lists only"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} ErrorResponse
+// @Router /api/price-lists [get]
+func (h *PriceListHandler) ListPriceLists(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	filter := &domain.PriceListFilter{
+		Name:  c.Query("name"),
+		Page:  page,
+		Limit: limit,
+	}
+	if isActive := c.Query("is_active"); isActive != "" {
+		active := isActive == "true"
+		filter.IsActive = &active
+	}
+
+	priceLists, total, err := h.priceListService.ListPriceLists(c.Context(), tenantID, filter)
+	if err != nil {
+		return h.handleError(c, err, "Failed to list price lists")
+	}
+
+	return c.JSON(fiber.Map{
+		"price_lists": priceLists,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+	})
+}
+
+// GetPriceList returns a price list with its rules
+// @Summary Get Price List
+// @Description Get a price list with its rules
+// @Tags Price Lists
+// @Produce json
+// @Param id path string true "Price list ID"
+// @Success 200 {object} domain.PriceList
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/price-lists/{id} [get]
+func (h *PriceListHandler) GetPriceList(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	priceListID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidPriceListID(c)
+	}
+
+	priceList, err := h.priceListService.GetPriceList(c.Context(), tenantID, priceListID)
+	if err != nil {
+		return h.handleError(c, err, "Failed to get price list")
+	}
+
+	return c.JSON(priceList)
+}
+
+// UpdatePriceList changes a price list
+// @Summary Update Price List
+// @Description Change a price list's name, priority, customer groups, locations or schedule
+// @Tags Price Lists
+// @Accept json
+// @Produce json
+// @Param id path string true "Price list ID"
+// @Param request body domain.PriceList true "Price list"
+// @Success 200 {object} domain.PriceList
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/price-lists/{id} [put]
+func (h *PriceListHandler) UpdatePriceList(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	priceListID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidPriceListID(c)
+	}
+
+	var priceList domain.PriceList
+	if err := c.BodyParser(&priceList); err != nil {
+		h.logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+	priceList.ID = priceListID
+
+	if err := h.priceListService.UpdatePriceList(c.Context(), tenantID, &priceList); err != nil {
+		return h.handleError(c, err, "Failed to update price list")
+	}
+
+	return c.JSON(priceList)
+}
+
+// DeletePriceList removes a price list
+// @Summary Delete Price List
+// @Description Delete a price list and its rules
+// @Tags Price Lists
+// @Param id path string true "Price list ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/price-lists/{id} [delete]
+func (h *PriceListHandler) DeletePriceList(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	priceListID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidPriceListID(c)
+	}
+
+	if err := h.priceListService.DeletePriceList(c.Context(), tenantID, priceListID); err != nil {
+		return h.handleError(c, err, "Failed to delete price list")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// AddPriceListRule adds a rule to a price list
+// @Summary Add Price List Rule
+// @Description Price a variation, product, category or everything: a fixed price, a percentage off or an amount off, from a minimum quantity
+// @Tags Price Lists
+// @Accept json
+// @Produce json
+// @Param id path string true "Price list ID"
+// @Param request body domain.PriceListRule true "Rule"
+// @Success 201 {object} domain.PriceListRule
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/price-lists/{id}/rules [post]
+func (h *PriceListHandler) AddPriceListRule(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	priceListID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidPriceListID(c)
+	}
+
+	var rule domain.PriceListRule
+	if err := c.BodyParser(&rule); err != nil {
+		h.logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+	rule.PriceListID = priceListID
+
+	if err := h.priceListService.AddRule(c.Context(), tenantID, &rule); err != nil {
+		return h.handleError(c, err, "Failed to add price list rule")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// UpdatePriceListRule changes a price list rule
+// @Summary Update Price List Rule
+// @Description Change a rule's target, minimum quantity or price
+// @Tags Price Lists
+// @Accept json
+// @Produce json
+// @Param id path string true "Price list ID"
+// @Param ruleId path string true "Rule ID"
+// @Param request body domain.PriceListRule true "Rule"
+// @Success 200 {object} domain.PriceListRule
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/price-lists/{id}/rules/{ruleId} [put]
+func (h *PriceListHandler) UpdatePriceListRule(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	priceListID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidPriceListID(c)
+	}
+	ruleID, err := uuid.Parse(c.Params("ruleId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid rule ID format",
+		})
+	}
+
+	var rule domain.PriceListRule
+	if err := c.BodyParser(&rule); err != nil {
+		h.logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+	rule.ID = ruleID
+	rule.PriceListID = priceListID
+
+	if err := h.priceListService.UpdateRule(c.Context(), tenantID, &rule); err != nil {
+		return h.handleError(c, err, "Failed to update price list rule")
+	}
+
+	return c.JSON(rule)
+}
+
+// DeletePriceListRule removes a rule from a price list
+// @Summary Delete Price List Rule
+// @Description Delete a price list rule
+// @Tags Price Lists
+// @Param id path string true "Price list ID"
+// @Param ruleId path string true "Rule ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/price-lists/{id}/rules/{ruleId} [delete]
+func (h *PriceListHandler) DeletePriceListRule(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	priceListID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidPriceListID(c)
+	}
+	ruleID, err := uuid.Parse(c.Params("ruleId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid rule ID format",
+		})
+	}
+
+	if err := h.priceListService.DeleteRule(c.Context(), tenantID, priceListID, ruleID); err != nil {
+		return h.handleError(c, err, "Failed to delete price list rule")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *PriceListHandler) handleError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, services.ErrPriceListNotFound), errors.Is(err, services.ErrPriceRuleNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrInvalidPriceList):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	h.logger.Error(message, zap.Error(err))
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+func invalidPriceListID(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": "Invalid price list ID format",
+	})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+)
+
+// ReceiptHandler handles receipt rendering and reprint endpoints
+type ReceiptHandler struct {
+	receiptService *services.ReceiptService
+	logger         *zap.Logger
+}
+
+// NewReceiptHandler creates a new receipt handler
+func NewReceiptHandler(receiptService *services.ReceiptService, logger *zap.Logger) *ReceiptHandler {
+	return &ReceiptHandler{
+		receiptService: receiptService,
+		logger:         logger,
+	}
+}
+
+// RenderReceipt renders a receipt without counting it as printed
+// @Summary Render Receipt
+// @Description Render a receipt as HTML, PDF or an ESC/POS byte stream
+// @Tags Receipts
+// @Produce html,application/pdf,application/octet-stream
+// @Param id path string true "Receipt ID"
+// @Param format query string false "html, pdf or escpos" default(html)
+// @Param width query int false "Thermal paper width in mm for escpos (58 or 80)" default(80)
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/receipts/{id} [get]
+func (h *ReceiptHandler) RenderReceipt(c *fiber.Ctx) error {
+	return h.renderReceipt(c, false)
+}
+
+// ReprintReceipt renders a receipt again and increments its print count
+// @Summary Reprint Receipt
+// @Description Reprint a receipt as HTML, PDF or an ESC/POS byte stream and increment its print count
+// @Tags Receipts
+// @Produce html,application/pdf,application/octet-stream
+// @Param id path string true "Receipt ID"
+// @Param format query string false "html, pdf or escpos" default(escpos)
+// @Param width query int false "Thermal paper width in mm for escpos (58 or 80)" default(80)
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/receipts/{id}/reprint [post]
+func (h *ReceiptHandler) ReprintReceipt(c *fiber.Ctx) error {
+	return h.renderReceipt(c, true)
+}
+
+func (h *ReceiptHandler) renderReceipt(c *fiber.Ctx, reprint bool) error {
+	tenantID := c.Locals("tenant_id").(string)
+	receiptIDStr := c.Params("id")
+
+	receiptID, err := uuid.Parse(receiptIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid receipt ID format",
+		})
+	}
+
+	defaultFormat := services.ReceiptFormatHTML
+	if reprint {
+		defaultFormat = services.ReceiptFormatESCPOS
+	}
+	format := c.Query("format", defaultFormat)
+	width, _ := strconv.Atoi(c.Query("width", strconv.Itoa(services.PaperWidth80mm)))
+	if width != services.PaperWidth58mm && width != services.PaperWidth80mm {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Paper width must be 58 or 80",
+		})
+	}
+
+	var output []byte
+	var contentType string
+	if reprint {
+		output, contentType, err = h.receiptService.Reprint(c.Context(), tenantID, receiptID, format, width)
+	} else {
+		output, contentType, err = h.receiptService.Render(c.Context(), tenantID, receiptID, format, width)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrReceiptNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Receipt not found",
+			})
+		}
+		h.logger.Error("Failed to render receipt", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to render receipt",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Send(output)
+}
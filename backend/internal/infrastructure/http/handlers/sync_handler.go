@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+)
+
+// SyncHandler handles offline POS terminal sync
+type SyncHandler struct {
+	syncService *services.SyncService
+	logger      *zap.Logger
+}
+
+// NewSyncHandler creates a new sync handler
+func NewSyncHandler(syncService *services.SyncService, logger *zap.Logger) *SyncHandler {
+	return &SyncHandler{
+		syncService: syncService,
+		logger:      logger,
+	}
+}
+
+// Sync applies a terminal's offline batch and returns catalog changes
+// @Summary Sync POS Terminal
+// @Description Upload orders, payments and stock movements made offline, keyed by client-generated IDs, and download catalog changes since the terminal's cursor. Re-sending a batch does not apply it twice.
+// @Tags POS Sync
+// @Accept json
+// @Produce json
+// @Param request body services.SyncRequest true "Offline batch and sync cursor"
+// @Success 200 {object} services.SyncResult
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/pos/sync [post]
+func (h *SyncHandler) Sync(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	var userID *uuid.UUID
+	if id, ok := c.Locals("user_id").(uuid.UUID); ok {
+		userID = &id
+	}
+
+	var req services.SyncRequest
+	if err := c.BodyParser(&req); err != nil {
+		h.logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	result, err := h.syncService.Sync(c.Context(), tenantID, userID, &req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSyncRequest) || errors.Is(err, services.ErrInvalidSyncCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		h.logger.Error("Failed to sync terminal", zap.String("terminal_id", req.TerminalID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to sync terminal",
+		})
+	}
+
+	return c.JSON(result)
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/auth"
+)
+
+// TenantAuth validates the bearer token of a request and stores its tenant and
+// user in the tenant_id and user_id locals the handlers read. Handlers pass the
+// request context on to services, and the database scopes their queries to the
+// tenant stored here. Requests without a valid token, or whose token names no
+// tenant, are refused.
+func TenantAuth(validator *auth.KeycloakValidator) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := c.Get(fiber.HeaderAuthorization)
+		if header == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Missing authorization token",
+			})
+		}
+
+		claims, err := validator.ValidateToken(header)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid authorization token",
+			})
+		}
+
+		userID, err := uuid.Parse(claims.Subject)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid token subject",
+			})
+		}
+		if claims.TenantID == "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Token is not scoped to a tenant",
+			})
+		}
+
+		c.Locals("tenant_id", claims.TenantID)
+		c.Locals("user_id", userID)
+		return c.Next()
+	}
+}
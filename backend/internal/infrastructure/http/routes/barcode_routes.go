@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/http/handlers"
+)
+
+// SetupBarcodeRoutes sets up barcode scanning, management and label routes
+func SetupBarcodeRoutes(
+	app *fiber.App,
+	barcodeService *services.BarcodeService,
+	logger *zap.Logger,
+) {
+	// Create handler
+	handler := handlers.NewBarcodeHandler(barcodeService, logger)
+
+	// API routes group
+	api := app.Group("/api")
+
+	// Barcode routes
+	barcodes := api.Group("/barcodes")
+	{
+		barcodes.Get("/lookup", handler.Lookup)         // GET /api/barcodes/lookup?code=
+		barcodes.Get("/:id/label", handler.RenderLabel) // GET /api/barcodes/:id/label?format=png|svg&scale=2
+		barcodes.Delete("/:id", handler.RemoveBarcode)  // DELETE /api/barcodes/:id
+	}
+
+	// Product barcode routes
+	products := api.Group("/products")
+	{
+		products.Get("/:id/barcodes", handler.GetProductBarcodes) // GET /api/products/:id/barcodes
+		products.Post("/:id/barcodes", handler.AddBarcode)        // POST /api/products/:id/barcodes
+	}
+}
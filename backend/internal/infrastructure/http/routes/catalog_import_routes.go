@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/http/handlers"
+)
+
+// SetupCatalogImportRoutes sets up bulk catalog import and export routes
+func SetupCatalogImportRoutes(app *fiber.App, catalogImportService *services.CatalogImportService, logger *zap.Logger) {
+	// Create handler
+	handler := handlers.NewCatalogImportHandler(catalogImportService, logger)
+
+	// API routes group
+	api := app.Group("/api")
+
+	// Catalog routes
+	catalog := api.Group("/catalog")
+	{
+		catalog.Get("/export", handler.ExportCatalog)                      // GET /api/catalog/export?format=csv|xlsx&location_id=
+		catalog.Post("/imports", handler.StartCatalogImport)               // POST /api/catalog/imports
+		catalog.Get("/imports", handler.ListCatalogImports)                // GET /api/catalog/imports
+		catalog.Get("/imports/:id", handler.GetCatalogImport)              // GET /api/catalog/imports/:id
+		catalog.Post("/imports/:id/apply", handler.ApplyCatalogImport)     // POST /api/catalog/imports/:id/apply
+		catalog.Get("/imports/:id/errors", handler.GetCatalogImportErrors) // GET /api/catalog/imports/:id/errors
+	}
+}
@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/http/handlers"
+)
+
+// SetupCustomerRoutes sets up customer and loyalty routes
+func SetupCustomerRoutes(
+	app *fiber.App,
+	customerService *services.CustomerService,
+	loyaltyService *services.LoyaltyService,
+	logger *zap.Logger,
+) {
+	// Create handler
+	handler := handlers.NewCustomerHandler(customerService, loyaltyService, logger)
+
+	// API routes group
+	api := app.Group("/api")
+
+	// Customer routes
+	customers := api.Group("/customers")
+	{
+		customers.Post("/", handler.CreateCustomer)                             // POST /api/customers
+		customers.Get("/", handler.ListCustomers)                               // GET /api/customers?search=
+		customers.Get("/lookup", handler.LookupCustomer)                        // GET /api/customers/lookup?email=&phone=
+		customers.Get("/:id", handler.GetCustomer)                              // GET /api/customers/:id
+		customers.Put("/:id", handler.UpdateCustomer)                           // PUT /api/customers/:id
+		customers.Delete("/:id", handler.DeleteCustomer)                        // DELETE /api/customers/:id
+		customers.Get("/:id/orders", handler.GetCustomerOrders)                 // GET /api/customers/:id/orders
+		customers.Get("/:id/wishlists", handler.GetCustomerWishlists)           // GET /api/customers/:id/wishlists
+		customers.Get("/:id/loyalty", handler.GetLoyaltyLedger)                 // GET /api/customers/:id/loyalty
+		customers.Post("/:id/loyalty/adjustments", handler.AdjustLoyaltyPoints) // POST /api/customers/:id/loyalty/adjustments
+	}
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/http/handlers"
+)
+
+// SetupGiftCardRoutes sets up gift card and store credit routes
+func SetupGiftCardRoutes(app *fiber.App, giftCardService *services.GiftCardService, logger *zap.Logger) {
+	// Create handler
+	handler := handlers.NewGiftCardHandler(giftCardService, logger)
+
+	// API routes group
+	api := app.Group("/api")
+
+	// Gift card routes
+	giftCards := api.Group("/gift-cards")
+	{
+		giftCards.Post("/", handler.IssueGiftCard)                          // POST /api/gift-cards
+		giftCards.Get("/", handler.ListGiftCards)                           // GET /api/gift-cards?type=&status=&customer_id=
+		giftCards.Get("/lookup", handler.LookupGiftCard)                    // GET /api/gift-cards/lookup?code=
+		giftCards.Get("/:id", handler.GetGiftCard)                          // GET /api/gift-cards/:id
+		giftCards.Put("/:id/status", handler.SetGiftCardStatus)             // PUT /api/gift-cards/:id/status
+		giftCards.Post("/:id/adjustments", handler.AdjustGiftCardBalance)   // POST /api/gift-cards/:id/adjustments
+		giftCards.Get("/:id/transactions", handler.GetGiftCardTransactions) // GET /api/gift-cards/:id/transactions
+	}
+}
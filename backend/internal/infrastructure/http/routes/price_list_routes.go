@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/http/handlers"
+)
+
+// SetupPriceListRoutes sets up price list routes
+func SetupPriceListRoutes(app *fiber.App, priceListService *services.PriceListService, logger *zap.Logger) {
+	// Create handler
+	handler := handlers.NewPriceListHandler(priceListService, logger)
+
+	// API routes group
+	api := app.Group("/api")
+
+	// Price list routes
+	priceLists := api.Group("/price-lists")
+	{
+		priceLists.Post("/", handler.CreatePriceList)                        // POST /api/price-lists
+		priceLists.Get("/", handler.ListPriceLists)                          // GET /api/price-lists?name=&is_active=
+		priceLists.Get("/:id", handler.GetPriceList)                         // GET /api/price-lists/:id
+		priceLists.Put("/:id", handler.UpdatePriceList)                      // PUT /api/price-lists/:id
+		priceLists.Delete("/:id", handler.DeletePriceList)                   // DELETE /api/price-lists/:id
+		priceLists.Post("/:id/rules", handler.AddPriceListRule)              // POST /api/price-lists/:id/rules
+		priceLists.Put("/:id/rules/:ruleId", handler.UpdatePriceListRule)    // PUT /api/price-lists/:id/rules/:ruleId
+		priceLists.Delete("/:id/rules/:ruleId", handler.DeletePriceListRule) // DELETE /api/price-lists/:id/rules/:ruleId
+	}
+}
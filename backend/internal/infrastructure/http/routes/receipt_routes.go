@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/http/handlers"
+)
+
+// SetupReceiptRoutes sets up receipt rendering and reprint routes
+func SetupReceiptRoutes(
+	app *fiber.App,
+	receiptService *services.ReceiptService,
+	logger *zap.Logger,
+) {
+	// Create handler
+	handler := handlers.NewReceiptHandler(receiptService, logger)
+
+	// API routes group
+	api := app.Group("/api")
+
+	// Receipt routes
+	receipts := api.Group("/receipts")
+	{
+		receipts.Get("/:id", handler.RenderReceipt)           // GET /api/receipts/:id?format=html|pdf|escpos&width=58|80
+		receipts.Post("/:id/reprint", handler.ReprintReceipt) // POST /api/receipts/:id/reprint
+	}
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/http/handlers"
+)
+
+// SetupSyncRoutes sets up the offline POS terminal sync route
+func SetupSyncRoutes(
+	app *fiber.App,
+	syncService *services.SyncService,
+	logger *zap.Logger,
+) {
+	// Create handler
+	handler := handlers.NewSyncHandler(syncService, logger)
+
+	// API routes group
+	api := app.Group("/api")
+
+	// POS sync routes
+	pos := api.Group("/pos")
+	{
+		pos.Post("/sync", handler.Sync) // POST /api/pos/sync
+	}
+}
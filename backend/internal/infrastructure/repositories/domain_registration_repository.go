@@ -8,6 +8,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 )
 
 // DomainRegistrationRepositoryImpl implements DomainRegistrationRepository
@@ -20,12 +21,12 @@ func NewDomainRegistrationRepository(db *gorm.DB) *DomainRegistrationRepositoryI
 }
 
 func (r *DomainRegistrationRepositoryImpl) Create(ctx context.Context, registration *domain.DomainRegistration) error {
-	return r.db.WithContext(ctx).Create(registration).Error
+	return database.DBFromContext(ctx, r.db).Create(registration).Error
 }
 
 func (r *DomainRegistrationRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.DomainRegistration, error) {
 	var registration domain.DomainRegistration
-	err := r.db.WithContext(ctx).First(&registration, "id = ?", id).Error
+	err := database.DBFromContext(ctx, r.db).First(&registration, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -35,7 +36,7 @@ func (r *DomainRegistrationRepositoryImpl) GetByID(ctx context.Context, id uuid.
 func (r *DomainRegistrationRepositoryImpl) GetByDomain(ctx context.Context, domainName string) (*domain.DomainRegistration, error) {
 	var registration domain.DomainRegistration
 	// Note: This would need a join with TenantDomain table
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Joins("JOIN tenant_domains ON domain_registrations.domain_id = tenant_domains.id").
 		Where("tenant_domains.domain = ?", domainName).
 		First(&registration).Error
@@ -47,7 +48,7 @@ func (r *DomainRegistrationRepositoryImpl) GetByDomain(ctx context.Context, doma
 
 func (r *DomainRegistrationRepositoryImpl) GetByTenantID(ctx context.Context, tenantID uuid.UUID) ([]*domain.DomainRegistration, error) {
 	var registrations []*domain.DomainRegistration
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Joins("JOIN tenant_domains ON domain_registrations.domain_id = tenant_domains.id").
 		Where("tenant_domains.tenant_id = ?", tenantID).
 		Find(&registrations).Error
@@ -55,39 +56,39 @@ func (r *DomainRegistrationRepositoryImpl) GetByTenantID(ctx context.Context, te
 }
 
 func (r *DomainRegistrationRepositoryImpl) Update(ctx context.Context, registration *domain.DomainRegistration) error {
-	return r.db.WithContext(ctx).Save(registration).Error
+	return database.DBFromContext(ctx, r.db).Save(registration).Error
 }
 
 func (r *DomainRegistrationRepositoryImpl) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.DomainRegistration{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.DomainRegistration{}, "id = ?", id).Error
 }
 
 func (r *DomainRegistrationRepositoryImpl) GetExpiringRegistrations(ctx context.Context, days int) ([]*domain.DomainRegistration, error) {
 	expiryDate := time.Now().AddDate(0, 0, days)
 	var registrations []*domain.DomainRegistration
-	err := r.db.WithContext(ctx).Where("expiration_date <= ? AND expiration_date > ? AND auto_renew = ?",
+	err := database.DBFromContext(ctx, r.db).Where("expiration_date <= ? AND expiration_date > ? AND auto_renew = ?",
 		expiryDate, time.Now(), true).Find(&registrations).Error
 	return registrations, err
 }
 
 func (r *DomainRegistrationRepositoryImpl) GetByStatus(ctx context.Context, status string) ([]*domain.DomainRegistration, error) {
 	var registrations []*domain.DomainRegistration
-	err := r.db.WithContext(ctx).Where("registration_status = ?", status).Find(&registrations).Error
+	err := database.DBFromContext(ctx, r.db).Where("registration_status = ?", status).Find(&registrations).Error
 	return registrations, err
 }
 
 func (r *DomainRegistrationRepositoryImpl) GetByProvider(ctx context.Context, provider string) ([]*domain.DomainRegistration, error) {
 	var registrations []*domain.DomainRegistration
-	err := r.db.WithContext(ctx).Where("registrar_provider = ?", provider).Find(&registrations).Error
+	err := database.DBFromContext(ctx, r.db).Where("registrar_provider = ?", provider).Find(&registrations).Error
 	return registrations, err
 }
 
 func (r *DomainRegistrationRepositoryImpl) UpdateAutoRenew(ctx context.Context, id uuid.UUID, autoRenew bool) error {
-	return r.db.WithContext(ctx).Model(&domain.DomainRegistration{}).Where("id = ?", id).Update("auto_renew", autoRenew).Error
+	return database.DBFromContext(ctx, r.db).Model(&domain.DomainRegistration{}).Where("id = ?", id).Update("auto_renew", autoRenew).Error
 }
 
 func (r *DomainRegistrationRepositoryImpl) List(ctx context.Context, filter domain.DomainRegistrationFilter) ([]*domain.DomainRegistration, int64, error) {
-	query := r.db.WithContext(ctx).Model(&domain.DomainRegistration{})
+	query := database.DBFromContext(ctx, r.db).Model(&domain.DomainRegistration{})
 
 	// Apply filters
 	if filter.TenantID != nil {
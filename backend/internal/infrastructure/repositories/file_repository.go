@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 	"gorm.io/gorm"
 )
 
@@ -21,13 +22,13 @@ func NewFileRepository(db *gorm.DB) domain.FileRepository {
 
 // Create creates a new file record
 func (r *FileRepositoryImpl) Create(ctx context.Context, file *domain.File) error {
-	return r.db.WithContext(ctx).Create(file).Error
+	return database.DBFromContext(ctx, r.db).Create(file).Error
 }
 
 // GetByID retrieves a file by ID
 func (r *FileRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.File, error) {
 	var file domain.File
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("User").
 		Preload("Tenant").
 		First(&file, "id = ?", id).Error
@@ -40,7 +41,7 @@ func (r *FileRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain
 // GetByPath retrieves a file by path
 func (r *FileRepositoryImpl) GetByPath(ctx context.Context, path string) (*domain.File, error) {
 	var file domain.File
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("User").
 		Preload("Tenant").
 		First(&file, "path = ?", path).Error
@@ -53,7 +54,7 @@ func (r *FileRepositoryImpl) GetByPath(ctx context.Context, path string) (*domai
 // GetByChecksum retrieves a file by checksum
 func (r *FileRepositoryImpl) GetByChecksum(ctx context.Context, checksum string) (*domain.File, error) {
 	var file domain.File
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("checksum = ? AND deleted_at IS NULL", checksum).
 		First(&file).Error
 	if err != nil {
@@ -64,23 +65,23 @@ func (r *FileRepositoryImpl) GetByChecksum(ctx context.Context, checksum string)
 
 // Update updates a file record
 func (r *FileRepositoryImpl) Update(ctx context.Context, file *domain.File) error {
-	return r.db.WithContext(ctx).Save(file).Error
+	return database.DBFromContext(ctx, r.db).Save(file).Error
 }
 
 // Delete hard deletes a file record
 func (r *FileRepositoryImpl) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Unscoped().Delete(&domain.File{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Unscoped().Delete(&domain.File{}, "id = ?", id).Error
 }
 
 // SoftDelete soft deletes a file record
 func (r *FileRepositoryImpl) SoftDelete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.File{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.File{}, "id = ?", id).Error
 }
 
 // ListByUser retrieves files by user with pagination
 func (r *FileRepositoryImpl) ListByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*domain.File, error) {
 	var files []*domain.File
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("user_id = ?", userID).
 		Limit(limit).
 		Offset(offset).
@@ -92,7 +93,7 @@ func (r *FileRepositoryImpl) ListByUser(ctx context.Context, userID uuid.UUID, l
 // ListByTenant retrieves files by tenant with pagination
 func (r *FileRepositoryImpl) ListByTenant(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*domain.File, error) {
 	var files []*domain.File
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("tenant_id = ?", tenantID).
 		Limit(limit).
 		Offset(offset).
@@ -104,7 +105,7 @@ func (r *FileRepositoryImpl) ListByTenant(ctx context.Context, tenantID uuid.UUI
 // ListByCategory retrieves files by category with pagination
 func (r *FileRepositoryImpl) ListByCategory(ctx context.Context, category string, limit, offset int) ([]*domain.File, error) {
 	var files []*domain.File
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("category = ?", category).
 		Limit(limit).
 		Offset(offset).
@@ -116,7 +117,7 @@ func (r *FileRepositoryImpl) ListByCategory(ctx context.Context, category string
 // ListByUserAndCategory retrieves files by user and category with pagination
 func (r *FileRepositoryImpl) ListByUserAndCategory(ctx context.Context, userID uuid.UUID, category string, limit, offset int) ([]*domain.File, error) {
 	var files []*domain.File
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("user_id = ? AND category = ?", userID, category).
 		Limit(limit).
 		Offset(offset).
@@ -128,7 +129,7 @@ func (r *FileRepositoryImpl) ListByUserAndCategory(ctx context.Context, userID u
 // ListByTags lists files by tags
 func (r *FileRepositoryImpl) ListByTags(ctx context.Context, tags []string, limit, offset int) ([]*domain.File, error) {
 	var files []*domain.File
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("tags @> ?", tags).
 		Limit(limit).
 		Offset(offset).
@@ -140,7 +141,7 @@ func (r *FileRepositoryImpl) ListByTags(ctx context.Context, tags []string, limi
 // ListPublic lists public files
 func (r *FileRepositoryImpl) ListPublic(ctx context.Context, limit, offset int) ([]*domain.File, error) {
 	var files []*domain.File
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("is_public = ?", true).
 		Limit(limit).
 		Offset(offset).
@@ -152,7 +153,7 @@ func (r *FileRepositoryImpl) ListPublic(ctx context.Context, limit, offset int)
 // ListPendingProcessing lists files pending processing
 func (r *FileRepositoryImpl) ListPendingProcessing(ctx context.Context, limit, offset int) ([]*domain.File, error) {
 	var files []*domain.File
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("processing_status = ?", "pending").
 		Limit(limit).
 		Offset(offset).
@@ -164,7 +165,7 @@ func (r *FileRepositoryImpl) ListPendingProcessing(ctx context.Context, limit, o
 // ListPendingVirusScan lists files pending virus scan
 func (r *FileRepositoryImpl) ListPendingVirusScan(ctx context.Context, limit, offset int) ([]*domain.File, error) {
 	var files []*domain.File
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("virus_scan_status = ?", "pending").
 		Limit(limit).
 		Offset(offset).
@@ -176,7 +177,7 @@ func (r *FileRepositoryImpl) ListPendingVirusScan(ctx context.Context, limit, of
 // CountByUser counts files by user
 func (r *FileRepositoryImpl) CountByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Model(&domain.File{}).
 		Where("user_id = ?", userID).
 		Count(&count).Error
@@ -186,7 +187,7 @@ func (r *FileRepositoryImpl) CountByUser(ctx context.Context, userID uuid.UUID)
 // CountByTenant counts files by tenant
 func (r *FileRepositoryImpl) CountByTenant(ctx context.Context, tenantID uuid.UUID) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Model(&domain.File{}).
 		Where("tenant_id = ?", tenantID).
 		Count(&count).Error
@@ -196,28 +197,28 @@ func (r *FileRepositoryImpl) CountByTenant(ctx context.Context, tenantID uuid.UU
 // GetTotalSizeByUser gets total file size by user
 func (r *FileRepositoryImpl) GetTotalSizeByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
 	var totalSize int64
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Model(&domain.File{}).
 		Where("user_id = ?", userID).
 		Select("COALESCE(SUM(size), 0)").
-		Scan(&totalSize).Error
+		Find(&totalSize).Error
 	return totalSize, err
 }
 
 // GetTotalSizeByTenant gets total file size by tenant
 func (r *FileRepositoryImpl) GetTotalSizeByTenant(ctx context.Context, tenantID uuid.UUID) (int64, error) {
 	var totalSize int64
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Model(&domain.File{}).
 		Where("tenant_id = ?", tenantID).
 		Select("COALESCE(SUM(size), 0)").
-		Scan(&totalSize).Error
+		Find(&totalSize).Error
 	return totalSize, err
 }
 
 // DeleteExpired deletes expired files
 func (r *FileRepositoryImpl) DeleteExpired(ctx context.Context) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Delete(&domain.File{}, "expires_at IS NOT NULL AND expires_at < ?", time.Now()).Error
 }
 
@@ -226,7 +227,7 @@ func (r *FileRepositoryImpl) Search(ctx context.Context, query string, tenantID
 	var files []*domain.File
 	searchPattern := "%" + query + "%"
 
-	db := r.db.WithContext(ctx).
+	db := database.DBFromContext(ctx, r.db).
 		Where("file_name ILIKE ? OR original_name ILIKE ?", searchPattern, searchPattern)
 
 	if tenantID != nil {
@@ -242,7 +243,7 @@ func (r *FileRepositoryImpl) Search(ctx context.Context, query string, tenantID
 
 // UpdateProcessingStatus updates file processing status
 func (r *FileRepositoryImpl) UpdateProcessingStatus(ctx context.Context, id uuid.UUID, status string) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.File{}).
 		Where("id = ?", id).
 		Update("processing_status", status).Error
@@ -258,7 +259,7 @@ func (r *FileRepositoryImpl) UpdateVirusScanStatus(ctx context.Context, id uuid.
 		updates["virus_scan_result"] = result
 	}
 
-	return r.db.WithContext(ctx).Model(&domain.File{}).
+	return database.DBFromContext(ctx, r.db).Model(&domain.File{}).
 		Where("id = ?", id).
 		Updates(updates).Error
 }
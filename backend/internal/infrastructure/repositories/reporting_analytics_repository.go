@@ -9,6 +9,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 )
 
 // AnalyticsReportRepositoryImpl implements AnalyticsReportRepository
@@ -22,28 +23,28 @@ func NewAnalyticsReportRepository(db *gorm.DB) domain.AnalyticsReportRepository
 }
 
 func (r *AnalyticsReportRepositoryImpl) Create(ctx context.Context, report *domain.AnalyticsReport) error {
-	return r.db.WithContext(ctx).Create(report).Error
+	return database.DBFromContext(ctx, r.db).Create(report).Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.AnalyticsReport, error) {
 	var report domain.AnalyticsReport
-	err := r.db.WithContext(ctx).Where("id = ?", id).First(&report).Error
+	err := database.DBFromContext(ctx, r.db).Where("id = ?", id).First(&report).Error
 	return &report, err
 }
 
 func (r *AnalyticsReportRepositoryImpl) Update(ctx context.Context, report *domain.AnalyticsReport) error {
-	return r.db.WithContext(ctx).Save(report).Error
+	return database.DBFromContext(ctx, r.db).Save(report).Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.AnalyticsReport{}, id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.AnalyticsReport{}, id).Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) GetByTenantID(ctx context.Context, tenantID string, filter *domain.ReportFilter) ([]*domain.AnalyticsReport, int64, error) {
 	var reports []*domain.AnalyticsReport
 	var total int64
 
-	query := r.db.WithContext(ctx).Model(&domain.AnalyticsReport{}).Where("tenant_id = ?", tenantID)
+	query := database.DBFromContext(ctx, r.db).Model(&domain.AnalyticsReport{}).Where("tenant_id = ?", tenantID)
 
 	// Apply filters
 	if filter.ReportType != nil && *filter.ReportType != "" {
@@ -83,7 +84,7 @@ func (r *AnalyticsReportRepositoryImpl) UpdateStatus(ctx context.Context, id uui
 	if errorMessage != "" {
 		updates["error_message"] = errorMessage
 	}
-	return r.db.WithContext(ctx).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Updates(updates).Error
+	return database.DBFromContext(ctx, r.db).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Updates(updates).Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) MarkCompleted(ctx context.Context, id uuid.UUID, filePath, fileURL string, fileSize int64) error {
@@ -95,7 +96,7 @@ func (r *AnalyticsReportRepositoryImpl) MarkCompleted(ctx context.Context, id uu
 		"completed_at": time.Now(),
 		"updated_at":   time.Now(),
 	}
-	return r.db.WithContext(ctx).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Updates(updates).Error
+	return database.DBFromContext(ctx, r.db).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Updates(updates).Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) MarkFailed(ctx context.Context, id uuid.UUID, errorMessage string) error {
@@ -104,40 +105,40 @@ func (r *AnalyticsReportRepositoryImpl) MarkFailed(ctx context.Context, id uuid.
 		"error_message": errorMessage,
 		"updated_at":    time.Now(),
 	}
-	return r.db.WithContext(ctx).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Updates(updates).Error
+	return database.DBFromContext(ctx, r.db).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Updates(updates).Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) IncrementDownloadCount(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Update("download_count", gorm.Expr("download_count + 1")).Error
+	return database.DBFromContext(ctx, r.db).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Update("download_count", gorm.Expr("download_count + 1")).Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) UpdateLastDownload(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Update("last_download_at", time.Now()).Error
+	return database.DBFromContext(ctx, r.db).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Update("last_download_at", time.Now()).Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) GetScheduledReports(ctx context.Context, before time.Time) ([]*domain.AnalyticsReport, error) {
 	var reports []*domain.AnalyticsReport
-	err := r.db.WithContext(ctx).Where("scheduled_for <= ? AND status = ?", before, "pending").Find(&reports).Error
+	err := database.DBFromContext(ctx, r.db).Where("scheduled_for <= ? AND status = ?", before, "pending").Find(&reports).Error
 	return reports, err
 }
 
 func (r *AnalyticsReportRepositoryImpl) GetRecurringReports(ctx context.Context, before time.Time) ([]*domain.AnalyticsReport, error) {
 	var reports []*domain.AnalyticsReport
-	err := r.db.WithContext(ctx).Where("is_recurring = true AND next_run_at <= ?", before).Find(&reports).Error
+	err := database.DBFromContext(ctx, r.db).Where("is_recurring = true AND next_run_at <= ?", before).Find(&reports).Error
 	return reports, err
 }
 
 func (r *AnalyticsReportRepositoryImpl) UpdateNextRun(ctx context.Context, id uuid.UUID, nextRun time.Time) error {
-	return r.db.WithContext(ctx).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Update("next_run_at", nextRun).Error
+	return database.DBFromContext(ctx, r.db).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Update("next_run_at", nextRun).Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) DeleteExpiredReports(ctx context.Context, before time.Time) (int64, error) {
-	result := r.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&domain.AnalyticsReport{})
+	result := database.DBFromContext(ctx, r.db).Where("expires_at < ?", before).Delete(&domain.AnalyticsReport{})
 	return result.RowsAffected, result.Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
-	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&domain.AnalyticsReport{}).Error
+	return database.DBFromContext(ctx, r.db).Where("user_id = ?", userID).Delete(&domain.AnalyticsReport{}).Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) UpdateProgress(ctx context.Context, id uuid.UUID, progress int, stats map[string]interface{}) error {
@@ -145,7 +146,7 @@ func (r *AnalyticsReportRepositoryImpl) UpdateProgress(ctx context.Context, id u
 		"processing_stats": stats,
 		"updated_at":       time.Now(),
 	}
-	return r.db.WithContext(ctx).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Updates(updates).Error
+	return database.DBFromContext(ctx, r.db).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Updates(updates).Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) UpdateFileInfo(ctx context.Context, id uuid.UUID, filePath, fileURL string, fileSize int64) error {
@@ -155,14 +156,14 @@ func (r *AnalyticsReportRepositoryImpl) UpdateFileInfo(ctx context.Context, id u
 		"file_size":  fileSize,
 		"updated_at": time.Now(),
 	}
-	return r.db.WithContext(ctx).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Updates(updates).Error
+	return database.DBFromContext(ctx, r.db).Model(&domain.AnalyticsReport{}).Where("id = ?", id).Updates(updates).Error
 }
 
 func (r *AnalyticsReportRepositoryImpl) SearchReports(ctx context.Context, tenantID, query string, limit, offset int) ([]*domain.AnalyticsReport, int64, error) {
 	var reports []*domain.AnalyticsReport
 	var total int64
 
-	searchQuery := r.db.WithContext(ctx).Model(&domain.AnalyticsReport{}).
+	searchQuery := database.DBFromContext(ctx, r.db).Model(&domain.AnalyticsReport{}).
 		Where("tenant_id = ? AND (title ILIKE ? OR description ILIKE ?)", tenantID, "%"+query+"%", "%"+query+"%")
 
 	// Count total
@@ -176,14 +177,14 @@ func (r *AnalyticsReportRepositoryImpl) SearchReports(ctx context.Context, tenan
 
 func (r *AnalyticsReportRepositoryImpl) GetReportsByType(ctx context.Context, tenantID, reportType string, limit, offset int) ([]*domain.AnalyticsReport, error) {
 	var reports []*domain.AnalyticsReport
-	err := r.db.WithContext(ctx).Where("tenant_id = ? AND report_type = ?", tenantID, reportType).
+	err := database.DBFromContext(ctx, r.db).Where("tenant_id = ? AND report_type = ?", tenantID, reportType).
 		Order("created_at DESC").Offset(offset).Limit(limit).Find(&reports).Error
 	return reports, err
 }
 
 func (r *AnalyticsReportRepositoryImpl) GetRecentReports(ctx context.Context, tenantID string, limit int) ([]*domain.AnalyticsReport, error) {
 	var reports []*domain.AnalyticsReport
-	err := r.db.WithContext(ctx).Where("tenant_id = ?", tenantID).
+	err := database.DBFromContext(ctx, r.db).Where("tenant_id = ?", tenantID).
 		Order("created_at DESC").Limit(limit).Find(&reports).Error
 	return reports, err
 }
@@ -199,12 +200,12 @@ func NewUserActivityMetricsRepository(db *gorm.DB) domain.UserActivityMetricsRep
 }
 
 func (r *UserActivityMetricsRepositoryImpl) Create(ctx context.Context, metric *domain.UserActivityMetrics) error {
-	return r.db.WithContext(ctx).Create(metric).Error
+	return database.DBFromContext(ctx, r.db).Create(metric).Error
 }
 
 func (r *UserActivityMetricsRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.UserActivityMetrics, error) {
 	var metric domain.UserActivityMetrics
-	err := r.db.WithContext(ctx).Where("id = ?", id).First(&metric).Error
+	err := database.DBFromContext(ctx, r.db).Where("id = ?", id).First(&metric).Error
 	return &metric, err
 }
 
@@ -212,7 +213,7 @@ func (r *UserActivityMetricsRepositoryImpl) GetByTenantAndDateRange(ctx context.
 	var metrics []*domain.UserActivityMetrics
 	var total int64
 
-	query := r.db.WithContext(ctx).Model(&domain.UserActivityMetrics{}).
+	query := database.DBFromContext(ctx, r.db).Model(&domain.UserActivityMetrics{}).
 		Where("tenant_id = ? AND date BETWEEN ? AND ?", tenantID, startDate, endDate)
 
 	// Apply filters
@@ -244,7 +245,7 @@ func (r *UserActivityMetricsRepositoryImpl) RecordUserActivity(ctx context.Conte
 
 	// Try to find existing metric for today
 	var metric domain.UserActivityMetrics
-	err := r.db.WithContext(ctx).Where("tenant_id = ? AND user_id = ? AND date = ? AND session_id = ?",
+	err := database.DBFromContext(ctx, r.db).Where("tenant_id = ? AND user_id = ? AND date = ? AND session_id = ?",
 		tenantID, userID, today, sessionID).First(&metric).Error
 
 	if err != nil {
@@ -286,7 +287,7 @@ func (r *UserActivityMetricsRepositoryImpl) RecordUserActivity(ctx context.Conte
 				metric.City = city
 			}
 
-			return r.db.WithContext(ctx).Create(&metric).Error
+			return database.DBFromContext(ctx, r.db).Create(&metric).Error
 		}
 		return err
 	}
@@ -311,7 +312,7 @@ func (r *UserActivityMetricsRepositoryImpl) RecordUserActivity(ctx context.Conte
 		updates["activity_data"] = metric.ActivityData
 	}
 
-	return r.db.WithContext(ctx).Model(&metric).Where("id = ?", metric.ID).Updates(updates).Error
+	return database.DBFromContext(ctx, r.db).Model(&metric).Where("id = ?", metric.ID).Updates(updates).Error
 }
 
 func (r *UserActivityMetricsRepositoryImpl) GetUserSummary(ctx context.Context, tenantID string, userID uuid.UUID, days int) (map[string]interface{}, error) {
@@ -326,10 +327,10 @@ func (r *UserActivityMetricsRepositoryImpl) GetUserSummary(ctx context.Context,
 		AvgSessionTime float64 `json:"avg_session_time"`
 	}
 
-	err := r.db.WithContext(ctx).Model(&domain.UserActivityMetrics{}).
+	err := database.DBFromContext(ctx, r.db).Model(&domain.UserActivityMetrics{}).
 		Select("SUM(page_views) as total_page_views, COUNT(*) as total_sessions, SUM(session_duration) as total_duration, SUM(actions_count) as total_actions, SUM(login_count) as login_count, AVG(session_duration) as avg_session_time").
 		Where("tenant_id = ? AND user_id = ? AND date >= ?", tenantID, userID, startDate).
-		Scan(&result).Error
+		Find(&result).Error
 
 	if err != nil {
 		return nil, err
@@ -375,34 +376,37 @@ func (r *UserActivityMetricsRepositoryImpl) GetActivityTrends(ctx context.Contex
 		ORDER BY period
 	`, groupFormat, groupFormat)
 
-	rows, err := r.db.WithContext(ctx).Raw(query, tenantID, startDate, endDate).Rows()
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	err := database.WithinTenantTransaction(ctx, r.db, tenantID, func(tx *gorm.DB) error {
+		rows, err := tx.Raw(query, tenantID, startDate, endDate).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
 
-	for rows.Next() {
-		var period string
-		var totalPageViews, uniqueUsers, totalSessions, totalActions int
+		for rows.Next() {
+			var period string
+			var totalPageViews, uniqueUsers, totalSessions, totalActions int
 
-		if err := rows.Scan(&period, &totalPageViews, &uniqueUsers, &totalSessions, &totalActions); err != nil {
-			return nil, err
-		}
+			if err := rows.Scan(&period, &totalPageViews, &uniqueUsers, &totalSessions, &totalActions); err != nil {
+				return err
+			}
 
-		results = append(results, map[string]interface{}{
-			"period":           period,
-			"total_page_views": totalPageViews,
-			"unique_users":     uniqueUsers,
-			"total_sessions":   totalSessions,
-			"total_actions":    totalActions,
-		})
-	}
+			results = append(results, map[string]interface{}{
+				"period":           period,
+				"total_page_views": totalPageViews,
+				"unique_users":     uniqueUsers,
+				"total_sessions":   totalSessions,
+				"total_actions":    totalActions,
+			})
+		}
 
-	return results, nil
+		return nil
+	})
+	return results, err
 }
 
 func (r *UserActivityMetricsRepositoryImpl) DeleteOldMetrics(ctx context.Context, before time.Time) (int64, error) {
-	result := r.db.WithContext(ctx).Where("date < ?", before).Delete(&domain.UserActivityMetrics{})
+	result := database.DBFromContext(ctx, r.db).Where("date < ?", before).Delete(&domain.UserActivityMetrics{})
 	return result.RowsAffected, result.Error
 }
 
@@ -417,12 +421,12 @@ func NewSystemUsageMetricsRepository(db *gorm.DB) domain.SystemUsageMetricsRepos
 }
 
 func (r *SystemUsageMetricsRepositoryImpl) Create(ctx context.Context, metric *domain.SystemUsageMetrics) error {
-	return r.db.WithContext(ctx).Create(metric).Error
+	return database.DBFromContext(ctx, r.db).Create(metric).Error
 }
 
 func (r *SystemUsageMetricsRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.SystemUsageMetrics, error) {
 	var metric domain.SystemUsageMetrics
-	err := r.db.WithContext(ctx).Where("id = ?", id).First(&metric).Error
+	err := database.DBFromContext(ctx, r.db).Where("id = ?", id).First(&metric).Error
 	return &metric, err
 }
 
@@ -430,7 +434,7 @@ func (r *SystemUsageMetricsRepositoryImpl) GetByTenantAndDateRange(ctx context.C
 	var metrics []*domain.SystemUsageMetrics
 	var total int64
 
-	query := r.db.WithContext(ctx).Model(&domain.SystemUsageMetrics{}).
+	query := database.DBFromContext(ctx, r.db).Model(&domain.SystemUsageMetrics{}).
 		Where("tenant_id = ? AND date BETWEEN ? AND ?", tenantID, startDate, endDate)
 
 	// Apply filters
@@ -460,7 +464,7 @@ func (r *SystemUsageMetricsRepositoryImpl) GetByTenantAndDateRange(ctx context.C
 func (r *SystemUsageMetricsRepositoryImpl) RecordCustomMetric(ctx context.Context, tenantID string, date time.Time, hour int, metricType, metricName string, metricValue float64, metricUnit string, customMetrics map[string]interface{}) error {
 	// Try to find existing metric for this date/hour/type/name
 	var metric domain.SystemUsageMetrics
-	err := r.db.WithContext(ctx).Where("tenant_id = ? AND date = ? AND hour = ? AND metric_type = ? AND metric_name = ?",
+	err := database.DBFromContext(ctx, r.db).Where("tenant_id = ? AND date = ? AND hour = ? AND metric_type = ? AND metric_name = ?",
 		tenantID, date, hour, metricType, metricName).First(&metric).Error
 
 	if err != nil {
@@ -477,7 +481,7 @@ func (r *SystemUsageMetricsRepositoryImpl) RecordCustomMetric(ctx context.Contex
 				CustomMetrics: customMetrics,
 				Metadata:      make(map[string]interface{}),
 			}
-			return r.db.WithContext(ctx).Create(&metric).Error
+			return database.DBFromContext(ctx, r.db).Create(&metric).Error
 		}
 		return err
 	}
@@ -499,7 +503,7 @@ func (r *SystemUsageMetricsRepositoryImpl) RecordCustomMetric(ctx context.Contex
 		updates["custom_metrics"] = metric.CustomMetrics
 	}
 
-	return r.db.WithContext(ctx).Model(&metric).Where("id = ?", metric.ID).Updates(updates).Error
+	return database.DBFromContext(ctx, r.db).Model(&metric).Where("id = ?", metric.ID).Updates(updates).Error
 }
 
 func (r *SystemUsageMetricsRepositoryImpl) GetSystemOverview(ctx context.Context, tenantID string, days int) (map[string]interface{}, error) {
@@ -512,10 +516,10 @@ func (r *SystemUsageMetricsRepositoryImpl) GetSystemOverview(ctx context.Context
 		AvgResponse   float64 `json:"avg_response_time"`
 	}
 
-	err := r.db.WithContext(ctx).Model(&domain.SystemUsageMetrics{}).
+	err := database.DBFromContext(ctx, r.db).Model(&domain.SystemUsageMetrics{}).
 		Select("SUM(api_calls_total) as total_api_calls, SUM(api_calls_error) as total_errors, AVG(api_response_time) as avg_response").
 		Where("tenant_id = ? AND date >= ?", tenantID, startDate).
-		Scan(&apiMetrics).Error
+		Find(&apiMetrics).Error
 
 	if err != nil {
 		return nil, err
@@ -533,10 +537,10 @@ func (r *SystemUsageMetricsRepositoryImpl) GetSystemOverview(ctx context.Context
 		BandwidthUsed int64 `json:"bandwidth_used"`
 	}
 
-	err = r.db.WithContext(ctx).Model(&domain.SystemUsageMetrics{}).
+	err = database.DBFromContext(ctx, r.db).Model(&domain.SystemUsageMetrics{}).
 		Select("SUM(storage_used) as storage_used, SUM(bandwidth_used) as bandwidth_used").
 		Where("tenant_id = ? AND date >= ?", tenantID, startDate).
-		Scan(&resourceMetrics).Error
+		Find(&resourceMetrics).Error
 
 	if err != nil {
 		return nil, err
@@ -550,10 +554,10 @@ func (r *SystemUsageMetricsRepositoryImpl) GetSystemOverview(ctx context.Context
 		TotalSessions int `json:"total_sessions"`
 	}
 
-	err = r.db.WithContext(ctx).Model(&domain.SystemUsageMetrics{}).
+	err = database.DBFromContext(ctx, r.db).Model(&domain.SystemUsageMetrics{}).
 		Select("MAX(active_users) as active_users, SUM(new_users) as new_users, MAX(active_users) as total_users, SUM(sessions_created) as total_sessions").
 		Where("tenant_id = ? AND date >= ?", tenantID, startDate).
-		Scan(&userMetrics).Error
+		Find(&userMetrics).Error
 
 	if err != nil {
 		return nil, err
@@ -565,10 +569,10 @@ func (r *SystemUsageMetricsRepositoryImpl) GetSystemOverview(ctx context.Context
 		OrdersCount int     `json:"orders_count"`
 	}
 
-	err = r.db.WithContext(ctx).Model(&domain.SystemUsageMetrics{}).
+	err = database.DBFromContext(ctx, r.db).Model(&domain.SystemUsageMetrics{}).
 		Select("SUM(revenue) as revenue, SUM(orders_created) as orders_count").
 		Where("tenant_id = ? AND date >= ?", tenantID, startDate).
-		Scan(&salesMetrics).Error
+		Find(&salesMetrics).Error
 
 	if err != nil {
 		return nil, err
@@ -599,10 +603,10 @@ func (r *SystemUsageMetricsRepositoryImpl) GetAPIUsageStats(ctx context.Context,
 		MinResponse  int     `json:"min_response_time"`
 	}
 
-	err := r.db.WithContext(ctx).Model(&domain.SystemUsageMetrics{}).
+	err := database.DBFromContext(ctx, r.db).Model(&domain.SystemUsageMetrics{}).
 		Select("SUM(api_calls_total) as total_calls, SUM(api_calls_success) as success_calls, SUM(api_calls_error) as error_calls, AVG(api_response_time) as avg_response, MAX(api_response_time) as max_response, MIN(api_response_time) as min_response").
 		Where("tenant_id = ? AND date BETWEEN ? AND ?", tenantID, startDate, endDate).
-		Scan(&stats).Error
+		Find(&stats).Error
 
 	if err != nil {
 		return nil, err
@@ -632,10 +636,10 @@ func (r *SystemUsageMetricsRepositoryImpl) GetStorageStats(ctx context.Context,
 		BandwidthUsed   int64 `json:"bandwidth_used"`
 	}
 
-	err := r.db.WithContext(ctx).Model(&domain.SystemUsageMetrics{}).
+	err := database.DBFromContext(ctx, r.db).Model(&domain.SystemUsageMetrics{}).
 		Select("MAX(storage_used) as total_storage, SUM(files_uploaded) as files_uploaded, SUM(files_downloaded) as files_downloaded, SUM(bandwidth_used) as bandwidth_used").
 		Where("tenant_id = ? AND date BETWEEN ? AND ?", tenantID, startDate, endDate).
-		Scan(&stats).Error
+		Find(&stats).Error
 
 	if err != nil {
 		return nil, err
@@ -658,10 +662,10 @@ func (r *SystemUsageMetricsRepositoryImpl) GetUserActivityStats(ctx context.Cont
 		SuccessfulLogins int `json:"successful_logins"`
 	}
 
-	err := r.db.WithContext(ctx).Model(&domain.SystemUsageMetrics{}).
+	err := database.DBFromContext(ctx, r.db).Model(&domain.SystemUsageMetrics{}).
 		Select("MAX(active_users) as max_active_users, SUM(new_users) as total_new_users, SUM(sessions_created) as total_sessions, SUM(login_attempts) as total_logins, SUM(login_successful) as successful_logins").
 		Where("tenant_id = ? AND date BETWEEN ? AND ?", tenantID, startDate, endDate).
-		Scan(&stats).Error
+		Find(&stats).Error
 
 	if err != nil {
 		return nil, err
@@ -689,10 +693,10 @@ func (r *SystemUsageMetricsRepositoryImpl) GetPerformanceStats(ctx context.Conte
 		TotalDBQueries int64   `json:"total_db_queries"`
 	}
 
-	err := r.db.WithContext(ctx).Model(&domain.SystemUsageMetrics{}).
+	err := database.DBFromContext(ctx, r.db).Model(&domain.SystemUsageMetrics{}).
 		Select("AVG(api_response_time) as avg_api_response, AVG(database_query_time) as avg_db_query, SUM(database_queries) as total_db_queries").
 		Where("tenant_id = ? AND date BETWEEN ? AND ?", tenantID, startDate, endDate).
-		Scan(&stats).Error
+		Find(&stats).Error
 
 	if err != nil {
 		return nil, err
@@ -706,6 +710,6 @@ func (r *SystemUsageMetricsRepositoryImpl) GetPerformanceStats(ctx context.Conte
 }
 
 func (r *SystemUsageMetricsRepositoryImpl) DeleteOldMetrics(ctx context.Context, before time.Time) (int64, error) {
-	result := r.db.WithContext(ctx).Where("date < ?", before).Delete(&domain.SystemUsageMetrics{})
+	result := database.DBFromContext(ctx, r.db).Where("date < ?", before).Delete(&domain.SystemUsageMetrics{})
 	return result.RowsAffected, result.Error
 }
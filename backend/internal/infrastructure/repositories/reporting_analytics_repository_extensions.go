@@ -9,6 +9,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 )
 
 // =============================================
@@ -16,39 +17,39 @@ import (
 // =============================================
 
 func (r *UserActivityMetricsRepositoryImpl) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.UserActivityMetrics{}, id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.UserActivityMetrics{}, id).Error
 }
 
 func (r *UserActivityMetricsRepositoryImpl) Update(ctx context.Context, metrics *domain.UserActivityMetrics) error {
-	return r.db.WithContext(ctx).Save(metrics).Error
+	return database.DBFromContext(ctx, r.db).Save(metrics).Error
 }
 
 func (r *UserActivityMetricsRepositoryImpl) UpdateSessionDuration(ctx context.Context, tenantID string, userID uuid.UUID, sessionID string, duration int) error {
-	return r.db.WithContext(ctx).Model(&domain.UserActivityMetrics{}).
+	return database.DBFromContext(ctx, r.db).Model(&domain.UserActivityMetrics{}).
 		Where("tenant_id = ? AND user_id = ? AND session_id = ?", tenantID, userID, sessionID).
 		Update("session_duration", duration).Error
 }
 
 func (r *UserActivityMetricsRepositoryImpl) IncrementPageViews(ctx context.Context, tenantID string, userID uuid.UUID, date time.Time) error {
-	return r.db.WithContext(ctx).Model(&domain.UserActivityMetrics{}).
+	return database.DBFromContext(ctx, r.db).Model(&domain.UserActivityMetrics{}).
 		Where("tenant_id = ? AND user_id = ? AND date = ?", tenantID, userID, date).
 		Update("page_views", gorm.Expr("page_views + 1")).Error
 }
 
 func (r *UserActivityMetricsRepositoryImpl) IncrementActions(ctx context.Context, tenantID string, userID uuid.UUID, date time.Time, count int) error {
-	return r.db.WithContext(ctx).Model(&domain.UserActivityMetrics{}).
+	return database.DBFromContext(ctx, r.db).Model(&domain.UserActivityMetrics{}).
 		Where("tenant_id = ? AND user_id = ? AND date = ?", tenantID, userID, date).
 		Update("actions_count", gorm.Expr("actions_count + ?", count)).Error
 }
 
 func (r *UserActivityMetricsRepositoryImpl) IncrementLoginCount(ctx context.Context, tenantID string, userID uuid.UUID, date time.Time) error {
-	return r.db.WithContext(ctx).Model(&domain.UserActivityMetrics{}).
+	return database.DBFromContext(ctx, r.db).Model(&domain.UserActivityMetrics{}).
 		Where("tenant_id = ? AND user_id = ? AND date = ?", tenantID, userID, date).
 		Update("login_count", gorm.Expr("login_count + 1")).Error
 }
 
 func (r *UserActivityMetricsRepositoryImpl) IncrementErrorCount(ctx context.Context, tenantID string, userID uuid.UUID, date time.Time, count int) error {
-	return r.db.WithContext(ctx).Model(&domain.UserActivityMetrics{}).
+	return database.DBFromContext(ctx, r.db).Model(&domain.UserActivityMetrics{}).
 		Where("tenant_id = ? AND user_id = ? AND date = ?", tenantID, userID, date).
 		Update("errors_count", gorm.Expr("errors_count + ?", count)).Error
 }
@@ -57,7 +58,7 @@ func (r *UserActivityMetricsRepositoryImpl) GetByTenantAndUser(ctx context.Conte
 	var metrics []*domain.UserActivityMetrics
 	var total int64
 
-	query := r.db.WithContext(ctx).Model(&domain.UserActivityMetrics{}).
+	query := database.DBFromContext(ctx, r.db).Model(&domain.UserActivityMetrics{}).
 		Where("tenant_id = ? AND user_id = ?", tenantID, userID)
 
 	// Apply date filters if provided
@@ -83,7 +84,7 @@ func (r *UserActivityMetricsRepositoryImpl) GetByTenantAndUser(ctx context.Conte
 
 func (r *UserActivityMetricsRepositoryImpl) GetDailyMetrics(ctx context.Context, tenantID string, date time.Time, filter *domain.ActivityMetricsFilter) ([]*domain.UserActivityMetrics, error) {
 	var metrics []*domain.UserActivityMetrics
-	query := r.db.WithContext(ctx).Where("tenant_id = ? AND date = ?", tenantID, date)
+	query := database.DBFromContext(ctx, r.db).Where("tenant_id = ? AND date = ?", tenantID, date)
 
 	if filter.UserID != nil {
 		query = query.Where("user_id = ?", *filter.UserID)
@@ -95,7 +96,7 @@ func (r *UserActivityMetricsRepositoryImpl) GetDailyMetrics(ctx context.Context,
 
 func (r *UserActivityMetricsRepositoryImpl) GetActiveUsersCount(ctx context.Context, tenantID string, date time.Time) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).Model(&domain.UserActivityMetrics{}).
+	err := database.DBFromContext(ctx, r.db).Model(&domain.UserActivityMetrics{}).
 		Where("tenant_id = ? AND date = ?", tenantID, date).
 		Select("COUNT(DISTINCT user_id)").
 		Count(&count).Error
@@ -104,7 +105,7 @@ func (r *UserActivityMetricsRepositoryImpl) GetActiveUsersCount(ctx context.Cont
 
 func (r *UserActivityMetricsRepositoryImpl) GetTopUsers(ctx context.Context, tenantID string, startDate, endDate time.Time, limit int) ([]*domain.UserActivityMetrics, error) {
 	var metrics []*domain.UserActivityMetrics
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("tenant_id = ? AND date BETWEEN ? AND ?", tenantID, startDate, endDate).
 		Order("page_views DESC").
 		Limit(limit).
@@ -119,11 +120,11 @@ func (r *UserActivityMetricsRepositoryImpl) GetDeviceStats(ctx context.Context,
 	}
 
 	var stats []DeviceStat
-	err := r.db.WithContext(ctx).Model(&domain.UserActivityMetrics{}).
+	err := database.DBFromContext(ctx, r.db).Model(&domain.UserActivityMetrics{}).
 		Select("device_type, COUNT(*) as count").
 		Where("tenant_id = ? AND date BETWEEN ? AND ?", tenantID, startDate, endDate).
 		Group("device_type").
-		Scan(&stats).Error
+		Find(&stats).Error
 
 	if err != nil {
 		return nil, err
@@ -143,12 +144,12 @@ func (r *UserActivityMetricsRepositoryImpl) GetGeographicStats(ctx context.Conte
 	}
 
 	var stats []GeoStat
-	err := r.db.WithContext(ctx).Model(&domain.UserActivityMetrics{}).
+	err := database.DBFromContext(ctx, r.db).Model(&domain.UserActivityMetrics{}).
 		Select("country, COUNT(*) as count").
 		Where("tenant_id = ? AND date BETWEEN ? AND ?", tenantID, startDate, endDate).
 		Group("country").
 		Order("count DESC").
-		Scan(&stats).Error
+		Find(&stats).Error
 
 	if err != nil {
 		return nil, err
@@ -162,7 +163,7 @@ func (r *UserActivityMetricsRepositoryImpl) GetGeographicStats(ctx context.Conte
 }
 
 func (r *UserActivityMetricsRepositoryImpl) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
-	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&domain.UserActivityMetrics{}).Error
+	return database.DBFromContext(ctx, r.db).Where("user_id = ?", userID).Delete(&domain.UserActivityMetrics{}).Error
 }
 
 // =============================================
@@ -170,11 +171,11 @@ func (r *UserActivityMetricsRepositoryImpl) DeleteByUserID(ctx context.Context,
 // =============================================
 
 func (r *SystemUsageMetricsRepositoryImpl) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.SystemUsageMetrics{}, id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.SystemUsageMetrics{}, id).Error
 }
 
 func (r *SystemUsageMetricsRepositoryImpl) Update(ctx context.Context, metrics *domain.SystemUsageMetrics) error {
-	return r.db.WithContext(ctx).Save(metrics).Error
+	return database.DBFromContext(ctx, r.db).Save(metrics).Error
 }
 
 func (r *SystemUsageMetricsRepositoryImpl) RecordAPIUsage(ctx context.Context, tenantID string, date time.Time, hour int, calls, successes, errors int, avgResponseTime int) error {
@@ -218,7 +219,7 @@ func (r *SystemUsageMetricsRepositoryImpl) RecordPOSMetrics(ctx context.Context,
 
 func (r *SystemUsageMetricsRepositoryImpl) GetHourlyMetrics(ctx context.Context, tenantID string, date time.Time, filter *domain.SystemMetricsFilter) ([]*domain.SystemUsageMetrics, error) {
 	var metrics []*domain.SystemUsageMetrics
-	query := r.db.WithContext(ctx).Where("tenant_id = ? AND date = ?", tenantID, date)
+	query := database.DBFromContext(ctx, r.db).Where("tenant_id = ? AND date = ?", tenantID, date)
 
 	if filter.MetricType != nil && *filter.MetricType != "" {
 		query = query.Where("metric_type = ?", *filter.MetricType)
@@ -256,34 +257,37 @@ func (r *SystemUsageMetricsRepositoryImpl) GetDailyAggregates(ctx context.Contex
 
 	query += " GROUP BY date, metric_type ORDER BY date, metric_type"
 
-	rows, err := r.db.WithContext(ctx).Raw(query, args...).Rows()
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var date time.Time
-		var metricType string
-		var totalValue, avgValue, maxValue, minValue float64
-		var dataPoints int
-
-		if err := rows.Scan(&date, &metricType, &totalValue, &avgValue, &maxValue, &minValue, &dataPoints); err != nil {
-			return nil, err
+	err := database.WithinTenantTransaction(ctx, r.db, tenantID, func(tx *gorm.DB) error {
+		rows, err := tx.Raw(query, args...).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var date time.Time
+			var metricType string
+			var totalValue, avgValue, maxValue, minValue float64
+			var dataPoints int
+
+			if err := rows.Scan(&date, &metricType, &totalValue, &avgValue, &maxValue, &minValue, &dataPoints); err != nil {
+				return err
+			}
+
+			results = append(results, map[string]interface{}{
+				"date":        date,
+				"metric_type": metricType,
+				"total_value": totalValue,
+				"avg_value":   avgValue,
+				"max_value":   maxValue,
+				"min_value":   minValue,
+				"data_points": dataPoints,
+			})
 		}
 
-		results = append(results, map[string]interface{}{
-			"date":        date,
-			"metric_type": metricType,
-			"total_value": totalValue,
-			"avg_value":   avgValue,
-			"max_value":   maxValue,
-			"min_value":   minValue,
-			"data_points": dataPoints,
-		})
-	}
-
-	return results, nil
+		return nil
+	})
+	return results, err
 }
 
 func (r *SystemUsageMetricsRepositoryImpl) GetTopMetrics(ctx context.Context, tenantID string, metricType string, startDate, endDate time.Time, limit int) ([]map[string]interface{}, error) {
@@ -302,30 +306,33 @@ func (r *SystemUsageMetricsRepositoryImpl) GetTopMetrics(ctx context.Context, te
 		LIMIT ?
 	`
 
-	rows, err := r.db.WithContext(ctx).Raw(query, tenantID, metricType, startDate, endDate, limit).Rows()
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var metricName string
-		var totalValue, avgValue float64
-		var dataPoints int
-
-		if err := rows.Scan(&metricName, &totalValue, &avgValue, &dataPoints); err != nil {
-			return nil, err
+	err := database.WithinTenantTransaction(ctx, r.db, tenantID, func(tx *gorm.DB) error {
+		rows, err := tx.Raw(query, tenantID, metricType, startDate, endDate, limit).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var metricName string
+			var totalValue, avgValue float64
+			var dataPoints int
+
+			if err := rows.Scan(&metricName, &totalValue, &avgValue, &dataPoints); err != nil {
+				return err
+			}
+
+			results = append(results, map[string]interface{}{
+				"metric_name": metricName,
+				"total_value": totalValue,
+				"avg_value":   avgValue,
+				"data_points": dataPoints,
+			})
 		}
 
-		results = append(results, map[string]interface{}{
-			"metric_name": metricName,
-			"total_value": totalValue,
-			"avg_value":   avgValue,
-			"data_points": dataPoints,
-		})
-	}
-
-	return results, nil
+		return nil
+	})
+	return results, err
 }
 
 func (r *SystemUsageMetricsRepositoryImpl) GetSystemWideStats(ctx context.Context, startDate, endDate time.Time) (map[string]interface{}, error) {
@@ -337,20 +344,22 @@ func (r *SystemUsageMetricsRepositoryImpl) GetSystemWideStats(ctx context.Contex
 		ActiveTenants    int64   `json:"active_tenants"`
 	}
 
-	err := r.db.WithContext(ctx).Model(&domain.SystemUsageMetrics{}).
-		Select("COUNT(DISTINCT tenant_id) as total_tenants, SUM(api_calls_total) as total_api_calls, SUM(storage_used) as total_storage_used, SUM(revenue) as total_revenue").
-		Where("date BETWEEN ? AND ?", startDate, endDate).
-		Scan(&stats).Error
+	err := database.WithinPlatformTransaction(ctx, r.db, func(tx *gorm.DB) error {
+		err := tx.Model(&domain.SystemUsageMetrics{}).
+			Select("COUNT(DISTINCT tenant_id) as total_tenants, SUM(api_calls_total) as total_api_calls, SUM(storage_used) as total_storage_used, SUM(revenue) as total_revenue").
+			Where("date BETWEEN ? AND ?", startDate, endDate).
+			Find(&stats).Error
 
-	if err != nil {
-		return nil, err
-	}
+		if err != nil {
+			return err
+		}
 
-	// Get active tenants (those with activity in the period)
-	err = r.db.WithContext(ctx).Model(&domain.SystemUsageMetrics{}).
-		Select("COUNT(DISTINCT tenant_id)").
-		Where("date BETWEEN ? AND ? AND (api_calls_total > 0 OR orders_created > 0)", startDate, endDate).
-		Scan(&stats.ActiveTenants).Error
+		// Get active tenants (those with activity in the period)
+		return tx.Model(&domain.SystemUsageMetrics{}).
+			Select("COUNT(DISTINCT tenant_id)").
+			Where("date BETWEEN ? AND ? AND (api_calls_total > 0 OR orders_created > 0)", startDate, endDate).
+			Find(&stats.ActiveTenants).Error
+	})
 
 	if err != nil {
 		return nil, err
@@ -396,34 +405,37 @@ func (r *SystemUsageMetricsRepositoryImpl) GetTenantRankings(ctx context.Context
 		LIMIT ?
 	`, column, column, column)
 
-	rows, err := r.db.WithContext(ctx).Raw(query, startDate, endDate, limit).Rows()
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	rank := 1
-	for rows.Next() {
-		var tenantID string
-		var totalValue, avgValue, maxValue float64
-
-		if err := rows.Scan(&tenantID, &totalValue, &avgValue, &maxValue); err != nil {
-			return nil, err
+	err := database.WithinPlatformTransaction(ctx, r.db, func(tx *gorm.DB) error {
+		rows, err := tx.Raw(query, startDate, endDate, limit).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		rank := 1
+		for rows.Next() {
+			var tenantID string
+			var totalValue, avgValue, maxValue float64
+
+			if err := rows.Scan(&tenantID, &totalValue, &avgValue, &maxValue); err != nil {
+				return err
+			}
+
+			results = append(results, map[string]interface{}{
+				"rank":        rank,
+				"tenant_id":   tenantID,
+				"total_value": totalValue,
+				"avg_value":   avgValue,
+				"max_value":   maxValue,
+			})
+			rank++
 		}
 
-		results = append(results, map[string]interface{}{
-			"rank":        rank,
-			"tenant_id":   tenantID,
-			"total_value": totalValue,
-			"avg_value":   avgValue,
-			"max_value":   maxValue,
-		})
-		rank++
-	}
-
-	return results, nil
+		return nil
+	})
+	return results, err
 }
 
 func (r *SystemUsageMetricsRepositoryImpl) DeleteByTenantID(ctx context.Context, tenantID string) error {
-	return r.db.WithContext(ctx).Where("tenant_id = ?", tenantID).Delete(&domain.SystemUsageMetrics{}).Error
+	return database.DBFromContext(ctx, r.db).Where("tenant_id = ?", tenantID).Delete(&domain.SystemUsageMetrics{}).Error
 }
@@ -0,0 +1,304 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
+)
+
+const rlsTestSchema = "rls_test"
+
+// rlsFixture holds two tenants with two invitations each. Both tenants have
+// invited shared@example.com, and each has one expired invitation.
+type rlsFixture struct {
+	db                 *gorm.DB
+	tx                 *database.GormTransactionManager
+	repo               *TenantInvitationRepositoryImpl
+	tenantA, tenantB   uuid.UUID
+	invitedA, invitedB uuid.UUID
+	expiredA, expiredB uuid.UUID
+	sharedEmail        string
+	tokenA, tokenB     string
+	scopeA             context.Context
+	unscoped           context.Context
+	platform           context.Context
+}
+
+// openRLSTest connects to the database named by TEST_POSTGRES_DSN, skipping the
+// test when it is not set, and builds the tenant invitations table with its
+// tenant policy in a schema of its own. The pool holds a single connection so the
+// session's search path and role apply to every query. The tests also skip when
+// the platform role is missing and cannot be created.
+func openRLSTest(t *testing.T) *rlsFixture {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to connect to PostgreSQL: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get underlying sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetMaxIdleConns(1)
+	if err := database.InstallTenantScope(db); err != nil {
+		t.Fatalf("InstallTenantScope: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("RESET ROLE")
+		db.Exec("DROP SCHEMA IF EXISTS " + rlsTestSchema + " CASCADE")
+		sqlDB.Close()
+	})
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if err := db.Exec(query, args...).Error; err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	exec("DROP SCHEMA IF EXISTS " + rlsTestSchema + " CASCADE")
+	exec("CREATE SCHEMA " + rlsTestSchema)
+	exec("SET search_path TO " + rlsTestSchema)
+	exec(`CREATE TABLE tenant_invitations (
+		id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+		tenant_id uuid NOT NULL,
+		email text NOT NULL,
+		role text NOT NULL,
+		invited_by uuid NOT NULL,
+		token text NOT NULL UNIQUE,
+		status text DEFAULT 'pending',
+		expires_at timestamptz,
+		accepted_at timestamptz,
+		accepted_by uuid,
+		metadata jsonb,
+		created_at timestamptz,
+		updated_at timestamptz
+	)`)
+
+	if _, err := (&database.PostgresDB{DB: db}).EnableTenantRLS(context.Background(), rlsTestSchema); err != nil {
+		t.Fatalf("EnableTenantRLS: %v", err)
+	}
+
+	f := &rlsFixture{
+		db:          db,
+		tx:          database.NewGormTransactionManager(db),
+		repo:        &TenantInvitationRepositoryImpl{db: db},
+		tenantA:     uuid.New(),
+		tenantB:     uuid.New(),
+		invitedA:    uuid.New(),
+		invitedB:    uuid.New(),
+		expiredA:    uuid.New(),
+		expiredB:    uuid.New(),
+		sharedEmail: "shared@example.com",
+		tokenA:      "token-a",
+		tokenB:      "token-b",
+		unscoped:    context.Background(),
+		platform:    database.AsPlatform(context.Background()),
+	}
+	f.scopeA = database.WithTenantID(context.Background(), f.tenantA.String())
+
+	now := time.Now()
+	insert := `INSERT INTO tenant_invitations (id, tenant_id, email, role, invited_by, token, expires_at, created_at, updated_at)
+		VALUES (?, ?, ?, 'member', ?, ?, ?, ?, ?)`
+	inviter := uuid.New()
+	exec(insert, f.invitedA, f.tenantA, f.sharedEmail, inviter, f.tokenA, now.Add(time.Hour), now, now)
+	exec(insert, f.invitedB, f.tenantB, f.sharedEmail, inviter, f.tokenB, now.Add(time.Hour), now, now)
+	exec(insert, f.expiredA, f.tenantA, "expired-a@example.com", inviter, "expired-a", now.Add(-time.Hour), now, now)
+	exec(insert, f.expiredB, f.tenantB, "expired-b@example.com", inviter, "expired-b", now.Add(-time.Hour), now, now)
+
+	// Superusers and BYPASSRLS roles skip every policy, so such a user runs the
+	// tests as a plain role instead, one that may switch to the platform role
+	var bypass bool
+	if err := db.Raw("SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user").Row().Scan(&bypass); err != nil {
+		t.Fatalf("failed to look up the current role: %v", err)
+	}
+	if bypass {
+		exec(`DO $$ BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'rls_test_app') THEN CREATE ROLE rls_test_app NOLOGIN; END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = '` + database.PlatformRole + `') THEN CREATE ROLE ` + database.PlatformRole + ` NOLOGIN BYPASSRLS; END IF;
+		END $$`)
+		exec("GRANT USAGE ON SCHEMA " + rlsTestSchema + " TO rls_test_app, " + database.PlatformRole)
+		exec("GRANT ALL ON ALL TABLES IN SCHEMA " + rlsTestSchema + " TO rls_test_app, " + database.PlatformRole)
+		exec("SET ROLE rls_test_app")
+		return f
+	}
+
+	var member bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = ? AND pg_has_role(current_user, oid, 'MEMBER'))", database.PlatformRole).Row().Scan(&member); err != nil {
+		t.Fatalf("failed to look up the platform role: %v", err)
+	}
+	if !member {
+		t.Skipf("%s does not exist or the current user cannot switch to it", database.PlatformRole)
+	}
+	exec("GRANT USAGE ON SCHEMA " + rlsTestSchema + " TO " + database.PlatformRole)
+	exec("GRANT ALL ON ALL TABLES IN SCHEMA " + rlsTestSchema + " TO " + database.PlatformRole)
+	return f
+}
+
+// invitationStatus reads an invitation's status as the platform role
+func (f *rlsFixture) invitationStatus(t *testing.T, id uuid.UUID) string {
+	t.Helper()
+	invitation, err := f.repo.GetByID(f.platform, id)
+	if err != nil {
+		t.Fatalf("GetByID(%s) as platform: %v", id, err)
+	}
+	return invitation.Status
+}
+
+func TestRLSHidesOtherTenantsRows(t *testing.T) {
+	f := openRLSTest(t)
+
+	err := f.tx.WithinTransaction(f.scopeA, func(ctx context.Context) error {
+		if _, err := f.repo.GetByID(ctx, f.invitedB); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("GetByID of the other tenant's invitation error = %v, want ErrRecordNotFound", err)
+		}
+		if _, err := f.repo.GetByToken(ctx, f.tokenB); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("GetByToken of the other tenant's invitation error = %v, want ErrRecordNotFound", err)
+		}
+
+		// ListByEmail has no tenant filter at all
+		invitations, err := f.repo.ListByEmail(ctx, f.sharedEmail)
+		if err != nil {
+			return err
+		}
+		if len(invitations) != 1 || invitations[0].ID != f.invitedA {
+			t.Errorf("ListByEmail returned %d invitations, want only the tenant's own", len(invitations))
+		}
+
+		invitations, err = f.repo.ListByTenant(ctx, f.tenantB, 10, 0)
+		if err != nil {
+			return err
+		}
+		if len(invitations) != 0 {
+			t.Errorf("ListByTenant of the other tenant returned %d invitations, want none", len(invitations))
+		}
+
+		if _, err := f.repo.GetByID(ctx, f.invitedA); err != nil {
+			t.Errorf("GetByID of the tenant's own invitation: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("tenant transaction: %v", err)
+	}
+}
+
+func TestRLSBlocksWritesToOtherTenantsRows(t *testing.T) {
+	f := openRLSTest(t)
+
+	err := f.tx.WithinTransaction(f.scopeA, func(ctx context.Context) error {
+		if err := f.repo.RevokeInvitation(ctx, f.invitedB); err != nil {
+			return err
+		}
+		// CleanupExpiredInvitations updates every expired invitation it can see
+		return f.repo.CleanupExpiredInvitations(ctx)
+	})
+	if err != nil {
+		t.Fatalf("tenant transaction: %v", err)
+	}
+
+	if status := f.invitationStatus(t, f.invitedB); status != "pending" {
+		t.Errorf("the other tenant's invitation was revoked: status %q", status)
+	}
+	if status := f.invitationStatus(t, f.expiredB); status != "pending" {
+		t.Errorf("the other tenant's expired invitation was cleaned up: status %q", status)
+	}
+	if status := f.invitationStatus(t, f.expiredA); status != "expired" {
+		t.Errorf("the tenant's own expired invitation has status %q, want expired", status)
+	}
+
+	err = f.tx.WithinTransaction(f.scopeA, func(ctx context.Context) error {
+		return database.DBFromContext(ctx, f.db).Exec(`INSERT INTO tenant_invitations (tenant_id, email, role, invited_by, token)
+			VALUES (?, 'intruder@example.com', 'member', ?, 'intruder')`, f.tenantB, uuid.New()).Error
+	})
+	if err == nil {
+		t.Error("a tenant transaction inserted a row for another tenant")
+	}
+}
+
+func TestRLSScopesTransactionsFromRequestContext(t *testing.T) {
+	f := openRLSTest(t)
+
+	// Fiber keeps request locals, such as the tenant set by the auth middleware,
+	// as user values of the fasthttp request context that handlers pass on
+	request := &fasthttp.RequestCtx{}
+	request.SetUserValue("tenant_id", f.tenantB.String())
+
+	err := f.tx.WithinTransaction(request, func(ctx context.Context) error {
+		invitations, err := f.repo.ListByEmail(ctx, f.sharedEmail)
+		if err != nil {
+			return err
+		}
+		if len(invitations) != 1 || invitations[0].ID != f.invitedB {
+			t.Errorf("ListByEmail returned %d invitations, want only the request tenant's", len(invitations))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("request transaction: %v", err)
+	}
+}
+
+func TestRLSScopesReadsOutsideTransactions(t *testing.T) {
+	f := openRLSTest(t)
+
+	invitations, err := f.repo.ListByEmail(f.scopeA, f.sharedEmail)
+	if err != nil {
+		t.Fatalf("ListByEmail: %v", err)
+	}
+	if len(invitations) != 1 || invitations[0].ID != f.invitedA {
+		t.Errorf("ListByEmail returned %d invitations, want only the tenant's own", len(invitations))
+	}
+
+	request := &fasthttp.RequestCtx{}
+	request.SetUserValue("tenant_id", f.tenantB.String())
+	invitations, err = f.repo.ListByEmail(request, f.sharedEmail)
+	if err != nil {
+		t.Fatalf("ListByEmail for the request: %v", err)
+	}
+	if len(invitations) != 1 || invitations[0].ID != f.invitedB {
+		t.Errorf("ListByEmail for the request returned %d invitations, want only the request tenant's", len(invitations))
+	}
+}
+
+func TestRLSSettingDoesNotOutliveTransaction(t *testing.T) {
+	f := openRLSTest(t)
+
+	if err := f.tx.WithinTransaction(f.scopeA, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("tenant transaction: %v", err)
+	}
+
+	// The pool's single connection served the tenant transaction; code running
+	// on it afterwards without a tenant is not scoped to that tenant, and the
+	// policy fails closed
+	invitations, err := f.repo.ListByEmail(f.unscoped, f.sharedEmail)
+	if err != nil {
+		t.Fatalf("ListByEmail unscoped: %v", err)
+	}
+	if len(invitations) != 0 {
+		t.Errorf("ListByEmail unscoped returned %d invitations, want none", len(invitations))
+	}
+
+	invitations, err = f.repo.ListByEmail(f.platform, f.sharedEmail)
+	if err != nil {
+		t.Fatalf("ListByEmail as platform: %v", err)
+	}
+	if len(invitations) != 2 {
+		t.Errorf("ListByEmail as platform returned %d invitations, want both tenants'", len(invitations))
+	}
+}
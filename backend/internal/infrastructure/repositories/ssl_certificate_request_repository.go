@@ -8,6 +8,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 )
 
 // SSLCertificateRequestRepositoryImpl implements SSLCertificateRequestRepository
@@ -20,12 +21,12 @@ func NewSSLCertificateRequestRepository(db *gorm.DB) *SSLCertificateRequestRepos
 }
 
 func (r *SSLCertificateRequestRepositoryImpl) Create(ctx context.Context, request *domain.SSLCertificateRequest) error {
-	return r.db.WithContext(ctx).Create(request).Error
+	return database.DBFromContext(ctx, r.db).Create(request).Error
 }
 
 func (r *SSLCertificateRequestRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.SSLCertificateRequest, error) {
 	var request domain.SSLCertificateRequest
-	err := r.db.WithContext(ctx).First(&request, "id = ?", id).Error
+	err := database.DBFromContext(ctx, r.db).First(&request, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -34,40 +35,40 @@ func (r *SSLCertificateRequestRepositoryImpl) GetByID(ctx context.Context, id uu
 
 func (r *SSLCertificateRequestRepositoryImpl) GetByDomainID(ctx context.Context, domainID uuid.UUID) ([]*domain.SSLCertificateRequest, error) {
 	var requests []*domain.SSLCertificateRequest
-	err := r.db.WithContext(ctx).Where("domain_id = ?", domainID).Order("created_at DESC").Find(&requests).Error
+	err := database.DBFromContext(ctx, r.db).Where("domain_id = ?", domainID).Order("created_at DESC").Find(&requests).Error
 	return requests, err
 }
 
 func (r *SSLCertificateRequestRepositoryImpl) GetByStatus(ctx context.Context, status string) ([]*domain.SSLCertificateRequest, error) {
 	var requests []*domain.SSLCertificateRequest
-	err := r.db.WithContext(ctx).Where("status = ?", status).Find(&requests).Error
+	err := database.DBFromContext(ctx, r.db).Where("status = ?", status).Find(&requests).Error
 	return requests, err
 }
 
 func (r *SSLCertificateRequestRepositoryImpl) Update(ctx context.Context, request *domain.SSLCertificateRequest) error {
-	return r.db.WithContext(ctx).Save(request).Error
+	return database.DBFromContext(ctx, r.db).Save(request).Error
 }
 
 func (r *SSLCertificateRequestRepositoryImpl) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.SSLCertificateRequest{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.SSLCertificateRequest{}, "id = ?", id).Error
 }
 
 func (r *SSLCertificateRequestRepositoryImpl) GetPendingRequests(ctx context.Context) ([]*domain.SSLCertificateRequest, error) {
 	var requests []*domain.SSLCertificateRequest
-	err := r.db.WithContext(ctx).Where("status IN ? AND attempt_count < max_attempts",
+	err := database.DBFromContext(ctx, r.db).Where("status IN ? AND attempt_count < max_attempts",
 		[]string{"pending", "processing"}).Find(&requests).Error
 	return requests, err
 }
 
 func (r *SSLCertificateRequestRepositoryImpl) GetExpiredRequests(ctx context.Context) ([]*domain.SSLCertificateRequest, error) {
 	var requests []*domain.SSLCertificateRequest
-	err := r.db.WithContext(ctx).Where("expires_at <= ? AND status NOT IN ?",
+	err := database.DBFromContext(ctx, r.db).Where("expires_at <= ? AND status NOT IN ?",
 		time.Now(), []string{"completed", "failed"}).Find(&requests).Error
 	return requests, err
 }
 
 func (r *SSLCertificateRequestRepositoryImpl) IncrementAttemptCount(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Model(&domain.SSLCertificateRequest{}).Where("id = ?", id).
+	return database.DBFromContext(ctx, r.db).Model(&domain.SSLCertificateRequest{}).Where("id = ?", id).
 		Updates(map[string]interface{}{
 			"attempt_count":   gorm.Expr("attempt_count + 1"),
 			"last_attempt_at": time.Now(),
@@ -75,7 +76,7 @@ func (r *SSLCertificateRequestRepositoryImpl) IncrementAttemptCount(ctx context.
 }
 
 func (r *SSLCertificateRequestRepositoryImpl) MarkAsCompleted(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Model(&domain.SSLCertificateRequest{}).Where("id = ?", id).
+	return database.DBFromContext(ctx, r.db).Model(&domain.SSLCertificateRequest{}).Where("id = ?", id).
 		Updates(map[string]interface{}{
 			"status":       "completed",
 			"completed_at": time.Now(),
@@ -83,6 +84,6 @@ func (r *SSLCertificateRequestRepositoryImpl) MarkAsCompleted(ctx context.Contex
 }
 
 func (r *SSLCertificateRequestRepositoryImpl) UpdateChallengeData(ctx context.Context, id uuid.UUID, challengeData map[string]interface{}) error {
-	return r.db.WithContext(ctx).Model(&domain.SSLCertificateRequest{}).Where("id = ?", id).
+	return database.DBFromContext(ctx, r.db).Model(&domain.SSLCertificateRequest{}).Where("id = ?", id).
 		Update("challenge_data", challengeData).Error
 }
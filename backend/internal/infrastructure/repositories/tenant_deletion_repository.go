@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
+	"gorm.io/gorm"
+)
+
+// TenantDeletionRepositoryImpl implements the TenantDeletionRepository interface
+type TenantDeletionRepositoryImpl struct {
+	db *gorm.DB
+}
+
+// NewTenantDeletionRepository creates a new tenant deletion repository
+func NewTenantDeletionRepository(db *gorm.DB) domain.TenantDeletionRepository {
+	return &TenantDeletionRepositoryImpl{db: db}
+}
+
+// Create creates a new tenant deletion. The open deletion index allows one
+// scheduled or purging deletion per tenant.
+func (r *TenantDeletionRepositoryImpl) Create(ctx context.Context, deletion *domain.TenantDeletion) error {
+	err := database.DBFromContext(ctx, r.db).Create(deletion).Error
+	if database.IsDuplicateKey(err) {
+		return domain.ErrTenantDeletionOpen
+	}
+	return err
+}
+
+// GetByID gets a tenant deletion by ID
+func (r *TenantDeletionRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.TenantDeletion, error) {
+	var deletion domain.TenantDeletion
+	err := database.DBFromContext(ctx, r.db).First(&deletion, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &deletion, nil
+}
+
+// Update updates a tenant deletion
+func (r *TenantDeletionRepositoryImpl) Update(ctx context.Context, deletion *domain.TenantDeletion) error {
+	return database.DBFromContext(ctx, r.db).Save(deletion).Error
+}
+
+// UpdateIfStatus updates a tenant deletion whose stored status is still status
+func (r *TenantDeletionRepositoryImpl) UpdateIfStatus(ctx context.Context, deletion *domain.TenantDeletion, status string) (bool, error) {
+	result := database.DBFromContext(ctx, r.db).
+		Model(deletion).
+		Where("status = ?", status).
+		Select("*").
+		Omit("created_at").
+		Updates(deletion)
+	return result.RowsAffected == 1, result.Error
+}
+
+// ListByTenant lists a tenant's deletions, newest first
+func (r *TenantDeletionRepositoryImpl) ListByTenant(ctx context.Context, tenantID uuid.UUID) ([]*domain.TenantDeletion, error) {
+	var deletions []*domain.TenantDeletion
+	err := database.DBFromContext(ctx, r.db).
+		Where("tenant_id = ?", tenantID).
+		Order("requested_at DESC").
+		Find(&deletions).Error
+	return deletions, err
+}
+
+// GetOpenByTenant gets the tenant's deletion that is scheduled or being purged
+func (r *TenantDeletionRepositoryImpl) GetOpenByTenant(ctx context.Context, tenantID uuid.UUID) (*domain.TenantDeletion, error) {
+	var deletion domain.TenantDeletion
+	err := database.DBFromContext(ctx, r.db).
+		Where("tenant_id = ? AND status IN (?, ?)", tenantID, domain.TenantDeletionStatusScheduled, domain.TenantDeletionStatusPurging).
+		First(&deletion).Error
+	if err != nil {
+		return nil, err
+	}
+	return &deletion, nil
+}
+
+// ListDue lists deletions whose grace period ended by at, including purges that
+// were interrupted
+func (r *TenantDeletionRepositoryImpl) ListDue(ctx context.Context, at time.Time, limit int) ([]*domain.TenantDeletion, error) {
+	var deletions []*domain.TenantDeletion
+	err := database.DBFromContext(ctx, r.db).
+		Where("status IN (?, ?) AND purge_after <= ?", domain.TenantDeletionStatusScheduled, domain.TenantDeletionStatusPurging, at).
+		Order("purge_after ASC").
+		Limit(limit).
+		Find(&deletions).Error
+	return deletions, err
+}
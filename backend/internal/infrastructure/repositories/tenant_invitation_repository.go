@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 	"gorm.io/gorm"
 )
 
@@ -21,13 +22,13 @@ func NewTenantInvitationRepository(db *gorm.DB) domain.TenantInvitationRepositor
 
 // Create creates a new invitation
 func (r *TenantInvitationRepositoryImpl) Create(ctx context.Context, invitation *domain.TenantInvitation) error {
-	return r.db.WithContext(ctx).Create(invitation).Error
+	return database.DBFromContext(ctx, r.db).Create(invitation).Error
 }
 
 // GetByID gets an invitation by ID
 func (r *TenantInvitationRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.TenantInvitation, error) {
 	var invitation domain.TenantInvitation
-	err := r.db.WithContext(ctx).First(&invitation, "id = ?", id).Error
+	err := database.DBFromContext(ctx, r.db).First(&invitation, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +38,7 @@ func (r *TenantInvitationRepositoryImpl) GetByID(ctx context.Context, id uuid.UU
 // GetByToken gets an invitation by token
 func (r *TenantInvitationRepositoryImpl) GetByToken(ctx context.Context, token string) (*domain.TenantInvitation, error) {
 	var invitation domain.TenantInvitation
-	err := r.db.WithContext(ctx).First(&invitation, "token = ?", token).Error
+	err := database.DBFromContext(ctx, r.db).First(&invitation, "token = ?", token).Error
 	if err != nil {
 		return nil, err
 	}
@@ -46,18 +47,18 @@ func (r *TenantInvitationRepositoryImpl) GetByToken(ctx context.Context, token s
 
 // Update updates an invitation
 func (r *TenantInvitationRepositoryImpl) Update(ctx context.Context, invitation *domain.TenantInvitation) error {
-	return r.db.WithContext(ctx).Save(invitation).Error
+	return database.DBFromContext(ctx, r.db).Save(invitation).Error
 }
 
 // Delete deletes an invitation
 func (r *TenantInvitationRepositoryImpl) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.TenantInvitation{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.TenantInvitation{}, "id = ?", id).Error
 }
 
 // ListByTenant lists invitations for a tenant
 func (r *TenantInvitationRepositoryImpl) ListByTenant(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*domain.TenantInvitation, error) {
 	var invitations []*domain.TenantInvitation
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("tenant_id = ?", tenantID).
 		Limit(limit).
 		Offset(offset).
@@ -69,7 +70,7 @@ func (r *TenantInvitationRepositoryImpl) ListByTenant(ctx context.Context, tenan
 // ListByEmail lists invitations for an email
 func (r *TenantInvitationRepositoryImpl) ListByEmail(ctx context.Context, email string) ([]*domain.TenantInvitation, error) {
 	var invitations []*domain.TenantInvitation
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("email = ?", email).
 		Order("created_at DESC").
 		Find(&invitations).Error
@@ -79,7 +80,7 @@ func (r *TenantInvitationRepositoryImpl) ListByEmail(ctx context.Context, email
 // AcceptInvitation accepts an invitation
 func (r *TenantInvitationRepositoryImpl) AcceptInvitation(ctx context.Context, token string, userID uuid.UUID) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.TenantInvitation{}).
 		Where("token = ? AND status = ? AND expires_at > ?", token, "pending", now).
 		Updates(map[string]interface{}{
@@ -93,7 +94,7 @@ func (r *TenantInvitationRepositoryImpl) AcceptInvitation(ctx context.Context, t
 // RevokeInvitation revokes an invitation
 func (r *TenantInvitationRepositoryImpl) RevokeInvitation(ctx context.Context, id uuid.UUID) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.TenantInvitation{}).
 		Where("id = ?", id).
 		Updates(map[string]interface{}{
@@ -105,7 +106,7 @@ func (r *TenantInvitationRepositoryImpl) RevokeInvitation(ctx context.Context, i
 // CleanupExpiredInvitations cleans up expired invitations
 func (r *TenantInvitationRepositoryImpl) CleanupExpiredInvitations(ctx context.Context) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.TenantInvitation{}).
 		Where("status = ? AND expires_at < ?", "pending", now).
 		Updates(map[string]interface{}{
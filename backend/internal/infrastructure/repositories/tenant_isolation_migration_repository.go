@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
+	"gorm.io/gorm"
+)
+
+// TenantIsolationMigrationRepositoryImpl implements the TenantIsolationMigrationRepository interface
+type TenantIsolationMigrationRepositoryImpl struct {
+	db *gorm.DB
+}
+
+// NewTenantIsolationMigrationRepository creates a new tenant isolation migration repository
+func NewTenantIsolationMigrationRepository(db *gorm.DB) domain.TenantIsolationMigrationRepository {
+	return &TenantIsolationMigrationRepositoryImpl{db: db}
+}
+
+// Create creates a new isolation migration
+func (r *TenantIsolationMigrationRepositoryImpl) Create(ctx context.Context, migration *domain.TenantIsolationMigration) error {
+	return database.DBFromContext(ctx, r.db).Create(migration).Error
+}
+
+// GetByID gets an isolation migration by ID
+func (r *TenantIsolationMigrationRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.TenantIsolationMigration, error) {
+	var migration domain.TenantIsolationMigration
+	err := database.DBFromContext(ctx, r.db).First(&migration, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &migration, nil
+}
+
+// Update updates an isolation migration
+func (r *TenantIsolationMigrationRepositoryImpl) Update(ctx context.Context, migration *domain.TenantIsolationMigration) error {
+	return database.DBFromContext(ctx, r.db).Save(migration).Error
+}
+
+// ListByTenant lists a tenant's isolation migrations, newest first
+func (r *TenantIsolationMigrationRepositoryImpl) ListByTenant(ctx context.Context, tenantID uuid.UUID) ([]*domain.TenantIsolationMigration, error) {
+	var migrations []*domain.TenantIsolationMigration
+	err := database.DBFromContext(ctx, r.db).
+		Where("tenant_id = ?", tenantID).
+		Order("started_at DESC").
+		Find(&migrations).Error
+	return migrations, err
+}
+
+// GetOpenByTenant gets the tenant's isolation migration that is copying or cutting over
+func (r *TenantIsolationMigrationRepositoryImpl) GetOpenByTenant(ctx context.Context, tenantID uuid.UUID) (*domain.TenantIsolationMigration, error) {
+	var migration domain.TenantIsolationMigration
+	err := database.DBFromContext(ctx, r.db).
+		Where("tenant_id = ? AND status IN (?, ?)", tenantID, domain.TenantMigrationStatusCopying, domain.TenantMigrationStatusCutover).
+		First(&migration).Error
+	if err != nil {
+		return nil, err
+	}
+	return &migration, nil
+}
+
+// ListOpen lists the isolation migrations of every tenant that are copying or cutting over
+func (r *TenantIsolationMigrationRepositoryImpl) ListOpen(ctx context.Context) ([]*domain.TenantIsolationMigration, error) {
+	var migrations []*domain.TenantIsolationMigration
+	err := database.DBFromContext(ctx, r.db).
+		Where("status IN (?, ?)", domain.TenantMigrationStatusCopying, domain.TenantMigrationStatusCutover).
+		Order("started_at").
+		Find(&migrations).Error
+	return migrations, err
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 	"gorm.io/gorm"
 )
 
@@ -21,13 +22,13 @@ func NewTenantOnboardingRepository(db *gorm.DB) domain.TenantOnboardingRepositor
 
 // Create creates a new onboarding log
 func (r *TenantOnboardingRepositoryImpl) Create(ctx context.Context, log *domain.TenantOnboardingLog) error {
-	return r.db.WithContext(ctx).Create(log).Error
+	return database.DBFromContext(ctx, r.db).Create(log).Error
 }
 
 // GetByID gets an onboarding log by ID
 func (r *TenantOnboardingRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.TenantOnboardingLog, error) {
 	var log domain.TenantOnboardingLog
-	err := r.db.WithContext(ctx).First(&log, "id = ?", id).Error
+	err := database.DBFromContext(ctx, r.db).First(&log, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -36,18 +37,18 @@ func (r *TenantOnboardingRepositoryImpl) GetByID(ctx context.Context, id uuid.UU
 
 // Update updates an onboarding log
 func (r *TenantOnboardingRepositoryImpl) Update(ctx context.Context, log *domain.TenantOnboardingLog) error {
-	return r.db.WithContext(ctx).Save(log).Error
+	return database.DBFromContext(ctx, r.db).Save(log).Error
 }
 
 // Delete deletes an onboarding log
 func (r *TenantOnboardingRepositoryImpl) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.TenantOnboardingLog{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.TenantOnboardingLog{}, "id = ?", id).Error
 }
 
 // ListByTenant lists onboarding logs for a tenant
 func (r *TenantOnboardingRepositoryImpl) ListByTenant(ctx context.Context, tenantID uuid.UUID) ([]*domain.TenantOnboardingLog, error) {
 	var logs []*domain.TenantOnboardingLog
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("tenant_id = ?", tenantID).
 		Order("step ASC").
 		Find(&logs).Error
@@ -57,7 +58,7 @@ func (r *TenantOnboardingRepositoryImpl) ListByTenant(ctx context.Context, tenan
 // GetByTenantAndStep gets an onboarding log by tenant and step
 func (r *TenantOnboardingRepositoryImpl) GetByTenantAndStep(ctx context.Context, tenantID uuid.UUID, step int) (*domain.TenantOnboardingLog, error) {
 	var log domain.TenantOnboardingLog
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("tenant_id = ? AND step = ?", tenantID, step).
 		First(&log).Error
 	if err != nil {
@@ -72,7 +73,7 @@ func (r *TenantOnboardingRepositoryImpl) UpdateStepStatus(ctx context.Context, t
 
 	// Try to find existing log entry
 	var log domain.TenantOnboardingLog
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("tenant_id = ? AND step = ?", tenantID, step).
 		First(&log).Error
 
@@ -93,7 +94,7 @@ func (r *TenantOnboardingRepositoryImpl) UpdateStepStatus(ctx context.Context, t
 			log.CompletedAt = &now
 		}
 
-		return r.db.WithContext(ctx).Create(&log).Error
+		return database.DBFromContext(ctx, r.db).Create(&log).Error
 	} else if err != nil {
 		return err
 	} else {
@@ -115,7 +116,7 @@ func (r *TenantOnboardingRepositoryImpl) UpdateStepStatus(ctx context.Context, t
 			updates["started_at"] = now
 		}
 
-		return r.db.WithContext(ctx).
+		return database.DBFromContext(ctx, r.db).
 			Model(&log).
 			Updates(updates).Error
 	}
@@ -124,7 +125,7 @@ func (r *TenantOnboardingRepositoryImpl) UpdateStepStatus(ctx context.Context, t
 // GetCurrentStep gets the current onboarding step for a tenant
 func (r *TenantOnboardingRepositoryImpl) GetCurrentStep(ctx context.Context, tenantID uuid.UUID) (*domain.TenantOnboardingLog, error) {
 	var log domain.TenantOnboardingLog
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("tenant_id = ? AND status IN (?, ?)", tenantID, "in_progress", "pending").
 		Order("step ASC").
 		First(&log).Error
@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 	"gorm.io/gorm"
 )
 
@@ -24,13 +25,13 @@ func NewTenantRepository(db *gorm.DB) domain.TenantRepository {
 
 // Create creates a new tenant
 func (r *TenantRepositoryImpl) Create(ctx context.Context, tenant *domain.Tenant) error {
-	return r.db.WithContext(ctx).Create(tenant).Error
+	return database.DBFromContext(ctx, r.db).Create(tenant).Error
 }
 
 // GetByID gets a tenant by ID
 func (r *TenantRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.Tenant, error) {
 	var tenant domain.Tenant
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		First(&tenant, "id = ?", id).Error
 	if err != nil {
 		return nil, err
@@ -41,7 +42,7 @@ func (r *TenantRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*doma
 // GetBySubdomain gets a tenant by subdomain
 func (r *TenantRepositoryImpl) GetBySubdomain(ctx context.Context, subdomain string) (*domain.Tenant, error) {
 	var tenant domain.Tenant
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		First(&tenant, "subdomain = ?", subdomain).Error
 	if err != nil {
 		return nil, err
@@ -52,7 +53,7 @@ func (r *TenantRepositoryImpl) GetBySubdomain(ctx context.Context, subdomain str
 // GetByDomain gets a tenant by domain
 func (r *TenantRepositoryImpl) GetByDomain(ctx context.Context, domainName string) (*domain.Tenant, error) {
 	var tenantDomain domain.TenantDomain
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		First(&tenantDomain, "domain = ?", domainName).Error
 	if err != nil {
 		return nil, err
@@ -69,18 +70,18 @@ func (r *TenantRepositoryImpl) GetByDomain(ctx context.Context, domainName strin
 
 // Update updates a tenant
 func (r *TenantRepositoryImpl) Update(ctx context.Context, tenant *domain.Tenant) error {
-	return r.db.WithContext(ctx).Save(tenant).Error
+	return database.DBFromContext(ctx, r.db).Save(tenant).Error
 }
 
 // Delete deletes a tenant
 func (r *TenantRepositoryImpl) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.Tenant{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.Tenant{}, "id = ?", id).Error
 }
 
 // List lists tenants with pagination
 func (r *TenantRepositoryImpl) List(ctx context.Context, limit, offset int) ([]*domain.Tenant, error) {
 	var tenants []*domain.Tenant
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Limit(limit).
 		Offset(offset).
 		Order("created_at DESC").
@@ -91,7 +92,7 @@ func (r *TenantRepositoryImpl) List(ctx context.Context, limit, offset int) ([]*
 // Count counts total tenants
 func (r *TenantRepositoryImpl) Count(ctx context.Context) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).Model(&domain.Tenant{}).Count(&count).Error
+	err := database.DBFromContext(ctx, r.db).Model(&domain.Tenant{}).Count(&count).Error
 	return count, err
 }
 
@@ -99,7 +100,7 @@ func (r *TenantRepositoryImpl) Count(ctx context.Context) (int64, error) {
 func (r *TenantRepositoryImpl) SearchTenants(ctx context.Context, query string, limit, offset int) ([]*domain.Tenant, error) {
 	var tenants []*domain.Tenant
 	searchQuery := "%" + query + "%"
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("name ILIKE ? OR plan ILIKE ?", searchQuery, searchQuery).
 		Limit(limit).
 		Offset(offset).
@@ -111,7 +112,7 @@ func (r *TenantRepositoryImpl) SearchTenants(ctx context.Context, query string,
 // ListByStatus lists tenants by status
 func (r *TenantRepositoryImpl) ListByStatus(ctx context.Context, status string, limit, offset int) ([]*domain.Tenant, error) {
 	var tenants []*domain.Tenant
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("status = ?", status).
 		Limit(limit).
 		Offset(offset).
@@ -123,7 +124,7 @@ func (r *TenantRepositoryImpl) ListByStatus(ctx context.Context, status string,
 // ListByPlan lists tenants by plan
 func (r *TenantRepositoryImpl) ListByPlan(ctx context.Context, plan string, limit, offset int) ([]*domain.Tenant, error) {
 	var tenants []*domain.Tenant
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("plan = ?", plan).
 		Limit(limit).
 		Offset(offset).
@@ -137,7 +138,7 @@ func (r *TenantRepositoryImpl) ListByPlan(ctx context.Context, plan string, limi
 // UpdateOnboardingStatus updates tenant onboarding status
 func (r *TenantRepositoryImpl) UpdateOnboardingStatus(ctx context.Context, tenantID uuid.UUID, status string, step int) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.Tenant{}).
 		Where("id = ?", tenantID).
 		Updates(map[string]interface{}{
@@ -150,7 +151,7 @@ func (r *TenantRepositoryImpl) UpdateOnboardingStatus(ctx context.Context, tenan
 // UpdateOnboardingData updates tenant onboarding data
 func (r *TenantRepositoryImpl) UpdateOnboardingData(ctx context.Context, tenantID uuid.UUID, data map[string]interface{}) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.Tenant{}).
 		Where("id = ?", tenantID).
 		Updates(map[string]interface{}{
@@ -162,7 +163,7 @@ func (r *TenantRepositoryImpl) UpdateOnboardingData(ctx context.Context, tenantI
 // GetTenantsByOnboardingStatus gets tenants by onboarding status
 func (r *TenantRepositoryImpl) GetTenantsByOnboardingStatus(ctx context.Context, status string, limit, offset int) ([]*domain.Tenant, error) {
 	var tenants []*domain.Tenant
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("onboarding_status = ?", status).
 		Limit(limit).
 		Offset(offset).
@@ -177,7 +178,7 @@ func (r *TenantRepositoryImpl) GetTenantsByOnboardingStatus(ctx context.Context,
 func (r *TenantRepositoryImpl) UpdateSettings(ctx context.Context, tenantID uuid.UUID, settings *domain.TenantSettings) error {
 	now := time.Now()
 
-	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	return database.DBFromContext(ctx, r.db).Transaction(func(tx *gorm.DB) error {
 		// Update the tenant's updated_at timestamp
 		if err := tx.Model(&domain.Tenant{}).
 			Where("id = ?", tenantID).
@@ -196,7 +197,7 @@ func (r *TenantRepositoryImpl) UpdateSettings(ctx context.Context, tenantID uuid
 func (r *TenantRepositoryImpl) UpdateConfiguration(ctx context.Context, tenantID uuid.UUID, config *domain.TenantConfiguration) error {
 	now := time.Now()
 
-	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	return database.DBFromContext(ctx, r.db).Transaction(func(tx *gorm.DB) error {
 		// Update the tenant's updated_at timestamp
 		if err := tx.Model(&domain.Tenant{}).
 			Where("id = ?", tenantID).
@@ -215,7 +216,7 @@ func (r *TenantRepositoryImpl) UpdateConfiguration(ctx context.Context, tenantID
 func (r *TenantRepositoryImpl) UpdateBranding(ctx context.Context, tenantID uuid.UUID, branding *domain.TenantBranding) error {
 	now := time.Now()
 
-	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	return database.DBFromContext(ctx, r.db).Transaction(func(tx *gorm.DB) error {
 		// Update the tenant's updated_at timestamp
 		if err := tx.Model(&domain.Tenant{}).
 			Where("id = ?", tenantID).
@@ -234,7 +235,7 @@ func (r *TenantRepositoryImpl) UpdateBranding(ctx context.Context, tenantID uuid
 func (r *TenantRepositoryImpl) UpdateBilling(ctx context.Context, tenantID uuid.UUID, billing *domain.TenantBilling) error {
 	now := time.Now()
 
-	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	return database.DBFromContext(ctx, r.db).Transaction(func(tx *gorm.DB) error {
 		// Update the tenant's updated_at timestamp
 		if err := tx.Model(&domain.Tenant{}).
 			Where("id = ?", tenantID).
@@ -254,7 +255,7 @@ func (r *TenantRepositoryImpl) UpdateBilling(ctx context.Context, tenantID uuid.
 // ActivateTenant activates a tenant
 func (r *TenantRepositoryImpl) ActivateTenant(ctx context.Context, tenantID uuid.UUID) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.Tenant{}).
 		Where("id = ?", tenantID).
 		Updates(map[string]interface{}{
@@ -266,7 +267,7 @@ func (r *TenantRepositoryImpl) ActivateTenant(ctx context.Context, tenantID uuid
 // SuspendTenant suspends a tenant
 func (r *TenantRepositoryImpl) SuspendTenant(ctx context.Context, tenantID uuid.UUID) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.Tenant{}).
 		Where("id = ?", tenantID).
 		Updates(map[string]interface{}{
@@ -278,7 +279,7 @@ func (r *TenantRepositoryImpl) SuspendTenant(ctx context.Context, tenantID uuid.
 // CancelTenant cancels a tenant
 func (r *TenantRepositoryImpl) CancelTenant(ctx context.Context, tenantID uuid.UUID) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.Tenant{}).
 		Where("id = ?", tenantID).
 		Updates(map[string]interface{}{
@@ -294,7 +295,7 @@ func (r *TenantRepositoryImpl) IsSubdomainAvailable(ctx context.Context, subdoma
 	var count int64
 
 	// Check both subdomain field in tenants and domain field in tenant_domains
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Model(&domain.Tenant{}).
 		Where("subdomain = ?", subdomain).
 		Count(&count).Error
@@ -306,7 +307,7 @@ func (r *TenantRepositoryImpl) IsSubdomainAvailable(ctx context.Context, subdoma
 		return false, nil
 	}
 
-	err = r.db.WithContext(ctx).
+	err = database.DBFromContext(ctx, r.db).
 		Model(&domain.TenantDomain{}).
 		Where("domain = ?", subdomain+".example.com").
 		Count(&count).Error
@@ -332,12 +333,12 @@ func (r *TenantRepositoryImpl) ReserveSubdomain(ctx context.Context, subdomain s
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
-	return r.db.WithContext(ctx).Create(tenantDomain).Error
+	return database.DBFromContext(ctx, r.db).Create(tenantDomain).Error
 }
 
 // ReleaseSubdomain releases a subdomain
 func (r *TenantRepositoryImpl) ReleaseSubdomain(ctx context.Context, subdomain string) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Delete(&domain.TenantDomain{}, "domain LIKE ?", subdomain+"%").Error
 }
 
@@ -346,7 +347,7 @@ func (r *TenantRepositoryImpl) ReleaseSubdomain(ctx context.Context, subdomain s
 // GetTenantMetrics gets detailed tenant metrics
 func (r *TenantRepositoryImpl) GetTenantMetrics(ctx context.Context, tenantID uuid.UUID, metricType string, from, to time.Time) ([]*domain.TenantUsageMetrics, error) {
 	var metrics []*domain.TenantUsageMetrics
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("tenant_id = ? AND metric_type = ? AND recorded_at BETWEEN ? AND ?", tenantID, metricType, from, to).
 		Order("recorded_at DESC").
 		Find(&metrics).Error
@@ -355,7 +356,7 @@ func (r *TenantRepositoryImpl) GetTenantMetrics(ctx context.Context, tenantID uu
 
 // RecordUsageMetric records a usage metric
 func (r *TenantRepositoryImpl) RecordUsageMetric(ctx context.Context, metric *domain.TenantUsageMetrics) error {
-	return r.db.WithContext(ctx).Create(metric).Error
+	return database.DBFromContext(ctx, r.db).Create(metric).Error
 }
 
 // GetTenantStats gets basic tenant statistics
@@ -364,7 +365,7 @@ func (r *TenantRepositoryImpl) GetTenantStats(ctx context.Context, tenantID uuid
 
 	// Get user count
 	var userCount int64
-	if err := r.db.WithContext(ctx).
+	if err := database.DBFromContext(ctx, r.db).
 		Table("tenant_users").
 		Where("tenant_id = ?", tenantID).
 		Count(&userCount).Error; err == nil {
@@ -373,7 +374,7 @@ func (r *TenantRepositoryImpl) GetTenantStats(ctx context.Context, tenantID uuid
 
 	// Get domain count
 	var domainCount int64
-	if err := r.db.WithContext(ctx).
+	if err := database.DBFromContext(ctx, r.db).
 		Model(&domain.TenantDomain{}).
 		Where("tenant_id = ?", tenantID).
 		Count(&domainCount).Error; err == nil {
@@ -5,6 +5,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 	"gorm.io/gorm"
 )
 
@@ -20,13 +21,13 @@ func NewUserPreferenceRepository(db *gorm.DB) domain.UserPreferenceRepository {
 
 // Create creates a new user preference
 func (r *UserPreferenceRepositoryImpl) Create(ctx context.Context, preference *domain.UserPreference) error {
-	return r.db.WithContext(ctx).Create(preference).Error
+	return database.DBFromContext(ctx, r.db).Create(preference).Error
 }
 
 // GetByID retrieves a user preference by ID
 func (r *UserPreferenceRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.UserPreference, error) {
 	var preference domain.UserPreference
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("User").
 		Preload("Tenant").
 		First(&preference, "id = ?", id).Error
@@ -39,7 +40,7 @@ func (r *UserPreferenceRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID
 // GetByUserAndKey retrieves a user preference by user and key
 func (r *UserPreferenceRepositoryImpl) GetByUserAndKey(ctx context.Context, userID uuid.UUID, tenantID *uuid.UUID, category, key string) (*domain.UserPreference, error) {
 	var preference domain.UserPreference
-	query := r.db.WithContext(ctx).
+	query := database.DBFromContext(ctx, r.db).
 		Where("user_id = ? AND category = ? AND key = ?", userID, category, key)
 
 	if tenantID != nil {
@@ -57,12 +58,12 @@ func (r *UserPreferenceRepositoryImpl) GetByUserAndKey(ctx context.Context, user
 
 // Update updates a user preference
 func (r *UserPreferenceRepositoryImpl) Update(ctx context.Context, preference *domain.UserPreference) error {
-	return r.db.WithContext(ctx).Save(preference).Error
+	return database.DBFromContext(ctx, r.db).Save(preference).Error
 }
 
 // Delete deletes a user preference
 func (r *UserPreferenceRepositoryImpl) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.UserPreference{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.UserPreference{}, "id = ?", id).Error
 }
 
 // UpsertPreference creates or updates a user preference
@@ -75,7 +76,7 @@ func (r *UserPreferenceRepositoryImpl) UpsertPreference(ctx context.Context, use
 		Value:    value,
 	}
 
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Where("user_id = ? AND category = ? AND key = ? AND (tenant_id = ? OR (tenant_id IS NULL AND ? IS NULL))",
 			userID, category, key, tenantID, tenantID).
 		Assign(map[string]interface{}{
@@ -88,7 +89,7 @@ func (r *UserPreferenceRepositoryImpl) UpsertPreference(ctx context.Context, use
 // ListByUser retrieves all preferences for a user
 func (r *UserPreferenceRepositoryImpl) ListByUser(ctx context.Context, userID uuid.UUID, tenantID *uuid.UUID) ([]*domain.UserPreference, error) {
 	var preferences []*domain.UserPreference
-	query := r.db.WithContext(ctx).Where("user_id = ?", userID)
+	query := database.DBFromContext(ctx, r.db).Where("user_id = ?", userID)
 
 	if tenantID != nil {
 		query = query.Where("tenant_id = ?", *tenantID)
@@ -103,7 +104,7 @@ func (r *UserPreferenceRepositoryImpl) ListByUser(ctx context.Context, userID uu
 // ListByCategory retrieves preferences for a user by category
 func (r *UserPreferenceRepositoryImpl) ListByCategory(ctx context.Context, userID uuid.UUID, tenantID *uuid.UUID, category string) ([]*domain.UserPreference, error) {
 	var preferences []*domain.UserPreference
-	query := r.db.WithContext(ctx).
+	query := database.DBFromContext(ctx, r.db).
 		Where("user_id = ? AND category = ?", userID, category)
 
 	if tenantID != nil {
@@ -118,7 +119,7 @@ func (r *UserPreferenceRepositoryImpl) ListByCategory(ctx context.Context, userI
 
 // DeleteByUser deletes all preferences for a user
 func (r *UserPreferenceRepositoryImpl) DeleteByUser(ctx context.Context, userID uuid.UUID) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Delete(&domain.UserPreference{}, "user_id = ?", userID).Error
 }
 
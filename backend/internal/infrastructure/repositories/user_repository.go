@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 	"gorm.io/gorm"
 )
 
@@ -21,13 +22,13 @@ func NewUserRepository(db *gorm.DB) domain.UserRepository {
 
 // Create creates a new user
 func (r *UserRepositoryImpl) Create(ctx context.Context, user *domain.User) error {
-	return r.db.WithContext(ctx).Create(user).Error
+	return database.DBFromContext(ctx, r.db).Create(user).Error
 }
 
 // GetByID retrieves a user by ID
 func (r *UserRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
 	var user domain.User
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("TenantUsers").
 		Preload("UserRoles").
 		Preload("Sessions").
@@ -41,7 +42,7 @@ func (r *UserRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain
 // GetByEmail retrieves a user by email
 func (r *UserRepositoryImpl) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var user domain.User
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("TenantUsers").
 		Preload("UserRoles").
 		First(&user, "email = ?", email).Error
@@ -54,7 +55,7 @@ func (r *UserRepositoryImpl) GetByEmail(ctx context.Context, email string) (*dom
 // GetByUsername retrieves a user by username
 func (r *UserRepositoryImpl) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
 	var user domain.User
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("TenantUsers").
 		Preload("UserRoles").
 		First(&user, "username = ?", username).Error
@@ -67,7 +68,7 @@ func (r *UserRepositoryImpl) GetByUsername(ctx context.Context, username string)
 // GetByKeycloakUserID retrieves a user by Keycloak user ID
 func (r *UserRepositoryImpl) GetByKeycloakUserID(ctx context.Context, keycloakUserID string) (*domain.User, error) {
 	var user domain.User
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("TenantUsers").
 		Preload("UserRoles").
 		First(&user, "keycloak_user_id = ?", keycloakUserID).Error
@@ -79,23 +80,23 @@ func (r *UserRepositoryImpl) GetByKeycloakUserID(ctx context.Context, keycloakUs
 
 // Update updates a user
 func (r *UserRepositoryImpl) Update(ctx context.Context, user *domain.User) error {
-	return r.db.WithContext(ctx).Save(user).Error
+	return database.DBFromContext(ctx, r.db).Save(user).Error
 }
 
 // Delete hard deletes a user
 func (r *UserRepositoryImpl) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Unscoped().Delete(&domain.User{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Unscoped().Delete(&domain.User{}, "id = ?", id).Error
 }
 
 // SoftDelete soft deletes a user
 func (r *UserRepositoryImpl) SoftDelete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.User{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.User{}, "id = ?", id).Error
 }
 
 // List retrieves users with pagination
 func (r *UserRepositoryImpl) List(ctx context.Context, limit, offset int) ([]*domain.User, error) {
 	var users []*domain.User
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("TenantUsers").
 		Preload("UserRoles").
 		Limit(limit).
@@ -108,7 +109,7 @@ func (r *UserRepositoryImpl) List(ctx context.Context, limit, offset int) ([]*do
 // ListByTenant retrieves users by tenant with pagination
 func (r *UserRepositoryImpl) ListByTenant(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*domain.User, error) {
 	var users []*domain.User
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("TenantUsers").
 		Preload("UserRoles").
 		Joins("JOIN tenant_users ON users.id = tenant_users.user_id").
@@ -123,7 +124,7 @@ func (r *UserRepositoryImpl) ListByTenant(ctx context.Context, tenantID uuid.UUI
 // ListByRole retrieves users by role with pagination
 func (r *UserRepositoryImpl) ListByRole(ctx context.Context, role string, limit, offset int) ([]*domain.User, error) {
 	var users []*domain.User
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("TenantUsers").
 		Preload("UserRoles").
 		Joins("JOIN user_roles ON users.id = user_roles.user_id").
@@ -144,7 +145,7 @@ func (r *UserRepositoryImpl) ListSystemAdmins(ctx context.Context, limit, offset
 // ListTenantAdmins retrieves tenant admin users for a specific tenant
 func (r *UserRepositoryImpl) ListTenantAdmins(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*domain.User, error) {
 	var users []*domain.User
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("TenantUsers").
 		Preload("UserRoles").
 		Joins("JOIN tenant_users ON users.id = tenant_users.user_id").
@@ -160,7 +161,7 @@ func (r *UserRepositoryImpl) ListTenantAdmins(ctx context.Context, tenantID uuid
 func (r *UserRepositoryImpl) Search(ctx context.Context, query string, limit, offset int) ([]*domain.User, error) {
 	var users []*domain.User
 	searchPattern := "%" + query + "%"
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("TenantUsers").
 		Preload("UserRoles").
 		Where("first_name ILIKE ? OR last_name ILIKE ? OR email ILIKE ? OR username ILIKE ?",
@@ -176,7 +177,7 @@ func (r *UserRepositoryImpl) Search(ctx context.Context, query string, limit, of
 func (r *UserRepositoryImpl) SearchByTenant(ctx context.Context, tenantID uuid.UUID, query string, limit, offset int) ([]*domain.User, error) {
 	var users []*domain.User
 	searchPattern := "%" + query + "%"
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("TenantUsers").
 		Preload("UserRoles").
 		Joins("JOIN tenant_users ON users.id = tenant_users.user_id").
@@ -193,14 +194,14 @@ func (r *UserRepositoryImpl) SearchByTenant(ctx context.Context, tenantID uuid.U
 // Count counts all users
 func (r *UserRepositoryImpl) Count(ctx context.Context) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).Model(&domain.User{}).Count(&count).Error
+	err := database.DBFromContext(ctx, r.db).Model(&domain.User{}).Count(&count).Error
 	return count, err
 }
 
 // CountByTenant counts users by tenant
 func (r *UserRepositoryImpl) CountByTenant(ctx context.Context, tenantID uuid.UUID) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Model(&domain.User{}).
 		Joins("JOIN tenant_users ON users.id = tenant_users.user_id").
 		Where("tenant_users.tenant_id = ?", tenantID).
@@ -211,7 +212,7 @@ func (r *UserRepositoryImpl) CountByTenant(ctx context.Context, tenantID uuid.UU
 // CountByRole counts users by role
 func (r *UserRepositoryImpl) CountByRole(ctx context.Context, role string) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Model(&domain.User{}).
 		Joins("JOIN user_roles ON users.id = user_roles.user_id").
 		Joins("JOIN roles ON user_roles.role_id = roles.id").
@@ -222,7 +223,7 @@ func (r *UserRepositoryImpl) CountByRole(ctx context.Context, role string) (int6
 
 // UpdateProfile updates user profile fields
 func (r *UserRepositoryImpl) UpdateProfile(ctx context.Context, userID uuid.UUID, profile map[string]interface{}) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.User{}).
 		Where("id = ?", userID).
 		Updates(profile).Error
@@ -230,7 +231,7 @@ func (r *UserRepositoryImpl) UpdateProfile(ctx context.Context, userID uuid.UUID
 
 // UpdateAvatar updates user avatar URL
 func (r *UserRepositoryImpl) UpdateAvatar(ctx context.Context, userID uuid.UUID, avatarURL string) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.User{}).
 		Where("id = ?", userID).
 		Update("avatar_url", avatarURL).Error
@@ -238,7 +239,7 @@ func (r *UserRepositoryImpl) UpdateAvatar(ctx context.Context, userID uuid.UUID,
 
 // UpdatePreferences updates user preferences
 func (r *UserRepositoryImpl) UpdatePreferences(ctx context.Context, userID uuid.UUID, preferences map[string]interface{}) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.User{}).
 		Where("id = ?", userID).
 		Update("preferences", preferences).Error
@@ -247,7 +248,7 @@ func (r *UserRepositoryImpl) UpdatePreferences(ctx context.Context, userID uuid.
 // UpdateLastLogin updates user's last login time
 func (r *UserRepositoryImpl) UpdateLastLogin(ctx context.Context, userID uuid.UUID) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.User{}).
 		Where("id = ?", userID).
 		Updates(map[string]interface{}{
@@ -258,7 +259,7 @@ func (r *UserRepositoryImpl) UpdateLastLogin(ctx context.Context, userID uuid.UU
 
 // IncrementLoginCount increments user's login count
 func (r *UserRepositoryImpl) IncrementLoginCount(ctx context.Context, userID uuid.UUID) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.User{}).
 		Where("id = ?", userID).
 		Update("login_count", gorm.Expr("login_count + 1")).Error
@@ -266,7 +267,7 @@ func (r *UserRepositoryImpl) IncrementLoginCount(ctx context.Context, userID uui
 
 // UpdateStatus updates user status
 func (r *UserRepositoryImpl) UpdateStatus(ctx context.Context, userID uuid.UUID, status string) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.User{}).
 		Where("id = ?", userID).
 		Update("status", status).Error
@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/ilmsadmin/zplus-saas-base/internal/domain"
+	"github.com/ilmsadmin/zplus-saas-base/internal/infrastructure/database"
 	"gorm.io/gorm"
 )
 
@@ -21,13 +22,13 @@ func NewUserSessionRepository(db *gorm.DB) domain.UserSessionRepository {
 
 // Create creates a new user session
 func (r *UserSessionRepositoryImpl) Create(ctx context.Context, session *domain.UserSession) error {
-	return r.db.WithContext(ctx).Create(session).Error
+	return database.DBFromContext(ctx, r.db).Create(session).Error
 }
 
 // GetByID retrieves a user session by ID
 func (r *UserSessionRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (*domain.UserSession, error) {
 	var session domain.UserSession
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("User").
 		Preload("Tenant").
 		First(&session, "id = ?", id).Error
@@ -40,7 +41,7 @@ func (r *UserSessionRepositoryImpl) GetByID(ctx context.Context, id uuid.UUID) (
 // GetByToken retrieves a user session by token
 func (r *UserSessionRepositoryImpl) GetByToken(ctx context.Context, token string) (*domain.UserSession, error) {
 	var session domain.UserSession
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Preload("User").
 		Preload("Tenant").
 		Where("session_token = ? AND expires_at > ?", token, time.Now()).
@@ -53,29 +54,29 @@ func (r *UserSessionRepositoryImpl) GetByToken(ctx context.Context, token string
 
 // Update updates a user session
 func (r *UserSessionRepositoryImpl) Update(ctx context.Context, session *domain.UserSession) error {
-	return r.db.WithContext(ctx).Save(session).Error
+	return database.DBFromContext(ctx, r.db).Save(session).Error
 }
 
 // Delete deletes a user session
 func (r *UserSessionRepositoryImpl) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.UserSession{}, "id = ?", id).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.UserSession{}, "id = ?", id).Error
 }
 
 // DeleteByUserID deletes all sessions for a user
 func (r *UserSessionRepositoryImpl) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.UserSession{}, "user_id = ?", userID).Error
+	return database.DBFromContext(ctx, r.db).Delete(&domain.UserSession{}, "user_id = ?", userID).Error
 }
 
 // DeleteExpired deletes expired sessions
 func (r *UserSessionRepositoryImpl) DeleteExpired(ctx context.Context) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Delete(&domain.UserSession{}, "expires_at < ?", time.Now()).Error
 }
 
 // ListByUser retrieves sessions by user with pagination
 func (r *UserSessionRepositoryImpl) ListByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*domain.UserSession, error) {
 	var sessions []*domain.UserSession
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
 		Limit(limit).
 		Offset(offset).
@@ -87,7 +88,7 @@ func (r *UserSessionRepositoryImpl) ListByUser(ctx context.Context, userID uuid.
 // ListByTenant retrieves sessions by tenant with pagination
 func (r *UserSessionRepositoryImpl) ListByTenant(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*domain.UserSession, error) {
 	var sessions []*domain.UserSession
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Where("tenant_id = ? AND expires_at > ?", tenantID, time.Now()).
 		Limit(limit).
 		Offset(offset).
@@ -99,7 +100,7 @@ func (r *UserSessionRepositoryImpl) ListByTenant(ctx context.Context, tenantID u
 // CountActiveByUser counts active sessions for a user
 func (r *UserSessionRepositoryImpl) CountActiveByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).
+	err := database.DBFromContext(ctx, r.db).
 		Model(&domain.UserSession{}).
 		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
 		Count(&count).Error
@@ -108,7 +109,7 @@ func (r *UserSessionRepositoryImpl) CountActiveByUser(ctx context.Context, userI
 
 // UpdateLastAccessed updates the last accessed time for a session
 func (r *UserSessionRepositoryImpl) UpdateLastAccessed(ctx context.Context, token string) error {
-	return r.db.WithContext(ctx).
+	return database.DBFromContext(ctx, r.db).
 		Model(&domain.UserSession{}).
 		Where("session_token = ?", token).
 		Update("last_accessed_at", time.Now()).Error
@@ -0,0 +1,127 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+)
+
+// SMTPConfig holds SMTP server settings
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// UseTLS upgrades the connection with STARTTLS, or uses implicit TLS on port 465
+	UseTLS  bool
+	Timeout time.Duration
+}
+
+// SMTPMailTransport implements services.MailTransport over SMTP
+type SMTPMailTransport struct {
+	config SMTPConfig
+}
+
+// NewSMTPMailTransport creates a new SMTP mail transport
+func NewSMTPMailTransport(config SMTPConfig) *SMTPMailTransport {
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &SMTPMailTransport{config: config}
+}
+
+// Send delivers the message to the SMTP server
+func (t *SMTPMailTransport) Send(ctx context.Context, msg *services.MailMessage) error {
+	if len(msg.To) == 0 {
+		return errors.New("message has no recipients")
+	}
+	recipients, err := msg.Recipients()
+	if err != nil {
+		return err
+	}
+
+	body, err := msg.MIME()
+	if err != nil {
+		return err
+	}
+
+	client, err := t.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if t.config.Username != "" {
+		auth := smtp.PlainAuth("", t.config.Username, t.config.Password, t.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate with SMTP server: %w", err)
+		}
+	}
+
+	if err := client.Mail(msg.FromAddress); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return fmt.Errorf("failed to add recipient %s: %w", recipient.Address, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message data: %w", err)
+	}
+	if _, err := writer.Write(body); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+func (t *SMTPMailTransport) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(t.config.Host, strconv.Itoa(t.config.Port))
+	dialer := &net.Dialer{Timeout: t.config.Timeout}
+	tlsConfig := &tls.Config{ServerName: t.config.Host}
+
+	var conn net.Conn
+	var err error
+	if t.config.UseTLS && t.config.Port == 465 {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(t.config.Timeout))
+
+	client, err := smtp.NewClient(conn, t.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+
+	if t.config.UseTLS && t.config.Port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	return client, nil
+}
@@ -0,0 +1,360 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ilmsadmin/zplus-saas-base/internal/application/services"
+)
+
+// StripePaymentGateway implements services.PaymentGateway against the Stripe
+// PaymentIntents API, or any server speaking the same protocol (e.g. stripe-mock)
+type StripePaymentGateway struct {
+	client     *http.Client
+	secretKey  string
+	baseURL    string
+	apiVersion string
+}
+
+// StripeConfig represents Stripe gateway configuration
+type StripeConfig struct {
+	SecretKey  string        `json:"secret_key"`
+	BaseURL    string        `json:"base_url,omitempty"`    // Defaults to https://api.stripe.com
+	APIVersion string        `json:"api_version,omitempty"` // Sent as the Stripe-Version header
+	Timeout    time.Duration `json:"timeout,omitempty"`
+}
+
+// Currencies Stripe expects in major units rather than cents
+var stripeZeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true, "KRW": true, "MGA": true,
+	"PYG": true, "RWF": true, "UGX": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// NewStripePaymentGateway creates a new Stripe-compatible payment gateway
+func NewStripePaymentGateway(cfg StripeConfig) (*StripePaymentGateway, error) {
+	if cfg.SecretKey == "" {
+		return nil, fmt.Errorf("stripe secret key is required")
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.stripe.com"
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	return &StripePaymentGateway{
+		client:     &http.Client{Timeout: timeout},
+		secretKey:  cfg.SecretKey,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiVersion: cfg.APIVersion,
+	}, nil
+}
+
+// Name returns the gateway identifier used in PaymentData.Gateway
+func (g *StripePaymentGateway) Name() string {
+	return "stripe"
+}
+
+// Authorize creates and confirms a PaymentIntent, capturing it immediately when requested
+func (g *StripePaymentGateway) Authorize(ctx context.Context, req *services.PaymentGatewayRequest) (*services.PaymentGatewayResult, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(toStripeAmount(req.Amount, req.Currency), 10))
+	form.Set("currency", strings.ToLower(req.Currency))
+	form.Set("payment_method", req.Token)
+	form.Set("confirm", "true")
+	form.Set("description", req.Description)
+	form.Add("expand[]", "latest_charge.balance_transaction")
+	if req.Capture {
+		form.Set("capture_method", "automatic")
+	} else {
+		form.Set("capture_method", "manual")
+	}
+	form.Set("metadata[order_id]", req.OrderID.String())
+	for key, value := range req.Metadata {
+		form.Set(fmt.Sprintf("metadata[%s]", key), value)
+	}
+
+	intent, err := g.post(ctx, "/v1/payment_intents", form, req.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.intentResult(intent, req.Currency), nil
+}
+
+// Capture captures a previously authorized PaymentIntent, optionally for a lower amount
+func (g *StripePaymentGateway) Capture(ctx context.Context, authorizationID string, amount float64, idempotencyKey string) (*services.PaymentGatewayResult, error) {
+	intent, err := g.get(ctx, "/v1/payment_intents/"+url.PathEscape(authorizationID))
+	if err != nil {
+		return nil, err
+	}
+	if intent.isDeclined() {
+		return g.intentResult(intent, intent.Currency), nil
+	}
+
+	form := url.Values{}
+	form.Set("amount_to_capture", strconv.FormatInt(toStripeAmount(amount, intent.Currency), 10))
+	form.Add("expand[]", "latest_charge.balance_transaction")
+
+	intent, err = g.post(ctx, "/v1/payment_intents/"+url.PathEscape(authorizationID)+"/capture", form, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.intentResult(intent, intent.Currency), nil
+}
+
+// Void cancels an uncaptured PaymentIntent and releases the hold
+func (g *StripePaymentGateway) Void(ctx context.Context, authorizationID string) (*services.PaymentGatewayResult, error) {
+	intent, err := g.post(ctx, "/v1/payment_intents/"+url.PathEscape(authorizationID)+"/cancel", url.Values{}, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return g.intentResult(intent, intent.Currency), nil
+}
+
+// Refund refunds all or part of a captured PaymentIntent
+func (g *StripePaymentGateway) Refund(ctx context.Context, chargeID string, amount float64, idempotencyKey string) (*services.PaymentGatewayResult, error) {
+	intent, err := g.get(ctx, "/v1/payment_intents/"+url.PathEscape(chargeID))
+	if err != nil {
+		return nil, err
+	}
+	if intent.isDeclined() {
+		return g.intentResult(intent, intent.Currency), nil
+	}
+
+	form := url.Values{}
+	form.Set("payment_intent", chargeID)
+	form.Set("amount", strconv.FormatInt(toStripeAmount(amount, intent.Currency), 10))
+
+	body, err := g.do(ctx, http.MethodPost, "/v1/refunds", form, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var refund stripeRefund
+	if err := json.Unmarshal(body, &refund); err != nil {
+		return nil, fmt.Errorf("failed to decode stripe refund: %w", err)
+	}
+
+	result := &services.PaymentGatewayResult{
+		TransactionID: refund.ID,
+		Amount:        fromStripeAmount(refund.Amount, refund.Currency),
+		Raw:           rawJSON(body),
+	}
+	if refund.Error != nil {
+		result.TransactionID = chargeID
+		result.Status = services.GatewayStatusDeclined
+		result.FailureReason = refund.Error.reason()
+	} else if refund.Status == "failed" || refund.Status == "canceled" {
+		result.Status = services.GatewayStatusDeclined
+		result.FailureReason = refund.FailureReason
+	} else {
+		result.Status = services.GatewayStatusRefunded
+	}
+
+	return result, nil
+}
+
+// Helper methods
+
+type stripeError struct {
+	Type        string `json:"type"`
+	Code        string `json:"code"`
+	DeclineCode string `json:"decline_code"`
+	Message     string `json:"message"`
+}
+
+func (e *stripeError) reason() string {
+	if e.DeclineCode != "" {
+		return fmt.Sprintf("%s: %s", e.DeclineCode, e.Message)
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	return e.Message
+}
+
+type stripePaymentIntent struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	Amount         int64  `json:"amount"`
+	AmountReceived int64  `json:"amount_received"`
+	Currency       string `json:"currency"`
+	LatestCharge   *struct {
+		BalanceTransaction *struct {
+			Fee int64 `json:"fee"`
+		} `json:"balance_transaction"`
+	} `json:"latest_charge"`
+	LastPaymentError *stripeError `json:"last_payment_error"`
+	Error            *stripeError `json:"error"`
+
+	raw map[string]interface{}
+}
+
+func (i *stripePaymentIntent) isDeclined() bool {
+	return i.Error != nil || i.LastPaymentError != nil
+}
+
+type stripeRefund struct {
+	ID            string       `json:"id"`
+	Status        string       `json:"status"`
+	Amount        int64        `json:"amount"`
+	Currency      string       `json:"currency"`
+	FailureReason string       `json:"failure_reason"`
+	Error         *stripeError `json:"error"`
+}
+
+func (g *StripePaymentGateway) intentResult(intent *stripePaymentIntent, currency string) *services.PaymentGatewayResult {
+	result := &services.PaymentGatewayResult{
+		TransactionID: intent.ID,
+		Amount:        fromStripeAmount(intent.Amount, currency),
+		Raw:           intent.raw,
+	}
+
+	switch {
+	case intent.Error != nil:
+		result.Status = services.GatewayStatusDeclined
+		result.FailureReason = intent.Error.reason()
+	case intent.LastPaymentError != nil:
+		result.Status = services.GatewayStatusDeclined
+		result.FailureReason = intent.LastPaymentError.reason()
+	case intent.Status == "succeeded":
+		result.Status = services.GatewayStatusCaptured
+		result.Amount = fromStripeAmount(intent.AmountReceived, currency)
+	case intent.Status == "requires_capture":
+		result.Status = services.GatewayStatusAuthorized
+	case intent.Status == "canceled":
+		result.Status = services.GatewayStatusVoided
+	default:
+		result.Status = services.GatewayStatusDeclined
+		result.FailureReason = fmt.Sprintf("unexpected payment intent status: %s", intent.Status)
+	}
+
+	if intent.LatestCharge != nil && intent.LatestCharge.BalanceTransaction != nil {
+		result.Fee = fromStripeAmount(intent.LatestCharge.BalanceTransaction.Fee, currency)
+	}
+
+	return result
+}
+
+func (g *StripePaymentGateway) get(ctx context.Context, path string) (*stripePaymentIntent, error) {
+	body, err := g.do(ctx, http.MethodGet, path, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return decodeStripeIntent(body)
+}
+
+func (g *StripePaymentGateway) post(ctx context.Context, path string, form url.Values, idempotencyKey string) (*stripePaymentIntent, error) {
+	body, err := g.do(ctx, http.MethodPost, path, form, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	return decodeStripeIntent(body)
+}
+
+// do performs the request and returns the body. Card errors (HTTP 402) are
+// returned as a body carrying an "error" object so callers can record the
+// decline; any other non-2xx status is a transport-level error.
+func (g *StripePaymentGateway) do(ctx context.Context, method, path string, form url.Values, idempotencyKey string) ([]byte, error) {
+	var reader io.Reader
+	if form != nil {
+		reader = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build stripe request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+g.secretKey)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if g.apiVersion != "" {
+		req.Header.Set("Stripe-Version", g.apiVersion)
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("stripe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stripe response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusPaymentRequired || (resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return body, nil
+	}
+
+	var errBody struct {
+		Error *stripeError `json:"error"`
+	}
+	if json.Unmarshal(body, &errBody) == nil && errBody.Error != nil {
+		return nil, fmt.Errorf("stripe returned %d: %s", resp.StatusCode, errBody.Error.reason())
+	}
+	return nil, fmt.Errorf("stripe returned %d", resp.StatusCode)
+}
+
+func decodeStripeIntent(body []byte) (*stripePaymentIntent, error) {
+	var intent stripePaymentIntent
+	if err := json.Unmarshal(body, &intent); err != nil {
+		return nil, fmt.Errorf("failed to decode stripe payment intent: %w", err)
+	}
+	intent.raw = rawJSON(body)
+
+	// Declines carry the intent inside the error object
+	if intent.Error != nil && intent.ID == "" {
+		var wrapped struct {
+			Error struct {
+				PaymentIntent *stripePaymentIntent `json:"payment_intent"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(body, &wrapped) == nil && wrapped.Error.PaymentIntent != nil {
+			intent.ID = wrapped.Error.PaymentIntent.ID
+			intent.Amount = wrapped.Error.PaymentIntent.Amount
+			intent.Currency = wrapped.Error.PaymentIntent.Currency
+		}
+	}
+
+	return &intent, nil
+}
+
+func rawJSON(body []byte) map[string]interface{} {
+	raw := make(map[string]interface{})
+	json.Unmarshal(body, &raw)
+	return raw
+}
+
+func toStripeAmount(amount float64, currency string) int64 {
+	if stripeZeroDecimalCurrencies[strings.ToUpper(currency)] {
+		return int64(math.Round(amount))
+	}
+	return int64(math.Round(amount * 100))
+}
+
+func fromStripeAmount(amount int64, currency string) float64 {
+	if stripeZeroDecimalCurrencies[strings.ToUpper(currency)] {
+		return float64(amount)
+	}
+	return float64(amount) / 100
+}
@@ -17,6 +17,10 @@ type Config struct {
 	MongoDB  MongoDBConfig
 	JWT      JWTConfig
 	Logger   LoggerConfig
+	Payment  PaymentConfig
+	Mail     MailConfig
+	Tenant   TenantConfig
+	Jobs     JobsConfig
 }
 
 type AppConfig struct {
@@ -71,6 +75,65 @@ type LoggerConfig struct {
 	OutputPath string
 }
 
+type PaymentConfig struct {
+	StripeSecretKey  string
+	StripeAPIVersion string
+	StripeAPIBaseURL string
+	GatewayTimeout   time.Duration
+
+	// How long an uncaptured authorization hold is kept before it is voided
+	AuthorizationWindow time.Duration
+	// How long order and payment idempotency keys are remembered
+	IdempotencyKeyTTL time.Duration
+}
+
+type MailConfig struct {
+	// smtp, file or memory
+	Transport string
+	FileDir   string
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPUseTLS   bool
+	SMTPTimeout  time.Duration
+
+	FromAddress   string
+	FromName      string
+	DefaultLocale string
+
+	// Failed deliveries are retried with exponential backoff up to MaxAttempts
+	MaxAttempts  int
+	RetryBackoff time.Duration
+}
+
+type TenantConfig struct {
+	// How long a deleted tenant can be restored before its data is purged
+	DeletionGracePeriod time.Duration
+	// Where tenant data export archives are written
+	ExportDir string
+	// Base64 Ed25519 private key seed that signs deletion certificates
+	CertificateSigningKey string
+}
+
+// JobsConfig sets how often background jobs run; zero disables a job
+type JobsConfig struct {
+	// How often authorization holds past the authorization window are voided
+	AuthorizationSweepInterval time.Duration
+	// How often queued and failed mail deliveries are sent
+	MailRetryInterval time.Duration
+	// How often paid orders missing from their customer's history are recorded
+	CustomerHistoryInterval time.Duration
+	// How often catalog imports stuck in progress are failed, and how long one may run
+	CatalogImportSweepInterval time.Duration
+	CatalogImportTimeout       time.Duration
+	// How often tenants whose deletion grace period is over are purged
+	TenantPurgeInterval time.Duration
+	// How often tenant isolation moves left behind by a stopped process are resumed
+	TenantMoveResumeInterval time.Duration
+}
+
 func Load() (*Config, error) {
 	// Load .env file if exists
 	if err := godotenv.Load(); err != nil {
@@ -124,6 +187,47 @@ func Load() (*Config, error) {
 			Format:     getEnv("LOG_FORMAT", "json"),
 			OutputPath: getEnv("LOG_OUTPUT_PATH", "stdout"),
 		},
+		Payment: PaymentConfig{
+			StripeSecretKey:  getEnv("STRIPE_SECRET_KEY", ""),
+			StripeAPIVersion: getEnv("STRIPE_API_VERSION", "2023-10-16"),
+			StripeAPIBaseURL: getEnv("STRIPE_API_BASE_URL", "https://api.stripe.com"),
+			GatewayTimeout:   getEnvAsDuration("PAYMENT_GATEWAY_TIMEOUT", 30*time.Second),
+
+			AuthorizationWindow: getEnvAsDuration("PAYMENT_AUTHORIZATION_WINDOW", 7*24*time.Hour),
+			IdempotencyKeyTTL:   getEnvAsDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		},
+		Mail: MailConfig{
+			Transport: getEnv("MAIL_TRANSPORT", "smtp"),
+			FileDir:   getEnv("MAIL_FILE_DIR", "./storage/mail"),
+
+			SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:     getEnvAsInt("SMTP_PORT", 1025),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			SMTPUseTLS:   getEnvAsBool("SMTP_USE_TLS", false),
+			SMTPTimeout:  getEnvAsDuration("SMTP_TIMEOUT", 30*time.Second),
+
+			FromAddress:   getEnv("SMTP_FROM_EMAIL", "noreply@zplus.io"),
+			FromName:      getEnv("SMTP_FROM_NAME", "Zplus SaaS"),
+			DefaultLocale: getEnv("DEFAULT_LOCALE", "en"),
+
+			MaxAttempts:  getEnvAsInt("MAIL_MAX_ATTEMPTS", 5),
+			RetryBackoff: getEnvAsDuration("MAIL_RETRY_BACKOFF", time.Minute),
+		},
+		Tenant: TenantConfig{
+			DeletionGracePeriod:   getEnvAsDuration("TENANT_DELETION_GRACE_PERIOD", 30*24*time.Hour),
+			ExportDir:             getEnv("TENANT_EXPORT_DIR", "./storage/exports"),
+			CertificateSigningKey: getEnv("TENANT_CERTIFICATE_SIGNING_KEY", ""),
+		},
+		Jobs: JobsConfig{
+			AuthorizationSweepInterval: getEnvAsDuration("JOB_AUTHORIZATION_SWEEP_INTERVAL", time.Hour),
+			MailRetryInterval:          getEnvAsDuration("JOB_MAIL_RETRY_INTERVAL", time.Minute),
+			CustomerHistoryInterval:    getEnvAsDuration("JOB_CUSTOMER_HISTORY_INTERVAL", 15*time.Minute),
+			CatalogImportSweepInterval: getEnvAsDuration("JOB_CATALOG_IMPORT_SWEEP_INTERVAL", 15*time.Minute),
+			CatalogImportTimeout:       getEnvAsDuration("JOB_CATALOG_IMPORT_TIMEOUT", 2*time.Hour),
+			TenantPurgeInterval:        getEnvAsDuration("JOB_TENANT_PURGE_INTERVAL", time.Hour),
+			TenantMoveResumeInterval:   getEnvAsDuration("JOB_TENANT_MOVE_RESUME_INTERVAL", time.Minute),
+		},
 	}
 
 	return config, nil